@@ -0,0 +1,707 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jth/archiver/internal/backup"
+	"github.com/jth/archiver/internal/config"
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/drives"
+	"github.com/jth/archiver/internal/dupes"
+	"github.com/jth/archiver/internal/image"
+	"github.com/jth/archiver/internal/remotename"
+	"github.com/jth/archiver/internal/scan"
+	"github.com/jth/archiver/internal/scratch"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+// stageUpload is the progress stage of backup uploads
+const stageUpload = "upload"
+
+var (
+	backupPrefix  string
+	backupDryRun  bool
+	backupVerbose bool
+
+	backupPhotoLayout  string
+	backupPhotoPrefix  string
+	backupNameTemplate string
+	backupFoldCase     bool
+	backupBestOfBurst  bool
+	backupUploads      int
+)
+
+// defaultUploads is how many files backup-diff uploads at once unless
+// configured
+const defaultUploads = 4
+
+// newBackupDiffCommand creates a command that backs up what changed in a folder
+func newBackupDiffCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup-diff",
+		Short: "Upload the files of a folder that are new or changed since the last backup",
+		Long: `Rescan a live folder, compare it with the catalog and upload only the files
+that were never uploaded or whose content changed since their last upload, so
+the archiver can be run repeatedly as an incremental backup. Files whose size
+and modification time are unchanged are not hashed again.
+
+Files are uploaded under --prefix (by default the folder name) with their path
+relative to the folder. Files that disappeared from the folder are reported
+but left in the bucket.
+
+--photo-layout date uploads photos under --photo-prefix by the year and month
+they were taken, from their EXIF DateTimeOriginal (photos/2016/07/IMG_1234.jpg),
+instead of by folder. Photos without a date keep the folder layout. A photo
+whose name is already used by a different photo gets the start of its hash
+added to the name. The names are recorded in the catalog.
+
+--name-template (or remote_name_template in the config) names uploads from
+placeholders instead of by folder, e.g. "{drive}/{relpath}" or
+"{year}/{month}/{hash[:2]}/{name}". Placeholders: {prefix}, {drive}, {path},
+{relpath}, {dir}, {name}, {stem}, {ext}, {year}, {month}, {day} (when a photo
+was taken, or else the file was modified) and {hash}, cut with e.g. {hash[:2]}.
+Names already used by other content are reported as collisions and, like
+photo names, disambiguated with the start of the hash.
+
+--case-insensitive (or case_insensitive_names in the config) also counts
+names differing only in case (Report.pdf and report.pdf) as collisions, for
+buckets that may be restored to a case-insensitive file system. The file
+uploaded first keeps the name. The names colliding files were given are
+recorded in the catalog.
+
+--best-of-burst uploads only the best photo of each group of near-identical
+photos in the folder, as archiver dupes --perceptual finds them; the others
+are recorded in the catalog as part of the best photo's burst.
+
+With raw_local set to preview in the config, an uploaded camera raw file is
+replaced on disk by its embedded JPEG preview (IMG_0001.CR2.jpg) and a stub
+pointing to the upload, once every destination has a copy.
+
+Each file is also copied to the replicas listed in the config, under the same
+name; files a replica doesn't hold yet are copied even if unchanged.
+Examples:
+  archiver backup-diff --source ~/Documents --dry-run
+  archiver backup-diff --source ~/Documents --bucket my-backup --prefix laptop/Documents
+  archiver backup-diff --source /Volumes/CameraCards --photo-layout date
+  archiver backup-diff --source ~/Documents --name-template "{drive}/{relpath}" --dry-run -v`,
+		Run: executeBackupDiff,
+	}
+
+	cmd.Flags().StringVarP(&sourcePath, "source", "s", "", "Folder to back up")
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Backblaze B2 bucket name (default: from config)")
+	cmd.Flags().StringVar(&backupPrefix, "prefix", "", "Prefix of the uploaded names (default: the folder name)")
+	cmd.Flags().StringVar(&backupNameTemplate, "name-template", "", "Template naming the uploads (default: remote_name_template from the config, or --prefix/{relpath})")
+	cmd.Flags().BoolVar(&backupFoldCase, "case-insensitive", false, "Treat names differing only in case as collisions (default: case_insensitive_names from the config)")
+	cmd.Flags().StringVar(&backupPhotoLayout, "photo-layout", "folder", "Remote layout of photos: folder, or date to organize them by when they were taken")
+	cmd.Flags().StringVar(&backupPhotoPrefix, "photo-prefix", "photos", "Prefix of photo names with --photo-layout date")
+	cmd.Flags().BoolVar(&backupBestOfBurst, "best-of-burst", false, "Upload only the best photo of each burst of near-identical photos")
+	cmd.Flags().IntVar(&backupUploads, "max-uploads", 0, "Maximum files uploaded at once (default: concurrency.uploads from the config, or 4)")
+	cmd.Flags().BoolVar(&includeAll, "include-all", false, "Disable the default exclusion lists")
+	cmd.Flags().BoolVar(&backupDryRun, "dry-run", false, "Report what would be uploaded without uploading")
+	cmd.Flags().BoolVarP(&backupVerbose, "verbose", "v", false, "List new, changed and missing files")
+	cmd.MarkFlagRequired("source")
+
+	return cmd
+}
+
+// executeBackupDiff rescans the folder and uploads what changed
+func executeBackupDiff(cmd *cobra.Command, args []string) {
+	source, err := filepath.Abs(sourcePath)
+	if err == nil {
+		var info os.FileInfo
+		if info, err = os.Stat(source); err == nil && !info.IsDir() {
+			err = fmt.Errorf("%s is not a folder", source)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !cmd.Flags().Changed("prefix") {
+		backupPrefix = filepath.Base(source)
+	}
+	if backupPhotoLayout != "folder" && backupPhotoLayout != "date" {
+		fmt.Fprintf(os.Stderr, "Error: unknown photo layout %q (expected folder or date)\n", backupPhotoLayout)
+		os.Exit(1)
+	}
+	if !cmd.Flags().Changed("name-template") {
+		backupNameTemplate = appConfig.RemoteNameTemplate
+	}
+	if !cmd.Flags().Changed("case-insensitive") {
+		backupFoldCase = appConfig.CaseInsensitiveNames
+	}
+	var template *remotename.Template
+	if backupNameTemplate != "" {
+		if template, err = remotename.Parse(backupNameTemplate); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if cmd.Flags().Changed("bucket") {
+		appConfig.B2Bucket = bucket
+	}
+	if !backupDryRun {
+		if err := appConfig.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer handleInterrupt(cancel)()
+
+	fmt.Fprintf(stdout, "Scanning %s\n", source)
+	present, err := rescan(ctx, source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning %s: %v\n", source, err)
+		os.Exit(1)
+	}
+
+	files, err := database.GetFilesInDirectory(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading catalog: %v\n", err)
+		os.Exit(1)
+	}
+	changes := backup.Diff(files, present)
+	var inBursts int
+	if backupBestOfBurst {
+		if changes, inBursts, err = skipBurstShots(ctx, database, changes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error grouping photos: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	replicas, err := loadReplicas(database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading replicas: %v\n", err)
+		os.Exit(1)
+	}
+
+	counts := make(map[backup.Status]int)
+	toCopy := make(map[string]int)
+	var pending []backup.Change
+	var pendingBytes, uploadBytes int64
+	for _, change := range changes {
+		counts[change.Status]++
+		if backupVerbose && change.Status != backup.StatusUnchanged {
+			fmt.Fprintf(stdout, "  %-9s %s\n", change.Status, change.File.RelativePath)
+		}
+
+		copies := 0
+		for _, r := range replicas {
+			if r.needs(change) {
+				toCopy[r.name]++
+				copies++
+			}
+		}
+		if change.NeedsUpload() {
+			uploadBytes += change.File.Size
+		}
+		if change.NeedsUpload() || copies > 0 {
+			pending = append(pending, change)
+			pendingBytes += change.File.Size
+		}
+	}
+
+	if backupFoldCase {
+		if err := database.FoldRemoteNames(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading remote names: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	targets := planRemoteNames(ctx, database, pending, template)
+	locked, retention, err := planRetention(pending, targets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	collisions, unnamed := 0, 0
+	for i, target := range targets {
+		switch {
+		case target.err != nil:
+			unnamed++
+			fmt.Fprintf(os.Stderr, "  Error: %v\n", target.err)
+		case target.collision != backup.NoCollision:
+			collisions++
+			if backupVerbose {
+				fmt.Fprintf(stdout, "  %s collision %s -> %s\n", target.collision, pending[i].File.RelativePath, target.name)
+			}
+		}
+	}
+
+	fmt.Fprintf(stdout, "\nNew: %d\n", counts[backup.StatusNew])
+	fmt.Fprintf(stdout, "Changed: %d\n", counts[backup.StatusChanged])
+	fmt.Fprintf(stdout, "Unchanged: %d\n", counts[backup.StatusUnchanged])
+	fmt.Fprintf(stdout, "Missing from the folder: %d\n", counts[backup.StatusMissing])
+	fmt.Fprintf(stdout, "To upload: %d file(s), %s\n", counts[backup.StatusNew]+counts[backup.StatusChanged], formatSize(uploadBytes))
+	for _, r := range replicas {
+		fmt.Fprintf(stdout, "To copy to %s: %d file(s)\n", r.name, toCopy[r.name])
+	}
+	if inBursts > 0 {
+		fmt.Fprintf(stdout, "Burst shots not uploaded: %d (the best of each burst is)\n", inBursts)
+	}
+	if locked > 0 {
+		fmt.Fprintf(stdout, "To lock: %d (%s)\n", locked, describeRetention(retention))
+	}
+	if collisions > 0 {
+		fmt.Fprintf(stdout, "Name collisions: %d (renamed with the start of their hash)\n", collisions)
+	}
+	if unnamed > 0 {
+		fmt.Fprintf(stdout, "Without a name: %d (they will fail)\n", unnamed)
+	}
+	if backupDryRun {
+		fmt.Fprintln(stdout, "Dry run: nothing was uploaded.")
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	uploader, err := newUploader()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+		os.Exit(1)
+	}
+	defer uploader.Close()
+	for _, r := range replicas {
+		if err := r.open(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: replica %s is unavailable, its copies will fail: %v\n", r.name, err)
+		}
+		defer r.close()
+	}
+
+	if err := uploadChanges(ctx, database, uploader, replicas, source, pending, targets, pendingBytes); err != nil {
+		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// skipBurstShots groups the folder's photos into bursts and leaves out the
+// changes of photos other than the best of their burst, returning how many
+// were left out
+func skipBurstShots(ctx context.Context, database *db.DB, changes []backup.Change) ([]backup.Change, int, error) {
+	var present []*db.FileStatus
+	for _, change := range changes {
+		if change.Status != backup.StatusMissing {
+			present = append(present, change.File)
+		}
+	}
+	bursts, err := groupBursts(ctx, database, present, dupes.DefaultBurstOptions())
+	if err != nil {
+		return nil, 0, err
+	}
+	best := dupes.BestOf(bursts)
+
+	kept := changes[:0]
+	skipped := 0
+	for _, change := range changes {
+		if bestID, ok := best[change.File.ID]; ok && bestID != change.File.ID && change.NeedsUpload() {
+			skipped++
+			continue
+		}
+		kept = append(kept, change)
+	}
+	return kept, skipped, nil
+}
+
+// rescan updates the catalog with the folder's current contents and returns
+// the paths found
+func rescan(ctx context.Context, source string) (map[string]bool, error) {
+	sourcePath, filesFrom = source, ""
+	scanner, err := newSourceScanner()
+	if err != nil {
+		return nil, err
+	}
+	defer scanner.Close()
+	if includeAll {
+		scanner.SetPolicy(nil)
+	}
+	scanner.SetReuseHashes(true)
+	scanner.SetHashGate(ctx.Err)
+
+	present := make(map[string]bool)
+	scanner.SetProgress(func(file scan.FileInfo) {
+		present[file.Path] = true
+	})
+	if err := scanner.Scan(ctx); err != nil {
+		return nil, err
+	}
+	return present, nil
+}
+
+// uploadChanges uploads the pending files, copies them to the replicas
+// missing them and records it all as a run. A Ctrl+C lets the current file
+// finish and stops before the next one, as does a replica folder filling up.
+func uploadChanges(ctx context.Context, database *db.DB, uploader *upload.B2Uploader, replicas []*replica,
+	source string, pending []backup.Change, targets []remoteTarget, pendingBytes int64) (err error) {
+	run, err := database.StartRun("backup-diff", source)
+	if err != nil {
+		return err
+	}
+
+	tracker := newTracker()
+	defer stopProgress()
+	tracker.UpdateTotals(int64(len(pending)), pendingBytes)
+	tracker.AddByteStage(stageUpload, "Uploading files", pendingBytes)
+
+	started := 0
+	defer func() {
+		stats := tracker.Statistics
+		run.FilesTotal = stats.TotalFiles
+		run.FilesProcessed = stats.ProcessedFiles
+		run.FilesFailed = stats.FailedFiles
+		run.BytesProcessed = stats.BytesProcessed
+		run.BytesUploaded = stats.BytesUploaded
+		run.FilesRemaining = int64(len(pending) - started)
+		run.Stage = stageUpload
+		if finishErr := database.FinishRun(run, err); finishErr != nil {
+			fmt.Fprintf(os.Stderr, "Error recording run %d: %v\n", run.ID, finishErr)
+		}
+		notifyRun(run)
+	}()
+
+	// Uploads in progress are finished when ctx is cancelled
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	work := context.WithoutCancel(ctx)
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < uploadWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				file := pending[i].File
+				uploaded, uploadErr := backupFile(work, database, uploader, replicas, run, pending[i], targets[i])
+				if errors.Is(uploadErr, scratch.ErrDiskFull) {
+					abort(uploadErr)
+				}
+				if uploadErr != nil {
+					logger.Warn("backup upload failed", "path", file.Path, "error", uploadErr)
+					tracker.UpdateFileStats(0, 0, 1, 0)
+					if dbErr := database.AddRunError(run.ID, file.Path, uploadErr); dbErr != nil {
+						logger.Warn("could not record error in the run history", "path", file.Path, "error", dbErr)
+					}
+				} else {
+					tracker.UpdateFileStats(1, 0, 0, file.Size)
+				}
+				if uploaded > 0 {
+					tracker.UpdateUploadStats(uploaded)
+				}
+				tracker.IncrementStage(stageUpload, file.Size)
+			}
+		}()
+	}
+
+dispatch:
+	for i := range pending {
+		if tracker.Wait(ctx) != nil {
+			break
+		}
+		select {
+		case queue <- i:
+			started++
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	stopProgress()
+	tracker.PrintSummary()
+	if cause := context.Cause(ctx); errors.Is(cause, scratch.ErrDiskFull) {
+		fmt.Fprintf(stdout, "\nRun %d stopped with %d file(s) left to upload: %v\nFree some space and run backup-diff again.\n",
+			run.ID, len(pending)-started, cause)
+		return fmt.Errorf("stopped during %s: %w", stageUpload, cause)
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintf(stdout, "\nRun %d was interrupted with %d file(s) left to upload. Run backup-diff again to upload them.\n",
+			run.ID, len(pending)-started)
+		return fmt.Errorf("interrupted during %s: %w", stageUpload, ctx.Err())
+	}
+	tracker.CompleteStage(stageUpload)
+	fmt.Fprintf(stdout, "Recorded as run %d (archiver runs show %d)\n", run.ID, run.ID)
+	return nil
+}
+
+// uploadWorkers returns how many files are uploaded at once: --max-uploads,
+// or concurrency.uploads from the config, or defaultUploads
+func uploadWorkers() int {
+	switch {
+	case backupUploads > 0:
+		return backupUploads
+	case appConfig.Concurrency.Uploads > 0:
+		return appConfig.Concurrency.Uploads
+	}
+	return defaultUploads
+}
+
+// backupFile uploads a pending file to the bucket if it is new or changed,
+// and copies it to the replicas missing its current content. A failed
+// destination doesn't keep the others from being tried. It returns the
+// bytes transferred.
+func backupFile(ctx context.Context, database *db.DB, uploader *upload.B2Uploader, replicas []*replica,
+	run *db.Run, change backup.Change, target remoteTarget) (int64, error) {
+	file := change.File
+	if target.err != nil {
+		return 0, target.err
+	}
+	if !target.taken.IsZero() {
+		if err := database.SetTakenAt(file.ID, target.taken); err != nil {
+			return 0, err
+		}
+	}
+
+	var transferred int64
+	var errs []error
+	var url string
+	if change.NeedsUpload() {
+		result, err := uploader.PutRetained(ctx, file.Path, target.name, uploadInfo(file, run), target.retention)
+		if err == nil {
+			err = database.RecordUpload(file.ID, result.URL, result.RemotePath, result.UploadedAt, file.SHA256)
+		}
+		if err == nil && target.retention != nil {
+			err = database.RecordLock(lockOf(file.ID, *target.retention))
+		}
+		if err == nil && target.collision != backup.NoCollision {
+			err = database.RecordNameMapping(&db.NameMapping{
+				FileID:     file.ID,
+				LayoutName: target.layoutName,
+				RemoteName: target.name,
+				Collision:  string(target.collision),
+			})
+		}
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			recordUploadProvenance(database, file, "b2", result, "")
+			transferred += file.Size
+			url = result.URL
+		}
+	}
+
+	for _, r := range replicas {
+		if !r.needs(change) {
+			continue
+		}
+		err := r.err
+		var result *upload.UploadResult
+		if err == nil {
+			result, err = r.dest.Put(ctx, file.Path, target.name, uploadInfo(file, run))
+		}
+		if err == nil {
+			err = database.RecordReplica(file.ID, r.name, result.URL, file.SHA256, result.UploadedAt)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("replica %s: %w", r.name, err))
+			continue
+		}
+		r.copied(file)
+		recordUploadProvenance(database, file, r.config.Type, result, r.name)
+		transferred += file.Size
+	}
+
+	// Only replace a raw file once every destination has a copy
+	if url != "" && len(errs) == 0 && appConfig.RawLocal == "preview" && image.IsRaw(file.Path) {
+		if err := keepRawPreview(ctx, database, uploader, file.Path, url); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return transferred, errors.Join(errs...)
+}
+
+// keepRawPreview replaces an uploaded camera raw file with its embedded JPEG
+// preview and a stub pointing to the upload, once the bucket is confirmed to
+// hold it. The stub is recorded so unstub can bring the raw file back.
+func keepRawPreview(ctx context.Context, database *db.DB, uploader *upload.B2Uploader, path, url string) error {
+	preview, err := image.RawPreview(path)
+	if err != nil {
+		return fmt.Errorf("raw preview: %w", err)
+	}
+	verify := func() error {
+		return uploader.Verify(ctx, url, path)
+	}
+	if _, err := database.ReplaceWithPreview(path, url, preview, db.StubMode(stubMode), verify); err != nil {
+		return fmt.Errorf("raw preview: %w", err)
+	}
+	logger.Debug("replaced raw file with its preview", "path", path, "preview", db.PreviewPath(path))
+	return nil
+}
+
+// recordUploadProvenance records an upload of a file, to the bucket or to
+// the named replica
+func recordUploadProvenance(database *db.DB, file *db.FileStatus, tool string, result *upload.UploadResult, replicaName string) {
+	details := "name=" + result.RemotePath
+	if replicaName != "" {
+		details += " replica=" + replicaName
+	}
+	err := database.RecordProvenance(&db.Provenance{
+		FileID:   file.ID,
+		Artifact: db.ArtifactUpload,
+		Tool:     tool,
+		Duration: result.ElapsedTime,
+		Details:  details,
+	})
+	if err != nil {
+		logger.Warn("could not record provenance", "artifact", db.ArtifactUpload, "file_id", file.ID, "error", err)
+	}
+}
+
+// remoteTarget is the name a pending file is uploaded under
+type remoteTarget struct {
+	name       string
+	taken      time.Time         // EXIF date of a photo, recorded when it is uploaded
+	layoutName string            // Name the layout gave the file, before a collision changed it
+	collision  backup.Collision  // Why the name was changed
+	err        error             // Why the file has no name
+	retention  *upload.Retention // Object Lock applied on upload, or nil
+}
+
+// planRemoteNames names the pending files in the bucket: by the date photos
+// were taken with --photo-layout date, otherwise by the name template or
+// below the prefix by folder. Names already used by other content, in the
+// catalog or earlier in the backup, are disambiguated, as are names
+// differing only in case with --case-insensitive.
+func planRemoteNames(ctx context.Context, database *db.DB, pending []backup.Change,
+	template *remotename.Template) []remoteTarget {
+	usesDate := template != nil && (template.Uses("year") || template.Uses("month") || template.Uses("day"))
+	names := backup.NewNames(database.RemoteNameOwner)
+	if backupFoldCase {
+		names.FoldCase(database.RemoteNameFoldOwner)
+	}
+
+	targets := make([]remoteTarget, len(pending))
+	for i, change := range pending {
+		file, target := change.File, &targets[i]
+
+		// Files only copied to a replica keep the name they were uploaded under
+		if !change.NeedsUpload() && file.RemoteName != "" {
+			target.name = file.RemoteName
+			continue
+		}
+
+		date := file.ModTime
+		if backup.IsPhoto(file) && (backupPhotoLayout == "date" || usesDate) {
+			if taken, err := image.DateTaken(ctx, file.Path); err == nil {
+				target.taken, date = taken, taken
+			} else {
+				logger.Debug("no photo date", "path", file.Path, "error", err)
+			}
+		}
+
+		var name string
+		switch {
+		case backupPhotoLayout == "date" && !target.taken.IsZero():
+			name = backup.PhotoName(backupPhotoPrefix, file, target.taken)
+		case template != nil:
+			name, target.err = template.Execute(remotename.Vars{
+				Prefix:  backupPrefix,
+				Path:    file.Path,
+				RelPath: file.RelativePath,
+				Drive:   drives.NameFromPath(file.Path),
+				Date:    date,
+				SHA256:  file.SHA256,
+			})
+			if target.err != nil {
+				continue
+			}
+		default:
+			name = backup.RemoteName(backupPrefix, file)
+		}
+
+		target.layoutName = name
+		target.name, target.collision, target.err = names.Assign(name, file)
+	}
+	return targets
+}
+
+// uploadInfo is the B2 file info stored with an upload, for retention
+// policies and for finding where a remote file came from
+func uploadInfo(file *db.FileStatus, run *db.Run) map[string]string {
+	info := map[string]string{"run_id": strconv.FormatInt(run.ID, 10)}
+	if drive := drives.NameFromPath(file.Path); drive != "" {
+		info["drive"] = drive
+	}
+	return info
+}
+
+// replica is an extra destination configured in replicas, which backups
+// copy every file to
+type replica struct {
+	name   string
+	config config.Replica
+	mu     sync.Mutex
+	done   map[int64]string // SHA-256 each file was last copied with
+
+	dest  upload.Destination
+	err   error // Why the destination can't be used
+	close func()
+}
+
+// loadReplicas returns the configured replicas with what was copied to them
+func loadReplicas(database *db.DB) ([]*replica, error) {
+	var replicas []*replica
+	for _, cfg := range appConfig.Replicas {
+		done, err := database.ReplicatedHashes(cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, &replica{name: cfg.Name, config: cfg, done: done, close: func() {}})
+	}
+	return replicas, nil
+}
+
+// needs reports whether the replica lacks the file's current content
+func (r *replica) needs(change backup.Change) bool {
+	if change.Status == backup.StatusMissing {
+		return false
+	}
+	r.mu.Lock()
+	sha256, ok := r.done[change.File.ID]
+	r.mu.Unlock()
+	return change.NeedsUpload() || !ok || sha256 != change.File.SHA256
+}
+
+// copied records that the replica holds the file's current content
+func (r *replica) copied(file *db.FileStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done[file.ID] = file.SHA256
+}
+
+// open connects to the destination. On failure the error is kept, failing
+// each copy to the replica.
+func (r *replica) open() error {
+	switch r.config.Type {
+	case "b2":
+		uploader, err := newUploaderFor(r.config.Bucket)
+		if err != nil {
+			r.err = err
+			return err
+		}
+		r.dest, r.close = uploader, func() { uploader.Close() }
+	default:
+		r.dest, r.err = upload.NewLocalDestination(r.config.Path)
+	}
+	return r.err
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bucketAllVersions bool
+	bucketNoUsage     bool
+)
+
+// newBucketCommand creates the command group for B2 buckets
+func newBucketCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bucket",
+		Short: "Create, list and inspect B2 buckets",
+		Long: `Manage buckets with the B2 credentials of the config, so setting up an archive
+doesn't need the B2 web console. The bucket defaults to b2_bucket.
+Examples:
+  archiver bucket create my-archive
+  archiver bucket list
+  archiver bucket info`,
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create [name]",
+		Short: "Create a private bucket that keeps only the last version of each file",
+		Long: `Create a private bucket. Unless --all-versions is given it gets a lifecycle
+rule deleting replaced and deleted versions a day after they are hidden; with
+b2_encryption set to SSE-B2 its files are encrypted by default.`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  executeBucketCreate,
+	}
+	createCmd.Flags().BoolVar(&bucketAllVersions, "all-versions", false, "Keep every version of every file")
+
+	infoCmd := &cobra.Command{
+		Use:   "info [name]",
+		Short: "Show a bucket's settings and how much it stores",
+		Long: `Show a bucket's type, encryption and lifecycle rules, and count the files
+and bytes it stores. Counting lists every file version, one class C
+transaction per 1000; --no-usage skips it.`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  executeBucketInfo,
+	}
+	infoCmd.Flags().BoolVar(&bucketNoUsage, "no-usage", false, "Don't count the files in the bucket")
+
+	cmd.AddCommand(createCmd)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the buckets of the account",
+		Args:  cobra.NoArgs,
+		Run:   executeBucketList,
+	})
+	cmd.AddCommand(infoCmd)
+
+	return cmd
+}
+
+// bucketUploader creates a B2 client for the bucket named in args, or the
+// configured one
+func bucketUploader(args []string) *upload.B2Uploader {
+	if len(args) > 0 {
+		appConfig.B2Bucket = args[0]
+	}
+	if err := appConfig.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(1)
+	}
+
+	uploader, err := newUploader()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+		os.Exit(1)
+	}
+	return uploader
+}
+
+// executeBucketCreate creates the bucket
+func executeBucketCreate(cmd *cobra.Command, args []string) {
+	configured := appConfig.B2Bucket
+	uploader := bucketUploader(args)
+	defer uploader.Close()
+
+	var rules []upload.LifecycleRule
+	if !bucketAllVersions {
+		rules = []upload.LifecycleRule{upload.KeepLastVersion("")}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	created, err := uploader.CreateBucket(ctx, rules, appConfig.B2Encryption)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating bucket: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Created %s bucket %s (%s)\n", created.Type, created.Name, created.ID)
+	printLifecycleRules(created.LifecycleRules)
+	if created.Name != configured {
+		fmt.Printf("\nTo archive to it, run: archiver config set b2_bucket %s\n", created.Name)
+	}
+}
+
+// executeBucketList lists the account's buckets
+func executeBucketList(cmd *cobra.Command, args []string) {
+	// Listing needs no bucket, but the client is built for one
+	if appConfig.B2Bucket == "" {
+		appConfig.B2Bucket = "-"
+	}
+	uploader := bucketUploader(nil)
+	defer uploader.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	buckets, err := uploader.ListBuckets(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing buckets: %v\n", err)
+		os.Exit(1)
+	}
+	if len(buckets) == 0 {
+		fmt.Println("No buckets. Create one with: archiver bucket create <name>")
+		return
+	}
+
+	for _, b := range buckets {
+		encryption := b.Encryption
+		if encryption == "" {
+			encryption = "unencrypted"
+		}
+		fmt.Printf("%-40s %-11s %-12s %s\n", b.Name, b.Type, encryption, b.ID)
+	}
+}
+
+// executeBucketInfo shows a bucket's settings and usage
+func executeBucketInfo(cmd *cobra.Command, args []string) {
+	uploader := bucketUploader(args)
+	defer uploader.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer handleInterrupt(cancel)()
+
+	info, err := uploader.BucketInfo(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading bucket: %v\n", err)
+		os.Exit(1)
+	}
+
+	encryption := info.Encryption
+	if encryption == "" {
+		encryption = "none by default"
+	}
+	fmt.Printf("Bucket:     %s\n", info.Name)
+	fmt.Printf("ID:         %s\n", info.ID)
+	fmt.Printf("Type:       %s\n", info.Type)
+	fmt.Printf("Encryption: %s\n\n", encryption)
+	printLifecycleRules(info.LifecycleRules)
+
+	if bucketNoUsage {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "\nCounting files...")
+	usage, err := uploader.Usage(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error counting files: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Files:        %d (%s)\n", usage.Files, formatSize(usage.Bytes))
+	fmt.Printf("Old versions: %d (%s)\n", usage.OldVersions, formatSize(usage.OldBytes))
+	fmt.Printf("Total stored: %s\n", formatSize(usage.Bytes+usage.OldBytes))
+	if usage.LargeStarted > 0 {
+		fmt.Printf("Unfinished large uploads: %d (billed until finished or cancelled)\n", usage.LargeStarted)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jth/archiver/internal/bundle"
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bundleTitle   string
+	bundleNoIndex bool
+)
+
+// newExportBundleCommand creates a command that exports a read-only bundle
+// of the catalog to share
+func newExportBundleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export-bundle",
+		Short: "Export a read-only, searchable copy of the catalog to share",
+		Long: `Export a folder that relatives can browse and search without the archiver
+or B2 credentials: index.html searches the names, summaries and tags of the
+files straight from disk, archive.db is a copy of the whole catalog for any
+SQLite browser, and index/ is a copy of the search index for archiver search.
+A README.txt explains the files. Only uploaded files are on the search page
+unless --all is set.
+
+The search index is brought up to date first. The output folder must not
+already hold a bundle.
+Examples:
+  archiver export-bundle --output ./family-archive --title "Family Archive"
+  archiver export-bundle --output /Volumes/USB/archive --all --no-index`,
+		Run: executeExportBundle,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+	cmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Directory to write the bundle to (required)")
+	cmd.Flags().StringVar(&bundleTitle, "title", "Archive", "Title shown on the search page")
+	cmd.Flags().BoolVar(&exportAll, "all", false, "Include files that have not been uploaded yet")
+	cmd.Flags().BoolVar(&bundleNoIndex, "no-index", false, "Leave out the search index")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Bucket namespace recorded in the bundle (default: from config)")
+	cmd.MarkFlagRequired("output")
+
+	return cmd
+}
+
+// executeExportBundle writes the search page, the catalog copy and the index
+func executeExportBundle(cmd *cobra.Command, args []string) {
+	if _, err := os.Stat(filepath.Join(exportOutput, bundle.DBFile)); err == nil {
+		fmt.Fprintf(os.Stderr, "Error: %s already holds a bundle\n", exportOutput)
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	namespace := appConfig.B2Bucket
+	if cmd.Flags().Changed("bucket") {
+		namespace = bucket
+	}
+	writer, err := bundle.NewWriter(exportOutput, bundle.Options{Title: bundleTitle, Header: manifest.NewHeader(namespace)})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	count := 0
+	err = database.ForEachFile(!exportAll, func(file *db.FileStatus) error {
+		entry := manifest.EntryFromFile(file)
+		tags, err := database.GetTags(file.ID)
+		if err != nil {
+			return err
+		}
+		entry.Tags = tags
+		count++
+		return writer.Write(entry)
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing the search page: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The index is synced before the catalog is copied, so they match
+	withIndex := !bundleNoIndex
+	if _, err := os.Stat(indexDir); withIndex && err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: no search index at %s, leaving it out (archiver index rebuild creates it)\n", indexDir)
+		withIndex = false
+	}
+	if withIndex {
+		syncIndex(database)
+	}
+	if err := database.Dump(filepath.Join(exportOutput, bundle.DBFile)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error copying the catalog: %v\n", err)
+		os.Exit(1)
+	}
+	if withIndex {
+		if err := bundle.CopyIndex(indexDir, exportOutput); err != nil {
+			fmt.Fprintf(os.Stderr, "Error copying the search index: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Exported %d files to %s; open %s in a browser to search them\n",
+		count, exportOutput, filepath.Join(exportOutput, bundle.PageFile))
+}
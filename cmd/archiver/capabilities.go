@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jth/archiver/internal/capabilities"
+	"github.com/jth/archiver/internal/tools"
+	"github.com/spf13/cobra"
+)
+
+var capabilitiesJSON bool
+
+// newCapabilitiesCommand creates a command that reports what this machine can process
+func newCapabilitiesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "capabilities",
+		Short: "Show which formats this machine can extract, convert, transcode and summarize",
+		Long: `Show the work this machine can do with the tools and API keys it has:
+which document formats can be extracted, which images converted, whether
+video can be transcoded, transcribed or OCR'd, and which summarization
+models are available locally or in the cloud. Work that needs a missing
+tool is skipped rather than attempted.
+Examples:
+  archiver capabilities
+  archiver capabilities --json`,
+		Run: executeCapabilities,
+	}
+
+	cmd.Flags().BoolVar(&capabilitiesJSON, "json", false, "Print the capability matrix as JSON")
+
+	return cmd
+}
+
+// executeCapabilities prints the detected capability matrix
+func executeCapabilities(cmd *cobra.Command, args []string) {
+	matrix := capabilities.Detect()
+
+	if capabilitiesJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(matrix); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding capabilities: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Println("Extraction:")
+	for _, capability := range matrix.Extraction {
+		printCapability(capability)
+	}
+	fmt.Println("Conversion:")
+	for _, capability := range matrix.Conversion {
+		printCapability(capability)
+	}
+	fmt.Println("Media:")
+	printCapability(matrix.Transcoding)
+	printCapability(matrix.Transcription)
+	printCapability(matrix.OCR)
+
+	fmt.Println("Summarization:")
+	fmt.Printf("  %-14s %s\n", "local", modelList(matrix.Summarization.Local))
+	fmt.Printf("  %-14s %s\n", "cloud", modelList(matrix.Summarization.Cloud))
+	fmt.Println()
+
+	tools.PrintHints(os.Stdout)
+}
+
+// printCapability prints one capability line, e.g. "  pdf   yes (pdftotext)  .pdf"
+func printCapability(capability capabilities.Capability) {
+	status := "no"
+	if capability.Available {
+		status = "yes (" + capability.Tool + ")"
+	}
+	fmt.Printf("  %-14s %-20s %s\n", capability.Name, status, strings.Join(capability.Formats, " "))
+}
+
+// modelList joins model names, or returns "none"
+func modelList(models []string) string {
+	if len(models) == 0 {
+		return "none"
+	}
+	return strings.Join(models, ", ")
+}
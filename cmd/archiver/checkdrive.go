@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/integrity"
+	"github.com/spf13/cobra"
+)
+
+const stageCheck = "check"
+
+var checkVerbose bool
+
+// newCheckDriveCommand creates a command that looks for bit-rot on a
+// scanned drive
+func newCheckDriveCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "checkdrive",
+		Short: "Re-hash the files of a scanned drive to find bit-rot",
+		Long: `Read every file the catalog has under a folder again and compare its SHA-256
+with the one recorded when it was scanned, to find files an aging drive has
+damaged while there is still time to copy the drive.
+
+A file whose content changed while its size and modification time didn't is
+reported as corrupted; one that can't be read all the way through as
+unreadable, which often means the drive is failing. Files edited since the
+scan are reported as modified, and files no longer there as missing; rescan
+the folder to update the catalog with them.
+
+Damaged files that were uploaded with their scanned content can be restored
+with archiver restore. The check is recorded in the run history, with the
+damaged files as the run's errors, and the command exits with status 1 when
+it finds any.
+Examples:
+  archiver checkdrive --source /Volumes/OldDrive
+  archiver checkdrive --source /Volumes/OldDrive/Photos -v`,
+		Run: executeCheckDrive,
+	}
+
+	cmd.Flags().StringVarP(&sourcePath, "source", "s", "", "Folder or drive to check")
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().BoolVarP(&checkVerbose, "verbose", "v", false, "Also list modified and missing files")
+	cmd.MarkFlagRequired("source")
+
+	return cmd
+}
+
+// executeCheckDrive checks the catalog files under the folder
+func executeCheckDrive(cmd *cobra.Command, args []string) {
+	source, err := filepath.Abs(sourcePath)
+	if err == nil {
+		var info os.FileInfo
+		if info, err = os.Stat(source); err == nil && !info.IsDir() {
+			err = fmt.Errorf("%s is not a folder", source)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	all, err := database.GetFilesInDirectory(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading catalog: %v\n", err)
+		os.Exit(1)
+	}
+	var files []*db.FileStatus
+	for _, file := range all {
+		if !file.IsDir && !file.DeletedAt.Valid {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(stdout, "No files under %s in the catalog; scan it first with archiver scan --source %s\n", source, source)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer handleInterrupt(cancel)()
+
+	damaged, err := checkFiles(ctx, database, source, files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if damaged > 0 {
+		os.Exit(1)
+	}
+}
+
+// checkFiles re-hashes the files, reports those that changed and records
+// the check as a run. It returns how many files are damaged.
+func checkFiles(ctx context.Context, database *db.DB, source string, files []*db.FileStatus) (damaged int, err error) {
+	run, err := database.StartRun("checkdrive", source)
+	if err != nil {
+		return 0, err
+	}
+
+	var totalBytes int64
+	for _, file := range files {
+		totalBytes += file.Size
+	}
+	tracker := newTracker()
+	defer stopProgress()
+	tracker.UpdateTotals(int64(len(files)), totalBytes)
+	tracker.AddByteStage(stageCheck, "Checking files", totalBytes)
+
+	checked := 0
+	defer func() {
+		stats := tracker.Statistics
+		run.FilesTotal = stats.TotalFiles
+		run.FilesProcessed = stats.ProcessedFiles
+		run.FilesSkipped = stats.SkippedFiles
+		run.FilesFailed = stats.FailedFiles
+		run.BytesProcessed = stats.BytesProcessed
+		run.FilesRemaining = int64(len(files) - checked)
+		run.Stage = stageCheck
+		if finishErr := database.FinishRun(run, err); finishErr != nil {
+			fmt.Fprintf(os.Stderr, "Error recording run %d: %v\n", run.ID, finishErr)
+		}
+		notifyRun(run)
+	}()
+
+	counts := make(map[integrity.Status]int)
+	var reported []integrity.Result
+	for _, file := range files {
+		if tracker.Wait(ctx) != nil {
+			break
+		}
+		checked++
+
+		result := integrity.Check(file)
+		counts[result.Status]++
+		switch {
+		case result.Damaged():
+			tracker.UpdateFileStats(0, 0, 1, 0)
+			if dbErr := database.AddRunError(run.ID, file.Path, damage(result)); dbErr != nil {
+				logger.Warn("could not record error in the run history", "path", file.Path, "error", dbErr)
+			}
+			reported = append(reported, result)
+		case result.Status == integrity.StatusOK:
+			tracker.UpdateFileStats(1, 0, 0, file.Size)
+		default:
+			tracker.UpdateFileStats(0, 1, 0, 0)
+			if checkVerbose {
+				reported = append(reported, result)
+			}
+		}
+		tracker.IncrementStage(stageCheck, file.Size)
+	}
+
+	stopProgress()
+	tracker.PrintSummary()
+	for _, result := range reported {
+		fmt.Fprintf(stdout, "  %-10s %s", result.Status, result.File.Path)
+		if result.Damaged() && result.File.UploadedURL != "" && result.File.UploadSHA256 == result.File.SHA256 {
+			fmt.Fprint(stdout, " (uploaded intact)")
+		}
+		fmt.Fprintln(stdout)
+	}
+	fmt.Fprintf(stdout, "\nChecked %d of %d file(s) under %s:\n", checked, len(files), source)
+	for _, status := range []integrity.Status{
+		integrity.StatusOK, integrity.StatusCorrupted, integrity.StatusUnreadable,
+		integrity.StatusModified, integrity.StatusMissing, integrity.StatusUnhashed,
+	} {
+		if counts[status] > 0 {
+			fmt.Fprintf(stdout, "  %-10s %d\n", status, counts[status])
+		}
+	}
+	damaged = counts[integrity.StatusCorrupted] + counts[integrity.StatusUnreadable]
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(stdout, "\nRun %d was interrupted with %d file(s) left to check.\n", run.ID, len(files)-checked)
+		return damaged, fmt.Errorf("interrupted during %s: %w", stageCheck, ctx.Err())
+	}
+	if damaged > 0 {
+		fmt.Fprintf(stdout, "\n%d damaged file(s); copy what you can off the drive. Recorded as run %d (archiver runs show %d)\n",
+			damaged, run.ID, run.ID)
+	} else {
+		fmt.Fprintf(stdout, "Recorded as run %d (archiver runs show %d)\n", run.ID, run.ID)
+	}
+	return damaged, nil
+}
+
+// damage describes what is wrong with a damaged file, for the run history
+func damage(result integrity.Result) error {
+	if result.Err != nil {
+		return fmt.Errorf("%s: %w", result.Status, result.Err)
+	}
+	return fmt.Errorf("%s: SHA-256 is %s, scanned as %s", result.Status, result.SHA256, result.File.SHA256)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jth/archiver/internal/config"
+	"github.com/jth/archiver/internal/remotename"
+	"github.com/jth/archiver/internal/scratch"
+	"github.com/jth/archiver/internal/summariser"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var configForce bool
+
+// newConfigCommand creates the command group for the config file
+func newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Create, show, edit and check the configuration",
+		Long: `Manage the config file given by --config (./config.json by default).
+Examples:
+  archiver config init
+  archiver config set b2_bucket my-archive
+  archiver config set notify.desktop true
+  archiver config show
+  archiver config validate`,
+	}
+
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Write a commented config file with the default settings",
+		Args:  cobra.NoArgs,
+		Run:   executeConfigInit,
+	}
+	initCmd.Flags().BoolVar(&configForce, "force", false, "Replace an existing config file")
+
+	cmd.AddCommand(initCmd)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Print the configuration in effect, with keys masked",
+		Args:  cobra.NoArgs,
+		Run:   executeConfigShow,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Set one setting in the config file",
+		Long: `Set one setting in the config file, creating it with the defaults if needed.
+Keys are named as in the file, with nested settings joined by dots
+(notify.desktop). Only the value changes: comments and the rest of the file
+are kept. Lists such as tag_rules are edited in the file itself.`,
+		Args: cobra.ExactArgs(2),
+		Run:  executeConfigSet,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "validate",
+		Short: "Check the config file and test the B2 and LLM credentials",
+		Args:  cobra.NoArgs,
+		Run:   executeConfigValidate,
+	})
+
+	return cmd
+}
+
+// executeConfigInit writes the config template
+func executeConfigInit(cmd *cobra.Command, args []string) {
+	if _, err := os.Stat(configPath); err == nil && !configForce {
+		fmt.Fprintf(os.Stderr, "Error: %s already exists (use --force to replace it)\n", configPath)
+		os.Exit(1)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating config directory: %v\n", err)
+		os.Exit(1)
+	}
+	// The file will hold API keys
+	if err := os.WriteFile(configPath, []byte(config.Template), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing config file: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s\n", configPath)
+}
+
+// executeConfigShow prints the loaded configuration as JSON
+func executeConfigShow(cmd *cobra.Command, args []string) {
+	data, err := json.MarshalIndent(appConfig.Masked(), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding config: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Only the JSON goes to stdout, for piping to other tools
+	if _, err := os.Stat(configPath); err == nil {
+		fmt.Fprintf(os.Stderr, "// Loaded from %s\n", configPath)
+	} else {
+		fmt.Fprintln(os.Stderr, "// Loaded from environment variables")
+	}
+	fmt.Println(string(data))
+}
+
+// executeConfigSet changes one setting in the config file
+func executeConfigSet(cmd *cobra.Command, args []string) {
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating config directory: %v\n", err)
+			os.Exit(1)
+		}
+		// The commented defaults, as written by config init
+		if err := os.WriteFile(configPath, []byte(config.Template), 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating config file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := config.SetInFile(configPath, args[0], args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Set %s in %s\n", args[0], configPath)
+}
+
+// executeConfigValidate checks the settings and makes one cheap call with
+// each credential
+func executeConfigValidate(cmd *cobra.Command, args []string) {
+	failed := false
+	check := func(name string, err error) {
+		if err != nil {
+			fmt.Printf("  FAIL  %s: %v\n", name, err)
+			failed = true
+			return
+		}
+		fmt.Printf("  ok    %s\n", name)
+	}
+
+	// loadConfig falls back to the environment when the file doesn't parse
+	if _, err := os.Stat(configPath); err == nil {
+		_, err := config.LoadFromFile(configPath)
+		check("config file "+configPath, err)
+	}
+	check("summarize level", validSetting(appConfig.Summarize, "none", "basic", "default", "full"))
+	check("stub mode", validSetting(appConfig.StubMode, "webloc", "shortcut", "none"))
+	check("raw local", validSetting(appConfig.RawLocal, "keep", "preview"))
+	check("priority", validSetting(appConfig.Concurrency.Priority, "balanced", "uploads"))
+	check("drive health", validSetting(appConfig.DriveHealth, "warn", "refuse", "off"))
+	check("snapshots", validSetting(appConfig.Snapshots, "latest", "dedupe", "all"))
+	check("scratch folder "+scratch.Dir(), scratch.Ensure(scratch.Dir(), 0))
+	check("B2 encryption", validSetting(appConfig.B2Encryption, "", upload.EncryptionB2, upload.EncryptionCustomer))
+	if appConfig.RemoteNameTemplate != "" {
+		_, err := remotename.Parse(appConfig.RemoteNameTemplate)
+		check("remote name template", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := appConfig.Validate(); err != nil {
+		check("B2 credentials", err)
+	} else {
+		uploader, err := newUploader()
+		if err == nil {
+			err = uploader.CheckAccess(ctx)
+			uploader.Close()
+		}
+		check("B2 credentials and bucket "+appConfig.B2Bucket, err)
+	}
+
+	keys := []struct{ provider, key string }{
+		{"anthropic", firstNonEmpty(appConfig.AnthropicAPIKey, os.Getenv("ANTHROPIC_KEY"))},
+		{"openai", firstNonEmpty(appConfig.OpenAIAPIKey, os.Getenv("OPENAI_API_KEY"))},
+		{"groq", os.Getenv("GROQ_API_KEY")},
+	}
+	pinged := 0
+	for _, k := range keys {
+		if k.key == "" {
+			continue
+		}
+		check(k.provider+" API key", summariser.Ping(ctx, k.provider, k.key))
+		pinged++
+	}
+	if pinged == 0 {
+		fmt.Println("  --    no LLM API keys set: documents are only summarized with a local model")
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// validSetting checks that a setting has one of the allowed values
+func validSetting(value string, allowed ...string) error {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not one of %v", value, allowed)
+}
+
+// firstNonEmpty returns the first value that isn't empty
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	costsBy   string
+	costsDays int
+)
+
+// newCostsCommand creates a command that reports the money spent
+func newCostsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "costs",
+		Short: "Report LLM and B2 spend by day, run, provider or model",
+		Long: `Total the money spent on summaries, and the B2 download charges estimated
+at list price, as recorded by every run. The lifetime LLM spend is compared
+with lifetime_budget_usd, which stops summarizing once reached, and the
+uploads in the catalog give an estimate of the monthly B2 storage bill.
+Examples:
+  archiver costs
+  archiver costs --by run --days 30
+  archiver costs --by model`,
+		Run: executeCosts,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&costsBy, "by", "day", "Group by day, run, provider, model or kind")
+	cmd.Flags().IntVar(&costsDays, "days", 0, "Only count the last n days (0 for all)")
+
+	return cmd
+}
+
+// executeCosts prints the spend report
+func executeCosts(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	var since time.Time
+	if costsDays > 0 {
+		since = time.Now().AddDate(0, 0, -costsDays)
+	}
+	groups, err := database.CostsBy(costsBy, since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error totalling costs: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(groups) == 0 {
+		fmt.Println("No costs recorded yet.")
+	} else {
+		var total float64
+		for _, group := range groups {
+			fmt.Printf("%-24s %6d requests  $%9.4f", group.Key, group.Requests, group.Amount)
+			if group.Bytes > 0 {
+				fmt.Printf("  %s", formatSize(group.Bytes))
+			}
+			fmt.Println()
+			total += group.Amount
+		}
+		fmt.Printf("%-24s %15s  $%9.4f\n", "Total", "", total)
+	}
+
+	spent, err := database.TotalCost(db.CostLLM)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error totalling costs: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\nLifetime LLM spend: $%.4f", spent)
+	if budget := appConfig.LifetimeBudgetUSD; budget > 0 {
+		fmt.Printf(" of $%.2f budget ($%.4f left)", budget, max(budget-spent, 0))
+	}
+	fmt.Println()
+
+	stored, err := database.StoredBytes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error totalling uploads: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("B2 storage: %s, about $%.2f per month\n", formatSize(stored), upload.StorageCost(stored))
+}
+
+// recordEgress records the estimated cost of downloading a file from B2.
+// Failing to record it is only reported.
+func recordEgress(database *db.DB, fileID, bytes int64) {
+	err := database.RecordCost(&db.Cost{
+		FileID:   fileID,
+		Kind:     db.CostEgress,
+		Provider: "b2",
+		Amount:   upload.EgressCost(bytes),
+		Bytes:    bytes,
+	})
+	if err != nil {
+		logger.Warn("could not record download cost", "file_id", fileID, "error", err)
+	}
+}
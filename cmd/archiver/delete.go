@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var (
+	deleteWhere  string
+	deleteReason string
+	deleteDryRun bool
+)
+
+// newDeleteCommand creates a command that soft-deletes catalog entries
+func newDeleteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete [path...]",
+		Short: "Mark catalog entries as deleted",
+		Long: `Mark files as deleted in the catalog. The entries stay in the database as
+tombstones with the reason and date, so reports and duplicate detection stay
+accurate, but they are no longer processed, exported or found by search.
+Deleted files can be restored with archiver undelete until purge removes the
+tombstones and their uploaded copies for good, which it does once they have
+been in the trash for trash_days from the config file. Files locked with
+archiver lock can't be deleted until their lock ends.
+Examples:
+  archiver delete /Volumes/OldDrive/tmp/dump.sql --reason "scratch file"
+  archiver delete --where "path LIKE '/Volumes/OldDrive/Caches/%'" --reason cache --dry-run`,
+		Run: executeDelete,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+	cmd.Flags().StringVar(&deleteWhere, "where", "", "SQL filter over the catalog columns selecting the files")
+	cmd.Flags().StringVar(&deleteReason, "reason", "", "Why the files are deleted")
+	cmd.Flags().BoolVar(&deleteDryRun, "dry-run", false, "List the files without deleting them")
+
+	return cmd
+}
+
+// executeDelete tombstones the selected files and drops them from the index
+func executeDelete(cmd *cobra.Command, args []string) {
+	if len(args) == 0 && deleteWhere == "" {
+		fmt.Fprintln(os.Stderr, "Error: give the paths to delete or --where")
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	var files []*db.FileStatus
+	for _, arg := range args {
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving %s: %v\n", arg, err)
+			os.Exit(1)
+		}
+		file, err := database.GetFileByPath(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s is not in the catalog\n", path)
+			os.Exit(1)
+		}
+		if file.DeletedAt.Valid {
+			fmt.Printf("Already deleted: %s\n", path)
+			continue
+		}
+		files = append(files, file)
+	}
+	if deleteWhere != "" {
+		matched, err := database.FindFiles(deleteWhere)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error selecting files: %v\n", err)
+			os.Exit(1)
+		}
+		files = append(files, matched...)
+	}
+
+	fmt.Printf("%d file(s) to delete\n", len(files))
+	if deleteDryRun {
+		for _, file := range files {
+			fmt.Printf("  %s\n", file.Path)
+		}
+		return
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	indexer, err := db.NewIndexer(db.IndexConfig{IndexDir: indexDir}, database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening index: %v\n", err)
+		os.Exit(1)
+	}
+	defer indexer.Close()
+
+	var deleted int
+	for _, file := range files {
+		if err := checkUnlocked(database, file); err != nil {
+			fmt.Fprintf(os.Stderr, "  REFUSED %v\n", err)
+			continue
+		}
+		if err := database.MarkDeleted(file.ID, deleteReason); err != nil {
+			fmt.Fprintf(os.Stderr, "  FAILED %s: %v\n", file.Path, err)
+			continue
+		}
+		if err := indexer.RemoveFile(file.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "  Warning: %s is still in the search index: %v\n", file.Path, err)
+		}
+		deleted++
+	}
+
+	fmt.Printf("Deleted %d file(s). Restore them with archiver undelete, or run archiver purge to remove them permanently.\n", deleted)
+}
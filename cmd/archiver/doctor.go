@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/jth/archiver/internal/capabilities"
+	"github.com/jth/archiver/internal/doc"
+	"github.com/jth/archiver/internal/tools"
+	"github.com/spf13/cobra"
+)
+
+var doctorJSON bool
+
+// doctorReport is what doctor --json prints
+type doctorReport struct {
+	Tools         []tools.Tool               `json:"tools"`
+	Needs         []tools.Need               `json:"needs"`
+	Summarization capabilities.Summarization `json:"summarization"`
+}
+
+// newDoctorCommand creates a command that checks the optional external tools
+func newDoctorCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the optional external tools and suggest how to install missing ones",
+		Long: `Check every optional external tool archiver uses (pdftotext, Tika,
+pandoc, ffmpeg, Whisper, ImageMagick, exiftool, smartctl and others): where it
+is installed and which version, which functionality is degraded to a fallback
+tool or unavailable, and the command that installs each missing package on
+this platform. Files that need a missing tool are skipped by runs.
+Examples:
+  archiver doctor
+  archiver doctor --json`,
+		Run: executeDoctor,
+	}
+
+	cmd.Flags().BoolVar(&doctorJSON, "json", false, "Print the report as JSON")
+
+	return cmd
+}
+
+// executeDoctor probes the tools and prints the report
+func executeDoctor(cmd *cobra.Command, args []string) {
+	report := doctorReport{
+		Tools:         tools.Tools(),
+		Needs:         withTikaServer(tools.Needs()),
+		Summarization: capabilities.Detect().Summarization,
+	}
+
+	if doctorJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding report: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Println("Tools:")
+	for _, tool := range report.Tools {
+		switch {
+		case tool.Installed():
+			fmt.Printf("  %-12s %s\n", tool.Name, tool.Version)
+			fmt.Printf("  %-12s %s\n", "", tool.Path)
+		case tool.Install != "":
+			fmt.Printf("  %-12s missing: %s\n", tool.Name, tool.Install)
+		default:
+			fmt.Printf("  %-12s missing: install %s\n", tool.Name, tool.Package)
+		}
+		if !tool.Installed() && (tool.Name == "ffmpeg" || tool.Name == "ffprobe") {
+			fmt.Printf("  %-12s or download a static build with archiver install-ffmpeg\n", "")
+		}
+	}
+
+	if tikaServer != nil {
+		if err := tikaServer.Check(context.Background()); err == nil {
+			fmt.Printf("  %-12s answering at %s\n", "tika server", appConfig.TikaURL)
+		} else if launcher := doc.TikaLauncher(appConfig.TikaServerJar); launcher != nil {
+			fmt.Printf("  %-12s started at %s with %s when needed\n", "tika server", appConfig.TikaURL, launcher[0])
+		} else {
+			fmt.Printf("  %-12s not running at %s; the tika command is used\n", "tika server", appConfig.TikaURL)
+		}
+	}
+
+	fmt.Println("Functionality:")
+	degraded, unavailable := 0, 0
+	for _, need := range report.Needs {
+		status := "ok (" + need.Tool + ")"
+		switch {
+		case !need.Available():
+			status = "unavailable"
+			unavailable++
+		case need.Degraded():
+			status = fmt.Sprintf("degraded (%s instead of %s)", need.Tool, need.Preferred)
+			degraded++
+		}
+		fmt.Printf("  %-28s %s\n", need.Purpose, status)
+	}
+
+	fmt.Println("Summarization:")
+	fmt.Printf("  %-28s %s\n", "local", modelList(report.Summarization.Local))
+	fmt.Printf("  %-28s %s\n", "cloud", modelList(report.Summarization.Cloud))
+	fmt.Println()
+
+	if !report.Summarization.Available() {
+		fmt.Println("No summarization model is available: run Ollama or set an API key to summarize documents.")
+		fmt.Println()
+	}
+	tools.PrintHints(os.Stdout)
+	fmt.Printf("%d of %d features available, %d degraded to a fallback tool\n",
+		len(report.Needs)-unavailable, len(report.Needs), degraded)
+}
+
+// withTikaServer counts a Tika server that answers or can be started as
+// providing what the tika command would
+func withTikaServer(needs []tools.Need) []tools.Need {
+	if !doc.TikaServerUsable(context.Background()) {
+		return needs
+	}
+	for i, need := range needs {
+		tika := slices.Index(need.Tools, "tika")
+		if tika < 0 || (need.Tool != "" && slices.Index(need.Tools, need.Tool) < tika) {
+			continue
+		}
+		needs[i].Tool = "tika-server"
+		if need.Preferred == "tika" {
+			needs[i].Preferred = "tika-server"
+		}
+	}
+	return needs
+}
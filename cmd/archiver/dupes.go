@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/drives"
+	"github.com/jth/archiver/internal/dupes"
+	"github.com/jth/archiver/internal/image"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dupesMinSize string
+	dupesLimit   int
+	dupesPrefer  []string
+	dupesScript  string
+	dupesAction  string
+
+	dupesPerceptual bool
+	dupesDistance   int
+	dupesWindow     time.Duration
+)
+
+// newDupesCommand creates a command that reports duplicate files
+func newDupesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dupes",
+		Short: "Report files with the same content across all drives",
+		Long: `Group the files in the catalog by SHA-256 and list the clusters of identical
+files, most wasted space first. In each cluster one copy is marked to keep:
+the first under a --prefer prefix, otherwise one that has been uploaded,
+otherwise the oldest.
+
+--script writes a shell script that deletes the other copies or, with
+--action stub, replaces them with stubs pointing to the kept copy's upload
+(or to the kept copy itself), and marks them deleted in the catalog. Nothing
+is changed until you review and run the script.
+
+--perceptual groups near-identical photos instead, such as the shots of a
+burst or resized copies, by a perceptual hash of each photo taken within
+--window of the others. The largest, then sharpest photo of each group is
+marked best. Groups are recorded in the catalog, for backup-diff
+--best-of-burst. Hashes are kept, so only new or changed photos are read
+again.
+Examples:
+  archiver dupes --min-size 10MB
+  archiver dupes --prefer /Volumes/Archive2024/ --script dedupe.sh
+  archiver dupes --action delete --script dedupe.sh
+  archiver dupes --perceptual --window 5m`,
+		Run: executeDupes,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&indexDir, "index-dir", "./index", "Search index the script removes deleted copies from")
+	cmd.Flags().StringVar(&dupesMinSize, "min-size", "1B", "Ignore files smaller than this (e.g., 500KB, 1GB)")
+	cmd.Flags().IntVarP(&dupesLimit, "limit", "l", 20, "Number of clusters to list (0 for all)")
+	cmd.Flags().StringArrayVar(&dupesPrefer, "prefer", nil, "Keep copies under this path prefix (repeatable, in order of preference)")
+	cmd.Flags().StringVar(&dupesScript, "script", "", "Write a shell script handling the extra copies to this file")
+	cmd.Flags().StringVar(&dupesAction, "action", string(dupes.ActionStub), "What the script does with extra copies: stub or delete")
+	cmd.Flags().StringVar(&stubMode, "stub-mode", "webloc", "Stub format for --action stub: webloc or shortcut")
+	cmd.Flags().BoolVar(&dupesPerceptual, "perceptual", false, "Group near-identical photos, such as bursts, instead of identical files")
+	cmd.Flags().IntVar(&dupesDistance, "distance", dupes.DefaultBurstOptions().MaxDistance, "Most bits the perceptual hashes of grouped photos differ by (0-64)")
+	cmd.Flags().DurationVar(&dupesWindow, "window", dupes.DefaultBurstOptions().Window, "Only compare photos modified this close together (0 compares all)")
+
+	return cmd
+}
+
+// executeDupes prints the duplicate clusters and writes the script
+func executeDupes(cmd *cobra.Command, args []string) {
+	minSize, err := parseSize(dupesMinSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --min-size: %v\n", err)
+		os.Exit(1)
+	}
+	action := dupes.Action(dupesAction)
+	if action != dupes.ActionStub && action != dupes.ActionDelete {
+		fmt.Fprintf(os.Stderr, "Error: unknown action %q (expected stub or delete)\n", dupesAction)
+		os.Exit(1)
+	}
+	mode := db.StubMode(stubMode)
+	if action == dupes.ActionStub && mode != db.StubModeWebloc && mode != db.StubModeShortcut {
+		fmt.Fprintf(os.Stderr, "Error: --action stub needs --stub-mode webloc or shortcut\n")
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	if dupesPerceptual {
+		if dupesScript != "" {
+			fmt.Fprintf(os.Stderr, "Error: --script only handles identical files, not --perceptual groups\n")
+			os.Exit(1)
+		}
+		listBursts(database, minSize)
+		return
+	}
+
+	files, err := database.FindDuplicates(minSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding duplicates: %v\n", err)
+		os.Exit(1)
+	}
+	clusters := dupes.Group(files, dupesPrefer)
+	if len(clusters) == 0 {
+		fmt.Println("No duplicates found.")
+		return
+	}
+
+	var wasted int64
+	for _, cluster := range clusters {
+		wasted += cluster.Wasted()
+	}
+	fmt.Printf("%d clusters of identical files, %s wasted\n", len(clusters), formatSize(wasted))
+
+	for i, cluster := range clusters {
+		if dupesLimit > 0 && i == dupesLimit {
+			fmt.Printf("\n... %d more (use --limit 0 to list all)\n", len(clusters)-i)
+			break
+		}
+		fmt.Printf("\n%s wasted: %d copies of %s (sha256 %.12s)\n",
+			formatSize(cluster.Wasted()), len(cluster.Files), formatSize(cluster.Size), cluster.SHA256)
+		for _, file := range cluster.Files {
+			marker := "    "
+			if file == cluster.Keep {
+				marker = "keep"
+			}
+			drive := ""
+			if name := drives.NameFromPath(file.Path); name != "" {
+				drive = " [" + name + "]"
+			}
+			fmt.Printf("  %s %s%s\n", marker, file.Path, drive)
+		}
+	}
+
+	if dupesScript == "" {
+		return
+	}
+	dbPath, _ := filepath.Abs(dbFilePath)
+	indexPath, _ := filepath.Abs(indexDir)
+	out, err := os.OpenFile(dupesScript, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating script: %v\n", err)
+		os.Exit(1)
+	}
+	err = dupes.WriteScript(out, clusters, dupes.ScriptOptions{
+		Action:   action,
+		StubMode: mode,
+		DBPath:   dbPath,
+		IndexDir: indexPath,
+	})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing script: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\nWrote %s: review it, then run it to %s the extra copies.\n", dupesScript, action)
+}
+
+// listBursts groups the photos of the catalog into bursts and prints them
+func listBursts(database *db.DB, minSize int64) {
+	files, err := database.FindFiles(fmt.Sprintf("size >= %d", minSize))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error selecting photos: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer handleInterrupt(cancel)()
+	bursts, err := groupBursts(ctx, database, files, dupes.BurstOptions{MaxDistance: dupesDistance, Window: dupesWindow})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error grouping photos: %v\n", err)
+		os.Exit(1)
+	}
+	if len(bursts) == 0 {
+		fmt.Println("No near-identical photos found.")
+		return
+	}
+
+	var wasted int64
+	for _, burst := range bursts {
+		wasted += burst.Wasted()
+	}
+	fmt.Printf("%d groups of near-identical photos, %s besides the best of each\n", len(bursts), formatSize(wasted))
+
+	for i, burst := range bursts {
+		if dupesLimit > 0 && i == dupesLimit {
+			fmt.Printf("\n... %d more (use --limit 0 to list all)\n", len(bursts)-i)
+			break
+		}
+		best := burst.Best()
+		fmt.Printf("\n%s besides the best: %d photos\n", formatSize(burst.Wasted()), len(burst.Photos))
+		for _, photo := range burst.Photos {
+			marker := "    "
+			if photo == best {
+				marker = "best"
+			}
+			fmt.Printf("  %s %s (%dx%d, sharpness %.0f, distance %d)\n", marker, photo.File.Path,
+				photo.Print.Width, photo.Print.Height, photo.Print.Sharpness,
+				image.Distance(photo.Print.Hash, best.Print.Hash))
+		}
+	}
+}
+
+// groupBursts fingerprints the photos among files that have no current
+// fingerprint, groups them into bursts and records the bursts in the
+// catalog. Photos that can't be read,
+// such as those on drives not mounted, are left out.
+func groupBursts(ctx context.Context, database *db.DB, files []*db.FileStatus, opts dupes.BurstOptions) ([]*dupes.Burst, error) {
+	hashes, err := database.GetImageHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	var photos []*dupes.Photo
+	var ids []int64
+	var unreadable int
+	for _, file := range files {
+		if !image.IsPhoto(file.Path) || !dupes.Local(file) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		stored := hashes[file.ID]
+		if stored == nil || stored.SHA256 != file.SHA256 {
+			fingerprint, err := image.PerceptualHash(ctx, file.Path)
+			if err != nil {
+				logger.Debug("could not fingerprint photo", "path", file.Path, "error", err)
+				unreadable++
+				continue
+			}
+			stored = &db.ImageHash{
+				FileID:    file.ID,
+				SHA256:    file.SHA256,
+				Hash:      fingerprint.Hash,
+				Width:     fingerprint.Width,
+				Height:    fingerprint.Height,
+				Sharpness: fingerprint.Sharpness,
+			}
+			if err := database.SaveImageHash(stored); err != nil {
+				return nil, err
+			}
+		}
+		photos = append(photos, &dupes.Photo{File: file, Print: stored})
+		ids = append(ids, file.ID)
+	}
+	if unreadable > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d photo(s) could not be read and were left out\n", unreadable)
+	}
+
+	bursts := dupes.GroupBursts(photos, opts)
+	if err := database.SetBursts(ids, dupes.BestOf(bursts)); err != nil {
+		return nil, err
+	}
+	return bursts, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat string
+	exportOutput string
+	exportAll    bool
+)
+
+// newExportManifestCommand creates a command that exports the archive manifest
+func newExportManifestCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export-manifest",
+		Short: "Export a portable manifest of archived files",
+		Long: `Export a portable manifest of everything archived (paths, hashes, sizes,
+remote URLs and summaries) so a human-readable record exists independently
+of the tool.
+Examples:
+  archiver export-manifest --format jsonl --output manifest.jsonl
+  archiver export-manifest --format csv > manifest.csv
+  archiver export-manifest --format sqlite --output archive-copy.db`,
+		Run: executeExportManifest,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&exportFormat, "format", "jsonl", "Manifest format: jsonl, csv, or sqlite")
+	cmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Output file (default: stdout; required for sqlite)")
+	cmd.Flags().BoolVar(&exportAll, "all", false, "Include files that have not been uploaded yet")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Bucket namespace recorded in the manifest header (default: from config)")
+
+	return cmd
+}
+
+// executeExportManifest writes the manifest in the requested format
+func executeExportManifest(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	// A SQLite dump is a straight copy of the catalog
+	if exportFormat == "sqlite" {
+		if exportOutput == "" {
+			fmt.Fprintln(os.Stderr, "Error: --output is required for sqlite exports")
+			os.Exit(1)
+		}
+		if err := database.Dump(exportOutput); err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting database: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Database exported to %s\n", exportOutput)
+		return
+	}
+
+	var out io.Writer = os.Stdout
+	if exportOutput != "" {
+		file, err := os.Create(exportOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	namespace := appConfig.B2Bucket
+	if cmd.Flags().Changed("bucket") {
+		namespace = bucket
+	}
+	writer, err := manifest.NewWriter(out, manifest.Format(exportFormat), manifest.NewHeader(namespace))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	count := 0
+	err = database.ForEachFile(!exportAll, func(file *db.FileStatus) error {
+		entry := manifest.EntryFromFile(file)
+		tags, err := database.GetTags(file.ID)
+		if err != nil {
+			return err
+		}
+		entry.Tags = tags
+		count++
+		return writer.Write(entry)
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing manifest: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d entries\n", count)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/reconcile"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importPrefix  string
+	importVerify  bool
+	importDryRun  bool
+	importVerbose bool
+	importAdopt   bool
+)
+
+// newImportCommand creates a command that adopts files already present in B2
+func newImportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Mark files already present in the B2 bucket as archived",
+		Long: `List the objects in the B2 bucket (for example uploaded earlier with rclone),
+match them to scanned local files by name, size and SHA-1, and record them as
+uploaded so they are not uploaded again.
+With --adopt, every object that matches no local file gets a catalog entry of
+its own, with the path b2://<bucket>/<name>, the SHA-1 checksum reported by B2
+and its download URL, and is added to the search index. This builds the
+catalog of a bucket filled before the archiver was used.
+Examples:
+  archiver import --bucket my-archive
+  archiver import --prefix photos/ --verify --dry-run
+  archiver import --bucket my-archive --adopt --prefix photos/ --verbose`,
+		Run: executeImport,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Backblaze B2 bucket name (default: from config)")
+	cmd.Flags().StringVar(&importPrefix, "prefix", "", "Only consider objects under this prefix")
+	cmd.Flags().BoolVar(&importVerify, "verify", false, "Confirm every match by comparing SHA-1 hashes")
+	cmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Report matches without updating the database")
+	cmd.Flags().BoolVarP(&importVerbose, "verbose", "v", false, "List matched and unmatched objects")
+	cmd.Flags().BoolVar(&importAdopt, "adopt", false, "Catalog and index objects that match no local file")
+
+	return cmd
+}
+
+// executeImport matches bucket contents to the catalog
+func executeImport(cmd *cobra.Command, args []string) {
+	if cmd.Flags().Changed("bucket") {
+		appConfig.B2Bucket = bucket
+	}
+	if err := appConfig.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	uploader, err := newUploader()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+		os.Exit(1)
+	}
+	defer uploader.Close()
+
+	importer := reconcile.NewImporter(database, uploader)
+	report, err := importer.Import(context.Background(), reconcile.Options{
+		Prefix:     importPrefix,
+		VerifyHash: importVerify,
+		DryRun:     importDryRun,
+		Adopt:      importAdopt,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error importing bucket contents: %v\n", err)
+		os.Exit(1)
+	}
+
+	if importVerbose {
+		for _, match := range report.Matched {
+			fmt.Printf("  matched   %s -> %s\n", match.Remote.Name, match.File.Path)
+		}
+		for _, file := range report.Adopted {
+			fmt.Printf("  adopted   %s\n", file.Path)
+		}
+		for _, remote := range report.Ambiguous {
+			fmt.Printf("  ambiguous %s\n", remote.Name)
+		}
+		for _, remote := range report.Unmatched {
+			fmt.Printf("  unmatched %s\n", remote.Name)
+		}
+	}
+	for _, err := range report.Errors {
+		fmt.Fprintf(os.Stderr, "  error: %v\n", err)
+	}
+
+	indexed := 0
+	if !importDryRun && len(report.Adopted) > 0 {
+		indexed, err = indexAdopted(database, report.Adopted)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error indexing adopted files: %v\n", err)
+		}
+	}
+
+	fmt.Printf("\nRemote objects: %d\n", report.RemoteFiles)
+	fmt.Printf("Matched: %d\n", len(report.Matched))
+	if importAdopt {
+		fmt.Printf("Adopted: %d\n", len(report.Adopted))
+	}
+	fmt.Printf("Already archived: %d\n", report.AlreadyArchived)
+	fmt.Printf("Ambiguous: %d\n", len(report.Ambiguous))
+	if !importAdopt {
+		fmt.Printf("Unmatched: %d\n", len(report.Unmatched))
+	}
+	switch {
+	case importDryRun:
+		fmt.Println("Dry run: no changes were written.")
+	case importAdopt:
+		fmt.Printf("Indexed for search: %d\n", indexed)
+	}
+}
+
+// indexAdopted adds the adopted files to the search index
+func indexAdopted(database *db.DB, adopted []*db.FileStatus) (int, error) {
+	indexer, err := db.NewIndexer(db.IndexConfig{
+		IndexDir:       indexDir,
+		IndexSummaries: true,
+		IndexContent:   true,
+	}, database)
+	if err != nil {
+		return 0, err
+	}
+	defer indexer.Close()
+
+	count := 0
+	for _, file := range adopted {
+		stored, err := database.GetFileByPath(file.Path)
+		if err != nil {
+			return count, err
+		}
+		if stored == nil {
+			continue
+		}
+		if err := indexer.UpdateFile(stored); err != nil {
+			return count, fmt.Errorf("%s: %w", file.Path, err)
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var indexShowMissing bool
+
+// newIndexCommand creates the command group for the search index
+func newIndexCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Keep the search index in step with the catalog",
+		Long: `Every change to the catalog queues the file for the search index in the same
+database transaction. Runs and searches index the queued files, so the index
+catches up even after a crash; these commands do it by hand, rebuild the
+index from scratch or check it against the catalog.
+Examples:
+  archiver index sync
+  archiver index verify --show-missing
+  archiver index rebuild`,
+	}
+
+	cmd.PersistentFlags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.PersistentFlags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "sync",
+		Short: "Index the files changed since the last sync",
+		Run:   executeIndexSync,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rebuild",
+		Short: "Replace the search index with one built from the catalog",
+		Run:   executeIndexRebuild,
+	})
+	verify := &cobra.Command{
+		Use:   "verify",
+		Short: "Check that every cataloged file is in the search index",
+		Run:   executeIndexVerify,
+	}
+	verify.Flags().BoolVar(&indexShowMissing, "show-missing", false, "List the files missing from the index")
+	cmd.AddCommand(verify)
+
+	return cmd
+}
+
+// openIndex opens the database and the search index over it
+func openIndex() (*db.DB, *db.BleveIndexer) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	indexer, err := db.NewIndexer(db.IndexConfig{
+		IndexDir:       indexDir,
+		IndexSummaries: true,
+		IndexContent:   true,
+	}, database)
+	if err != nil {
+		database.Close()
+		fmt.Fprintf(os.Stderr, "Error opening index: %v\n", err)
+		os.Exit(1)
+	}
+	return database, indexer
+}
+
+// syncIndex indexes the files a command changed. A failure only delays
+// finding them in searches, so it is logged rather than returned.
+func syncIndex(database *db.DB) {
+	indexer, err := db.NewIndexer(db.IndexConfig{
+		IndexDir:       indexDir,
+		IndexSummaries: true,
+		IndexContent:   true,
+	}, database)
+	if err == nil {
+		_, err = indexer.Sync(context.Background())
+		indexer.Close()
+	}
+	if err != nil {
+		logger.Warn("could not update the search index; run archiver index sync", "error", err)
+	}
+}
+
+// executeIndexSync indexes the queued files
+func executeIndexSync(cmd *cobra.Command, args []string) {
+	database, indexer := openIndex()
+	defer database.Close()
+	defer indexer.Close()
+
+	count, err := indexer.Sync(commandContext())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error syncing the index: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Indexed %d changed file(s).\n", count)
+}
+
+// executeIndexRebuild builds the index again from the catalog
+func executeIndexRebuild(cmd *cobra.Command, args []string) {
+	database, indexer := openIndex()
+	defer database.Close()
+	defer indexer.Close()
+
+	count, err := indexer.Rebuild(commandContext())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rebuilding the index: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Rebuilt the index with %d file(s).\n", count)
+}
+
+// executeIndexVerify compares the index with the catalog
+func executeIndexVerify(cmd *cobra.Command, args []string) {
+	database, indexer := openIndex()
+	defer database.Close()
+	defer indexer.Close()
+
+	report, err := indexer.Verify()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying the index: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Cataloged files: %d\n", report.Files)
+	fmt.Printf("Indexed documents: %d\n", report.Indexed)
+	fmt.Printf("Missing from the index: %d\n", len(report.Missing))
+	fmt.Printf("Stale documents: %d\n", report.Stale)
+	fmt.Printf("Queued for the next sync: %d\n", report.Pending)
+	if indexShowMissing {
+		for _, id := range report.Missing {
+			if file, err := database.GetFileByID(id); err == nil && file != nil {
+				fmt.Printf("  %d  %s\n", id, file.Path)
+			}
+		}
+	}
+
+	if !report.OK() {
+		if report.Pending > 0 {
+			fmt.Println("Run archiver index sync to index the queued files, or archiver index rebuild if that is not enough.")
+		} else {
+			fmt.Println("Run archiver index rebuild to fix the index.")
+		}
+		os.Exit(1)
+	}
+	fmt.Println("The index matches the catalog.")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/scan"
+	"github.com/jth/archiver/internal/tools"
+	"github.com/spf13/cobra"
+)
+
+// newIngestCommand creates a command that archives NUL-delimited paths
+func newIngestCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ingest <- | path-list>",
+		Short: "Archive NUL-delimited paths read from stdin or a file",
+		Long: `Read NUL-delimited file and directory paths, as written by find -print0,
+and run them through the archiving pipeline: scan, extract and summarize.
+Pass - to read from stdin, so the archiver can be composed with existing
+shell workflows.
+Examples:
+  find /Volumes/OldDrive -name '*.pdf' -newer last-run -print0 | archiver ingest -
+  fd -0 -e docx . ~/Documents | archiver ingest - --summarize basic
+  archiver ingest selection.lst --power-aware`,
+		Args: cobra.ExactArgs(1),
+		Run:  executeIngest,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+	cmd.Flags().BoolVar(&includeAll, "include-all", false, "Disable the default exclusion lists")
+	cmd.Flags().StringVar(&summarize, "summarize", "default", "Summarization level: none, basic, default, or full")
+	cmd.Flags().Float64Var(&costCap, "cost-cap", 5.0, "Maximum LLM spend in USD")
+	cmd.Flags().IntVar(&maxTranscodes, "max-transcodes", 0, "Maximum concurrent video transcodes (default: 1)")
+	cmd.Flags().IntVar(&maxExtractions, "max-extractions", 0, "Maximum concurrent text extractions (default: based on CPU and memory)")
+	cmd.Flags().BoolVar(&powerAware, "power-aware", false, "Pause transcoding and hashing while on battery or thermally throttled")
+
+	return cmd
+}
+
+// executeIngest reads the path list and runs the pipeline over it
+func executeIngest(cmd *cobra.Command, args []string) {
+	var list io.Reader = os.Stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening path list: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		list = file
+	}
+
+	paths, err := scan.ReadNULList(list)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading paths: %v\n", err)
+		os.Exit(1)
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(stdout, "No paths to ingest.")
+		return
+	}
+
+	fmt.Fprintf(stdout, "Ingesting %d path(s)\n", len(paths))
+	tools.PrintHints(stdout)
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	scanner, err := newPathScanner(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating scanner: %v\n", err)
+		os.Exit(1)
+	}
+	defer scanner.Close()
+	if includeAll {
+		scanner.SetPolicy(nil)
+	}
+
+	source := fmt.Sprintf("%d path(s) from %s", len(paths), args[0])
+	if args[0] == "-" {
+		source = fmt.Sprintf("%d path(s) from stdin", len(paths))
+	}
+	if err := runPipeline(database, scanner, "ingest", source); err != nil {
+		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jth/archiver/internal/tools"
+	"github.com/spf13/cobra"
+)
+
+var ffmpegURL string
+
+// newInstallFFmpegCommand creates a command that downloads static builds of
+// ffmpeg and ffprobe
+func newInstallFFmpegCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "install-ffmpeg",
+		Short: "Download static builds of ffmpeg and ffprobe into ~/.archiver/bin",
+		Long: `Download static builds of ffmpeg and ffprobe for this platform (macOS or
+Linux, Intel or ARM) into ~/.archiver/bin, so videos can be transcoded and
+probed without installing ffmpeg system-wide. Each download is checked
+against its published SHA-256 before it is installed. Tools on the PATH are
+used ahead of the ones in ~/.archiver/bin, where builds can also be copied
+by hand.
+
+--url downloads from elsewhere: {os} (macos or linux), {arch} (amd64 or
+arm64) and {tool} (ffmpeg or ffprobe) are replaced, and each ZIP archive
+needs a checksum file at the same URL with .sha256 appended.
+Examples:
+  archiver install-ffmpeg
+  archiver install-ffmpeg --url https://mirror.example.com/ffmpeg/{os}-{arch}/{tool}.zip`,
+		Args: cobra.NoArgs,
+		Run:  executeInstallFFmpeg,
+	}
+
+	cmd.Flags().StringVar(&ffmpegURL, "url", tools.DefaultFFmpegURL, "URL template of the builds to download")
+
+	return cmd
+}
+
+// executeInstallFFmpeg downloads and installs the builds
+func executeInstallFFmpeg(cmd *cobra.Command, args []string) {
+	fmt.Println("Downloading ffmpeg and ffprobe...")
+	installed, err := tools.InstallFFmpeg(commandContext(), ffmpegURL)
+	for _, path := range installed {
+		fmt.Printf("Installed %s\n", path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(tools.Version("ffmpeg"))
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 
 	"github.com/jth/archiver/internal/interactive"
+	"github.com/jth/archiver/internal/policy"
+	"github.com/jth/archiver/internal/scan"
 	"github.com/spf13/cobra"
 )
 
@@ -77,9 +79,7 @@ func executeInteractive(cmd *cobra.Command, args []string) {
 	fmt.Println("\nBackup Summary:")
 	fmt.Println("---------------")
 	fmt.Println("Selected drives:")
-	for i, drive := range selectedDrives {
-		fmt.Printf("  %d. %s\n", i+1, drive)
-	}
+	printDriveEstimates(selectedDrives)
 
 	fmt.Printf("\nBackup provider: %s\n", backupOptions.BackupProvider)
 	fmt.Printf("Create local copy: %t\n", backupOptions.CreateLocalCopy)
@@ -102,6 +102,31 @@ func executeInteractive(cmd *cobra.Command, args []string) {
 	executeBackup(backupOptions)
 }
 
+// printDriveEstimates lists the selected drives with a quick estimate of the
+// files and bytes to process, so totals are known before confirming
+func printDriveEstimates(selectedDrives []string) {
+	defaultPolicy, err := policy.Default()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not load exclusion lists: %v\n", err)
+	}
+
+	var totalFiles, totalBytes int64
+	for i, drive := range selectedDrives {
+		estimate, err := scan.EstimateSize(drive, defaultPolicy)
+		if err != nil {
+			fmt.Printf("  %d. %s (size unknown: %v)\n", i+1, drive, err)
+			continue
+		}
+		fmt.Printf("  %d. %s - %d files, %s\n", i+1, drive, estimate.Files, formatSize(estimate.Bytes))
+		totalFiles += estimate.Files
+		totalBytes += estimate.Bytes
+	}
+
+	if len(selectedDrives) > 1 {
+		fmt.Printf("  Total: %d files, %s\n", totalFiles, formatSize(totalBytes))
+	}
+}
+
 // executeBackup handles the actual backup process based on options
 func executeBackup(options *interactive.BackupOptions) {
 	// For now, just print what we would do
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/labels"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	labelsOutput     string
+	labelsDrives     []string
+	labelsCatalogURL string
+	labelsAll        bool
+)
+
+// newLabelsCommand creates a command that prints labels for archived drives
+func newLabelsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "labels",
+		Short: "Generate printable QR-coded labels for fully archived drives",
+		Long: `Generate a PDF with one 4x2 inch label per drive whose files have all been
+uploaded, and copied to every replica, for drives retired to a drawer. Each label shows the drive name,
+archive date, bucket and prefix, file count and size, and a QR code linking to
+the drive's catalog entry. Drives are recognised by their mount point, as in
+search --drive.
+
+--catalog-url sets the QR link; {drive} in it is replaced with the drive name.
+Without it the QR code holds the label details as text.
+Examples:
+  archiver labels --output labels.pdf
+  archiver labels --drive Photos2019 --catalog-url "https://archive.example.com/?drive={drive}"`,
+		Run: executeLabels,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVarP(&labelsOutput, "output", "o", "labels.pdf", "PDF file to write")
+	cmd.Flags().StringSliceVar(&labelsDrives, "drive", nil, "Only label these drives (repeatable)")
+	cmd.Flags().StringVar(&labelsCatalogURL, "catalog-url", "", "Link encoded in the QR code; {drive} is replaced with the drive name")
+	cmd.Flags().BoolVar(&labelsAll, "all", false, "Also label drives with files not uploaded yet")
+
+	return cmd
+}
+
+// executeLabels writes labels for the selected drives
+func executeLabels(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	summaries, err := database.DriveSummaries(replicaNames()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error summarizing drives: %v\n", err)
+		os.Exit(1)
+	}
+
+	var driveLabels []labels.Label
+	for _, summary := range summaries {
+		if len(labelsDrives) > 0 && !containsFold(labelsDrives, summary.Name) {
+			continue
+		}
+		if !summary.Complete() && !labelsAll {
+			fmt.Printf("Skipping %s: %d of %d files archived\n", summary.Name, summary.Uploaded, summary.Files)
+			continue
+		}
+		driveLabels = append(driveLabels, driveLabel(summary))
+	}
+	if len(driveLabels) == 0 {
+		fmt.Println("No drives to label.")
+		return
+	}
+
+	file, err := os.Create(labelsOutput)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+		os.Exit(1)
+	}
+	if err := labels.WritePDF(file, driveLabels); err != nil {
+		file.Close()
+		fmt.Fprintf(os.Stderr, "Error writing labels: %v\n", err)
+		os.Exit(1)
+	}
+	if err := file.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing labels: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Wrote %d label(s) to %s\n", len(driveLabels), labelsOutput)
+}
+
+// driveLabel builds the label of a drive. The bucket and prefix come from
+// the common part of its upload URLs.
+func driveLabel(summary *db.DriveSummary) labels.Label {
+	label := labels.Label{
+		Drive:      summary.Name,
+		ArchivedAt: summary.LastUpload,
+		Files:      summary.Files,
+		Bytes:      summary.Bytes,
+	}
+
+	prefix := summary.URLPrefix
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		prefix = prefix[:i+1]
+	}
+	if bucket, name, err := upload.SplitFileURL(prefix); err == nil {
+		label.Bucket, label.Prefix = bucket, name
+	} else if summary.Uploaded > 0 {
+		label.Bucket = "(several)"
+	}
+
+	if labelsCatalogURL != "" {
+		label.Link = strings.ReplaceAll(labelsCatalogURL, "{drive}", url.QueryEscape(summary.Name))
+	} else {
+		label.Link = fmt.Sprintf("Archiver drive %s\nArchived %s\nBucket %s/%s\n%d files",
+			summary.Name, summary.LastUpload.Format("2006-01-02"), label.Bucket, label.Prefix, summary.Files)
+		if health := summary.Health; health != nil {
+			status := "healthy"
+			if problems := health.Problems(); len(problems) > 0 {
+				status = strings.Join(problems, ", ")
+			}
+			label.Link += fmt.Sprintf("\nSMART %s (%s)", status, health.CheckedAt.Format("2006-01-02"))
+		}
+	}
+	return label
+}
+
+// containsFold reports whether values contains s, ignoring case
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lifecyclePrefix      string
+	lifecycleHideAfter   int
+	lifecycleDeleteAfter int
+	lifecycleKeepLast    bool
+	lifecycleRemove      bool
+)
+
+// newLifecycleCommand creates a command that shows and edits the bucket's
+// lifecycle rules
+func newLifecycleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lifecycle",
+		Short: "Show or set the lifecycle rules of the B2 bucket",
+		Long: `Show the lifecycle rules of the bucket, which hide files some days after they
+are uploaded and delete hidden (replaced or deleted) versions some days after
+they are hidden. With --hide-after, --delete-after or --keep-last-version the
+rule for --prefix is set, replacing any rule for the same prefix; --remove
+removes it. An empty prefix applies to the whole bucket.
+Examples:
+  archiver lifecycle
+  archiver lifecycle --keep-last-version
+  archiver lifecycle --prefix tmp/ --hide-after 30 --delete-after 1
+  archiver lifecycle --prefix tmp/ --remove`,
+		Run: executeLifecycle,
+	}
+
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Backblaze B2 bucket name (default: from config)")
+	cmd.Flags().StringVar(&lifecyclePrefix, "prefix", "", "File name prefix the rule applies to")
+	cmd.Flags().IntVar(&lifecycleHideAfter, "hide-after", 0, "Hide files this many days after they are uploaded")
+	cmd.Flags().IntVar(&lifecycleDeleteAfter, "delete-after", 0, "Delete hidden versions this many days after they are hidden")
+	cmd.Flags().BoolVar(&lifecycleKeepLast, "keep-last-version", false, "Keep only the last version of each file (delete hidden versions after a day)")
+	cmd.Flags().BoolVar(&lifecycleRemove, "remove", false, "Remove the rule for --prefix")
+
+	return cmd
+}
+
+// executeLifecycle prints or updates the lifecycle rules
+func executeLifecycle(cmd *cobra.Command, args []string) {
+	if cmd.Flags().Changed("bucket") {
+		appConfig.B2Bucket = bucket
+	}
+	if err := appConfig.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(1)
+	}
+
+	uploader, err := newUploader()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+		os.Exit(1)
+	}
+	defer uploader.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	rules, err := uploader.LifecycleRules(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading lifecycle rules: %v\n", err)
+		os.Exit(1)
+	}
+
+	setting := cmd.Flags().Changed("hide-after") || cmd.Flags().Changed("delete-after") || lifecycleKeepLast
+	if setting || lifecycleRemove {
+		if setting && lifecycleRemove {
+			fmt.Fprintf(os.Stderr, "Error: --remove can't be combined with a rule\n")
+			os.Exit(1)
+		}
+
+		var kept []upload.LifecycleRule
+		for _, rule := range rules {
+			if rule.FileNamePrefix != lifecyclePrefix {
+				kept = append(kept, rule)
+			}
+		}
+		if setting {
+			rule := upload.LifecycleRule{FileNamePrefix: lifecyclePrefix}
+			if lifecycleKeepLast {
+				rule = upload.KeepLastVersion(lifecyclePrefix)
+			}
+			if cmd.Flags().Changed("hide-after") {
+				rule.DaysFromUploadingToHiding = &lifecycleHideAfter
+			}
+			if cmd.Flags().Changed("delete-after") {
+				rule.DaysFromHidingToDeleting = &lifecycleDeleteAfter
+			}
+			kept = append(kept, rule)
+		}
+
+		if err := uploader.SetLifecycleRules(ctx, kept); err != nil {
+			fmt.Fprintf(os.Stderr, "Error setting lifecycle rules: %v\n", err)
+			os.Exit(1)
+		}
+		rules = kept
+	}
+
+	printLifecycleRules(rules)
+}
+
+// printLifecycleRules lists lifecycle rules
+func printLifecycleRules(rules []upload.LifecycleRule) {
+	if len(rules) == 0 {
+		fmt.Printf("No lifecycle rules in %s: every version of every file is kept.\n", appConfig.B2Bucket)
+		return
+	}
+
+	fmt.Printf("Lifecycle rules of %s:\n", appConfig.B2Bucket)
+	for _, rule := range rules {
+		prefix := rule.FileNamePrefix
+		if prefix == "" {
+			prefix = "(all files)"
+		}
+		hide, del := "never hidden", "hidden versions kept"
+		if rule.DaysFromUploadingToHiding != nil {
+			hide = fmt.Sprintf("hidden %d day(s) after upload", *rule.DaysFromUploadingToHiding)
+		}
+		if rule.DaysFromHidingToDeleting != nil {
+			del = fmt.Sprintf("hidden versions deleted after %d day(s)", *rule.DaysFromHidingToDeleting)
+		}
+		fmt.Printf("  %-20s %s, %s\n", prefix, hide, del)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/backup"
+	"github.com/jth/archiver/internal/config"
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/tagging"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lockRun         int64
+	lockYears       int
+	lockMode        string
+	lockLegalHold   bool
+	lockReleaseHold bool
+	lockList        bool
+	lockDryRun      bool
+)
+
+// newLockCommand creates a command that makes uploads immutable with B2
+// Object Lock
+func newLockCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock [path...]",
+		Short: "Make uploaded files immutable for years with B2 Object Lock",
+		Long: `Lock the uploads of files, or of every file below a folder, or of the files a
+run uploaded with --run, so that they can't be deleted or overwritten until the
+retention ends, or while they are under a legal hold. The bucket must have
+been created with Object Lock enabled, and the key needs the writeFileRetentions
+and writeFileLegalHolds capabilities.
+
+In governance mode a key with bypassGovernance can still unlock files; in
+compliance mode nobody can, and retention can only be extended. Locks are
+recorded in the catalog, and delete and purge refuse locked files. The
+retention setting of the config file locks files as backup-diff uploads them;
+--years and --mode default to it.
+Examples:
+  archiver lock /Volumes/OldDrive/Tax --years 7 --mode compliance
+  archiver lock --run 42 --years 10
+  archiver lock /Volumes/OldDrive/Contracts/lease.pdf --legal-hold
+  archiver lock /Volumes/OldDrive/Contracts/lease.pdf --release-hold
+  archiver lock --list`,
+		Run: executeLock,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Backblaze B2 bucket name (default: from config)")
+	cmd.Flags().Int64Var(&lockRun, "run", 0, "Lock the files uploaded by this run")
+	cmd.Flags().IntVar(&lockYears, "years", 0, "Years to retain the files for (default: retention.years from config)")
+	cmd.Flags().StringVar(&lockMode, "mode", "", "Retention mode, governance or compliance (default: retention.mode from config)")
+	cmd.Flags().BoolVar(&lockLegalHold, "legal-hold", false, "Place a legal hold on the files, which lasts until released")
+	cmd.Flags().BoolVar(&lockReleaseHold, "release-hold", false, "Release the legal hold on the files")
+	cmd.Flags().BoolVar(&lockList, "list", false, "List the locked files")
+	cmd.Flags().BoolVar(&lockDryRun, "dry-run", false, "List the files without locking them")
+
+	return cmd
+}
+
+// executeLock locks the selected uploads, releases their legal holds, or
+// lists the locks
+func executeLock(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	if lockList {
+		listLocks(database)
+		return
+	}
+	if len(args) == 0 && lockRun == 0 {
+		fmt.Fprintln(os.Stderr, "Error: give the paths to lock or --run")
+		os.Exit(1)
+	}
+
+	var retention *upload.Retention
+	if !lockReleaseHold {
+		if retention, err = lockRetention(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	files, err := lockedFiles(database, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if lockReleaseHold {
+		fmt.Printf("%d file(s) to release\n", len(files))
+	} else {
+		fmt.Printf("%d file(s) to lock (%s)\n", len(files), describeRetention(retention))
+	}
+	if lockDryRun {
+		for _, file := range files {
+			fmt.Printf("  %s\n", file.Path)
+		}
+		return
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	if cmd.Flags().Changed("bucket") {
+		appConfig.B2Bucket = bucket
+	}
+	if err := appConfig.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(1)
+	}
+	uploader, err := newUploader()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+		os.Exit(1)
+	}
+	defer uploader.Close()
+
+	ctx := context.Background()
+	var done, failed int
+	for _, file := range files {
+		if lockReleaseHold {
+			err = uploader.ReleaseLegalHold(ctx, file.UploadedURL)
+			if err == nil {
+				err = database.ReleaseLegalHold(file.ID)
+			}
+		} else {
+			err = uploader.SetRetention(ctx, file.UploadedURL, *retention)
+			if err == nil {
+				err = database.RecordLock(lockOf(file.ID, *retention))
+			}
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "  FAILED %s: %v\n", file.Path, err)
+			continue
+		}
+		done++
+	}
+
+	if lockReleaseHold {
+		fmt.Printf("Released %d file(s), %d failed\n", done, failed)
+	} else {
+		fmt.Printf("Locked %d file(s), %d failed\n", done, failed)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// lockRetention returns the retention given by the flags, defaulting to the
+// config file's
+func lockRetention() (*upload.Retention, error) {
+	years, mode := lockYears, lockMode
+	if years == 0 {
+		years = appConfig.Retention.Years
+	}
+	if mode == "" {
+		mode = appConfig.Retention.Mode
+	}
+	if years < 0 {
+		return nil, fmt.Errorf("--years can't be negative")
+	}
+	if years == 0 && !lockLegalHold {
+		return nil, fmt.Errorf("give --years, --legal-hold or set retention.years in the config file")
+	}
+	if years == 0 {
+		mode = ""
+	} else if err := upload.CheckRetentionMode(mode); err != nil {
+		return nil, err
+	}
+	return upload.RetentionFor(mode, years, lockLegalHold), nil
+}
+
+// lockedFiles returns the uploaded files given as paths, below folders given
+// as paths, and uploaded by the run given with --run
+func lockedFiles(database *db.DB, args []string) ([]*db.FileStatus, error) {
+	var roots []string
+	for _, arg := range args {
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", arg, err)
+		}
+		roots = append(roots, path)
+	}
+
+	var files []*db.FileStatus
+	seen := make(map[int64]bool)
+	add := func(file *db.FileStatus) {
+		if !seen[file.ID] && file.UploadedURL != "" {
+			seen[file.ID] = true
+			files = append(files, file)
+		}
+	}
+
+	if len(roots) > 0 {
+		err := database.ForEachFile(true, func(file *db.FileStatus) error {
+			for _, root := range roots {
+				if file.Path == root || strings.HasPrefix(file.Path, root+string(filepath.Separator)) {
+					add(file)
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if lockRun != 0 {
+		run, err := database.GetRun(lockRun)
+		if err != nil {
+			return nil, err
+		}
+		until := time.Now()
+		if run.FinishedAt.Valid {
+			until = run.FinishedAt.Time
+		}
+		err = database.ForEachFileChanged(run.StartedAt, until, func(file *db.FileStatus) error {
+			if file.UploadTime.Valid && !file.UploadTime.Time.Before(run.StartedAt) && !file.UploadTime.Time.After(until) {
+				add(file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// listLocks prints the locked uploads
+func listLocks(database *db.DB) {
+	locks, err := database.GetLocks()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing locks: %v\n", err)
+		os.Exit(1)
+	}
+	now := time.Now()
+	var active int
+	for _, lock := range locks {
+		if !lock.Locked(now) {
+			continue
+		}
+		active++
+		fmt.Printf("%s  %s\n", lock.Path, describeLock(lock))
+	}
+	if active == 0 {
+		fmt.Println("No locked files.")
+	}
+}
+
+// describeLock describes the lock of an upload
+func describeLock(lock *db.Lock) string {
+	var parts []string
+	if lock.RetainUntil.Valid && time.Now().Before(lock.RetainUntil.Time) {
+		parts = append(parts, fmt.Sprintf("%s until %s", lock.Mode, lock.RetainUntil.Time.Format("2006-01-02")))
+	}
+	if lock.LegalHold {
+		parts = append(parts, "legal hold")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeRetention describes a retention about to be applied
+func describeRetention(retention *upload.Retention) string {
+	return describeLock(lockOf(0, *retention))
+}
+
+// lockOf is the catalog record of a retention applied to a file's upload
+func lockOf(fileID int64, retention upload.Retention) *db.Lock {
+	lock := &db.Lock{FileID: fileID, LegalHold: retention.LegalHold}
+	if retention.Mode != "" {
+		lock.Mode = retention.Mode
+		lock.RetainUntil = sql.NullTime{Time: retention.Until, Valid: true}
+	}
+	return lock
+}
+
+// checkUnlocked returns an error if the upload of a file is locked
+func checkUnlocked(database *db.DB, file *db.FileStatus) error {
+	lock, err := database.GetLock(file.ID)
+	if err != nil {
+		return err
+	}
+	if lock.Locked(time.Now()) {
+		return fmt.Errorf("%s is locked (%s)", file.Path, describeLock(lock))
+	}
+	return nil
+}
+
+// planRetention sets the retention the config file gives each pending
+// upload, returning it and how many uploads will be locked
+func planRetention(pending []backup.Change, targets []remoteTarget) (int, *upload.Retention, error) {
+	policy := appConfig.Retention
+	if !policy.Enabled() {
+		return 0, nil, nil
+	}
+	matches, err := retentionMatcher(policy)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	mode := policy.Mode
+	if policy.Years == 0 {
+		mode = ""
+	}
+	retention := upload.RetentionFor(mode, policy.Years, policy.LegalHold)
+	locked := 0
+	for i, change := range pending {
+		if change.NeedsUpload() && matches(change.File.Path) {
+			targets[i].retention = retention
+			locked++
+		}
+	}
+	return locked, retention, nil
+}
+
+// retentionMatcher returns a function reporting whether the retention
+// policy covers a path
+func retentionMatcher(policy config.Retention) (func(path string) bool, error) {
+	if len(policy.Paths) == 0 {
+		return func(string) bool { return true }, nil
+	}
+	tagger := tagging.NewTagger()
+	for _, pattern := range policy.Paths {
+		if err := tagger.Add(pattern, "retention"); err != nil {
+			return nil, fmt.Errorf("invalid retention path in config: %w", err)
+		}
+	}
+	return func(path string) bool { return len(tagger.Tags(path)) > 0 }, nil
+}
@@ -1,10 +1,31 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/jth/archiver/internal/config"
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/doc"
+	"github.com/jth/archiver/internal/drives"
+	"github.com/jth/archiver/internal/logging"
+	"github.com/jth/archiver/internal/notify"
+	"github.com/jth/archiver/internal/pipeline"
+	"github.com/jth/archiver/internal/power"
+	"github.com/jth/archiver/internal/progress"
+	"github.com/jth/archiver/internal/scan"
+	"github.com/jth/archiver/internal/scratch"
+	"github.com/jth/archiver/internal/summariser"
+	"github.com/jth/archiver/internal/tools"
+	"github.com/jth/archiver/internal/upload"
 	"github.com/spf13/cobra"
 )
 
@@ -17,8 +38,33 @@ var (
 	summarize       string
 	stubMode        string
 	costCap         float64
+	maxTranscodes   int
+	maxExtractions  int
+	powerAware      bool
 	appConfig       *config.Config
 	debugMode       bool
+	logLevel        string
+	logFile         string
+	logFormat       string
+	logger          *slog.Logger
+	logCloser       io.Closer
+	progressFormat  string
+	progressSocket  string
+	progressEvents  io.Writer
+	progressCloser  io.Closer             // The progress socket, closed when the command ends
+	stdout          io.Writer = os.Stdout // Command output; stderr while stdout carries progress events
+	dashboard       *progress.InteractiveMode
+	dashboardLogger *slog.Logger // Logger to restore when the dashboard closes
+	serveAddr       string
+	webServer       *progress.WebServer
+	webLogger       *slog.Logger // Logger to restore when the web server stops
+	stopPauses      func()       // Stops pausing the run's tracker on a signal
+	scratchDir      string
+	dbSyncMode      string
+	notifyDesktop   bool
+	webhookURLs     []string
+	notifier        *notify.Notifier
+	tikaServer      *doc.TikaServer
 	interactiveMode bool = true // Default to interactive mode
 )
 
@@ -28,20 +74,38 @@ func main() {
 		Short: "Archiver - Process, summarize, and backup files to B2",
 		Long: `Archiver is a CLI tool that ingests an external drive, transcodes videos,
 summarizes documents, uploads to Backblaze B2, and provides a searchable index.`,
-		PersistentPreRun: loadConfig,
-		Run:              executeArchiver,
+		PersistentPreRun:  loadConfig,
+		PersistentPostRun: finishCommand,
+		Run:               executeArchiver,
 	}
 
 	// Define flags
 	rootCmd.PersistentFlags().StringVar(&configPath, "config", "./config.json", "Path to config file (optional)")
 	rootCmd.PersistentFlags().BoolVar(&debugMode, "debug", false, "Enable debug output")
-	rootCmd.Flags().StringVarP(&sourcePath, "source", "s", "", "Path to the source directory (required)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "warn", "Log level: debug, info, warn, or error")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Append logs to this file instead of stderr")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Log format: text or json")
+	rootCmd.PersistentFlags().StringVar(&progressFormat, "progress-format", "text", "Progress output: text (progress bars), json (newline-delimited events) or tui (dashboard)")
+	rootCmd.PersistentFlags().StringVar(&progressSocket, "progress-socket", "", "Serve JSON progress events on this Unix socket, for clients to connect to, instead of stdout")
+	rootCmd.PersistentFlags().StringVar(&serveAddr, "serve", "", "Serve a live progress page at http://<address>/progress, such as localhost:8080")
+	rootCmd.PersistentFlags().StringVar(&scratchDir, "scratch-dir", "", "Folder for transcodes, previews and other intermediate files (default: scratch_dir from the config, or the system temporary folder)")
+	rootCmd.PersistentFlags().StringVar(&dbSyncMode, "db-sync-mode", "", "How often the database waits for writes to reach the disk: off, normal, full or extra (default: db_sync_mode from the config, or normal)")
+	rootCmd.PersistentFlags().BoolVar(&notifyDesktop, "notify", false, "Show a desktop notification when a run finishes or fails")
+	rootCmd.PersistentFlags().StringArrayVar(&webhookURLs, "webhook", nil, "Post the run summary to this URL when a run finishes or fails (Slack, Discord or generic JSON; repeatable)")
+	rootCmd.Flags().StringVarP(&sourcePath, "source", "s", "", "Source directory, file or glob (required unless --files-from is set)")
+	rootCmd.Flags().StringVar(&filesFrom, "files-from", "", "File listing paths to archive, one per line (- for stdin)")
+	rootCmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	rootCmd.Flags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+	rootCmd.Flags().BoolVar(&includeAll, "include-all", false, "Disable the default exclusion lists")
 	rootCmd.Flags().StringVar(&b2KeyID, "b2-key-id", "", "Backblaze B2 Key ID (required)")
 	rootCmd.Flags().StringVar(&b2AppKey, "b2-app-key", "", "Backblaze B2 Application Key (required)")
 	rootCmd.Flags().StringVar(&bucket, "bucket", "", "Backblaze B2 bucket name (required)")
 	rootCmd.Flags().StringVar(&summarize, "summarize", "default", "Summarization level: none, basic, default, or full")
 	rootCmd.Flags().StringVar(&stubMode, "stub-mode", "webloc", "Local stub format: webloc, shortcut, or none")
 	rootCmd.Flags().Float64Var(&costCap, "cost-cap", 5.0, "Maximum LLM spend in USD")
+	rootCmd.Flags().IntVar(&maxTranscodes, "max-transcodes", 0, "Maximum concurrent video transcodes (default: 1)")
+	rootCmd.Flags().IntVar(&maxExtractions, "max-extractions", 0, "Maximum concurrent text extractions (default: based on CPU and memory)")
+	rootCmd.Flags().BoolVar(&powerAware, "power-aware", false, "Pause transcoding and hashing while on battery or thermally throttled")
 	rootCmd.Flags().BoolVarP(&interactiveMode, "interactive", "i", true, "Start in interactive mode (default)")
 
 	// Only mark flags as required if not in interactive mode
@@ -51,7 +115,7 @@ summarizes documents, uploads to Backblaze B2, and provides a searchable index.`
 	}
 
 	if !interactiveMode && !isInteractiveArg {
-		rootCmd.MarkFlagRequired("source")
+		rootCmd.MarkFlagsOneRequired("source", "files-from")
 		rootCmd.MarkFlagRequired("b2-key-id")
 		rootCmd.MarkFlagRequired("b2-app-key")
 		rootCmd.MarkFlagRequired("bucket")
@@ -59,24 +123,71 @@ summarizes documents, uploads to Backblaze B2, and provides a searchable index.`
 
 	// Add subcommands
 	rootCmd.AddCommand(newSearchCommand())
+	rootCmd.AddCommand(newIndexCommand())
 	rootCmd.AddCommand(newInteractiveCommand())
+	rootCmd.AddCommand(newExportManifestCommand())
+	rootCmd.AddCommand(newReprocessCommand())
+	rootCmd.AddCommand(newResummarizeCommand())
+	rootCmd.AddCommand(newImportCommand())
+	rootCmd.AddCommand(newBackupDiffCommand())
+	rootCmd.AddCommand(newCheckDriveCommand())
+	rootCmd.AddCommand(newRestoreCommand())
+	rootCmd.AddCommand(newVersionsCommand())
+	rootCmd.AddCommand(newPeekCommand())
+	rootCmd.AddCommand(newStreamURLCommand())
+	rootCmd.AddCommand(newShareCommand())
+	rootCmd.AddCommand(newResolveCommand())
+	rootCmd.AddCommand(newUnstubCommand())
+	rootCmd.AddCommand(newQuarantineCommand())
+	rootCmd.AddCommand(newSalvageCommand())
+	rootCmd.AddCommand(newLifecycleCommand())
+	rootCmd.AddCommand(newBucketCommand())
+	rootCmd.AddCommand(newMigrateCommand())
+	rootCmd.AddCommand(newCostsCommand())
+	rootCmd.AddCommand(newScanCommand())
+	rootCmd.AddCommand(newCapabilitiesCommand())
+	rootCmd.AddCommand(newDoctorCommand())
+	rootCmd.AddCommand(newInstallFFmpegCommand())
+	rootCmd.AddCommand(newIngestCommand())
+	rootCmd.AddCommand(newScheduleCommand())
+	rootCmd.AddCommand(newRetagCommand())
+	rootCmd.AddCommand(newTagCommand())
+	rootCmd.AddCommand(newNoteCommand())
+	rootCmd.AddCommand(newRunsCommand())
+	rootCmd.AddCommand(newTraceCommand())
+	rootCmd.AddCommand(newTextCommand())
+	rootCmd.AddCommand(newResumeCommand())
+	rootCmd.AddCommand(newDeleteCommand())
+	rootCmd.AddCommand(newUndeleteCommand())
+	rootCmd.AddCommand(newPurgeCommand())
+	rootCmd.AddCommand(newLockCommand())
+	rootCmd.AddCommand(newDupesCommand())
+	rootCmd.AddCommand(newStatsCommand())
+	rootCmd.AddCommand(newReportCommand())
+	rootCmd.AddCommand(newExportSiteCommand())
+	rootCmd.AddCommand(newExportBundleCommand())
+	rootCmd.AddCommand(newLabelsCommand())
+	rootCmd.AddCommand(newConfigCommand())
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(stdout, err)
 		os.Exit(1)
 	}
 }
 
 func loadConfig(cmd *cobra.Command, args []string) {
+	setupLogging(cmd)
+	setupProgress()
+
 	// First, try to load from config file if it exists
 	if _, statErr := os.Stat(configPath); statErr == nil {
 		var err error
 		appConfig, err = config.LoadFromFile(configPath)
 		if err != nil {
-			fmt.Printf("Warning: Could not load config file: %v\n", err)
+			fmt.Fprintf(stdout, "Warning: Could not load config file: %v\n", err)
 			// Continue to load from env and flags
 		} else if debugMode {
-			fmt.Printf("Loaded configuration from: %s\n", configPath)
+			fmt.Fprintf(stdout, "Loaded configuration from: %s\n", configPath)
 		}
 	}
 
@@ -84,7 +195,7 @@ func loadConfig(cmd *cobra.Command, args []string) {
 	if appConfig == nil {
 		appConfig = config.LoadFromEnv()
 		if debugMode {
-			fmt.Println("Loaded configuration from environment variables")
+			fmt.Fprintln(stdout, "Loaded configuration from environment variables")
 		}
 	}
 
@@ -125,8 +236,17 @@ func loadConfig(cmd *cobra.Command, args []string) {
 		costCap = appConfig.CostCapUSD
 	}
 
-	// If interactive flag is used, start the interactive command
-	if interactiveMode && cmd.Name() != "interactive" && cmd.Name() != "help" {
+	setupNotifier()
+	setupScratch()
+	setupDatabase()
+	setupTika()
+	doc.SetStripBoilerplate(appConfig.StripHTMLBoilerplate)
+	// Uploads are done by the archiver itself, so only the tools it starts
+	// give way
+	tools.SetLowPriority(appConfig.Concurrency.Priority == "uploads")
+
+	// If interactive flag is used on the root command, start the interactive command
+	if interactiveMode && cmd == cmd.Root() {
 		// We're in root command with interactive flag - pass control to interactive command
 		interactiveCmd := newInteractiveCommand()
 		interactiveCmd.Run(cmd, args)
@@ -135,12 +255,347 @@ func loadConfig(cmd *cobra.Command, args []string) {
 
 	// Print API key info in debug mode
 	if debugMode {
-		fmt.Println("Configuration loaded successfully")
-		fmt.Printf("B2 Key ID: %s...\n", maskString(appConfig.B2KeyID))
-		fmt.Printf("Anthropic API Key: %s...\n", maskString(appConfig.AnthropicAPIKey))
-		fmt.Printf("OpenAI API Key: %s...\n", maskString(appConfig.OpenAIAPIKey))
-		fmt.Printf("Mistral API Key: %s...\n", maskString(appConfig.MistralAPIKey))
-		fmt.Printf("Grok API Key: %s...\n", maskString(appConfig.GrokAPIKey))
+		fmt.Fprintln(stdout, "Configuration loaded successfully")
+		fmt.Fprintf(stdout, "B2 Key ID: %s...\n", maskString(appConfig.B2KeyID))
+		fmt.Fprintf(stdout, "Anthropic API Key: %s...\n", maskString(appConfig.AnthropicAPIKey))
+		fmt.Fprintf(stdout, "OpenAI API Key: %s...\n", maskString(appConfig.OpenAIAPIKey))
+		fmt.Fprintf(stdout, "Mistral API Key: %s...\n", maskString(appConfig.MistralAPIKey))
+		fmt.Fprintf(stdout, "Grok API Key: %s...\n", maskString(appConfig.GrokAPIKey))
+	}
+}
+
+// setupLogging creates the logger from the log flags and makes it the
+// default. --debug raises the level to debug unless --log-level is set.
+func setupLogging(cmd *cobra.Command) {
+	level := logLevel
+	if debugMode && !cmd.Flags().Changed("log-level") {
+		level = "debug"
+	}
+
+	var err error
+	logger, logCloser, err = logging.New(logging.Options{
+		Level:  level,
+		File:   logFile,
+		Format: logFormat,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+}
+
+// setupProgress opens the JSON progress event stream when requested. Events
+// written to stdout get it to themselves: the commands write their output to
+// stdout, which moves to stderr.
+func setupProgress() {
+	switch progressFormat {
+	case "text":
+		if progressSocket == "" {
+			return
+		}
+	case "tui":
+		return
+	case "json":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown progress format %q (expected text, json or tui)\n", progressFormat)
+		os.Exit(1)
+	}
+
+	if progressSocket != "" {
+		socket, err := progress.ListenSocket(progressSocket)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating progress socket: %v\n", err)
+			os.Exit(1)
+		}
+		progressEvents, progressCloser = socket, socket
+		return
+	}
+
+	progressEvents = os.Stdout
+	stdout = os.Stderr
+}
+
+// setupNotifier creates the run notifier from the notify config, with
+// --notify and --webhook added to it
+func setupNotifier() {
+	webhooks := make([]notify.Webhook, 0, len(appConfig.Notify.Webhooks)+len(webhookURLs))
+	for _, webhook := range appConfig.Notify.Webhooks {
+		webhooks = append(webhooks, notify.Webhook{URL: webhook.URL, Type: webhook.Type})
+	}
+	for _, url := range webhookURLs {
+		webhooks = append(webhooks, notify.Webhook{URL: url})
+	}
+
+	var err error
+	notifier, err = notify.New(appConfig.Notify.Desktop || notifyDesktop, webhooks, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// setupScratch points intermediate files at the scratch folder, removing
+// what killed runs left there
+func setupScratch() {
+	if scratchDir != "" {
+		appConfig.ScratchDir = scratchDir
+	}
+	if err := scratch.Configure(appConfig.ScratchDir, int64(appConfig.MinFreeGB*(1<<30))); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if removed, err := scratch.RemoveStale(24 * time.Hour); err != nil {
+		logger.Warn("could not clean the scratch folder", "error", err)
+	} else if removed > 0 {
+		logger.Info("removed files left in the scratch folder by earlier runs", "count", removed)
+	}
+}
+
+// setupDatabase applies the database settings of the config and flags to
+// the databases the command opens
+func setupDatabase() {
+	if dbSyncMode != "" {
+		appConfig.DBSyncMode = dbSyncMode
+	}
+	if err := db.SetSyncMode(appConfig.DBSyncMode); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// setupTika points document extraction at the Tika server of the config,
+// which is started on first use if nothing answers there
+func setupTika() {
+	if appConfig.TikaURL == "" {
+		return
+	}
+	tikaServer = doc.NewTikaServer(appConfig.TikaURL, doc.TikaLauncher(appConfig.TikaServerJar)...)
+	doc.SetTikaServer(tikaServer)
+}
+
+// newUploader creates a B2 client with the credentials, bucket and
+// encryption settings of the config
+func newUploader() (*upload.B2Uploader, error) {
+	return newUploaderFor(appConfig.B2Bucket)
+}
+
+// newUploaderFor creates a B2 client for another bucket of the account, with
+// the credentials and encryption settings of the config
+func newUploaderFor(bucketName string) (*upload.B2Uploader, error) {
+	b2Config := upload.B2Config{
+		KeyID:      appConfig.B2KeyID,
+		AppKey:     appConfig.B2AppKey,
+		BucketName: bucketName,
+		Encryption: appConfig.B2Encryption,
+		Concurrent: appConfig.Concurrency.Uploads,
+		Timeout:    minutes(appConfig.Timeouts.Upload),
+		Logger:     logger,
+	}
+	if appConfig.B2CustomerKey != "" {
+		key, err := base64.StdEncoding.DecodeString(appConfig.B2CustomerKey)
+		if err != nil {
+			return nil, fmt.Errorf("b2_sse_c_key is not valid base64: %w", err)
+		}
+		b2Config.CustomerKey = key
+	}
+	return upload.NewB2Uploader(b2Config)
+}
+
+// pipelineTimeouts returns the per-file timeouts of the config
+func pipelineTimeouts() pipeline.Timeouts {
+	return pipeline.Timeouts{
+		Extract:   minutes(appConfig.Timeouts.Extract),
+		Transcode: minutes(appConfig.Timeouts.Transcode),
+		Summarize: minutes(appConfig.Timeouts.Summarize),
+	}
+}
+
+// minutes converts a number of minutes from the config to a duration
+func minutes(n int) time.Duration {
+	return time.Duration(n) * time.Minute
+}
+
+// replicaNames returns the names of the configured replicas, which a file
+// must be copied to to count as archived
+func replicaNames() []string {
+	var names []string
+	for _, replica := range appConfig.Replicas {
+		names = append(names, replica.Name)
+	}
+	return names
+}
+
+// notifyRun sends the notifications for a finished run
+func notifyRun(run *db.Run) {
+	if notifier == nil || !notifier.Enabled() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	notifier.Notify(ctx, notify.Summary{
+		RunID:           run.ID,
+		Command:         run.Command,
+		Source:          run.Source,
+		Status:          run.Status,
+		StartedAt:       run.StartedAt,
+		FinishedAt:      run.FinishedAt.Time,
+		DurationSeconds: run.FinishedAt.Time.Sub(run.StartedAt).Seconds(),
+		FilesTotal:      run.FilesTotal,
+		FilesProcessed:  run.FilesProcessed,
+		FilesSkipped:    run.FilesSkipped,
+		FilesFailed:     run.FilesFailed,
+		BytesProcessed:  run.BytesProcessed,
+		BytesUploaded:   run.BytesUploaded,
+		Cost:            run.Cost,
+		Error:           run.Error,
+	})
+}
+
+// newTracker creates a progress tracker drawing bars, writing events or
+// showing the dashboard, depending on --progress-format, and serving the
+// progress page with --serve. The run pauses and resumes on SIGUSR1. Call
+// stopProgress when the work is done.
+func newTracker() *progress.Tracker {
+	tracker := progress.NewTracker()
+	if progressEvents != nil {
+		tracker.SetEventWriter(progressEvents)
+	}
+	if progressFormat == "tui" {
+		startDashboard(tracker)
+	}
+	if serveAddr != "" {
+		startWebServer(tracker)
+	}
+	stopPauses = pauseOnSignal(tracker)
+	return tracker
+}
+
+// pauseOnSignal pauses the tracker on the pause signal (SIGUSR1), and
+// resumes it on the next one: no more files are started meanwhile, those in
+// progress are finished. Call the returned function when the run is over.
+func pauseOnSignal(tracker *progress.Tracker) (stop func()) {
+	if len(pauseSignals) == 0 {
+		return func() {}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, pauseSignals...)
+	done := make(chan struct{})
+
+	// Tell the user on the dashboard, or on stderr unless it carries events
+	d, quiet := dashboard, progressEvents != nil
+	report := func(message string) {
+		logger.Info(message)
+		switch {
+		case d != nil:
+			d.AddLog(message)
+		case !quiet:
+			fmt.Fprintf(os.Stderr, "\n%s\n", message)
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+			case <-done:
+				return
+			}
+			if tracker.Paused() {
+				tracker.Resume()
+				report("Resumed")
+			} else {
+				tracker.Pause()
+				report(fmt.Sprintf("Paused: finishing the files in progress (kill -USR1 %d to resume)", os.Getpid()))
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// startDashboard shows the progress of tracker on the terminal dashboard,
+// with the log in its activity log, falling back to progress bars if the
+// terminal can't show it
+func startDashboard(tracker *progress.Tracker) {
+	config := progress.DefaultInteractiveModeConfig()
+	// Ctrl+C doesn't reach the process while the dashboard has the terminal
+	config.OnQuit = func() {
+		if process, err := os.FindProcess(os.Getpid()); err == nil {
+			process.Signal(os.Interrupt)
+		}
+	}
+	d := progress.NewInteractiveMode(tracker, config)
+	if err := d.Start(); err != nil {
+		logger.Warn("showing progress bars instead of the dashboard", "error", err)
+		return
+	}
+	dashboard = d
+
+	// The log file keeps everything; stderr would draw over the dashboard
+	var next slog.Handler
+	if logFile != "" {
+		next = logger.Handler()
+	}
+	dashboardLogger = logger
+	logger = slog.New(dashboard.LogHandler(next))
+	slog.SetDefault(logger)
+}
+
+// startWebServer serves the progress page of tracker at --serve, with the
+// log messages in its log
+func startWebServer(tracker *progress.Tracker) {
+	w := progress.NewWebServer(tracker)
+	if err := w.Start(serveAddr); err != nil {
+		logger.Warn("not serving the progress page", "address", serveAddr, "error", err)
+		return
+	}
+	webServer = w
+	fmt.Fprintf(os.Stderr, "Progress: %s\n", w.URL())
+
+	webLogger = logger
+	logger = slog.New(w.LogHandler(logger.Handler()))
+	slog.SetDefault(logger)
+}
+
+// stopProgress stops pausing on signals, the progress page and the
+// dashboard, if any, giving the terminal and the log back
+func stopProgress() {
+	if stopPauses != nil {
+		stopPauses()
+		stopPauses = nil
+	}
+	if webServer != nil {
+		webServer.Stop()
+		webServer = nil
+		logger = webLogger
+		slog.SetDefault(logger)
+	}
+	if dashboard == nil {
+		return
+	}
+	dashboard.Stop()
+	dashboard = nil
+	logger = dashboardLogger
+	slog.SetDefault(logger)
+}
+
+// finishCommand removes the intermediate files the command left in the
+// scratch folder and closes the progress socket and log file, if any
+func finishCommand(cmd *cobra.Command, args []string) {
+	scratch.Cleanup()
+	if progressCloser != nil {
+		progressCloser.Close()
+	}
+	if tikaServer != nil {
+		tikaServer.Close()
+	}
+	if logCloser != nil {
+		logCloser.Close()
 	}
 }
 
@@ -161,13 +616,274 @@ func executeArchiver(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	fmt.Println("Starting Archiver...")
-	fmt.Printf("Processing source: %s\n", sourcePath)
-	fmt.Printf("Using B2 bucket: %s\n", bucket)
-	fmt.Printf("Summarization level: %s\n", summarize)
-	fmt.Printf("Stub mode: %s\n", stubMode)
-	fmt.Printf("Cost cap: $%.2f USD\n", costCap)
+	fmt.Fprintln(stdout, "Starting Archiver...")
+	fmt.Fprintf(stdout, "Processing source: %s\n", sourceDescription())
+	fmt.Fprintf(stdout, "Using B2 bucket: %s\n", bucket)
+	fmt.Fprintf(stdout, "Summarization level: %s\n", summarize)
+	fmt.Fprintf(stdout, "Stub mode: %s\n", stubMode)
+	fmt.Fprintf(stdout, "Cost cap: $%.2f USD\n", costCap)
+	fmt.Fprintln(stdout)
+	tools.PrintHints(stdout)
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	scanner, err := newSourceScanner()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating scanner: %v\n", err)
+		os.Exit(1)
+	}
+	defer scanner.Close()
+	if includeAll {
+		scanner.SetPolicy(nil)
+	}
+
+	if err := runPipeline(database, scanner, "archive", sourceDescription()); err != nil {
+		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintln(stdout, "Archiver completed successfully.")
+}
+
+// checkDriveHealth reads and records the SMART status of the drive holding
+// source before it is archived, warning about sectors going bad or, with
+// drive_health set to refuse, failing. Drives whose status can't be read
+// are archived as usual.
+func checkDriveHealth(database *db.DB, source string) error {
+	if appConfig.DriveHealth == "off" {
+		return nil
+	}
+	if info, err := os.Stat(source); err != nil || !info.IsDir() {
+		return nil
+	}
 
-	// Main processing pipeline will be implemented here
-	fmt.Println("Archiver completed successfully.")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	health, err := drives.CheckHealth(ctx, source)
+	if err != nil {
+		logger.Info("drive health not checked", "source", source, "error", err)
+		return nil
+	}
+	name := drives.NameFromPath(source)
+	if name == "" {
+		name = health.Device
+	}
+	if err := database.RecordDriveHealth(name, health); err != nil {
+		logger.Warn("could not record drive health", "drive", name, "error", err)
+	}
+
+	problems := health.Problems()
+	if len(problems) == 0 {
+		return nil
+	}
+	if appConfig.DriveHealth == "refuse" {
+		return fmt.Errorf("drive %s is failing (%s); copy it to a healthy disk and archive the copy, or set drive_health to warn",
+			name, strings.Join(problems, ", "))
+	}
+	fmt.Fprintf(stdout, "Warning: drive %s is failing (%s); archive its most important files first and copy it soon\n\n",
+		name, strings.Join(problems, ", "))
+	return nil
+}
+
+// flagOrConfig returns a limit from the command line, falling back to
+// the config when the flag is unset
+func flagOrConfig(flag, configured int) int {
+	if flag > 0 {
+		return flag
+	}
+	return configured
+}
+
+// registerPlugins adds the plugins in the config file to a pipeline
+func registerPlugins(p *pipeline.Pipeline) error {
+	if appConfig == nil {
+		return nil
+	}
+	for _, plugin := range appConfig.Plugins {
+		err := p.RegisterPlugin(pipeline.Plugin{
+			Name:         plugin.Name,
+			Command:      plugin.Command,
+			Extensions:   plugin.Extensions,
+			ContentTypes: plugin.ContentTypes,
+			Timeout:      time.Duration(plugin.TimeoutSeconds) * time.Second,
+		})
+		if err != nil {
+			return fmt.Errorf("invalid plugin in config: %w", err)
+		}
+	}
+	return nil
+}
+
+// runPipeline scans and processes the scanner's sources with the configured
+// summarization, cost cap, limits and power settings, then prints a summary.
+// The run is recorded in the run history under command and source. A nil
+// scanner skips the scan and processes the documents already in the catalog,
+// those below source when it is a folder.
+func runPipeline(database *db.DB, scanner *scan.Scanner, command, source string) (err error) {
+	if scanner != nil {
+		if err := checkDriveHealth(database, source); err != nil {
+			return err
+		}
+	}
+
+	run, err := database.StartRun(command, source)
+	if err != nil {
+		return err
+	}
+	defer syncIndex(database)
+
+	// The dashboard takes over the log, so it starts before the pipeline
+	// gets the logger
+	tracker := newTracker()
+	defer stopProgress()
+
+	p := pipeline.New(pipeline.Config{
+		SummaryLevel:    summariser.SummaryLevel(summarize),
+		CostCap:         costCap,
+		LifetimeBudget:  appConfig.LifetimeBudgetUSD,
+		DocumentCap:     appConfig.DocumentCapUSD,
+		ProviderCaps:    appConfig.ProviderCapsUSD,
+		ExtractEntities: appConfig.ExtractEntities,
+		Classifier:      newClassifier(),
+		WhisperModel:    appConfig.WhisperModel,
+		CaptionPhotos:   appConfig.CaptionPhotos,
+		Limits: pipeline.Limits{
+			Transcodes:  flagOrConfig(maxTranscodes, appConfig.Concurrency.Transcodes),
+			Extractions: flagOrConfig(maxExtractions, appConfig.Concurrency.Extractions),
+			Hashes:      appConfig.Concurrency.HashWorkers,
+			Summaries:   appConfig.Concurrency.Summaries,
+		},
+		Timeouts: pipelineTimeouts(),
+		Logger:   logger,
+	}, database)
+	p.SetRun(run.ID)
+	if webServer != nil {
+		webServer.SetSpend(p.TotalCost)
+	}
+	if err := registerPlugins(p); err != nil {
+		return err
+	}
+
+	// Transcodes and conversions go to the bucket, when there is one
+	if appConfig.Validate() == nil {
+		uploader, err := newUploader()
+		if err != nil {
+			return fmt.Errorf("failed to create B2 client: %w", err)
+		}
+		defer uploader.Close()
+		p.SetMediaDestination(uploader)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer handleInterrupt(cancel)()
+
+	if powerAware {
+		monitor := power.NewMonitor(power.DefaultInterval, func(state power.State) {
+			if state.ShouldPause() {
+				fmt.Fprintf(stdout, "\nPausing transcoding and hashing: %s\n", state.Reason())
+			} else {
+				fmt.Fprintln(stdout, "\nResuming transcoding and hashing")
+			}
+		})
+		monitor.Start(ctx)
+		p.SetPowerMonitor(monitor)
+	}
+
+	defer func() {
+		stats := tracker.Statistics
+		run.FilesTotal = stats.TotalFiles
+		run.FilesProcessed = stats.ProcessedFiles
+		run.FilesSkipped = stats.SkippedFiles
+		run.FilesFailed = stats.FailedFiles
+		run.BytesProcessed = stats.BytesProcessed
+		run.BytesUploaded = stats.BytesUploaded
+		run.Cost = p.TotalCost()
+		run.FilesRemaining = p.Remaining()
+		run.Stage = p.Stage()
+		if finishErr := database.FinishRun(run, err); finishErr != nil {
+			fmt.Fprintf(os.Stderr, "Error recording run %d: %v\n", run.ID, finishErr)
+		}
+		notifyRun(run)
+	}()
+
+	if scanner == nil {
+		if info, statErr := os.Stat(source); statErr == nil && info.IsDir() {
+			p.SetSource(source)
+		}
+		err = p.ProcessDocuments(ctx, tracker)
+		if err == nil {
+			err = p.ProcessMedia(ctx, tracker)
+		}
+		if err == nil {
+			err = p.CaptionPhotos(ctx, tracker)
+		}
+	} else {
+		err = p.Run(ctx, scanner, tracker)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			stopProgress()
+			tracker.PrintSummary()
+			fmt.Fprintf(stdout, "\nRun %d was interrupted. Files finished so far are saved", run.ID)
+			if remaining := p.Remaining(); remaining > 0 {
+				fmt.Fprintf(stdout, "; %d file(s) were not started", remaining)
+			}
+			fmt.Fprintf(stdout, ".\nRun archiver resume %d to continue where it stopped.\n", run.ID)
+		}
+		return err
+	}
+
+	stopProgress()
+	tracker.PrintSummary()
+	fmt.Fprintf(stdout, "LLM spend: $%.4f\n", p.TotalCost())
+	fmt.Fprintf(stdout, "Recorded as run %d (archiver runs show %d)\n", run.ID, run.ID)
+	return nil
+}
+
+// commandContext returns a context cancelled by the first Ctrl+C or SIGTERM,
+// for commands that stop cleanly when it is done. Signals are handled as
+// usual after that, so a second Ctrl+C quits at once.
+func commandContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx
+}
+
+// handleInterrupt cancels a run on the first Ctrl+C or SIGTERM, letting the
+// files in progress finish, and quits on the second after giving the terminal
+// back from the dashboard. Call the returned function when the run is over.
+func handleInterrupt(cancel context.CancelFunc) (stop func()) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		for interrupts := 0; ; interrupts++ {
+			select {
+			case <-signals:
+			case <-done:
+				return
+			}
+			if interrupts > 0 {
+				stopProgress()
+				fmt.Fprintln(os.Stderr, "\nQuitting without finishing the files in progress")
+				os.Exit(130)
+			}
+			fmt.Fprintln(os.Stderr, "\nInterrupted: finishing the files in progress (press Ctrl+C again to quit now)")
+			cancel()
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
 }
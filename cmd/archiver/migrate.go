@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateFrom    string
+	migrateTo      string
+	migrateDryRun  bool
+	migrateVerbose bool
+)
+
+// newMigrateCommand creates a command that moves uploads to another bucket
+// or provider
+func newMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Copy uploaded files to another bucket or provider and update the catalog",
+		Long: `Copy the uploaded files recorded in the catalog from a B2 bucket to another
+destination, without reading the original drives again, and point their
+catalog entries at the copies. Destinations are:
+
+  b2:<bucket>     another bucket of the B2 account, copied by B2 itself
+  s3:<bucket>     an S3 or S3-compatible bucket (s3_* settings in the config)
+  local:<folder>  a folder, such as a mounted NAS share
+
+Files are streamed from B2 to S3 and local folders. Files already moved are
+skipped, so an interrupted migration picks up where it stopped. The source
+bucket is left untouched; delete it once the copies are checked.
+Examples:
+  archiver migrate --to b2:new-archive --dry-run
+  archiver migrate --from b2:old-archive --to s3:new-archive
+  archiver migrate --to local:/Volumes/NAS/archive`,
+		Run: executeMigrate,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&migrateFrom, "from", "", "Bucket to move from, as b2:<bucket> (default: b2_bucket)")
+	cmd.Flags().StringVar(&migrateTo, "to", "", "Destination: b2:<bucket>, s3:<bucket> or local:<folder>")
+	cmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Count the files to move without copying them")
+	cmd.Flags().BoolVarP(&migrateVerbose, "verbose", "v", false, "List each file copied")
+	cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+// executeMigrate copies the uploads and updates their catalog entries
+func executeMigrate(cmd *cobra.Command, args []string) {
+	if migrateFrom == "" {
+		migrateFrom = "b2:" + appConfig.B2Bucket
+	}
+	fromKind, fromBucket, err := parseLocation(migrateFrom)
+	if err == nil && fromKind != "b2" {
+		err = fmt.Errorf("can only migrate from b2:<bucket>, where the catalog's uploads are")
+	}
+	toKind, toName, toErr := parseLocation(migrateTo)
+	if err == nil {
+		err = toErr
+	}
+	if err == nil && toKind == "b2" && toName == fromBucket {
+		err = fmt.Errorf("%s is already where the files are", migrateTo)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	files, err := database.FindFiles("uploaded_url IS NOT NULL AND uploaded_url != ''")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error selecting files: %v\n", err)
+		os.Exit(1)
+	}
+	var pending []*db.FileStatus
+	var pendingBytes int64
+	for _, file := range files {
+		if bucket, name, err := upload.SplitFileURL(file.UploadedURL); err == nil && bucket == fromBucket && name != "" {
+			pending = append(pending, file)
+			pendingBytes += file.Size
+		}
+	}
+	fmt.Printf("To move from %s to %s: %d file(s), %s\n", migrateFrom, migrateTo, len(pending), formatSize(pendingBytes))
+	if migrateDryRun || len(pending) == 0 {
+		return
+	}
+
+	appConfig.B2Bucket = fromBucket
+	if err := appConfig.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(1)
+	}
+	source, err := newUploader()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+		os.Exit(1)
+	}
+	defer source.Close()
+
+	transfer, closeTarget, err := migrationTarget(source, toKind, toName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening %s: %v\n", migrateTo, err)
+		os.Exit(1)
+	}
+	defer closeTarget()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer handleInterrupt(cancel)()
+	work := context.WithoutCancel(ctx)
+
+	// Catalog entries sharing an upload are moved with one copy
+	moved := make(map[string]string)
+	var copied, failed int
+	var copiedBytes int64
+	for i, file := range pending {
+		if ctx.Err() != nil {
+			fmt.Printf("\nInterrupted with %d file(s) left. Run migrate again to move them.\n", len(pending)-i)
+			break
+		}
+
+		newURL, ok := moved[file.UploadedURL]
+		if !ok {
+			_, name, _ := upload.SplitFileURL(file.UploadedURL)
+			result, err := transfer(work, name, file.UploadedURL)
+			if err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "  Error: %s: %v\n", file.Path, err)
+				continue
+			}
+			newURL = result.URL
+			moved[file.UploadedURL] = newURL
+			copied++
+			copiedBytes += result.Size
+			if toKind != "b2" {
+				recordEgress(database, file.ID, result.Size)
+			}
+			if migrateVerbose {
+				fmt.Printf("  copied %s (%s)\n", name, formatSize(result.Size))
+			}
+		}
+
+		if err := database.SetUploadedURL(file.ID, newURL); err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "  Error: recording %s: %v\n", file.Path, err)
+		}
+	}
+
+	fmt.Printf("Copied %d file(s), %s; %d failed\n", copied, formatSize(copiedBytes), failed)
+	if toKind == "b2" && failed == 0 && ctx.Err() == nil {
+		fmt.Printf("To upload to it from now on, run: archiver config set b2_bucket %s\n", toName)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// parseLocation splits a location such as s3:bucket into its kind and name
+func parseLocation(location string) (kind, name string, err error) {
+	kind, name, found := strings.Cut(location, ":")
+	if !found || name == "" {
+		return "", "", fmt.Errorf("invalid location %q (expected b2:<bucket>, s3:<bucket> or local:<folder>)", location)
+	}
+	switch kind {
+	case "b2", "s3", "local":
+		return kind, name, nil
+	}
+	return "", "", fmt.Errorf("unknown storage %q in %s (expected b2, s3 or local)", kind, location)
+}
+
+// migrationTransfer copies the file uploaded to fileURL under name
+type migrationTransfer func(ctx context.Context, name, fileURL string) (*upload.UploadResult, error)
+
+// migrationTarget returns how files are moved from source to the
+// destination, and a function releasing the destination
+func migrationTarget(source *upload.B2Uploader, kind, location string) (migrationTransfer, func(), error) {
+	var dest upload.StreamDestination
+	switch kind {
+	case "b2":
+		target, err := newUploaderFor(location)
+		if err != nil {
+			return nil, nil, err
+		}
+		copyFile := func(ctx context.Context, name, fileURL string) (*upload.UploadResult, error) {
+			return target.CopyFrom(ctx, source, name)
+		}
+		return copyFile, func() { target.Close() }, nil
+	case "s3":
+		client, err := upload.NewS3Client(upload.S3Config{
+			AccessKeyID:     appConfig.S3AccessKeyID,
+			SecretAccessKey: appConfig.S3SecretAccessKey,
+			Region:          appConfig.S3Region,
+			Endpoint:        appConfig.S3Endpoint,
+			Bucket:          location,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		dest = client
+	default:
+		local, err := upload.NewLocalDestination(location)
+		if err != nil {
+			return nil, nil, err
+		}
+		dest = local
+	}
+
+	stream := func(ctx context.Context, name, fileURL string) (*upload.UploadResult, error) {
+		object, err := source.Open(ctx, fileURL)
+		if err != nil {
+			return nil, err
+		}
+		defer object.Close()
+		return dest.PutStream(ctx, name, object, object.Size, object.ContentType)
+	}
+	return stream, func() {}, nil
+}
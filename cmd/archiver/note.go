@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var noteDelete int64
+
+// newNoteCommand creates a command that annotates a file
+func newNoteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "note <file> [text]",
+		Short: "Add a note to a file, or list its notes",
+		Long: `Annotate a file, named by its catalog ID or path, with free text. Notes are
+searchable like summaries. Without text, the notes of the file are listed.
+Examples:
+  archiver note 1234 "Grandma's photo album, scanned in 2009"
+  archiver note /Volumes/OldDrive/Scans/album.pdf
+  archiver note 1234 --delete 7`,
+		Args: cobra.RangeArgs(1, 2),
+		Run:  executeNote,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+	cmd.Flags().Int64Var(&noteDelete, "delete", 0, "Delete the note with this ID")
+
+	return cmd
+}
+
+// executeNote adds, deletes or lists the notes of a file
+func executeNote(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	file, err := fileByIDOrPath(database, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	text := ""
+	if len(args) == 2 {
+		text = strings.TrimSpace(args[1])
+	}
+	if text == "" && noteDelete == 0 {
+		listNotes(database, file)
+		return
+	}
+
+	if text != "" {
+		id, err := database.AddNote(file.ID, text)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding note: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Added note %d to %s\n", id, file.Path)
+	}
+	if noteDelete != 0 {
+		if err := database.DeleteNote(file.ID, noteDelete); err != nil {
+			fmt.Fprintf(os.Stderr, "Error deleting note: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted note %d of %s\n", noteDelete, file.Path)
+	}
+
+	indexer, err := db.NewIndexer(db.IndexConfig{
+		IndexDir:       indexDir,
+		IndexSummaries: true,
+		IndexContent:   true,
+	}, database)
+	if err == nil {
+		_, err = indexer.Sync(context.Background())
+		indexer.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating the search index: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// listNotes prints the notes of a file, oldest first
+func listNotes(database *db.DB, file *db.FileStatus) {
+	notes, err := database.GetNotes(file.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading notes: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d  %s\n", file.ID, file.Path)
+	if len(notes) == 0 {
+		fmt.Println("No notes.")
+		return
+	}
+	for _, note := range notes {
+		fmt.Printf("  [%d] %s  %s\n", note.ID, note.CreatedAt.Format("2006-01-02"), note.Text)
+	}
+}
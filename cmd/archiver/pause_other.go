@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// pauseSignals pause and resume a run; there is no SIGUSR1 to use here
+var pauseSignals []os.Signal
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/preview"
+	"github.com/spf13/cobra"
+)
+
+var (
+	peekOutput  string
+	peekSizeMB  int64
+	peekSeconds int
+	peekPages   int
+)
+
+// newPeekCommand creates a command that previews an archived file
+func newPeekCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "peek <file>",
+		Short: "Preview an archived file by fetching only its beginning",
+		Long: `Fetch just the start of an uploaded file with a ranged download, to preview a
+large video or document without downloading all of it. The file is named by
+its catalog path.
+
+Videos are cut to their first --seconds with ffmpeg (without re-encoding);
+MP4 and MOV files that keep their index at the end can't be previewed this
+way. The first --pages of PDFs are rendered to PNG with pdftoppm. Other files,
+and files these tools can't handle, are saved as the partial download.
+Examples:
+  archiver peek /Volumes/OldDrive/Video/wedding.mts
+  archiver peek /Volumes/OldDrive/Scans/deeds.pdf --pages 2 --output /tmp`,
+		Args: cobra.ExactArgs(1),
+		Run:  executePeek,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Backblaze B2 bucket name (default: from config)")
+	cmd.Flags().StringVarP(&peekOutput, "output", "o", ".", "Directory to write the preview to")
+	cmd.Flags().Int64Var(&peekSizeMB, "size", 0, "MB to fetch (default: 32 for videos, 4 for PDFs, 1 otherwise)")
+	cmd.Flags().IntVar(&peekSeconds, "seconds", 30, "Length of video previews in seconds")
+	cmd.Flags().IntVar(&peekPages, "pages", 3, "Number of PDF pages to render")
+
+	return cmd
+}
+
+// executePeek fetches the start of a file and turns it into a preview
+func executePeek(cmd *cobra.Command, args []string) {
+	if cmd.Flags().Changed("bucket") {
+		appConfig.B2Bucket = bucket
+	}
+	if err := appConfig.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	file, err := catalogFile(database, args[0], false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if file.UploadedURL == "" {
+		fmt.Fprintf(os.Stderr, "Error: %s has not been uploaded\n", file.Path)
+		os.Exit(1)
+	}
+
+	kind := preview.KindOf(file.Path, file.ContentType)
+	size := preview.DefaultBytes(kind)
+	if peekSizeMB > 0 {
+		size = peekSizeMB << 20
+	}
+
+	uploader, err := newUploader()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+		os.Exit(1)
+	}
+	defer uploader.Close()
+
+	if err := os.MkdirAll(peekOutput, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+		os.Exit(1)
+	}
+	name := filepath.Base(file.Path)
+	ext := filepath.Ext(name)
+	base := filepath.Join(peekOutput, strings.TrimSuffix(name, ext))
+	partial := base + ".partial" + ext
+
+	out, err := os.Create(partial)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+		os.Exit(1)
+	}
+	ctx := context.Background()
+	fetched, err := uploader.DownloadRange(ctx, file.UploadedURL, 0, size, out)
+	if fetched > 0 {
+		recordEgress(database, file.ID, fetched)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partial)
+		fmt.Fprintf(os.Stderr, "Error fetching %s: %v\n", file.Path, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Fetched %s of %s\n", formatSize(fetched), formatSize(file.Size))
+	if fetched >= file.Size {
+		complete := base + ext
+		if err := os.Rename(partial, complete); err == nil {
+			fmt.Printf("The whole file fit: %s\n", complete)
+			return
+		}
+	}
+
+	switch kind {
+	case preview.KindVideo:
+		output := base + ".preview" + ext
+		if err := preview.Video(ctx, partial, output, peekSeconds); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not cut a preview: %v\n", err)
+			break
+		}
+		os.Remove(partial)
+		fmt.Printf("Preview of the first %d seconds: %s\n", peekSeconds, output)
+		return
+	case preview.KindPDF:
+		images, err := preview.PDFPages(ctx, partial, base+".page", peekPages)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not render pages: %v\n", err)
+			break
+		}
+		os.Remove(partial)
+		fmt.Printf("Rendered %d page(s):\n", len(images))
+		for _, image := range images {
+			fmt.Printf("  %s\n", image)
+		}
+		return
+	}
+
+	fmt.Printf("Partial file: %s\n", partial)
+}
+
+// catalogFile finds a catalog entry by its path, as given or made absolute.
+// Deleted entries are only found with withDeleted.
+func catalogFile(database *db.DB, path string, withDeleted bool) (*db.FileStatus, error) {
+	candidates := []string{path}
+	if abs, err := filepath.Abs(path); err == nil && abs != path {
+		candidates = append(candidates, abs)
+	}
+	for _, candidate := range candidates {
+		file, err := database.GetFileByPath(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil && (withDeleted || !file.DeletedAt.Valid) {
+			return file, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not in the catalog", path)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	purgeOlderThan  int
+	purgeKeepRemote bool
+	purgeDryRun     bool
+)
+
+// newPurgeCommand creates a command that permanently removes tombstones
+func newPurgeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Permanently remove deleted catalog entries and their uploads",
+		Long: `Permanently remove files marked as deleted from the catalog, along with their
+tags, extracted text and provenance, and delete their uploaded copies from B2.
+A tombstone whose remote copy can't be deleted is kept so purge can be retried,
+as are those of files locked with archiver lock until their lock ends.
+
+Deleted files stay in the trash, where archiver undelete can restore them, for
+trash_days from the config file, 30 days by default; purge only removes those
+deleted longer ago unless --purge-older-than says otherwise, and
+--purge-older-than 0 empties the trash as purge did before there was one.
+Examples:
+  archiver purge --dry-run
+  archiver purge --purge-older-than 90
+  archiver purge --purge-older-than 0`,
+		Run: executePurge,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Backblaze B2 bucket name (default: from config)")
+	cmd.Flags().IntVar(&purgeOlderThan, "purge-older-than", 0, "Only purge files deleted at least this many days ago (default: trash_days from config)")
+	cmd.Flags().BoolVar(&purgeKeepRemote, "keep-remote", false, "Leave the uploaded copies in B2")
+	cmd.Flags().BoolVar(&purgeDryRun, "dry-run", false, "List the files without purging them")
+
+	return cmd
+}
+
+// executePurge removes tombstones and their remote objects
+func executePurge(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	olderThan := purgeOlderThan
+	if !cmd.Flags().Changed("purge-older-than") {
+		olderThan = appConfig.TrashDays
+	}
+	if olderThan < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --purge-older-than can't be negative")
+		os.Exit(1)
+	}
+	var before time.Time
+	if olderThan > 0 {
+		before = time.Now().AddDate(0, 0, -olderThan)
+	}
+	files, err := database.GetDeletedFiles(before)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing deleted files: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d deleted file(s) to purge\n", len(files))
+	if purgeDryRun {
+		for _, file := range files {
+			fmt.Printf("  %s (deleted %s", file.Path, file.DeletedAt.Time.Format("2006-01-02"))
+			if file.DeleteReason != "" {
+				fmt.Printf(": %s", file.DeleteReason)
+			}
+			fmt.Println(")")
+		}
+		return
+	}
+
+	var uploader *upload.B2Uploader
+	if !purgeKeepRemote && hasUploads(files) {
+		if cmd.Flags().Changed("bucket") {
+			appConfig.B2Bucket = bucket
+		}
+		if err := appConfig.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+			os.Exit(1)
+		}
+		uploader, err = newUploader()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+			os.Exit(1)
+		}
+		defer uploader.Close()
+	}
+
+	ctx := context.Background()
+	var purged, failed, remote, locked int
+	for _, file := range files {
+		if err := checkUnlocked(database, file); err != nil {
+			locked++
+			fmt.Fprintf(os.Stderr, "  KEPT %v\n", err)
+			continue
+		}
+		if uploader != nil && file.UploadedURL != "" {
+			deleted, err := deleteUploads(ctx, database, uploader, file)
+			remote += deleted
+			if err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "  FAILED %s: %v\n", file.Path, err)
+				continue
+			}
+		}
+
+		if err := database.PurgeFile(file.ID); err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "  FAILED %s: %v\n", file.Path, err)
+			continue
+		}
+		purged++
+	}
+
+	fmt.Printf("Purged %d file(s), deleted %d remote object(s), %d failed\n", purged, remote, failed)
+	if locked > 0 {
+		fmt.Printf("Kept %d locked file(s) until their retention ends or legal hold is released\n", locked)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// deleteUploads deletes every version of a file's upload from the bucket,
+// and the uploads of its previous versions under other names that no other
+// file has been given since. It returns the number of names deleted.
+func deleteUploads(ctx context.Context, database *db.DB, uploader *upload.B2Uploader, file *db.FileStatus) (int, error) {
+	name, err := uploader.RemoteName(file.UploadedURL)
+	if err != nil {
+		return 0, err
+	}
+	if err := uploader.DeleteFile(ctx, name); err != nil {
+		return 0, err
+	}
+	deleted := 1
+
+	versions, err := database.GetFileVersions(file.ID)
+	if err != nil {
+		return deleted, err
+	}
+	done := map[string]bool{name: true}
+	for _, version := range versions {
+		if version.UploadedURL == "" {
+			continue
+		}
+		old, err := uploader.RemoteName(version.UploadedURL)
+		if err != nil || done[old] {
+			continue
+		}
+		done[old] = true
+		if owner, err := database.RemoteNameOwner(old); err != nil {
+			return deleted, err
+		} else if owner != nil {
+			continue
+		}
+		if err := uploader.DeleteFile(ctx, old); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// hasUploads reports whether any of the files has been uploaded
+func hasUploads(files []*db.FileStatus) bool {
+	for _, file := range files {
+		if file.UploadedURL != "" {
+			return true
+		}
+	}
+	return false
+}
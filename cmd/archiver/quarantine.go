@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/spf13/cobra"
+)
+
+// newQuarantineCommand creates a command that lists the files set aside as
+// unreadable
+func newQuarantineCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "quarantine [path]",
+		Short: "List the files set aside because they could not be read",
+		Long: `List the quarantined files, or those below a path: files and folders a scan
+could not read, and documents that could not be read again after their
+extraction failed. Runs skip them. Read them again with
+archiver scan --source <drive> --retry-quarantined.
+Examples:
+  archiver quarantine
+  archiver quarantine /Volumes/OldDrive`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  executeQuarantine,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+
+	return cmd
+}
+
+// executeQuarantine prints the quarantine report
+func executeQuarantine(cmd *cobra.Command, args []string) {
+	root := ""
+	if len(args) == 1 {
+		abs, err := filepath.Abs(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		root = abs
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	files, err := database.GetQuarantined(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing quarantined files: %v\n", err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Println("No files are quarantined.")
+		return
+	}
+
+	for _, file := range files {
+		fmt.Printf("%s\n", file.Path)
+		fmt.Printf("  %s failed %d time(s), last on %s: %s\n",
+			file.Stage, file.Attempts, file.LastSeen.Format("2006-01-02 15:04"), file.Error)
+	}
+	fmt.Printf("\n%d file(s) quarantined. Retry them with archiver scan --source <drive> --retry-quarantined.\n", len(files))
+}
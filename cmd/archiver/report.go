@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportOutput  string
+	reportRun     string
+	reportTitle   string
+	reportNotable int
+	reportRuns    int
+)
+
+// newReportCommand creates a command that writes an HTML report of a run or
+// of the whole catalog
+func newReportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Write a standalone HTML report of the archive or of a run",
+		Long: `Write a single HTML file, with no scripts or other files, that can be emailed
+to the people who share the archive: the files by kind and by year, the space
+deduplication saves, the LLM spend by kind and model, the errors grouped by
+cause, and a sample of the summaries (the longest in each folder).
+
+By default the report covers the whole catalog and lists the recent runs.
+--run limits it to the files a run scanned or uploaded, and to its costs and
+errors; "latest" is the most recent run.
+Examples:
+  archiver report --output archive.html --title "Family Archive"
+  archiver report --run latest --output last-run.html
+  archiver report --run 12 --notable 30`,
+		Run: executeReport,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVarP(&reportOutput, "output", "o", "report.html", "File to write the report to")
+	cmd.Flags().StringVar(&reportRun, "run", "", "Report on this run (an id, or latest) instead of the whole catalog")
+	cmd.Flags().StringVar(&reportTitle, "title", "", "Title of the report (default: Archive report, or the run)")
+	cmd.Flags().IntVar(&reportNotable, "notable", report.DefaultNotable, "Summaries to include")
+	cmd.Flags().IntVar(&reportRuns, "runs", 10, "Recent runs to list in a report of the whole catalog (0 for all)")
+
+	return cmd
+}
+
+// executeReport collects the report from the catalog and writes it
+func executeReport(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	run, err := reportedRun(database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	title := reportTitle
+	if title == "" && run != nil {
+		title = fmt.Sprintf("Archive report: run %d", run.ID)
+	}
+
+	collector := report.NewCollector(report.Options{Title: title, Run: run, Notable: reportNotable})
+	r, err := collectReport(database, collector, run)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading the catalog: %v\n", err)
+		os.Exit(1)
+	}
+
+	file, err := os.Create(reportOutput)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	err = report.Write(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing the report: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Wrote a report of %d files to %s\n", r.Files, reportOutput)
+}
+
+// reportedRun returns the run given with --run, or nil for the whole catalog
+func reportedRun(database *db.DB) (*db.Run, error) {
+	switch reportRun {
+	case "":
+		return nil, nil
+	case "latest":
+		runs, err := database.ListRuns(1)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) == 0 {
+			return nil, fmt.Errorf("no runs recorded yet")
+		}
+		return runs[0], nil
+	}
+	id, err := strconv.ParseInt(reportRun, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid run id %q", reportRun)
+	}
+	return database.GetRun(id)
+}
+
+// collectReport adds the files and errors of the run, or of the whole
+// catalog if run is nil, to the collector and fills in the costs
+func collectReport(database *db.DB, collector *report.Collector, run *db.Run) (*report.Report, error) {
+	add := func(file *db.FileStatus) error {
+		collector.Add(file)
+		return nil
+	}
+
+	var runErrors []db.RunError
+	var err error
+	if run != nil {
+		until := time.Now()
+		if run.FinishedAt.Valid {
+			until = run.FinishedAt.Time
+		}
+		err = database.ForEachFileChanged(run.StartedAt, until, add)
+		if err == nil {
+			runErrors, err = database.GetRunErrors(run.ID)
+		}
+	} else {
+		err = database.ForEachFile(false, add)
+		if err == nil {
+			runErrors, err = database.GetRunErrorsSince(time.Time{})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, runError := range runErrors {
+		collector.AddError(runError)
+	}
+
+	r := collector.Report()
+	costsBy := func(dimension string) ([]db.CostGroup, error) {
+		if run != nil {
+			return database.RunCostsBy(run.ID, dimension)
+		}
+		return database.CostsBy(dimension, time.Time{})
+	}
+	if r.CostsByKind, err = costsBy("kind"); err != nil {
+		return nil, err
+	}
+	if r.CostsByModel, err = costsBy("model"); err != nil {
+		return nil, err
+	}
+	for _, group := range r.CostsByKind {
+		r.Cost += group.Amount
+	}
+
+	if run == nil {
+		if r.StoredBytes, err = database.StoredBytes(); err != nil {
+			return nil, err
+		}
+		if r.Runs, err = database.ListRuns(reportRuns); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
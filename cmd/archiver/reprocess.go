@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/pipeline"
+	"github.com/jth/archiver/internal/summariser"
+	"github.com/jth/archiver/internal/tools"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reprocessWhere  string
+	reprocessDryRun bool
+)
+
+// newReprocessCommand creates a command that re-runs extraction and summarization
+func newReprocessCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reprocess",
+		Short: "Re-run extraction and summarization for matching files",
+		Long: `Re-run extraction and summarization for files matching a filter, for example
+when better tools or models become available. The filter is a SQL expression
+over the catalog columns (extractor, extract_quality, summary_model,
+content_type, path, size, ...).
+Examples:
+  archiver reprocess --where "extract_quality < 0.6 OR extractor = 'fallback'"
+  archiver reprocess --where "summary_model = 'none'" --dry-run
+  archiver reprocess --where "id IN (SELECT file_id FROM provenance WHERE tool = 'pdftotext' AND tool_version LIKE '0.%')"`,
+		Run: executeReprocess,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&reprocessWhere, "where", "", "SQL filter selecting the files to reprocess (required)")
+	cmd.Flags().BoolVar(&reprocessDryRun, "dry-run", false, "List matching files without reprocessing them")
+	cmd.Flags().StringVar(&summarize, "summarize", "default", "Summarization level: none, basic, default, or full")
+	cmd.Flags().Float64Var(&costCap, "cost-cap", 5.0, "Maximum LLM spend in USD")
+
+	cmd.MarkFlagRequired("where")
+
+	return cmd
+}
+
+// executeReprocess reprocesses all files matching the filter
+func executeReprocess(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	files, err := database.FindFiles(reprocessWhere)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error selecting files: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d file(s) match: %s\n", len(files), reprocessWhere)
+	if reprocessDryRun {
+		for _, file := range files {
+			fmt.Printf("  %s (extractor: %s, quality: %.2f)\n", file.Path, file.Extractor, file.ExtractQuality)
+		}
+		return
+	}
+
+	tools.PrintHints(os.Stdout)
+
+	p := pipeline.New(pipeline.Config{
+		SummaryLevel:    summariser.SummaryLevel(summarize),
+		CostCap:         costCap,
+		LifetimeBudget:  appConfig.LifetimeBudgetUSD,
+		DocumentCap:     appConfig.DocumentCapUSD,
+		ProviderCaps:    appConfig.ProviderCapsUSD,
+		ExtractEntities: appConfig.ExtractEntities,
+		Classifier:      newClassifier(),
+		WhisperModel:    appConfig.WhisperModel,
+		RefreshCache:    true,
+		Timeouts:        pipelineTimeouts(),
+		Logger:          logger,
+	}, database)
+	if err := registerPlugins(p); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	var processed, skipped, failed int
+	for _, file := range files {
+		result := p.ProcessDocument(ctx, file)
+		switch {
+		case result.Error != nil:
+			failed++
+			fmt.Fprintf(os.Stderr, "  FAILED %s: %v\n", file.Path, result.Error)
+		case result.Skipped:
+			skipped++
+		default:
+			processed++
+			fmt.Printf("  %s: %s (quality %.2f), summarized by %s\n",
+				file.Path, result.Extractor, result.Quality, result.Model)
+		}
+	}
+
+	fmt.Printf("\nReprocessed %d, skipped %d, failed %d. LLM spend: $%.4f\n",
+		processed, skipped, failed, p.TotalCost())
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/restore"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var resolveRestore bool
+
+// newResolveCommand creates a command that looks up stubs in the catalog
+func newResolveCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resolve <stub-file>...",
+		Short: "Show the archived file a stub points to, optionally restoring it in place",
+		Long: `Read .webloc and .url stubs, and Markdown notes linking to an upload, and
+show the catalog entries of the uploaded file they point to. With --restore
+the file is downloaded next to the stub under its original name, checked
+against the catalog's SHA-256, and the stub is removed. A file already at the
+original name is left alone and its stub kept.
+Examples:
+  archiver resolve /Volumes/OldDrive/Taxes/2019.pdf.webloc
+  archiver resolve --restore /Volumes/OldDrive/Photos/*.url`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  executeResolve,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Backblaze B2 bucket name (default: from config)")
+	cmd.Flags().BoolVar(&resolveRestore, "restore", false, "Download the original file in place of the stub")
+
+	return cmd
+}
+
+// executeResolve prints the catalog entries behind each stub and restores
+// them if asked
+func executeResolve(cmd *cobra.Command, args []string) {
+	if cmd.Flags().Changed("bucket") {
+		appConfig.B2Bucket = bucket
+	}
+	if resolveRestore {
+		if err := appConfig.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	var uploader *upload.B2Uploader
+	if resolveRestore {
+		uploader, err = newUploader()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+			os.Exit(1)
+		}
+		defer uploader.Close()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer handleInterrupt(cancel)()
+
+	failed := 0
+	for _, stub := range args {
+		if ctx.Err() != nil {
+			fmt.Println("\nInterrupted: stubs already resolved are complete.")
+			break
+		}
+		file, err := resolveStub(database, stub)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed++
+			continue
+		}
+		if !resolveRestore {
+			continue
+		}
+		if err := restoreStub(ctx, database, uploader, stub, file); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("  Restored: %s\n", db.StubOriginal(stub))
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// resolveStub prints the catalog entries of the upload a stub points to and
+// returns the one it most likely stands in for: the entry at the stub's
+// original path if there is one, otherwise the first copy still cataloged
+func resolveStub(database *db.DB, stub string) (*db.FileStatus, error) {
+	original := db.StubOriginal(stub)
+	if original == "" {
+		return nil, fmt.Errorf("%s is not a stub file", stub)
+	}
+	url, err := db.ReadStub(stub)
+	if err != nil {
+		return nil, err
+	}
+	files, err := database.GetFilesByURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", url, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s points to %s, which is not in the catalog", stub, url)
+	}
+	file := stubbedFile(files, original)
+
+	fmt.Printf("%s\n", stub)
+	fmt.Printf("  URL:      %s\n", url)
+	fmt.Printf("  Original: %s\n", original)
+	for _, candidate := range files {
+		status := ""
+		if candidate.DeletedAt.Valid {
+			status = " (deleted from catalog)"
+		}
+		fmt.Printf("  Catalog:  %s, %s%s\n", candidate.Path, formatSize(candidate.Size), status)
+	}
+	if file.SHA256 != "" {
+		fmt.Printf("  SHA-256:  %s\n", file.SHA256)
+	}
+	if file.UploadTime.Valid {
+		fmt.Printf("  Uploaded: %s\n", file.UploadTime.Time.Format("2006-01-02 15:04"))
+	}
+	return file, nil
+}
+
+// stubbedFile picks the catalog entry a stub of original stands in for out
+// of the files sharing its upload
+func stubbedFile(files []*db.FileStatus, original string) *db.FileStatus {
+	for _, file := range files {
+		if file.Path == original {
+			return file
+		}
+	}
+	return files[0]
+}
+
+// restoreStub downloads file to the stub's original path and removes the
+// stub once the download is complete and verified
+func restoreStub(ctx context.Context, database *db.DB, uploader *upload.B2Uploader, stub string, file *db.FileStatus) error {
+	original := db.StubOriginal(stub)
+	if _, err := os.Lstat(original); err == nil {
+		return fmt.Errorf("%s already exists; the stub was kept", original)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	err := restore.WriteFile(original, file, func(w io.Writer) error {
+		return uploader.Download(context.WithoutCancel(ctx), file.UploadedURL, w)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", original, err)
+	}
+	recordEgress(database, file.ID, file.Size)
+
+	if err := os.Remove(stub); err != nil {
+		return fmt.Errorf("restored %s but could not remove its stub: %w", original, err)
+	}
+	if err := database.RemoveStub(original); err != nil {
+		logger.Warn("could not forget stub", "path", stub, "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/restore"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreTo         string
+	restoreWhere      string
+	restoreOnConflict string
+	restoreDryRun     bool
+)
+
+// newRestoreCommand creates a command that downloads archived files
+func newRestoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Download archived files into a directory without clobbering local changes",
+		Long: `Download uploaded files from B2 into a directory, each at its path relative to
+the scanned source. Files already there with the archived content are left
+alone. When a different file is in the way, --on-conflict decides: prompt asks
+for each one (the default), skip keeps the local file, overwrite replaces it
+and keep-both restores next to it as "name (restored).ext". The summary lists
+every conflict and whether the local file was newer.
+Examples:
+  archiver restore --to ~/Restored --where "path LIKE '/Volumes/OldDrive/Taxes/%'"
+  archiver restore --to ~/Documents --on-conflict keep-both --dry-run`,
+		Run: executeRestore,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Backblaze B2 bucket name (default: from config)")
+	cmd.Flags().StringVar(&restoreTo, "to", "", "Directory to restore into")
+	cmd.Flags().StringVar(&restoreWhere, "where", "", "SQL filter over the catalog columns selecting the files (default: all uploaded files)")
+	cmd.Flags().StringVar(&restoreOnConflict, "on-conflict", string(restore.PolicyPrompt), "What to do with different local files: prompt, skip, overwrite or keep-both")
+	cmd.Flags().BoolVar(&restoreDryRun, "dry-run", false, "Report what would be restored and the conflicts without downloading")
+	cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+// restoreOutcome is what happened to one file
+type restoreOutcome string
+
+const (
+	outcomeRestored  restoreOutcome = "restored"
+	outcomeIdentical restoreOutcome = "identical"
+	outcomeSkipped   restoreOutcome = "skipped"
+	outcomeReplaced  restoreOutcome = "overwritten"
+	outcomeKeptBoth  restoreOutcome = "kept both"
+	outcomeUndecided restoreOutcome = "to decide" // Dry run of prompt
+	outcomeFailed    restoreOutcome = "failed"
+)
+
+// executeRestore downloads the selected files, resolving conflicts
+func executeRestore(cmd *cobra.Command, args []string) {
+	policy, err := restore.ParsePolicy(restoreOnConflict)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if policy == restore.PolicyPrompt && !restoreDryRun && !stdinIsTerminal() {
+		fmt.Fprintln(os.Stderr, "Error: cannot prompt without a terminal; choose --on-conflict skip, overwrite or keep-both")
+		os.Exit(1)
+	}
+
+	if cmd.Flags().Changed("bucket") {
+		appConfig.B2Bucket = bucket
+	}
+	if !restoreDryRun {
+		if err := appConfig.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	where := "uploaded_url IS NOT NULL AND uploaded_url != ''"
+	if restoreWhere != "" {
+		where += " AND (" + restoreWhere + ")"
+	}
+	files, err := database.FindFiles(where)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error selecting files: %v\n", err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Println("No uploaded files match.")
+		return
+	}
+
+	var uploader *upload.B2Uploader
+	if !restoreDryRun {
+		uploader, err = newUploader()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+			os.Exit(1)
+		}
+		defer uploader.Close()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer handleInterrupt(cancel)()
+
+	counts := make(map[restoreOutcome]int)
+	var conflicts []string
+	prompt := bufio.NewReader(os.Stdin)
+	for _, file := range files {
+		if ctx.Err() != nil {
+			fmt.Println("\nInterrupted: files already restored are complete.")
+			break
+		}
+
+		target, err := restore.Inspect(file, restoreTo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  error: %v\n", err)
+			counts[outcomeFailed]++
+			continue
+		}
+		if target.Identical {
+			counts[outcomeIdentical]++
+			continue
+		}
+
+		dest := target.Path
+		outcome := outcomeRestored
+		if target.Conflict() {
+			choice := policy
+			if choice == restore.PolicyPrompt && !restoreDryRun {
+				choice, policy = askConflict(prompt, target)
+			}
+			switch choice {
+			case restore.PolicyPrompt:
+				outcome = outcomeUndecided
+			case restore.PolicySkip:
+				outcome = outcomeSkipped
+			case restore.PolicyOverwrite:
+				outcome = outcomeReplaced
+			case restore.PolicyKeepBoth:
+				outcome = outcomeKeptBoth
+				if dest, err = restore.KeepBothPath(target.Path); err != nil {
+					fmt.Fprintf(os.Stderr, "  error: %v\n", err)
+					counts[outcomeFailed]++
+					continue
+				}
+			}
+			conflicts = append(conflicts, conflictLine(target, outcome))
+		}
+
+		if outcome != outcomeSkipped && outcome != outcomeUndecided && !restoreDryRun {
+			err := restore.WriteFile(dest, file, func(w io.Writer) error {
+				return uploader.Download(context.WithoutCancel(ctx), file.UploadedURL, w)
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "  error: %v\n", err)
+				counts[outcomeFailed]++
+				continue
+			}
+			recordEgress(database, file.ID, file.Size)
+		}
+		counts[outcome]++
+	}
+
+	if len(conflicts) > 0 {
+		fmt.Printf("\nConflicts (%d):\n", len(conflicts))
+		for _, line := range conflicts {
+			fmt.Println(line)
+		}
+	}
+	fmt.Printf("\nRestored: %d\n", counts[outcomeRestored])
+	fmt.Printf("Already up to date: %d\n", counts[outcomeIdentical])
+	fmt.Printf("Conflicts skipped: %d\n", counts[outcomeSkipped])
+	fmt.Printf("Conflicts overwritten: %d\n", counts[outcomeReplaced])
+	fmt.Printf("Conflicts kept both: %d\n", counts[outcomeKeptBoth])
+	if counts[outcomeUndecided] > 0 {
+		fmt.Printf("Conflicts to decide: %d\n", counts[outcomeUndecided])
+	}
+	fmt.Printf("Failed: %d\n", counts[outcomeFailed])
+	if restoreDryRun {
+		fmt.Println("Dry run: nothing was downloaded.")
+	}
+	if counts[outcomeFailed] > 0 {
+		os.Exit(1)
+	}
+}
+
+// askConflict asks what to do with one conflict. It returns the choice and
+// the policy for the conflicts after it, which stays prompt unless the
+// answer applies to all of them.
+func askConflict(prompt *bufio.Reader, target *restore.Target) (choice, next restore.Policy) {
+	for {
+		fmt.Printf("%s differs from the archived version", target.Path)
+		if target.LocalNewer {
+			fmt.Print(" and is newer")
+		}
+		fmt.Print(".\n[s]kip, [o]verwrite, [k]eep both (capital letter: same for all remaining)? ")
+
+		answer, err := prompt.ReadString('\n')
+		if err != nil && answer == "" {
+			return restore.PolicySkip, restore.PolicySkip
+		}
+		answer = strings.TrimSpace(answer)
+		for _, option := range []struct {
+			key    string
+			policy restore.Policy
+		}{
+			{"s", restore.PolicySkip},
+			{"o", restore.PolicyOverwrite},
+			{"k", restore.PolicyKeepBoth},
+		} {
+			switch answer {
+			case option.key:
+				return option.policy, restore.PolicyPrompt
+			case strings.ToUpper(option.key):
+				return option.policy, option.policy
+			}
+		}
+	}
+}
+
+// conflictLine describes a conflict and how it was resolved
+func conflictLine(target *restore.Target, outcome restoreOutcome) string {
+	age := "older"
+	if target.LocalNewer {
+		age = "newer"
+	}
+	return fmt.Sprintf("  %-11s %s (local file %s)", outcome, target.Path, age)
+}
+
+// stdinIsTerminal reports whether stdin is an interactive terminal
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/pipeline"
+	"github.com/jth/archiver/internal/recovery"
+	"github.com/jth/archiver/internal/scan"
+	"github.com/jth/archiver/internal/tools"
+	"github.com/spf13/cobra"
+)
+
+var resumeAuto bool
+
+// newResumeCommand creates a command that continues an interrupted run
+func newResumeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resume [run-id]",
+		Short: "Continue an interrupted run where it stopped",
+		Long: `Continue a run that was interrupted, by default the latest one that no later
+run of the same source completed. A run stopped while processing documents
+or media goes straight to the files of its source it didn't get to. A run
+stopped while scanning scans its source again, keeping the hashes of files
+already scanned if they are unchanged, then processes the documents. Files
+already processed are skipped either way.
+
+Runs over paths from ingest or --files-from can only be resumed after their
+scan; rerun the original command otherwise.
+
+--auto is meant to run at login or boot (e.g. from a launchd agent). It
+marks runs the machine crashed or lost power in as interrupted, repairs what
+they left behind (half-written stubs, temporary files and unfinished large
+file uploads), then resumes the latest interrupted run of every source that
+is mounted, and sends a notification when done. It does nothing if there is
+nothing to resume.
+Examples:
+  archiver resume
+  archiver resume 12 --summarize basic
+  archiver resume --auto`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  executeResume,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+	cmd.Flags().BoolVar(&resumeAuto, "auto", false, "Recover from a crash and resume every interrupted run, with a notification")
+	cmd.Flags().BoolVar(&includeAll, "include-all", false, "Disable the default exclusion lists")
+	cmd.Flags().StringVar(&summarize, "summarize", "default", "Summarization level: none, basic, default, or full")
+	cmd.Flags().Float64Var(&costCap, "cost-cap", 5.0, "Maximum LLM spend in USD")
+	cmd.Flags().IntVar(&maxTranscodes, "max-transcodes", 0, "Maximum concurrent video transcodes (default: 1)")
+	cmd.Flags().IntVar(&maxExtractions, "max-extractions", 0, "Maximum concurrent text extractions (default: based on CPU and memory)")
+	cmd.Flags().BoolVar(&powerAware, "power-aware", false, "Pause transcoding and hashing while on battery or thermally throttled")
+
+	return cmd
+}
+
+// executeResume finds the run to resume and runs the remaining stages
+func executeResume(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	if resumeAuto {
+		if len(args) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: --auto resumes every interrupted run; don't name one\n")
+			os.Exit(1)
+		}
+		if err := resumeAll(database); err != nil {
+			fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	run, err := resumableRun(database, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if run == nil {
+		fmt.Fprintln(stdout, "No interrupted run to resume.")
+		return
+	}
+	if run.Command == "backup-diff" {
+		fmt.Fprintf(stdout, "Run %d was a backup of %s; run backup-diff again to upload what is left.\n", run.ID, run.Source)
+		return
+	}
+	if run.Command == "checkdrive" {
+		fmt.Fprintf(stdout, "Run %d was a check of %s; run checkdrive again to check it.\n", run.ID, run.Source)
+		return
+	}
+
+	if err := resumeRun(database, run); err != nil {
+		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// resumeRun runs the stages an interrupted run didn't finish
+func resumeRun(database *db.DB, run *db.Run) error {
+	var scanner *scan.Scanner
+	if run.Stage == pipeline.StageDocuments || run.Stage == pipeline.StageMedia {
+		fmt.Fprintf(stdout, "Resuming run %d (%s): processing the remaining documents and media\n", run.ID, run.Source)
+	} else {
+		if _, err := os.Stat(run.Source); err != nil {
+			return fmt.Errorf("run %d stopped while scanning %s, which can't be scanned again; run the original command instead",
+				run.ID, run.Source)
+		}
+		fmt.Fprintf(stdout, "Resuming run %d (%s): scanning again, skipping unchanged files\n", run.ID, run.Source)
+
+		sourcePath, filesFrom = run.Source, ""
+		var err error
+		scanner, err = newSourceScanner()
+		if err != nil {
+			return fmt.Errorf("failed to create scanner: %w", err)
+		}
+		defer scanner.Close()
+		if includeAll {
+			scanner.SetPolicy(nil)
+		}
+		scanner.SetReuseHashes(true)
+	}
+	tools.PrintHints(stdout)
+
+	return runPipeline(database, scanner, fmt.Sprintf("resume %d", run.ID), run.Source)
+}
+
+// resumeAll recovers from a crash and resumes the latest interrupted run of
+// every mounted source, for resume --auto
+func resumeAll(database *db.DB) error {
+	if boot, err := recovery.BootTime(); err != nil {
+		logger.Warn("can't tell which runs crashed", "error", err)
+	} else if crashed, err := database.MarkCrashedRuns(boot); err != nil {
+		return err
+	} else if crashed > 0 {
+		fmt.Fprintf(stdout, "Marked %d run(s) that were running when the machine went down as interrupted\n", crashed)
+	}
+
+	runs, err := database.InterruptedRuns()
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		return nil
+	}
+
+	// Unattended runs always say how they went
+	if !notifier.Enabled() {
+		notifyDesktop = true
+		setupNotifier()
+	}
+
+	for _, run := range runs {
+		if run.Command == "backup-diff" {
+			cancelUnfinishedUploads()
+			fmt.Fprintf(stdout, "Run %d was a backup of %s; run backup-diff again to upload what is left.\n", run.ID, run.Source)
+			continue
+		}
+		if run.Command == "checkdrive" {
+			continue
+		}
+		if info, err := os.Stat(run.Source); err != nil || !info.IsDir() {
+			fmt.Fprintf(stdout, "Skipping run %d: %s is not mounted\n", run.ID, run.Source)
+			continue
+		}
+
+		fixes, err := recovery.Sweep(run.Source, func(original string) string {
+			if file, err := database.GetFileByPath(original); err == nil && file != nil {
+				return file.UploadedURL
+			}
+			return ""
+		})
+		for _, fix := range fixes {
+			fmt.Fprintf(stdout, "  %s %s: %s\n", fix.Action, fix.Path, fix.Detail)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to clean up after run %d: %w", run.ID, err)
+		}
+
+		if err := resumeRun(database, run); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Error resuming run %d: %v\n", run.ID, err)
+		}
+	}
+	return nil
+}
+
+// cancelUnfinishedUploads cancels the large file uploads a crashed backup
+// left unfinished in the bucket, if B2 is configured
+func cancelUnfinishedUploads() {
+	if appConfig.B2KeyID == "" || appConfig.B2AppKey == "" || appConfig.B2Bucket == "" {
+		return
+	}
+	uploader, err := newUploader()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+		return
+	}
+	defer uploader.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	cancelled, err := uploader.CancelUnfinishedUploads(ctx)
+	for _, name := range cancelled {
+		fmt.Fprintf(stdout, "  cancelled the unfinished upload of %s\n", name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error cancelling unfinished uploads: %v\n", err)
+	}
+}
+
+// resumableRun returns the run named by the arguments, or the latest
+// interrupted run when there are none
+func resumableRun(database *db.DB, args []string) (*db.Run, error) {
+	if len(args) == 0 {
+		return database.LatestInterruptedRun()
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid run id %q", args[0])
+	}
+	run, err := database.GetRun(id)
+	if err != nil {
+		return nil, err
+	}
+	if run.Status == db.RunCompleted {
+		return nil, fmt.Errorf("run %d completed; there is nothing to resume", id)
+	}
+	return run, nil
+}
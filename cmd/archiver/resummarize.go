@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/pipeline"
+	"github.com/jth/archiver/internal/summariser"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resummarizeWhere  string
+	resummarizeLevel  string
+	resummarizeDryRun bool
+)
+
+// newResummarizeCommand creates a command that summarizes archived files
+// again from their stored text
+func newResummarizeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resummarize",
+		Short: "Summarize archived files again from their stored text",
+		Long: `Summarize the files matching a search query, filters or a SQL expression again,
+from the text stored when they were extracted or transcribed, for example when
+better or cheaper models become available. The drives the files came from
+needn't be connected. Summaries are replaced in the catalog and the search
+index, with the cost of each recorded, and the run stops once --cost-cap is
+spent. Files without stored text are skipped; use reprocess for those.
+Examples:
+  archiver resummarize --query "invoice" --level full --dry-run
+  archiver resummarize --ext pdf --drive OldDrive --cost-cap 2
+  archiver resummarize --where "summary_model = 'gpt-3.5-turbo'" --level full`,
+		Run: executeResummarize,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+	cmd.Flags().StringVarP(&query, "query", "q", "", "Search query selecting the files")
+	cmd.Flags().StringVar(&filterExt, "ext", "", "Only files with this extension")
+	cmd.Flags().StringVar(&filterContentType, "content-type", "", "Only files whose content type starts with this (e.g., application/pdf)")
+	cmd.Flags().StringVar(&filterDrive, "drive", "", "Only files scanned from this drive")
+	cmd.Flags().StringVar(&filterTag, "tag", "", "Only files with this tag")
+	cmd.Flags().StringVar(&resummarizeWhere, "where", "", "SQL filter over the catalog columns selecting the files")
+	cmd.Flags().StringVar(&resummarizeLevel, "level", "default", "Summarization level: basic, default, or full")
+	cmd.Flags().Float64Var(&costCap, "cost-cap", 5.0, "Maximum LLM spend in USD")
+	cmd.Flags().BoolVar(&resummarizeDryRun, "dry-run", false, "List matching files without summarizing them")
+
+	return cmd
+}
+
+// executeResummarize summarizes the selected files again
+func executeResummarize(cmd *cobra.Command, args []string) {
+	level := summariser.SummaryLevel(resummarizeLevel)
+	switch level {
+	case summariser.SummaryBasic, summariser.SummaryDefault, summariser.SummaryFull:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --level must be basic, default or full, got %q\n", resummarizeLevel)
+		os.Exit(1)
+	}
+
+	request := db.SearchRequest{
+		Query:       query,
+		Extension:   filterExt,
+		ContentType: filterContentType,
+		Drive:       filterDrive,
+		Tag:         filterTag,
+	}
+	if query == "" && !hasFilters(request) && resummarizeWhere == "" {
+		fmt.Fprintln(os.Stderr, "Error: select files with --query, --where or a filter")
+		os.Exit(1)
+	}
+
+	database, indexer := openIndex()
+	defer database.Close()
+	fileIDs, err := selectFiles(database, indexer, request, resummarizeWhere, "")
+	indexer.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error selecting files: %v\n", err)
+		os.Exit(1)
+	}
+
+	var files []*db.FileStatus
+	for _, id := range fileIDs {
+		file, err := database.GetFileByID(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %d: %v\n", id, err)
+			os.Exit(1)
+		}
+		if file != nil && !file.IsDir && !file.DeletedAt.Valid {
+			files = append(files, file)
+		}
+	}
+
+	fmt.Printf("%d file(s) selected\n", len(files))
+	if resummarizeDryRun {
+		for _, file := range files {
+			model := file.SummaryModel
+			if model == "" {
+				model = "none"
+			}
+			fmt.Printf("  %s (summarized by %s)\n", file.Path, model)
+		}
+		return
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	p := pipeline.New(pipeline.Config{
+		SummaryLevel:    level,
+		CostCap:         costCap,
+		LifetimeBudget:  appConfig.LifetimeBudgetUSD,
+		DocumentCap:     appConfig.DocumentCapUSD,
+		ProviderCaps:    appConfig.ProviderCapsUSD,
+		ExtractEntities: appConfig.ExtractEntities,
+		Classifier:      newClassifier(),
+		RefreshCache:    true,
+		Timeouts:        pipelineTimeouts(),
+		Logger:          logger,
+	}, database)
+	if !p.CanSummarize() {
+		fmt.Fprintln(os.Stderr, "Error: no model can summarize; set an API key or install Ollama (see archiver doctor)")
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	var summarized, skipped, failed int
+	for i, file := range files {
+		result := p.Resummarize(ctx, file)
+		if errors.Is(result.Error, summariser.ErrBudgetReached) {
+			fmt.Fprintf(os.Stderr, "\nStopped: %v; %d file(s) left\n", result.Error, len(files)-i)
+			break
+		}
+		switch {
+		case result.Error != nil:
+			failed++
+			fmt.Fprintf(os.Stderr, "  FAILED %s: %v\n", file.Path, result.Error)
+		case result.Skipped:
+			skipped++
+			fmt.Printf("  %s: no stored text, skipped\n", file.Path)
+		default:
+			summarized++
+			fmt.Printf("  %s: summarized by %s ($%.4f)\n", file.Path, result.Model, result.Cost)
+		}
+	}
+	syncIndex(database)
+
+	fmt.Printf("\nResummarized %d, skipped %d, failed %d. LLM spend: $%.4f\n",
+		summarized, skipped, failed, p.TotalCost())
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var (
+	retagWhere  string
+	retagAdd    []string
+	retagRemove []string
+	retagRename string
+	retagDryRun bool
+)
+
+// newRetagCommand creates a command that adds and removes tags in bulk
+func newRetagCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retag",
+		Short: "Add, remove or rename tags on many files at once",
+		Long: `Add, remove or rename tags on every file matching a search query, filters or
+a SQL expression. The catalog and the search index are updated together, and
+each edit is recorded so it can be undone.
+Examples:
+  archiver retag --query "invoice" --ext pdf --add-tag finance --dry-run
+  archiver retag --where "path LIKE '%/Scans/%'" --add-tag scans --remove-tag inbox
+  archiver retag --rename-tag photo=photos
+  archiver retag history
+  archiver retag undo`,
+		Run: executeRetag,
+	}
+
+	cmd.PersistentFlags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.PersistentFlags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+
+	cmd.Flags().StringVarP(&query, "query", "q", "", "Search query selecting the files")
+	cmd.Flags().StringVar(&filterExt, "ext", "", "Only files with this extension")
+	cmd.Flags().StringVar(&filterContentType, "content-type", "", "Only files whose content type starts with this (e.g., video/)")
+	cmd.Flags().StringVar(&filterDrive, "drive", "", "Only files scanned from this drive")
+	cmd.Flags().StringVar(&filterTag, "tag", "", "Only files with this tag")
+	cmd.Flags().StringVar(&retagWhere, "where", "", "SQL filter over the catalog columns selecting the files")
+	cmd.Flags().StringSliceVar(&retagAdd, "add-tag", nil, "Tag to add (repeatable)")
+	cmd.Flags().StringSliceVar(&retagRemove, "remove-tag", nil, "Tag to remove (repeatable)")
+	cmd.Flags().StringVar(&retagRename, "rename-tag", "", "Rename a tag, as old=new")
+	cmd.Flags().BoolVar(&retagDryRun, "dry-run", false, "Preview the changes without applying them")
+
+	cmd.MarkFlagsOneRequired("add-tag", "remove-tag", "rename-tag")
+	cmd.MarkFlagsMutuallyExclusive("rename-tag", "add-tag")
+	cmd.MarkFlagsMutuallyExclusive("rename-tag", "remove-tag")
+
+	cmd.AddCommand(newRetagUndoCommand())
+	cmd.AddCommand(newRetagHistoryCommand())
+
+	return cmd
+}
+
+// newRetagUndoCommand creates a command that reverts a bulk tag edit
+func newRetagUndoCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "undo [edit-id]",
+		Short: "Revert a bulk tag edit (default: the most recent one)",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   executeRetagUndo,
+	}
+}
+
+// newRetagHistoryCommand creates a command that lists bulk tag edits
+func newRetagHistoryCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "history",
+		Short: "List bulk tag edits",
+		Run:   executeRetagHistory,
+	}
+}
+
+// executeRetag previews or applies a bulk tag edit
+func executeRetag(cmd *cobra.Command, args []string) {
+	add, remove := cleanTags(retagAdd), cleanTags(retagRemove)
+	renameFrom := ""
+	if retagRename != "" {
+		from, to, ok := strings.Cut(retagRename, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" || from == to {
+			fmt.Fprintf(os.Stderr, "Error: --rename-tag must be old=new, got %q\n", retagRename)
+			os.Exit(1)
+		}
+		renameFrom = from
+		add, remove = []string{to}, []string{from}
+	}
+	for _, tag := range add {
+		for _, other := range remove {
+			if tag == other {
+				fmt.Fprintf(os.Stderr, "Error: tag %q is both added and removed\n", tag)
+				os.Exit(1)
+			}
+		}
+	}
+
+	request := db.SearchRequest{
+		Query:       query,
+		Extension:   filterExt,
+		ContentType: filterContentType,
+		Drive:       filterDrive,
+		Tag:         filterTag,
+	}
+	if query == "" && !hasFilters(request) && retagWhere == "" && renameFrom == "" {
+		fmt.Fprintln(os.Stderr, "Error: select files with --query, --where or a filter")
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	indexer, err := db.NewIndexer(db.IndexConfig{
+		IndexDir:       indexDir,
+		IndexSummaries: true,
+		IndexContent:   true,
+	}, database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening index: %v\n", err)
+		os.Exit(1)
+	}
+	defer indexer.Close()
+
+	fileIDs, err := selectFiles(database, indexer, request, retagWhere, renameFrom)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error selecting files: %v\n", err)
+		os.Exit(1)
+	}
+
+	changes, err := database.PlanTagEdit(fileIDs, add, remove)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error planning tag edit: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d file(s) selected, %d tag change(s)\n", len(fileIDs), len(changes))
+	if len(changes) == 0 {
+		return
+	}
+	printTagChanges(changes)
+	if retagDryRun {
+		fmt.Println("\nDry run: nothing was changed.")
+		return
+	}
+
+	editID, err := indexer.ApplyTagEdit(describeRetag(add, remove, renameFrom), changes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error applying tag edit: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\nApplied tag edit %d. Revert it with: archiver retag undo %d\n", editID, editID)
+}
+
+// selectFiles returns the IDs of the files matching every given selector:
+// the search query and filters, the SQL filter where and the tag
+func selectFiles(database *db.DB, indexer *db.BleveIndexer, request db.SearchRequest, where, tag string) ([]int64, error) {
+	var sets [][]int64
+
+	if request.Query != "" || hasFilters(request) {
+		ids, err := indexer.MatchingFileIDs(request)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, ids)
+	}
+
+	if where != "" {
+		files, err := database.FindFiles(where)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]int64, len(files))
+		for i, file := range files {
+			ids[i] = file.ID
+		}
+		sets = append(sets, ids)
+	}
+
+	if tag != "" {
+		ids, err := database.FilesWithTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, ids)
+	}
+
+	// Keep the IDs present in every set
+	counts := make(map[int64]int)
+	for _, set := range sets {
+		seen := make(map[int64]bool)
+		for _, id := range set {
+			if !seen[id] {
+				seen[id] = true
+				counts[id]++
+			}
+		}
+	}
+
+	var ids []int64
+	for id, count := range counts {
+		if count == len(sets) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// printTagChanges prints the changes grouped by file
+func printTagChanges(changes []db.TagChange) {
+	var path string
+	var line []string
+	flush := func() {
+		if len(line) > 0 {
+			fmt.Printf("  %s  %s\n", path, strings.Join(line, " "))
+		}
+	}
+
+	for _, change := range changes {
+		if change.Path != path {
+			flush()
+			path, line = change.Path, nil
+		}
+		if change.Added {
+			line = append(line, "+"+change.Tag)
+		} else {
+			line = append(line, "-"+change.Tag)
+		}
+	}
+	flush()
+}
+
+// describeRetag summarizes a tag edit for the history
+func describeRetag(add, remove []string, renameFrom string) string {
+	if renameFrom != "" {
+		return fmt.Sprintf("rename %s to %s", renameFrom, add[0])
+	}
+
+	var parts []string
+	for _, tag := range add {
+		parts = append(parts, "+"+tag)
+	}
+	for _, tag := range remove {
+		parts = append(parts, "-"+tag)
+	}
+	return strings.Join(parts, " ")
+}
+
+// cleanTags trims tags and drops empty ones
+func cleanTags(tags []string) []string {
+	var cleaned []string
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			cleaned = append(cleaned, tag)
+		}
+	}
+	return cleaned
+}
+
+// executeRetagUndo reverts a bulk tag edit
+func executeRetagUndo(cmd *cobra.Command, args []string) {
+	var editID int64
+	if len(args) == 1 {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || id <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid edit id %q\n", args[0])
+			os.Exit(1)
+		}
+		editID = id
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	indexer, err := db.NewIndexer(db.IndexConfig{
+		IndexDir:       indexDir,
+		IndexSummaries: true,
+		IndexContent:   true,
+	}, database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening index: %v\n", err)
+		os.Exit(1)
+	}
+	defer indexer.Close()
+
+	edit, err := indexer.UndoTagEdit(editID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error undoing tag edit: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Undid tag edit %d (%s): %d change(s) reverted\n", edit.ID, edit.Description, edit.Changes)
+}
+
+// executeRetagHistory lists the recorded bulk tag edits
+func executeRetagHistory(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	edits, err := database.ListTagEdits()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing tag edits: %v\n", err)
+		os.Exit(1)
+	}
+	if len(edits) == 0 {
+		fmt.Println("No tag edits.")
+		return
+	}
+
+	for _, edit := range edits {
+		status := ""
+		if edit.UndoneAt.Valid {
+			status = " (undone " + edit.UndoneAt.Time.Format("2006-01-02 15:04") + ")"
+		}
+		fmt.Printf("%d  %s  %-30s %d change(s)%s\n",
+			edit.ID, edit.CreatedAt.Format("2006-01-02 15:04"), edit.Description, edit.Changes, status)
+	}
+}
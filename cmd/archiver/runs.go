@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/recovery"
+	"github.com/spf13/cobra"
+)
+
+var (
+	runsLimit    int
+	jobSource    string
+	jobSummarize string
+	jobAll       bool
+	jobsAll      bool
+	workWait     bool
+)
+
+// jobPollInterval is how often runs work --wait looks for new jobs
+const jobPollInterval = 30 * time.Second
+
+// newRunsCommand creates the command group for the run history
+func newRunsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "Show the history of archive runs",
+		Long: `Every archive, ingest, scheduled and queued run is recorded with its start
+and end time, file counts, bytes uploaded, LLM spend and errors.
+
+Archive runs can also be queued as jobs, which runs work then runs one after
+another, so that several drives can be lined up to archive unattended.
+Examples:
+  archiver runs list
+  archiver runs show 12
+  archiver runs queue --source /Volumes/OldDrive
+  archiver runs jobs
+  archiver runs work --wait`,
+	}
+
+	cmd.PersistentFlags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List recent runs",
+		Run:   executeRunsList,
+	}
+	listCmd.Flags().IntVarP(&runsLimit, "limit", "l", 20, "Maximum number of runs to list (0 for all)")
+
+	cmd.AddCommand(listCmd)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show <id>",
+		Short: "Show the details and errors of a run",
+		Args:  cobra.ExactArgs(1),
+		Run:   executeRunsShow,
+	})
+	cmd.AddCommand(newRunsQueueCommand())
+	cmd.AddCommand(newRunsJobsCommand())
+	cmd.AddCommand(newRunsWorkCommand())
+	cmd.AddCommand(&cobra.Command{
+		Use:   "cancel <job-id>",
+		Short: "Take a queued job out of the queue",
+		Args:  cobra.ExactArgs(1),
+		Run:   executeRunsCancel,
+	})
+
+	return cmd
+}
+
+// newRunsQueueCommand creates a command that queues an archive run
+func newRunsQueueCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Queue an archive run of a source for runs work",
+		Run:   executeRunsQueue,
+	}
+
+	cmd.Flags().StringVarP(&jobSource, "source", "s", "", "Source directory, file or glob to archive (required)")
+	cmd.Flags().StringVar(&jobSummarize, "summarize", "default", "Summarization level: none, basic, default, or full")
+	cmd.Flags().BoolVar(&jobAll, "include-all", false, "Disable the default exclusion lists")
+	cmd.MarkFlagRequired("source")
+
+	return cmd
+}
+
+// newRunsJobsCommand creates a command that lists the job queue
+func newRunsJobsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "List the queued and running jobs",
+		Run:   executeRunsJobs,
+	}
+
+	cmd.Flags().BoolVarP(&jobsAll, "all", "a", false, "List finished and cancelled jobs too")
+
+	return cmd
+}
+
+// newRunsWorkCommand creates a command that runs the queued jobs
+func newRunsWorkCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "work",
+		Short: "Run the queued jobs one after another",
+		Long: `Run the queued jobs in the order they were queued, each recorded as a run,
+until the queue is empty. With --wait the worker stays up and takes jobs as
+they are queued. Ctrl+C interrupts the current job and stops the worker; the
+interrupted run can be continued with archiver resume. Jobs left running by a
+worker the machine went down under are queued again.`,
+		Run: executeRunsWork,
+	}
+
+	cmd.Flags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+	cmd.Flags().BoolVar(&workWait, "wait", false, "Keep waiting for jobs once the queue is empty")
+	cmd.Flags().Float64Var(&costCap, "cost-cap", 5.0, "Maximum LLM spend in USD per run")
+	cmd.Flags().IntVar(&maxTranscodes, "max-transcodes", 0, "Maximum concurrent video transcodes (default: 1)")
+	cmd.Flags().IntVar(&maxExtractions, "max-extractions", 0, "Maximum concurrent text extractions (default: based on CPU and memory)")
+	cmd.Flags().BoolVar(&powerAware, "power-aware", false, "Pause transcoding and hashing while on battery or thermally throttled")
+
+	return cmd
+}
+
+// executeRunsList prints one line per recent run
+func executeRunsList(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	runs, err := database.ListRuns(runsLimit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing runs: %v\n", err)
+		os.Exit(1)
+	}
+	if len(runs) == 0 {
+		fmt.Fprintln(stdout, "No runs recorded yet.")
+		return
+	}
+
+	for _, run := range runs {
+		fmt.Fprintf(stdout, "%4d  %s  %-10s %-11s %6d files  %5d failed  $%.4f  %s\n",
+			run.ID, run.StartedAt.Format("2006-01-02 15:04"), run.Command, run.Status,
+			run.FilesProcessed, run.FilesFailed, run.Cost, run.Source)
+	}
+}
+
+// executeRunsShow prints the details of one run and the files that failed
+func executeRunsShow(cmd *cobra.Command, args []string) {
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid run id %q\n", args[0])
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	run, err := database.GetRun(id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	runErrors, err := database.GetRunErrors(id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading run errors: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(stdout, "Run %d: %s\n", run.ID, run.Command)
+	fmt.Fprintf(stdout, "Source: %s\n", run.Source)
+	fmt.Fprintf(stdout, "Status: %s\n", run.Status)
+	fmt.Fprintf(stdout, "Started: %s\n", run.StartedAt.Format("2006-01-02 15:04:05"))
+	if run.FinishedAt.Valid {
+		fmt.Fprintf(stdout, "Finished: %s (%s)\n", run.FinishedAt.Time.Format("2006-01-02 15:04:05"),
+			run.FinishedAt.Time.Sub(run.StartedAt).Round(time.Second))
+	}
+	fmt.Fprintf(stdout, "Files: %d total, %d processed, %d skipped, %d failed\n",
+		run.FilesTotal, run.FilesProcessed, run.FilesSkipped, run.FilesFailed)
+	if run.Status == db.RunInterrupted && run.Stage != "" {
+		fmt.Fprintf(stdout, "Stopped during: %s (archiver resume %d)\n", run.Stage, run.ID)
+	}
+	if run.FilesRemaining > 0 {
+		fmt.Fprintf(stdout, "Remaining: %d document(s) not started\n", run.FilesRemaining)
+	}
+	fmt.Fprintf(stdout, "Data processed: %s\n", formatSize(run.BytesProcessed))
+	fmt.Fprintf(stdout, "Data uploaded: %s\n", formatSize(run.BytesUploaded))
+	fmt.Fprintf(stdout, "LLM spend: $%.4f\n", run.Cost)
+	if run.Error != "" {
+		fmt.Fprintf(stdout, "Error: %s\n", run.Error)
+	}
+
+	if len(runErrors) > 0 {
+		fmt.Fprintf(stdout, "\nFailed files (%d):\n", len(runErrors))
+		for _, runError := range runErrors {
+			fmt.Fprintf(stdout, "  %s: %s\n", runError.Path, runError.Error)
+		}
+	}
+}
+
+// executeRunsQueue adds an archive run of a source to the job queue
+func executeRunsQueue(cmd *cobra.Command, args []string) {
+	// Drives may be plugged in only once the job comes up, so a missing
+	// source is only a warning
+	source, err := filepath.Abs(jobSource)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving source: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(source); err != nil {
+		fmt.Fprintf(stdout, "Warning: %s is not available now; the job will fail if it is still missing when it runs\n", source)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	job := &db.Job{Source: source, Summarize: jobSummarize, IncludeAll: jobAll}
+	if err := database.QueueJob(job); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(stdout, "Queued job %d: %s\n", job.ID, job.Source)
+}
+
+// executeRunsJobs prints one line per job in the queue
+func executeRunsJobs(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	jobs, err := database.ListJobs(jobsAll)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing jobs: %v\n", err)
+		os.Exit(1)
+	}
+	if len(jobs) == 0 {
+		fmt.Fprintln(stdout, "No jobs queued. Queue one with: archiver runs queue --source <path>")
+		return
+	}
+
+	for _, job := range jobs {
+		fmt.Fprintf(stdout, "%4d  %s  %-11s %s", job.ID, job.QueuedAt.Format("2006-01-02 15:04"), job.Status, job.Source)
+		if job.RunID != 0 {
+			fmt.Fprintf(stdout, "  (run %d)", job.RunID)
+		}
+		if job.Error != "" {
+			fmt.Fprintf(stdout, "  %s", job.Error)
+		}
+		fmt.Fprintln(stdout)
+	}
+}
+
+// executeRunsCancel takes a job out of the queue
+func executeRunsCancel(cmd *cobra.Command, args []string) {
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid job id %q\n", args[0])
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	if err := database.CancelJob(id); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(stdout, "Cancelled job %d\n", id)
+}
+
+// executeRunsWork takes jobs from the queue and runs them until it is empty,
+// or until interrupted with --wait
+func executeRunsWork(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	if boot, err := recovery.BootTime(); err != nil {
+		logger.Warn("can't tell which jobs crashed", "error", err)
+	} else if requeued, err := database.RequeueCrashedJobs(boot); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	} else if requeued > 0 {
+		fmt.Fprintf(stdout, "Queued %d job(s) that were running when the machine went down again\n", requeued)
+	}
+
+	// A Ctrl+C reaches the run in progress too, which finishes the files
+	// it has started before the worker stops
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var failed int
+	for ctx.Err() == nil {
+		job, err := database.TakeJob()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error taking a job: %v\n", err)
+			os.Exit(1)
+		}
+		if job == nil {
+			if !workWait {
+				break
+			}
+			select {
+			case <-time.After(jobPollInterval):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		fmt.Fprintf(stdout, "\n[%s] Running job %d: %s\n", time.Now().Format("2006-01-02 15:04"), job.ID, job.Source)
+		jobErr := archiveSource(database, job.Command(), job.Source, job.Summarize, job.IncludeAll)
+		if err := database.FinishJob(job, jobErr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error recording the end of job %d: %v\n", job.ID, err)
+		}
+		if jobErr != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "Job %d %s: %v\n", job.ID, job.Status, jobErr)
+		}
+		if job.Status == db.RunInterrupted {
+			break
+		}
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jth/archiver/internal/backup"
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/drives"
+	"github.com/jth/archiver/internal/salvage"
+	"github.com/jth/archiver/internal/scan"
+	"github.com/jth/archiver/internal/scratch"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	salvageChunkSize int
+	salvageRetries   int
+	salvageTimeout   time.Duration
+	salvageNoUpload  bool
+	salvageList      bool
+)
+
+// newSalvageCommand creates a command that copies what can be read of the
+// quarantined files of a failing drive
+func newSalvageCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "salvage",
+		Short: "Upload what can be read of the quarantined files of a failing drive",
+		Long: `Read the quarantined files below the source in small chunks, retrying each
+and giving up on reads that hang, and upload what could be read. Chunks that
+still fail are read again sector by sector; the sectors that can't be read
+are replaced with zeros and recorded as bad ranges. Partial uploads carry
+partial=true in their file info. --list shows the salvaged files and their
+bad ranges.
+Examples:
+  archiver salvage --source /Volumes/OldDrive
+  archiver salvage --source /Volumes/OldDrive --retries 10 --timeout 30s
+  archiver salvage --source /Volumes/OldDrive --list`,
+		Run: executeSalvage,
+	}
+
+	cmd.Flags().StringVarP(&sourcePath, "source", "s", "", "Drive or folder whose quarantined files to salvage")
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&backupPrefix, "prefix", "", "Prefix of the uploaded names (default: the folder name)")
+	cmd.Flags().IntVar(&salvageChunkSize, "chunk-size", salvage.DefaultChunkSize, "Bytes read at once")
+	cmd.Flags().IntVar(&salvageRetries, "retries", salvage.DefaultRetries, "Attempts at each chunk and sector")
+	cmd.Flags().DurationVar(&salvageTimeout, "timeout", salvage.DefaultTimeout, "Time before a read is given up on")
+	cmd.Flags().BoolVar(&salvageNoUpload, "no-upload", false, "Catalog what was read without uploading it")
+	cmd.Flags().BoolVar(&salvageList, "list", false, "List the salvaged files instead of salvaging")
+	cmd.MarkFlagRequired("source")
+
+	return cmd
+}
+
+// executeSalvage salvages the quarantined files below the source
+func executeSalvage(cmd *cobra.Command, args []string) {
+	source, err := filepath.Abs(sourcePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if salvageList {
+		listSalvaged(source)
+		return
+	}
+	if !cmd.Flags().Changed("prefix") {
+		backupPrefix = filepath.Base(source)
+	}
+
+	var uploader *upload.B2Uploader
+	if !salvageNoUpload {
+		if err := appConfig.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+			os.Exit(1)
+		}
+		uploader, err = newUploader()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+			os.Exit(1)
+		}
+		defer uploader.Close()
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	quarantined, err := database.GetQuarantined(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing quarantined files: %v\n", err)
+		os.Exit(1)
+	}
+	if len(quarantined) == 0 {
+		fmt.Printf("No files are quarantined below %s.\n", source)
+		return
+	}
+
+	scanner, err := newPathScanner([]string{source})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating scanner: %v\n", err)
+		os.Exit(1)
+	}
+	defer scanner.Close()
+
+	options := salvage.Options{ChunkSize: salvageChunkSize, Retries: salvageRetries, Timeout: salvageTimeout}
+	ctx := context.Background()
+	var complete, partial, failed int
+	for _, entry := range quarantined {
+		salvaged, err := scanner.Salvage(ctx, entry.Path, options)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", entry.Path, err)
+			failed++
+			continue
+		}
+		err = uploadSalvaged(ctx, database, uploader, salvaged)
+		scratch.Remove(salvaged.Copy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: upload failed: %v\n", entry.Path, err)
+			failed++
+			continue
+		}
+
+		result := salvaged.Result
+		if result.Partial() {
+			partial++
+			fmt.Printf("%s: recovered %s of %s, %d bad range(s)\n", entry.Path,
+				formatSize(result.Recovered), formatSize(result.Size), len(result.BadRanges))
+		} else {
+			complete++
+			fmt.Printf("%s: recovered in full\n", entry.Path)
+		}
+	}
+
+	fmt.Printf("\nSalvaged %d in full, %d partially, %d failed\n", complete, partial, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// uploadSalvaged uploads the copy of a salvaged file under the name a backup
+// would give it, unless uploads are off
+func uploadSalvaged(ctx context.Context, database *db.DB, uploader *upload.B2Uploader, salvaged *scan.Salvaged) error {
+	if uploader == nil {
+		return nil
+	}
+	file, err := database.GetFileByPath(salvaged.Path)
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		return fmt.Errorf("%s is not cataloged", salvaged.Path)
+	}
+
+	info := map[string]string{
+		"partial":    strconv.FormatBool(salvaged.Result.Partial()),
+		"bad_ranges": strconv.Itoa(len(salvaged.Result.BadRanges)),
+	}
+	if drive := drives.NameFromPath(file.Path); drive != "" {
+		info["drive"] = drive
+	}
+	result, err := uploader.Put(ctx, salvaged.Copy, backup.RemoteName(backupPrefix, file), info)
+	if err != nil {
+		return err
+	}
+	if err := database.RecordUpload(file.ID, result.URL, result.RemotePath, result.UploadedAt, file.SHA256); err != nil {
+		return err
+	}
+	recordUploadProvenance(database, file, "b2", result, "")
+	return nil
+}
+
+// listSalvaged prints the salvaged files below root with their bad ranges
+func listSalvaged(root string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	files, err := database.GetSalvaged(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing salvaged files: %v\n", err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Printf("No files were salvaged below %s.\n", root)
+		return
+	}
+
+	for _, file := range files {
+		fmt.Printf("%s\n", file.Path)
+		if !file.Partial {
+			fmt.Printf("  recovered in full on %s\n", file.SalvagedAt.Format("2006-01-02 15:04"))
+			continue
+		}
+		fmt.Printf("  recovered %s of %s on %s, unreadable:\n", formatSize(file.Recovered),
+			formatSize(file.Size), file.SalvagedAt.Format("2006-01-02 15:04"))
+		for _, r := range file.BadRanges {
+			fmt.Printf("    bytes %d-%d\n", r.Offset, r.End()-1)
+		}
+	}
+}
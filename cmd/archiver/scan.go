@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jth/archiver/internal/pipeline"
+	"github.com/jth/archiver/internal/scan"
+	"github.com/jth/archiver/internal/tagging"
+	"github.com/spf13/cobra"
+)
+
+var (
+	includeAll       bool
+	showExcluded     bool
+	filesFrom        string
+	snapshots        string
+	retryQuarantined bool
+)
+
+// newScanCommand creates a command that catalogs a source directory
+func newScanCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "scan",
+		Short: "Catalog a source directory without uploading",
+		Long: `Walk a source directory, hash its files and record them in the archive database.
+System folders, package caches, virtual environments and similar noise are
+skipped using the built-in exclusion lists; use --include-all to keep them.
+The source may also be a single file or a glob, and --files-from reads a
+list of paths (one per line, "-" for stdin) produced by other tools.
+Time Machine backups and folders of APFS snapshots are recognized: every
+snapshot is scanned but files unchanged since an earlier one are left out,
+or with --snapshots latest only the newest snapshot is scanned.
+Files and folders that can't be read, as on a failing drive, are quarantined
+and the scan goes on; archiver quarantine lists them. --retry-quarantined
+reads them again in small chunks, retrying each, instead of scanning.
+Examples:
+  archiver scan --source /Volumes/OldDrive
+  archiver scan --source /Volumes/OldDrive --show-excluded
+  archiver scan --source /Volumes/OldDrive --include-all
+  archiver scan --source /Volumes/TimeMachine --snapshots latest
+  archiver scan --source '/Volumes/OldDrive/Scans/*.pdf'
+  find /Volumes/OldDrive -name '*.key' | archiver scan --files-from -
+  archiver scan --source /Volumes/OldDrive --retry-quarantined`,
+		Run: executeScan,
+	}
+
+	cmd.Flags().StringVarP(&sourcePath, "source", "s", "", "Source directory, file or glob")
+	cmd.Flags().StringVar(&filesFrom, "files-from", "", "File listing paths to scan, one per line (- for stdin)")
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().BoolVar(&includeAll, "include-all", false, "Disable the default exclusion lists")
+	cmd.Flags().BoolVar(&showExcluded, "show-excluded", false, "List every excluded path")
+	cmd.Flags().StringVar(&snapshots, "snapshots", "", "Scan snapshot backups: latest, dedupe or all (default from config)")
+	cmd.Flags().BoolVar(&retryQuarantined, "retry-quarantined", false, "Read the quarantined files below the source again instead of scanning")
+	cmd.MarkFlagsOneRequired("source", "files-from")
+
+	return cmd
+}
+
+// executeScan scans the source directory into the database
+func executeScan(cmd *cobra.Command, args []string) {
+	scanner, err := newSourceScanner()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating scanner: %v\n", err)
+		os.Exit(1)
+	}
+	defer scanner.Close()
+
+	if includeAll {
+		scanner.SetPolicy(nil)
+	}
+	if retryQuarantined {
+		retryQuarantinedFiles(scanner)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer handleInterrupt(cancel)()
+
+	fmt.Fprintf(stdout, "Scanning %s...\n", sourceDescription())
+	err = pipeline.Scan(ctx, scanner, newTracker())
+	stopProgress()
+	if err != nil && ctx.Err() != nil {
+		scanned := scanner.Scanned()
+		fmt.Fprintf(stdout, "\nInterrupted after %d files. Files scanned so far are saved.\n", scanned.Files)
+		os.Exit(130)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError scanning source: %v\n", err)
+		os.Exit(1)
+	}
+	scanned := scanner.Scanned()
+	fmt.Fprintf(stdout, "Scanned %d files in %d directories (%s)\n", scanned.Files, scanned.Dirs, formatSize(scanned.Bytes))
+	if copies := scanner.SnapshotCopies(); copies.Files > 0 {
+		fmt.Fprintf(stdout, "Left out %d files (%s) unchanged since an earlier snapshot\n", copies.Files, formatSize(copies.Bytes))
+	}
+	if quarantined := scanner.Quarantined(); quarantined > 0 {
+		fmt.Fprintf(stdout, "Quarantined %d unreadable files or folders (archiver quarantine lists them)\n", quarantined)
+	}
+
+	report := scanner.Excluded()
+	if len(report.Exclusions) == 0 {
+		fmt.Fprintln(stdout, "Scan complete. Nothing was excluded.")
+		return
+	}
+
+	fmt.Fprintf(stdout, "Scan complete. Auto-excluded %d paths:\n", len(report.Exclusions))
+	for _, count := range report.ByRule() {
+		fmt.Fprintf(stdout, "  %6d  %s\n", count.Count, count.Rule)
+	}
+
+	if showExcluded {
+		fmt.Fprintln(stdout, "\nExcluded paths:")
+		for _, exclusion := range report.Exclusions {
+			suffix := ""
+			if exclusion.IsDir {
+				suffix = "/"
+			}
+			fmt.Fprintf(stdout, "  %s%s  (%s)\n", exclusion.Path, suffix, exclusion.Rule)
+		}
+	} else {
+		fmt.Fprintln(stdout, "Use --show-excluded to list them, or --include-all to scan everything.")
+	}
+}
+
+// retryQuarantinedFiles reads the quarantined files below the source again
+// and reports how many were recovered
+func retryQuarantinedFiles(scanner *scan.Scanner) {
+	fmt.Fprintf(stdout, "Retrying quarantined files below %s...\n", sourceDescription())
+	result, err := scanner.RetryQuarantined(commandContext())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error retrying quarantined files: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(stdout, "Recovered %d, still unreadable %d, missing %d\n", result.Recovered, result.Failed, result.Missing)
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// newSourceScanner creates a scanner over the paths named by --source and
+// --files-from. A single directory is scanned as before; files, globs and
+// lists are scanned relative to the directory that contains them all.
+func newSourceScanner() (*scan.Scanner, error) {
+	paths, err := sourcePaths()
+	if err != nil {
+		return nil, err
+	}
+	return newPathScanner(paths)
+}
+
+// newPathScanner creates a scanner over the given files and directories
+func newPathScanner(paths []string) (*scan.Scanner, error) {
+	tagger, err := newTagger()
+	if err != nil {
+		return nil, err
+	}
+
+	scanner, err := scan.NewScanner(paths[0], dbFilePath)
+	if err != nil {
+		return nil, err
+	}
+	scanner.SetTagger(tagger)
+	scanner.SetLogger(logger)
+	if appConfig != nil {
+		scanner.SetHashWorkers(appConfig.Concurrency.HashWorkers)
+		scanner.SetHashTimeout(minutes(appConfig.Timeouts.Hash))
+		if appConfig.Snapshots != "" {
+			scanner.SetSnapshotMode(scan.SnapshotMode(appConfig.Snapshots))
+		}
+	}
+	if snapshots != "" {
+		scanner.SetSnapshotMode(scan.SnapshotMode(snapshots))
+	}
+	if info, err := os.Stat(paths[0]); len(paths) == 1 && err == nil && info.IsDir() {
+		return scanner, nil
+	}
+	if err := scanner.SetPaths(paths); err != nil {
+		scanner.Close()
+		return nil, err
+	}
+	return scanner, nil
+}
+
+// newTagger builds the tagger for the tag rules in the config file
+func newTagger() (*tagging.Tagger, error) {
+	tagger := tagging.NewTagger()
+	if appConfig == nil {
+		return tagger, nil
+	}
+	for _, rule := range appConfig.TagRules {
+		if err := tagger.Add(rule.Pattern, rule.Tag); err != nil {
+			return nil, fmt.Errorf("invalid tag rule in config: %w", err)
+		}
+	}
+	if classifier := newClassifier(); classifier != nil {
+		tagger.SetClassifier(classifier)
+	}
+	return tagger, nil
+}
+
+// newClassifier builds the classifier for the built-in categories and those
+// in the config file, or returns nil if classification is off
+func newClassifier() *tagging.Classifier {
+	if appConfig == nil || !appConfig.Classify {
+		return nil
+	}
+	classifier := tagging.NewClassifier(tagging.DefaultCategories())
+	for _, category := range appConfig.Categories {
+		classifier.Add(tagging.Category{
+			Tag:          category.Tag,
+			Extensions:   category.Extensions,
+			PathKeywords: category.PathKeywords,
+			Keywords:     category.Keywords,
+			MinMatches:   category.MinMatches,
+		})
+	}
+	return classifier
+}
+
+// sourcePaths resolves --source and --files-from into the paths to scan
+func sourcePaths() ([]string, error) {
+	var paths []string
+	if sourcePath != "" {
+		resolved, err := scan.ResolveSource(sourcePath)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, resolved...)
+	}
+
+	if filesFrom != "" {
+		list := os.Stdin
+		if filesFrom != "-" {
+			file, err := os.Open(filesFrom)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open file list: %w", err)
+			}
+			defer file.Close()
+			list = file
+		}
+		listed, err := scan.ReadFileList(list)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, listed...)
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("nothing to scan: set --source or --files-from")
+	}
+	return paths, nil
+}
+
+// sourceDescription describes the scan source for progress messages
+func sourceDescription() string {
+	switch {
+	case filesFrom != "" && sourcePath != "":
+		return fmt.Sprintf("%s and the paths listed in %s", sourcePath, filesFrom)
+	case filesFrom == "-":
+		return "the paths listed on stdin"
+	case filesFrom != "":
+		return "the paths listed in " + filesFrom
+	}
+	return sourcePath
+}
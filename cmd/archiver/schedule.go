@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/schedule"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scheduleSource     string
+	scheduleSummarize  string
+	scheduleIncludeAll bool
+)
+
+// newScheduleCommand creates the command group for scheduled archive runs
+func newScheduleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schedule",
+		Short: "Manage scheduled archive runs",
+		Long: `Schedule recurring archive runs with cron expressions and run them with the
+built-in scheduler, instead of external cron entries with long flag strings.
+Schedules are stored in the archive database.
+Examples:
+  archiver schedule add "0 2 * * *" --source /Volumes/Media
+  archiver schedule add @weekly --source ~/Documents --summarize basic
+  archiver schedule list
+  archiver schedule remove 2
+  archiver schedule daemon`,
+	}
+
+	cmd.PersistentFlags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.PersistentFlags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+
+	cmd.AddCommand(newScheduleAddCommand())
+	cmd.AddCommand(newScheduleListCommand())
+	cmd.AddCommand(newScheduleRemoveCommand())
+	cmd.AddCommand(newScheduleDaemonCommand())
+
+	return cmd
+}
+
+// newScheduleAddCommand creates a command that adds a schedule
+func newScheduleAddCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add <cron-expression>",
+		Short: "Add a scheduled archive run",
+		Long: `Add a scheduled archive run. The schedule is a five-field cron expression
+(minute hour day-of-month month day-of-week) or one of @hourly, @daily,
+@weekly, @monthly and @yearly.`,
+		Args: cobra.ExactArgs(1),
+		Run:  executeScheduleAdd,
+	}
+
+	cmd.Flags().StringVarP(&scheduleSource, "source", "s", "", "Source directory, file or glob to archive (required)")
+	cmd.Flags().StringVar(&scheduleSummarize, "summarize", "default", "Summarization level: none, basic, default, or full")
+	cmd.Flags().BoolVar(&scheduleIncludeAll, "include-all", false, "Disable the default exclusion lists")
+	cmd.MarkFlagRequired("source")
+
+	return cmd
+}
+
+// newScheduleListCommand creates a command that lists schedules
+func newScheduleListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List scheduled archive runs",
+		Run:   executeScheduleList,
+	}
+}
+
+// newScheduleRemoveCommand creates a command that removes a schedule
+func newScheduleRemoveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <id>",
+		Short: "Remove a scheduled archive run",
+		Args:  cobra.ExactArgs(1),
+		Run:   executeScheduleRemove,
+	}
+}
+
+// newScheduleDaemonCommand creates a command that runs schedules as they come due
+func newScheduleDaemonCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Run scheduled archive runs as they come due",
+		Long: `Run in the foreground and start each scheduled archive run when its cron
+expression matches. Runs execute one at a time; a schedule that comes due
+while another run is in progress is skipped until its next time. Changes
+made with schedule add and remove are picked up without a restart.`,
+		Run: executeScheduleDaemon,
+	}
+
+	cmd.Flags().Float64Var(&costCap, "cost-cap", 5.0, "Maximum LLM spend in USD per run")
+	cmd.Flags().IntVar(&maxTranscodes, "max-transcodes", 0, "Maximum concurrent video transcodes (default: 1)")
+	cmd.Flags().IntVar(&maxExtractions, "max-extractions", 0, "Maximum concurrent text extractions (default: based on CPU and memory)")
+	cmd.Flags().BoolVar(&powerAware, "power-aware", false, "Pause transcoding and hashing while on battery or thermally throttled")
+
+	return cmd
+}
+
+// executeScheduleAdd validates and stores a new schedule
+func executeScheduleAdd(cmd *cobra.Command, args []string) {
+	spec, err := schedule.Parse(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Drives may be unplugged when the schedule is added, so a missing
+	// source is only a warning
+	source, err := filepath.Abs(scheduleSource)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving source: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(source); err != nil {
+		fmt.Fprintf(stdout, "Warning: %s is not available now; runs will be skipped while it is missing\n", source)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	s := &db.Schedule{
+		Spec:       spec.String(),
+		Source:     source,
+		Summarize:  scheduleSummarize,
+		IncludeAll: scheduleIncludeAll,
+	}
+	if err := database.AddSchedule(s); err != nil {
+		fmt.Fprintf(os.Stderr, "Error adding schedule: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(stdout, "Added schedule %d: %s %s (next run %s)\n",
+		s.ID, s.Spec, s.Source, formatNextRun(spec, time.Now()))
+}
+
+// executeScheduleList prints every schedule with its next and last run
+func executeScheduleList(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	schedules, err := database.ListSchedules()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing schedules: %v\n", err)
+		os.Exit(1)
+	}
+	if len(schedules) == 0 {
+		fmt.Fprintln(stdout, "No schedules. Add one with: archiver schedule add \"0 2 * * *\" --source <path>")
+		return
+	}
+
+	now := time.Now()
+	for _, s := range schedules {
+		next := "invalid schedule"
+		if spec, err := schedule.Parse(s.Spec); err == nil {
+			next = formatNextRun(spec, now)
+		}
+
+		fmt.Fprintf(stdout, "%d  %-16s %s\n", s.ID, s.Spec, s.Source)
+		fmt.Fprintf(stdout, "   summarize: %s  next: %s", s.Summarize, next)
+		if s.LastRun.Valid {
+			fmt.Fprintf(stdout, "  last: %s", s.LastRun.Time.Format("2006-01-02 15:04"))
+			if s.LastError != "" {
+				fmt.Fprintf(stdout, " (failed: %s)", s.LastError)
+			}
+		}
+		fmt.Fprintln(stdout)
+	}
+}
+
+// executeScheduleRemove deletes a schedule by ID
+func executeScheduleRemove(cmd *cobra.Command, args []string) {
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid schedule id %q\n", args[0])
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	if err := database.RemoveSchedule(id); err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing schedule: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(stdout, "Removed schedule %d\n", id)
+}
+
+// executeScheduleDaemon wakes at the start of every minute and runs the
+// schedules that match it
+func executeScheduleDaemon(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Fprintln(stdout, "Scheduler running. Press Ctrl+C to stop.")
+	for {
+		now := time.Now()
+		select {
+		case <-time.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+		case <-ctx.Done():
+			fmt.Fprintln(stdout, "Scheduler stopped.")
+			return
+		}
+
+		// Reload every minute so added and removed schedules take effect
+		tick := time.Now().Truncate(time.Minute)
+		schedules, err := database.ListSchedules()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing schedules: %v\n", err)
+			continue
+		}
+
+		for _, s := range schedules {
+			spec, err := schedule.Parse(s.Spec)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Skipping schedule %d: %v\n", s.ID, err)
+				continue
+			}
+			if !spec.Matches(tick) || ctx.Err() != nil {
+				continue
+			}
+			runSchedule(database, s)
+		}
+	}
+}
+
+// runSchedule runs one scheduled archive and records the outcome
+func runSchedule(database *db.DB, s *db.Schedule) {
+	started := time.Now()
+	fmt.Fprintf(stdout, "\n[%s] Running schedule %d: %s\n", started.Format("2006-01-02 15:04"), s.ID, s.Source)
+
+	err := archiveSource(database, fmt.Sprintf("schedule %d", s.ID), s.Source, s.Summarize, s.IncludeAll)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Schedule %d failed: %v\n", s.ID, err)
+	}
+	if err := database.RecordScheduleRun(s.ID, started, err); err != nil {
+		fmt.Fprintf(os.Stderr, "Error recording run of schedule %d: %v\n", s.ID, err)
+	}
+}
+
+// archiveSource runs the pipeline over a source on behalf of a schedule or
+// a queued job, recording the run with the given command
+func archiveSource(database *db.DB, command, source, level string, all bool) error {
+	// The pipeline reads its settings from the command flags
+	sourcePath, filesFrom = source, ""
+	summarize, includeAll = level, all
+
+	scanner, err := newSourceScanner()
+	if err != nil {
+		return err
+	}
+	defer scanner.Close()
+	if includeAll {
+		scanner.SetPolicy(nil)
+	}
+	return runPipeline(database, scanner, command, source)
+}
+
+// formatNextRun formats the next time spec fires after now
+func formatNextRun(spec *schedule.Spec, now time.Time) string {
+	next := spec.Next(now)
+	if next.IsZero() {
+		return "never"
+	}
+	return next.Format("2006-01-02 15:04")
+}
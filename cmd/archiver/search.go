@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jth/archiver/internal/db"
 	"github.com/spf13/cobra"
@@ -20,6 +27,32 @@ var (
 	sortDesc     bool
 	dbFilePath   string
 	outputFormat string
+	outputFields string
+	snippetCount int
+	snippetSize  int
+	noColor      bool
+	fuzzy        bool
+	fuzziness    int
+	prefix       bool
+
+	filterExt         string
+	filterContentType string
+	filterMinSize     string
+	filterMaxSize     string
+	filterAfter       string
+	filterBefore      string
+	filterDrive       string
+	filterTag         string
+	filterPerson      string
+	filterOrg         string
+	filterPlace       string
+	filterDocType     string
+	filterKeyword     string
+	showFacets        int
+
+	mustClauses   []string
+	shouldClauses []string
+	notClauses    []string
 )
 
 // searchCmd represents the search command
@@ -31,29 +64,127 @@ func newSearchCommand() *cobra.Command {
 Examples:
   archiver search --query "document about finance"
   archiver search --query "image" --field "ContentType" --limit 20
-  archiver search --query "report" --sort-by "ModTime" --sort-desc`,
+  archiver search --query "report" --sort-by "ModTime" --sort-desc
+  archiver search --query "reciepts" --fuzzy --fuzziness 2
+  archiver search --query "vacat" --prefix --field Name
+  archiver search --query "invoice" --ext pdf --after 2015-01-01 --before 2016-01-01
+  archiver search --content-type video/ --min-size 1GB --drive OldDrive
+  archiver search --query "w2" --tag tax
+  archiver search --doc-type invoice --org "Acme Corp" --facets 5
+  archiver search --must 'Name:"tax return"' --must ModTime:2015-01-01..2016-01-01 --not Extension:=.tmp
+  archiver search --should Tags:=tax --should Summary:irs --must Size:..10MB
+  archiver search --ext pdf --format csv --fields path,size,modified > pdfs.csv
+  archiver search --query "tax" --format print0 | xargs -0 ls -l`,
 		Run: executeSearch,
 	}
+	searchCmd.Long += `
+
+Structured queries (--must, --should, --not; each may be repeated):
+  word words      Match all the words, in any field
+  Field:words     Match all the words in Field
+  Field:"words"   Match the words as a phrase
+  Field:=value    Match the exact value of a keyword field (Extension,
+                  ContentType, Drive, Tags, People, DocumentType, ...)
+  Field:pre*      Match a word starting with pre
+  Size:1MB..1GB   Size in a range; either end may be left out
+  ModTime:2015-01-01..2016-01-01
+                  Date in a range, the end exclusive; also UpdatedAt
+Every --must clause has to match and no --not clause may. Without --must, at
+least one --should clause has to match; with it, --should clauses only rank
+matching files higher. Field names are not case sensitive.
+Fields: ` + strings.Join(db.QueryFields, ", ")
 
 	// Add flags
 	searchCmd.Flags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
 	searchCmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
-	searchCmd.Flags().StringVarP(&query, "query", "q", "", "Search query (required)")
+	searchCmd.Flags().StringVarP(&query, "query", "q", "", "Search query (required unless a filter is given)")
 	searchCmd.Flags().StringVarP(&fieldName, "field", "f", "", "Restrict search to this field (e.g., Path, Name, Summary)")
-	searchCmd.Flags().IntVarP(&limit, "limit", "l", 10, "Maximum number of results to return")
+	searchCmd.Flags().IntVarP(&limit, "limit", "l", 10, "Maximum number of results to return (csv, tsv and print0 return them all by default)")
 	searchCmd.Flags().IntVarP(&offset, "offset", "o", 0, "Number of results to skip (for pagination)")
 	searchCmd.Flags().StringVar(&sortBy, "sort-by", "", "Field to sort by (e.g., ModTime, Size, Path)")
 	searchCmd.Flags().BoolVar(&sortDesc, "sort-desc", false, "Sort in descending order")
-	searchCmd.Flags().StringVar(&outputFormat, "format", "text", "Output format: text, json")
+	searchCmd.Flags().StringVar(&outputFormat, "format", "text", "Output format: text, json, csv, tsv, or print0 (NUL-separated paths)")
+	searchCmd.Flags().StringVar(&outputFields, "fields", defaultSearchFields, "Columns for csv and tsv: "+strings.Join(searchFieldNames(), ", "))
+	searchCmd.Flags().BoolVar(&fuzzy, "fuzzy", false, "Match terms approximately, tolerating typos")
+	searchCmd.Flags().IntVar(&fuzziness, "fuzziness", 1, "Maximum edit distance per term for --fuzzy (1 or 2)")
+	searchCmd.Flags().BoolVar(&prefix, "prefix", false, "Match terms by prefix, for truncated names")
+	searchCmd.MarkFlagsMutuallyExclusive("fuzzy", "prefix")
+	searchCmd.Flags().IntVar(&snippetCount, "snippets", 3, "Number of highlighted snippets to show per result")
+	searchCmd.Flags().IntVar(&snippetSize, "snippet-size", 150, "Length of each snippet in characters")
+	searchCmd.Flags().BoolVar(&noColor, "no-color", false, "Do not colorize matched terms")
 
-	// Mark required flags
-	searchCmd.MarkFlagRequired("query")
+	// Filters
+	searchCmd.Flags().StringVar(&filterExt, "ext", "", "Only files with this extension (e.g., pdf)")
+	searchCmd.Flags().StringVar(&filterContentType, "content-type", "", "Only files whose content type starts with this (e.g., video/)")
+	searchCmd.Flags().StringVar(&filterMinSize, "min-size", "", "Minimum file size (e.g., 500KB, 1GB)")
+	searchCmd.Flags().StringVar(&filterMaxSize, "max-size", "", "Maximum file size (e.g., 500KB, 1GB)")
+	searchCmd.Flags().StringVar(&filterAfter, "after", "", "Only files modified on or after this date (YYYY-MM-DD)")
+	searchCmd.Flags().StringVar(&filterBefore, "before", "", "Only files modified before this date (YYYY-MM-DD)")
+	searchCmd.Flags().StringVar(&filterDrive, "drive", "", "Only files scanned from this drive")
+	searchCmd.Flags().StringVar(&filterTag, "tag", "", "Only files with this tag")
+	searchCmd.Flags().StringVar(&filterPerson, "person", "", "Only documents mentioning this person")
+	searchCmd.Flags().StringVar(&filterOrg, "org", "", "Only documents mentioning this organization")
+	searchCmd.Flags().StringVar(&filterPlace, "place", "", "Only documents mentioning this place")
+	searchCmd.Flags().StringVar(&filterDocType, "doc-type", "", "Only documents of this type (e.g., invoice, letter)")
+	searchCmd.Flags().StringVar(&filterKeyword, "keyword", "", "Only documents with this keyword")
+	searchCmd.Flags().StringArrayVar(&mustClauses, "must", nil, "Clause every result has to match (see above)")
+	searchCmd.Flags().StringArrayVar(&shouldClauses, "should", nil, "Clause results should match, ranked higher if they do")
+	searchCmd.Flags().StringArrayVar(&notClauses, "not", nil, "Clause no result may match")
+	searchCmd.Flags().IntVar(&showFacets, "facets", 0, "Also list the n most common people, organizations, places, dates, types and keywords of all matches")
 
 	return searchCmd
 }
 
 // executeSearch performs the search operation
 func executeSearch(cmd *cobra.Command, args []string) {
+	if !slices.Contains([]string{"text", "json", "csv", "tsv", "print0"}, outputFormat) {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected text, json, csv, tsv or print0)\n", outputFormat)
+		os.Exit(1)
+	}
+	fields, err := parseSearchFields(outputFields)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Create the search request
+	request := db.SearchRequest{
+		Query:       query,
+		FieldName:   fieldName,
+		Limit:       limit,
+		Offset:      offset,
+		SortBy:      sortBy,
+		SortDesc:    sortDesc,
+		Fuzzy:       fuzzy,
+		Fuzziness:   fuzziness,
+		Prefix:      prefix,
+		Snippets:    snippetCount,
+		SnippetSize: snippetSize,
+		Colorize:    outputFormat == "text" && !noColor && isTerminal(os.Stdout),
+		Extension:   filterExt,
+		ContentType: filterContentType,
+		Drive:       filterDrive,
+		Tag:         filterTag,
+
+		Person:       filterPerson,
+		Organization: filterOrg,
+		Place:        filterPlace,
+		DocumentType: filterDocType,
+		Keyword:      filterKeyword,
+	}
+	if err = parseFilters(&request); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if request.Boolean, err = parseBooleanQuery(mustClauses, shouldClauses, notClauses); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if query == "" && !hasFilters(request) && request.Boolean.Empty() {
+		fmt.Fprintln(os.Stderr, "Error: --query, --must, --should or at least one filter is required")
+		os.Exit(1)
+	}
+
 	// Create a database connection
 	database, err := db.Open(dbFilePath)
 	if err != nil {
@@ -66,6 +197,7 @@ func executeSearch(cmd *cobra.Command, args []string) {
 	config := db.IndexConfig{
 		IndexDir:       indexDir,
 		IndexSummaries: true,
+		IndexContent:   true,
 	}
 
 	// Create the indexer
@@ -76,32 +208,234 @@ func executeSearch(cmd *cobra.Command, args []string) {
 	}
 	defer indexer.Close()
 
-	// Create the search request
-	request := db.SearchRequest{
-		Query:     query,
-		FieldName: fieldName,
-		Limit:     limit,
-		Offset:    offset,
-		SortBy:    sortBy,
-		SortDesc:  sortDesc,
+	// Catch up with changes made by commands that don't index
+	if _, err := indexer.Sync(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: the search index may be out of date: %v\n", err)
 	}
 
-	// Perform the search
-	results, err := indexer.Search(request)
+	// Perform the search. Output piped to other tools gets every match
+	// unless --limit says otherwise, so that none are silently left out.
+	var results []db.SearchResult
+	if machineReadable := outputFormat == "csv" || outputFormat == "tsv" || outputFormat == "print0"; machineReadable && !cmd.Flags().Changed("limit") {
+		results, err = searchAll(indexer, request)
+	} else {
+		results, err = indexer.Search(request)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error searching: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Output the results
-	if outputFormat == "json" {
+	switch outputFormat {
+	case "json":
 		outputJSON(results)
-	} else {
+	case "csv":
+		outputDelimited(os.Stdout, results, fields, ',')
+		return
+	case "tsv":
+		outputDelimited(os.Stdout, results, fields, '\t')
+		return
+	case "print0":
+		outputPrint0(os.Stdout, results)
+		return
+	default:
 		outputText(results, query)
 	}
 
 	// Print summary
-	fmt.Printf("\nFound %d results for query: %s\n", len(results), query)
+	if query != "" {
+		fmt.Printf("\nFound %d results for query: %s\n", len(results), query)
+	} else {
+		fmt.Printf("\nFound %d results\n", len(results))
+	}
+
+	if showFacets > 0 {
+		facets, err := indexer.Facets(request, showFacets)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error computing facets: %v\n", err)
+			os.Exit(1)
+		}
+		printFacets(facets)
+	}
+}
+
+// searchPageSize is how many results searchAll fetches at a time
+const searchPageSize = 1000
+
+// searchAll returns every result of a request from its offset on, fetching
+// them a page at a time
+func searchAll(indexer *db.BleveIndexer, request db.SearchRequest) ([]db.SearchResult, error) {
+	var results []db.SearchResult
+	request.Limit = searchPageSize
+	for {
+		page, err := indexer.Search(request)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, page...)
+		if len(page) < searchPageSize {
+			return results, nil
+		}
+		request.Offset += searchPageSize
+	}
+}
+
+// printFacets lists the most common values of each facet with any
+func printFacets(facets map[string][]db.FacetCount) {
+	for _, field := range db.FacetFields {
+		if len(facets[field]) == 0 {
+			continue
+		}
+		values := make([]string, len(facets[field]))
+		for i, facet := range facets[field] {
+			values[i] = fmt.Sprintf("%s (%d)", facet.Value, facet.Count)
+		}
+		fmt.Printf("%s: %s\n", field, strings.Join(values, ", "))
+	}
+}
+
+// parseFilters parses the size and date filter flags into the request
+func parseFilters(request *db.SearchRequest) error {
+	var err error
+	if filterMinSize != "" {
+		if request.MinSize, err = parseSize(filterMinSize); err != nil {
+			return fmt.Errorf("invalid --min-size: %w", err)
+		}
+	}
+	if filterMaxSize != "" {
+		if request.MaxSize, err = parseSize(filterMaxSize); err != nil {
+			return fmt.Errorf("invalid --max-size: %w", err)
+		}
+	}
+	if filterAfter != "" {
+		if request.After, err = time.ParseInLocation("2006-01-02", filterAfter, time.Local); err != nil {
+			return fmt.Errorf("invalid --after date: %w", err)
+		}
+	}
+	if filterBefore != "" {
+		if request.Before, err = time.ParseInLocation("2006-01-02", filterBefore, time.Local); err != nil {
+			return fmt.Errorf("invalid --before date: %w", err)
+		}
+	}
+	return nil
+}
+
+// hasFilters reports whether any filter is set on the request
+func hasFilters(request db.SearchRequest) bool {
+	return request.Extension != "" || request.ContentType != "" || request.Drive != "" ||
+		request.Tag != "" || request.Person != "" || request.Organization != "" || request.Place != "" ||
+		request.DocumentType != "" || request.Keyword != "" || request.MinSize > 0 || request.MaxSize > 0 ||
+		!request.After.IsZero() || !request.Before.IsZero()
+}
+
+// parseBooleanQuery parses the clauses of the --must, --should and --not flags
+func parseBooleanQuery(must, should, not []string) (db.BooleanQuery, error) {
+	var booleanQuery db.BooleanQuery
+	for _, group := range []struct {
+		flag    string
+		values  []string
+		clauses *[]db.Clause
+	}{
+		{"--must", must, &booleanQuery.Must},
+		{"--should", should, &booleanQuery.Should},
+		{"--not", not, &booleanQuery.Not},
+	} {
+		for _, value := range group.values {
+			clause, err := parseClause(value)
+			if err != nil {
+				return booleanQuery, fmt.Errorf("invalid %s %q: %w", group.flag, value, err)
+			}
+			*group.clauses = append(*group.clauses, clause)
+		}
+	}
+	return booleanQuery, nil
+}
+
+// parseClause parses a structured query clause such as Name:report,
+// Summary:"tax return", Tags:=tax, Name:vacat*, Size:1MB..1GB or
+// ModTime:2015-01-01..2016-01-01. Text before a colon that is not an index
+// field is part of the value.
+func parseClause(value string) (db.Clause, error) {
+	clause := db.Clause{Kind: db.ClauseMatch, Value: strings.TrimSpace(value)}
+	if name, rest, ok := strings.Cut(clause.Value, ":"); ok {
+		for _, field := range db.QueryFields {
+			if strings.EqualFold(name, field) {
+				clause.Field, clause.Value = field, strings.TrimSpace(rest)
+				break
+			}
+		}
+	}
+
+	switch {
+	case clause.Field == "Size":
+		low, high, ok := strings.Cut(clause.Value, "..")
+		if !ok {
+			return clause, fmt.Errorf("expected a range like Size:1MB..1GB")
+		}
+		var err error
+		clause.Kind = db.ClauseSizeRange
+		if low != "" {
+			if clause.Min, err = parseSize(low); err != nil {
+				return clause, err
+			}
+		}
+		if high != "" {
+			if clause.Max, err = parseSize(high); err != nil {
+				return clause, err
+			}
+		}
+	case clause.Field == "ModTime" || clause.Field == "UpdatedAt":
+		start, end, ok := strings.Cut(clause.Value, "..")
+		if !ok {
+			return clause, fmt.Errorf("expected a range like %s:2015-01-01..2016-01-01", clause.Field)
+		}
+		var err error
+		clause.Kind = db.ClauseDateRange
+		if start != "" {
+			if clause.Start, err = time.ParseInLocation("2006-01-02", start, time.Local); err != nil {
+				return clause, fmt.Errorf("invalid date %q", start)
+			}
+		}
+		if end != "" {
+			if clause.End, err = time.ParseInLocation("2006-01-02", end, time.Local); err != nil {
+				return clause, fmt.Errorf("invalid date %q", end)
+			}
+		}
+	case len(clause.Value) >= 2 && strings.HasPrefix(clause.Value, `"`) && strings.HasSuffix(clause.Value, `"`):
+		clause.Kind = db.ClausePhrase
+		clause.Value = clause.Value[1 : len(clause.Value)-1]
+	case strings.HasPrefix(clause.Value, "=") && clause.Field != "":
+		clause.Kind = db.ClauseTerm
+		clause.Value = strings.TrimPrefix(clause.Value, "=")
+	case strings.HasSuffix(clause.Value, "*") && !strings.ContainsAny(clause.Value, " \t"):
+		clause.Kind = db.ClausePrefix
+		clause.Value = strings.TrimSuffix(clause.Value, "*")
+	}
+
+	if clause.Value == "" && clause.Kind != db.ClauseSizeRange && clause.Kind != db.ClauseDateRange {
+		return clause, fmt.Errorf("nothing to match")
+	}
+	return clause, nil
+}
+
+// parseSize parses a human-readable size such as "500", "10KB" or "1.5G"
+// using binary units, matching formatSize
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	number := strings.TrimRight(strings.TrimSuffix(value, "B"), "KMGTPE")
+	unit := strings.TrimSuffix(strings.TrimPrefix(value, number), "B")
+
+	size, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || size < 0 || len(unit) > 1 {
+		return 0, fmt.Errorf("cannot parse size %q", value)
+	}
+	if unit != "" {
+		for i := 0; i <= strings.Index("KMGTPE", unit); i++ {
+			size *= 1024
+		}
+	}
+	return int64(size), nil
 }
 
 // outputText prints search results in text format
@@ -134,11 +468,22 @@ func outputText(results []db.SearchResult, searchQuery string) {
 
 		// Print result header
 		fmt.Printf("\n%d. [%s] %s (%.2f)\n", i+1, typeIndicator, displayPath, result.Score)
-		fmt.Printf("   Size: %s | Modified: %s\n", size, timeStr)
+		if pages, ok := result.Metadata["Pages"].(float64); ok && pages > 0 {
+			fmt.Printf("   Size: %s | Modified: %s | Pages: %d\n", size, timeStr, int(pages))
+		} else {
+			fmt.Printf("   Size: %s | Modified: %s\n", size, timeStr)
+		}
 
-		// Print snippet if available
-		if result.Snippet != "" {
-			fmt.Printf("   %s\n", result.Snippet)
+		// Print snippets if available
+		for _, snippet := range result.Snippets {
+			fmt.Printf("   …%s…\n", strings.Join(strings.Fields(snippet), " "))
+		}
+		switch len(result.Pages) {
+		case 0:
+		case 1:
+			fmt.Printf("   Match on page %d\n", result.Pages[0])
+		default:
+			fmt.Printf("   Matches on pages %s\n", formatPages(result.Pages, ", "))
 		}
 
 		// Print metadata if available and relevant
@@ -165,6 +510,137 @@ func outputJSON(results []db.SearchResult) {
 	fmt.Println(string(jsonData))
 }
 
+// defaultSearchFields are the columns of csv and tsv output unless --fields
+// says otherwise
+const defaultSearchFields = "path,size,modified,type"
+
+// searchFields are the columns csv and tsv output can have
+var searchFields = map[string]func(db.SearchResult) string{
+	"id":       func(r db.SearchResult) string { return r.ID },
+	"path":     func(r db.SearchResult) string { return r.Path },
+	"name":     func(r db.SearchResult) string { return filepath.Base(r.Path) },
+	"size":     func(r db.SearchResult) string { return strconv.FormatInt(r.Size, 10) },
+	"modified": func(r db.SearchResult) string { return r.ModTime.Format(time.RFC3339) },
+	"score":    func(r db.SearchResult) string { return strconv.FormatFloat(r.Score, 'f', 4, 64) },
+	"snippet":  func(r db.SearchResult) string { return strings.Join(strings.Fields(r.Snippet), " ") },
+	"dir":      func(r db.SearchResult) string { return strconv.FormatBool(r.IsDir) },
+	"type":     func(r db.SearchResult) string { return metadataString(r, "ContentType") },
+	"drive":    func(r db.SearchResult) string { return metadataString(r, "Drive") },
+	"url":      func(r db.SearchResult) string { return metadataString(r, "UploadedURL") },
+	"summary":  func(r db.SearchResult) string { return metadataString(r, "Summary") },
+	"pages":    func(r db.SearchResult) string { return formatPages(r.Pages, "; ") },
+}
+
+// maxListedPages caps how many matching pages are listed per result
+const maxListedPages = 20
+
+// formatPages lists page numbers with a separator, the first
+// maxListedPages of them only
+func formatPages(pages []int, separator string) string {
+	listed := make([]string, 0, len(pages))
+	for i, page := range pages {
+		if i == maxListedPages {
+			listed = append(listed, fmt.Sprintf("and %d more", len(pages)-i))
+			break
+		}
+		listed = append(listed, strconv.Itoa(page))
+	}
+	return strings.Join(listed, separator)
+}
+
+// searchFieldNames returns the names of the csv and tsv columns, sorted
+func searchFieldNames() []string {
+	names := make([]string, 0, len(searchFields))
+	for name := range searchFields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// parseSearchFields parses a comma-separated list of column names
+func parseSearchFields(list string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		if searchFields[field] == nil {
+			return nil, fmt.Errorf("unknown field %q (expected %s)", field, strings.Join(searchFieldNames(), ", "))
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("--fields needs at least one field")
+	}
+	return fields, nil
+}
+
+// metadataString returns a stored index field of a result as a string,
+// joining fields with several values
+func metadataString(result db.SearchResult, field string) string {
+	switch value := result.Metadata[field].(type) {
+	case string:
+		return value
+	case []interface{}:
+		values := make([]string, len(value))
+		for i, v := range value {
+			values[i] = fmt.Sprint(v)
+		}
+		return strings.Join(values, "; ")
+	}
+	return ""
+}
+
+// outputDelimited prints search results as CSV, or as TSV when separator
+// is a tab, with a header row naming the fields. TSV values have their
+// tabs and line breaks replaced with spaces instead of being quoted.
+func outputDelimited(w io.Writer, results []db.SearchResult, fields []string, separator rune) {
+	rows := [][]string{fields}
+	for _, result := range results {
+		row := make([]string, len(fields))
+		for i, field := range fields {
+			row[i] = searchFields[field](result)
+		}
+		rows = append(rows, row)
+	}
+
+	if separator == '\t' {
+		breaks := func(r rune) bool { return r == '\t' || r == '\n' || r == '\r' }
+		for _, row := range rows {
+			for i, value := range row {
+				row[i] = strings.Join(strings.FieldsFunc(value, breaks), " ")
+			}
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		return
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = separator
+	if err := writer.WriteAll(rows); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+	}
+}
+
+// outputPrint0 prints the paths of search results, each followed by a NUL
+// byte, for xargs -0
+func outputPrint0(w io.Writer, results []db.SearchResult) {
+	for _, result := range results {
+		fmt.Fprint(w, result.Path, "\x00")
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0 && os.Getenv("NO_COLOR") == ""
+}
+
 // formatSize formats file size in human-readable format
 func formatSize(size int64) string {
 	const unit = 1024
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+func TestParseSearchFields(t *testing.T) {
+	fields, err := parseSearchFields(" Path, size,,type ")
+	if err != nil {
+		t.Fatalf("parseSearchFields: %v", err)
+	}
+	if got := strings.Join(fields, ","); got != "path,size,type" {
+		t.Errorf("fields = %q, want path,size,type", got)
+	}
+
+	if _, err := parseSearchFields("path,colour"); err == nil || !strings.Contains(err.Error(), `"colour"`) {
+		t.Errorf("unknown field: err = %v, want it named", err)
+	}
+	for _, list := range []string{"", " , ,"} {
+		if _, err := parseSearchFields(list); err == nil {
+			t.Errorf("parseSearchFields(%q) = nil error, want one for an empty list", list)
+		}
+	}
+}
+
+var delimitedResults = []db.SearchResult{
+	{Path: "/docs/plain.txt", Size: 12, ModTime: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+	{Path: "/docs/a, \"quoted\"\tname.txt", Size: 7, Metadata: map[string]interface{}{"Summary": "first line\nsecond\tline"}},
+}
+
+func TestOutputDelimitedCSV(t *testing.T) {
+	var out bytes.Buffer
+	outputDelimited(&out, delimitedResults, []string{"path", "size", "summary"}, ',')
+
+	want := "path,size,summary\n" +
+		"/docs/plain.txt,12,\n" +
+		"\"/docs/a, \"\"quoted\"\"\tname.txt\",7,\"first line\nsecond\tline\"\n"
+	if out.String() != want {
+		t.Errorf("csv output =\n%q\nwant\n%q", out.String(), want)
+	}
+}
+
+func TestOutputDelimitedTSV(t *testing.T) {
+	var out bytes.Buffer
+	outputDelimited(&out, delimitedResults, []string{"path", "modified", "summary"}, '\t')
+
+	want := "path\tmodified\tsummary\n" +
+		"/docs/plain.txt\t2024-03-01T12:00:00Z\t\n" +
+		"/docs/a, \"quoted\" name.txt\t0001-01-01T00:00:00Z\tfirst line second line\n"
+	if out.String() != want {
+		t.Errorf("tsv output =\n%q\nwant\n%q", out.String(), want)
+	}
+}
+
+func TestOutputPrint0(t *testing.T) {
+	var out bytes.Buffer
+	outputPrint0(&out, delimitedResults)
+
+	want := "/docs/plain.txt\x00/docs/a, \"quoted\"\tname.txt\x00"
+	if out.String() != want {
+		t.Errorf("print0 output = %q, want %q", out.String(), want)
+	}
+}
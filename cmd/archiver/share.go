@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/config"
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	shareExpires   string
+	shareTo        string
+	shareList      bool
+	shareRevokeAll bool
+)
+
+// newShareCommand creates a command that hands out expiring links to
+// uploaded files
+func newShareCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "share [file]",
+		Short: "Print an expiring link to an uploaded file in a private bucket",
+		Long: `Print a link that downloads an uploaded file from a private bucket without
+credentials until it expires (at most 7 days, B2's limit). The file is named by
+its catalog ID or path. Each link is recorded with who it was for, who shared
+it and when it expires; --list shows them. The link itself is not kept.
+
+Links are signed with a sharing key that can only read and share the files of
+the bucket. The first share creates it and saves it in the config file as
+b2_share_key_id and b2_share_app_key, which needs the writeKeys capability.
+--revoke-all replaces it with a new key and deletes the old one in B2 (with
+the deleteKeys capability), so every link handed out so far stops working.
+Files encrypted with SSE-C can't be shared, as downloads need the key.
+Examples:
+  archiver share 1234 --expires 7d --to "Aunt May"
+  archiver share /Volumes/OldDrive/Video/wedding.mts --expires 12h
+  archiver share --list
+  archiver share --revoke-all`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  executeShare,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&shareExpires, "expires", "7d", "How long the link works, in days (7d) or as a duration (12h)")
+	cmd.Flags().StringVar(&shareTo, "to", "", "Who the link is for, as recorded")
+	cmd.Flags().BoolVar(&shareList, "list", false, "List the links handed out, or those of the file")
+	cmd.Flags().BoolVar(&shareRevokeAll, "revoke-all", false, "Replace the sharing key, revoking every link handed out")
+
+	return cmd
+}
+
+// executeShare prints a link to the file, lists the links or revokes them
+func executeShare(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	var file *db.FileStatus
+	if len(args) == 1 {
+		if file, err = shareFile(database, args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	switch {
+	case shareList:
+		listShares(database, file)
+		return
+	case shareRevokeAll:
+		revokeShares(database)
+		return
+	case file == nil:
+		fmt.Fprintln(os.Stderr, "Error: name the file to share, or use --list or --revoke-all")
+		os.Exit(1)
+	case file.UploadedURL == "":
+		fmt.Fprintf(os.Stderr, "Error: %s has not been uploaded\n", file.Path)
+		os.Exit(1)
+	}
+
+	expires, err := parseExpiry(shareExpires)
+	if err == nil && expires > upload.MaxStreamDuration {
+		err = fmt.Errorf("links can't last longer than %d days", int(upload.MaxStreamDuration.Hours()/24))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := checkShareConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	if appConfig.B2ShareKeyID == "" {
+		if err := replaceShareKey(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating the sharing key: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	signer, err := upload.NewB2Uploader(upload.B2Config{
+		KeyID:      appConfig.B2ShareKeyID,
+		AppKey:     appConfig.B2ShareAppKey,
+		BucketName: appConfig.B2Bucket,
+		Concurrent: 1,
+		Logger:     logger,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+		os.Exit(1)
+	}
+	defer signer.Close()
+
+	link, err := signer.StreamURL(ctx, file.UploadedURL, expires)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error signing the link: %v\n", err)
+		os.Exit(1)
+	}
+	share := &db.Share{
+		FileID:     file.ID,
+		SharedWith: shareTo,
+		SharedBy:   currentUser(),
+		KeyID:      appConfig.B2ShareKeyID,
+		ExpiresAt:  time.Now().Add(expires),
+	}
+	if err := database.RecordShare(share); err != nil {
+		fmt.Fprintf(os.Stderr, "Error recording the share: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Link to %s, valid until %s:\n", file.Path, share.ExpiresAt.Format("2006-01-02 15:04"))
+	fmt.Println(link)
+}
+
+// shareFile finds the file to share by catalog ID or path
+func shareFile(database *db.DB, arg string) (*db.FileStatus, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		file, err := database.GetFileByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil && !file.DeletedAt.Valid {
+			return file, nil
+		}
+	}
+	return catalogFile(database, arg, false)
+}
+
+// parseExpiry parses a number of days such as 7d, or a Go duration
+func parseExpiry(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid expiry %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid expiry %q (expected e.g. 7d or 12h)", value)
+	}
+	return d, nil
+}
+
+// checkShareConfig checks that links can be signed and the sharing key kept
+func checkShareConfig() error {
+	if err := appConfig.Validate(); err != nil {
+		return err
+	}
+	if appConfig.B2Encryption == upload.EncryptionCustomer {
+		return fmt.Errorf("files encrypted with %s can't be shared by link", upload.EncryptionCustomer)
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		return fmt.Errorf("the sharing key is kept in the config file, and %s doesn't exist (archiver config init creates it)", configPath)
+	}
+	return nil
+}
+
+// replaceShareKey creates a sharing key and saves it in the config file in
+// place of the current one
+func replaceShareKey(ctx context.Context) error {
+	uploader, err := newUploader()
+	if err != nil {
+		return err
+	}
+	defer uploader.Close()
+
+	key, err := uploader.CreateShareKey(ctx)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.LoadFromFile(configPath)
+	if err != nil {
+		return err
+	}
+	cfg.B2ShareKeyID, cfg.B2ShareAppKey = key.KeyID, key.AppKey
+	if err := cfg.SaveToFile(configPath); err != nil {
+		return err
+	}
+	appConfig.B2ShareKeyID, appConfig.B2ShareAppKey = key.KeyID, key.AppKey
+	return nil
+}
+
+// revokeShares replaces the sharing key and deletes the old one, so the
+// links it signed stop working
+func revokeShares(database *db.DB) {
+	if err := checkShareConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(1)
+	}
+	ctx := context.Background()
+	old := appConfig.B2ShareKeyID
+	if err := replaceShareKey(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating the sharing key: %v\n", err)
+		os.Exit(1)
+	}
+	if old == "" {
+		fmt.Println("Created a sharing key; no links had been handed out.")
+		return
+	}
+
+	uploader, err := newUploader()
+	if err == nil {
+		err = uploader.DeleteKey(ctx, old)
+		uploader.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error deleting the old sharing key %s, its links still work: %v\n", old, err)
+		os.Exit(1)
+	}
+	revoked, err := database.RevokeShares(old)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error recording the revocation: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Replaced the sharing key; %d unexpired link(s) no longer work.\n", revoked)
+}
+
+// listShares prints the links handed out for file, or for every file
+func listShares(database *db.DB, file *db.FileStatus) {
+	var fileID int64
+	if file != nil {
+		fileID = file.ID
+	}
+	shares, err := database.GetShares(fileID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing shares: %v\n", err)
+		os.Exit(1)
+	}
+	if len(shares) == 0 {
+		fmt.Println("No links handed out.")
+		return
+	}
+
+	now := time.Now()
+	for _, share := range shares {
+		status := "active until " + share.ExpiresAt.Format("2006-01-02 15:04")
+		switch {
+		case share.RevokedAt.Valid:
+			status = "revoked " + share.RevokedAt.Time.Format("2006-01-02 15:04")
+		case !share.Active(now):
+			status = "expired " + share.ExpiresAt.Format("2006-01-02 15:04")
+		}
+		to := share.SharedWith
+		if to == "" {
+			to = "(unnamed)"
+		}
+		fmt.Printf("%s  %s  to %s by %s, %s\n", share.CreatedAt.Format("2006-01-02 15:04"), share.Path, to, share.SharedBy, status)
+	}
+}
+
+// currentUser returns the name of the user running the command
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/manifest"
+	"github.com/jth/archiver/internal/site"
+	"github.com/spf13/cobra"
+)
+
+var (
+	siteTitle    string
+	sitePageSize int
+	siteWhere    string
+	siteStream   time.Duration
+	sitePrivate  bool
+)
+
+// newExportSiteCommand creates a command that exports a static catalog browser
+func newExportSiteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export-site",
+		Short: "Export a static, browsable catalog for hosting without a backend",
+		Long: `Export the catalog as a static site: paginated HTML pages linking to the
+uploaded files, plus the same pages as JSON for other tools. The directory can
+be hosted on any static file host, or opened from disk, as a read-only archive
+browser. Only uploaded files are included unless --all is set.
+
+The site is meant to be shared, so it shows each file's path within its source
+rather than where it is on this machine, and leaves out the summaries, which
+can quote private documents. --private keeps both, for a site only you see.
+
+With --stream-for, videos get a player on the page that streams them from B2
+through a URL valid for that long (at most 7 days); after that the site has to
+be exported again for the players to work.
+Examples:
+  archiver export-site --output ./site --title "Family Archive"
+  archiver export-site --output ./videos --content-type video/ --stream-for 72h
+  archiver export-site --output ./photos --content-type image/ --tag family
+  archiver export-site --output ./docs --where "path LIKE '%/Documents/%'"
+  archiver export-site --output ./mine --private`,
+		Run: executeExportSite,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Directory to write the site to (required)")
+	cmd.Flags().StringVar(&siteTitle, "title", "Archive", "Title shown on the pages")
+	cmd.Flags().IntVar(&sitePageSize, "page-size", site.DefaultPageSize, "Files per page")
+	cmd.Flags().BoolVar(&exportAll, "all", false, "Include files that have not been uploaded yet")
+	cmd.Flags().StringVar(&filterExt, "ext", "", "Only files with this extension")
+	cmd.Flags().StringVar(&filterContentType, "content-type", "", "Only files whose content type starts with this (e.g., image/)")
+	cmd.Flags().StringVar(&filterTag, "tag", "", "Only files with this tag")
+	cmd.Flags().StringVar(&siteWhere, "where", "", "SQL filter over the catalog columns selecting the files")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Bucket namespace recorded in the catalog (default: from config)")
+	cmd.Flags().DurationVar(&siteStream, "stream-for", 0, "Embed video players using streaming URLs valid this long (e.g. 72h)")
+	cmd.Flags().BoolVar(&sitePrivate, "private", false, "Keep the full paths and the summaries instead of paths within the source only")
+	cmd.MarkFlagRequired("output")
+
+	return cmd
+}
+
+// executeExportSite writes the filtered catalog as a static site
+func executeExportSite(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	namespace := appConfig.B2Bucket
+	if cmd.Flags().Changed("bucket") {
+		namespace = bucket
+	}
+	opts := site.Options{
+		Title:    siteTitle,
+		PageSize: sitePageSize,
+		Header:   manifest.NewHeader(namespace),
+		Private:  sitePrivate,
+	}
+
+	if siteStream > 0 {
+		if err := appConfig.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+			os.Exit(1)
+		}
+		uploader, err := newUploader()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+			os.Exit(1)
+		}
+		defer uploader.Close()
+
+		opts.StreamURL = func(entry manifest.Entry) (string, error) {
+			// Files uploaded to another bucket keep a plain link
+			if _, err := uploader.RemoteName(entry.UploadedURL); err != nil {
+				return "", nil
+			}
+			return uploader.StreamURL(context.Background(), entry.UploadedURL, siteStream)
+		}
+	}
+
+	writer, err := site.NewWriter(exportOutput, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	count := 0
+	write := func(file *db.FileStatus) error {
+		if !matchesSiteFilters(file) {
+			return nil
+		}
+		entry := manifest.EntryFromFile(file)
+		tags, err := database.GetTags(file.ID)
+		if err != nil {
+			return err
+		}
+		if filterTag != "" && !containsTag(tags, filterTag) {
+			return nil
+		}
+		entry.Tags = tags
+		count++
+		return writer.Write(entry)
+	}
+
+	if siteWhere != "" {
+		var files []*db.FileStatus
+		files, err = database.FindFiles(siteWhere)
+		for i := 0; err == nil && i < len(files); i++ {
+			err = write(files[i])
+		}
+	} else {
+		err = database.ForEachFile(!exportAll, write)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing site: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Exported %d files to %s\n", count, filepath.Join(exportOutput, "index.html"))
+}
+
+// matchesSiteFilters applies the upload, extension and content type filters
+func matchesSiteFilters(file *db.FileStatus) bool {
+	if !exportAll && file.UploadedURL == "" {
+		return false
+	}
+	if filterExt != "" && !strings.EqualFold(strings.TrimPrefix(filepath.Ext(file.Path), "."), strings.TrimPrefix(filterExt, ".")) {
+		return false
+	}
+	if filterContentType != "" && !strings.HasPrefix(file.ContentType, filterContentType) {
+		return false
+	}
+	return true
+}
+
+// containsTag reports whether tags contains tag
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
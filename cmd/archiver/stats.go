@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/stats"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsBy       []string
+	statsFormat   string
+	statsUnder    string
+	statsDepth    int
+	statsLimit    int
+	statsUploaded bool
+)
+
+// newStatsCommand creates a command that reports disk usage of the catalog
+func newStatsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Report the size of the archive by extension, type, directory, year and drive",
+		Long: `Total the files in the catalog, counts and bytes, by extension, content type,
+directory, modification year and drive, largest first. Deleted files are left
+out.
+
+Directories are totalled --depth levels below the root, or below --under,
+which also limits the report to that subtree: raise the depth or move
+--under down to drill into the biggest directories.
+Examples:
+  archiver stats
+  archiver stats --by directory --under /Volumes/OldDrive --depth 1
+  archiver stats --uploaded --format csv > usage.csv`,
+		Run: executeStats,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringSliceVar(&statsBy, "by", stats.Dimensions, "Dimensions to report: "+strings.Join(stats.Dimensions, ", "))
+	cmd.Flags().StringVar(&statsFormat, "format", "text", "Output format: text, json, or csv")
+	cmd.Flags().StringVar(&statsUnder, "under", "", "Only count files under this directory")
+	cmd.Flags().IntVar(&statsDepth, "depth", 3, "Directory levels to total at")
+	cmd.Flags().IntVarP(&statsLimit, "limit", "l", 15, "Rows per dimension in text output (0 for all)")
+	cmd.Flags().BoolVar(&statsUploaded, "uploaded", false, "Only count files that have been uploaded")
+
+	return cmd
+}
+
+// executeStats totals the catalog and prints the report
+func executeStats(cmd *cobra.Command, args []string) {
+	for _, dim := range statsBy {
+		if !slices.Contains(stats.Dimensions, dim) {
+			fmt.Fprintf(os.Stderr, "Error: unknown dimension %q (expected %s)\n", dim, strings.Join(stats.Dimensions, ", "))
+			os.Exit(1)
+		}
+	}
+	if statsFormat != "text" && statsFormat != "json" && statsFormat != "csv" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected text, json, or csv)\n", statsFormat)
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	collector := stats.NewCollector(stats.Options{Under: statsUnder, Depth: statsDepth})
+	err = database.ForEachFile(statsUploaded, func(file *db.FileStatus) error {
+		collector.Add(file)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading the catalog: %v\n", err)
+		os.Exit(1)
+	}
+	report := collector.Report()
+
+	switch statsFormat {
+	case "json":
+		err = stats.WriteJSON(os.Stdout, report, statsBy)
+	case "csv":
+		err = stats.WriteCSV(os.Stdout, report, statsBy)
+	default:
+		err = stats.WriteText(os.Stdout, report, statsBy, statsLimit)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing the report: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var streamExpires time.Duration
+
+// newStreamURLCommand creates a command that prints a streaming URL
+func newStreamURLCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stream-url <file>",
+		Short: "Print a time-limited URL for playing an archived file from B2",
+		Long: `Print a URL that plays or downloads an uploaded file straight from B2 without
+credentials until it expires. Browsers and media players seek in it with range
+requests, so a video plays without downloading it first. The file is named by
+its catalog path.
+Examples:
+  archiver stream-url /Volumes/OldDrive/Video/wedding.mts
+  mpv "$(archiver stream-url /Volumes/OldDrive/Video/wedding.mts --expires 10m)"`,
+		Args: cobra.ExactArgs(1),
+		Run:  executeStreamURL,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Backblaze B2 bucket name (default: from config)")
+	cmd.Flags().DurationVar(&streamExpires, "expires", time.Hour, "How long the URL stays valid (at most 7 days)")
+
+	return cmd
+}
+
+// executeStreamURL authorizes one file for streaming and prints its URL
+func executeStreamURL(cmd *cobra.Command, args []string) {
+	if cmd.Flags().Changed("bucket") {
+		appConfig.B2Bucket = bucket
+	}
+	if err := appConfig.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	file, err := catalogFile(database, args[0], false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if file.UploadedURL == "" {
+		fmt.Fprintf(os.Stderr, "Error: %s has not been uploaded\n", file.Path)
+		os.Exit(1)
+	}
+
+	uploader, err := newUploader()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+		os.Exit(1)
+	}
+	defer uploader.Close()
+
+	streamURL, err := uploader.StreamURL(context.Background(), file.UploadedURL, streamExpires)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(streamURL)
+}
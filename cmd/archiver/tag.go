@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/spf13/cobra"
+)
+
+// newTagCommand creates the command group for tagging single files
+func newTagCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tag",
+		Short: "Add, remove or list the tags of a file",
+		Long: `Tag one file, named by its catalog ID or path. Changes are indexed for
+search --tag right away and recorded like retag edits, so they show in retag
+history and can be reverted with retag undo.
+Examples:
+  archiver tag add 1234 family grandma
+  archiver tag remove /Volumes/OldDrive/Scans/album.pdf family
+  archiver tag list 1234`,
+	}
+
+	cmd.PersistentFlags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.PersistentFlags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add <file> <tag>...",
+		Short: "Add tags to a file",
+		Args:  cobra.MinimumNArgs(2),
+		Run:   func(cmd *cobra.Command, args []string) { executeTagEdit(args[0], args[1:], nil) },
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "remove <file> <tag>...",
+		Short: "Remove tags from a file",
+		Args:  cobra.MinimumNArgs(2),
+		Run:   func(cmd *cobra.Command, args []string) { executeTagEdit(args[0], nil, args[1:]) },
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list <file>",
+		Short: "List the tags of a file",
+		Args:  cobra.ExactArgs(1),
+		Run:   executeTagList,
+	})
+
+	return cmd
+}
+
+// executeTagEdit adds and removes tags of one file
+func executeTagEdit(name string, add, remove []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	file, err := fileByIDOrPath(database, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	changes, err := database.PlanTagEdit([]int64{file.ID}, add, remove)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error planning tag edit: %v\n", err)
+		os.Exit(1)
+	}
+	if len(changes) == 0 {
+		fmt.Println("Nothing to change.")
+		return
+	}
+
+	indexer, err := db.NewIndexer(db.IndexConfig{
+		IndexDir:       indexDir,
+		IndexSummaries: true,
+		IndexContent:   true,
+	}, database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening index: %v\n", err)
+		os.Exit(1)
+	}
+	defer indexer.Close()
+
+	description := fmt.Sprintf("tag %d", file.ID)
+	if len(add) > 0 {
+		description += " +" + strings.Join(add, " +")
+	}
+	if len(remove) > 0 {
+		description += " -" + strings.Join(remove, " -")
+	}
+	if _, err := indexer.ApplyTagEdit(description, changes); err != nil {
+		fmt.Fprintf(os.Stderr, "Error applying tag edit: %v\n", err)
+		os.Exit(1)
+	}
+	printTagChanges(changes)
+}
+
+// executeTagList prints the tags of one file
+func executeTagList(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	file, err := fileByIDOrPath(database, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	tags, err := database.GetTags(file.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading tags: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d  %s\n", file.ID, file.Path)
+	if len(tags) == 0 {
+		fmt.Println("No tags.")
+		return
+	}
+	fmt.Println(strings.Join(tags, ", "))
+}
+
+// fileByIDOrPath finds a file in the catalog by its ID or its path
+func fileByIDOrPath(database *db.DB, name string) (*db.FileStatus, error) {
+	id, err := strconv.ParseInt(name, 10, 64)
+	if err != nil {
+		return catalogFile(database, name, false)
+	}
+	file, err := database.GetFileByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil || file.DeletedAt.Valid {
+		return nil, fmt.Errorf("no file with id %d in the catalog", id)
+	}
+	return file, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+func TestFileByIDOrPath(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	files := []*db.FileStatus{
+		{Path: "/drive/lease.pdf", RelativePath: "lease.pdf", ModTime: time.Now()},
+		{Path: "/drive/old.pdf", RelativePath: "old.pdf", ModTime: time.Now()},
+	}
+	if _, err := database.InsertFilesBatch(files); err != nil {
+		t.Fatal(err)
+	}
+	lease, _ := database.GetFileByPath("/drive/lease.pdf")
+	old, _ := database.GetFileByPath("/drive/old.pdf")
+	if err := database.MarkDeleted(old.ID, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"/drive/lease.pdf", fmt.Sprint(lease.ID)} {
+		if file, err := fileByIDOrPath(database, name); err != nil || file.ID != lease.ID {
+			t.Errorf("fileByIDOrPath(%q) = %+v, %v; want the lease", name, file, err)
+		}
+	}
+	for _, name := range []string{"/drive/missing.pdf", "/drive/old.pdf", fmt.Sprint(old.ID), "999"} {
+		if file, err := fileByIDOrPath(database, name); err == nil {
+			t.Errorf("fileByIDOrPath(%q) = %+v; want an error for a file not in the catalog", name, file)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var textMetadata bool
+
+// newTextCommand creates a command that prints the stored text of a file
+func newTextCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "text <file>",
+		Short: "Print the text extracted from a file",
+		Long: `Print the text extracted from a document, or transcribed from an audio file,
+as stored in the catalog, without the drive it came from. The file is named by
+its catalog ID or path. --metadata prints the metadata extracted along with the
+text instead, such as its title, author, language or page count, one key per
+line.
+Examples:
+  archiver text /Volumes/OldDrive/Scans/deeds.pdf > deeds.txt
+  archiver text 1234 --metadata`,
+		Args: cobra.ExactArgs(1),
+		Run:  executeText,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().BoolVar(&textMetadata, "metadata", false, "Print the extracted metadata instead of the text")
+
+	return cmd
+}
+
+// executeText prints the text or metadata of a file
+func executeText(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	file, err := fileByIDOrPath(database, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if textMetadata {
+		metadata, err := database.GetMetadata(file.ID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading metadata: %v\n", err)
+			os.Exit(1)
+		}
+		if len(metadata) == 0 {
+			fmt.Fprintf(os.Stderr, "No metadata stored for %s\n", file.Path)
+			os.Exit(1)
+		}
+		for _, key := range slices.Sorted(maps.Keys(metadata)) {
+			fmt.Printf("%s: %s\n", key, metadata[key])
+		}
+		return
+	}
+
+	text, err := database.GetText(file.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading text: %v\n", err)
+		os.Exit(1)
+	}
+	if text == "" {
+		fmt.Fprintf(os.Stderr, "No text stored for %s; it hasn't been extracted\n", file.Path)
+		os.Exit(1)
+	}
+	fmt.Print(text)
+	if !strings.HasSuffix(text, "\n") {
+		fmt.Println()
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/trace"
+	"github.com/spf13/cobra"
+)
+
+var traceLogs []string
+
+// newTraceCommand creates a command that shows the history of one file
+func newTraceCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trace <file>",
+		Short: "Show a timeline of everything done to a file",
+		Long: `Show when a file was scanned, extracted, summarized, converted, uploaded,
+tagged and deleted, with the tools, models, durations and costs recorded for
+each step, and the errors it had in any run. The file is named by its catalog
+path.
+
+--log adds the records about the file from a log written with --log-file (text
+or JSON); use --log-level debug when archiving to log every step.
+Examples:
+  archiver trace /Volumes/OldDrive/Scans/deeds.pdf
+  archiver trace /Volumes/OldDrive/Scans/deeds.pdf --log run.log`,
+		Args: cobra.ExactArgs(1),
+		Run:  executeTrace,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringArrayVar(&traceLogs, "log", nil, "Log file to include records from (repeatable)")
+
+	return cmd
+}
+
+// executeTrace prints the timeline of a file
+func executeTrace(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	// Deleted files are found too: their history ends with the deletion
+	file, err := catalogFile(database, args[0], true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	src := trace.Sources{File: file}
+	if src.Provenance, err = database.GetProvenance(file.ID); err == nil {
+		if src.Errors, err = database.GetFileErrors(file.Path); err == nil {
+			if src.Tags, err = database.GetFileTags(file.ID); err == nil {
+				src.Notes, err = database.GetNotes(file.ID)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading the history of %s: %v\n", file.Path, err)
+		os.Exit(1)
+	}
+
+	events := append(trace.Timeline(src), trace.Stubs(file.Path)...)
+	for _, logPath := range traceLogs {
+		logEvents, err := readLogEvents(logPath, file.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", logPath, err)
+			os.Exit(1)
+		}
+		events = append(events, logEvents...)
+	}
+	trace.Sort(events)
+
+	fmt.Println(file.Path)
+	for _, event := range events {
+		fmt.Printf("  %s  %-12s %s\n", event.Time.Local().Format("2006-01-02 15:04:05"), event.Action, event.Detail)
+	}
+	if !file.ScannedAt.Valid {
+		fmt.Println("\nScan times are recorded from this version on; rescan to add one.")
+	}
+}
+
+// readLogEvents reads the records about a file from a log file
+func readLogEvents(logPath, path string) ([]trace.Event, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return trace.FromLog(f, path)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var (
+	undeleteReason string
+	undeleteList   bool
+	undeleteDryRun bool
+)
+
+// newUndeleteCommand creates a command that restores deleted catalog
+// entries from the trash
+func newUndeleteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "undelete [path...]",
+		Short: "Restore deleted catalog entries that haven't been purged",
+		Long: `Restore files marked as deleted, or every deleted file below a folder, to the
+catalog. Their tags, extracted text and uploads are kept until purge removes
+them, so a restored file is processed, exported and found by search again as
+if it had never been deleted. --reason restores only the files deleted for
+that reason, and --list shows the trash with when purge will empty it.
+Examples:
+  archiver undelete --list
+  archiver undelete /Volumes/OldDrive/tmp/dump.sql
+  archiver undelete /Volumes/OldDrive/Caches --reason cache --dry-run`,
+		Run: executeUndelete,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&indexDir, "index-dir", "./index", "Directory containing the search index")
+	cmd.Flags().StringVar(&undeleteReason, "reason", "", "Only restore files deleted for this reason")
+	cmd.Flags().BoolVar(&undeleteList, "list", false, "List the deleted files that can be restored")
+	cmd.Flags().BoolVar(&undeleteDryRun, "dry-run", false, "List the files without restoring them")
+
+	return cmd
+}
+
+// executeUndelete restores the selected tombstones and indexes them again
+func executeUndelete(cmd *cobra.Command, args []string) {
+	if len(args) == 0 && !undeleteList {
+		fmt.Fprintln(os.Stderr, "Error: give the paths to restore or --list")
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	files, err := deletedFiles(database, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if undeleteList {
+		listTrash(files)
+		return
+	}
+
+	fmt.Printf("%d file(s) to restore\n", len(files))
+	if undeleteDryRun {
+		for _, file := range files {
+			fmt.Printf("  %s\n", file.Path)
+		}
+		return
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	var restored, failed int
+	for _, file := range files {
+		if err := database.Undelete(file.ID); err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "  FAILED %s: %v\n", file.Path, err)
+			continue
+		}
+		restored++
+	}
+	syncIndex(database)
+
+	fmt.Printf("Restored %d file(s), %d failed\n", restored, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// deletedFiles returns the deleted files given as paths or below folders
+// given as paths, all of them when there are none, deleted for the reason
+// given with --reason
+func deletedFiles(database *db.DB, args []string) ([]*db.FileStatus, error) {
+	var roots []string
+	for _, arg := range args {
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", arg, err)
+		}
+		roots = append(roots, path)
+	}
+
+	deleted, err := database.GetDeletedFiles(time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("listing deleted files: %w", err)
+	}
+
+	var files []*db.FileStatus
+	for _, file := range deleted {
+		if undeleteReason != "" && file.DeleteReason != undeleteReason {
+			continue
+		}
+		if len(roots) == 0 || slices.ContainsFunc(roots, func(root string) bool { return isWithin(file.Path, root) }) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// isWithin reports whether path is root or below it. Only whole names
+// match, so /a/bc isn't within /a/b.
+func isWithin(path, root string) bool {
+	if path == root {
+		return true
+	}
+	if !strings.HasSuffix(root, string(filepath.Separator)) {
+		root += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, root)
+}
+
+// listTrash prints the deleted files with when purge will remove them
+func listTrash(files []*db.FileStatus) {
+	if len(files) == 0 {
+		fmt.Println("The trash is empty.")
+		return
+	}
+	for _, file := range files {
+		fmt.Printf("%s  deleted %s", file.Path, file.DeletedAt.Time.Format("2006-01-02"))
+		if file.DeleteReason != "" {
+			fmt.Printf(" (%s)", file.DeleteReason)
+		}
+		if appConfig.TrashDays > 0 {
+			fmt.Printf(", purged after %s", file.DeletedAt.Time.AddDate(0, 0, appConfig.TrashDays).Format("2006-01-02"))
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%d deleted file(s)\n", len(files))
+}
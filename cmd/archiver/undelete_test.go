@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+func TestDeletedFiles(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	paths := []string{"/a/b", "/a/b/x.txt", "/a/b/c/y.txt", "/a/bc/z.txt", "/a/keep.txt"}
+	var files []*db.FileStatus
+	for _, path := range paths {
+		files = append(files, &db.FileStatus{Path: path, RelativePath: path[1:], ModTime: time.Now()})
+	}
+	if _, err := database.InsertFilesBatch(files); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths[:4] {
+		file, err := database.GetFileByPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reason := "cleanup"
+		if path == "/a/b/c/y.txt" {
+			reason = "cache"
+		}
+		if err := database.MarkDeleted(file.ID, reason); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		args   []string
+		reason string
+		want   []string
+	}{
+		{nil, "", []string{"/a/b", "/a/b/c/y.txt", "/a/b/x.txt", "/a/bc/z.txt"}},
+		{[]string{"/a/b"}, "", []string{"/a/b", "/a/b/c/y.txt", "/a/b/x.txt"}},
+		{[]string{"/a/b/"}, "", []string{"/a/b", "/a/b/c/y.txt", "/a/b/x.txt"}},
+		{[]string{"/"}, "", []string{"/a/b", "/a/b/c/y.txt", "/a/b/x.txt", "/a/bc/z.txt"}},
+		{[]string{"/a/bc"}, "", []string{"/a/bc/z.txt"}},
+		{[]string{"/a/b/x.txt", "/a/bc"}, "", []string{"/a/b/x.txt", "/a/bc/z.txt"}},
+		{[]string{"/a/b"}, "cache", []string{"/a/b/c/y.txt"}},
+		{[]string{"/a/keep.txt"}, "", nil},
+	}
+	for _, tt := range tests {
+		undeleteReason = tt.reason
+		found, err := deletedFiles(database, tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, file := range found {
+			got = append(got, file.Path)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("deletedFiles(%q, reason %q) = %q, want %q", tt.args, tt.reason, got, tt.want)
+		}
+	}
+	undeleteReason = ""
+}
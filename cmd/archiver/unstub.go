@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	unstubWhere  string
+	unstubDryRun bool
+)
+
+// newUnstubCommand creates a command that brings stubbed files back
+func newUnstubCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unstub <path>",
+		Short: "Restore files replaced by stubs and remove the stubs",
+		Long: `Undo the stubs recorded for a file or the files below a directory: each
+original is downloaded from its upload, checked against the catalog's SHA-256
+and put back, then its stub is removed. --where narrows the files with a SQL
+filter over the catalog columns. Stubs whose original is already back, or
+was never removed because a run stopped halfway, are cleaned up and
+forgotten; files in the way of a restore are left alone with their stub.
+Examples:
+  archiver unstub /Volumes/OldDrive/Photos --dry-run
+  archiver unstub /Volumes/OldDrive --where "content_type LIKE 'image/%'"`,
+		Args: cobra.ExactArgs(1),
+		Run:  executeUnstub,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Backblaze B2 bucket name (default: from config)")
+	cmd.Flags().StringVar(&unstubWhere, "where", "", "SQL filter over the catalog columns selecting the files")
+	cmd.Flags().BoolVar(&unstubDryRun, "dry-run", false, "List the stubs that would be undone without downloading")
+
+	return cmd
+}
+
+// executeUnstub restores the stubbed files below the path
+func executeUnstub(cmd *cobra.Command, args []string) {
+	if cmd.Flags().Changed("bucket") {
+		appConfig.B2Bucket = bucket
+	}
+	if !unstubDryRun {
+		if err := appConfig.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	root, err := filepath.Abs(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	stubs, err := selectStubs(database, root, unstubWhere)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error selecting stubs: %v\n", err)
+		os.Exit(1)
+	}
+	if len(stubs) == 0 {
+		fmt.Printf("No stubs are recorded below %s.\n", root)
+		return
+	}
+
+	var uploader *upload.B2Uploader
+	if !unstubDryRun {
+		uploader, err = newUploader()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating B2 client: %v\n", err)
+			os.Exit(1)
+		}
+		defer uploader.Close()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer handleInterrupt(cancel)()
+
+	restored, forgotten, failed := 0, 0, 0
+	for _, stub := range stubs {
+		if ctx.Err() != nil {
+			fmt.Println("\nInterrupted: files already restored are complete.")
+			break
+		}
+
+		done, err := settleStub(database, stub)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  error: %v\n", err)
+			failed++
+			continue
+		}
+		if done {
+			forgotten++
+			continue
+		}
+
+		files, err := database.GetFilesByURL(stub.URL)
+		if err == nil && len(files) == 0 {
+			err = fmt.Errorf("%s points to %s, which is not in the catalog", stub.StubPath, stub.URL)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  error: %v\n", err)
+			failed++
+			continue
+		}
+		file := stubbedFile(files, stub.OriginalPath)
+
+		if unstubDryRun {
+			fmt.Printf("  would restore %s (%s)\n", stub.OriginalPath, formatSize(file.Size))
+			restored++
+			continue
+		}
+		if err := restoreStub(ctx, database, uploader, stub.StubPath, file); err != nil {
+			fmt.Fprintf(os.Stderr, "  error: %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("  restored %s\n", stub.OriginalPath)
+		restored++
+	}
+
+	fmt.Printf("\nRestored: %d\n", restored)
+	fmt.Printf("Already back: %d\n", forgotten)
+	fmt.Printf("Failed: %d\n", failed)
+	if unstubDryRun {
+		fmt.Println("Dry run: nothing was downloaded.")
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// settleStub handles a stub that needs no download: one whose original is
+// back, or whose replacement stopped before the original was removed. Its
+// leftover stub file is removed and its record forgotten. It reports
+// whether the stub was settled.
+func settleStub(database *db.DB, stub *db.StubResult) (bool, error) {
+	_, err := os.Lstat(stub.OriginalPath)
+	if os.IsNotExist(err) {
+		if _, err := os.Lstat(stub.StubPath); os.IsNotExist(err) {
+			return false, fmt.Errorf("%s is gone and %s is not there", stub.StubPath, stub.OriginalPath)
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if stub.State == db.StubComplete {
+		if _, err := os.Lstat(stub.StubPath); err == nil {
+			// Something new is at the original's path; restoreStub reports it
+			return false, nil
+		}
+	}
+	if unstubDryRun {
+		return true, nil
+	}
+
+	if stub.State != db.StubComplete && stub.StubPath != "" {
+		if err := os.Remove(stub.StubPath); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return true, database.RemoveStub(stub.OriginalPath)
+}
+
+// selectStubs returns the stubs recorded below root, narrowed to the files
+// matching where if it is set
+func selectStubs(database *db.DB, root, where string) ([]*db.StubResult, error) {
+	stubs, err := database.GetStubs(root)
+	if err != nil || where == "" {
+		return stubs, err
+	}
+
+	files, err := database.FindFiles(where)
+	if err != nil {
+		return nil, err
+	}
+	matched := make(map[string]bool, len(files))
+	for _, file := range files {
+		matched[file.Path] = true
+	}
+
+	var selected []*db.StubResult
+	for _, stub := range stubs {
+		if matched[stub.OriginalPath] {
+			selected = append(selected, stub)
+		}
+	}
+	return selected, nil
+}
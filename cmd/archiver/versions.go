@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var (
+	versionsRestore int
+	versionsOutput  string
+)
+
+// newVersionsCommand creates a command that lists and restores the
+// previous versions of a file
+func newVersionsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "versions <file>",
+		Short: "List the previous versions of a changed file, or restore one",
+		Long: `List the contents a file had before a scan found it changed, oldest first,
+with the current content last. Uploading changed content under the same name
+keeps the earlier upload as a previous version in B2, so a version that was
+uploaded can be restored with --restore, to --output or next to the current
+directory as <name>.v<number><ext>. A lifecycle rule deleting hidden versions,
+such as lifecycle --keep-last-version, removes them from the bucket.
+Examples:
+  archiver versions /Volumes/OldDrive/Documents/thesis.docx
+  archiver versions /Volumes/OldDrive/Documents/thesis.docx --restore 2
+  archiver versions /Volumes/OldDrive/Documents/thesis.docx --restore 1 --output /tmp/draft.docx`,
+		Args: cobra.ExactArgs(1),
+		Run:  executeVersions,
+	}
+
+	cmd.Flags().StringVar(&dbFilePath, "db", "./archive.db", "Path to the archive database")
+	cmd.Flags().StringVar(&bucket, "bucket", "", "Backblaze B2 bucket name (default: from config)")
+	cmd.Flags().IntVar(&versionsRestore, "restore", 0, "Download this version")
+	cmd.Flags().StringVarP(&versionsOutput, "output", "o", "", "Where to save the restored version")
+
+	return cmd
+}
+
+// executeVersions lists the versions of a file or restores one
+func executeVersions(cmd *cobra.Command, args []string) {
+	database, err := db.Open(dbFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	file, err := catalogFile(database, args[0], true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	versions, err := database.GetFileVersions(file.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading versions: %v\n", err)
+		os.Exit(1)
+	}
+
+	if versionsRestore == 0 {
+		printVersions(file, versions)
+		return
+	}
+	if versionsRestore < 1 || versionsRestore > len(versions)+1 {
+		fmt.Fprintf(os.Stderr, "Error: %s has versions 1 to %d\n", file.Path, len(versions)+1)
+		os.Exit(1)
+	}
+	if err := restoreVersion(cmd, database, file, versions, versionsRestore); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// printVersions lists the previous versions of a file and its current one
+func printVersions(file *db.FileStatus, versions []*db.FileVersion) {
+	fmt.Printf("%s: %d version(s)\n", file.Path, len(versions)+1)
+	for _, v := range versions {
+		modified := ""
+		if v.ModTime.Valid {
+			modified = v.ModTime.Time.Format("2006-01-02 15:04")
+		}
+		upload := "not uploaded"
+		if v.UploadedURL != "" && v.UploadTime.Valid {
+			upload = "uploaded " + v.UploadTime.Time.Format("2006-01-02")
+		}
+		fmt.Printf("  %3d  %-16s  %9s  %.12s  %s, replaced %s\n", v.Number, modified, formatSize(v.Size),
+			v.SHA256, upload, v.ReplacedAt.Format("2006-01-02"))
+	}
+
+	upload := "not uploaded"
+	if file.UploadedURL != "" && file.UploadSHA256 == file.SHA256 && file.UploadTime.Valid {
+		upload = "uploaded " + file.UploadTime.Time.Format("2006-01-02")
+	}
+	fmt.Printf("  %3d  %-16s  %9s  %.12s  %s (current)\n", len(versions)+1, file.ModTime.Format("2006-01-02 15:04"),
+		formatSize(file.Size), file.SHA256, upload)
+}
+
+// restoreVersion downloads a version of a file, the current one being the
+// number after the last previous version
+func restoreVersion(cmd *cobra.Command, database *db.DB, file *db.FileStatus, versions []*db.FileVersion, number int) error {
+	fileURL, uploadTime, size := file.UploadedURL, file.UploadTime, file.Size
+	if number <= len(versions) {
+		fileURL, uploadTime, size = versions[number-1].UploadedURL, versions[number-1].UploadTime, versions[number-1].Size
+	} else if file.UploadSHA256 != "" && file.UploadSHA256 != file.SHA256 {
+		fileURL = ""
+	}
+	if fileURL == "" || !uploadTime.Valid {
+		return fmt.Errorf("version %d of %s was never uploaded", number, file.Path)
+	}
+
+	output := versionsOutput
+	if output == "" {
+		ext := filepath.Ext(file.Path)
+		output = fmt.Sprintf("%s.v%d%s", strings.TrimSuffix(filepath.Base(file.Path), ext), number, ext)
+	}
+	if _, err := os.Stat(output); err == nil {
+		return fmt.Errorf("%s already exists", output)
+	}
+
+	if cmd.Flags().Changed("bucket") {
+		appConfig.B2Bucket = bucket
+	}
+	if err := appConfig.Validate(); err != nil {
+		return fmt.Errorf("configuration: %w", err)
+	}
+	uploader, err := newUploader()
+	if err != nil {
+		return fmt.Errorf("creating B2 client: %w", err)
+	}
+	defer uploader.Close()
+
+	ctx := context.Background()
+	version, err := uploader.VersionAt(ctx, fileURL, uploadTime.Time)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if err := uploader.DownloadVersion(ctx, version.FileID, out); err != nil {
+		out.Close()
+		os.Remove(output)
+		return err
+	}
+	recordEgress(database, file.ID, size)
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Restored version %d of %s to %s\n", number, file.Path, output)
+	return nil
+}
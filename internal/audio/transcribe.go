@@ -0,0 +1,107 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/scratch"
+	"github.com/jth/archiver/internal/tools"
+)
+
+// Formats lists the audio formats that can be transcribed
+var Formats = []string{
+	".mp3", ".m4a", ".wav", ".aac", ".flac", ".ogg", ".opus",
+	".aiff", ".aif", ".amr", ".wma", ".caf",
+}
+
+// IsSupported checks if a file is a standalone audio file that can be
+// transcribed
+func IsSupported(path string) bool {
+	return slices.Contains(Formats, strings.ToLower(filepath.Ext(path)))
+}
+
+// Options contains options for transcription
+type Options struct {
+	Model    string        // Whisper model, e.g. tiny, base, small, medium or large
+	Language string        // Spoken language, e.g. en; empty to detect it
+	Timeout  time.Duration // 0 for none
+}
+
+// DefaultOptions returns default transcription options
+func DefaultOptions() Options {
+	return Options{
+		Model:   "base",
+		Timeout: 2 * time.Hour,
+	}
+}
+
+// Transcript is the text spoken in an audio file
+type Transcript struct {
+	Text  string
+	Model string
+}
+
+// Transcriber turns the speech in an audio file into text
+type Transcriber interface {
+	Transcribe(ctx context.Context, audioPath string, options Options) (*Transcript, error)
+}
+
+// Whisper is the Transcriber running the whisper command-line tool
+type Whisper struct{}
+
+// Transcribe implements Transcriber. The transcript is written to the
+// scratch folder, so nothing is left next to the source.
+func (Whisper) Transcribe(ctx context.Context, audioPath string, options Options) (*Transcript, error) {
+	if !tools.Available("whisper") {
+		return nil, fmt.Errorf("whisper not found in PATH, cannot transcribe: %w", tools.ErrNotInstalled)
+	}
+	if _, err := os.Stat(audioPath); err != nil {
+		return nil, fmt.Errorf("cannot transcribe %s: %w", audioPath, err)
+	}
+	if options.Model == "" {
+		options.Model = DefaultOptions().Model
+	}
+
+	outputDir, err := scratch.Mkdir("whisper-*", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcript directory: %w", err)
+	}
+	defer scratch.Remove(outputDir)
+
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	args := []string{
+		audioPath,
+		"--model", options.Model,
+		"--output_format", "txt",
+		"--output_dir", outputDir,
+		"--verbose", "False",
+	}
+	if options.Language != "" {
+		args = append(args, "--language", options.Language)
+	}
+	cmd := tools.Command(ctx, "whisper", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("whisper transcription failed: %w\nOutput: %s", err, stderr.String())
+	}
+
+	base := strings.TrimSuffix(filepath.Base(audioPath), filepath.Ext(audioPath))
+	text, err := os.ReadFile(filepath.Join(outputDir, base+".txt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript file: %w", err)
+	}
+
+	return &Transcript{Text: strings.TrimSpace(string(text)), Model: options.Model}, nil
+}
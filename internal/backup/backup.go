@@ -0,0 +1,203 @@
+package backup
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/pathnorm"
+)
+
+// Status describes a catalog file compared with its last upload
+type Status string
+
+// File statuses
+const (
+	StatusNew       Status = "new"       // Never uploaded
+	StatusChanged   Status = "changed"   // Content changed since the last upload
+	StatusUnchanged Status = "unchanged" // Uploaded as it is now
+	StatusMissing   Status = "missing"   // In the catalog but no longer in the folder
+)
+
+// Change is a catalog file with its status
+type Change struct {
+	File   *db.FileStatus
+	Status Status
+}
+
+// NeedsUpload reports whether the file has to be uploaded
+func (c Change) NeedsUpload() bool {
+	return c.Status == StatusNew || c.Status == StatusChanged
+}
+
+// Diff compares the catalog files of a folder, freshly rescanned, with their
+// uploads. present holds the paths the rescan found; other files of the
+// folder are missing. Directories and deleted files are left out.
+func Diff(files []*db.FileStatus, present map[string]bool) []Change {
+	var changes []Change
+	for _, file := range files {
+		if file.IsDir || file.DeletedAt.Valid {
+			continue
+		}
+
+		status := StatusUnchanged
+		switch {
+		case !present[file.Path]:
+			status = StatusMissing
+		case file.UploadedURL == "":
+			status = StatusNew
+		case changedSinceUpload(file):
+			status = StatusChanged
+		}
+		changes = append(changes, Change{File: file, Status: status})
+	}
+
+	return changes
+}
+
+// changedSinceUpload compares the file's hash with the one it was uploaded
+// with. Files uploaded without a recorded hash, or too large to be hashed,
+// count as changed if they were modified after the upload.
+func changedSinceUpload(file *db.FileStatus) bool {
+	if file.SHA256 != "" && file.UploadSHA256 != "" {
+		return file.SHA256 != file.UploadSHA256
+	}
+	return file.UploadTime.Valid && file.ModTime.After(file.UploadTime.Time)
+}
+
+// RemoteName returns the name a file is backed up under: its path relative
+// to the folder, below prefix, in NFC and with names too long for most file
+// systems shortened. The catalog keeps the byte-exact path to restore to.
+func RemoteName(prefix string, file *db.FileStatus) string {
+	return path.Join(prefix, pathnorm.RemotePath(file.RelativePath))
+}
+
+// photoExtensions are the photo formats that can be named by their date
+var photoExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".heic": true, ".heif": true, ".tif": true, ".tiff": true,
+	".dng": true, ".cr2": true, ".cr3": true, ".nef": true, ".arw": true, ".raf": true,
+	".orf": true, ".rw2": true,
+}
+
+// IsPhoto reports whether a file is a photo that can carry an EXIF date
+func IsPhoto(file *db.FileStatus) bool {
+	return photoExtensions[strings.ToLower(filepath.Ext(file.Path))]
+}
+
+// PhotoName returns the date-based name of a photo taken at taken, below
+// prefix: e.g. photos/2016/07/IMG_1234.jpg
+func PhotoName(prefix string, file *db.FileStatus, taken time.Time) string {
+	return path.Join(prefix, taken.Format("2006"), taken.Format("01"), pathnorm.RemotePath(filepath.Base(file.Path)))
+}
+
+// Disambiguate returns name with the start of the file's SHA-256 (or its
+// catalog ID, when it has no hash) added to the base name, for a file whose
+// name is taken by other content: IMG_1234.jpg becomes IMG_1234-1a2b3c4d.jpg
+func Disambiguate(name string, file *db.FileStatus) string {
+	suffix := fmt.Sprint(file.ID)
+	if len(file.SHA256) >= 8 {
+		suffix = file.SHA256[:8]
+	}
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + suffix + ext
+}
+
+// Collision is why a file didn't get the name its layout gives it
+type Collision string
+
+// Collisions
+const (
+	NoCollision      Collision = ""
+	CollisionContent Collision = "content" // The name is used by other content
+	CollisionCase    Collision = "case"    // A name differing only in case is used by other content
+)
+
+// Names assigns remote names to the files of a backup, detecting
+// collisions: a name already used by other content, in the catalog or
+// earlier in the backup, is disambiguated
+type Names struct {
+	owner     func(name string) (*db.FileStatus, error)
+	foldOwner func(folded string) (*db.FileStatus, error)
+	assigned  map[string]*db.FileStatus
+	folded    map[string]*db.FileStatus // By pathnorm.FoldCase of the name
+}
+
+// NewNames creates a name registry. owner returns the catalog file uploaded
+// under a name, or nil.
+func NewNames(owner func(name string) (*db.FileStatus, error)) *Names {
+	return &Names{owner: owner, assigned: make(map[string]*db.FileStatus)}
+}
+
+// FoldCase makes names that differ only in case collide, for layouts that
+// may be copied to a case-insensitive file system, where Report.pdf and
+// report.pdf are the same file. owner returns the catalog file uploaded
+// under a name with the given pathnorm.FoldCase, or nil.
+func (n *Names) FoldCase(owner func(folded string) (*db.FileStatus, error)) {
+	n.foldOwner = owner
+	n.folded = make(map[string]*db.FileStatus)
+}
+
+// Assign returns the name to upload a file under, given the name its layout
+// gives it, and the collision that made it differ. A file keeps its name
+// when it was the first to use it, so the same files get the same names on
+// every run.
+func (n *Names) Assign(name string, file *db.FileStatus) (string, Collision, error) {
+	collision := NoCollision
+	for _, candidate := range []string{name, Disambiguate(name, file)} {
+		taken, err := n.taken(candidate, file)
+		if err != nil {
+			return "", NoCollision, err
+		}
+		if taken == NoCollision {
+			n.assigned[candidate] = file
+			if n.folded != nil {
+				n.folded[pathnorm.FoldCase(candidate)] = file
+			}
+			return candidate, collision, nil
+		}
+		if collision == NoCollision {
+			collision = taken
+		}
+	}
+	return "", collision, fmt.Errorf("%s: %s and %s are both used by other files", file.Path, name, Disambiguate(name, file))
+}
+
+// taken reports whether name is used by content other than file's, or with
+// FoldCase a name differing only in case is
+func (n *Names) taken(name string, file *db.FileStatus) (Collision, error) {
+	other := n.assigned[name]
+	if other == nil {
+		var err error
+		if other, err = n.owner(name); err != nil {
+			return NoCollision, err
+		}
+	}
+	if other != nil && !sameContent(other, file) {
+		return CollisionContent, nil
+	}
+	if n.folded == nil {
+		return NoCollision, nil
+	}
+
+	folded := pathnorm.FoldCase(name)
+	other = n.folded[folded]
+	if other == nil {
+		var err error
+		if other, err = n.foldOwner(folded); err != nil {
+			return NoCollision, err
+		}
+	}
+	if other != nil && !sameContent(other, file) {
+		return CollisionCase, nil
+	}
+	return NoCollision, nil
+}
+
+// sameContent reports whether two catalog entries are the same file or
+// have the same hash, so they can share a remote name
+func sameContent(a, b *db.FileStatus) bool {
+	return a.ID == b.ID || (a.SHA256 != "" && a.SHA256 == b.SHA256)
+}
@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+func TestDiff(t *testing.T) {
+	uploaded := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	uploadTime := sql.NullTime{Time: uploaded, Valid: true}
+
+	files := []*db.FileStatus{
+		{Path: "/docs/new.txt", SHA256: "a"},
+		{Path: "/docs/same.txt", SHA256: "b", UploadedURL: "u", UploadTime: uploadTime, UploadSHA256: "b",
+			ModTime: uploaded.Add(time.Hour)},
+		{Path: "/docs/edited.txt", SHA256: "c2", UploadedURL: "u", UploadTime: uploadTime, UploadSHA256: "c1"},
+		{Path: "/docs/imported.txt", SHA256: "d", UploadedURL: "u", UploadTime: uploadTime,
+			ModTime: uploaded.Add(time.Hour)},
+		{Path: "/docs/old.txt", SHA256: "e", UploadedURL: "u", UploadTime: uploadTime,
+			ModTime: uploaded.Add(-time.Hour)},
+		{Path: "/docs/gone.txt", UploadedURL: "u"},
+		{Path: "/docs/sub", IsDir: true},
+		{Path: "/docs/deleted.txt", DeletedAt: uploadTime},
+	}
+	present := map[string]bool{
+		"/docs/new.txt":      true,
+		"/docs/same.txt":     true,
+		"/docs/edited.txt":   true,
+		"/docs/imported.txt": true,
+		"/docs/old.txt":      true,
+		"/docs/sub":          true,
+		"/docs/deleted.txt":  true,
+	}
+
+	want := map[string]Status{
+		"/docs/new.txt":      StatusNew,
+		"/docs/same.txt":     StatusUnchanged,
+		"/docs/edited.txt":   StatusChanged,
+		"/docs/imported.txt": StatusChanged,
+		"/docs/old.txt":      StatusUnchanged,
+		"/docs/gone.txt":     StatusMissing,
+	}
+
+	changes := Diff(files, present)
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d", len(changes), len(want))
+	}
+	for _, change := range changes {
+		if change.Status != want[change.File.Path] {
+			t.Errorf("%s: got %s, want %s", change.File.Path, change.Status, want[change.File.Path])
+		}
+	}
+}
+
+func TestRemoteName(t *testing.T) {
+	file := &db.FileStatus{RelativePath: "Taxes/2023/return.pdf"}
+	if got := RemoteName("Documents", file); got != "Documents/Taxes/2023/return.pdf" {
+		t.Errorf("got %q", got)
+	}
+	if got := RemoteName("", file); got != "Taxes/2023/return.pdf" {
+		t.Errorf("got %q without prefix", got)
+	}
+}
+
+func TestPhotoName(t *testing.T) {
+	file := &db.FileStatus{ID: 7, Path: "/Volumes/A/DCIM/100CANON/IMG_1234.JPG", SHA256: "1a2b3c4d5e6f"}
+	if !IsPhoto(file) {
+		t.Fatal("a .JPG should be a photo")
+	}
+	name := PhotoName("photos", file, time.Date(2016, 7, 4, 12, 0, 0, 0, time.UTC))
+	if name != "photos/2016/07/IMG_1234.JPG" {
+		t.Errorf("got %q", name)
+	}
+	if got := Disambiguate(name, file); got != "photos/2016/07/IMG_1234-1a2b3c4d.JPG" {
+		t.Errorf("got %q", got)
+	}
+	if got := Disambiguate(name, &db.FileStatus{ID: 7}); got != "photos/2016/07/IMG_1234-7.JPG" {
+		t.Errorf("got %q without a hash", got)
+	}
+}
+
+func TestNames(t *testing.T) {
+	uploaded := &db.FileStatus{ID: 1, Path: "/a/IMG_1.jpg", SHA256: "aaaaaaaa11"}
+	catalog := map[string]*db.FileStatus{"photos/IMG_1.jpg": uploaded}
+	names := NewNames(func(name string) (*db.FileStatus, error) {
+		return catalog[name], nil
+	})
+
+	for _, tt := range []struct {
+		file      *db.FileStatus
+		want      string
+		collision Collision
+	}{
+		{uploaded, "photos/IMG_1.jpg", NoCollision},
+		{&db.FileStatus{ID: 2, Path: "/b/IMG_1.jpg", SHA256: "aaaaaaaa11"}, "photos/IMG_1.jpg", NoCollision},
+		{&db.FileStatus{ID: 3, Path: "/c/IMG_1.jpg", SHA256: "cccccccc33"}, "photos/IMG_1-cccccccc.jpg", CollisionContent},
+		{&db.FileStatus{ID: 4, Path: "/d/IMG_1.jpg"}, "photos/IMG_1-4.jpg", CollisionContent},
+	} {
+		got, collision, err := names.Assign("photos/IMG_1.jpg", tt.file)
+		if err != nil || got != tt.want || collision != tt.collision {
+			t.Errorf("%s: got %q, %q (%v), want %q, %q", tt.file.Path, got, collision, err, tt.want, tt.collision)
+		}
+	}
+}
+
+func TestNamesFoldCase(t *testing.T) {
+	uploaded := &db.FileStatus{ID: 1, Path: "/a/Report.pdf", SHA256: "aaaaaaaa11"}
+	catalog := map[string]*db.FileStatus{"docs/report.pdf": uploaded}
+	names := NewNames(func(name string) (*db.FileStatus, error) { return nil, nil })
+	names.FoldCase(func(folded string) (*db.FileStatus, error) { return catalog[folded], nil })
+
+	for _, tt := range []struct {
+		name      string
+		file      *db.FileStatus
+		want      string
+		collision Collision
+	}{
+		{"docs/Report.pdf", uploaded, "docs/Report.pdf", NoCollision},
+		{"docs/REPORT.pdf", &db.FileStatus{ID: 2, Path: "/a/REPORT.pdf", SHA256: "bbbbbbbb22"}, "docs/REPORT-bbbbbbbb.pdf", CollisionCase},
+		{"docs/Résumé.pdf", &db.FileStatus{ID: 3, Path: "/a/Résumé.pdf", SHA256: "cccccccc33"}, "docs/Résumé.pdf", NoCollision},
+		{"docs/RÉSUMÉ.pdf", &db.FileStatus{ID: 4, Path: "/a/RÉSUMÉ.pdf", SHA256: "dddddddd44"}, "docs/RÉSUMÉ-dddddddd.pdf", CollisionCase},
+	} {
+		got, collision, err := names.Assign(tt.name, tt.file)
+		if err != nil || got != tt.want || collision != tt.collision {
+			t.Errorf("%s: got %q, %q (%v), want %q, %q", tt.name, got, collision, err, tt.want, tt.collision)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Package bundle writes a read-only copy of the archive's metadata for
+// people who don't run the archiver: a static search page that works when
+// opened from disk, next to the catalog database and search index
+package bundle
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jth/archiver/internal/manifest"
+)
+
+// File names in a bundle
+const (
+	PageFile   = "index.html"
+	DataFile   = "data.js"
+	DBFile     = "archive.db"
+	IndexDir   = "index"
+	ReadmeFile = "README.txt"
+)
+
+// Options configures a bundle
+type Options struct {
+	Title  string
+	Header manifest.Header
+}
+
+// record is an entry as the search page reads it, with short keys to keep
+// data.js small
+type record struct {
+	Path        string   `json:"p"`
+	Size        int64    `json:"s"`
+	Modified    string   `json:"m,omitempty"` // YYYY-MM-DD
+	ContentType string   `json:"c,omitempty"`
+	URL         string   `json:"u,omitempty"`
+	Summary     string   `json:"d,omitempty"`
+	Tags        []string `json:"t,omitempty"`
+}
+
+// Writer writes the search page and its data into a directory. The data is
+// a script rather than JSON so the page can load it from disk, where
+// browsers refuse to fetch files.
+type Writer struct {
+	dir   string
+	opts  Options
+	file  *os.File
+	data  *bufio.Writer
+	count int
+}
+
+// NewWriter creates a bundle writer, creating dir if needed
+func NewWriter(dir string, opts Options) (*Writer, error) {
+	if opts.Title == "" {
+		opts.Title = "Archive"
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+	file, err := os.Create(filepath.Join(dir, DataFile))
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{dir: dir, opts: opts, file: file, data: bufio.NewWriter(file)}
+	w.data.WriteString("window.ARCHIVE_ENTRIES = [\n")
+	return w, nil
+}
+
+// Write adds an entry to the search page
+func (w *Writer) Write(entry manifest.Entry) error {
+	r := record{
+		Path:        entry.Path,
+		Size:        entry.Size,
+		ContentType: entry.ContentType,
+		URL:         entry.UploadedURL,
+		Summary:     entry.Summary,
+		Tags:        entry.Tags,
+	}
+	if entry.RelativePath != "" {
+		r.Path = entry.RelativePath
+	}
+	if !entry.ModTime.IsZero() {
+		r.Modified = entry.ModTime.Format("2006-01-02")
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if w.count > 0 {
+		w.data.WriteString(",\n")
+	}
+	w.count++
+	_, err = w.data.Write(data)
+	return err
+}
+
+// Close finishes data.js and writes the search page and README.txt
+func (w *Writer) Close() error {
+	w.data.WriteString("\n];\n")
+	err := w.data.Flush()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", DataFile, err)
+	}
+
+	data := pageData{
+		Title:       w.opts.Title,
+		Total:       w.count,
+		Namespace:   w.opts.Header.Namespace,
+		GeneratedAt: time.Now().Format("2006-01-02"),
+	}
+	if err := w.writeTemplate(PageFile, pageTemplate, data); err != nil {
+		return err
+	}
+	return w.writeTemplate(ReadmeFile, readmeTemplate, data)
+}
+
+// executor is an HTML or text template
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// writeTemplate renders a template into a file of the bundle
+func (w *Writer) writeTemplate(name string, tmpl executor, data pageData) error {
+	file, err := os.Create(filepath.Join(w.dir, name))
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(file, data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return file.Close()
+}
+
+// CopyIndex copies the search index at src into the bundle in dir. Nothing
+// may write to the index meanwhile.
+func CopyIndex(src, dir string) error {
+	dst := filepath.Join(dir, IndexDir)
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(path, target)
+	})
+}
+
+// copyFile copies a regular file
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,81 @@
+package bundle
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jth/archiver/internal/manifest"
+)
+
+func TestWriter(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewWriter(dir, Options{Title: "Family", Header: manifest.NewHeader("bucket")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []manifest.Entry{
+		{Path: "/A/Photos/beach.jpg", RelativePath: "Photos/beach.jpg", Size: 300, ContentType: "image/jpeg", Tags: []string{"family"}},
+		{Path: "/A/</script><b>.txt", Summary: "Grandma's letter"},
+	}
+	for _, entry := range entries {
+		if err := writer.Write(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, DataFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := string(data)
+	if strings.Contains(script, "</script>") {
+		t.Error("data.js should escape markup")
+	}
+	array, ok := strings.CutPrefix(strings.TrimSpace(script), "window.ARCHIVE_ENTRIES = ")
+	if !ok {
+		t.Fatalf("unexpected data.js %q", script)
+	}
+	var records []record
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(array, ";")), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Path != "Photos/beach.jpg" || records[0].Tags[0] != "family" || records[1].Summary != "Grandma's letter" {
+		t.Errorf("unexpected records %+v", records)
+	}
+
+	page, err := os.ReadFile(filepath.Join(dir, PageFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), `<script src="data.js">`) || !strings.Contains(string(page), "2 files") {
+		t.Error("search page should load data.js and count the files")
+	}
+	readme, err := os.ReadFile(filepath.Join(dir, ReadmeFile))
+	if err != nil || !strings.Contains(string(readme), "from the bucket bucket") {
+		t.Errorf("unexpected README %q: %v", readme, err)
+	}
+}
+
+func TestCopyIndex(t *testing.T) {
+	src, dir := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "store"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"index_meta.json": "{}", "store/root.bolt": "bolt"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CopyIndex(src, dir); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, IndexDir, "store", "root.bolt")); err != nil || string(data) != "bolt" {
+		t.Errorf("index not copied: %q, %v", data, err)
+	}
+}
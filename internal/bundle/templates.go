@@ -0,0 +1,169 @@
+package bundle
+
+import (
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// pageData is rendered by pageTemplate and readmeTemplate
+type pageData struct {
+	Title       string
+	Total       int
+	Namespace   string // Bucket the files were uploaded to
+	GeneratedAt string
+}
+
+var pageTemplate = htmltemplate.Must(htmltemplate.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, system-ui, sans-serif; margin: 2em auto; max-width: 72em; padding: 0 1em; color: #222; }
+form { display: flex; flex-wrap: wrap; gap: .5em; margin: 1em 0; }
+input[type=search] { flex: 1; min-width: 16em; font-size: 1.1em; padding: .3em .5em; }
+select { font-size: 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; vertical-align: top; padding: .4em .6em; border-bottom: 1px solid #ddd; }
+td.size { white-space: nowrap; text-align: right; }
+.summary { color: #555; font-size: .9em; }
+.tag { display: inline-block; background: #eef; border-radius: 3px; padding: 0 .4em; margin: 0 .2em .2em 0; font-size: .85em; }
+.muted { color: #777; }
+nav button { margin-right: .5em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="muted">{{.Total}} files, exported {{.GeneratedAt}}. Search the names, summaries and tags; every word has to match.</p>
+<form id="form">
+<input type="search" id="q" placeholder="Search, e.g. birthday 2015" autofocus>
+<select id="kind">
+<option value="">All kinds</option>
+<option value="image/">Photos and images</option>
+<option value="video/">Videos</option>
+<option value="audio/">Audio</option>
+<option value="text/ application/pdf application/msword officedocument opendocument">Documents</option>
+</select>
+<select id="tag"><option value="">All tags</option></select>
+</form>
+<p id="count" class="muted"></p>
+<table>
+<thead><tr><th>File</th><th>Size</th><th>Modified</th><th>Type</th></tr></thead>
+<tbody id="results"></tbody>
+</table>
+<nav id="pages"></nav>
+<noscript><p>The search needs JavaScript. The catalog is also in archive.db, which any SQLite browser opens.</p></noscript>
+<script src="data.js"></script>
+<script>
+const pageSize = 100;
+const entries = window.ARCHIVE_ENTRIES || [];
+entries.forEach(e => e.text = [e.p, e.d || "", (e.t || []).join(" ")].join(" ").toLowerCase());
+let matches = entries, page = 0;
+
+const tags = {};
+entries.forEach(e => (e.t || []).forEach(t => tags[t] = (tags[t] || 0) + 1));
+Object.keys(tags).sort((a, b) => tags[b] - tags[a] || a.localeCompare(b)).forEach(t => {
+  const option = document.createElement("option");
+  option.value = t;
+  option.textContent = t + " (" + tags[t] + ")";
+  document.getElementById("tag").appendChild(option);
+});
+
+function size(n) {
+  const units = ["B", "KB", "MB", "GB", "TB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) { n /= 1024; i++; }
+  return n.toFixed(i ? 1 : 0) + " " + units[i];
+}
+
+function cell(row, text, className) {
+  const td = row.insertCell();
+  td.textContent = text;
+  if (className) td.className = className;
+  return td;
+}
+
+function search() {
+  const words = document.getElementById("q").value.toLowerCase().split(/\s+/).filter(w => w);
+  const kinds = document.getElementById("kind").value.split(" ").filter(k => k);
+  const tag = document.getElementById("tag").value;
+  matches = entries.filter(e =>
+    words.every(w => e.text.includes(w)) &&
+    (!kinds.length || kinds.some(k => (e.c || "").includes(k))) &&
+    (!tag || (e.t || []).includes(tag)));
+  page = 0;
+  show();
+}
+
+function show() {
+  const results = document.getElementById("results");
+  results.replaceChildren();
+  for (const e of matches.slice(page * pageSize, (page + 1) * pageSize)) {
+    const row = results.insertRow();
+    const file = row.insertCell();
+    if (e.u) {
+      const link = document.createElement("a");
+      link.href = e.u;
+      link.textContent = e.p;
+      file.appendChild(link);
+    } else {
+      file.appendChild(document.createTextNode(e.p));
+    }
+    for (const t of e.t || []) {
+      const span = document.createElement("span");
+      span.className = "tag";
+      span.textContent = t;
+      file.appendChild(document.createElement("br"));
+      file.appendChild(span);
+    }
+    if (e.d) {
+      const summary = document.createElement("div");
+      summary.className = "summary";
+      summary.textContent = e.d;
+      file.appendChild(summary);
+    }
+    cell(row, size(e.s), "size");
+    cell(row, e.m || "");
+    cell(row, e.c || "");
+  }
+
+  const pages = Math.ceil(matches.length / pageSize);
+  document.getElementById("count").textContent = matches.length + " of " + entries.length + " files" +
+    (pages > 1 ? ", page " + (page + 1) + " of " + pages : "");
+  const nav = document.getElementById("pages");
+  nav.replaceChildren();
+  const button = (label, target) => {
+    const b = document.createElement("button");
+    b.textContent = label;
+    b.onclick = () => { page = target; show(); window.scrollTo(0, 0); };
+    nav.appendChild(b);
+  };
+  if (page > 0) button("← Previous", page - 1);
+  if (page < pages - 1) button("Next →", page + 1);
+}
+
+document.getElementById("form").onsubmit = e => { e.preventDefault(); search(); };
+["q", "kind", "tag"].forEach(id => document.getElementById(id).oninput = search);
+search();
+</script>
+</body>
+</html>
+`))
+
+var readmeTemplate = texttemplate.Must(texttemplate.New("readme").Parse(`{{.Title}}
+{{.Total}} files, exported {{.GeneratedAt}}{{if .Namespace}} from the bucket {{.Namespace}}{{end}}.
+
+This folder is a read-only copy of the archive's catalog. Nothing in it can
+change the archive.
+
+index.html  Open it in a web browser to search the files by name, summary
+            and tag. It works offline, straight from this folder.
+data.js     The files the page searches.
+archive.db  The full catalog, a SQLite database. Any SQLite browser opens
+            it, such as DB Browser for SQLite (sqlitebrowser.org).
+index/      The full-text search index, for the archiver's search command:
+            archiver search --db archive.db --index-dir index --query "..."
+
+Links to the files open their copy in the bucket, which may ask for access.
+`))
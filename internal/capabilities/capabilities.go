@@ -0,0 +1,167 @@
+package capabilities
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jth/archiver/internal/audio"
+	"github.com/jth/archiver/internal/doc"
+	"github.com/jth/archiver/internal/summariser"
+	"github.com/jth/archiver/internal/tools"
+)
+
+// Capability is one kind of work and whether this machine can do it
+type Capability struct {
+	Name      string   `json:"name"`
+	Available bool     `json:"available"`
+	Tool      string   `json:"tool,omitempty"`    // Tool that will do the work
+	Formats   []string `json:"formats,omitempty"` // Extensions it applies to; empty means any
+}
+
+// handles reports whether the capability applies to the file at path
+func (c Capability) handles(path string) bool {
+	if len(c.Formats) == 0 {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, format := range c.Formats {
+		if ext == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Summarization lists the summarization models that can be used
+type Summarization struct {
+	Local []string `json:"local"` // Models that run on this machine
+	Cloud []string `json:"cloud"` // Models reached through a provider API
+}
+
+// Available reports whether any model can summarize
+func (s Summarization) Available() bool {
+	return len(s.Local) > 0 || len(s.Cloud) > 0
+}
+
+// Matrix is the set of work this machine can do with the tools and API keys
+// it has
+type Matrix struct {
+	Extraction    []Capability  `json:"extraction"`
+	Conversion    []Capability  `json:"conversion"`
+	Transcoding   Capability    `json:"transcoding"`
+	Transcription Capability    `json:"transcription"`
+	OCR           Capability    `json:"ocr"`
+	Summarization Summarization `json:"summarization"`
+}
+
+// extractor is a document format family and the tools that can extract it,
+// in the order doc.ExtractText tries them
+type extractor struct {
+	name    string
+	formats []string
+	tools   []string
+	builtin bool // a raw read is used when no tool is installed
+}
+
+var extractors = []extractor{
+	{"pdf", []string{".pdf"}, []string{"pdftotext", "pdf2text"}, false},
+	{"office", []string{".docx", ".doc", ".odt", ".rtf"}, []string{"tika", "pandoc", "textutil"}, false},
+	{"spreadsheet", []string{".xlsx", ".csv"}, nil, true},
+	{"xls", []string{".xls"}, []string{"tika"}, false},
+	{"presentation", []string{".pptx", ".ppt"}, []string{"tika", "pandoc"}, false},
+	{"epub", []string{".epub"}, []string{"pandoc", "tika"}, false},
+	{"html", []string{".html", ".htm", ".xml"}, nil, true},
+	{"text", []string{".txt"}, nil, true},
+	{"markdown", []string{".md", ".markdown"}, nil, true},
+	{"notebook", []string{".ipynb"}, nil, true},
+	{"iwork", []string{".pages", ".numbers", ".key"}, nil, true},
+	{"appleworks", []string{".cwk"}, nil, true},
+	{"code", doc.CodeFormats(), nil, true},
+}
+
+// Detect probes the installed tools and configured providers
+func Detect() Matrix {
+	var matrix Matrix
+
+	for _, e := range extractors {
+		capability := Capability{Name: e.name, Formats: e.formats, Tool: tools.First(e.tools...)}
+		// A Tika server takes the place of the tika command
+		if i := slices.Index(e.tools, "tika"); i >= 0 &&
+			(capability.Tool == "" || slices.Index(e.tools, capability.Tool) >= i) &&
+			doc.TikaServerUsable(context.Background()) {
+			capability.Tool = "tika-server"
+		}
+		if capability.Tool == "" && e.builtin {
+			capability.Tool = "native"
+		}
+		capability.Available = capability.Tool != ""
+		matrix.Extraction = append(matrix.Extraction, capability)
+	}
+
+	matrix.Conversion = []Capability{
+		detect("heic", []string{".heic", ".heif"}, "sips", "convert"),
+		detect("avif", []string{".avif"}, "convert"),
+		detect("image", []string{".jpg", ".jpeg", ".png", ".tiff", ".tif", ".raw", ".cr2", ".nef", ".arw"}, "ffmpeg"),
+	}
+	matrix.Transcoding = detect("video", nil, "ffmpeg")
+	matrix.Transcription = detect("whisper", audio.Formats, "whisper")
+	matrix.OCR = detect("ocr", nil, "tesseract")
+
+	// The summariser marks which models have a usable provider
+	matrix.Summarization = Summarization{Local: []string{}, Cloud: []string{}}
+	for _, model := range summariser.NewSummariser(summariser.DefaultConfig()).Models() {
+		switch {
+		case !model.Available:
+		case model.Provider == "ollama":
+			matrix.Summarization.Local = append(matrix.Summarization.Local, model.Name)
+		default:
+			matrix.Summarization.Cloud = append(matrix.Summarization.Cloud, model.Name)
+		}
+	}
+
+	return matrix
+}
+
+// detect builds a capability provided by the first installed tool of names
+func detect(name string, formats []string, names ...string) Capability {
+	tool := tools.First(names...)
+	return Capability{Name: name, Available: tool != "", Tool: tool, Formats: formats}
+}
+
+// CanExtract reports whether text can be extracted from the file at path
+func (m Matrix) CanExtract(path string) bool {
+	return canHandle(m.Extraction, path)
+}
+
+// ExtractionTool returns the tool the text of the document at path is
+// extracted with, or "" if none is available
+func (m Matrix) ExtractionTool(path string) string {
+	for _, capability := range m.Extraction {
+		if capability.handles(path) {
+			return capability.Tool
+		}
+	}
+	return ""
+}
+
+// CanConvert reports whether the image at path can be converted
+func (m Matrix) CanConvert(path string) bool {
+	return canHandle(m.Conversion, path)
+}
+
+// CanTranscribe reports whether the audio file at path can be transcribed
+func (m Matrix) CanTranscribe(path string) bool {
+	return canHandle([]Capability{m.Transcription}, path)
+}
+
+// canHandle reports whether the first capability handling path is available
+func canHandle(capabilities []Capability, path string) bool {
+	for _, capability := range capabilities {
+		if capability.handles(path) {
+			return capability.Available
+		}
+	}
+	return false
+}
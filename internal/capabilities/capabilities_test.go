@@ -0,0 +1,44 @@
+package capabilities
+
+import "testing"
+
+func TestCanExtract(t *testing.T) {
+	matrix := Matrix{
+		Extraction: []Capability{
+			{Name: "pdf", Formats: []string{".pdf"}},
+			{Name: "text", Available: true, Tool: "native", Formats: []string{".txt"}},
+		},
+		Conversion: []Capability{
+			{Name: "heic", Available: true, Tool: "sips", Formats: []string{".heic", ".heif"}},
+		},
+	}
+
+	tests := []struct {
+		path    string
+		extract bool
+		convert bool
+	}{
+		{"/docs/report.pdf", false, false},
+		{"/docs/NOTES.TXT", true, false},
+		{"/photos/IMG_0001.HEIC", false, true},
+		{"/misc/archive.zip", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := matrix.CanExtract(tt.path); got != tt.extract {
+			t.Errorf("CanExtract(%q) = %v, want %v", tt.path, got, tt.extract)
+		}
+		if got := matrix.CanConvert(tt.path); got != tt.convert {
+			t.Errorf("CanConvert(%q) = %v, want %v", tt.path, got, tt.convert)
+		}
+	}
+}
+
+func TestSummarizationAvailable(t *testing.T) {
+	if (Summarization{}).Available() {
+		t.Error("empty summarization should not be available")
+	}
+	if !(Summarization{Local: []string{"llama3-8b-instruct"}}).Available() {
+		t.Error("a local model should make summarization available")
+	}
+}
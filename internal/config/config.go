@@ -5,41 +5,251 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // Config holds application configuration and API keys
 type Config struct {
 	// Backblaze B2 configuration
 	B2KeyID   string `json:"b2_key_id"`
-	B2AppKey  string `json:"b2_app_key"`
+	B2AppKey  string `json:"b2_app_key" secret:"true"`
 	B2Bucket  string `json:"b2_bucket"`
 	B2KeyName string `json:"b2_key_name"`
 
+	// Server-side encryption of uploads: SSE-B2, or SSE-C with a base64
+	// 256-bit key that is needed again to download them
+	B2Encryption  string `json:"b2_encryption"`
+	B2CustomerKey string `json:"b2_sse_c_key" secret:"true"`
+
+	// Key signing the links of archiver share, which creates it and replaces
+	// it to revoke them
+	B2ShareKeyID  string `json:"b2_share_key_id"`
+	B2ShareAppKey string `json:"b2_share_app_key" secret:"true"`
+
+	// S3 or S3-compatible storage, a destination of archiver migrate
+	S3AccessKeyID     string `json:"s3_access_key_id"`
+	S3SecretAccessKey string `json:"s3_secret_access_key" secret:"true"`
+	S3Region          string `json:"s3_region"`
+	S3Endpoint        string `json:"s3_endpoint"`
+
 	// AI model API keys
-	AnthropicAPIKey string `json:"anthropic_api_key"`
-	OpenAIAPIKey    string `json:"openai_api_key"`
-	MistralAPIKey   string `json:"mistral_api_key"`
-	GrokAPIKey      string `json:"grok_api_key"`
-	GrpetileAPIKey  string `json:"greptile_api_key"`
+	AnthropicAPIKey string `json:"anthropic_api_key" secret:"true"`
+	OpenAIAPIKey    string `json:"openai_api_key" secret:"true"`
+	MistralAPIKey   string `json:"mistral_api_key" secret:"true"`
+	GrokAPIKey      string `json:"grok_api_key" secret:"true"`
+	GrpetileAPIKey  string `json:"greptile_api_key" secret:"true"`
 
 	// Other service keys
-	GithubToken    string `json:"github_token"`
-	NeonAPIKey     string `json:"neon_api_key"`
-	BraveSearchKey string `json:"brave_search_key"`
+	GithubToken    string `json:"github_token" secret:"true"`
+	NeonAPIKey     string `json:"neon_api_key" secret:"true"`
+	BraveSearchKey string `json:"brave_search_key" secret:"true"`
 
 	// App configuration
 	CostCapUSD float64 `json:"cost_cap_usd"`
 	Summarize  string  `json:"summarize"`
 	StubMode   string  `json:"stub_mode"`
+
+	// Days a deleted catalog entry and its uploads stay recoverable with
+	// undelete before purge removes them; 0 lets purge remove them at once
+	TrashDays int `json:"trash_days"`
+
+	// Maximum LLM spend across all runs in USD; 0 for no limit
+	LifetimeBudgetUSD float64 `json:"lifetime_budget_usd"`
+	// Maximum LLM spend on one document in USD; 0 for no limit
+	DocumentCapUSD float64 `json:"document_cap_usd"`
+	// Maximum LLM spend per calendar month in USD by provider, e.g. "openai"
+	ProviderCapsUSD map[string]float64 `json:"provider_monthly_caps_usd,omitempty"`
+	// Extract people, organizations, dates, places, document types and
+	// keywords from documents along with their summaries
+	ExtractEntities bool `json:"extract_entities"`
+	// Whisper model transcribing audio files: tiny, base, small, medium or
+	// large
+	WhisperModel string `json:"whisper_model"`
+	// Apache Tika server documents are extracted with, which reuses one JVM
+	// instead of starting the tika command per file; empty to use the command
+	TikaURL string `json:"tika_url"`
+	// tika-server-standard JAR started with java when nothing answers at a
+	// local tika_url; tika-rest-server or tika-server is started otherwise
+	TikaServerJar string `json:"tika_server_jar"`
+	// Leave navigation, sidebars, footers and other boilerplate out of the
+	// text of HTML pages
+	StripHTMLBoilerplate bool `json:"strip_html_boilerplate"`
+	// Describe each photo in one line with a vision model, LLaVA through
+	// Ollama or OpenAI, for text search
+	CaptionPhotos bool `json:"caption_photos"`
+	// What backup-diff leaves on disk after uploading a camera raw file: keep
+	// the raw file, or preview to replace it with its embedded JPEG preview
+	// and a stub
+	RawLocal string `json:"raw_local"`
+	// Folder for transcodes, previews and other intermediate files; empty
+	// for the system temporary folder
+	ScratchDir string `json:"scratch_dir"`
+	// Space in GB left free on the scratch disk and on local replicas and
+	// restore targets; work that would use it stops
+	MinFreeGB float64 `json:"min_free_gb"`
+	// How often the catalog database waits for writes to reach the disk:
+	// off, normal, full or extra
+	DBSyncMode string `json:"db_sync_mode"`
+	// What an archive run does when the SMART status of the drive being
+	// archived shows sectors going bad: warn, refuse to start, or off to
+	// skip the check
+	DriveHealth string `json:"drive_health"`
+	// How Time Machine backups and folders of APFS snapshots are scanned:
+	// latest for the latest snapshot only, dedupe for every snapshot with
+	// files unchanged since an earlier one left out, or all
+	Snapshots string `json:"snapshots"`
+
+	// Template naming uploads in the bucket, e.g. "{drive}/{relpath}"; empty
+	// keeps each command's default layout
+	RemoteNameTemplate string `json:"remote_name_template"`
+	// Count names differing only in case as collisions, for buckets that
+	// may be restored to a case-insensitive file system
+	CaseInsensitiveNames bool `json:"case_insensitive_names"`
+
+	// Destinations every backed-up file is copied to besides b2_bucket. A
+	// file is archived once all of them hold it.
+	Replicas []Replica `json:"replicas,omitempty"`
+
+	// Tags applied during scanning to files whose path matches a pattern
+	TagRules []TagRule `json:"tag_rules,omitempty"`
+
+	// Tag files with the built-in categories (tax, medical, photos, code,
+	// receipts, legal, school) and those in Categories, by their name while
+	// scanning and by their text while processing
+	Classify   bool       `json:"classify"`
+	Categories []Category `json:"categories,omitempty"`
+
+	// External programs deriving text from the formats the archiver can't
+	// read itself
+	Plugins []Plugin `json:"plugins,omitempty"`
+
+	// Notifications sent when a run finishes or fails
+	Notify NotifyConfig `json:"notify,omitempty"`
+
+	// How much work of each kind runs at once, and what gets the CPU first
+	Concurrency Concurrency `json:"concurrency"`
+
+	// How long one file may take at each stage before it is given up on
+	Timeouts Timeouts `json:"timeouts"`
+
+	// Object Lock applied to uploads, for buckets created with Object Lock
+	// enabled
+	Retention Retention `json:"retention"`
+}
+
+// Retention locks the files backup-diff uploads for Years, in governance
+// or compliance mode, and places a legal hold on them with LegalHold. Only
+// files matching one of Paths are locked, or every file when it is empty;
+// patterns are those of tag rules.
+type Retention struct {
+	Years     int      `json:"years"` // 0 to leave uploads unlocked
+	Mode      string   `json:"mode"`
+	LegalHold bool     `json:"legal_hold"`
+	Paths     []string `json:"paths,omitempty"`
+}
+
+// Enabled reports whether uploads are locked
+func (r Retention) Enabled() bool {
+	return r.Years > 0 || r.LegalHold
+}
+
+// Concurrency tunes how many tasks of each kind run at once. Zero sizes
+// them for the machine; the --max-* flags of a command take precedence.
+type Concurrency struct {
+	HashWorkers int `json:"hash_workers"` // Files hashed at once while scanning
+	Transcodes  int `json:"transcodes"`   // ffmpeg processes, each using every core
+	Extractions int `json:"extractions"`  // Text extractors
+	Uploads     int `json:"uploads"`      // Files backup-diff uploads at once
+	Summaries   int `json:"summaries"`    // LLM requests, which providers rate-limit
+	// uploads runs transcoders, converters, extractors and Whisper at a low
+	// CPU priority so that uploads aren't starved by them; balanced leaves
+	// priorities alone
+	Priority string `json:"priority"`
+}
+
+// Timeouts bounds how long one file may take at each stage, in minutes, so
+// that a hung tool or a wedged read doesn't stall a run: the file is
+// recorded as failed and the run moves on. 0 for no limit.
+type Timeouts struct {
+	Hash      int `json:"hash_minutes"`      // Reading a file to hash it while scanning
+	Extract   int `json:"extract_minutes"`   // Extracting or transcribing the text of a file
+	Transcode int `json:"transcode_minutes"` // Transcoding a video or converting a photo
+	Upload    int `json:"upload_minutes"`    // Uploading a file
+	Summarize int `json:"summarize_minutes"` // Summarizing the text of a file
+}
+
+// TagRule tags files whose path matches Pattern, e.g. "*/Tax*/**" -> "tax".
+// In patterns * matches within a path segment and ** across segments.
+type TagRule struct {
+	Pattern string `json:"pattern"`
+	Tag     string `json:"tag"`
+}
+
+// Category adds a category for classification, or extends the built-in one
+// with the same tag. A file is put in it by one of its Extensions or
+// PathKeywords, or by a text containing MinMatches (default 2) of Keywords.
+type Category struct {
+	Tag          string   `json:"tag"`
+	Extensions   []string `json:"extensions,omitempty"`
+	PathKeywords []string `json:"path_keywords,omitempty"`
+	Keywords     []string `json:"keywords,omitempty"`
+	MinMatches   int      `json:"min_matches,omitempty"`
+}
+
+// Replica is an extra upload destination: a B2 bucket reached with the
+// same key, or a local folder such as a mounted NAS share
+type Replica struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`             // b2 or local
+	Bucket string `json:"bucket,omitempty"` // For b2
+	Path   string `json:"path,omitempty"`   // For local
+}
+
+// Plugin is an external program run on each file with one of Extensions,
+// or a content type starting with one of ContentTypes. It gets the file's
+// path and catalog entry as JSON on stdin and prints the text it derived,
+// and optionally a title, quality, metadata and tags, as JSON on stdout.
+type Plugin struct {
+	Name           string   `json:"name"`
+	Command        []string `json:"command"`
+	Extensions     []string `json:"extensions,omitempty"`
+	ContentTypes   []string `json:"content_types,omitempty"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"` // Default 300
+}
+
+// NotifyConfig enables desktop notifications and webhooks for finished runs
+type NotifyConfig struct {
+	Desktop  bool      `json:"desktop,omitempty"`
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+}
+
+// Webhook is a URL the run summary is posted to. Type is slack, discord or
+// generic; when empty it is guessed from the URL.
+type Webhook struct {
+	URL  string `json:"url"`
+	Type string `json:"type,omitempty"`
 }
 
 // Default configuration values
 var defaults = Config{
-	B2Bucket:   "RabidArchiver",
-	B2KeyName:  "rabidarchiver",
-	CostCapUSD: 5.0,
-	Summarize:  "default",
-	StubMode:   "webloc",
+	B2Bucket:             "RabidArchiver",
+	B2KeyName:            "rabidarchiver",
+	CostCapUSD:           5.0,
+	Summarize:            "default",
+	StubMode:             "webloc",
+	TrashDays:            30,
+	Classify:             true,
+	WhisperModel:         "base",
+	TikaURL:              "http://localhost:9998",
+	StripHTMLBoilerplate: true,
+	RawLocal:             "keep",
+	MinFreeGB:            1,
+	DBSyncMode:           "normal",
+	DriveHealth:          "warn",
+	Snapshots:            "dedupe",
+	Concurrency:          Concurrency{Priority: "balanced"},
+	Timeouts:             Timeouts{Hash: 30, Extract: 15, Transcode: 360, Upload: 120, Summarize: 10},
+	Retention:            Retention{Mode: "governance"},
 }
 
 // LoadFromEnv loads configuration from environment variables
@@ -88,7 +298,8 @@ func LoadFromEnv() *Config {
 	return &config
 }
 
-// LoadFromFile loads configuration from a JSON file
+// LoadFromFile loads configuration from a JSON file. Lines starting with //
+// are comments.
 func LoadFromFile(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -96,13 +307,25 @@ func LoadFromFile(path string) (*Config, error) {
 	}
 
 	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	if err := json.Unmarshal(stripComments(data), &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
 	return &config, nil
 }
 
+// stripComments blanks the comment lines of a config file, keeping line
+// numbers in parse errors intact
+func stripComments(data []byte) []byte {
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "//") {
+			lines[i] = ""
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
 // SaveToFile saves configuration to a JSON file
 func (c *Config) SaveToFile(path string) error {
 	// Ensure directory exists
@@ -137,6 +360,35 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("B2 Bucket name is required")
 	}
 
+	names := make(map[string]bool)
+	for i, replica := range c.Replicas {
+		switch {
+		case replica.Name == "":
+			return fmt.Errorf("replica %d has no name", i+1)
+		case names[replica.Name]:
+			return fmt.Errorf("replica name %q is used twice", replica.Name)
+		case replica.Type == "b2" && replica.Bucket == "":
+			return fmt.Errorf("replica %s: bucket is required", replica.Name)
+		case replica.Type == "b2" && replica.Bucket == c.B2Bucket:
+			return fmt.Errorf("replica %s: bucket %s is already b2_bucket", replica.Name, replica.Bucket)
+		case replica.Type == "local" && replica.Path == "":
+			return fmt.Errorf("replica %s: path is required", replica.Name)
+		case replica.Type != "b2" && replica.Type != "local":
+			return fmt.Errorf("replica %s: unknown type %q (expected b2 or local)", replica.Name, replica.Type)
+		}
+		names[replica.Name] = true
+	}
+
+	switch {
+	case c.Timeouts.Hash < 0 || c.Timeouts.Extract < 0 || c.Timeouts.Transcode < 0 ||
+		c.Timeouts.Upload < 0 || c.Timeouts.Summarize < 0:
+		return fmt.Errorf("timeouts can't be negative")
+	case c.Retention.Years < 0:
+		return fmt.Errorf("retention.years can't be negative")
+	case c.Retention.Years > 0 && c.Retention.Mode != "governance" && c.Retention.Mode != "compliance":
+		return fmt.Errorf("unknown retention.mode %q (expected governance or compliance)", c.Retention.Mode)
+	}
+
 	return nil
 }
 
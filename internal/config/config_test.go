@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTemplateHasDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(Template), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	want := defaults
+	want.TagRules = []TagRule{}
+	want.Categories = []Category{}
+	want.Replicas = []Replica{}
+	want.ProviderCapsUSD = map[string]float64{}
+	want.Notify.Webhooks = []Webhook{}
+	want.Retention.Paths = []string{}
+	if !reflect.DeepEqual(*cfg, want) {
+		t.Errorf("template = %+v, want defaults %+v", *cfg, want)
+	}
+}
+
+func TestSet(t *testing.T) {
+	cfg := defaults
+	for _, kv := range [][2]string{
+		{"b2_bucket", "photos"},
+		{"cost_cap_usd", "2.5"},
+		{"notify.desktop", "true"},
+		{"concurrency.uploads", "8"},
+	} {
+		if err := cfg.Set(kv[0], kv[1]); err != nil {
+			t.Fatalf("Set(%q, %q): %v", kv[0], kv[1], err)
+		}
+	}
+	if cfg.B2Bucket != "photos" || cfg.CostCapUSD != 2.5 || !cfg.Notify.Desktop || cfg.Concurrency.Uploads != 8 {
+		t.Errorf("Set did not apply: %+v", cfg)
+	}
+
+	for _, kv := range [][2]string{
+		{"bucket", "photos"},
+		{"cost_cap_usd", "lots"},
+		{"concurrency.uploads", "2.5"},
+		{"tag_rules", "tax"},
+	} {
+		if err := cfg.Set(kv[0], kv[1]); err == nil {
+			t.Errorf("Set(%q, %q) should fail", kv[0], kv[1])
+		}
+	}
+}
+
+func TestSetInFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(Template), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range [][2]string{
+		{"b2_bucket", "photos"},
+		{"cost_cap_usd", "2.5"},
+		{"retention.years", "7"},
+		{"notify.desktop", "true"},
+	} {
+		if err := SetInFile(path, kv[0], kv[1]); err != nil {
+			t.Fatalf("SetInFile(%q, %q): %v", kv[0], kv[1], err)
+		}
+	}
+	if err := SetInFile(path, "cost_cap_usd", "lots"); err == nil {
+		t.Error("SetInFile with a bad value should fail")
+	}
+
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.B2Bucket != "photos" || cfg.CostCapUSD != 2.5 || cfg.Retention.Years != 7 || !cfg.Notify.Desktop {
+		t.Errorf("SetInFile did not apply: %+v", cfg)
+	}
+	data, _ := os.ReadFile(path)
+	for _, comment := range []string{
+		"// Archiver configuration. Lines starting with // are comments.",
+		"// Backblaze B2 application key and the bucket files are uploaded to",
+		"// released with archiver lock --release-hold.",
+	} {
+		if !strings.Contains(string(data), comment) {
+			t.Errorf("comment %q lost from\n%s", comment, data)
+		}
+	}
+
+	// Keys are added to the objects that exist, and the objects to the file
+	sparse := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(sparse, []byte("{\n  // Uploads\n  \"b2_bucket\": \"x\"\n}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetInFile(sparse, "notify.desktop", "true"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(sparse)
+	want := "{\n  // Uploads\n  \"b2_bucket\": \"x\",\n  \"notify\": {\"desktop\": true}\n}\n"
+	if string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+}
+
+func TestMasked(t *testing.T) {
+	cfg := defaults
+	cfg.B2KeyID = "0012345abcdef"
+	cfg.B2AppKey = "K001secretsecretWXYZ"
+	cfg.Notify.Webhooks = []Webhook{{URL: "https://hooks.slack.com/services/T0/B0/secret"}}
+
+	masked := cfg.Masked()
+	if masked.B2KeyID != cfg.B2KeyID {
+		t.Errorf("key ID should not be masked, got %q", masked.B2KeyID)
+	}
+	if masked.B2AppKey != "****WXYZ" {
+		t.Errorf("app key = %q, want ****WXYZ", masked.B2AppKey)
+	}
+	if got := masked.Notify.Webhooks[0].URL; got != "https://hooks.slack.com/****" {
+		t.Errorf("webhook = %q", got)
+	}
+	if cfg.B2AppKey != "K001secretsecretWXYZ" || cfg.Notify.Webhooks[0].URL != "https://hooks.slack.com/services/T0/B0/secret" {
+		t.Error("Masked changed the original config")
+	}
+}
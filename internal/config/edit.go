@@ -0,0 +1,416 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Template is the commented config file written by archiver config init. Its
+// values are the defaults.
+const Template = `// Archiver configuration. Lines starting with // are comments.
+// Environment variables are only read when this file doesn't exist.
+{
+  // Backblaze B2 application key and the bucket files are uploaded to
+  "b2_key_id": "",
+  "b2_app_key": "",
+  "b2_bucket": "RabidArchiver",
+  "b2_key_name": "rabidarchiver",
+  // Server-side encryption of uploads: "" (the bucket default), SSE-B2, or
+  // SSE-C with a base64 256-bit key (keep a copy: downloads need it too)
+  "b2_encryption": "",
+  "b2_sse_c_key": "",
+  // Key signing the links of archiver share, which creates it (the key
+  // above needs the writeKeys and deleteKeys capabilities) and replaces it
+  // with --revoke-all
+  "b2_share_key_id": "",
+  "b2_share_app_key": "",
+
+  // S3 credentials for archiver migrate --to s3:<bucket>. The endpoint is
+  // only needed for S3-compatible providers, e.g. https://s3.wasabisys.com
+  "s3_access_key_id": "",
+  "s3_secret_access_key": "",
+  "s3_region": "",
+  "s3_endpoint": "",
+
+  // LLM API keys used to summarize documents
+  "anthropic_api_key": "",
+  "openai_api_key": "",
+  "mistral_api_key": "",
+  "grok_api_key": "",
+  "greptile_api_key": "",
+
+  // Other service keys
+  "github_token": "",
+  "neon_api_key": "",
+  "brave_search_key": "",
+
+  // Maximum LLM spend per run in USD
+  "cost_cap_usd": 5,
+  // Maximum LLM spend across all runs in USD, see archiver costs; 0 for no
+  // limit
+  "lifetime_budget_usd": 0,
+  // Maximum LLM spend on one document in USD, and per month by provider,
+  // e.g. {"openai": 20, "anthropic": 10}; 0 or missing for no limit.
+  // Documents over them are summarized by a cheaper model, or more briefly.
+  "document_cap_usd": 0,
+  "provider_monthly_caps_usd": {},
+  // Also extract people, organizations, dates, places, the document type and
+  // keywords from documents, for search --person, --org, --facets etc.
+  "extract_entities": false,
+  // Whisper model transcribing voice memos and other audio files: tiny,
+  // base, small, medium or large. Larger ones are slower but more accurate.
+  "whisper_model": "base",
+  // Apache Tika server that Office documents, XLS spreadsheets, presentations
+  // and e-books are extracted with, keeping one JVM running rather than
+  // starting the tika command, and a JVM, per file. When nothing answers at a
+  // local URL it is started with tika-rest-server or tika-server, or with
+  // java and the tika-server-standard JAR at tika_server_jar, and stopped
+  // when the command ends. Empty to use the tika command.
+  "tika_url": "http://localhost:9998",
+  "tika_server_jar": "",
+  // Index only the content of HTML pages, leaving out their navigation,
+  // sidebars, footers, cookie banners and link lists.
+  "strip_html_boilerplate": true,
+  // Describe each photo in one line ("two kids on a beach at sunset") with
+  // LLaVA through Ollama, or OpenAI if no local model is installed, so that
+  // untagged photos can be found by search. Costs count against the caps.
+  "caption_photos": false,
+  // What backup-diff leaves behind after uploading a camera raw file (.cr2,
+  // .nef, .arw...): keep, or preview to replace it with its embedded JPEG
+  // preview (IMG_0001.CR2.jpg) and a stub pointing to the upload
+  "raw_local": "keep",
+  // Where transcodes, previews and other intermediate files are written,
+  // e.g. a fast internal disk; empty for the system temporary folder. They
+  // are removed once a command is done with them.
+  "scratch_dir": "",
+  // GB to leave free on the scratch disk, local replicas and restore
+  // targets; a backup-diff stops when a replica folder gets this full
+  "min_free_gb": 1,
+  // How often the catalog database waits for writes to reach the disk:
+  // normal is safe against crashes and may lose the last writes on a power
+  // loss; full and extra lose nothing but scan more slowly, and off is
+  // fastest but can corrupt the catalog on a power loss
+  "db_sync_mode": "normal",
+  // Before archiving a drive its SMART status is read with smartctl and
+  // recorded; warn or refuse to start when it reports failing, reallocated
+  // or pending sectors, or off
+  "drive_health": "warn",
+  // Time Machine backups and folders of APFS snapshots hold a full copy of
+  // the disk per snapshot: latest scans only the newest, dedupe every one
+  // leaving out files unchanged since an earlier snapshot, all every file
+  "snapshots": "dedupe",
+  // Days deleted catalog entries, and their uploads, stay in the trash where
+  // archiver undelete can restore them; purge removes only older ones
+  "trash_days": 30,
+  // Summarization level: none, basic, default or full
+  "summarize": "default",
+  // Local stub format: webloc, shortcut or none
+  "stub_mode": "webloc",
+  // Names of uploads in the bucket, e.g. "{drive}/{relpath}" or
+  // "{year}/{month}/{hash[:2]}/{name}"; empty keeps the default layout
+  "remote_name_template": "",
+  // Rename uploads whose names differ only in case from another file's
+  // (Report.pdf and report.pdf), for buckets that may be restored to a
+  // case-insensitive file system
+  "case_insensitive_names": false,
+  // Destinations every backed-up file is also copied to, e.g.
+  // {"name": "nas", "type": "local", "path": "/Volumes/NAS/archive"} or
+  // {"name": "offsite", "type": "b2", "bucket": "my-archive-copy"}
+  "replicas": [],
+
+  // Tags applied to scanned files whose path matches a pattern, e.g.
+  // {"pattern": "*/Tax*/**", "tag": "tax"}
+  "tag_rules": [],
+  // Tag files as tax, medical, photos, code, receipts, legal or school from
+  // their name and text, plus any categories added or extended here, e.g.
+  // {"tag": "recipes", "keywords": ["ingredients", "preheat", "tablespoon"]}
+  "classify": true,
+  "categories": [],
+
+  // Desktop notifications and webhooks (Slack, Discord or generic JSON) for
+  // finished runs, e.g. {"url": "https://hooks.slack.com/services/..."}
+  "notify": {
+    "desktop": false,
+    "webhooks": []
+  },
+
+  // How many files are hashed, transcoded, extracted, uploaded and
+  // summarized at once; 0 sizes each for this machine. Hashing external
+  // hard drives is fastest one file at a time, SSDs take more. Set priority
+  // to uploads to run transcoders, extractors and other tools at a low CPU
+  // priority, so that they don't starve uploads.
+  "concurrency": {
+    "hash_workers": 0,
+    "transcodes": 0,
+    "extractions": 0,
+    "uploads": 0,
+    "summaries": 0,
+    "priority": "balanced"
+  },
+
+  // Minutes one file may take at each stage before it is recorded as failed
+  // and the run moves on, so that a hung ffmpeg or a read stuck on a failing
+  // or network drive doesn't stall it; 0 for no limit
+  "timeouts": {
+    "hash_minutes": 30,
+    "extract_minutes": 15,
+    "transcode_minutes": 360,
+    "upload_minutes": 120,
+    "summarize_minutes": 10
+  },
+
+  // Lock the files backup-diff uploads for this many years with B2 Object
+  // Lock, which the bucket must have been created with. In governance mode
+  // a key with bypassGovernance can still unlock them; in compliance mode
+  // nobody can delete them before then. legal_hold keeps them until it is
+  // released with archiver lock --release-hold. paths limits the locks to
+  // files matching tag rule patterns, e.g. "*/Tax*/**"; empty locks all.
+  "retention": {
+    "years": 0,
+    "mode": "governance",
+    "legal_hold": false,
+    "paths": []
+  }
+}
+`
+
+// Keys returns the keys that Set accepts, sorted
+func Keys() []string {
+	var keys []string
+	walkFields(reflect.ValueOf(&Config{}).Elem(), "", func(key string, _ reflect.Value, _ reflect.StructField) {
+		keys = append(keys, key)
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+// Set sets the value of a key, named as in the config file. Keys of nested
+// settings are joined with dots, e.g. notify.desktop. Lists such as tag_rules
+// can't be set this way.
+func (c *Config) Set(key, value string) error {
+	var field reflect.Value
+	walkFields(reflect.ValueOf(c).Elem(), "", func(name string, v reflect.Value, _ reflect.StructField) {
+		if name == key {
+			field = v
+		}
+	})
+	if !field.IsValid() {
+		return fmt.Errorf("unknown key %q (expected one of: %s)", key, strings.Join(Keys(), ", "))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be a number: %w", key, err)
+		}
+		field.SetFloat(n)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a whole number: %w", key, err)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false: %w", key, err)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("%s can't be set from the command line; edit the config file", key)
+	}
+	return nil
+}
+
+// Masked returns a copy of the config with API keys, tokens and webhook URLs
+// masked, for display
+func (c *Config) Masked() *Config {
+	masked := *c
+	walkFields(reflect.ValueOf(&masked).Elem(), "", func(_ string, v reflect.Value, field reflect.StructField) {
+		if field.Tag.Get("secret") == "true" {
+			v.SetString(mask(v.String()))
+		}
+	})
+
+	// Webhook URLs carry their token in the path
+	masked.Notify.Webhooks = make([]Webhook, len(c.Notify.Webhooks))
+	for i, webhook := range c.Notify.Webhooks {
+		if u, err := url.Parse(webhook.URL); err == nil && u.Host != "" {
+			webhook.URL = u.Scheme + "://" + u.Host + "/****"
+		} else {
+			webhook.URL = mask(webhook.URL)
+		}
+		masked.Notify.Webhooks[i] = webhook
+	}
+	return &masked
+}
+
+// mask hides all but the last four characters of a secret
+func mask(s string) string {
+	if s == "" {
+		return ""
+	}
+	if len(s) <= 8 {
+		return "****"
+	}
+	return "****" + s[len(s)-4:]
+}
+
+// walkFields calls fn for every string, number and bool setting of a config
+// struct and for its lists, with the dotted key of each
+func walkFields(v reflect.Value, prefix string, fn func(key string, field reflect.Value, def reflect.StructField)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		def := t.Field(i)
+		name, _, _ := strings.Cut(def.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		if def.Type.Kind() == reflect.Struct {
+			walkFields(v.Field(i), key+".", fn)
+			continue
+		}
+		fn(key, v.Field(i), def)
+	}
+}
+
+// SetInFile sets the value of a key, as Set does, in the config file at
+// path. Only the value is replaced, or the key added to its object, so the
+// comments and layout of the file are kept.
+func SetInFile(path, key, value string) error {
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Set(key, value); err != nil {
+		return err
+	}
+	var encoded []byte
+	walkFields(reflect.ValueOf(cfg).Elem(), "", func(name string, v reflect.Value, _ reflect.StructField) {
+		if name == key {
+			encoded, err = json.Marshal(v.Interface())
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	data, err = setValue(data, strings.Split(key, "."), encoded)
+	if err != nil {
+		return fmt.Errorf("failed to edit config file: %w", err)
+	}
+	if err := os.WriteFile(path, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// setValue returns the config file data with the value of the member at
+// path replaced by value, or the member added to the innermost object of
+// path that exists
+func setValue(data []byte, path []string, value []byte) ([]byte, error) {
+	// Blanking the comments keeps the offsets of the data
+	plain := make([]byte, len(data))
+	copy(plain, data)
+	offset := 0
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "//") {
+			for i := offset; i < offset+len(strings.TrimRight(line, "\n")); i++ {
+				plain[i] = ' '
+			}
+		}
+		offset += len(line)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(plain))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("the file doesn't hold an object")
+	}
+	for depth := 1; ; {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == json.Delim('}') {
+			// The member is missing: add it, and the objects it is in
+			end := int(dec.InputOffset()) - 1
+			member := value
+			for i := len(path) - 1; i > 0; i-- {
+				member = []byte(fmt.Sprintf("{%q: %s}", path[i], member))
+			}
+			return insertMember(data, plain, end, depth, path[0], member), nil
+		}
+		name, _ := tok.(string)
+		if name != path[0] {
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// The value starts after the colon following the name
+		start := int(dec.InputOffset())
+		start += bytes.IndexByte(plain[start:], ':') + 1
+		for start < len(plain) && isSpace(plain[start]) {
+			start++
+		}
+		if len(path) > 1 {
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+				return nil, fmt.Errorf("%s is not an object", name)
+			}
+			path = path[1:]
+			depth++
+			continue
+		}
+		var old json.RawMessage
+		if err := dec.Decode(&old); err != nil {
+			return nil, err
+		}
+		end := int(dec.InputOffset())
+		return append(append(append([]byte{}, data[:start]...), value...), data[end:]...), nil
+	}
+}
+
+// insertMember adds a member to the object closed by the brace at end, at
+// depth levels of nesting, indented like the template
+func insertMember(data, plain []byte, end, depth int, name string, value []byte) []byte {
+	last := end - 1
+	for last >= 0 && isSpace(plain[last]) {
+		last--
+	}
+	member := fmt.Sprintf("\n%s%q: %s", strings.Repeat("  ", depth), name, value)
+	if plain[last] != '{' {
+		member = "," + member
+	}
+	// Comments after the last member are kept, after the new one
+	if !bytes.Contains(data[last+1:end], []byte("\n")) {
+		member += "\n" + strings.Repeat("  ", depth-1)
+	}
+	return append(append(append([]byte{}, data[:last+1]...), member...), data[last+1:]...)
+}
+
+// isSpace reports whether c is JSON whitespace
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,197 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// StatusUpdate is a change to the processing or upload state of a file.
+// Fields left empty don't change the file.
+type StatusUpdate struct {
+	ID          int64
+	Processed   bool // Marks the file processed
+	UploadedURL string
+	UploadTime  time.Time
+}
+
+// UpdateFileStatusBatch applies status updates in a single transaction with
+// one prepared statement, which is much faster than updating the files one
+// at a time. Either all of them are applied or none.
+func (db *DB) UpdateFileStatusBatch(updates []StatusUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+	UPDATE files
+	SET processed = processed OR ?,
+	    uploaded_url = COALESCE(NULLIF(?, ''), uploaded_url),
+	    upload_time = COALESCE(?, upload_time)
+	WHERE id = ?
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, update := range updates {
+		uploadTime := sql.NullTime{Time: update.UploadTime, Valid: !update.UploadTime.IsZero()}
+		if _, err := stmt.Exec(update.Processed, update.UploadedURL, uploadTime, update.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// InsertFilesBatch adds catalog entries for files in a single transaction,
+// leaving existing entries with the same path untouched. It returns how many
+// were added.
+func (db *DB) InsertFilesBatch(files []*FileStatus) (int, error) {
+	if len(files) == 0 {
+		return 0, nil
+	}
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+	INSERT INTO files (path, relative_path, size, mod_time, is_dir, content_type, sha256, sha1,
+	                   processed, uploaded_url, upload_time, scanned_at)
+	VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''), ?, ?)
+	ON CONFLICT(path) DO NOTHING
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	added := 0
+	for _, file := range files {
+		result, err := stmt.Exec(file.Path, file.RelativePath, file.Size, file.ModTime, file.IsDir,
+			file.ContentType, file.SHA256, file.SHA1, file.Processed, file.UploadedURL, file.UploadTime,
+			file.ScannedAt)
+		if err != nil {
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		added += int(n)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// GetFilesPage retrieves up to limit files that haven't been deleted, with
+// IDs above afterID, in ID order. Passing the ID of the last file of a page
+// gets the next one, so the whole catalog can be read in pages of bounded
+// size without holding a query open; an empty page is the end.
+func (db *DB) GetFilesPage(afterID int64, limit int) ([]*FileStatus, error) {
+	rows, err := db.conn.Query(`
+	SELECT `+fileColumns+`
+	FROM files
+	WHERE id > ? AND deleted_at IS NULL
+	ORDER BY id
+	LIMIT ?
+	`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make([]*FileStatus, 0, limit)
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// Extraction is the text extracted from a file and how it was extracted
+type Extraction struct {
+	FileID    int64
+	Extractor string
+	Quality   float64
+	Text      string
+	// Metadata replaces the metadata stored for the file
+	Metadata map[string]string
+	// Processed marks the file processed, when its text is all that is
+	// kept of it
+	Processed bool
+	// Provenance, if set, is recorded along with the text
+	Provenance *Provenance
+}
+
+// SaveExtractions stores the extracted text and metadata of files, replacing
+// any earlier ones, along with the extractor, quality and provenance of each,
+// in a single transaction. Either all of them are stored or none.
+func (db *DB) SaveExtractions(extractions []Extraction) error {
+	if len(extractions) == 0 {
+		return nil
+	}
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	files, err := tx.Prepare(`
+	UPDATE files
+	SET extractor = ?, extract_quality = ?, processed = processed OR ?
+	WHERE id = ?
+	`)
+	if err != nil {
+		return err
+	}
+	defer files.Close()
+	texts, err := tx.Prepare(`
+	INSERT OR REPLACE INTO file_text (file_id, text, updated_at)
+	VALUES (?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer texts.Close()
+	provenance, err := tx.Prepare(insertProvenance)
+	if err != nil {
+		return err
+	}
+	defer provenance.Close()
+
+	now := time.Now()
+	for _, e := range extractions {
+		if _, err := files.Exec(e.Extractor, e.Quality, e.Processed, e.FileID); err != nil {
+			return err
+		}
+		if _, err := texts.Exec(e.FileID, e.Text, now); err != nil {
+			return err
+		}
+		if err := replaceMetadata(tx, e.FileID, e.Metadata); err != nil {
+			return err
+		}
+		if e.Provenance == nil {
+			continue
+		}
+		result, err := provenance.Exec(provenanceArgs(e.Provenance)...)
+		if err != nil {
+			return err
+		}
+		if e.Provenance.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBatches(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	var files []*FileStatus
+	for i := 0; i < 5; i++ {
+		files = append(files, &FileStatus{Path: fmt.Sprintf("/drive/file%d.txt", i), RelativePath: fmt.Sprintf("file%d.txt", i),
+			Size: int64(i), ModTime: time.Now()})
+	}
+	added, err := database.InsertFilesBatch(append(files, files[0]))
+	if err != nil || added != 5 {
+		t.Fatalf("InsertFilesBatch = %d, %v; want 5 added", added, err)
+	}
+
+	var ids []int64
+	for afterID := int64(0); ; {
+		page, err := database.GetFilesPage(afterID, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		if len(page) > 2 {
+			t.Fatalf("page of %d files, want at most 2", len(page))
+		}
+		for _, file := range page {
+			ids = append(ids, file.ID)
+		}
+		afterID = page[len(page)-1].ID
+	}
+	if len(ids) != 5 {
+		t.Fatalf("paged through %v, want 5 files", ids)
+	}
+
+	uploaded := time.UnixMilli(1700000000000)
+	err = database.UpdateFileStatusBatch([]StatusUpdate{
+		{ID: ids[0], Processed: true},
+		{ID: ids[1], UploadedURL: "https://f000.backblazeb2.com/file/archive/file1.txt", UploadTime: uploaded},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := database.GetFileByID(ids[0])
+	second, _ := database.GetFileByID(ids[1])
+	if !first.Processed || first.UploadedURL != "" {
+		t.Errorf("first file = processed %v, uploaded %q; want processed only", first.Processed, first.UploadedURL)
+	}
+	if second.Processed || second.UploadedURL == "" || !second.UploadTime.Time.Equal(uploaded) {
+		t.Errorf("second file = processed %v, uploaded %q at %v; want uploaded only", second.Processed,
+			second.UploadedURL, second.UploadTime.Time)
+	}
+}
+
+func TestUnprocessedPages(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	var files []*FileStatus
+	for i := 0; i < 5; i++ {
+		files = append(files, &FileStatus{Path: fmt.Sprintf("/drive/file%d.txt", i), RelativePath: fmt.Sprintf("file%d.txt", i),
+			ModTime: time.Now()})
+	}
+	files = append(files, &FileStatus{Path: "/other/notes.txt", RelativePath: "notes.txt", ModTime: time.Now()})
+	if _, err := database.InsertFilesBatch(files); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files processed while paging are not read again
+	var paths []string
+	err = database.ForEachUnprocessedPage("/drive", 2, func(page []*FileStatus) error {
+		for _, file := range page {
+			paths = append(paths, file.Path)
+			if err := database.MarkProcessed(file.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 5 || paths[0] != "/drive/file0.txt" || paths[4] != "/drive/file4.txt" {
+		t.Errorf("paged through %v, want the 5 files below /drive in path order", paths)
+	}
+
+	remaining, err := database.GetUnprocessedFiles("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 1 || remaining[0].Path != "/other/notes.txt" {
+		t.Errorf("unprocessed = %v, want /other/notes.txt", remaining)
+	}
+}
+
+func TestSaveExtractions(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	files := []*FileStatus{
+		{Path: "/drive/report.pdf", RelativePath: "report.pdf", ModTime: time.Now()},
+		{Path: "/drive/notes.txt", RelativePath: "notes.txt", ModTime: time.Now()},
+	}
+	if _, err := database.InsertFilesBatch(files); err != nil {
+		t.Fatal(err)
+	}
+	report, _ := database.GetFileByPath("/drive/report.pdf")
+	notes, _ := database.GetFileByPath("/drive/notes.txt")
+
+	err = database.SaveExtractions([]Extraction{
+		{FileID: report.ID, Extractor: "pdftotext", Quality: 0.9, Text: "Annual report",
+			Metadata:   map[string]string{"pages": "12", "title": "Annual report", "author": ""},
+			Provenance: &Provenance{FileID: report.ID, Artifact: ArtifactExtraction, Tool: "pdftotext"}},
+		{FileID: notes.ID, Extractor: "native", Quality: 1, Text: "Meeting notes", Processed: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, _ = database.GetFileByID(report.ID)
+	notes, _ = database.GetFileByID(notes.ID)
+	if report.Extractor != "pdftotext" || report.ExtractQuality != 0.9 {
+		t.Errorf("extraction = %s at %v, want pdftotext at 0.9", report.Extractor, report.ExtractQuality)
+	}
+	if report.Processed || !notes.Processed {
+		t.Errorf("processed = %v, %v; want only the notes marked", report.Processed, notes.Processed)
+	}
+	if text, err := database.GetText(report.ID); err != nil || text != "Annual report" {
+		t.Errorf("text = %q, %v", text, err)
+	}
+	metadata, err := database.GetMetadata(report.ID)
+	if err != nil || len(metadata) != 2 || metadata["pages"] != "12" {
+		t.Errorf("metadata = %v, %v; want the pages and title", metadata, err)
+	}
+	records, err := database.GetProvenance(report.ID)
+	if err != nil || len(records) != 1 || records[0].Tool != "pdftotext" || records[0].ID == 0 {
+		t.Errorf("provenance = %+v, %v; want the pdftotext extraction", records, err)
+	}
+	if records, _ := database.GetProvenance(notes.ID); len(records) != 0 {
+		t.Errorf("provenance of the notes = %+v, want none", records)
+	}
+}
+
+func TestMetadataReplaced(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	if _, err := database.InsertFilesBatch([]*FileStatus{{Path: "/drive/deeds.pdf", RelativePath: "deeds.pdf", ModTime: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	file, _ := database.GetFileByPath("/drive/deeds.pdf")
+	if err := database.SetMetadata(file.ID, map[string]string{"title": "Deeds", "pages": "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SetMetadata(file.ID, map[string]string{"pages": "4"}); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := database.GetMetadata(file.ID)
+	if err != nil || len(metadata) != 1 || metadata["pages"] != "4" {
+		t.Errorf("metadata = %v, %v; want only the new page count", metadata, err)
+	}
+
+	if err := database.PurgeFile(file.ID); err != nil {
+		t.Fatal(err)
+	}
+	if metadata, _ := database.GetMetadata(file.ID); len(metadata) != 0 {
+		t.Errorf("metadata of a purged file = %v", metadata)
+	}
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"strconv"
+	"time"
+)
+
+// ImageHash is the perceptual fingerprint of a photo, kept until its
+// content changes
+type ImageHash struct {
+	FileID    int64
+	SHA256    string // Content the fingerprint was taken of
+	Hash      uint64
+	Width     int
+	Height    int
+	Sharpness float64
+}
+
+// SaveImageHash stores the fingerprint of a photo, replacing any earlier one
+func (db *DB) SaveImageHash(h *ImageHash) error {
+	_, err := db.conn.Exec(`
+	INSERT INTO image_hashes (file_id, sha256, dhash, width, height, sharpness, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (file_id) DO UPDATE
+	SET sha256 = excluded.sha256, dhash = excluded.dhash, width = excluded.width, height = excluded.height,
+		sharpness = excluded.sharpness, created_at = excluded.created_at
+	`, h.FileID, h.SHA256, strconv.FormatUint(h.Hash, 16), h.Width, h.Height, h.Sharpness, time.Now())
+	return err
+}
+
+// GetImageHashes returns the stored fingerprints by file ID
+func (db *DB) GetImageHashes() (map[int64]*ImageHash, error) {
+	rows, err := db.conn.Query("SELECT file_id, sha256, dhash, width, height, sharpness FROM image_hashes")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := make(map[int64]*ImageHash)
+	for rows.Next() {
+		h := &ImageHash{}
+		var hash string
+		if err := rows.Scan(&h.FileID, &h.SHA256, &hash, &h.Width, &h.Height, &h.Sharpness); err != nil {
+			return nil, err
+		}
+		if h.Hash, err = strconv.ParseUint(hash, 16, 64); err != nil {
+			continue
+		}
+		hashes[h.FileID] = h
+	}
+	return hashes, rows.Err()
+}
+
+// SetBursts records which burst the given photos are in, as the ID of the
+// burst's best photo by file ID. Photos of fileIDs missing from best are in
+// no burst; bursts of other photos are left as they are.
+func (db *DB) SetBursts(fileIDs []int64, best map[int64]int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range fileIDs {
+		if _, err := tx.Exec("DELETE FROM photo_bursts WHERE file_id = ?", id); err != nil {
+			return err
+		}
+		bestID, ok := best[id]
+		if !ok {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO photo_bursts (file_id, best_id) VALUES (?, ?)", id, bestID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetBursts returns the ID of the best photo of each photo's burst, by file
+// ID. The best photo maps to itself.
+func (db *DB) GetBursts() (map[int64]int64, error) {
+	rows, err := db.conn.Query("SELECT file_id, best_id FROM photo_bursts")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	best := make(map[int64]int64)
+	for rows.Next() {
+		var id, bestID int64
+		if err := rows.Scan(&id, &bestID); err != nil {
+			return nil, err
+		}
+		best[id] = bestID
+	}
+	return best, rows.Err()
+}
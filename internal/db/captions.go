@@ -0,0 +1,33 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SetCaption stores the one-line description of a photo and the model that
+// wrote it, replacing any earlier one
+func (db *DB) SetCaption(fileID int64, caption, model string) error {
+	_, err := db.conn.Exec(`
+	INSERT INTO captions (file_id, caption, model, created_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (file_id) DO UPDATE
+	SET caption = excluded.caption, model = excluded.model, created_at = excluded.created_at
+	`, fileID, caption, model, time.Now())
+	return err
+}
+
+// GetCaption returns the caption of a photo, or "" if it has none
+func (db *DB) GetCaption(fileID int64) (string, error) {
+	var caption string
+	err := db.conn.QueryRow("SELECT caption FROM captions WHERE file_id = ?", fileID).Scan(&caption)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return caption, err
+}
+
+// GetUncaptionedFiles returns the files that have no caption yet
+func (db *DB) GetUncaptionedFiles() ([]*FileStatus, error) {
+	return db.FindFiles("id NOT IN (SELECT file_id FROM captions)")
+}
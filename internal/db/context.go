@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ctxConn runs the statements of a DB with the context it is bound to, so
+// that cancelling the context stops a query or transaction in progress
+type ctxConn struct {
+	*sql.DB
+	ctx context.Context
+}
+
+// Exec runs a statement with the bound context
+func (c ctxConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.ExecContext(c.ctx, query, args...)
+}
+
+// Query runs a query with the bound context
+func (c ctxConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.QueryContext(c.ctx, query, args...)
+}
+
+// QueryRow runs a query returning at most one row with the bound context
+func (c ctxConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRowContext(c.ctx, query, args...)
+}
+
+// Begin starts a transaction, which is rolled back if the bound context is
+// cancelled before it is committed
+func (c ctxConn) Begin() (*sql.Tx, error) {
+	return c.DB.BeginTx(c.ctx, nil)
+}
+
+// Ping checks the connection with the bound context
+func (c ctxConn) Ping() error {
+	return c.DB.PingContext(c.ctx)
+}
+
+// WithContext returns a DB using the same connections whose queries and
+// transactions stop when ctx is done, returning its error. The DB it was
+// made from is unaffected; only the DB returned by Open needs closing.
+func (db *DB) WithContext(ctx context.Context) *DB {
+	bound := *db
+	bound.conn = ctxConn{DB: db.conn.DB, ctx: ctx}
+	return &bound
+}
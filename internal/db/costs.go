@@ -0,0 +1,141 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Cost kinds
+const (
+	CostLLM    = "llm"       // A summarization request
+	CostEgress = "b2_egress" // Downloaded from B2, estimated at list price
+)
+
+// Cost is money spent, or estimated to be spent, on an external service
+type Cost struct {
+	ID        int64
+	RunID     int64 // 0 when not part of a run
+	FileID    int64
+	Kind      string
+	Provider  string
+	Model     string
+	Amount    float64 // USD
+	Bytes     int64   // Transferred, for egress
+	CreatedAt time.Time
+}
+
+// RecordCost stores a cost. CreatedAt defaults to now.
+func (db *DB) RecordCost(c *Cost) error {
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now()
+	}
+
+	result, err := db.conn.Exec(`
+	INSERT INTO costs (run_id, file_id, kind, provider, model, amount, bytes, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, nullID(c.RunID), nullID(c.FileID), c.Kind, c.Provider, c.Model, c.Amount, c.Bytes, c.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	c.ID, err = result.LastInsertId()
+	return err
+}
+
+// nullID stores an unset ID as NULL
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// TotalCost returns the lifetime spend of a kind, or of every kind if kind
+// is empty
+func (db *DB) TotalCost(kind string) (float64, error) {
+	var total sql.NullFloat64
+	err := db.conn.QueryRow("SELECT SUM(amount) FROM costs WHERE ? = '' OR kind = ?", kind, kind).Scan(&total)
+	return total.Float64, err
+}
+
+// CostGroup totals the costs sharing a key
+type CostGroup struct {
+	Key      string
+	Requests int64
+	Amount   float64
+	Bytes    int64
+}
+
+// costKeys are the SQL expressions costs can be grouped by
+var costKeys = map[string]string{
+	"day":      "substr(c.created_at, 1, 10)",
+	"run":      "COALESCE(r.id || ' ' || r.command, '(no run)')",
+	"provider": "COALESCE(NULLIF(c.provider, ''), '(none)')",
+	"model":    "COALESCE(NULLIF(c.model, ''), '(none)')",
+	"kind":     "c.kind",
+}
+
+// CostsBy totals the costs since a time (or all of them, if since is zero)
+// by day, run, provider, model or kind. Days and runs are listed newest
+// first, the others by amount.
+func (db *DB) CostsBy(dimension string, since time.Time) ([]CostGroup, error) {
+	key, ok := costKeys[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown cost grouping %q (expected day, run, provider, model or kind)", dimension)
+	}
+	order := "SUM(c.amount) DESC, grp"
+	switch dimension {
+	case "day":
+		order = "grp DESC"
+	case "run":
+		order = "MAX(c.run_id) IS NULL, MAX(c.run_id) DESC"
+	}
+
+	return db.costGroups(key, "c.created_at >= ?", order, since)
+}
+
+// RunCostsBy totals the costs of a run by provider, model or kind, largest
+// first
+func (db *DB) RunCostsBy(runID int64, dimension string) ([]CostGroup, error) {
+	key, ok := costKeys[dimension]
+	if !ok || dimension == "day" || dimension == "run" {
+		return nil, fmt.Errorf("unknown cost grouping %q for a run (expected provider, model or kind)", dimension)
+	}
+	return db.costGroups(key, "c.run_id = ?", "SUM(c.amount) DESC, grp", runID)
+}
+
+// costGroups totals the costs matching where by the key expression
+func (db *DB) costGroups(key, where, order string, args ...interface{}) ([]CostGroup, error) {
+	rows, err := db.conn.Query(`
+	SELECT `+key+` AS grp, COUNT(*), SUM(c.amount), SUM(c.bytes)
+	FROM costs c LEFT JOIN runs r ON r.id = c.run_id
+	WHERE `+where+`
+	GROUP BY grp
+	ORDER BY `+order, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []CostGroup
+	for rows.Next() {
+		var group CostGroup
+		if err := rows.Scan(&group.Key, &group.Requests, &group.Amount, &group.Bytes); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// StoredBytes totals the size of the uploads in the catalog, counting
+// uploads shared by several files once. Deleted files count until purged,
+// as their uploads are still stored.
+func (db *DB) StoredBytes() (int64, error) {
+	var total int64
+	err := db.conn.QueryRow(`
+	SELECT COALESCE(SUM(size), 0) FROM (
+		SELECT MAX(size) AS size FROM files
+		WHERE uploaded_url IS NOT NULL AND uploaded_url != ''
+		GROUP BY uploaded_url
+	)`).Scan(&total)
+	return total, err
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCosts(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	run, err := database.StartRun("archive", "/Volumes/A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	yesterday := time.Now().AddDate(0, 0, -1)
+	for _, cost := range []*Cost{
+		{RunID: run.ID, FileID: 1, Kind: CostLLM, Provider: "openai", Model: "gpt-4o", Amount: 0.10, CreatedAt: yesterday},
+		{RunID: run.ID, FileID: 2, Kind: CostLLM, Provider: "anthropic", Model: "claude-3-haiku", Amount: 0.05},
+		{FileID: 3, Kind: CostLLM, Provider: "openai", Model: "gpt-4o", Amount: 0.02},
+		{FileID: 1, Kind: CostEgress, Provider: "b2", Amount: 0.01, Bytes: 1 << 30},
+	} {
+		if err := database.RecordCost(cost); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for kind, want := range map[string]float64{"": 0.18, CostLLM: 0.17, CostEgress: 0.01, "other": 0} {
+		if total, err := database.TotalCost(kind); err != nil || math.Abs(total-want) > 1e-9 {
+			t.Errorf("TotalCost(%q) = %v, %v; want %v", kind, total, err, want)
+		}
+	}
+
+	check := func(name string, groups []CostGroup, err error, want ...CostGroup) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(groups) != len(want) {
+			t.Fatalf("%s = %+v, want %+v", name, groups, want)
+		}
+		for i := range want {
+			got := groups[i]
+			if got.Key != want[i].Key || got.Requests != want[i].Requests || got.Bytes != want[i].Bytes ||
+				math.Abs(got.Amount-want[i].Amount) > 1e-9 {
+				t.Errorf("%s[%d] = %+v, want %+v", name, i, got, want[i])
+			}
+		}
+	}
+
+	groups, err := database.CostsBy("provider", time.Time{})
+	check("by provider", groups, err,
+		CostGroup{Key: "openai", Requests: 2, Amount: 0.12},
+		CostGroup{Key: "anthropic", Requests: 1, Amount: 0.05},
+		CostGroup{Key: "b2", Requests: 1, Amount: 0.01, Bytes: 1 << 30})
+	groups, err = database.CostsBy("kind", time.Time{})
+	check("by kind", groups, err,
+		CostGroup{Key: CostLLM, Requests: 3, Amount: 0.17},
+		CostGroup{Key: CostEgress, Requests: 1, Amount: 0.01, Bytes: 1 << 30})
+	groups, err = database.CostsBy("run", time.Time{})
+	check("by run", groups, err,
+		CostGroup{Key: "1 archive", Requests: 2, Amount: 0.15},
+		CostGroup{Key: "(no run)", Requests: 2, Amount: 0.03, Bytes: 1 << 30})
+	groups, err = database.CostsBy("day", time.Time{})
+	check("by day", groups, err,
+		CostGroup{Key: time.Now().Format("2006-01-02"), Requests: 3, Amount: 0.08, Bytes: 1 << 30},
+		CostGroup{Key: yesterday.Format("2006-01-02"), Requests: 1, Amount: 0.10})
+	groups, err = database.CostsBy("model", time.Now().Add(-time.Hour))
+	check("by model since an hour ago", groups, err,
+		CostGroup{Key: "claude-3-haiku", Requests: 1, Amount: 0.05},
+		CostGroup{Key: "gpt-4o", Requests: 1, Amount: 0.02},
+		CostGroup{Key: "(none)", Requests: 1, Amount: 0.01, Bytes: 1 << 30})
+	groups, err = database.RunCostsBy(run.ID, "provider")
+	check("run by provider", groups, err,
+		CostGroup{Key: "openai", Requests: 1, Amount: 0.10},
+		CostGroup{Key: "anthropic", Requests: 1, Amount: 0.05})
+
+	if _, err := database.CostsBy("colour", time.Time{}); err == nil {
+		t.Error("CostsBy an unknown grouping succeeded")
+	}
+	if _, err := database.RunCostsBy(run.ID, "day"); err == nil {
+		t.Error("RunCostsBy day succeeded")
+	}
+}
+
+func TestStoredBytes(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	if stored, err := database.StoredBytes(); err != nil || stored != 0 {
+		t.Errorf("StoredBytes of an empty catalog = %d, %v", stored, err)
+	}
+
+	files := []*FileStatus{
+		{Path: "/a/report.pdf", RelativePath: "report.pdf", Size: 100, ModTime: time.Now()},
+		{Path: "/b/report.pdf", RelativePath: "report.pdf", Size: 100, ModTime: time.Now()},
+		{Path: "/a/photo.jpg", RelativePath: "photo.jpg", Size: 50, ModTime: time.Now()},
+		{Path: "/a/notes.txt", RelativePath: "notes.txt", Size: 70, ModTime: time.Now()},
+	}
+	if _, err := database.InsertFilesBatch(files); err != nil {
+		t.Fatal(err)
+	}
+	urls := []string{"https://b2/report.pdf", "https://b2/report.pdf", "https://b2/photo.jpg", ""}
+	var updates []StatusUpdate
+	for i, file := range files {
+		stored, err := database.GetFileByPath(file.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.ID = stored.ID
+		if urls[i] != "" {
+			updates = append(updates, StatusUpdate{ID: stored.ID, UploadedURL: urls[i], UploadTime: time.Now()})
+		}
+	}
+	if err := database.UpdateFileStatusBatch(updates); err != nil {
+		t.Fatal(err)
+	}
+	// Deleted files are stored until purged
+	if err := database.MarkDeleted(files[2].ID, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if stored, err := database.StoredBytes(); err != nil || stored != 150 {
+		t.Errorf("StoredBytes = %d, %v; want 150, the shared upload counted once", stored, err)
+	}
+	if err := database.PurgeFile(files[2].ID); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := database.StoredBytes(); err != nil || stored != 100 {
+		t.Errorf("StoredBytes after purging = %d, %v; want 100", stored, err)
+	}
+}
@@ -1,12 +1,15 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/jth/archiver/internal/pathnorm"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -17,18 +20,92 @@ type FileStatus struct {
 	RelativePath string
 	Size         int64
 	ModTime      time.Time
+	ScannedAt    sql.NullTime // When the file was last scanned
 	IsDir        bool
 	ContentType  string
 	SHA256       string
+	SHA1         string // Checksum reported by remote storage, for adopted files
 	Processed    bool
 	UploadedURL  string
 	UploadTime   sql.NullTime
+	UploadSHA256 string       // Content hash when the file was last uploaded
+	RemoteName   string       // Name in the bucket of the last upload
+	TakenAt      sql.NullTime // EXIF date a photo was taken, in camera time
 	Summary      string
+
+	// Extraction details recorded when the document text was last extracted
+	Extractor      string
+	ExtractQuality float64
+	SummaryModel   string
+
+	// Set when the file has been soft-deleted from the catalog
+	DeletedAt    sql.NullTime
+	DeleteReason string
+}
+
+// fileColumns is the column list matching scanFile, in order
+const fileColumns = `id, path, relative_path, size, mod_time, is_dir, content_type,
+	       sha256, processed, uploaded_url, upload_time, summary,
+	       extractor, extract_quality, summary_model, deleted_at, delete_reason,
+	       sha1, upload_sha256, scanned_at, remote_name, taken_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanFile scans a row selected with fileColumns into a FileStatus
+func scanFile(row rowScanner) (*FileStatus, error) {
+	var file FileStatus
+	var contentType, sha, uploadedURL, summary sql.NullString
+	var extractor, summaryModel, deleteReason, sha1, uploadSHA, remoteName sql.NullString
+	var extractQuality sql.NullFloat64
+	err := row.Scan(
+		&file.ID,
+		&file.Path,
+		&file.RelativePath,
+		&file.Size,
+		&file.ModTime,
+		&file.IsDir,
+		&contentType,
+		&sha,
+		&file.Processed,
+		&uploadedURL,
+		&file.UploadTime,
+		&summary,
+		&extractor,
+		&extractQuality,
+		&summaryModel,
+		&file.DeletedAt,
+		&deleteReason,
+		&sha1,
+		&uploadSHA,
+		&file.ScannedAt,
+		&remoteName,
+		&file.TakenAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	file.ContentType = contentType.String
+	file.SHA256 = sha.String
+	file.UploadedURL = uploadedURL.String
+	file.Summary = summary.String
+	file.Extractor = extractor.String
+	file.ExtractQuality = extractQuality.Float64
+	file.SummaryModel = summaryModel.String
+	file.DeleteReason = deleteReason.String
+	file.SHA1 = sha1.String
+	file.UploadSHA256 = uploadSHA.String
+	file.RemoteName = remoteName.String
+
+	return &file, nil
 }
 
 // DB provides a database connection and utility functions
 type DB struct {
-	conn *sql.DB
+	conn ctxConn
 }
 
 // Open opens a connection to the database
@@ -39,12 +116,12 @@ func Open(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	conn, err := sql.Open("sqlite3", dbPath)
+	conn, err := sql.Open("sqlite3", DSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	db := &DB{conn: conn}
+	db := &DB{conn: ctxConn{DB: conn, ctx: context.Background()}}
 
 	// Verify connection
 	if err := db.conn.Ping(); err != nil {
@@ -52,6 +129,12 @@ func Open(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// Bring the schema up to date
+	if err := Migrate(db.conn.DB); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return db, nil
 }
 
@@ -60,33 +143,31 @@ func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
-// GetFileByPath retrieves a file by its path
+// GetFileByPath retrieves a file by its path, or by the same path written
+// in another Unicode normalization
 func (db *DB) GetFileByPath(path string) (*FileStatus, error) {
 	query := `
-	SELECT id, path, relative_path, size, mod_time, is_dir, content_type, 
-	       sha256, processed, uploaded_url, upload_time, summary
+	SELECT ` + fileColumns + `
 	FROM files
-	WHERE path = ?
+	WHERE path = ? OR path_key = ?
+	ORDER BY path = ? DESC
+	LIMIT 1
 	`
 
-	row := db.conn.QueryRow(query, path)
+	file, err := scanFile(db.conn.QueryRow(query, path, pathnorm.NFC(path), path))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	var file FileStatus
-	err := row.Scan(
-		&file.ID,
-		&file.Path,
-		&file.RelativePath,
-		&file.Size,
-		&file.ModTime,
-		&file.IsDir,
-		&file.ContentType,
-		&file.SHA256,
-		&file.Processed,
-		&file.UploadedURL,
-		&file.UploadTime,
-		&file.Summary,
-	)
+	return file, nil
+}
 
+// GetFileByID retrieves a file by its ID
+func (db *DB) GetFileByID(id int64) (*FileStatus, error) {
+	file, err := scanFile(db.conn.QueryRow("SELECT "+fileColumns+" FROM files WHERE id = ?", id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -94,20 +175,66 @@ func (db *DB) GetFileByPath(path string) (*FileStatus, error) {
 		return nil, err
 	}
 
-	return &file, nil
+	return file, nil
 }
 
-// GetUnprocessedFiles retrieves all unprocessed files
-func (db *DB) GetUnprocessedFiles() ([]*FileStatus, error) {
+// GetUnprocessedFiles retrieves the unprocessed files below root, or all of
+// them when root is empty, leaving out quarantined files
+func (db *DB) GetUnprocessedFiles(root string) ([]*FileStatus, error) {
+	var files []*FileStatus
+	err := db.ForEachUnprocessedPage(root, 1000, func(page []*FileStatus) error {
+		files = append(files, page...)
+		return nil
+	})
+	return files, err
+}
+
+// ForEachUnprocessedPage streams the unprocessed files below root, or all of
+// them when root is empty, to fn in path order, pageSize files at a time,
+// leaving out quarantined files. Each page is read with a query of its own
+// that starts after the last path of the one before, so memory stays bounded,
+// fn may write to the database, and files processed in the meantime aren't
+// read again. Iteration stops at the first error returned by fn.
+func (db *DB) ForEachUnprocessedPage(root string, pageSize int, fn func([]*FileStatus) error) error {
 	query := `
-	SELECT id, path, relative_path, size, mod_time, is_dir, content_type, 
-	       sha256, processed, uploaded_url, upload_time, summary
+	SELECT ` + fileColumns + `
 	FROM files
-	WHERE processed = FALSE AND is_dir = FALSE
+	WHERE processed = FALSE AND is_dir = FALSE AND deleted_at IS NULL
+	  AND path NOT IN (SELECT path FROM quarantine)
+	  AND (? = '' OR path LIKE ? ESCAPE '\')
+	  AND path > ?
 	ORDER BY path
+	LIMIT ?
 	`
+	below := escapeLike(strings.TrimSuffix(root, "/")) + "/%"
+
+	after := ""
+	for {
+		var page []*FileStatus
+		err := db.forEachFile(func(file *FileStatus) error {
+			page = append(page, file)
+			return nil
+		}, query, root, below, after, pageSize)
+		if err != nil || len(page) == 0 {
+			return err
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		after = page[len(page)-1].Path
+	}
+}
 
-	rows, err := db.conn.Query(query)
+// GetFilesByType retrieves files by MIME type prefix
+func (db *DB) GetFilesByType(typePrefix string) ([]*FileStatus, error) {
+	query := `
+	SELECT ` + fileColumns + `
+	FROM files
+	WHERE content_type LIKE ? AND is_dir = FALSE AND deleted_at IS NULL
+	ORDER BY path
+	`
+
+	rows, err := db.conn.Query(query, typePrefix+"%")
 	if err != nil {
 		return nil, err
 	}
@@ -115,25 +242,11 @@ func (db *DB) GetUnprocessedFiles() ([]*FileStatus, error) {
 
 	var files []*FileStatus
 	for rows.Next() {
-		var file FileStatus
-		err := rows.Scan(
-			&file.ID,
-			&file.Path,
-			&file.RelativePath,
-			&file.Size,
-			&file.ModTime,
-			&file.IsDir,
-			&file.ContentType,
-			&file.SHA256,
-			&file.Processed,
-			&file.UploadedURL,
-			&file.UploadTime,
-			&file.Summary,
-		)
+		file, err := scanFile(rows)
 		if err != nil {
 			return nil, err
 		}
-		files = append(files, &file)
+		files = append(files, file)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -143,17 +256,216 @@ func (db *DB) GetUnprocessedFiles() ([]*FileStatus, error) {
 	return files, nil
 }
 
-// GetFilesByType retrieves files by MIME type prefix
-func (db *DB) GetFilesByType(typePrefix string) ([]*FileStatus, error) {
+// ForEachFile streams every file record that hasn't been deleted to fn in
+// path order. When archivedOnly is set, only files that have been uploaded
+// are visited. Iteration stops at the first error returned by fn.
+func (db *DB) ForEachFile(archivedOnly bool, fn func(*FileStatus) error) error {
+	query := `
+	SELECT ` + fileColumns + `
+	FROM files
+	WHERE is_dir = FALSE AND deleted_at IS NULL`
+	if archivedOnly {
+		query += ` AND uploaded_url IS NOT NULL AND uploaded_url != ''`
+	}
+	query += `
+	ORDER BY path
+	`
+	return db.forEachFile(fn, query)
+}
+
+// ForEachFileChanged streams the files that haven't been deleted and were
+// scanned or uploaded between since and until, such as during a run, to fn
+// in path order. Files a rescan found unchanged are not visited.
+func (db *DB) ForEachFileChanged(since, until time.Time, fn func(*FileStatus) error) error {
 	query := `
-	SELECT id, path, relative_path, size, mod_time, is_dir, content_type, 
-	       sha256, processed, uploaded_url, upload_time, summary
+	SELECT ` + fileColumns + `
 	FROM files
-	WHERE content_type LIKE ? AND is_dir = FALSE
+	WHERE is_dir = FALSE AND deleted_at IS NULL
+	  AND ((scanned_at >= ? AND scanned_at <= ?) OR (upload_time >= ? AND upload_time <= ?))
 	ORDER BY path
 	`
+	return db.forEachFile(fn, query, since, until, since, until)
+}
 
-	rows, err := db.conn.Query(query, typePrefix+"%")
+// forEachFile runs a query selecting fileColumns and passes each file to fn
+func (db *DB) forEachFile(fn func(*FileStatus) error, query string, args ...interface{}) error {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(file); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Dump writes a consistent copy of the database to path using VACUUM INTO
+func (db *DB) Dump(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("destination already exists: %s", path)
+	}
+
+	if _, err := db.conn.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to dump database: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateFileStatus updates the status of a file
+func (db *DB) UpdateFileStatus(id int64, processed bool, uploadedURL string, summary string) error {
+	query := `
+	UPDATE files
+	SET processed = ?, uploaded_url = ?, upload_time = ?, summary = ?
+	WHERE id = ?
+	`
+
+	_, err := db.conn.Exec(query, processed, uploadedURL, time.Now(), summary, id)
+	return err
+}
+
+// FindFiles retrieves files matching a SQL filter expression over the files
+// table columns, e.g. "extract_quality < 0.6 OR extractor = 'fallback'".
+// Deleted files are left out.
+func (db *DB) FindFiles(where string) ([]*FileStatus, error) {
+	query := `
+	SELECT ` + fileColumns + `
+	FROM files
+	WHERE is_dir = FALSE AND deleted_at IS NULL AND (` + where + `)
+	ORDER BY path
+	`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", where, err)
+	}
+	defer rows.Close()
+
+	var files []*FileStatus
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// FindDuplicates retrieves the files whose SHA-256 is shared with another
+// file of at least minSize bytes, ordered by hash and path. Deleted files
+// are left out.
+func (db *DB) FindDuplicates(minSize int64) ([]*FileStatus, error) {
+	query := `
+	SELECT ` + fileColumns + `
+	FROM files
+	WHERE is_dir = FALSE AND deleted_at IS NULL AND sha256 IN (
+		SELECT sha256 FROM files
+		WHERE is_dir = FALSE AND deleted_at IS NULL AND sha256 IS NOT NULL AND sha256 != '' AND size >= ?
+		GROUP BY sha256
+		HAVING COUNT(*) > 1
+	)
+	ORDER BY sha256, path
+	`
+
+	rows, err := db.conn.Query(query, minSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*FileStatus
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// UpdateExtraction records which extractor produced a file's text and how
+// clean the resulting text was
+func (db *DB) UpdateExtraction(id int64, extractor string, quality float64) error {
+	query := `
+	UPDATE files
+	SET extractor = ?, extract_quality = ?
+	WHERE id = ?
+	`
+
+	_, err := db.conn.Exec(query, extractor, quality, id)
+	return err
+}
+
+// UpdateSummary replaces a file's summary without touching its upload state
+func (db *DB) UpdateSummary(id int64, summary, model string) error {
+	query := `
+	UPDATE files
+	SET summary = ?, summary_model = ?
+	WHERE id = ?
+	`
+
+	_, err := db.conn.Exec(query, summary, model, id)
+	return err
+}
+
+// MarkProcessed records that a file's text was extracted and, if it could
+// be, summarized, so that later runs skip it until its content changes
+func (db *DB) MarkProcessed(id int64) error {
+	_, err := db.conn.Exec("UPDATE files SET processed = TRUE WHERE id = ?", id)
+	return err
+}
+
+// SaveText stores the extracted text of a file, replacing any earlier text
+func (db *DB) SaveText(id int64, text string) error {
+	query := `
+	INSERT OR REPLACE INTO file_text (file_id, text, updated_at)
+	VALUES (?, ?, ?)
+	`
+
+	_, err := db.conn.Exec(query, id, text, time.Now())
+	return err
+}
+
+// GetText retrieves the extracted text of a file, or "" if none was stored
+func (db *DB) GetText(id int64) (string, error) {
+	var text string
+	err := db.conn.QueryRow("SELECT text FROM file_text WHERE file_id = ?", id).Scan(&text)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return text, err
+}
+
+// FindUploadCandidates retrieves files of the given size whose relative path
+// equals relPath or whose name equals the base name of relPath. Exact relative
+// path matches are returned first.
+func (db *DB) FindUploadCandidates(relPath string, size int64) ([]*FileStatus, error) {
+	query := `
+	SELECT ` + fileColumns + `
+	FROM files
+	WHERE is_dir = FALSE AND size = ? AND (relative_path = ? OR path LIKE ? ESCAPE '\')
+	ORDER BY relative_path = ? DESC, path
+	`
+
+	namePattern := "%/" + escapeLike(filepath.Base(relPath))
+	rows, err := db.conn.Query(query, size, relPath, namePattern, relPath)
 	if err != nil {
 		return nil, err
 	}
@@ -161,25 +473,11 @@ func (db *DB) GetFilesByType(typePrefix string) ([]*FileStatus, error) {
 
 	var files []*FileStatus
 	for rows.Next() {
-		var file FileStatus
-		err := rows.Scan(
-			&file.ID,
-			&file.Path,
-			&file.RelativePath,
-			&file.Size,
-			&file.ModTime,
-			&file.IsDir,
-			&file.ContentType,
-			&file.SHA256,
-			&file.Processed,
-			&file.UploadedURL,
-			&file.UploadTime,
-			&file.Summary,
-		)
+		file, err := scanFile(rows)
 		if err != nil {
 			return nil, err
 		}
-		files = append(files, &file)
+		files = append(files, file)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -189,25 +487,68 @@ func (db *DB) GetFilesByType(typePrefix string) ([]*FileStatus, error) {
 	return files, nil
 }
 
-// UpdateFileStatus updates the status of a file
-func (db *DB) UpdateFileStatus(id int64, processed bool, uploadedURL string, summary string) error {
+// MarkUploaded records that a file already exists in remote storage
+func (db *DB) MarkUploaded(id int64, uploadedURL string, uploadTime time.Time) error {
 	query := `
 	UPDATE files
-	SET processed = ?, uploaded_url = ?, upload_time = ?, summary = ?
+	SET uploaded_url = ?, upload_time = ?
 	WHERE id = ?
 	`
 
-	_, err := db.conn.Exec(query, processed, uploadedURL, time.Now(), summary, id)
+	_, err := db.conn.Exec(query, uploadedURL, uploadTime, id)
+	return err
+}
+
+// SetUploadedURL records a new location of a file's upload, such as after
+// moving it to another bucket
+func (db *DB) SetUploadedURL(id int64, uploadedURL string) error {
+	_, err := db.conn.Exec("UPDATE files SET uploaded_url = ? WHERE id = ?", uploadedURL, id)
+	return err
+}
+
+// RecordUpload records an upload of a file's current content under
+// remoteName, identified by its SHA-256 so later changes can be detected
+func (db *DB) RecordUpload(id int64, uploadedURL, remoteName string, uploadTime time.Time, sha256 string) error {
+	query := `
+	UPDATE files
+	SET uploaded_url = ?, remote_name = ?, remote_name_folded = ?, upload_time = ?, upload_sha256 = ?
+	WHERE id = ?
+	`
+
+	_, err := db.conn.Exec(query, uploadedURL, remoteName, pathnorm.FoldCase(remoteName), uploadTime, sha256, id)
+	return err
+}
+
+// RemoteNameOwner retrieves a file uploaded under remoteName, or nil if
+// there is none
+func (db *DB) RemoteNameOwner(remoteName string) (*FileStatus, error) {
+	file, err := scanFile(db.conn.QueryRow("SELECT "+fileColumns+" FROM files WHERE remote_name = ? LIMIT 1", remoteName))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return file, err
+}
+
+// SetTakenAt records the date a photo was taken
+func (db *DB) SetTakenAt(id int64, takenAt time.Time) error {
+	_, err := db.conn.Exec("UPDATE files SET taken_at = ? WHERE id = ?", takenAt, id)
 	return err
 }
 
+// escapeLike escapes the LIKE wildcards in s using backslash as escape character
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "%", `\%`)
+	return strings.ReplaceAll(s, "_", `\_`)
+}
+
 // GetStats returns statistics about the files in the database
 func (db *DB) GetStats() (map[string]int64, error) {
 	stats := make(map[string]int64)
 
 	// Total files
 	var totalFiles int64
-	err := db.conn.QueryRow("SELECT COUNT(*) FROM files WHERE is_dir = FALSE").Scan(&totalFiles)
+	err := db.conn.QueryRow("SELECT COUNT(*) FROM files WHERE is_dir = FALSE AND deleted_at IS NULL").Scan(&totalFiles)
 	if err != nil {
 		return nil, err
 	}
@@ -223,7 +564,7 @@ func (db *DB) GetStats() (map[string]int64, error) {
 
 	// Processed files
 	var processedFiles int64
-	err = db.conn.QueryRow("SELECT COUNT(*) FROM files WHERE processed = TRUE AND is_dir = FALSE").Scan(&processedFiles)
+	err = db.conn.QueryRow("SELECT COUNT(*) FROM files WHERE processed = TRUE AND is_dir = FALSE AND deleted_at IS NULL").Scan(&processedFiles)
 	if err != nil {
 		return nil, err
 	}
@@ -231,11 +572,19 @@ func (db *DB) GetStats() (map[string]int64, error) {
 
 	// Total size
 	var totalSize int64
-	err = db.conn.QueryRow("SELECT SUM(size) FROM files WHERE is_dir = FALSE").Scan(&totalSize)
+	err = db.conn.QueryRow("SELECT COALESCE(SUM(size), 0) FROM files WHERE is_dir = FALSE AND deleted_at IS NULL").Scan(&totalSize)
 	if err != nil {
 		return nil, err
 	}
 	stats["totalSize"] = totalSize
 
+	// Soft-deleted files awaiting purge
+	var deletedFiles int64
+	err = db.conn.QueryRow("SELECT COUNT(*) FROM files WHERE deleted_at IS NOT NULL").Scan(&deletedFiles)
+	if err != nil {
+		return nil, err
+	}
+	stats["deletedFiles"] = deletedFiles
+
 	return stats, nil
 }
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/drives"
+)
+
+// DriveSummary totals the catalog files scanned from one drive
+type DriveSummary struct {
+	Name       string
+	Files      int64
+	Uploaded   int64 // Archived: uploaded, and copied to every replica
+	Bytes      int64
+	LastUpload time.Time      // Latest upload of any of the drive's files
+	URLPrefix  string         // Longest common prefix of the upload URLs
+	Health     *drives.Health // Latest SMART snapshot of the drive, if any
+}
+
+// Complete reports whether every file from the drive has been archived
+func (s *DriveSummary) Complete() bool {
+	return s.Files > 0 && s.Uploaded == s.Files
+}
+
+// DriveSummaries totals the files in the catalog by the drive they were
+// scanned from, in order of drive name. Files not on a recognised mount and
+// deleted files are left out. Files only count as uploaded once they are
+// also copied to each of the replica destinations.
+func (db *DB) DriveSummaries(replicas ...string) ([]*DriveSummary, error) {
+	var replicated []map[int64]string
+	for _, destination := range replicas {
+		hashes, err := db.ReplicatedHashes(destination)
+		if err != nil {
+			return nil, err
+		}
+		replicated = append(replicated, hashes)
+	}
+
+	byName := make(map[string]*DriveSummary)
+	err := db.ForEachFile(false, func(file *FileStatus) error {
+		name := drives.NameFromPath(file.Path)
+		if name == "" {
+			return nil
+		}
+
+		summary := byName[name]
+		if summary == nil {
+			summary = &DriveSummary{Name: name}
+			byName[name] = summary
+		}
+		summary.Files++
+		summary.Bytes += file.Size
+		if file.UploadedURL == "" {
+			return nil
+		}
+		for _, hashes := range replicated {
+			if _, ok := hashes[file.ID]; !ok {
+				return nil
+			}
+		}
+
+		if summary.Uploaded == 0 {
+			summary.URLPrefix = file.UploadedURL
+		} else {
+			summary.URLPrefix = commonPrefix(summary.URLPrefix, file.UploadedURL)
+		}
+		summary.Uploaded++
+		if file.UploadTime.Valid && file.UploadTime.Time.After(summary.LastUpload) {
+			summary.LastUpload = file.UploadTime.Time
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*DriveSummary, 0, len(byName))
+	for _, summary := range byName {
+		if summary.Health, err = db.LatestDriveHealth(summary.Name); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return strings.ToLower(summaries[i].Name) < strings.ToLower(summaries[j].Name)
+	})
+	return summaries, nil
+}
+
+// commonPrefix returns the longest common prefix of a and b
+func commonPrefix(a, b string) string {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return a[:i]
+		}
+	}
+	return a[:n]
+}
+
+// RecordDriveHealth stores a SMART snapshot of a drive, keeping the earlier
+// ones so that sectors going bad can be followed over time
+func (db *DB) RecordDriveHealth(drive string, health *drives.Health) error {
+	_, err := db.conn.Exec(`
+	INSERT INTO drive_health (drive, device, model, serial, passed, reallocated, pending,
+		uncorrectable, power_on_hours, temperature, checked_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, drive, health.Device, health.Model, health.Serial, health.Passed, health.Reallocated, health.Pending,
+		health.Uncorrectable, health.PowerOnHours, health.Temperature, health.CheckedAt)
+	return err
+}
+
+// LatestDriveHealth returns the latest SMART snapshot of a drive, or nil if
+// it was never checked
+func (db *DB) LatestDriveHealth(drive string) (*drives.Health, error) {
+	var health drives.Health
+	var model, serial sql.NullString
+	err := db.conn.QueryRow(`
+	SELECT device, model, serial, passed, reallocated, pending, uncorrectable,
+		power_on_hours, temperature, checked_at
+	FROM drive_health
+	WHERE drive = ?
+	ORDER BY checked_at DESC, id DESC
+	LIMIT 1
+	`, drive).Scan(&health.Device, &model, &serial, &health.Passed, &health.Reallocated, &health.Pending,
+		&health.Uncorrectable, &health.PowerOnHours, &health.Temperature, &health.CheckedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	health.Model, health.Serial = model.String, serial.String
+	return &health, nil
+}
@@ -0,0 +1,54 @@
+package db
+
+// Kinds of entities extracted from documents
+const (
+	EntityPerson       = "person"
+	EntityOrganization = "organization"
+	EntityDate         = "date"
+	EntityPlace        = "place"
+	EntityDocumentType = "document_type"
+	EntityKeyword      = "keyword"
+)
+
+// SetEntities replaces the entities of a file with the given values by kind
+func (db *DB) SetEntities(fileID int64, entities map[string][]string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM file_entities WHERE file_id = ?", fileID); err != nil {
+		return err
+	}
+	for kind, values := range entities {
+		for _, value := range values {
+			_, err := tx.Exec("INSERT OR IGNORE INTO file_entities (file_id, kind, value) VALUES (?, ?, ?)",
+				fileID, kind, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// GetEntities retrieves the entities of a file by kind, each in
+// alphabetical order
+func (db *DB) GetEntities(fileID int64) (map[string][]string, error) {
+	rows, err := db.conn.Query("SELECT kind, value FROM file_entities WHERE file_id = ? ORDER BY kind, value", fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := make(map[string][]string)
+	for rows.Next() {
+		var kind, value string
+		if err := rows.Scan(&kind, &value); err != nil {
+			return nil, err
+		}
+		entities[kind] = append(entities[kind], value)
+	}
+	return entities, rows.Err()
+}
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// syncBatchSize is how many queued files are indexed per batch
+const syncBatchSize = 500
+
+// queuedFile is a file waiting in the index queue, with the version of the
+// change that queued it
+type queuedFile struct {
+	id      int64
+	version int64
+}
+
+// PendingIndex returns how many files wait to be indexed
+func (db *DB) PendingIndex() (int, error) {
+	var count int
+	err := db.conn.QueryRow("SELECT COUNT(*) FROM index_queue").Scan(&count)
+	return count, err
+}
+
+// queuedFiles returns up to limit files from the index queue
+func (db *DB) queuedFiles(limit int) ([]queuedFile, error) {
+	rows, err := db.conn.Query("SELECT file_id, version FROM index_queue ORDER BY file_id LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queued []queuedFile
+	for rows.Next() {
+		var q queuedFile
+		if err := rows.Scan(&q.id, &q.version); err != nil {
+			return nil, err
+		}
+		queued = append(queued, q)
+	}
+	return queued, rows.Err()
+}
+
+// dequeue removes indexed files from the queue, unless they changed again
+// since they were read
+func (db *DB) dequeue(queued []queuedFile) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, q := range queued {
+		if _, err := tx.Exec("DELETE FROM index_queue WHERE file_id = ? AND version = ?", q.id, q.version); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Sync brings the index up to date with the database: every file queued by
+// a change since the last sync is indexed again, or removed from the index
+// if it was deleted. It returns the number of files synced, stopping between
+// batches when ctx is done; the files left stay queued.
+func (idx *BleveIndexer) Sync(ctx context.Context) (int, error) {
+	database := idx.db.WithContext(ctx)
+	count := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		queued, err := database.queuedFiles(syncBatchSize)
+		if err != nil {
+			return count, fmt.Errorf("failed to read the index queue: %w", err)
+		}
+		if len(queued) == 0 {
+			return count, nil
+		}
+
+		batch := idx.index.NewBatch()
+		for _, q := range queued {
+			file, err := database.GetFileByID(q.id)
+			if err != nil {
+				return count, err
+			}
+			if file == nil || file.DeletedAt.Valid {
+				batch.Delete(strconv.FormatInt(q.id, 10))
+				continue
+			}
+			doc, err := idx.document(file)
+			if err != nil {
+				return count, err
+			}
+			if err := batch.Index(doc.ID, doc); err != nil {
+				return count, err
+			}
+		}
+		if err := idx.index.Batch(batch); err != nil {
+			return count, err
+		}
+		if err := database.dequeue(queued); err != nil {
+			return count, fmt.Errorf("failed to update the index queue: %w", err)
+		}
+		count += len(queued)
+	}
+}
+
+// Rebuild replaces the index with a new one built from the database and
+// empties the index queue. It returns the number of files indexed; when ctx
+// is done the index holds only the files indexed so far, until Rebuild is
+// run again.
+func (idx *BleveIndexer) Rebuild(ctx context.Context) (int, error) {
+	if err := idx.index.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.RemoveAll(idx.path); err != nil {
+		return 0, fmt.Errorf("failed to remove the old index: %w", err)
+	}
+	index, err := bleve.New(idx.path, createIndexMapping())
+	if err != nil {
+		return 0, fmt.Errorf("failed to create index: %w", err)
+	}
+	idx.index = index
+
+	// Changes made while building stay queued for the next sync
+	if _, err := idx.db.conn.Exec("DELETE FROM index_queue"); err != nil {
+		return 0, fmt.Errorf("failed to clear the index queue: %w", err)
+	}
+	return idx.BuildIndex(ctx)
+}
+
+// IndexReport compares the index with the database
+type IndexReport struct {
+	Files   int     // Files in the catalog that should be indexed
+	Indexed uint64  // Documents in the index
+	Missing []int64 // IDs of cataloged files not in the index
+	Stale   uint64  // Documents of files no longer in the catalog
+	Pending int     // Files queued for the next sync
+}
+
+// OK reports whether the index matches the database, not counting changes
+// still queued
+func (r *IndexReport) OK() bool {
+	return len(r.Missing) == 0 && r.Stale == 0
+}
+
+// Verify checks that every cataloged file has a document in the index and
+// counts the documents of files that are gone
+func (idx *BleveIndexer) Verify() (*IndexReport, error) {
+	report := &IndexReport{}
+	var err error
+	if report.Indexed, err = idx.index.DocCount(); err != nil {
+		return nil, err
+	}
+	if report.Pending, err = idx.db.PendingIndex(); err != nil {
+		return nil, err
+	}
+
+	rows, err := idx.db.conn.Query("SELECT id FROM files WHERE deleted_at IS NULL ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		report.Files++
+		doc, err := idx.index.Document(strconv.FormatInt(id, 10))
+		if err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			report.Missing = append(report.Missing, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if present := uint64(report.Files - len(report.Missing)); report.Indexed > present {
+		report.Stale = report.Indexed - present
+	}
+	return report, nil
+}
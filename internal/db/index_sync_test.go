@@ -0,0 +1,69 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndexQueue(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	file := &FileStatus{ID: 1, Path: "/drive/report.pdf", RelativePath: "report.pdf", Size: 10, ModTime: time.Now()}
+	if err := insertTestFile(database, file); err != nil {
+		t.Fatal(err)
+	}
+	queued, err := database.queuedFiles(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 || queued[0].id != 1 {
+		t.Fatalf("queue after insert = %+v, want file 1", queued)
+	}
+	if err := database.dequeue(queued); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rescanning doesn't change what is indexed
+	if _, err := database.conn.Exec("UPDATE files SET scanned_at = ? WHERE id = 1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := database.PendingIndex(); err != nil || pending != 0 {
+		t.Errorf("PendingIndex after a rescan = %d, %v; want 0", pending, err)
+	}
+
+	if err := database.AddTags(1, "tax"); err != nil {
+		t.Fatal(err)
+	}
+	queued, err = database.queuedFiles(10)
+	if err != nil || len(queued) != 1 {
+		t.Fatalf("queue after tagging = %+v, %v", queued, err)
+	}
+
+	// A change made while the file was being indexed keeps it queued
+	if err := database.UpdateSummary(1, "A tax return", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.dequeue(queued); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := database.PendingIndex(); err != nil || pending != 1 {
+		t.Errorf("PendingIndex after a concurrent change = %d, %v; want 1", pending, err)
+	}
+
+	// A rescan of a changed file upserts it, which queues it again
+	_, err = database.conn.Exec(`
+	INSERT INTO files (path, relative_path, size, mod_time, is_dir) VALUES (?, ?, ?, ?, FALSE)
+	ON CONFLICT(path) DO UPDATE SET size = excluded.size
+	`, file.Path, file.RelativePath, 20, file.ModTime)
+	if err != nil {
+		t.Fatalf("upserting a queued file: %v", err)
+	}
+	if pending, err := database.PendingIndex(); err != nil || pending != 1 {
+		t.Errorf("PendingIndex after an upsert = %d, %v; want 1", pending, err)
+	}
+}
@@ -1,15 +1,25 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/blevesearch/bleve/v2"
 	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/highlight"
+	"github.com/blevesearch/bleve/v2/search/highlight/format/ansi"
+	"github.com/blevesearch/bleve/v2/search/highlight/format/html"
+	"github.com/blevesearch/bleve/v2/search/highlight/fragmenter/simple"
+	simplehighlighter "github.com/blevesearch/bleve/v2/search/highlight/highlighter/simple"
 	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/jth/archiver/internal/drives"
 )
 
 // IndexConfig represents the configuration for the full-text search index
@@ -18,14 +28,30 @@ type IndexConfig struct {
 	IndexDir string
 	// Whether to index file content summaries
 	IndexSummaries bool
+	// Whether to index the full extracted text of documents
+	IndexContent bool
 }
 
+// maxIndexedContent caps the extracted text stored in the index per file
+const maxIndexedContent = 1 << 20
+
+// Snippet defaults used when a search request leaves them unset
+const (
+	defaultSnippetCount = 3
+	defaultSnippetSize  = 150
+)
+
+// snippetFields are the fields snippets are taken from, in order of preference
+var snippetFields = []string{"Content", "Summary", "Caption", "Notes", "Path"}
+
 // SearchResult represents a search result item
 type SearchResult struct {
 	ID       string
 	Path     string
 	Score    float64
-	Snippet  string
+	Snippet  string   // Best snippet, same as Snippets[0]
+	Snippets []string // Highlighted fragments around the matched terms
+	Pages    []int    // Pages of a PDF the query matched on, numbered from 1
 	IsDir    bool
 	Size     int64
 	ModTime  time.Time
@@ -40,27 +66,80 @@ type SearchRequest struct {
 	SortBy    string
 	SortDesc  bool
 	FieldName string // Restrict search to a specific field
+
+	// Fuzzy matches each query term within Fuzziness edits (default 1), and
+	// Prefix matches terms starting with each query term. Both help with the
+	// typos and truncated names common on old drives.
+	Fuzzy     bool
+	Fuzziness int
+	Prefix    bool
+
+	// Snippets controls how many highlighted fragments are returned per
+	// result and SnippetSize their length in bytes. Colorize highlights
+	// matched terms with ANSI colors instead of <mark> tags.
+	Snippets    int
+	SnippetSize int
+	Colorize    bool
+
+	// Filters, combined with the query. Zero values leave a filter unset.
+	Extension   string    // File extension, with or without the leading dot
+	ContentType string    // Content type prefix, e.g. "video/" or "application/pdf"
+	MinSize     int64     // Minimum size in bytes (inclusive)
+	MaxSize     int64     // Maximum size in bytes (inclusive)
+	After       time.Time // Modified at or after this time
+	Before      time.Time // Modified before this time
+	Drive       string    // Name of the drive the file was scanned from
+	Tag         string    // Tag the file must have
+
+	// Entities the file must have, as extracted with its summary
+	Person       string
+	Organization string
+	Place        string
+	DocumentType string
+	Keyword      string
+
+	// Structured clauses, combined with the query and filters
+	Boolean BooleanQuery
 }
 
 // FileIndex represents the indexed file document
 type FileIndex struct {
-	ID           string
-	Path         string
-	RelativePath string
-	Name         string
-	Extension    string
-	Size         int64
-	ModTime      time.Time
-	IsDir        bool
-	ContentType  string
-	Summary      string
-	UploadedURL  string
-	UpdatedAt    time.Time
+	ID            string
+	Path          string
+	RelativePath  string
+	Name          string
+	Extension     string
+	Size          int64
+	ModTime       time.Time
+	IsDir         bool
+	ContentType   string
+	Drive         string
+	Tags          []string
+	People        []string
+	Organizations []string
+	Places        []string
+	Dates         []string
+	DocumentType  string
+	Keywords      []string
+	Notes         string
+	Caption       string
+	Camera        string // Camera and lens of a photo
+	Summary       string
+	Content       string
+	Pages         int // Number of pages of a PDF, 0 for other files
+	UploadedURL   string
+	UpdatedAt     time.Time
+}
+
+// Type returns the document type, so the fileindex mapping applies
+func (f FileIndex) Type() string {
+	return "fileindex"
 }
 
 // BleveIndexer provides full-text search capabilities
 type BleveIndexer struct {
 	config IndexConfig
+	path   string
 	index  bleve.Index
 	db     *DB
 }
@@ -95,6 +174,7 @@ func NewIndexer(config IndexConfig, db *DB) (*BleveIndexer, error) {
 
 	return &BleveIndexer{
 		config: config,
+		path:   indexPath,
 		index:  index,
 		db:     db,
 	}, nil
@@ -119,6 +199,10 @@ func createIndexMapping() mapping.IndexMapping {
 	documentMapping.AddFieldMappingsAt("RelativePath", textFieldMapping)
 	documentMapping.AddFieldMappingsAt("Name", textFieldMapping)
 	documentMapping.AddFieldMappingsAt("Summary", textFieldMapping)
+	documentMapping.AddFieldMappingsAt("Notes", textFieldMapping)
+	documentMapping.AddFieldMappingsAt("Caption", textFieldMapping)
+	documentMapping.AddFieldMappingsAt("Camera", textFieldMapping)
+	documentMapping.AddFieldMappingsAt("Content", textFieldMapping)
 
 	// Keyword fields
 	keywordFieldMapping := bleve.NewTextFieldMapping()
@@ -128,12 +212,18 @@ func createIndexMapping() mapping.IndexMapping {
 
 	documentMapping.AddFieldMappingsAt("Extension", keywordFieldMapping)
 	documentMapping.AddFieldMappingsAt("ContentType", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("Drive", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("Tags", keywordFieldMapping)
+	for _, field := range FacetFields {
+		documentMapping.AddFieldMappingsAt(field, keywordFieldMapping)
+	}
 
 	// Numeric fields
 	numericFieldMapping := bleve.NewNumericFieldMapping()
 	numericFieldMapping.Store = true
 
 	documentMapping.AddFieldMappingsAt("Size", numericFieldMapping)
+	documentMapping.AddFieldMappingsAt("Pages", numericFieldMapping)
 
 	// Date fields
 	dateTimeFieldMapping := bleve.NewDateTimeFieldMapping()
@@ -165,6 +255,16 @@ func (idx *BleveIndexer) IndexFile(file *FileStatus) error {
 		return fmt.Errorf("cannot index nil file")
 	}
 
+	// Index the document
+	doc, err := idx.document(file)
+	if err != nil {
+		return err
+	}
+	return idx.index.Index(doc.ID, doc)
+}
+
+// document builds the index document for a file
+func (idx *BleveIndexer) document(file *FileStatus) (FileIndex, error) {
 	// Extract file name and extension
 	name := filepath.Base(file.Path)
 	extension := strings.ToLower(filepath.Ext(file.Path))
@@ -180,17 +280,76 @@ func (idx *BleveIndexer) IndexFile(file *FileStatus) error {
 		ModTime:      file.ModTime,
 		IsDir:        file.IsDir,
 		ContentType:  file.ContentType,
+		Drive:        drives.NameFromPath(file.Path),
 		UploadedURL:  file.UploadedURL,
 		UpdatedAt:    time.Now(),
 	}
 
+	tags, err := idx.db.GetTags(file.ID)
+	if err != nil {
+		return doc, fmt.Errorf("failed to load tags of %s: %w", file.Path, err)
+	}
+	doc.Tags = tags
+
+	entities, err := idx.db.GetEntities(file.ID)
+	if err != nil {
+		return doc, fmt.Errorf("failed to load entities of %s: %w", file.Path, err)
+	}
+	doc.People = entities[EntityPerson]
+	doc.Organizations = entities[EntityOrganization]
+	doc.Places = entities[EntityPlace]
+	doc.Dates = entities[EntityDate]
+	doc.Keywords = entities[EntityKeyword]
+	if types := entities[EntityDocumentType]; len(types) > 0 {
+		doc.DocumentType = types[0]
+	}
+
+	notes, err := idx.db.GetNotes(file.ID)
+	if err != nil {
+		return doc, fmt.Errorf("failed to load notes of %s: %w", file.Path, err)
+	}
+	texts := make([]string, len(notes))
+	for i, note := range notes {
+		texts[i] = note.Text
+	}
+	doc.Notes = strings.Join(texts, "\n")
+
+	if doc.Caption, err = idx.db.GetCaption(file.ID); err != nil {
+		return doc, fmt.Errorf("failed to load caption of %s: %w", file.Path, err)
+	}
+	photo, err := idx.db.GetPhotoInfo(file.ID)
+	if err != nil {
+		return doc, fmt.Errorf("failed to load camera of %s: %w", file.Path, err)
+	}
+	if photo != nil {
+		doc.Camera = strings.TrimSpace(photo.Camera + " " + photo.Lens)
+	}
+
 	// Include summary if configured and available
 	if idx.config.IndexSummaries && file.Summary != "" {
 		doc.Summary = file.Summary
 	}
 
-	// Index the document
-	return idx.index.Index(doc.ID, doc)
+	// Include the extracted text if configured and available
+	if idx.config.IndexContent && !file.IsDir {
+		text, err := idx.db.GetText(file.ID)
+		if err != nil {
+			return doc, fmt.Errorf("failed to load text of %s: %w", file.Path, err)
+		}
+		doc.Pages = countPages(text)
+		if len(text) > maxIndexedContent {
+			// Cut before a character rather than inside one, so snippets
+			// taken from the end are valid UTF-8
+			cut := maxIndexedContent
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+			text = text[:cut]
+		}
+		doc.Content = text
+	}
+
+	return doc, nil
 }
 
 // RemoveFile removes a file from the index
@@ -213,98 +372,42 @@ func (idx *BleveIndexer) UpdateFile(file *FileStatus) error {
 	return idx.IndexFile(file)
 }
 
-// BuildIndex builds or rebuilds the full index from the database
-func (idx *BleveIndexer) BuildIndex() (int, error) {
-	// Get all files from the database
-	query := `
-	SELECT id, path, relative_path, size, mod_time, is_dir, content_type, 
-	       sha256, processed, uploaded_url, upload_time, summary
-	FROM files
-	ORDER BY id
-	`
-
-	rows, err := idx.db.conn.Query(query)
-	if err != nil {
-		return 0, err
-	}
-	defer rows.Close()
-
-	// Create a batch for more efficient indexing
-	batch := idx.index.NewBatch()
+// BuildIndex builds or rebuilds the full index from the database. Files
+// are read a page at a time and indexed in batches, so memory stays bounded
+// however large the catalog is. It stops between batches when ctx is done.
+func (idx *BleveIndexer) BuildIndex(ctx context.Context) (int, error) {
+	const batchSize = 100
+	database := idx.db.WithContext(ctx)
 	count := 0
-	batchSize := 100
-
-	for rows.Next() {
-		var file FileStatus
-		err := rows.Scan(
-			&file.ID,
-			&file.Path,
-			&file.RelativePath,
-			&file.Size,
-			&file.ModTime,
-			&file.IsDir,
-			&file.ContentType,
-			&file.SHA256,
-			&file.Processed,
-			&file.UploadedURL,
-			&file.UploadTime,
-			&file.Summary,
-		)
-		if err != nil {
+	var lastID int64
+	for {
+		if err := ctx.Err(); err != nil {
 			return count, err
 		}
-
-		// Extract file name and extension
-		name := filepath.Base(file.Path)
-		extension := strings.ToLower(filepath.Ext(file.Path))
-
-		// Create a document to index
-		doc := FileIndex{
-			ID:           fmt.Sprintf("%d", file.ID),
-			Path:         file.Path,
-			RelativePath: file.RelativePath,
-			Name:         name,
-			Extension:    extension,
-			Size:         file.Size,
-			ModTime:      file.ModTime,
-			IsDir:        file.IsDir,
-			ContentType:  file.ContentType,
-			UploadedURL:  file.UploadedURL,
-			UpdatedAt:    time.Now(),
-		}
-
-		// Include summary if configured and available
-		if idx.config.IndexSummaries && file.Summary != "" {
-			doc.Summary = file.Summary
-		}
-
-		// Add to batch
-		if err := batch.Index(doc.ID, doc); err != nil {
+		files, err := database.GetFilesPage(lastID, batchSize)
+		if err != nil {
 			return count, err
 		}
-		count++
+		if len(files) == 0 {
+			return count, nil
+		}
 
-		// Execute batch if it reaches the batch size
-		if count%batchSize == 0 {
-			if err := idx.index.Batch(batch); err != nil {
+		batch := idx.index.NewBatch()
+		for _, file := range files {
+			doc, err := idx.document(file)
+			if err != nil {
+				return count, err
+			}
+			if err := batch.Index(doc.ID, doc); err != nil {
 				return count, err
 			}
-			batch = idx.index.NewBatch()
 		}
-	}
-
-	// Execute the final batch if there are any documents left
-	if batch.Size() > 0 {
 		if err := idx.index.Batch(batch); err != nil {
 			return count, err
 		}
+		count += len(files)
+		lastID = files[len(files)-1].ID
 	}
-
-	if err := rows.Err(); err != nil {
-		return count, err
-	}
-
-	return count, nil
 }
 
 // Search performs a search on the index
@@ -313,25 +416,15 @@ func (idx *BleveIndexer) Search(request SearchRequest) ([]SearchResult, error) {
 	if request.Limit <= 0 {
 		request.Limit = 10
 	}
-
-	// Create a query based on the search request
-	var searchQuery query.Query
-
-	if request.Query == "" {
-		// If no query is provided, match all documents
-		searchQuery = bleve.NewMatchAllQuery()
-	} else if request.FieldName != "" {
-		// Search in a specific field
-		matchQuery := bleve.NewMatchQuery(request.Query)
-		matchQuery.SetField(request.FieldName)
-		searchQuery = matchQuery
-	} else {
-		// Search in all fields
-		searchQuery = bleve.NewQueryStringQuery(request.Query)
+	if request.Snippets <= 0 {
+		request.Snippets = defaultSnippetCount
+	}
+	if request.SnippetSize <= 0 {
+		request.SnippetSize = defaultSnippetSize
 	}
 
 	// Create the search request
-	searchRequest := bleve.NewSearchRequest(searchQuery)
+	searchRequest := bleve.NewSearchRequest(request.query())
 	searchRequest.Size = request.Limit
 	searchRequest.From = request.Offset
 	searchRequest.Fields = []string{"*"}
@@ -346,15 +439,15 @@ func (idx *BleveIndexer) Search(request SearchRequest) ([]SearchResult, error) {
 		searchRequest.SortBy([]string{request.SortBy + ":" + sortOrder})
 	}
 
-	// Set up highlighting for snippets
-	searchRequest.Highlight = bleve.NewHighlight()
-
 	// Execute the search
 	searchResults, err := idx.index.Search(searchRequest)
 	if err != nil {
 		return nil, err
 	}
 
+	// Set up highlighting for snippets
+	highlighter := newHighlighter(request)
+
 	// Process the results
 	var results []SearchResult
 	for _, hit := range searchResults.Hits {
@@ -371,20 +464,27 @@ func (idx *BleveIndexer) Search(request SearchRequest) ([]SearchResult, error) {
 			}
 		}
 
-		// Extract snippet from highlighted fragments
+		// Extract snippets around the matched terms
+		snippets, err := idx.snippets(hit, highlighter, request.Snippets)
+		if err != nil {
+			return nil, err
+		}
 		snippet := ""
-		if fragments, ok := hit.Fragments["Summary"]; ok && len(fragments) > 0 {
-			snippet = fragments[0]
-		} else if fragments, ok := hit.Fragments["Path"]; ok && len(fragments) > 0 {
-			snippet = fragments[0]
+		if len(snippets) > 0 {
+			snippet = snippets[0]
 		}
 
+		// Find the pages the content matched on, by its page breaks
+		content, _ := hit.Fields["Content"].(string)
+
 		// Create a search result
 		result := SearchResult{
 			ID:       hit.ID,
 			Path:     path,
 			Score:    hit.Score,
 			Snippet:  snippet,
+			Snippets: snippets,
+			Pages:    matchPages(content, hit.Locations["Content"]),
 			IsDir:    isDir,
 			Size:     int64(size),
 			ModTime:  modTime,
@@ -397,6 +497,244 @@ func (idx *BleveIndexer) Search(request SearchRequest) ([]SearchResult, error) {
 	return results, nil
 }
 
+// MatchingFileIDs returns the IDs of all files matching the request,
+// ignoring its limit and offset
+func (idx *BleveIndexer) MatchingFileIDs(request SearchRequest) ([]int64, error) {
+	const pageSize = 1000
+
+	var ids []int64
+	for from := 0; ; from += pageSize {
+		searchRequest := bleve.NewSearchRequestOptions(request.query(), pageSize, from, false)
+		searchResults, err := idx.index.Search(searchRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hit := range searchResults.Hits {
+			id, err := strconv.ParseInt(hit.ID, 10, 64)
+			if err != nil {
+				continue
+			}
+			ids = append(ids, id)
+		}
+
+		if len(searchResults.Hits) < pageSize {
+			return ids, nil
+		}
+	}
+}
+
+// query builds the bleve query for the request's query and filters
+func (request SearchRequest) query() query.Query {
+	var searchQuery query.Query
+
+	if request.Query == "" {
+		// If no query is provided, match all documents
+		searchQuery = bleve.NewMatchAllQuery()
+	} else if request.Fuzzy || request.Prefix {
+		// Match each term approximately
+		searchQuery = request.termsQuery()
+	} else if request.FieldName != "" {
+		// Search in a specific field
+		matchQuery := bleve.NewMatchQuery(request.Query)
+		matchQuery.SetField(request.FieldName)
+		searchQuery = matchQuery
+	} else {
+		// Search in all fields
+		searchQuery = bleve.NewQueryStringQuery(request.Query)
+	}
+
+	// Narrow the query down with the structured filters
+	if filters := request.filters(); len(filters) > 0 {
+		searchQuery = bleve.NewConjunctionQuery(append([]query.Query{searchQuery}, filters...)...)
+	}
+
+	return searchQuery
+}
+
+// termsQuery builds a fuzzy or prefix query for each term of the query, all
+// of which must match
+func (request SearchRequest) termsQuery() query.Query {
+	fuzziness := request.Fuzziness
+	if fuzziness <= 0 {
+		fuzziness = 1
+	}
+
+	var terms []query.Query
+	for _, term := range strings.Fields(strings.ToLower(request.Query)) {
+		var termQuery query.FieldableQuery
+		if request.Prefix {
+			termQuery = bleve.NewPrefixQuery(term)
+		} else {
+			fuzzyQuery := bleve.NewFuzzyQuery(term)
+			fuzzyQuery.SetFuzziness(fuzziness)
+			termQuery = fuzzyQuery
+		}
+		if request.FieldName != "" {
+			termQuery.SetField(request.FieldName)
+		}
+		terms = append(terms, termQuery)
+	}
+
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	return bleve.NewConjunctionQuery(terms...)
+}
+
+// newHighlighter creates a highlighter with the request's fragment size and style
+func newHighlighter(request SearchRequest) highlight.Highlighter {
+	var formatter highlight.FragmentFormatter = html.NewFragmentFormatter("<mark>", "</mark>")
+	if request.Colorize {
+		formatter = ansi.NewFragmentFormatter(ansi.DefaultAnsiHighlight)
+	}
+	return simplehighlighter.NewHighlighter(simple.NewFragmenter(request.SnippetSize), formatter, "…")
+}
+
+// snippets returns up to count highlighted fragments for a hit, taken from the
+// full text first, then the summary and the path
+func (idx *BleveIndexer) snippets(hit *search.DocumentMatch, highlighter highlight.Highlighter, count int) ([]string, error) {
+	if len(hit.Locations) == 0 {
+		return nil, nil
+	}
+
+	doc, err := idx.index.Document(hit.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load document %s: %w", hit.ID, err)
+	}
+	if doc == nil {
+		return nil, nil
+	}
+
+	var snippets []string
+	for _, field := range snippetFields {
+		if _, ok := hit.Locations[field]; !ok {
+			continue
+		}
+		for _, fragment := range highlighter.BestFragmentsInField(hit, doc, field, count-len(snippets)) {
+			if fragment = strings.TrimSpace(fragment); fragment != "" {
+				snippets = append(snippets, fragment)
+			}
+		}
+		if len(snippets) >= count {
+			break
+		}
+	}
+
+	return snippets, nil
+}
+
+// filters builds a query for each filter set on the request
+func (request SearchRequest) filters() []query.Query {
+	var filters []query.Query
+
+	if request.Extension != "" {
+		extension := strings.ToLower(request.Extension)
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		termQuery := bleve.NewTermQuery(extension)
+		termQuery.SetField("Extension")
+		filters = append(filters, termQuery)
+	}
+
+	if request.ContentType != "" {
+		prefixQuery := bleve.NewPrefixQuery(strings.ToLower(request.ContentType))
+		prefixQuery.SetField("ContentType")
+		filters = append(filters, prefixQuery)
+	}
+
+	if request.MinSize > 0 || request.MaxSize > 0 {
+		var min, max *float64
+		if request.MinSize > 0 {
+			value := float64(request.MinSize)
+			min = &value
+		}
+		if request.MaxSize > 0 {
+			value := float64(request.MaxSize)
+			max = &value
+		}
+		inclusive := true
+		rangeQuery := bleve.NewNumericRangeInclusiveQuery(min, max, &inclusive, &inclusive)
+		rangeQuery.SetField("Size")
+		filters = append(filters, rangeQuery)
+	}
+
+	if !request.After.IsZero() || !request.Before.IsZero() {
+		startInclusive, endInclusive := true, false
+		dateQuery := bleve.NewDateRangeInclusiveQuery(request.After, request.Before, &startInclusive, &endInclusive)
+		dateQuery.SetField("ModTime")
+		filters = append(filters, dateQuery)
+	}
+
+	if request.Drive != "" {
+		termQuery := bleve.NewTermQuery(request.Drive)
+		termQuery.SetField("Drive")
+		filters = append(filters, termQuery)
+	}
+
+	if request.Tag != "" {
+		termQuery := bleve.NewTermQuery(request.Tag)
+		termQuery.SetField("Tags")
+		filters = append(filters, termQuery)
+	}
+
+	for _, entity := range []struct{ field, value string }{
+		{"People", request.Person},
+		{"Organizations", request.Organization},
+		{"Places", request.Place},
+		{"DocumentType", request.DocumentType},
+		{"Keywords", request.Keyword},
+	} {
+		if entity.value != "" {
+			termQuery := bleve.NewTermQuery(entity.value)
+			termQuery.SetField(entity.field)
+			filters = append(filters, termQuery)
+		}
+	}
+
+	if !request.Boolean.Empty() {
+		filters = append(filters, request.Boolean.query())
+	}
+
+	return filters
+}
+
+// FacetFields are the entity fields of the index that searches can be
+// faceted by
+var FacetFields = []string{"People", "Organizations", "Places", "Dates", "DocumentType", "Keywords"}
+
+// FacetCount is a value of a facet and how many matching files have it
+type FacetCount struct {
+	Value string
+	Count int
+}
+
+// Facets returns the most common values of each facet field among all the
+// files matching the request, at most size per field
+func (idx *BleveIndexer) Facets(request SearchRequest, size int) (map[string][]FacetCount, error) {
+	searchRequest := bleve.NewSearchRequestOptions(request.query(), 0, 0, false)
+	for _, field := range FacetFields {
+		searchRequest.AddFacet(field, bleve.NewFacetRequest(field, size))
+	}
+	searchResults, err := idx.index.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	facets := make(map[string][]FacetCount)
+	for _, field := range FacetFields {
+		result, ok := searchResults.Facets[field]
+		if !ok {
+			continue
+		}
+		for _, term := range result.Terms.Terms() {
+			facets[field] = append(facets[field], FacetCount{Value: term.Term, Count: term.Count})
+		}
+	}
+	return facets, nil
+}
+
 // GetStats returns statistics about the index
 func (idx *BleveIndexer) GetStats() (map[string]interface{}, error) {
 	stats := idx.index.Stats()
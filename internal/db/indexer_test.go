@@ -1,11 +1,14 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 func TestIndexer(t *testing.T) {
@@ -173,7 +176,7 @@ func TestIndexer(t *testing.T) {
 		}
 
 		// Build the index
-		count, err := indexer.BuildIndex()
+		count, err := indexer.BuildIndex(context.Background())
 		if err != nil {
 			t.Fatalf("Failed to build index: %v", err)
 		}
@@ -191,6 +194,70 @@ func TestIndexer(t *testing.T) {
 		}
 	})
 
+	// Test structured filters
+	t.Run("Filters", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			request SearchRequest
+			want    string
+		}{
+			{"Extension", SearchRequest{Extension: "doc"}, "/test/path/file2.doc"},
+			{"ContentType", SearchRequest{ContentType: "text/"}, "/test/path/file.txt"},
+			{"MinSize", SearchRequest{MinSize: 1500}, "/test/path/file2.doc"},
+			{"MaxSize", SearchRequest{Query: "test", MaxSize: 1024}, "/test/path/file.txt"},
+			{"MustPhrase", SearchRequest{Boolean: BooleanQuery{
+				Must: []Clause{{Kind: ClausePhrase, Field: "Summary", Value: "another test"}},
+			}}, "/test/path/file2.doc"},
+			{"ShouldNot", SearchRequest{Boolean: BooleanQuery{
+				Should: []Clause{{Kind: ClauseMatch, Field: "Summary", Value: "test"}},
+				Not:    []Clause{{Kind: ClauseTerm, Field: "Extension", Value: ".doc"}},
+			}}, "/test/path/file.txt"},
+			{"SizeRange", SearchRequest{Boolean: BooleanQuery{
+				Must: []Clause{{Kind: ClauseSizeRange, Min: 2000, Max: 3000}},
+			}}, "/test/path/file2.doc"},
+		}
+
+		for _, tt := range tests {
+			results, err := indexer.Search(tt.request)
+			if err != nil {
+				t.Fatalf("%s: failed to search index: %v", tt.name, err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("%s: expected 1 search result, got %d", tt.name, len(results))
+			}
+			if results[0].Path != tt.want {
+				t.Errorf("%s: expected %s, got %s", tt.name, tt.want, results[0].Path)
+			}
+		}
+
+		results, err := indexer.Search(SearchRequest{After: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatalf("Failed to search index by date: %v", err)
+		}
+		if len(results) != 0 {
+			t.Errorf("Expected no files modified in the future, got %d", len(results))
+		}
+	})
+
+	// Test approximate matching
+	t.Run("FuzzyAndPrefix", func(t *testing.T) {
+		results, err := indexer.Search(SearchRequest{Query: "anothr", Fuzzy: true})
+		if err != nil {
+			t.Fatalf("Failed to run fuzzy search: %v", err)
+		}
+		if len(results) != 1 {
+			t.Errorf("Expected 1 fuzzy result, got %d", len(results))
+		}
+
+		results, err = indexer.Search(SearchRequest{Query: "anot", Prefix: true})
+		if err != nil {
+			t.Fatalf("Failed to run prefix search: %v", err)
+		}
+		if len(results) != 1 {
+			t.Errorf("Expected 1 prefix result, got %d", len(results))
+		}
+	})
+
 	// Test getting stats
 	t.Run("GetStats", func(t *testing.T) {
 		stats, err := indexer.GetStats()
@@ -258,3 +325,38 @@ func insertTestFile(db *DB, file *FileStatus) error {
 	)
 	return err
 }
+
+func TestIndexedContentCutOnCharacters(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	if _, err := database.InsertFilesBatch([]*FileStatus{{Path: "/drive/lettres.txt", RelativePath: "lettres.txt", ModTime: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	file, _ := database.GetFileByPath("/drive/lettres.txt")
+	// Over the cap, with the cap falling inside a two-byte é
+	text := "a" + strings.Repeat("é", maxIndexedContent/2+10)
+	if err := database.SaveExtractions([]Extraction{{FileID: file.ID, Extractor: "native", Quality: 1, Text: text}}); err != nil {
+		t.Fatal(err)
+	}
+
+	indexer, err := NewIndexer(IndexConfig{IndexDir: filepath.Join(t.TempDir(), "index"), IndexContent: true}, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexer.Close()
+	file, _ = database.GetFileByPath("/drive/lettres.txt")
+	doc, err := indexer.document(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Content) > maxIndexedContent || len(doc.Content) < maxIndexedContent-1 {
+		t.Errorf("indexed %d bytes, want the %d-byte cap less at most a character", len(doc.Content), maxIndexedContent)
+	}
+	if !utf8.ValidString(doc.Content) || !strings.HasSuffix(doc.Content, "é") {
+		t.Errorf("indexed text ends in %q, want whole characters", doc.Content[len(doc.Content)-4:])
+	}
+}
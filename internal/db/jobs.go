@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Job statuses. A job is queued until a worker takes it, and then ends
+// like the run it starts.
+const (
+	JobQueued    = "queued"
+	JobCancelled = "cancelled"
+)
+
+// Job is an archive run of a source waiting in the queue, or taken from it
+type Job struct {
+	ID         int64
+	Source     string
+	Summarize  string // Summarization level; empty uses the default
+	IncludeAll bool
+	Status     string // JobQueued, JobCancelled or one of the run statuses
+	QueuedAt   time.Time
+	StartedAt  sql.NullTime
+	FinishedAt sql.NullTime
+	RunID      int64 // The run the job started, 0 until it has one
+	Error      string
+}
+
+// Command returns the command the run of a job is recorded with
+func (j *Job) Command() string {
+	return fmt.Sprintf("job %d", j.ID)
+}
+
+// jobColumns is the column list matching scanJob, in order
+const jobColumns = `id, source, summarize, include_all, status, queued_at, started_at,
+	       finished_at, run_id, error`
+
+// scanJob scans a row selected with jobColumns into a Job
+func scanJob(row rowScanner) (*Job, error) {
+	var job Job
+	var summarize, jobErr sql.NullString
+	var runID sql.NullInt64
+	err := row.Scan(&job.ID, &job.Source, &summarize, &job.IncludeAll, &job.Status, &job.QueuedAt,
+		&job.StartedAt, &job.FinishedAt, &runID, &jobErr)
+	if err != nil {
+		return nil, err
+	}
+	job.Summarize = summarize.String
+	job.RunID = runID.Int64
+	job.Error = jobErr.String
+	return &job, nil
+}
+
+// QueueJob adds a job to the end of the queue and sets its ID
+func (db *DB) QueueJob(job *Job) error {
+	job.Status = JobQueued
+	job.QueuedAt = time.Now()
+
+	result, err := db.conn.Exec("INSERT INTO jobs (source, summarize, include_all, status, queued_at) VALUES (?, ?, ?, ?, ?)",
+		job.Source, job.Summarize, job.IncludeAll, job.Status, job.QueuedAt)
+	if err != nil {
+		return fmt.Errorf("failed to queue job: %w", err)
+	}
+
+	job.ID, err = result.LastInsertId()
+	return err
+}
+
+// ListJobs retrieves the queued and running jobs in the order they will be
+// or were taken, along with the finished ones if all is set
+func (db *DB) ListJobs(all bool) ([]*Job, error) {
+	query := "SELECT " + jobColumns + " FROM jobs"
+	var args []interface{}
+	if !all {
+		query += " WHERE status IN (?, ?)"
+		args = append(args, JobQueued, RunRunning)
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// TakeJob marks the oldest queued job as running and returns it, or nil if
+// the queue is empty. Workers sharing the queue never take the same job.
+func (db *DB) TakeJob() (*Job, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	job, err := scanJob(tx.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE status = ? ORDER BY id LIMIT 1", JobQueued))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job.Status = RunRunning
+	job.StartedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	if _, err := tx.Exec("UPDATE jobs SET status = ?, started_at = ? WHERE id = ?", job.Status, job.StartedAt, job.ID); err != nil {
+		return nil, err
+	}
+	return job, tx.Commit()
+}
+
+// FinishJob records how a job ended, as FinishRun does for runs, along with
+// the run it started, if it got that far
+func (db *DB) FinishJob(job *Job, jobErr error) error {
+	job.FinishedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	job.Status = RunCompleted
+	if jobErr != nil {
+		job.Status = RunFailed
+		if errors.Is(jobErr, context.Canceled) {
+			job.Status = RunInterrupted
+		}
+		job.Error = jobErr.Error()
+	}
+
+	query := `
+	UPDATE jobs
+	SET status = ?, finished_at = ?, error = ?,
+	    run_id = (SELECT MAX(id) FROM runs WHERE command = ?)
+	WHERE id = ?
+	`
+	if _, err := db.conn.Exec(query, job.Status, job.FinishedAt, job.Error, job.Command(), job.ID); err != nil {
+		return err
+	}
+	return db.conn.QueryRow("SELECT COALESCE(run_id, 0) FROM jobs WHERE id = ?", job.ID).Scan(&job.RunID)
+}
+
+// CancelJob takes a job that hasn't started out of the queue
+func (db *DB) CancelJob(id int64) error {
+	result, err := db.conn.Exec("UPDATE jobs SET status = ?, finished_at = ? WHERE id = ? AND status = ?",
+		JobCancelled, time.Now(), id, JobQueued)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	var status string
+	err = db.conn.QueryRow("SELECT status FROM jobs WHERE id = ?", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no job with id %d", id)
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("job %d is %s, only queued jobs can be cancelled", id, status)
+}
+
+// RequeueCrashedJobs puts the jobs still recorded as running that started
+// before the given time, such as the last boot, back in the queue. Their
+// worker died without recording how they ended. It returns the number of
+// jobs requeued.
+func (db *DB) RequeueCrashedJobs(before time.Time) (int64, error) {
+	result, err := db.conn.Exec("UPDATE jobs SET status = ?, started_at = NULL WHERE status = ? AND started_at < ?",
+		JobQueued, RunRunning, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue crashed jobs: %w", err)
+	}
+	return result.RowsAffected()
+}
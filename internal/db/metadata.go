@@ -0,0 +1,58 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// SetMetadata replaces the metadata extracted from a file, such as its
+// title, author or page count, with the given values by key
+func (db *DB) SetMetadata(fileID int64, metadata map[string]string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceMetadata(tx, fileID, metadata); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceMetadata replaces the metadata of a file within tx. Empty values
+// aren't stored.
+func replaceMetadata(tx *sql.Tx, fileID int64, metadata map[string]string) error {
+	if _, err := tx.Exec("DELETE FROM file_metadata WHERE file_id = ?", fileID); err != nil {
+		return err
+	}
+	for key, value := range metadata {
+		if value == "" {
+			continue
+		}
+		_, err := tx.Exec("INSERT INTO file_metadata (file_id, key, value) VALUES (?, ?, ?)", fileID, key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMetadata retrieves the metadata extracted from a file by key, or an
+// empty map if none was stored
+func (db *DB) GetMetadata(fileID int64) (map[string]string, error) {
+	rows, err := db.conn.Query("SELECT key, value FROM file_metadata WHERE file_id = ?", fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		metadata[key] = value
+	}
+	return metadata, rows.Err()
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jth/archiver/internal/pathnorm"
+)
+
+// NameMapping records that a file was uploaded under another name than its
+// layout gave it, because of a collision
+type NameMapping struct {
+	FileID     int64
+	Path       string
+	LayoutName string // Name the layout gave the file
+	RemoteName string // Name it was uploaded under
+	Collision  string // content, or case for a name differing only in case
+	RecordedAt time.Time
+}
+
+// RemoteNameFoldOwner retrieves the file first uploaded under a name whose
+// pathnorm.FoldCase is folded, or nil if there is none
+func (db *DB) RemoteNameFoldOwner(folded string) (*FileStatus, error) {
+	file, err := scanFile(db.conn.QueryRow(`
+	SELECT `+fileColumns+` FROM files
+	WHERE remote_name_folded = ?
+	ORDER BY upload_time, id
+	LIMIT 1
+	`, folded))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return file, err
+}
+
+// FoldRemoteNames records the case-folded remote names of files uploaded
+// before they were recorded with each upload, so RemoteNameFoldOwner finds
+// them
+func (db *DB) FoldRemoteNames() error {
+	rows, err := db.conn.Query("SELECT id, remote_name FROM files WHERE remote_name IS NOT NULL AND remote_name_folded IS NULL")
+	if err != nil {
+		return err
+	}
+	folded := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		folded[id] = pathnorm.FoldCase(name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for id, name := range folded {
+		if _, err := tx.Exec("UPDATE files SET remote_name_folded = ? WHERE id = ?", name, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RecordNameMapping records the name a file was uploaded under after a
+// collision, replacing the mapping of an earlier upload
+func (db *DB) RecordNameMapping(mapping *NameMapping) error {
+	_, err := db.conn.Exec(`
+	INSERT INTO name_mappings (file_id, layout_name, remote_name, collision, recorded_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (file_id) DO UPDATE
+	SET layout_name = excluded.layout_name, remote_name = excluded.remote_name,
+	    collision = excluded.collision, recorded_at = excluded.recorded_at
+	`, mapping.FileID, mapping.LayoutName, mapping.RemoteName, mapping.Collision, time.Now())
+	return err
+}
+
+// GetNameMappings returns the files uploaded under another name than their
+// layout gave them, by remote name
+func (db *DB) GetNameMappings() ([]*NameMapping, error) {
+	rows, err := db.conn.Query(`
+	SELECT m.file_id, f.path, m.layout_name, m.remote_name, m.collision, m.recorded_at
+	FROM name_mappings m
+	JOIN files f ON f.id = m.file_id
+	ORDER BY m.remote_name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []*NameMapping
+	for rows.Next() {
+		m := &NameMapping{}
+		if err := rows.Scan(&m.FileID, &m.Path, &m.LayoutName, &m.RemoteName, &m.Collision, &m.RecordedAt); err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, rows.Err()
+}
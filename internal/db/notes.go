@@ -0,0 +1,55 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Note is a free-text annotation of a file
+type Note struct {
+	ID        int64
+	FileID    int64
+	Text      string
+	CreatedAt time.Time
+}
+
+// AddNote adds a note to a file and returns its ID
+func (db *DB) AddNote(fileID int64, text string) (int64, error) {
+	result, err := db.conn.Exec("INSERT INTO notes (file_id, text, created_at) VALUES (?, ?, ?)",
+		fileID, text, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetNotes retrieves the notes of a file, oldest first
+func (db *DB) GetNotes(fileID int64) ([]*Note, error) {
+	rows, err := db.conn.Query("SELECT id, file_id, text, created_at FROM notes WHERE file_id = ? ORDER BY created_at, id", fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []*Note
+	for rows.Next() {
+		note := &Note{}
+		if err := rows.Scan(&note.ID, &note.FileID, &note.Text, &note.CreatedAt); err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+// DeleteNote deletes a note of a file
+func (db *DB) DeleteNote(fileID, noteID int64) error {
+	result, err := db.conn.Exec("DELETE FROM notes WHERE id = ? AND file_id = ?", noteID, fileID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("file %d has no note %d", fileID, noteID)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFileAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	database, err := Open(filepath.Join(dir, "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	indexer, err := NewIndexer(IndexConfig{IndexDir: filepath.Join(dir, "index")}, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexer.Close()
+
+	files := []*FileStatus{
+		{Path: "/drive/lease.pdf", RelativePath: "lease.pdf", ModTime: time.Now()},
+		{Path: "/drive/other.pdf", RelativePath: "other.pdf", ModTime: time.Now()},
+	}
+	if _, err := database.InsertFilesBatch(files); err != nil {
+		t.Fatal(err)
+	}
+	file, err := database.GetFileByPath("/drive/lease.pdf")
+	if err != nil || file == nil {
+		t.Fatalf("GetFileByPath = %v, %v", file, err)
+	}
+	other, _ := database.GetFileByPath("/drive/other.pdf")
+
+	// Tags of one file, as archiver tag edits them
+	edit := func(add, remove []string) {
+		t.Helper()
+		changes, err := database.PlanTagEdit([]int64{file.ID}, add, remove)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := indexer.ApplyTagEdit("tag", changes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edit([]string{"home", "contract"}, nil)
+	edit([]string{"signed"}, []string{"contract", "missing"})
+	if tags, err := database.GetTags(file.ID); err != nil || !slices.Equal(tags, []string{"home", "signed"}) {
+		t.Errorf("GetTags = %q, %v; want home and signed", tags, err)
+	}
+	if tags, err := database.GetTags(other.ID); err != nil || len(tags) != 0 {
+		t.Errorf("tags of another file = %q, %v; want none", tags, err)
+	}
+
+	// Notes of one file
+	first, err := database.AddNote(file.ID, "Renewed for two years")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := database.AddNote(file.ID, "Deposit returned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := database.GetNotes(file.ID)
+	if err != nil || len(notes) != 2 || notes[0].ID != first || notes[1].Text != "Deposit returned" {
+		t.Fatalf("GetNotes = %+v, %v; want both notes, oldest first", notes, err)
+	}
+	if err := database.DeleteNote(other.ID, first); err == nil {
+		t.Error("deleted a note through another file")
+	}
+	if err := database.DeleteNote(file.ID, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DeleteNote(file.ID, first); err == nil {
+		t.Error("deleted a note twice")
+	}
+	if notes, err := database.GetNotes(file.ID); err != nil || len(notes) != 1 || notes[0].ID != second {
+		t.Errorf("after deleting, GetNotes = %+v, %v; want only the second note", notes, err)
+	}
+
+	// A path that isn't in the catalog has nothing to annotate
+	if unknown, err := database.GetFileByPath("/drive/missing.pdf"); err != nil || unknown != nil {
+		t.Errorf("GetFileByPath of an unknown path = %+v, %v; want nil", unknown, err)
+	}
+	if changes, err := database.PlanTagEdit([]int64{999}, []string{"home"}, nil); err != nil || len(changes) != 0 {
+		t.Errorf("PlanTagEdit of an unknown file = %+v, %v; want no changes", changes, err)
+	}
+}
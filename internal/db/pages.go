@@ -0,0 +1,61 @@
+package db
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/search"
+)
+
+// pageBreak ends each page of the text extracted from a PDF, as pdftotext
+// writes it
+const pageBreak = "\f"
+
+// pageStarts returns the byte offsets at which the pages of text start,
+// or nil if it has no page breaks
+func pageStarts(text string) []int {
+	if !strings.Contains(text, pageBreak) {
+		return nil
+	}
+	starts := []int{0}
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], pageBreak)
+		if i < 0 {
+			break
+		}
+		offset += i + len(pageBreak)
+		starts = append(starts, offset)
+	}
+	// Text after the last break is a page only if it isn't blank
+	if last := starts[len(starts)-1]; strings.TrimSpace(text[last:]) == "" {
+		starts = starts[:len(starts)-1]
+	}
+	return starts
+}
+
+// countPages returns the number of pages of text, or 0 if it has no page
+// breaks
+func countPages(text string) int {
+	return len(pageStarts(text))
+}
+
+// matchPages returns the pages, numbered from 1, on which the terms of a
+// hit were found in text, in order
+func matchPages(text string, locations search.TermLocationMap) []int {
+	starts := pageStarts(text)
+	if starts == nil {
+		return nil
+	}
+	var pages []int
+	for _, termLocations := range locations {
+		for _, location := range termLocations {
+			page := sort.Search(len(starts), func(i int) bool { return starts[i] > int(location.Start) })
+			if !slices.Contains(pages, page) {
+				pages = append(pages, page)
+			}
+		}
+	}
+	slices.Sort(pages)
+	return pages
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/search"
+)
+
+func TestMatchPages(t *testing.T) {
+	text := "Cover\fContents\finvoice total\n\fnotes on the invoice\f\n"
+	if pages := countPages(text); pages != 4 {
+		t.Errorf("counted %d pages, want 4", pages)
+	}
+	if pages := countPages("no breaks"); pages != 0 {
+		t.Errorf("counted %d pages in text without breaks, want 0", pages)
+	}
+
+	at := func(term string, occurrence int) *search.Location {
+		offset := -1
+		for range occurrence + 1 {
+			offset += 1 + strings.Index(text[offset+1:], term)
+		}
+		return &search.Location{Start: uint64(offset), End: uint64(offset + len(term))}
+	}
+	locations := search.TermLocationMap{
+		"invoice": {at("invoice", 1), at("invoice", 0)},
+		"cover":   {at("Cover", 0)},
+	}
+	if pages := matchPages(text, locations); !slices.Equal(pages, []int{1, 3, 4}) {
+		t.Errorf("matched on pages %v, want 1, 3 and 4", pages)
+	}
+	if pages := matchPages("invoice", locations); pages != nil {
+		t.Errorf("matched on pages %v of text without breaks", pages)
+	}
+}
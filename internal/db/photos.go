@@ -0,0 +1,35 @@
+package db
+
+import "database/sql"
+
+// PhotoInfo is the camera metadata of a photo, read from its EXIF data when
+// it is scanned
+type PhotoInfo struct {
+	FileID       int64
+	Camera       string
+	Lens         string
+	ISO          int
+	ExposureTime string
+	FNumber      float64
+	FocalLength  float64
+	Width        int
+	Height       int
+	Orientation  int
+}
+
+// GetPhotoInfo returns the camera metadata of a photo, or nil if none was
+// recorded
+func (db *DB) GetPhotoInfo(fileID int64) (*PhotoInfo, error) {
+	p := &PhotoInfo{FileID: fileID}
+	err := db.conn.QueryRow(`
+	SELECT camera, lens, iso, exposure_time, f_number, focal_length, width, height, orientation
+	FROM photo_exif WHERE file_id = ?
+	`, fileID).Scan(&p.Camera, &p.Lens, &p.ISO, &p.ExposureTime, &p.FNumber, &p.FocalLength, &p.Width, &p.Height, &p.Orientation)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
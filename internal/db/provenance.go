@@ -0,0 +1,128 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Artifact kinds recorded in provenance
+const (
+	ArtifactExtraction = "extraction"
+	ArtifactTranscript = "transcript"
+	ArtifactSummary    = "summary"
+	ArtifactTranscode  = "transcode"
+	ArtifactConversion = "conversion"
+	ArtifactCaption    = "caption"
+	ArtifactThumbnail  = "thumbnail"
+	ArtifactUpload     = "upload"
+)
+
+// Provenance records which tool, version and model produced an artifact
+type Provenance struct {
+	ID            int64
+	FileID        int64
+	Artifact      string
+	Tool          string
+	ToolVersion   string
+	Model         string
+	PromptVersion string
+	Duration      time.Duration
+	Cost          float64
+	Details       string
+	CreatedAt     time.Time
+}
+
+// insertProvenance stores a provenance record, with the arguments
+// provenanceArgs returns for it
+const insertProvenance = `
+INSERT INTO provenance
+(file_id, artifact, tool, tool_version, model, prompt_version, duration_ms, cost, details, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+// provenanceArgs returns the arguments of insertProvenance for a record,
+// setting its CreatedAt to now if it is unset
+func provenanceArgs(p *Provenance) []any {
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now()
+	}
+	return []any{
+		p.FileID,
+		p.Artifact,
+		p.Tool,
+		p.ToolVersion,
+		p.Model,
+		p.PromptVersion,
+		p.Duration.Milliseconds(),
+		p.Cost,
+		p.Details,
+		p.CreatedAt,
+	}
+}
+
+// RecordProvenance stores a provenance record. CreatedAt defaults to now.
+func (db *DB) RecordProvenance(p *Provenance) error {
+	result, err := db.conn.Exec(insertProvenance, provenanceArgs(p)...)
+	if err != nil {
+		return err
+	}
+
+	p.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetProvenance retrieves all provenance records of a file, oldest first
+func (db *DB) GetProvenance(fileID int64) ([]*Provenance, error) {
+	query := `
+	SELECT id, file_id, artifact, tool, tool_version, model, prompt_version,
+	       duration_ms, cost, details, created_at
+	FROM provenance
+	WHERE file_id = ?
+	ORDER BY created_at, id
+	`
+
+	rows, err := db.conn.Query(query, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*Provenance
+	for rows.Next() {
+		var p Provenance
+		var tool, toolVersion, model, promptVersion, details sql.NullString
+		var durationMS sql.NullInt64
+		var cost sql.NullFloat64
+		err := rows.Scan(
+			&p.ID,
+			&p.FileID,
+			&p.Artifact,
+			&tool,
+			&toolVersion,
+			&model,
+			&promptVersion,
+			&durationMS,
+			&cost,
+			&details,
+			&p.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Tool = tool.String
+		p.ToolVersion = toolVersion.String
+		p.Model = model.String
+		p.PromptVersion = promptVersion.String
+		p.Duration = time.Duration(durationMS.Int64) * time.Millisecond
+		p.Cost = cost.Float64
+		p.Details = details.String
+		records = append(records, &p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// Stages a file can be quarantined in
+const (
+	QuarantineScan       = "scan"       // Reading it to detect its type or hash it failed
+	QuarantineExtraction = "extraction" // Reading it failed after its extraction failed
+)
+
+// Quarantined is a file set aside because it could not be read, typically
+// from bad sectors on a failing drive. Runs skip it until a retry reads it.
+type Quarantined struct {
+	Path      string
+	Stage     string
+	Error     string
+	Attempts  int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// Quarantine sets a file aside after reading it failed in stage, or counts
+// another failed attempt if it already is
+func (db *DB) Quarantine(path, stage string, cause error) error {
+	now := time.Now()
+	_, err := db.conn.Exec(`
+	INSERT INTO quarantine (path, stage, error, attempts, first_seen, last_seen)
+	VALUES (?, ?, ?, 1, ?, ?)
+	ON CONFLICT (path) DO UPDATE
+	SET stage = excluded.stage, error = excluded.error, attempts = quarantine.attempts + 1,
+	    last_seen = excluded.last_seen
+	`, path, stage, cause.Error(), now, now)
+	return err
+}
+
+// GetQuarantined returns the quarantined files below root, or all of them
+// when root is empty
+func (db *DB) GetQuarantined(root string) ([]*Quarantined, error) {
+	root = strings.TrimSuffix(root, "/")
+	rows, err := db.conn.Query(`
+	SELECT path, stage, error, attempts, first_seen, last_seen
+	FROM quarantine
+	WHERE ? = '' OR path = ? OR path LIKE ? ESCAPE '\'
+	ORDER BY path
+	`, root, root, escapeLike(root)+"/%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*Quarantined
+	for rows.Next() {
+		file := &Quarantined{}
+		if err := rows.Scan(&file.Path, &file.Stage, &file.Error, &file.Attempts, &file.FirstSeen, &file.LastSeen); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// ReleaseQuarantine takes a file out of quarantine once it could be read
+func (db *DB) ReleaseQuarantine(path string) error {
+	_, err := db.conn.Exec("DELETE FROM quarantine WHERE path = ?", path)
+	return err
+}
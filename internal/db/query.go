@@ -0,0 +1,124 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// ClauseKind is how a clause of a structured query matches
+type ClauseKind string
+
+// Clause kinds
+const (
+	ClauseMatch     ClauseKind = "match"      // All the words, in any order
+	ClausePhrase    ClauseKind = "phrase"     // The words next to each other, in order
+	ClauseTerm      ClauseKind = "term"       // Exactly the value, as stored in a keyword field
+	ClausePrefix    ClauseKind = "prefix"     // A word starting with the value
+	ClauseSizeRange ClauseKind = "size-range" // Size between Min and Max bytes
+	ClauseDateRange ClauseKind = "date-range" // Modified from Start until End
+)
+
+// QueryFields are the index fields clauses can name
+var QueryFields = []string{
+	"Path", "RelativePath", "Name", "Summary", "Notes", "Caption", "Camera", "Content",
+	"Extension", "ContentType", "Drive", "Tags",
+	"People", "Organizations", "Places", "Dates", "DocumentType", "Keywords",
+	"Size", "ModTime", "UpdatedAt",
+}
+
+// Clause is one condition of a structured query. Field names an index
+// field, like Name, Summary or Tags; empty means any field.
+type Clause struct {
+	Kind  ClauseKind
+	Field string
+	Value string
+
+	// Bounds of range clauses. A zero bound leaves that side open; Min and
+	// Max are inclusive, End is exclusive.
+	Min, Max   int64
+	Start, End time.Time
+}
+
+// BooleanQuery combines clauses without going through the query string
+// parser: every Must clause has to match, at least one Should clause has to
+// match when there are no Must clauses (otherwise Should clauses only rank
+// results higher), and no Not clause may match.
+type BooleanQuery struct {
+	Must   []Clause
+	Should []Clause
+	Not    []Clause
+}
+
+// Empty reports whether the query has no clauses
+func (b BooleanQuery) Empty() bool {
+	return len(b.Must) == 0 && len(b.Should) == 0 && len(b.Not) == 0
+}
+
+// query builds the bleve query for the clauses
+func (b BooleanQuery) query() query.Query {
+	must := clauseQueries(b.Must)
+	should := clauseQueries(b.Should)
+	if len(must) == 0 && len(should) == 0 {
+		// Excluding from nothing matches nothing
+		must = []query.Query{bleve.NewMatchAllQuery()}
+	}
+	booleanQuery := bleve.NewBooleanQuery(must, should, clauseQueries(b.Not))
+	if len(must) == 0 {
+		booleanQuery.SetMinShould(1)
+	}
+	return booleanQuery
+}
+
+// clauseQueries builds a query for each clause
+func clauseQueries(clauses []Clause) []query.Query {
+	queries := make([]query.Query, len(clauses))
+	for i, clause := range clauses {
+		queries[i] = clause.query()
+	}
+	return queries
+}
+
+// query builds the bleve query for a clause
+func (c Clause) query() query.Query {
+	var q query.FieldableQuery
+	switch c.Kind {
+	case ClausePhrase:
+		q = bleve.NewMatchPhraseQuery(c.Value)
+	case ClauseTerm:
+		q = bleve.NewTermQuery(c.Value)
+	case ClausePrefix:
+		q = bleve.NewPrefixQuery(strings.ToLower(c.Value))
+	case ClauseSizeRange:
+		var min, max *float64
+		if c.Min > 0 {
+			value := float64(c.Min)
+			min = &value
+		}
+		if c.Max > 0 {
+			value := float64(c.Max)
+			max = &value
+		}
+		inclusive := true
+		rangeQuery := bleve.NewNumericRangeInclusiveQuery(min, max, &inclusive, &inclusive)
+		rangeQuery.SetField("Size")
+		return rangeQuery
+	case ClauseDateRange:
+		startInclusive, endInclusive := true, false
+		dateQuery := bleve.NewDateRangeInclusiveQuery(c.Start, c.End, &startInclusive, &endInclusive)
+		field := c.Field
+		if field == "" {
+			field = "ModTime"
+		}
+		dateQuery.SetField(field)
+		return dateQuery
+	default:
+		q = bleve.NewMatchQuery(c.Value)
+	}
+	if c.Field != "" {
+		q.SetField(c.Field)
+	}
+	return q
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Replica is a copy of a file in a destination other than the main bucket
+type Replica struct {
+	FileID      int64
+	Destination string
+	URL         string
+	SHA256      string // Content the copy was made from
+	UploadedAt  time.Time
+}
+
+// RecordReplica records a copy of a file's current content in a
+// destination, replacing any earlier copy there
+func (db *DB) RecordReplica(fileID int64, destination, url, sha256 string, uploadedAt time.Time) error {
+	_, err := db.conn.Exec(`
+	INSERT INTO replicas (file_id, destination, url, sha256, uploaded_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (file_id, destination) DO UPDATE
+	SET url = excluded.url, sha256 = excluded.sha256, uploaded_at = excluded.uploaded_at
+	`, fileID, destination, url, sha256, uploadedAt)
+	return err
+}
+
+// GetReplicas returns the copies of a file, by destination
+func (db *DB) GetReplicas(fileID int64) ([]*Replica, error) {
+	rows, err := db.conn.Query(`
+	SELECT file_id, destination, url, sha256, uploaded_at
+	FROM replicas
+	WHERE file_id = ?
+	ORDER BY destination
+	`, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var replicas []*Replica
+	for rows.Next() {
+		replica := &Replica{}
+		var sha256 sql.NullString
+		if err := rows.Scan(&replica.FileID, &replica.Destination, &replica.URL, &sha256, &replica.UploadedAt); err != nil {
+			return nil, err
+		}
+		replica.SHA256 = sha256.String
+		replicas = append(replicas, replica)
+	}
+	return replicas, rows.Err()
+}
+
+// ReplicatedHashes returns the SHA-256 each file was last copied to a
+// destination with, by file ID
+func (db *DB) ReplicatedHashes(destination string) (map[int64]string, error) {
+	rows, err := db.conn.Query("SELECT file_id, sha256 FROM replicas WHERE destination = ?", destination)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var sha256 sql.NullString
+		if err := rows.Scan(&id, &sha256); err != nil {
+			return nil, err
+		}
+		hashes[id] = sha256.String
+	}
+	return hashes, rows.Err()
+}
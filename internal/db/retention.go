@@ -0,0 +1,94 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Lock is the Object Lock setting of a file's upload, as last applied: a
+// retention date, a legal hold, or both. Neither archiver nor B2 deletes a
+// locked upload.
+type Lock struct {
+	FileID      int64
+	Path        string
+	Mode        string       // governance or compliance; empty for a legal hold only
+	RetainUntil sql.NullTime // End of the retention
+	LegalHold   bool
+	LockedAt    time.Time
+}
+
+// Locked reports whether the upload can't be deleted at now
+func (l *Lock) Locked(now time.Time) bool {
+	return l != nil && (l.LegalHold || l.RetainUntil.Valid && now.Before(l.RetainUntil.Time))
+}
+
+// RecordLock records the Object Lock applied to a file's upload. Retention
+// only ever lasts longer, so an earlier date than the one recorded is
+// ignored, and a lock without a legal hold leaves the one recorded.
+// LockedAt defaults to now.
+func (db *DB) RecordLock(lock *Lock) error {
+	if lock.LockedAt.IsZero() {
+		lock.LockedAt = time.Now()
+	}
+	current, err := db.GetLock(lock.FileID)
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		if !lock.RetainUntil.Valid || current.RetainUntil.Valid && current.RetainUntil.Time.After(lock.RetainUntil.Time) {
+			lock.Mode, lock.RetainUntil = current.Mode, current.RetainUntil
+		}
+		lock.LegalHold = lock.LegalHold || current.LegalHold
+	}
+
+	_, err = db.conn.Exec(`
+	INSERT OR REPLACE INTO retention (file_id, mode, retain_until, legal_hold, locked_at)
+	VALUES (?, ?, ?, ?, ?)
+	`, lock.FileID, lock.Mode, lock.RetainUntil, lock.LegalHold, lock.LockedAt)
+	return err
+}
+
+// ReleaseLegalHold records that the legal hold on a file's upload was
+// released
+func (db *DB) ReleaseLegalHold(fileID int64) error {
+	_, err := db.conn.Exec("UPDATE retention SET legal_hold = FALSE WHERE file_id = ?", fileID)
+	return err
+}
+
+// GetLock returns the Object Lock of a file's upload, or nil if it was
+// never locked
+func (db *DB) GetLock(fileID int64) (*Lock, error) {
+	locks, err := db.queryLocks("WHERE r.file_id = ?", fileID)
+	if err != nil || len(locks) == 0 {
+		return nil, err
+	}
+	return locks[0], nil
+}
+
+// GetLocks returns the Object Locks of every upload locked, in path order
+func (db *DB) GetLocks() ([]*Lock, error) {
+	return db.queryLocks("ORDER BY f.path")
+}
+
+// queryLocks selects the locks with their file's path
+func (db *DB) queryLocks(clause string, args ...interface{}) ([]*Lock, error) {
+	rows, err := db.conn.Query(`
+	SELECT r.file_id, COALESCE(f.path, ''), COALESCE(r.mode, ''), r.retain_until, r.legal_hold, r.locked_at
+	FROM retention r
+	LEFT JOIN files f ON f.id = r.file_id
+	`+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locks []*Lock
+	for rows.Next() {
+		l := &Lock{}
+		if err := rows.Scan(&l.FileID, &l.Path, &l.Mode, &l.RetainUntil, &l.LegalHold, &l.LockedAt); err != nil {
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return locks, rows.Err()
+}
@@ -0,0 +1,270 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Run statuses
+const (
+	RunRunning     = "running"
+	RunCompleted   = "completed"
+	RunFailed      = "failed"
+	RunInterrupted = "interrupted"
+)
+
+// Run is one recorded pipeline execution
+type Run struct {
+	ID             int64
+	Command        string // Command that started the run, e.g. "ingest" or "schedule 2"
+	Source         string
+	Status         string
+	StartedAt      time.Time
+	FinishedAt     sql.NullTime
+	FilesTotal     int64
+	FilesProcessed int64
+	FilesSkipped   int64
+	FilesFailed    int64
+	BytesProcessed int64
+	BytesUploaded  int64
+	Cost           float64
+	Error          string
+	FilesRemaining int64  // Files an interrupted run left for the next one
+	Stage          string // Pipeline stage the run reached, where an interrupted run stopped
+}
+
+// RunError is a file that failed during a run
+type RunError struct {
+	RunID     int64
+	Path      string
+	Error     string
+	CreatedAt time.Time
+}
+
+// runColumns is the column list matching scanRun, in order
+const runColumns = `id, command, source, status, started_at, finished_at,
+	       files_total, files_processed, files_skipped, files_failed,
+	       bytes_processed, bytes_uploaded, cost, error, files_remaining, stage`
+
+// scanRun scans a row selected with runColumns into a Run
+func scanRun(row rowScanner) (*Run, error) {
+	var run Run
+	var source, runErr, stage sql.NullString
+	err := row.Scan(
+		&run.ID,
+		&run.Command,
+		&source,
+		&run.Status,
+		&run.StartedAt,
+		&run.FinishedAt,
+		&run.FilesTotal,
+		&run.FilesProcessed,
+		&run.FilesSkipped,
+		&run.FilesFailed,
+		&run.BytesProcessed,
+		&run.BytesUploaded,
+		&run.Cost,
+		&runErr,
+		&run.FilesRemaining,
+		&stage,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	run.Source = source.String
+	run.Error = runErr.String
+	run.Stage = stage.String
+	return &run, nil
+}
+
+// StartRun records the start of a run
+func (db *DB) StartRun(command, source string) (*Run, error) {
+	run := &Run{
+		Command:   command,
+		Source:    source,
+		Status:    RunRunning,
+		StartedAt: time.Now(),
+	}
+
+	result, err := db.conn.Exec("INSERT INTO runs (command, source, status, started_at) VALUES (?, ?, ?, ?)",
+		run.Command, run.Source, run.Status, run.StartedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record run: %w", err)
+	}
+
+	run.ID, err = result.LastInsertId()
+	return run, err
+}
+
+// FinishRun records the totals of a run and how it ended. The run fails
+// if runErr is set, or is interrupted if runErr is a context cancellation.
+func (db *DB) FinishRun(run *Run, runErr error) error {
+	run.FinishedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	run.Status = RunCompleted
+	if runErr != nil {
+		run.Status = RunFailed
+		if errors.Is(runErr, context.Canceled) {
+			run.Status = RunInterrupted
+		}
+		run.Error = runErr.Error()
+	}
+
+	query := `
+	UPDATE runs
+	SET status = ?, finished_at = ?, files_total = ?, files_processed = ?,
+	    files_skipped = ?, files_failed = ?, bytes_processed = ?,
+	    bytes_uploaded = ?, cost = ?, error = ?, files_remaining = ?, stage = ?
+	WHERE id = ?
+	`
+
+	_, err := db.conn.Exec(query, run.Status, run.FinishedAt, run.FilesTotal, run.FilesProcessed,
+		run.FilesSkipped, run.FilesFailed, run.BytesProcessed, run.BytesUploaded, run.Cost, run.Error,
+		run.FilesRemaining, run.Stage, run.ID)
+	return err
+}
+
+// AddRunError records a file that failed during a run
+func (db *DB) AddRunError(runID int64, path string, fileErr error) error {
+	_, err := db.conn.Exec("INSERT INTO run_errors (run_id, path, error, created_at) VALUES (?, ?, ?, ?)",
+		runID, path, fileErr.Error(), time.Now())
+	return err
+}
+
+// ListRuns retrieves the most recent runs, newest first. A limit of 0
+// retrieves all of them.
+func (db *DB) ListRuns(limit int) ([]*Run, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := db.conn.Query("SELECT "+runColumns+" FROM runs ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// GetRun retrieves a run by ID
+func (db *DB) GetRun(id int64) (*Run, error) {
+	run, err := scanRun(db.conn.QueryRow("SELECT "+runColumns+" FROM runs WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no run with id %d", id)
+	}
+	return run, err
+}
+
+// LatestInterruptedRun retrieves the most recent interrupted run that no
+// later run of the same source completed, or nil if there is none
+func (db *DB) LatestInterruptedRun() (*Run, error) {
+	query := `
+	SELECT ` + runColumns + `
+	FROM runs
+	WHERE status = ? AND NOT EXISTS (
+		SELECT 1 FROM runs later
+		WHERE later.source = runs.source AND later.id > runs.id AND later.status = ?
+	)
+	ORDER BY id DESC
+	LIMIT 1
+	`
+
+	run, err := scanRun(db.conn.QueryRow(query, RunInterrupted, RunCompleted))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return run, err
+}
+
+// InterruptedRuns retrieves the latest interrupted run of each source that
+// no later run of the source completed or was interrupted in, oldest first
+func (db *DB) InterruptedRuns() ([]*Run, error) {
+	query := `
+	SELECT ` + runColumns + `
+	FROM runs
+	WHERE status = ? AND NOT EXISTS (
+		SELECT 1 FROM runs later
+		WHERE later.source = runs.source AND later.id > runs.id AND later.status IN (?, ?)
+	)
+	ORDER BY id
+	`
+
+	rows, err := db.conn.Query(query, RunInterrupted, RunCompleted, RunInterrupted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// MarkCrashedRuns marks the runs still recorded as running that started
+// before the given time, such as the last boot, as interrupted. Their
+// process died without recording how they ended. It returns the number of
+// runs marked.
+func (db *DB) MarkCrashedRuns(before time.Time) (int64, error) {
+	result, err := db.conn.Exec("UPDATE runs SET status = ?, error = ? WHERE status = ? AND started_at < ?",
+		RunInterrupted, "crashed: the run never finished", RunRunning, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark crashed runs: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetRunErrors retrieves the files that failed during a run, in the order
+// they failed
+func (db *DB) GetRunErrors(runID int64) ([]RunError, error) {
+	return db.queryRunErrors("SELECT run_id, path, error, created_at FROM run_errors WHERE run_id = ? ORDER BY rowid", runID)
+}
+
+// GetRunErrorsSince retrieves the files that failed in any run since a time
+// (or ever, if since is zero), in the order they failed
+func (db *DB) GetRunErrorsSince(since time.Time) ([]RunError, error) {
+	return db.queryRunErrors("SELECT run_id, path, error, created_at FROM run_errors WHERE created_at >= ? ORDER BY created_at, rowid", since)
+}
+
+// GetFileErrors retrieves the errors a file had in any run, oldest first
+func (db *DB) GetFileErrors(path string) ([]RunError, error) {
+	return db.queryRunErrors("SELECT run_id, path, error, created_at FROM run_errors WHERE path = ? ORDER BY created_at, rowid", path)
+}
+
+// queryRunErrors runs a query selecting run_id, path, error and created_at
+func (db *DB) queryRunErrors(query string, args ...interface{}) ([]RunError, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runErrors []RunError
+	for rows.Next() {
+		var runError RunError
+		if err := rows.Scan(&runError.RunID, &runError.Path, &runError.Error, &runError.CreatedAt); err != nil {
+			return nil, err
+		}
+		runErrors = append(runErrors, runError)
+	}
+
+	return runErrors, rows.Err()
+}
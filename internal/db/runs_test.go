@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRuns(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	var runs []*Run
+	for _, source := range []string{"/Volumes/A", "/Volumes/B", "/Volumes/C"} {
+		run, err := database.StartRun("archive", source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, run)
+	}
+
+	started, err := database.GetRun(runs[0].ID)
+	if err != nil || started.Status != RunRunning || started.Source != "/Volumes/A" || started.FinishedAt.Valid {
+		t.Fatalf("started run = %+v, %v; want it running and unfinished", started, err)
+	}
+
+	runs[0].FilesProcessed, runs[0].BytesUploaded, runs[0].Cost = 12, 4096, 0.25
+	runs[0].Stage = "upload"
+	for i, runErr := range []error{nil, errors.New("drive unplugged"), fmt.Errorf("scan: %w", context.Canceled)} {
+		if err := database.FinishRun(runs[i], runErr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.AddRunError(runs[1].ID, "/Volumes/B/bad.pdf", errors.New("corrupt")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []string{RunCompleted, RunFailed, RunInterrupted} {
+		run, err := database.GetRun(runs[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Status != want || !run.FinishedAt.Valid {
+			t.Errorf("run %d = %s, finished %v; want %s", i, run.Status, run.FinishedAt.Valid, want)
+		}
+	}
+	finished, _ := database.GetRun(runs[0].ID)
+	if finished.FilesProcessed != 12 || finished.BytesUploaded != 4096 || finished.Cost != 0.25 || finished.Stage != "upload" {
+		t.Errorf("finished run totals = %+v", finished)
+	}
+	if failed, _ := database.GetRun(runs[1].ID); failed.Error != "drive unplugged" {
+		t.Errorf("failed run error = %q", failed.Error)
+	}
+	runErrors, err := database.GetRunErrors(runs[1].ID)
+	if err != nil || len(runErrors) != 1 || runErrors[0].Path != "/Volumes/B/bad.pdf" || runErrors[0].Error != "corrupt" {
+		t.Errorf("GetRunErrors = %+v, %v", runErrors, err)
+	}
+
+	listed, err := database.ListRuns(0)
+	if err != nil || len(listed) != 3 {
+		t.Fatalf("ListRuns(0) = %d runs, %v; want 3", len(listed), err)
+	}
+	for i, run := range listed {
+		if want := runs[len(runs)-1-i].ID; run.ID != want {
+			t.Errorf("ListRuns()[%d] = run %d, want %d: newest first", i, run.ID, want)
+		}
+	}
+	if listed, err := database.ListRuns(2); err != nil || len(listed) != 2 || listed[0].ID != runs[2].ID {
+		t.Errorf("ListRuns(2) = %d runs, %v; want the 2 newest", len(listed), err)
+	}
+
+	if _, err := database.GetRun(999); err == nil || !strings.Contains(err.Error(), "no run with id 999") {
+		t.Errorf("GetRun of an unknown run: err = %v", err)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	var jobs []*Job
+	for _, source := range []string{"/Volumes/A", "/Volumes/B", "/Volumes/C"} {
+		job := &Job{Source: source, Summarize: "basic"}
+		if err := database.QueueJob(job); err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := database.CancelJob(jobs[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := database.TakeJob()
+	if err != nil || first == nil || first.ID != jobs[0].ID || first.Status != RunRunning || !first.StartedAt.Valid {
+		t.Fatalf("TakeJob = %+v, %v; want the first job running", first, err)
+	}
+	if err := database.CancelJob(first.ID); err == nil {
+		t.Error("cancelled a running job")
+	}
+	run, err := database.StartRun(first.Command(), first.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.FinishJob(first, nil); err != nil {
+		t.Fatal(err)
+	}
+	if first.Status != RunCompleted || first.RunID != run.ID {
+		t.Errorf("finished job = %s with run %d, want completed with run %d", first.Status, first.RunID, run.ID)
+	}
+
+	// The cancelled job is skipped
+	second, err := database.TakeJob()
+	if err != nil || second == nil || second.ID != jobs[2].ID {
+		t.Fatalf("TakeJob = %+v, %v; want the third job", second, err)
+	}
+	if err := database.FinishJob(second, errors.New("source not found")); err != nil {
+		t.Fatal(err)
+	}
+	if second.Status != RunFailed || second.RunID != 0 {
+		t.Errorf("job failing before its run = %s with run %d, want failed with none", second.Status, second.RunID)
+	}
+	if job, err := database.TakeJob(); err != nil || job != nil {
+		t.Errorf("TakeJob of an empty queue = %+v, %v", job, err)
+	}
+
+	if pending, err := database.ListJobs(false); err != nil || len(pending) != 0 {
+		t.Errorf("ListJobs(false) = %d jobs, %v; want none left", len(pending), err)
+	}
+	all, err := database.ListJobs(true)
+	if err != nil || len(all) != 3 {
+		t.Fatalf("ListJobs(true) = %d jobs, %v; want 3", len(all), err)
+	}
+	for i, want := range []string{RunCompleted, JobCancelled, RunFailed} {
+		if all[i].ID != jobs[i].ID || all[i].Status != want {
+			t.Errorf("job %d = %d %s, want %d %s", i, all[i].ID, all[i].Status, jobs[i].ID, want)
+		}
+	}
+	if err := database.CancelJob(999); err == nil {
+		t.Error("cancelled an unknown job")
+	}
+
+	// A job left running by a worker that died is queued again
+	crashed := &Job{Source: "/Volumes/D"}
+	if err := database.QueueJob(crashed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.TakeJob(); err != nil {
+		t.Fatal(err)
+	}
+	if requeued, err := database.RequeueCrashedJobs(time.Now().Add(time.Minute)); err != nil || requeued != 1 {
+		t.Errorf("RequeueCrashedJobs = %d, %v; want 1", requeued, err)
+	}
+	if job, err := database.TakeJob(); err != nil || job == nil || job.ID != crashed.ID {
+		t.Errorf("TakeJob after requeueing = %+v, %v; want the crashed job", job, err)
+	}
+}
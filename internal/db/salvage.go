@@ -0,0 +1,53 @@
+package db
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/salvage"
+)
+
+// Salvaged is a file copied from a failing drive with what could be read of
+// it. Partial files have bad ranges, which were replaced with zeros in the
+// copy cataloged and uploaded.
+type Salvaged struct {
+	FileID     int64
+	Path       string
+	Size       int64
+	Partial    bool
+	Recovered  int64 // Bytes read
+	BadRanges  []salvage.Range
+	SalvagedAt time.Time
+}
+
+// GetSalvaged returns the salvaged files below root, or all of them when
+// root is empty
+func (db *DB) GetSalvaged(root string) ([]*Salvaged, error) {
+	root = strings.TrimSuffix(root, "/")
+	rows, err := db.conn.Query(`
+	SELECT s.file_id, f.path, f.size, s.partial, s.recovered, s.bad_ranges, s.salvaged_at
+	FROM salvaged s
+	JOIN files f ON f.id = s.file_id
+	WHERE ? = '' OR f.path = ? OR f.path LIKE ? ESCAPE '\'
+	ORDER BY f.path
+	`, root, root, escapeLike(root)+"/%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*Salvaged
+	for rows.Next() {
+		file := &Salvaged{}
+		var badRanges string
+		if err := rows.Scan(&file.FileID, &file.Path, &file.Size, &file.Partial, &file.Recovered, &badRanges, &file.SalvagedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(badRanges), &file.BadRanges); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
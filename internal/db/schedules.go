@@ -0,0 +1,94 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Schedule is a recurring archive run of a source
+type Schedule struct {
+	ID         int64
+	Spec       string // Cron expression, e.g. "0 2 * * *"
+	Source     string
+	Summarize  string // Summarization level; empty uses the default
+	IncludeAll bool
+	CreatedAt  time.Time
+	LastRun    sql.NullTime
+	LastError  string
+}
+
+// AddSchedule stores a new schedule and sets its ID
+func (db *DB) AddSchedule(s *Schedule) error {
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+
+	query := `
+	INSERT INTO schedules (spec, source, summarize, include_all, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	`
+
+	result, err := db.conn.Exec(query, s.Spec, s.Source, s.Summarize, s.IncludeAll, s.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	s.ID, err = result.LastInsertId()
+	return err
+}
+
+// ListSchedules retrieves all schedules in the order they were added
+func (db *DB) ListSchedules() ([]*Schedule, error) {
+	query := `
+	SELECT id, spec, source, summarize, include_all, created_at, last_run, last_error
+	FROM schedules
+	ORDER BY id
+	`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*Schedule
+	for rows.Next() {
+		var s Schedule
+		var summarize, lastError sql.NullString
+		err := rows.Scan(&s.ID, &s.Spec, &s.Source, &summarize, &s.IncludeAll,
+			&s.CreatedAt, &s.LastRun, &lastError)
+		if err != nil {
+			return nil, err
+		}
+		s.Summarize = summarize.String
+		s.LastError = lastError.String
+		schedules = append(schedules, &s)
+	}
+
+	return schedules, rows.Err()
+}
+
+// RemoveSchedule deletes a schedule
+func (db *DB) RemoveSchedule(id int64) error {
+	result, err := db.conn.Exec("DELETE FROM schedules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("no schedule with id %d", id)
+	}
+	return nil
+}
+
+// RecordScheduleRun records when a schedule last ran and the error it ended
+// with, if any
+func (db *DB) RecordScheduleRun(id int64, ranAt time.Time, runErr error) error {
+	var lastError string
+	if runErr != nil {
+		lastError = runErr.Error()
+	}
+
+	_, err := db.conn.Exec("UPDATE schedules SET last_run = ?, last_error = ? WHERE id = ?", ranAt, lastError, id)
+	return err
+}
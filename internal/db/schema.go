@@ -0,0 +1,459 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// baseSchema creates the catalog tables if they don't exist yet
+const baseSchema = `
+CREATE TABLE IF NOT EXISTS files (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	path TEXT NOT NULL,
+	relative_path TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	mod_time DATETIME NOT NULL,
+	is_dir BOOLEAN NOT NULL,
+	content_type TEXT,
+	sha256 TEXT,
+	processed BOOLEAN DEFAULT FALSE,
+	uploaded_url TEXT,
+	upload_time DATETIME,
+	summary TEXT,
+	UNIQUE(path)
+);
+CREATE INDEX IF NOT EXISTS idx_files_path ON files(path);
+CREATE INDEX IF NOT EXISTS idx_files_relative_path ON files(relative_path);
+CREATE INDEX IF NOT EXISTS idx_files_processed ON files(processed);
+
+CREATE TABLE IF NOT EXISTS provenance (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	file_id INTEGER NOT NULL,
+	artifact TEXT NOT NULL,
+	tool TEXT,
+	tool_version TEXT,
+	model TEXT,
+	prompt_version TEXT,
+	duration_ms INTEGER,
+	cost REAL,
+	details TEXT,
+	created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_provenance_file ON provenance(file_id);
+
+CREATE TABLE IF NOT EXISTS file_text (
+	file_id INTEGER PRIMARY KEY,
+	text TEXT NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS file_tags (
+	file_id INTEGER NOT NULL,
+	tag TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (file_id, tag)
+);
+CREATE INDEX IF NOT EXISTS idx_file_tags_tag ON file_tags(tag);
+
+CREATE TABLE IF NOT EXISTS tag_edits (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	description TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	undone_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS tag_edit_changes (
+	edit_id INTEGER NOT NULL,
+	file_id INTEGER NOT NULL,
+	tag TEXT NOT NULL,
+	added BOOLEAN NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_tag_edit_changes_edit ON tag_edit_changes(edit_id);
+
+CREATE TABLE IF NOT EXISTS schedules (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	spec TEXT NOT NULL,
+	source TEXT NOT NULL,
+	summarize TEXT,
+	include_all BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at DATETIME NOT NULL,
+	last_run DATETIME,
+	last_error TEXT
+);
+
+CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	command TEXT NOT NULL,
+	source TEXT,
+	status TEXT NOT NULL,
+	started_at DATETIME NOT NULL,
+	finished_at DATETIME,
+	files_total INTEGER NOT NULL DEFAULT 0,
+	files_processed INTEGER NOT NULL DEFAULT 0,
+	files_skipped INTEGER NOT NULL DEFAULT 0,
+	files_failed INTEGER NOT NULL DEFAULT 0,
+	bytes_processed INTEGER NOT NULL DEFAULT 0,
+	bytes_uploaded INTEGER NOT NULL DEFAULT 0,
+	cost REAL NOT NULL DEFAULT 0,
+	error TEXT
+);
+
+CREATE TABLE IF NOT EXISTS run_errors (
+	run_id INTEGER NOT NULL,
+	path TEXT NOT NULL,
+	error TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_run_errors_run ON run_errors(run_id);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	source TEXT NOT NULL,
+	summarize TEXT,
+	include_all BOOLEAN NOT NULL DEFAULT FALSE,
+	status TEXT NOT NULL,
+	queued_at DATETIME NOT NULL,
+	started_at DATETIME,
+	finished_at DATETIME,
+	run_id INTEGER,
+	error TEXT
+);
+
+CREATE TABLE IF NOT EXISTS replicas (
+	file_id INTEGER NOT NULL,
+	destination TEXT NOT NULL,
+	url TEXT NOT NULL,
+	sha256 TEXT,
+	uploaded_at DATETIME NOT NULL,
+	PRIMARY KEY (file_id, destination)
+);
+
+CREATE TABLE IF NOT EXISTS costs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	run_id INTEGER,
+	file_id INTEGER,
+	kind TEXT NOT NULL,
+	provider TEXT,
+	model TEXT,
+	amount REAL NOT NULL,
+	bytes INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_costs_created ON costs(created_at);
+
+CREATE TABLE IF NOT EXISTS summary_cache (
+	sha256 TEXT NOT NULL,
+	level TEXT NOT NULL,
+	model_family TEXT NOT NULL,
+	summary TEXT NOT NULL,
+	model TEXT NOT NULL,
+	provider TEXT,
+	prompt_version TEXT,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (sha256, level, model_family)
+);
+
+CREATE TABLE IF NOT EXISTS file_entities (
+	file_id INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (file_id, kind, value)
+);
+CREATE INDEX IF NOT EXISTS idx_file_entities_value ON file_entities(kind, value);
+
+CREATE TABLE IF NOT EXISTS file_metadata (
+	file_id INTEGER NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (file_id, key)
+);
+
+CREATE TABLE IF NOT EXISTS notes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	file_id INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_notes_file ON notes(file_id);
+
+CREATE TABLE IF NOT EXISTS captions (
+	file_id INTEGER PRIMARY KEY,
+	caption TEXT NOT NULL,
+	model TEXT,
+	created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS image_hashes (
+	file_id INTEGER PRIMARY KEY,
+	sha256 TEXT NOT NULL,
+	dhash TEXT NOT NULL,
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	sharpness REAL NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS photo_exif (
+	file_id INTEGER PRIMARY KEY,
+	camera TEXT NOT NULL,
+	lens TEXT NOT NULL,
+	iso INTEGER NOT NULL,
+	exposure_time TEXT NOT NULL,
+	f_number REAL NOT NULL,
+	focal_length REAL NOT NULL,
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	orientation INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS photo_bursts (
+	file_id INTEGER PRIMARY KEY,
+	best_id INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_photo_bursts_best ON photo_bursts(best_id);
+
+CREATE TABLE IF NOT EXISTS drive_health (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	drive TEXT NOT NULL,
+	device TEXT NOT NULL,
+	model TEXT,
+	serial TEXT,
+	passed BOOLEAN NOT NULL,
+	reallocated INTEGER NOT NULL,
+	pending INTEGER NOT NULL,
+	uncorrectable INTEGER NOT NULL,
+	power_on_hours INTEGER NOT NULL,
+	temperature INTEGER NOT NULL,
+	checked_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_drive_health_drive ON drive_health(drive);
+
+CREATE TABLE IF NOT EXISTS index_queue (
+	file_id INTEGER PRIMARY KEY,
+	version INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS stubs (
+	original_path TEXT PRIMARY KEY,
+	stub_path TEXT NOT NULL,
+	url TEXT NOT NULL,
+	mode TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS quarantine (
+	path TEXT PRIMARY KEY,
+	stage TEXT NOT NULL,
+	error TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	first_seen DATETIME NOT NULL,
+	last_seen DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS salvaged (
+	file_id INTEGER PRIMARY KEY,
+	partial BOOLEAN NOT NULL,
+	recovered INTEGER NOT NULL,
+	bad_ranges TEXT NOT NULL,
+	salvaged_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS name_mappings (
+	file_id INTEGER PRIMARY KEY,
+	layout_name TEXT NOT NULL,
+	remote_name TEXT NOT NULL,
+	collision TEXT NOT NULL,
+	recorded_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS shares (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	file_id INTEGER NOT NULL,
+	shared_with TEXT,
+	shared_by TEXT,
+	key_id TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	revoked_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_shares_file ON shares(file_id);
+
+CREATE TABLE IF NOT EXISTS file_versions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	file_id INTEGER NOT NULL,
+	sha256 TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	mod_time DATETIME,
+	summary TEXT,
+	uploaded_url TEXT,
+	remote_name TEXT,
+	upload_time DATETIME,
+	replaced_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_file_versions_file ON file_versions(file_id);
+
+CREATE TABLE IF NOT EXISTS retention (
+	file_id INTEGER PRIMARY KEY,
+	mode TEXT,
+	retain_until DATETIME,
+	legal_hold BOOLEAN NOT NULL DEFAULT FALSE,
+	locked_at DATETIME NOT NULL
+);
+`
+
+// column describes a column added to an existing table after its creation
+type column struct {
+	table      string
+	name       string
+	definition string
+}
+
+// addedColumns lists columns introduced after the original schema.
+// They are added in order to databases created by older versions.
+var addedColumns = []column{
+	{"files", "extractor", "TEXT"},
+	{"files", "extract_quality", "REAL"},
+	{"files", "summary_model", "TEXT"},
+	{"files", "deleted_at", "DATETIME"},
+	{"files", "delete_reason", "TEXT"},
+	{"runs", "files_remaining", "INTEGER NOT NULL DEFAULT 0"},
+	{"files", "sha1", "TEXT"},
+	{"runs", "stage", "TEXT"},
+	{"files", "upload_sha256", "TEXT"},
+	{"files", "scanned_at", "DATETIME"},
+	{"files", "remote_name", "TEXT"},
+	{"files", "taken_at", "DATETIME"},
+	{"summary_cache", "entities", "TEXT"},
+	{"stubs", "state", "TEXT NOT NULL DEFAULT 'complete'"},
+	{"files", "path_key", "TEXT"},
+	{"files", "remote_name_folded", "TEXT"},
+}
+
+// addedIndexes are created once the added columns they cover exist
+var addedIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_files_remote_name ON files(remote_name)",
+	"CREATE INDEX IF NOT EXISTS idx_files_path_key ON files(path_key)",
+	"CREATE INDEX IF NOT EXISTS idx_files_remote_name_folded ON files(remote_name_folded)",
+}
+
+// indexedTables are the tables the search index documents are built from,
+// with the column holding the file ID. Changes to them queue the file for
+// indexing.
+var indexedTables = []struct {
+	table  string
+	column string
+}{
+	{"file_text", "file_id"},
+	{"file_tags", "file_id"},
+	{"file_entities", "file_id"},
+	{"notes", "file_id"},
+	{"captions", "file_id"},
+	{"photo_exif", "file_id"},
+}
+
+// indexedColumns are the columns of files the index documents use. Updates
+// to other columns, like the scan time, don't queue the file.
+const indexedColumns = "path, relative_path, size, mod_time, is_dir, content_type, summary, uploaded_url, deleted_at"
+
+// indexTriggers returns the triggers that queue files for indexing in the
+// same transaction as the change, so the index catches up after a crash.
+// They are created once the added columns they watch exist, and replaced
+// on every open so that changes to them reach existing catalogs. They
+// upsert rather than INSERT OR REPLACE, as the conflict handling of a
+// trigger gives way to the upsert of a rescan that fires it.
+func indexTriggers() []string {
+	queue := func(id string) string {
+		return fmt.Sprintf(`INSERT INTO index_queue (file_id, version) VALUES (%s, 1)
+		ON CONFLICT (file_id) DO UPDATE SET version = index_queue.version + 1;`, id)
+	}
+	trigger := func(name, event, body string) string {
+		return fmt.Sprintf(`DROP TRIGGER IF EXISTS %[1]s;
+		CREATE TRIGGER %[1]s AFTER %[2]s BEGIN %[3]s END`, name, event, body)
+	}
+	triggers := []string{
+		trigger("index_files_insert", "INSERT ON files", queue("NEW.id")),
+		trigger("index_files_update", "UPDATE OF "+indexedColumns+" ON files", queue("NEW.id")),
+		trigger("index_files_delete", "DELETE ON files", queue("OLD.id")),
+	}
+	for _, t := range indexedTables {
+		for _, event := range []string{"INSERT", "UPDATE", "DELETE"} {
+			row := "NEW."
+			if event == "DELETE" {
+				row = "OLD."
+			}
+			triggers = append(triggers, trigger("index_"+t.table+"_"+strings.ToLower(event),
+				event+" ON "+t.table, queue(row+t.column)))
+		}
+	}
+	return triggers
+}
+
+// Migrate brings the schema of conn up to date. It is safe to call on every
+// open; existing tables and columns are left untouched.
+func Migrate(conn *sql.DB) error {
+	if _, err := conn.Exec(baseSchema); err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	for _, col := range addedColumns {
+		exists, err := columnExists(conn, col.table, col.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.name, col.definition)
+		if _, err := conn.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", col.table, col.name, err)
+		}
+	}
+
+	for _, stmt := range addedIndexes {
+		if _, err := conn.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range indexTriggers() {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create trigger: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// columnExists reports whether a table has a column with the given name
+func columnExists(conn *sql.DB, table, name string) (bool, error) {
+	rows, err := conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			colName    string
+			colType    string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &colName, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if colName == name {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Share is a link to an uploaded file handed out with archiver share. The
+// link itself is not kept, as it grants access until it expires.
+type Share struct {
+	ID         int64
+	FileID     int64
+	Path       string
+	SharedWith string
+	SharedBy   string
+	KeyID      string // Key that signed the link
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+}
+
+// Active reports whether the link still works at now
+func (s *Share) Active(now time.Time) bool {
+	return !s.RevokedAt.Valid && now.Before(s.ExpiresAt)
+}
+
+// RecordShare records a link handed out. CreatedAt defaults to now.
+func (db *DB) RecordShare(share *Share) error {
+	if share.CreatedAt.IsZero() {
+		share.CreatedAt = time.Now()
+	}
+	result, err := db.conn.Exec(`
+	INSERT INTO shares (file_id, shared_with, shared_by, key_id, created_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`, share.FileID, share.SharedWith, share.SharedBy, share.KeyID, share.CreatedAt, share.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	share.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetShares returns the links handed out for a file, or for every file when
+// fileID is 0, newest first
+func (db *DB) GetShares(fileID int64) ([]*Share, error) {
+	rows, err := db.conn.Query(`
+	SELECT s.id, s.file_id, COALESCE(f.path, ''), COALESCE(s.shared_with, ''), COALESCE(s.shared_by, ''),
+	       s.key_id, s.created_at, s.expires_at, s.revoked_at
+	FROM shares s
+	LEFT JOIN files f ON f.id = s.file_id
+	WHERE ? = 0 OR s.file_id = ?
+	ORDER BY s.created_at DESC, s.id DESC
+	`, fileID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []*Share
+	for rows.Next() {
+		s := &Share{}
+		if err := rows.Scan(&s.ID, &s.FileID, &s.Path, &s.SharedWith, &s.SharedBy,
+			&s.KeyID, &s.CreatedAt, &s.ExpiresAt, &s.RevokedAt); err != nil {
+			return nil, err
+		}
+		shares = append(shares, s)
+	}
+	return shares, rows.Err()
+}
+
+// RevokeShares marks the unexpired links signed with a key revoked, once the
+// key is deleted, and returns how many there were
+func (db *DB) RevokeShares(keyID string) (int64, error) {
+	now := time.Now()
+	result, err := db.conn.Exec(`
+	UPDATE shares SET revoked_at = ?
+	WHERE key_id = ? AND revoked_at IS NULL AND expires_at > ?
+	`, now, keyID, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// busyTimeout is how long a connection waits for another connection's write
+// to finish before failing with "database is locked"
+const busyTimeout = 10 * time.Second
+
+// SyncModes are the values of SQLite's synchronous setting: how often it
+// waits for writes to reach the disk. In WAL mode normal can lose the last
+// transactions on a power loss but never corrupts the database; full and
+// extra lose nothing but are slower, and off trusts the operating system.
+var SyncModes = []string{"off", "normal", "full", "extra"}
+
+var (
+	mu       sync.Mutex
+	syncMode = "normal"
+)
+
+// SetSyncMode sets the synchronous setting of the databases opened
+// afterwards, one of SyncModes; empty for normal
+func SetSyncMode(mode string) error {
+	if mode == "" {
+		mode = "normal"
+	}
+	mode = strings.ToLower(mode)
+	if !slices.Contains(SyncModes, mode) {
+		return fmt.Errorf("unknown database sync mode %q (expected %s)", mode, strings.Join(SyncModes, ", "))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	syncMode = mode
+	return nil
+}
+
+// DSN returns the data source name opening the SQLite database at path in
+// WAL mode, so that readers such as search don't fail while a scan writes,
+// with the busy timeout and the sync mode set with SetSyncMode.
+// Transactions take the write lock when they begin, so that two of them
+// can't both read and then wait on each other to write.
+func DSN(path string) string {
+	mu.Lock()
+	mode := syncMode
+	mu.Unlock()
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%s_journal_mode=WAL&_busy_timeout=%d&_synchronous=%s&_txlock=immediate",
+		path, separator, busyTimeout.Milliseconds(), strings.ToUpper(mode))
+}
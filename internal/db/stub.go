@@ -1,11 +1,16 @@
 package db
 
 import (
+	"bytes"
 	"encoding/xml"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/pathnorm"
 )
 
 // StubMode represents the format of the stub file
@@ -27,6 +32,8 @@ type StubResult struct {
 	URL          string
 	Mode         StubMode
 	Error        error
+	CreatedAt    time.Time // Set on stubs read back from the database
+	State        StubState // Set on stubs read back from the database
 }
 
 // WeblocFile represents an Apple .webloc file
@@ -52,19 +59,12 @@ func CreateStub(originalPath, url string, mode StubMode) (*StubResult, error) {
 		return result, nil
 	}
 
-	// Determine stub path
-	var stubPath string
-	switch mode {
-	case StubModeWebloc:
-		stubPath = originalPath + ".webloc"
-	case StubModeShortcut:
-		stubPath = originalPath + ".url"
-	default:
-		return nil, fmt.Errorf("unsupported stub mode: %s", mode)
+	stubPath, err := stubPathFor(originalPath, mode)
+	if err != nil {
+		return nil, err
 	}
 	result.StubPath = stubPath
 
-	var err error
 	switch mode {
 	case StubModeWebloc:
 		err = createWeblocFile(stubPath, url)
@@ -80,30 +80,133 @@ func CreateStub(originalPath, url string, mode StubMode) (*StubResult, error) {
 	return result, nil
 }
 
-// ReplaceWithStub replaces a file with a stub
-func ReplaceWithStub(originalPath, url string, mode StubMode) (*StubResult, error) {
-	// Create the stub
-	result, err := CreateStub(originalPath, url, mode)
-	if err != nil {
-		return result, err
+// stubPathFor returns the path of the stub of the given mode for a file.
+// Names that would be too long with the stub's extension are shortened.
+func stubPathFor(originalPath string, mode StubMode) (string, error) {
+	var ext string
+	switch mode {
+	case StubModeWebloc:
+		ext = ".webloc"
+	case StubModeShortcut:
+		ext = ".url"
+	default:
+		return "", fmt.Errorf("unsupported stub mode: %s", mode)
 	}
+	dir, name := filepath.Split(originalPath)
+	return pathnorm.Long(dir + pathnorm.FitName(name+ext, pathnorm.MaxNameBytes)), nil
+}
+
+// StubState is how far replacing a file with a stub got. Each step is
+// recorded before the next one starts, so after a crash the stub record
+// tells what is on disk.
+type StubState string
+
+const (
+	// StubVerified means the upload was checked; nothing on disk changed yet
+	StubVerified StubState = "verified"
+	// StubWritten means the stub is in place and the original still there
+	StubWritten StubState = "written"
+	// StubComplete means the original was removed
+	StubComplete StubState = "complete"
+)
 
-	// Skip if mode is none
+// ReplaceWithStub replaces an uploaded file with a stub pointing to its
+// upload. verify, if set, checks the upload first; nothing is touched if it
+// fails. The stub is written to a temporary name, synced and renamed into
+// place before the original is removed, so a crash leaves either the
+// original alone or both, never neither. Each step is recorded in the stubs
+// table.
+func (db *DB) ReplaceWithStub(originalPath, url string, mode StubMode, verify func() error) (*StubResult, error) {
+	result := &StubResult{OriginalPath: originalPath, URL: url, Mode: mode}
 	if mode == StubModeNone {
 		return result, nil
 	}
+	stubPath, err := stubPathFor(originalPath, mode)
+	if err != nil {
+		return nil, err
+	}
+	result.StubPath = stubPath
+	if err := db.verifyUpload(result, verify); err != nil {
+		return result, err
+	}
 
-	// Remove the original file
-	if err := os.Remove(originalPath); err != nil {
+	created, err := CreateStub(originalPath, url, mode)
+	if err != nil {
+		return created, err
+	}
+	result = created
+	if err := db.RecordStub(result, StubWritten); err != nil {
+		return result, err
+	}
+
+	if err := removeOriginal(result); err != nil {
+		return result, err
+	}
+	return result, db.RecordStub(result, StubComplete)
+}
+
+// verifyUpload runs verify and records the stub as verified
+func (db *DB) verifyUpload(result *StubResult, verify func() error) error {
+	if verify != nil {
+		if err := verify(); err != nil {
+			result.Error = fmt.Errorf("upload of %s not verified: %w", result.OriginalPath, err)
+			return result.Error
+		}
+	}
+	return db.RecordStub(result, StubVerified)
+}
+
+// removeOriginal removes the file a stub replaces and syncs its directory
+// so the removal survives a crash
+func removeOriginal(result *StubResult) error {
+	if err := os.Remove(result.OriginalPath); err != nil {
+		result.Error = fmt.Errorf("failed to remove original file: %w", err)
+		return result.Error
+	}
+	if err := syncDir(filepath.Dir(result.OriginalPath)); err != nil {
 		result.Error = fmt.Errorf("failed to remove original file: %w", err)
-		return result, result.Error
+		return result.Error
 	}
+	return nil
+}
+
+// PreviewPath returns where ReplaceWithPreview keeps the preview of a file,
+// IMG_0001.CR2.jpg for IMG_0001.CR2
+func PreviewPath(originalPath string) string {
+	return originalPath + ".jpg"
+}
 
+// ReplaceWithPreview replaces an uploaded file, such as a camera raw file,
+// with a JPEG preview of it and a stub pointing to the upload. The original
+// is removed even when mode is none, since the preview stands in for it;
+// verify, if set, checks the upload before anything is written.
+func (db *DB) ReplaceWithPreview(originalPath, url string, preview []byte, mode StubMode, verify func() error) (*StubResult, error) {
+	result := &StubResult{OriginalPath: originalPath, URL: url, Mode: mode}
+	if verify != nil {
+		if err := verify(); err != nil {
+			result.Error = fmt.Errorf("upload of %s not verified: %w", originalPath, err)
+			return result, result.Error
+		}
+	}
+
+	path := PreviewPath(originalPath)
+	if err := writeSynced(path, preview); err != nil {
+		return nil, fmt.Errorf("failed to write preview: %w", err)
+	}
+
+	if mode != StubModeNone {
+		// The upload was verified above
+		return db.ReplaceWithStub(originalPath, url, mode, nil)
+	}
+	if err := removeOriginal(result); err != nil {
+		return result, err
+	}
 	return result, nil
 }
 
-// CreateStubsForDirectory creates stubs for all files in a directory that have been uploaded
-func CreateStubsForDirectory(db *DB, directory string, mode StubMode) (int, error) {
+// CreateStubsForDirectory replaces all files in a directory that have been
+// uploaded with stubs, checking each upload with verify if it is set
+func CreateStubsForDirectory(db *DB, directory string, mode StubMode, verify func(*FileStatus) error) (int, error) {
 	if mode == StubModeNone {
 		return 0, nil
 	}
@@ -122,7 +225,11 @@ func CreateStubsForDirectory(db *DB, directory string, mode StubMode) (int, erro
 			continue
 		}
 
-		_, err := ReplaceWithStub(file.Path, file.UploadedURL, mode)
+		var check func() error
+		if verify != nil {
+			check = func() error { return verify(file) }
+		}
+		_, err := db.ReplaceWithStub(file.Path, file.UploadedURL, mode, check)
 		if err != nil && firstErr == nil {
 			firstErr = err
 		} else {
@@ -133,85 +240,241 @@ func CreateStubsForDirectory(db *DB, directory string, mode StubMode) (int, erro
 	return count, firstErr
 }
 
+// StubContent returns the content of a stub file of the given mode pointing
+// to url
+func StubContent(url string, mode StubMode) ([]byte, error) {
+	switch mode {
+	case StubModeWebloc:
+		// Create the XML structure for a .webloc file
+		webloc := WeblocFile{
+			Version: "1.0",
+		}
+		webloc.Dict.Key = "URL"
+		webloc.Dict.Value = url
+
+		var buf bytes.Buffer
+		buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+`)
+		encoder := xml.NewEncoder(&buf)
+		encoder.Indent("", "    ")
+		if err := encoder.Encode(webloc); err != nil {
+			return nil, fmt.Errorf("failed to encode XML: %w", err)
+		}
+		return buf.Bytes(), nil
+	case StubModeShortcut:
+		return []byte(fmt.Sprintf(`[InternetShortcut]
+URL=%s
+`, url)), nil
+	}
+	return nil, fmt.Errorf("unsupported stub mode: %s", mode)
+}
+
 // createWeblocFile creates a .webloc file (macOS)
 func createWeblocFile(path, url string) error {
+	return writeStubFile(path, url, StubModeWebloc)
+}
+
+// createShortcutFile creates a .url file (Windows)
+func createShortcutFile(path, url string) error {
+	return writeStubFile(path, url, StubModeShortcut)
+}
+
+// writeStubFile writes a stub file, creating its directory if needed
+func writeStubFile(path, url string, mode StubMode) error {
 	// Ensure the directory exists
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// Create the XML structure for a .webloc file
-	webloc := WeblocFile{
-		Version: "1.0",
+	content, err := StubContent(url, mode)
+	if err != nil {
+		return err
 	}
-	webloc.Dict.Key = "URL"
-	webloc.Dict.Value = url
+	if err := writeSynced(path, content); err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	return nil
+}
 
-	// Create the file
-	file, err := os.Create(path)
+// writeSynced writes a file through a temporary file that is synced and
+// renamed into place, then syncs the directory, so a crash never leaves a
+// half-written file behind and a completed write survives it
+func writeSynced(path string, content []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return err
+	}
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
 	}
-	defer file.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
 
-	// Write XML header
-	file.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
-<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
-`)
+// syncDir flushes a directory's entries to disk, making renames and
+// removals in it durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// markdownLink matches the target of a Markdown link, [name](url) or <url>
+var markdownLink = regexp.MustCompile(`\]\((https?://[^)\s]+)\)|<(https?://[^>\s]+)>`)
 
-	// Encode the structure
-	encoder := xml.NewEncoder(file)
-	encoder.Indent("", "    ")
-	if err := encoder.Encode(webloc); err != nil {
-		return fmt.Errorf("failed to encode XML: %w", err)
+// StubOriginal returns the path of the file a stub stands in for,
+// report.pdf for report.pdf.webloc, or "" if path is not a stub file name
+func StubOriginal(path string) string {
+	switch ext := filepath.Ext(path); ext {
+	case ".webloc", ".url", ".md":
+		return strings.TrimSuffix(path, ext)
 	}
+	return ""
+}
 
-	return nil
+// ReadStub returns the URL a stub file points to, or an error if the file
+// is not a complete stub. Besides the .webloc and .url stubs written here,
+// Markdown notes (.md) are read for their first link.
+func ReadStub(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var url string
+	switch filepath.Ext(path) {
+	case ".webloc":
+		var webloc WeblocFile
+		if err := xml.Unmarshal(data, &webloc); err == nil && webloc.Dict.Key == "URL" {
+			url = webloc.Dict.Value
+		}
+	case ".url":
+		for _, line := range strings.Split(string(data), "\n") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(line), "URL="); ok {
+				url = value
+			}
+		}
+	case ".md":
+		if match := markdownLink.FindStringSubmatch(string(data)); match != nil {
+			url = match[1] + match[2]
+		}
+	default:
+		return "", fmt.Errorf("%s is not a stub file", path)
+	}
+	if url == "" {
+		return "", fmt.Errorf("%s is not a complete stub", path)
+	}
+	return url, nil
 }
 
-// createShortcutFile creates a .url file (Windows)
-func createShortcutFile(path, url string) error {
-	// Ensure the directory exists
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+// RecordStub records a step of replacing a file with a stub, so it can be
+// undone with the original restored from its upload. A later stub of the
+// same file replaces the record.
+func (db *DB) RecordStub(result *StubResult, state StubState) error {
+	if result.Mode == StubModeNone {
+		return nil
 	}
+	_, err := db.conn.Exec(`
+	INSERT INTO stubs (original_path, stub_path, url, mode, created_at, state)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT (original_path) DO UPDATE
+	SET stub_path = excluded.stub_path, url = excluded.url, mode = excluded.mode,
+	    created_at = excluded.created_at, state = excluded.state
+	`, result.OriginalPath, result.StubPath, result.URL, string(result.Mode), time.Now(), string(state))
+	return err
+}
 
-	// Create the file
-	file, err := os.Create(path)
+// GetStubs retrieves the recorded stubs of the files at or below root, or
+// of all files when root is empty
+func (db *DB) GetStubs(root string) ([]*StubResult, error) {
+	root = strings.TrimSuffix(root, "/")
+	rows, err := db.conn.Query(`
+	SELECT original_path, stub_path, url, mode, created_at, state
+	FROM stubs
+	WHERE ? = '' OR original_path = ? OR original_path LIKE ? ESCAPE '\'
+	ORDER BY original_path
+	`, root, root, escapeLike(root)+"/%")
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
+	defer rows.Close()
 
-	// Write the contents
-	content := fmt.Sprintf(`[InternetShortcut]
-URL=%s
-`, url)
-	if _, err := file.WriteString(content); err != nil {
-		return fmt.Errorf("failed to write to file: %w", err)
+	var stubs []*StubResult
+	for rows.Next() {
+		stub := &StubResult{}
+		var mode, state string
+		if err := rows.Scan(&stub.OriginalPath, &stub.StubPath, &stub.URL, &mode, &stub.CreatedAt, &state); err != nil {
+			return nil, err
+		}
+		stub.Mode = StubMode(mode)
+		stub.State = StubState(state)
+		stubs = append(stubs, stub)
 	}
+	return stubs, rows.Err()
+}
 
-	return nil
+// RemoveStub forgets the stub of a file once the original is back
+func (db *DB) RemoveStub(originalPath string) error {
+	_, err := db.conn.Exec("DELETE FROM stubs WHERE original_path = ?", originalPath)
+	return err
+}
+
+// GetFilesByURL retrieves the files uploaded to url, those still in the
+// catalog first. Copies with the same content share an upload.
+func (db *DB) GetFilesByURL(url string) ([]*FileStatus, error) {
+	query := `
+	SELECT ` + fileColumns + `
+	FROM files
+	WHERE uploaded_url = ?
+	ORDER BY deleted_at IS NOT NULL, path
+	`
+
+	rows, err := db.conn.Query(query, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*FileStatus
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
 }
 
 // GetFilesInDirectory gets all files in a directory from the database
 func (db *DB) GetFilesInDirectory(directory string) ([]*FileStatus, error) {
 	query := `
-	SELECT id, path, relative_path, size, mod_time, is_dir, content_type, 
-	       sha256, processed, uploaded_url, upload_time, summary
+	SELECT ` + fileColumns + `
 	FROM files
-	WHERE path LIKE ?
+	WHERE path LIKE ? ESCAPE '\'
 	ORDER BY path
 	`
 
-	// Add wildcard to match all files in the directory
-	directoryPattern := directory
-	if !strings.HasSuffix(directoryPattern, "/") {
-		directoryPattern += "/"
-	}
-	directoryPattern += "%"
+	// Add wildcard to match all files in the directory, escaping those in
+	// its name
+	directoryPattern := escapeLike(strings.TrimSuffix(directory, "/")) + "/%"
 
 	rows, err := db.conn.Query(query, directoryPattern)
 	if err != nil {
@@ -221,25 +484,11 @@ func (db *DB) GetFilesInDirectory(directory string) ([]*FileStatus, error) {
 
 	var files []*FileStatus
 	for rows.Next() {
-		var file FileStatus
-		err := rows.Scan(
-			&file.ID,
-			&file.Path,
-			&file.RelativePath,
-			&file.Size,
-			&file.ModTime,
-			&file.IsDir,
-			&file.ContentType,
-			&file.SHA256,
-			&file.Processed,
-			&file.UploadedURL,
-			&file.UploadTime,
-			&file.Summary,
-		)
+		file, err := scanFile(rows)
 		if err != nil {
 			return nil, err
 		}
-		files = append(files, &file)
+		files = append(files, file)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadStub(t *testing.T) {
+	dir := t.TempDir()
+	url := "https://f000.backblazeb2.com/file/archive/Taxes/2019.pdf"
+
+	for _, mode := range []StubMode{StubModeWebloc, StubModeShortcut} {
+		result, err := CreateStub(filepath.Join(dir, "2019.pdf"), url, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ReadStub(result.StubPath); err != nil || got != url {
+			t.Errorf("%s stub: ReadStub = %q, %v", mode, got, err)
+		}
+		if got := StubOriginal(result.StubPath); got != filepath.Join(dir, "2019.pdf") {
+			t.Errorf("%s stub: StubOriginal = %q", mode, got)
+		}
+	}
+
+	note := filepath.Join(dir, "2019.pdf.md")
+	content := "# 2019.pdf\n\nArchived to [Backblaze](" + url + ") on 2024-03-01, see also [the index](https://example.com/index).\n"
+	if err := os.WriteFile(note, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadStub(note); err != nil || got != url {
+		t.Errorf("Markdown stub: ReadStub = %q, %v", got, err)
+	}
+
+	empty := filepath.Join(dir, "empty.md")
+	if err := os.WriteFile(empty, []byte("No links here\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadStub(empty); err == nil {
+		t.Error("Markdown note without a link read as a stub")
+	}
+	if got := StubOriginal(filepath.Join(dir, "2019.pdf")); got != "" {
+		t.Errorf("StubOriginal of a plain file = %q, want empty", got)
+	}
+}
+
+func TestRecordedStubs(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	for _, path := range []string{"/drive/Photos/a.cr2", "/drive/Photos/2019/b.cr2", "/drive/Photos2/c.cr2", "/drive/Taxes/d.pdf"} {
+		err := database.RecordStub(&StubResult{OriginalPath: path, StubPath: path + ".webloc", URL: "https://example.com/" + path, Mode: StubModeWebloc}, StubComplete)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.RecordStub(&StubResult{OriginalPath: "/drive/Photos/e.cr2", Mode: StubModeNone}, StubComplete); err != nil {
+		t.Fatal(err)
+	}
+
+	stubs, err := database.GetStubs("/drive/Photos/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stubs) != 2 || stubs[0].OriginalPath != "/drive/Photos/2019/b.cr2" || stubs[1].StubPath != "/drive/Photos/a.cr2.webloc" {
+		t.Errorf("GetStubs(/drive/Photos) = %+v", stubs)
+	}
+
+	if err := database.RemoveStub("/drive/Photos/a.cr2"); err != nil {
+		t.Fatal(err)
+	}
+	if stubs, err := database.GetStubs(""); err != nil || len(stubs) != 3 {
+		t.Errorf("GetStubs after RemoveStub = %d stubs, %v; want 3", len(stubs), err)
+	}
+}
+
+func TestGetFilesInDirectory(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	var files []*FileStatus
+	for _, path := range []string{"/drive/a_b/tax.pdf", "/drive/a_b/2019/deeds.pdf", "/drive/axb/photo.jpg", "/drive/a%b/notes.txt"} {
+		files = append(files, &FileStatus{Path: path, RelativePath: filepath.Base(path), ModTime: time.Now()})
+	}
+	if _, err := database.InsertFilesBatch(files); err != nil {
+		t.Fatal(err)
+	}
+
+	// The underscore and percent sign in the names match only themselves
+	for _, directory := range []string{"/drive/a_b", "/drive/a_b/"} {
+		found, err := database.GetFilesInDirectory(directory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 2 || found[0].Path != "/drive/a_b/2019/deeds.pdf" || found[1].Path != "/drive/a_b/tax.pdf" {
+			t.Errorf("GetFilesInDirectory(%s) = %d files, want the 2 below it", directory, len(found))
+		}
+	}
+	if found, err := database.GetFilesInDirectory("/drive/a%b"); err != nil || len(found) != 1 {
+		t.Errorf("GetFilesInDirectory(/drive/a%%b) = %d files, %v; want 1", len(found), err)
+	}
+}
+
+func TestReplaceWithStub(t *testing.T) {
+	dir := t.TempDir()
+	database, err := Open(filepath.Join(dir, "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	original := filepath.Join(dir, "2019.pdf")
+	if err := os.WriteFile(original, []byte("tax return"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	url := "https://f000.backblazeb2.com/file/archive/2019.pdf"
+
+	_, err = database.ReplaceWithStub(original, url, StubModeWebloc, func() error {
+		return errors.New("size mismatch")
+	})
+	if err == nil {
+		t.Fatal("ReplaceWithStub succeeded although the upload was not verified")
+	}
+	if _, err := os.Stat(original); err != nil {
+		t.Errorf("original touched after a failed verification: %v", err)
+	}
+	if _, err := os.Stat(original + ".webloc"); !os.IsNotExist(err) {
+		t.Errorf("stub written after a failed verification: %v", err)
+	}
+
+	result, err := database.ReplaceWithStub(original, url, StubModeWebloc, func() error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(original); !os.IsNotExist(err) {
+		t.Errorf("original still there: %v", err)
+	}
+	if got, err := ReadStub(result.StubPath); err != nil || got != url {
+		t.Errorf("ReadStub = %q, %v", got, err)
+	}
+	if _, err := os.Stat(result.StubPath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary stub left behind: %v", err)
+	}
+
+	stubs, err := database.GetStubs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stubs) != 1 || stubs[0].State != StubComplete || stubs[0].StubPath != result.StubPath {
+		t.Errorf("GetStubs = %+v, want one complete stub", stubs)
+	}
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// CachedSummary is a summary kept for reuse by files with the same content
+type CachedSummary struct {
+	SHA256        string
+	Level         string
+	ModelFamily   string
+	Summary       string
+	Model         string
+	Provider      string
+	PromptVersion string
+	Entities      string // JSON, empty if none were extracted
+	CreatedAt     time.Time
+}
+
+// GetCachedSummary returns the cached summary of content at a level by a
+// model family, or nil if there is none
+func (db *DB) GetCachedSummary(sha256, level, family string) (*CachedSummary, error) {
+	c := &CachedSummary{SHA256: sha256, Level: level, ModelFamily: family}
+	var provider, promptVersion, entities sql.NullString
+	err := db.conn.QueryRow(`
+	SELECT summary, model, provider, prompt_version, entities, created_at
+	FROM summary_cache
+	WHERE sha256 = ? AND level = ? AND model_family = ?
+	`, sha256, level, family).Scan(&c.Summary, &c.Model, &provider, &promptVersion, &entities, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Provider = provider.String
+	c.PromptVersion = promptVersion.String
+	c.Entities = entities.String
+	return c, nil
+}
+
+// CacheSummary stores a summary for reuse, replacing any cached for the same
+// content, level and model family. CreatedAt defaults to now.
+func (db *DB) CacheSummary(c *CachedSummary) error {
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now()
+	}
+	_, err := db.conn.Exec(`
+	INSERT INTO summary_cache (sha256, level, model_family, summary, model, provider, prompt_version, entities, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (sha256, level, model_family) DO UPDATE
+	SET summary = excluded.summary, model = excluded.model, provider = excluded.provider,
+		prompt_version = excluded.prompt_version, entities = excluded.entities, created_at = excluded.created_at
+	`, c.SHA256, c.Level, c.ModelFamily, c.Summary, c.Model, c.Provider, c.PromptVersion, c.Entities, c.CreatedAt)
+	return err
+}
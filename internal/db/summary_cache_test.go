@@ -0,0 +1,44 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSummaryCache(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	err = database.CacheSummary(&CachedSummary{SHA256: "abc", Level: "default", ModelFamily: "openai/gpt-4o",
+		Summary: "A lease", Model: "gpt-4o-2024-08-06", Provider: "openai"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hit, err := database.GetCachedSummary("abc", "default", "openai/gpt-4o")
+	if err != nil || hit == nil || hit.Summary != "A lease" || hit.Model != "gpt-4o-2024-08-06" {
+		t.Fatalf("GetCachedSummary = %+v, %v; want the lease summary", hit, err)
+	}
+
+	for _, key := range [][3]string{
+		{"def", "default", "openai/gpt-4o"},
+		{"abc", "full", "openai/gpt-4o"},
+		{"abc", "default", "anthropic/claude-3-haiku"},
+	} {
+		if miss, err := database.GetCachedSummary(key[0], key[1], key[2]); err != nil || miss != nil {
+			t.Errorf("GetCachedSummary%q = %+v, %v; want a miss", key, miss, err)
+		}
+	}
+
+	err = database.CacheSummary(&CachedSummary{SHA256: "abc", Level: "default", ModelFamily: "openai/gpt-4o",
+		Summary: "A lease of a flat", Model: "gpt-4o-2024-11-20", Provider: "openai"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hit, _ := database.GetCachedSummary("abc", "default", "openai/gpt-4o"); hit == nil || hit.Summary != "A lease of a flat" {
+		t.Errorf("after caching again, GetCachedSummary = %+v; want the summary replaced", hit)
+	}
+}
@@ -0,0 +1,355 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// TagChange is one tag added to or removed from a file by a bulk tag edit
+type TagChange struct {
+	FileID int64
+	Path   string
+	Tag    string
+	Added  bool
+}
+
+// TagEdit is a recorded bulk tag edit
+type TagEdit struct {
+	ID          int64
+	Description string
+	CreatedAt   time.Time
+	UndoneAt    sql.NullTime
+	Changes     int
+}
+
+// FileTag is a tag of a file and when it was added
+type FileTag struct {
+	Tag       string
+	CreatedAt time.Time
+}
+
+// AddTags tags a file. Tags the file already has are left unchanged.
+func (db *DB) AddTags(fileID int64, tags ...string) error {
+	now := time.Now()
+	for _, tag := range tags {
+		_, err := db.conn.Exec("INSERT OR IGNORE INTO file_tags (file_id, tag, created_at) VALUES (?, ?, ?)",
+			fileID, tag, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTags retrieves the tags of a file in alphabetical order
+func (db *DB) GetTags(fileID int64) ([]string, error) {
+	return queryTags(db.conn, fileID)
+}
+
+// GetFileTags retrieves the tags of a file with when each was added, oldest
+// first
+func (db *DB) GetFileTags(fileID int64) ([]FileTag, error) {
+	rows, err := db.conn.Query("SELECT tag, created_at FROM file_tags WHERE file_id = ? ORDER BY created_at, tag", fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []FileTag
+	for rows.Next() {
+		var tag FileTag
+		if err := rows.Scan(&tag.Tag, &tag.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// queryTags retrieves the tags of a file in alphabetical order
+func queryTags(q querier, fileID int64) ([]string, error) {
+	rows, err := q.Query("SELECT tag FROM file_tags WHERE file_id = ? ORDER BY tag", fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// FilesWithTag retrieves the IDs of the files that have a tag
+func (db *DB) FilesWithTag(tag string) ([]int64, error) {
+	rows, err := db.conn.Query("SELECT file_id FROM file_tags WHERE tag = ? ORDER BY file_id", tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// PlanTagEdit works out the changes that removing and then adding tags makes
+// to the given files. Only real changes are listed: tags a file already has
+// are not added again and tags it lacks are not removed.
+func (db *DB) PlanTagEdit(fileIDs []int64, add, remove []string) ([]TagChange, error) {
+	var changes []TagChange
+	for _, id := range fileIDs {
+		var path string
+		err := db.conn.QueryRow("SELECT path FROM files WHERE id = ?", id).Scan(&path)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		tags, err := db.GetTags(id)
+		if err != nil {
+			return nil, err
+		}
+		has := make(map[string]bool, len(tags))
+		for _, tag := range tags {
+			has[tag] = true
+		}
+
+		for _, tag := range remove {
+			if has[tag] {
+				changes = append(changes, TagChange{FileID: id, Path: path, Tag: tag, Added: false})
+				has[tag] = false
+			}
+		}
+		for _, tag := range add {
+			if !has[tag] {
+				changes = append(changes, TagChange{FileID: id, Path: path, Tag: tag, Added: true})
+				has[tag] = true
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// ListTagEdits retrieves the recorded bulk tag edits, most recent first
+func (db *DB) ListTagEdits() ([]*TagEdit, error) {
+	query := `
+	SELECT e.id, e.description, e.created_at, e.undone_at,
+	       (SELECT COUNT(*) FROM tag_edit_changes c WHERE c.edit_id = e.id)
+	FROM tag_edits e
+	ORDER BY e.id DESC
+	`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edits []*TagEdit
+	for rows.Next() {
+		var edit TagEdit
+		if err := rows.Scan(&edit.ID, &edit.Description, &edit.CreatedAt, &edit.UndoneAt, &edit.Changes); err != nil {
+			return nil, err
+		}
+		edits = append(edits, &edit)
+	}
+
+	return edits, rows.Err()
+}
+
+// ApplyTagEdit applies planned tag changes to the catalog and the index and
+// records them so the edit can be undone. The catalog changes are committed
+// only after the index has been updated, so a failure leaves both unchanged.
+func (idx *BleveIndexer) ApplyTagEdit(description string, changes []TagChange) (int64, error) {
+	tx, err := idx.db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec("INSERT INTO tag_edits (description, created_at) VALUES (?, ?)", description, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record tag edit: %w", err)
+	}
+	editID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, change := range changes {
+		if err := applyTagChange(tx, change, now); err != nil {
+			return 0, err
+		}
+		_, err := tx.Exec("INSERT INTO tag_edit_changes (edit_id, file_id, tag, added) VALUES (?, ?, ?, ?)",
+			editID, change.FileID, change.Tag, change.Added)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record tag edit: %w", err)
+		}
+	}
+
+	if err := idx.reindexTags(tx, changes); err != nil {
+		return 0, err
+	}
+
+	return editID, tx.Commit()
+}
+
+// UndoTagEdit reverts a bulk tag edit in the catalog and the index. An ID of
+// 0 reverts the most recent edit that hasn't been undone yet.
+func (idx *BleveIndexer) UndoTagEdit(id int64) (*TagEdit, error) {
+	var edit TagEdit
+	query := "SELECT id, description, created_at, undone_at FROM tag_edits WHERE id = ?"
+	args := []interface{}{id}
+	if id == 0 {
+		query = "SELECT id, description, created_at, undone_at FROM tag_edits WHERE undone_at IS NULL ORDER BY id DESC LIMIT 1"
+		args = nil
+	}
+	err := idx.db.conn.QueryRow(query, args...).Scan(&edit.ID, &edit.Description, &edit.CreatedAt, &edit.UndoneAt)
+	if err == sql.ErrNoRows {
+		if id == 0 {
+			return nil, fmt.Errorf("no tag edits to undo")
+		}
+		return nil, fmt.Errorf("no tag edit with id %d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if edit.UndoneAt.Valid {
+		return nil, fmt.Errorf("tag edit %d was already undone", edit.ID)
+	}
+
+	changes, err := idx.db.tagEditChanges(edit.ID)
+	if err != nil {
+		return nil, err
+	}
+	edit.Changes = len(changes)
+
+	tx, err := idx.db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, change := range changes {
+		change.Added = !change.Added
+		if err := applyTagChange(tx, change, now); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec("UPDATE tag_edits SET undone_at = ? WHERE id = ?", now, edit.ID); err != nil {
+		return nil, err
+	}
+
+	if err := idx.reindexTags(tx, changes); err != nil {
+		return nil, err
+	}
+
+	edit.UndoneAt = sql.NullTime{Time: now, Valid: true}
+	return &edit, tx.Commit()
+}
+
+// tagEditChanges retrieves the changes recorded for a tag edit
+func (db *DB) tagEditChanges(editID int64) ([]TagChange, error) {
+	query := `
+	SELECT c.file_id, COALESCE(f.path, ''), c.tag, c.added
+	FROM tag_edit_changes c
+	LEFT JOIN files f ON f.id = c.file_id
+	WHERE c.edit_id = ?
+	`
+
+	rows, err := db.conn.Query(query, editID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []TagChange
+	for rows.Next() {
+		var change TagChange
+		if err := rows.Scan(&change.FileID, &change.Path, &change.Tag, &change.Added); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// applyTagChange adds or removes one tag of a file
+func applyTagChange(q querier, change TagChange, now time.Time) error {
+	var err error
+	if change.Added {
+		_, err = q.Exec("INSERT OR IGNORE INTO file_tags (file_id, tag, created_at) VALUES (?, ?, ?)",
+			change.FileID, change.Tag, now)
+	} else {
+		_, err = q.Exec("DELETE FROM file_tags WHERE file_id = ? AND tag = ?", change.FileID, change.Tag)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update tags of %s: %w", change.Path, err)
+	}
+	return nil
+}
+
+// reindexTags updates the index documents of the changed files in one batch,
+// taking their tags from the uncommitted transaction
+func (idx *BleveIndexer) reindexTags(tx *sql.Tx, changes []TagChange) error {
+	batch := idx.index.NewBatch()
+	seen := make(map[int64]bool)
+	for _, change := range changes {
+		if seen[change.FileID] {
+			continue
+		}
+		seen[change.FileID] = true
+
+		file, err := scanFile(tx.QueryRow("SELECT "+fileColumns+" FROM files WHERE id = ?", change.FileID))
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		doc, err := idx.document(file)
+		if err != nil {
+			return err
+		}
+		if doc.Tags, err = queryTags(tx, file.ID); err != nil {
+			return err
+		}
+		if err := batch.Index(doc.ID, doc); err != nil {
+			return err
+		}
+	}
+
+	if err := idx.index.Batch(batch); err != nil {
+		return fmt.Errorf("failed to update index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTagEdits(t *testing.T) {
+	dir := t.TempDir()
+	database, err := Open(filepath.Join(dir, "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	indexer, err := NewIndexer(IndexConfig{IndexDir: filepath.Join(dir, "index")}, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexer.Close()
+
+	var files []*FileStatus
+	for _, name := range []string{"return.pdf", "receipt.jpg", "photo.jpg"} {
+		files = append(files, &FileStatus{Path: "/drive/" + name, RelativePath: name, ModTime: time.Now()})
+	}
+	if _, err := database.InsertFilesBatch(files); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, file := range files {
+		stored, err := database.GetFileByPath(file.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, stored.ID)
+	}
+	if err := database.AddTags(ids[0], "2019", "tax"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddTags(ids[1], "tax"); err != nil {
+		t.Fatal(err)
+	}
+
+	tagsOf := func() [][]string {
+		t.Helper()
+		var all [][]string
+		for _, id := range ids {
+			tags, err := database.GetTags(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, tags)
+		}
+		return all
+	}
+	equal := func(a, b [][]string) bool {
+		return slices.EqualFunc(a, b, func(x, y []string) bool { return slices.Equal(x, y) })
+	}
+	before := tagsOf()
+
+	// A preview writes nothing
+	changes, err := database.PlanTagEdit(ids, []string{"taxes"}, []string{"tax"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 5 {
+		t.Errorf("planned %d changes, want 2 removals and 3 additions: %+v", len(changes), changes)
+	}
+	if edits, err := database.ListTagEdits(); err != nil || len(edits) != 0 || !equal(tagsOf(), before) {
+		t.Fatalf("after planning: %d edits recorded, %v, tags %q; want nothing written", len(edits), err, tagsOf())
+	}
+
+	// Applying and undoing restores the tags exactly
+	editID, err := indexer.ApplyTagEdit("rename tax to taxes", changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"2019", "taxes"}, {"taxes"}, {"taxes"}}
+	if got := tagsOf(); !equal(got, want) {
+		t.Errorf("after applying, tags = %q, want %q", got, want)
+	}
+	undone, err := indexer.UndoTagEdit(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if undone.ID != editID || undone.Changes != 5 || !undone.UndoneAt.Valid {
+		t.Errorf("undid %+v, want edit %d with its 5 changes", undone, editID)
+	}
+	if got := tagsOf(); !equal(got, before) {
+		t.Errorf("after undoing, tags = %q, want %q", got, before)
+	}
+	if _, err := indexer.UndoTagEdit(editID); err == nil {
+		t.Error("undoing an edit twice succeeded")
+	}
+	if _, err := indexer.UndoTagEdit(0); err == nil {
+		t.Error("undoing with no edits left succeeded")
+	}
+
+	// Tags changed again since the edit are left as the undo finds them
+	changes, err = database.PlanTagEdit(ids[:2], []string{"reviewed"}, []string{"2019"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := indexer.ApplyTagEdit("mark reviewed", changes); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.conn.Exec("DELETE FROM file_tags WHERE file_id = ? AND tag = 'reviewed'", ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddTags(ids[0], "2019", "audit"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := indexer.UndoTagEdit(0); err != nil {
+		t.Fatal(err)
+	}
+	want = [][]string{{"2019", "audit", "tax"}, {"tax"}, nil}
+	if got := tagsOf(); !equal(got, want) {
+		t.Errorf("after undoing an edit changed since, tags = %q, want %q", got, want)
+	}
+}
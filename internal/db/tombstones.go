@@ -0,0 +1,123 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// MarkDeleted soft-deletes a file: the row stays in the catalog as a
+// tombstone with the reason and time, but the file is left out of
+// processing, exports and search until it is purged
+func (db *DB) MarkDeleted(id int64, reason string) error {
+	query := `
+	UPDATE files
+	SET deleted_at = ?, delete_reason = ?
+	WHERE id = ? AND deleted_at IS NULL
+	`
+
+	_, err := db.conn.Exec(query, time.Now(), reason, id)
+	return err
+}
+
+// Undelete restores a soft-deleted file to the catalog, which queues it for
+// indexing again. Files purged since can't be restored.
+func (db *DB) Undelete(id int64) error {
+	_, err := db.conn.Exec(`
+	UPDATE files
+	SET deleted_at = NULL, delete_reason = NULL
+	WHERE id = ? AND deleted_at IS NOT NULL
+	`, id)
+	return err
+}
+
+// GetDeletedFiles retrieves the soft-deleted files deleted before the given
+// time, oldest first. A zero time retrieves all of them.
+func (db *DB) GetDeletedFiles(before time.Time) ([]*FileStatus, error) {
+	query := `
+	SELECT ` + fileColumns + `
+	FROM files
+	WHERE deleted_at IS NOT NULL
+	`
+	var args []interface{}
+	if !before.IsZero() {
+		query += ` AND deleted_at < ?`
+		args = append(args, before)
+	}
+	query += `
+	ORDER BY deleted_at, path
+	`
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*FileStatus
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// PurgeFile permanently removes a file and everything recorded about it,
+// in one transaction
+func (db *DB) PurgeFile(id int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var path string
+	if err := tx.QueryRow("SELECT path FROM files WHERE id = ?", id).Scan(&path); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	// Quarantine and stubs are keyed by path
+	for _, stmt := range []string{
+		"DELETE FROM quarantine WHERE path = ?",
+		"DELETE FROM stubs WHERE original_path = ?",
+	} {
+		if _, err := tx.Exec(stmt, path); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range []string{
+		"DELETE FROM file_tags WHERE file_id = ?",
+		"DELETE FROM file_text WHERE file_id = ?",
+		"DELETE FROM provenance WHERE file_id = ?",
+		"DELETE FROM replicas WHERE file_id = ?",
+		"DELETE FROM file_entities WHERE file_id = ?",
+		"DELETE FROM file_metadata WHERE file_id = ?",
+		"DELETE FROM notes WHERE file_id = ?",
+		"DELETE FROM captions WHERE file_id = ?",
+		"DELETE FROM image_hashes WHERE file_id = ?",
+		"DELETE FROM photo_exif WHERE file_id = ?",
+		"DELETE FROM photo_bursts WHERE file_id = ?1 OR best_id = ?1",
+		"DELETE FROM file_versions WHERE file_id = ?",
+		"DELETE FROM salvaged WHERE file_id = ?",
+		"DELETE FROM name_mappings WHERE file_id = ?",
+		"DELETE FROM shares WHERE file_id = ?",
+		"DELETE FROM tag_edit_changes WHERE file_id = ?",
+		"DELETE FROM costs WHERE file_id = ?",
+		"DELETE FROM retention WHERE file_id = ?",
+		// Queues the file in index_queue, so that the next sync removes it
+		// from the index and then from the queue
+		"DELETE FROM files WHERE id = ?",
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUndelete(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	var files []*FileStatus
+	for _, name := range []string{"tax.pdf", "dump.sql", "notes.txt"} {
+		files = append(files, &FileStatus{Path: "/drive/" + name, RelativePath: name, ModTime: time.Now()})
+	}
+	if _, err := database.InsertFilesBatch(files); err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]int64)
+	for _, file := range files {
+		stored, err := database.GetFileByPath(file.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[file.RelativePath] = stored.ID
+	}
+
+	for _, name := range []string{"tax.pdf", "dump.sql"} {
+		if err := database.MarkDeleted(ids[name], "mistake"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted, err := database.GetDeletedFiles(time.Time{})
+	if err != nil || len(deleted) != 2 {
+		t.Fatalf("GetDeletedFiles = %d files, %v; want 2", len(deleted), err)
+	}
+	if deleted[0].DeleteReason != "mistake" || !deleted[0].DeletedAt.Valid {
+		t.Errorf("deleted file = reason %q, deleted at %v; want the reason and time recorded", deleted[0].DeleteReason, deleted[0].DeletedAt)
+	}
+	if older, err := database.GetDeletedFiles(time.Now().Add(-time.Hour)); err != nil || len(older) != 0 {
+		t.Errorf("files deleted over an hour ago = %d, %v; want none", len(older), err)
+	}
+
+	if err := database.Undelete(ids["tax.pdf"]); err != nil {
+		t.Fatal(err)
+	}
+	// Undeleting a file that isn't deleted changes nothing
+	if err := database.Undelete(ids["notes.txt"]); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err = database.GetDeletedFiles(time.Time{})
+	if err != nil || len(deleted) != 1 || deleted[0].Path != "/drive/dump.sql" {
+		t.Fatalf("after undelete, GetDeletedFiles = %v, %v; want only dump.sql", deleted, err)
+	}
+	restored, err := database.GetFileByPath("/drive/tax.pdf")
+	if err != nil || restored.DeletedAt.Valid || restored.DeleteReason != "" {
+		t.Errorf("restored file = %+v, %v; want its tombstone cleared", restored, err)
+	}
+}
+
+func TestPurgeFileLeavesNoOrphans(t *testing.T) {
+	database, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	files := []*FileStatus{
+		{Path: "/drive/tax.pdf", RelativePath: "tax.pdf", ModTime: time.Now()},
+		{Path: "/drive/notes.txt", RelativePath: "notes.txt", ModTime: time.Now()},
+	}
+	if _, err := database.InsertFilesBatch(files); err != nil {
+		t.Fatal(err)
+	}
+	tax, _ := database.GetFileByPath("/drive/tax.pdf")
+	notes, _ := database.GetFileByPath("/drive/notes.txt")
+
+	now := time.Now()
+	for _, file := range []*FileStatus{tax, notes} {
+		if err := database.AddTags(file.ID, "finance"); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.RecordCost(&Cost{FileID: file.ID, Kind: CostLLM, Amount: 0.01}); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.Quarantine(file.Path, "extraction", errors.New("read error")); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.RecordShare(&Share{FileID: file.ID, KeyID: "key", ExpiresAt: now.Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.RecordNameMapping(&NameMapping{FileID: file.ID, LayoutName: "a", RemoteName: "b", Collision: "case"}); err != nil {
+			t.Fatal(err)
+		}
+		for _, stmt := range []string{
+			"INSERT INTO stubs (original_path, stub_path, url, mode, created_at) VALUES (?2, ?2 || '.url', 'https://b2/x', 'link', ?3)",
+			"INSERT INTO salvaged (file_id, partial, recovered, bad_ranges, salvaged_at) VALUES (?1, TRUE, 10, '[]', ?3)",
+			"INSERT INTO tag_edit_changes (edit_id, file_id, tag, added) VALUES (1, ?1, 'finance', TRUE)",
+			"INSERT INTO retention (file_id, mode, retain_until, locked_at) VALUES (?1, 'governance', ?3, ?3)",
+		} {
+			if _, err := database.conn.Exec(stmt, file.ID, file.Path, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := database.PurgeFile(tax.ID); err != nil {
+		t.Fatal(err)
+	}
+	// Purging a file that is gone does nothing
+	if err := database.PurgeFile(tax.ID); err != nil {
+		t.Errorf("purging a purged file: %v", err)
+	}
+
+	// The purged file stays queued until the index drops it
+	indexer, err := NewIndexer(IndexConfig{IndexDir: filepath.Join(t.TempDir(), "index")}, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexer.Close()
+	if _, err := indexer.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := database.conn.Query(`
+	SELECT m.name FROM sqlite_master m, pragma_table_info(m.name) c
+	WHERE m.type = 'table' AND c.name = 'file_id'
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	keyed := map[string]string{"quarantine": "path", "stubs": "original_path"}
+	for _, table := range tables {
+		keyed[table] = "file_id"
+	}
+
+	for table, column := range keyed {
+		key := interface{}(tax.ID)
+		if column != "file_id" {
+			key = tax.Path
+		}
+		var orphans int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ?", table, column)
+		if err := database.conn.QueryRow(query, key).Scan(&orphans); err != nil {
+			t.Fatal(err)
+		}
+		if orphans != 0 {
+			t.Errorf("%s has %d row(s) of the purged file", table, orphans)
+		}
+	}
+	// The other file keeps its own
+	if shares, err := database.GetShares(notes.ID); err != nil || len(shares) != 1 {
+		t.Errorf("shares of the kept file = %d, %v; want 1", len(shares), err)
+	}
+	if quarantined, err := database.GetQuarantined(""); err != nil || len(quarantined) != 1 || quarantined[0].Path != notes.Path {
+		t.Errorf("quarantined = %+v, %v; want the kept file", quarantined, err)
+	}
+	if remaining, err := database.GetFileByID(tax.ID); err != nil || remaining != nil {
+		t.Errorf("purged file = %+v, %v", remaining, err)
+	}
+}
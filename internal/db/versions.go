@@ -0,0 +1,48 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// FileVersion is content a file had before a scan found it changed, with
+// the upload of that content if there was one
+type FileVersion struct {
+	ID          int64
+	FileID      int64
+	Number      int // 1 for the oldest version
+	SHA256      string
+	Size        int64
+	ModTime     sql.NullTime
+	Summary     string
+	UploadedURL string
+	RemoteName  string
+	UploadTime  sql.NullTime
+	ReplacedAt  time.Time // When a scan found newer content
+}
+
+// GetFileVersions returns the previous versions of a file, oldest first
+func (db *DB) GetFileVersions(fileID int64) ([]*FileVersion, error) {
+	rows, err := db.conn.Query(`
+	SELECT id, file_id, sha256, size, mod_time, COALESCE(summary, ''), COALESCE(uploaded_url, ''),
+	       COALESCE(remote_name, ''), upload_time, replaced_at
+	FROM file_versions
+	WHERE file_id = ?
+	ORDER BY id
+	`, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*FileVersion
+	for rows.Next() {
+		v := &FileVersion{Number: len(versions) + 1}
+		if err := rows.Scan(&v.ID, &v.FileID, &v.SHA256, &v.Size, &v.ModTime, &v.Summary, &v.UploadedURL,
+			&v.RemoteName, &v.UploadTime, &v.ReplacedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
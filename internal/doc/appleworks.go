@@ -0,0 +1,78 @@
+package doc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// appleWorksVersions names the versions of AppleWorks by the first byte of
+// their files; it was called ClarisWorks until version 5
+var appleWorksVersions = map[byte]string{
+	1: "ClarisWorks 1", 2: "ClarisWorks 2", 3: "ClarisWorks 3", 4: "ClarisWorks 4",
+	5: "AppleWorks 5", 6: "AppleWorks 6",
+}
+
+// minAppleWorksRun is the length of the shortest run of characters taken
+// to be text of an AppleWorks document
+const minAppleWorksRun = 8
+
+// extractAppleWorks recovers the text of an AppleWorks or ClarisWorks
+// document, whose format was never published, from the runs of Mac OS Roman
+// text in it, and records the version that saved it. Along with the words
+// of the document come some font and style names.
+func extractAppleWorks(path string) (string, map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read AppleWorks document: %w", err)
+	}
+	if len(data) < 8 || string(data[4:8]) != "BOBO" {
+		return "", nil, errors.New("not an AppleWorks or ClarisWorks document")
+	}
+	metadata := map[string]string{"format": "appleworks"}
+	if version, ok := appleWorksVersions[data[0]]; ok {
+		metadata["version"] = version
+	}
+
+	var text strings.Builder
+	start := -1
+	for i := 8; i <= len(data); i++ {
+		if i < len(data) && (data[i] >= 0x20 && data[i] != 0x7F || data[i] == '\r' || data[i] == '\t') {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= minAppleWorksRun {
+			run, _ := decode(charmap.Macintosh, data[start:i])
+			run = strings.TrimSpace(strings.ReplaceAll(run, "\r", "\n"))
+			if plausibleText(run) {
+				text.WriteString(run)
+				text.WriteString("\n\n")
+			}
+		}
+		start = -1
+	}
+	return text.String(), metadata, nil
+}
+
+// plausibleText reports whether a run of characters found in a binary file
+// reads as text: mostly letters, digits, spaces and common punctuation
+func plausibleText(run string) bool {
+	var total, readable, letters int
+	for _, r := range run {
+		total++
+		switch {
+		case unicode.IsLetter(r):
+			letters++
+			readable++
+		case unicode.IsDigit(r), unicode.IsSpace(r), strings.ContainsRune(".,;:!?'\"()-–—’“”", r):
+			readable++
+		}
+	}
+	return letters >= minAppleWorksRun/2 && readable*10 >= total*9
+}
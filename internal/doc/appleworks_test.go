@@ -0,0 +1,28 @@
+package doc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractAppleWorks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Letter.cwk")
+	data := []byte{6, 0x07, 0xE1, 0x00, 'B', 'O', 'B', 'O', 0x00, 0x01, 0x00}
+	data = append(data, "Dear Aunt May,\rThanks for the caf\x8e visit.\r"...)
+	data = append(data, 0x00, 0x00, 0x9A, 0xF3, 0x41, 0x12, 0x00)
+	data = append(data, "\xa5\xd7\xfb\xc4\xb9\xa3\xe1\xf0\xaa"...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ExtractText(context.Background(), path)
+	if err != nil || result.Error != nil {
+		t.Fatalf("ExtractText: %v, %v", err, result.Error)
+	}
+	want := "Dear Aunt May,\nThanks for the café visit.\n\n"
+	if result.Text != want || result.Metadata["version"] != "AppleWorks 6" {
+		t.Errorf("extracted %q, %v; want %q from AppleWorks 6", result.Text, result.Metadata, want)
+	}
+}
@@ -0,0 +1,140 @@
+package doc
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Characters that make up much of any text in a language, but are rare in
+// text decoded with the wrong charset
+const (
+	japaneseCommon = "のにはをたがでてとしれさいるなもかっこうますんだりあ"
+	koreanCommon   = "이다의는에하고을가한지사로기서자도들리어수대인를"
+	chineseCommon  = "的一是不了在人有我他这這个個们們中来來上大为為和国國地到以说說时時要就出会會可也你对對生能"
+)
+
+// minCommonShare is the share of the non-ASCII characters of a text that
+// must be common ones for a multibyte charset to be believed
+const minCommonShare = 0.1
+
+// multibyteCharsets are the East Asian charsets detected in text that is
+// neither UTF-8 nor declares its charset, most of which decode almost any
+// bytes without error, so the one whose text is most like the language it
+// encodes wins
+var multibyteCharsets = []struct {
+	name     string
+	encoding encoding.Encoding
+	common   string
+}{
+	{"shift_jis", japanese.ShiftJIS, japaneseCommon},
+	{"euc-jp", japanese.EUCJP, japaneseCommon},
+	{"euc-kr", korean.EUCKR, koreanCommon},
+	{"gbk", simplifiedchinese.GBK, chineseCommon},
+	{"big5", traditionalchinese.Big5, chineseCommon},
+}
+
+// decodeText converts text to UTF-8 and returns it with the name of the
+// encoding it was in. A byte order mark settles the encoding, then the
+// charset the file declares, if any and if the text decodes cleanly with
+// it, then UTF-8 if the text is valid UTF-8. Otherwise the text is tried
+// as Shift_JIS, EUC-JP, EUC-KR, GBK and Big5, and finally taken to be
+// Windows-1252, the superset of Latin-1 that old Windows and Mac files
+// were mostly written in.
+func decodeText(data []byte, declared string) (string, string) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), "utf-8"
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		text, _ := decode(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), data[2:])
+		return text, "utf-16le"
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		text, _ := decode(unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), data[2:])
+		return text, "utf-16be"
+	}
+
+	if declared != "" {
+		if enc, err := htmlindex.Get(declared); err == nil {
+			name, _ := htmlindex.Name(enc)
+			// A page saved in another charset often still claims the one
+			// it was served with, so the declaration must fit the bytes
+			if text, ok := decode(enc, data); ok && (name != "utf-8" || utf8.Valid(data)) {
+				return text, name
+			}
+		}
+	}
+	if utf8.Valid(data) {
+		return string(data), "utf-8"
+	}
+
+	best, bestName, bestShare := "", "", 0.0
+	for _, charset := range multibyteCharsets {
+		text, ok := decode(charset.encoding, data)
+		if !ok {
+			continue
+		}
+		if share := commonShare(text, charset.common); share > bestShare {
+			best, bestName, bestShare = text, charset.name, share
+		}
+	}
+	if bestShare >= minCommonShare {
+		return best, bestName
+	}
+
+	text, _ := decode(charmap.Windows1252, data)
+	return text, "windows-1252"
+}
+
+// decode converts data from enc to UTF-8, reporting whether every byte
+// was valid in enc
+func decode(enc encoding.Encoding, data []byte) (string, bool) {
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(decoded), false
+	}
+	return string(decoded), !bytes.ContainsRune(decoded, utf8.RuneError)
+}
+
+// commonShare returns the share of the non-ASCII characters of text that
+// are among common
+func commonShare(text, common string) float64 {
+	var total, found int
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			continue
+		}
+		total++
+		if strings.ContainsRune(common, r) {
+			found++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(found) / float64(total)
+}
+
+// charsetDeclaration matches the charset named by an HTML meta tag or an
+// XML declaration
+var charsetDeclaration = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?([\w.:-]+)|<\?xml[^>]+encoding\s*=\s*["']([\w.:-]+)`)
+
+// declaredCharset returns the charset an HTML or XML document declares in
+// its first kilobytes, or "" if it declares none
+func declaredCharset(data []byte) string {
+	head := data[:min(len(data), 4096)]
+	match := charsetDeclaration.FindSubmatch(head)
+	if match == nil {
+		return ""
+	}
+	return string(bytes.Join(match[1:], nil))
+}
@@ -0,0 +1,70 @@
+package doc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		text     string
+		encoding encoding.Encoding
+		want     string
+	}{
+		{"今日は晴れです。明日の天気は雨になるでしょう。", japanese.ShiftJIS, "shift_jis"},
+		{"今日は晴れです。明日の天気は雨になるでしょう。", japanese.EUCJP, "euc-jp"},
+		{"오늘은 날씨가 좋습니다. 내일은 비가 올 것입니다.", korean.EUCKR, "euc-kr"},
+		{"我们今天在公园里看到了很多人，他们都很高兴。", simplifiedchinese.GBK, "gbk"},
+		{"我們今天在公園裡看到了很多人，他們都很高興。", traditionalchinese.Big5, "big5"},
+	}
+	for _, test := range tests {
+		data, err := test.encoding.NewEncoder().Bytes([]byte(test.text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text, name := decodeText(data, ""); text != test.text || name != test.want {
+			t.Errorf("decoded %q as %s, want %q as %s", text, name, test.text, test.want)
+		}
+	}
+
+	// Latin-1 is read as Windows-1252, and a wrong declaration is ignored
+	if text, name := decodeText([]byte("R\xe9sum\xe9 \x93cr\xe8me br\xfbl\xe9e\x94"), "utf-8"); text != "Résumé “crème brûlée”" || name != "windows-1252" {
+		t.Errorf("decoded %q as %s, want Windows-1252", text, name)
+	}
+	if text, name := decodeText([]byte("\xff\xfeh\x00i\x00"), ""); text != "hi" || name != "utf-16le" {
+		t.Errorf("decoded %q as %s, want UTF-16LE", text, name)
+	}
+}
+
+func TestExtractEncodedFiles(t *testing.T) {
+	dir := t.TempDir()
+	page, _ := japanese.ShiftJIS.NewEncoder().Bytes([]byte(
+		`<html><head><meta charset="Shift_JIS"><title>日記</title></head><body>東京</body></html>`))
+	files := map[string][]byte{
+		"notes.txt":  []byte("Caf\xe9 cr\xe8me\n"),
+		"diary.html": page,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := ExtractText(context.Background(), filepath.Join(dir, "notes.txt"))
+	if err != nil || result.Text != "Café crème\n" || result.Metadata["encoding"] != "windows-1252" {
+		t.Errorf("text file = %q, %v, %v", result.Text, result.Metadata, err)
+	}
+	result, err = ExtractText(context.Background(), filepath.Join(dir, "diary.html"))
+	if err != nil || result.Metadata["encoding"] != "shift_jis" || !strings.Contains(result.Text, "東京") {
+		t.Errorf("HTML file = %q, %v, %v", result.Text, result.Metadata, err)
+	}
+}
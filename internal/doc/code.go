@@ -0,0 +1,155 @@
+package doc
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// codeLanguages maps the extensions of source files to their language
+var codeLanguages = map[string]string{
+	".go": "go", ".py": "python", ".rb": "ruby", ".php": "php", ".pl": "perl",
+	".lua": "lua", ".r": "r", ".js": "javascript", ".mjs": "javascript",
+	".jsx": "javascript", ".ts": "typescript", ".tsx": "typescript",
+	".java": "java", ".kt": "kotlin", ".scala": "scala", ".groovy": "groovy",
+	".clj": "clojure", ".c": "c", ".h": "c", ".cpp": "c++", ".cc": "c++",
+	".cxx": "c++", ".hpp": "c++", ".cs": "c#", ".vb": "visual basic",
+	".bas": "basic", ".swift": "swift", ".rs": "rust", ".dart": "dart",
+	".hs": "haskell", ".ml": "ocaml", ".erl": "erlang", ".ex": "elixir",
+	".exs": "elixir", ".el": "emacs lisp", ".lisp": "lisp", ".scm": "scheme",
+	".pas": "pascal", ".f90": "fortran", ".f": "fortran", ".asm": "assembly",
+	".sh": "shell", ".bash": "shell", ".zsh": "shell", ".ps1": "powershell",
+	".bat": "batch", ".sql": "sql",
+}
+
+// CodeFormats returns the extensions of the source files whose text is
+// extracted
+func CodeFormats() []string {
+	return slices.Sorted(maps.Keys(codeLanguages))
+}
+
+// extractCode reads a source file as it is, in whatever encoding it was
+// saved with, recording its language
+func extractCode(path string) (string, map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read source file: %w", err)
+	}
+	text, encoding := decodeText(data, "")
+	return text, map[string]string{
+		"language": codeLanguages[strings.ToLower(filepath.Ext(path))],
+		"encoding": encoding,
+		"lines":    strconv.Itoa(strings.Count(text, "\n")),
+	}, nil
+}
+
+// notebook is a Jupyter notebook: its cells, or in the nbformat 3
+// notebooks of IPython those of its worksheets
+type notebook struct {
+	Cells      []notebookCell `json:"cells"`
+	Worksheets []struct {
+		Cells []notebookCell `json:"cells"`
+	} `json:"worksheets"`
+	Metadata struct {
+		Kernelspec struct {
+			DisplayName string `json:"display_name"`
+			Language    string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+		Title string `json:"title"`
+	} `json:"metadata"`
+}
+
+// notebookCell is a cell of a notebook, whose source is a string or a list
+// of lines, and is called input in the code cells of nbformat 3
+type notebookCell struct {
+	Type     string          `json:"cell_type"`
+	Source   json.RawMessage `json:"source"`
+	Input    json.RawMessage `json:"input"`
+	Language string          `json:"language"`
+}
+
+// text returns the source of the cell
+func (c notebookCell) text() string {
+	source := c.Source
+	if source == nil {
+		source = c.Input
+	}
+	var lines []string
+	if err := json.Unmarshal(source, &lines); err == nil {
+		return strings.Join(lines, "")
+	}
+	var text string
+	json.Unmarshal(source, &text)
+	return text
+}
+
+// extractNotebook extracts the Markdown cells of a Jupyter notebook, with
+// their syntax stripped, and its code cells, leaving out their outputs
+func extractNotebook(path string) (string, map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read notebook: %w", err)
+	}
+	var nb notebook
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return "", nil, fmt.Errorf("invalid notebook: %w", err)
+	}
+	cells := nb.Cells
+	for _, worksheet := range nb.Worksheets {
+		cells = append(cells, worksheet.Cells...)
+	}
+
+	metadata := map[string]string{"cells": strconv.Itoa(len(cells))}
+	language := nb.Metadata.LanguageInfo.Name
+	if language == "" {
+		language = nb.Metadata.Kernelspec.Language
+	}
+	var text strings.Builder
+	title := nb.Metadata.Title
+	for _, cell := range cells {
+		source := strings.TrimSpace(cell.text())
+		if source == "" {
+			continue
+		}
+		switch cell.Type {
+		case "markdown":
+			stripped, heading := stripMarkdown(source)
+			if title == "" {
+				title = heading
+			}
+			source = strings.TrimSpace(stripped)
+		case "code":
+			if language == "" {
+				language = cell.Language
+			}
+		case "heading":
+			// nbformat 3 kept headings in cells of their own
+			if title == "" {
+				title = source
+			}
+		default:
+			continue
+		}
+		text.WriteString(source)
+		text.WriteString("\n\n")
+	}
+
+	if language != "" {
+		metadata["language"] = strings.ToLower(language)
+	}
+	if kernel := nb.Metadata.Kernelspec.DisplayName; kernel != "" {
+		metadata["kernel"] = kernel
+	}
+	if title != "" {
+		metadata["title"] = title
+	}
+	return strings.TrimSuffix(text.String(), "\n"), metadata, nil
+}
@@ -0,0 +1,59 @@
+package doc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExtractCode(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.go": "package main\n\n// Prints the \xe9t\xe9 report\nfunc main() {}\n",
+		"analysis.ipynb": `{
+ "cells": [
+  {"cell_type": "markdown", "metadata": {}, "source": ["# Rainfall *by* month\n", "\n", "Data from the [station](http://example.com)."]},
+  {"cell_type": "code", "metadata": {}, "outputs": [{"output_type": "stream", "text": ["noise"]}], "source": "import pandas as pd\nrain = pd.read_csv('rain.csv')"},
+  {"cell_type": "raw", "metadata": {}, "source": "skipped"}
+ ],
+ "metadata": {"kernelspec": {"display_name": "Python 3", "language": "python", "name": "python3"},
+              "language_info": {"name": "python"}},
+ "nbformat": 4, "nbformat_minor": 5
+}`,
+		"old.ipynb": `{"metadata": {"name": ""}, "nbformat": 3, "worksheets": [{"cells": [
+  {"cell_type": "heading", "level": 1, "source": ["Fitting"]},
+  {"cell_type": "code", "language": "python", "input": ["x = 1"], "outputs": []}
+]}]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !IsSupported("README.md") || !IsSupported("lib.rs") || !slices.Contains(SupportedFormats(), ".ipynb") {
+		t.Error("Markdown, source files and notebooks are not supported")
+	}
+
+	result, err := ExtractText(context.Background(), filepath.Join(dir, "main.go"))
+	if err != nil || result.Text != "package main\n\n// Prints the été report\nfunc main() {}\n" ||
+		result.Metadata["language"] != "go" || result.Metadata["lines"] != "4" {
+		t.Errorf("source file = %q, %v, %v", result.Text, result.Metadata, err)
+	}
+
+	result, err = ExtractText(context.Background(), filepath.Join(dir, "analysis.ipynb"))
+	want := "Rainfall by month\n\nData from the station.\n\nimport pandas as pd\nrain = pd.read_csv('rain.csv')\n"
+	if err != nil || result.Text != want {
+		t.Errorf("notebook = %q, %v; want %q", result.Text, err, want)
+	}
+	if result.Title != "Rainfall by month" || result.Metadata["language"] != "python" ||
+		result.Metadata["kernel"] != "Python 3" || result.Metadata["cells"] != "3" {
+		t.Errorf("title %q, metadata %v", result.Title, result.Metadata)
+	}
+
+	result, err = ExtractText(context.Background(), filepath.Join(dir, "old.ipynb"))
+	if err != nil || result.Text != "Fitting\n\nx = 1\n" || result.Title != "Fitting" || result.Metadata["language"] != "python" {
+		t.Errorf("nbformat 3 notebook = %q, title %q, %v, %v", result.Text, result.Title, result.Metadata, err)
+	}
+}
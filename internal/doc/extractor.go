@@ -5,27 +5,35 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"unicode"
+
+	"github.com/jth/archiver/internal/tools"
 )
 
 // ExtractResult contains the result of a document extraction
 type ExtractResult struct {
-	Path     string
-	Text     string
-	Title    string
-	Metadata map[string]string
-	Error    error
+	Path      string
+	Text      string
+	Title     string
+	Metadata  map[string]string
+	Extractor string  // Tool that produced the text, or "fallback" for a raw read
+	Quality   float64 // Share of readable characters in Text, from 0 to 1
+	Error     error
 }
 
-// SupportedFormats returns a list of supported document formats
+// SupportedFormats returns a list of supported document formats, source
+// files included
 func SupportedFormats() []string {
-	return []string{
+	return append([]string{
 		".pdf", ".docx", ".doc", ".rtf", ".odt",
 		".pptx", ".ppt", ".xlsx", ".xls", ".csv",
 		".epub", ".html", ".htm", ".xml", ".txt",
-	}
+		".md", ".markdown", ".ipynb",
+		".pages", ".numbers", ".key", ".cwk",
+	}, CodeFormats()...)
 }
 
 // IsSupported checks if a file format is supported for text extraction
@@ -55,33 +63,51 @@ func ExtractText(ctx context.Context, filePath string) (*ExtractResult, error) {
 
 	var text string
 	var metadata map[string]string
+	var extractor string
 	var title string
 	var err error
 
 	switch {
 	case ext == ".pdf":
-		text, metadata, err = extractPDF(ctx, filePath)
+		text, metadata, extractor, err = extractPDF(ctx, filePath)
 	case ext == ".docx" || ext == ".doc" || ext == ".odt" || ext == ".rtf":
-		text, metadata, err = extractOfficeDocument(ctx, filePath)
+		text, metadata, extractor, err = extractOfficeDocument(ctx, filePath)
 	case ext == ".xlsx" || ext == ".xls" || ext == ".csv":
-		text, metadata, err = extractSpreadsheet(ctx, filePath)
+		text, metadata, extractor, err = extractSpreadsheet(ctx, filePath)
 	case ext == ".pptx" || ext == ".ppt":
-		text, metadata, err = extractPresentation(ctx, filePath)
+		text, metadata, extractor, err = extractPresentation(ctx, filePath)
 	case ext == ".epub":
-		text, metadata, err = extractEPUB(ctx, filePath)
+		text, metadata, extractor, err = extractEPUB(ctx, filePath)
 	case ext == ".html" || ext == ".htm" || ext == ".xml":
-		text, metadata, err = extractHTML(ctx, filePath)
+		text, metadata, err = extractHTML(filePath)
+		extractor = "native"
 	case ext == ".txt":
-		text, err = extractTextFile(filePath)
-		metadata = make(map[string]string)
+		text, metadata, err = extractTextFile(filePath)
+		extractor = "native"
+	case ext == ".md" || ext == ".markdown":
+		text, metadata, err = extractMarkdown(filePath)
+		extractor = "native"
+	case ext == ".pages" || ext == ".numbers" || ext == ".key":
+		text, metadata, err = extractIWork(filePath)
+		extractor = "native"
+	case ext == ".cwk":
+		text, metadata, err = extractAppleWorks(filePath)
+		extractor = "native"
+	case ext == ".ipynb":
+		text, metadata, err = extractNotebook(filePath)
+		extractor = "native"
+	case codeLanguages[ext] != "":
+		text, metadata, err = extractCode(filePath)
+		extractor = "native"
 	default:
 		return nil, fmt.Errorf("no extraction method for format: %s", ext)
 	}
 
 	if err != nil {
 		return &ExtractResult{
-			Path:  filePath,
-			Error: err,
+			Path:      filePath,
+			Extractor: extractor,
+			Error:     err,
 		}, nil
 	}
 
@@ -94,52 +120,79 @@ func ExtractText(ctx context.Context, filePath string) (*ExtractResult, error) {
 	}
 
 	return &ExtractResult{
-		Path:     filePath,
-		Text:     text,
-		Title:    title,
-		Metadata: metadata,
+		Path:      filePath,
+		Text:      text,
+		Title:     title,
+		Metadata:  metadata,
+		Extractor: extractor,
+		Quality:   TextQuality(text),
 	}, nil
 }
 
+// TextQuality estimates how clean extracted text is, as the share of letters,
+// digits, punctuation and whitespace among all characters. Garbled text layers
+// and binary junk score low; an empty text scores 0.
+func TextQuality(text string) float64 {
+	total, readable := 0, 0
+	for _, r := range text {
+		total++
+		if r == unicode.ReplacementChar {
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || unicode.IsPunct(r) {
+			readable++
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return float64(readable) / float64(total)
+}
+
 // extractPDF extracts text and metadata from a PDF file
-func extractPDF(ctx context.Context, path string) (string, map[string]string, error) {
+func extractPDF(ctx context.Context, path string) (string, map[string]string, string, error) {
 	// Try pdftotext first (from poppler-utils)
-	if _, err := exec.LookPath("pdftotext"); err == nil {
-		cmd := exec.CommandContext(ctx, "pdftotext", "-enc", "UTF-8", path, "-")
+	if _, err := tools.LookPath("pdftotext"); err == nil {
+		cmd := tools.Command(ctx, "pdftotext", "-enc", "UTF-8", path, "-")
 		var out bytes.Buffer
 		cmd.Stdout = &out
 		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("pdftotext failed: %w", err)
+			return "", nil, "", fmt.Errorf("pdftotext failed: %w", err)
 		}
 
-		// Extract metadata with pdfinfo
+		// Extract metadata with pdfinfo, or at least count the pages, each
+		// of which pdftotext ends with a form feed
 		metadata, _ := extractPDFMetadata(ctx, path)
-		return out.String(), metadata, nil
+		if metadata["pages"] == "" {
+			metadata["pages"] = strconv.Itoa(strings.Count(out.String(), "\f"))
+		}
+		return out.String(), metadata, "pdftotext", nil
 	}
 
 	// Fallback to pdf2text if available
-	if _, err := exec.LookPath("pdf2text"); err == nil {
-		cmd := exec.CommandContext(ctx, "pdf2text", path)
+	if _, err := tools.LookPath("pdf2text"); err == nil {
+		cmd := tools.Command(ctx, "pdf2text", path)
 		var out bytes.Buffer
 		cmd.Stdout = &out
 		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("pdf2text failed: %w", err)
+			return "", nil, "", fmt.Errorf("pdf2text failed: %w", err)
 		}
-		return out.String(), make(map[string]string), nil
+		return out.String(), make(map[string]string), "pdf2text", nil
 	}
 
-	return "", nil, fmt.Errorf("no PDF extraction tools available")
+	return "", nil, "", fmt.Errorf("no PDF extraction tools available: %w", tools.ErrNotInstalled)
 }
 
 // extractPDFMetadata extracts metadata from a PDF using pdfinfo
 func extractPDFMetadata(ctx context.Context, path string) (map[string]string, error) {
 	metadata := make(map[string]string)
 
-	if _, err := exec.LookPath("pdfinfo"); err != nil {
+	if _, err := tools.LookPath("pdfinfo"); err != nil {
 		return metadata, nil // Not an error, just return empty metadata
 	}
 
-	cmd := exec.CommandContext(ctx, "pdfinfo", path)
+	cmd := tools.Command(ctx, "pdfinfo", path)
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	if err := cmd.Run(); err != nil {
@@ -161,210 +214,100 @@ func extractPDFMetadata(ctx context.Context, path string) (map[string]string, er
 }
 
 // extractOfficeDocument extracts text from Microsoft Office/LibreOffice documents
-func extractOfficeDocument(ctx context.Context, path string) (string, map[string]string, error) {
+func extractOfficeDocument(ctx context.Context, path string) (string, map[string]string, string, error) {
 	// Try Apache Tika if available
-	if _, err := exec.LookPath("tika"); err == nil {
-		// Use Tika for both text and metadata
-		cmd := exec.CommandContext(ctx, "tika", "--text", "--encoding=UTF-8", path)
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("tika failed: %w", err)
-		}
-
-		// Get metadata with tika
-		metadata, _ := extractTikaMetadata(ctx, path)
-		return out.String(), metadata, nil
+	if tikaAvailable(ctx) {
+		return extractWithTika(ctx, path)
 	}
 
 	// Try pandoc as fallback
-	if _, err := exec.LookPath("pandoc"); err == nil {
-		cmd := exec.CommandContext(ctx, "pandoc", "-t", "plain", path)
+	if _, err := tools.LookPath("pandoc"); err == nil {
+		cmd := tools.Command(ctx, "pandoc", "-t", "plain", path)
 		var out bytes.Buffer
 		cmd.Stdout = &out
 		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("pandoc failed: %w", err)
+			return "", nil, "", fmt.Errorf("pandoc failed: %w", err)
 		}
-		return out.String(), make(map[string]string), nil
+		return out.String(), make(map[string]string), "pandoc", nil
 	}
 
 	// Try textutil on macOS
-	if _, err := exec.LookPath("textutil"); err == nil {
-		cmd := exec.CommandContext(ctx, "textutil", "-convert", "txt", "-stdout", path)
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("textutil failed: %w", err)
-		}
-		return out.String(), make(map[string]string), nil
-	}
-
-	return "", nil, fmt.Errorf("no Office document extraction tools available")
-}
-
-// extractSpreadsheet extracts text from spreadsheet files
-func extractSpreadsheet(ctx context.Context, path string) (string, map[string]string, error) {
-	// Try Apache Tika for best results
-	if _, err := exec.LookPath("tika"); err == nil {
-		cmd := exec.CommandContext(ctx, "tika", "--text", "--encoding=UTF-8", path)
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("tika failed: %w", err)
-		}
-
-		// Get metadata with tika
-		metadata, _ := extractTikaMetadata(ctx, path)
-		return out.String(), metadata, nil
-	}
-
-	// Try pandas in Python for CSV/Excel files
-	if _, err := exec.LookPath("python3"); err == nil {
-		// Create a temporary Python script
-		tempScript := filepath.Join(os.TempDir(), "extract_excel.py")
-		script := `
-import sys
-import pandas as pd
-
-try:
-    df = pd.read_excel(sys.argv[1]) if not sys.argv[1].endswith('.csv') else pd.read_csv(sys.argv[1])
-    print(df.to_string())
-except Exception as e:
-    print(f"Error: {e}", file=sys.stderr)
-    sys.exit(1)
-`
-		if err := os.WriteFile(tempScript, []byte(script), 0644); err != nil {
-			return "", nil, fmt.Errorf("failed to create Python script: %w", err)
-		}
-		defer os.Remove(tempScript)
-
-		cmd := exec.CommandContext(ctx, "python3", tempScript, path)
+	if _, err := tools.LookPath("textutil"); err == nil {
+		cmd := tools.Command(ctx, "textutil", "-convert", "txt", "-stdout", path)
 		var out bytes.Buffer
 		cmd.Stdout = &out
 		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("pandas extraction failed: %w", err)
+			return "", nil, "", fmt.Errorf("textutil failed: %w", err)
 		}
-		return out.String(), make(map[string]string), nil
+		return out.String(), make(map[string]string), "textutil", nil
 	}
 
-	return "", nil, fmt.Errorf("no spreadsheet extraction tools available")
+	return "", nil, "", fmt.Errorf("no Office document extraction tools available: %w", tools.ErrNotInstalled)
 }
 
 // extractPresentation extracts text from presentation files
-func extractPresentation(ctx context.Context, path string) (string, map[string]string, error) {
+func extractPresentation(ctx context.Context, path string) (string, map[string]string, string, error) {
 	// Try Apache Tika
-	if _, err := exec.LookPath("tika"); err == nil {
-		cmd := exec.CommandContext(ctx, "tika", "--text", "--encoding=UTF-8", path)
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("tika failed: %w", err)
-		}
-
-		// Get metadata with tika
-		metadata, _ := extractTikaMetadata(ctx, path)
-		return out.String(), metadata, nil
+	if tikaAvailable(ctx) {
+		return extractWithTika(ctx, path)
 	}
 
 	// Try pandoc as fallback
-	if _, err := exec.LookPath("pandoc"); err == nil {
-		cmd := exec.CommandContext(ctx, "pandoc", "-t", "plain", path)
+	if _, err := tools.LookPath("pandoc"); err == nil {
+		cmd := tools.Command(ctx, "pandoc", "-t", "plain", path)
 		var out bytes.Buffer
 		cmd.Stdout = &out
 		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("pandoc failed: %w", err)
+			return "", nil, "", fmt.Errorf("pandoc failed: %w", err)
 		}
-		return out.String(), make(map[string]string), nil
+		return out.String(), make(map[string]string), "pandoc", nil
 	}
 
-	return "", nil, fmt.Errorf("no presentation extraction tools available")
+	return "", nil, "", fmt.Errorf("no presentation extraction tools available: %w", tools.ErrNotInstalled)
 }
 
 // extractEPUB extracts text from EPUB files
-func extractEPUB(ctx context.Context, path string) (string, map[string]string, error) {
+func extractEPUB(ctx context.Context, path string) (string, map[string]string, string, error) {
 	// Try pandoc
-	if _, err := exec.LookPath("pandoc"); err == nil {
-		cmd := exec.CommandContext(ctx, "pandoc", "-t", "plain", path)
+	if _, err := tools.LookPath("pandoc"); err == nil {
+		cmd := tools.Command(ctx, "pandoc", "-t", "plain", path)
 		var out bytes.Buffer
 		cmd.Stdout = &out
 		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("pandoc failed: %w", err)
+			return "", nil, "", fmt.Errorf("pandoc failed: %w", err)
 		}
-		return out.String(), make(map[string]string), nil
+		return out.String(), make(map[string]string), "pandoc", nil
 	}
 
 	// Try Apache Tika
-	if _, err := exec.LookPath("tika"); err == nil {
-		cmd := exec.CommandContext(ctx, "tika", "--text", "--encoding=UTF-8", path)
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("tika failed: %w", err)
-		}
-
-		// Get metadata with tika
-		metadata, _ := extractTikaMetadata(ctx, path)
-		return out.String(), metadata, nil
-	}
-
-	return "", nil, fmt.Errorf("no EPUB extraction tools available")
-}
-
-// extractHTML extracts text from HTML/XML files
-func extractHTML(ctx context.Context, path string) (string, map[string]string, error) {
-	// Try html2text
-	if _, err := exec.LookPath("html2text"); err == nil {
-		cmd := exec.CommandContext(ctx, "html2text", path)
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("html2text failed: %w", err)
-		}
-		return out.String(), make(map[string]string), nil
-	}
-
-	// Try Apache Tika
-	if _, err := exec.LookPath("tika"); err == nil {
-		cmd := exec.CommandContext(ctx, "tika", "--text", "--encoding=UTF-8", path)
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		if err := cmd.Run(); err != nil {
-			return "", nil, fmt.Errorf("tika failed: %w", err)
-		}
-
-		// Get metadata with tika
-		metadata, _ := extractTikaMetadata(ctx, path)
-		return out.String(), metadata, nil
-	}
-
-	// Read the file directly as fallback
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to read HTML file: %w", err)
+	if tikaAvailable(ctx) {
+		return extractWithTika(ctx, path)
 	}
 
-	return string(content), make(map[string]string), nil
+	return "", nil, "", fmt.Errorf("no EPUB extraction tools available: %w", tools.ErrNotInstalled)
 }
 
-// extractTextFile extracts text from plain text files
-func extractTextFile(path string) (string, error) {
-	content, err := os.ReadFile(path)
+// extractTextFile extracts text from plain text files in whatever
+// encoding they were saved with
+func extractTextFile(path string) (string, map[string]string, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to read text file: %w", err)
+		return "", nil, fmt.Errorf("failed to read text file: %w", err)
 	}
 
-	return string(content), nil
+	text, encoding := decodeText(data, "")
+	return text, map[string]string{"encoding": encoding}, nil
 }
 
 // extractTikaMetadata extracts metadata using Apache Tika
 func extractTikaMetadata(ctx context.Context, path string) (map[string]string, error) {
 	metadata := make(map[string]string)
 
-	if _, err := exec.LookPath("tika"); err != nil {
+	if _, err := tools.LookPath("tika"); err != nil {
 		return metadata, nil // Not an error, just return empty metadata
 	}
 
-	cmd := exec.CommandContext(ctx, "tika", "--metadata", "--json", path)
+	cmd := tools.Command(ctx, "tika", "--metadata", "--json", path)
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	if err := cmd.Run(); err != nil {
@@ -0,0 +1,417 @@
+package doc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// keepBoilerplate disables the removal of navigation, sidebars, footers
+// and the like from HTML pages
+var keepBoilerplate atomic.Bool
+
+// SetStripBoilerplate sets whether the text of an HTML page is limited to
+// its content, leaving out navigation, sidebars, footers, cookie banners
+// and other boilerplate; it is by default
+func SetStripBoilerplate(strip bool) {
+	keepBoilerplate.Store(!strip)
+}
+
+// extractHTML extracts the text and metadata of HTML and XML files,
+// converted to UTF-8 from the charset they declare or are detected to be in
+func extractHTML(path string) (string, map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read HTML file: %w", err)
+	}
+	content, encoding := decodeText(data, declaredCharset(data))
+	root, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	metadata := htmlMetadata(root)
+	metadata["encoding"] = encoding
+	// XML has no page layout to tell content from boilerplate by
+	strip := !keepBoilerplate.Load() && strings.ToLower(filepath.Ext(path)) != ".xml"
+	return htmlText(root, strip), metadata, nil
+}
+
+// htmlMetaKeys maps the meta tags of a page that are kept to the metadata
+// keys they are stored under; the first tag for a key wins
+var htmlMetaKeys = map[string]string{
+	"description":            "description",
+	"og:description":         "description",
+	"keywords":               "keywords",
+	"author":                 "author",
+	"og:title":               "title",
+	"og:site_name":           "site",
+	"article:published_time": "published",
+	"generator":              "generator",
+}
+
+// htmlMetadata returns the title, language and meta tags of a page
+func htmlMetadata(root *html.Node) map[string]string {
+	metadata := make(map[string]string)
+	var title string
+	for n := range root.Descendants() {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		switch n.DataAtom {
+		case atom.Html:
+			if lang := attr(n, "lang"); lang != "" {
+				metadata["language"] = lang
+			}
+		case atom.Title:
+			if title == "" {
+				title = strings.Join(strings.Fields(nodeText(n)), " ")
+			}
+		case atom.Meta:
+			name := strings.ToLower(attr(n, "name"))
+			if name == "" {
+				name = strings.ToLower(attr(n, "property"))
+			}
+			key, ok := htmlMetaKeys[name]
+			content := strings.TrimSpace(attr(n, "content"))
+			if ok && content != "" && metadata[key] == "" {
+				metadata[key] = content
+			}
+		}
+	}
+	// The title element names the page itself; og:title is a fallback
+	if title != "" {
+		metadata["title"] = title
+	}
+	return metadata
+}
+
+// htmlText renders the body of a page as plain text, one paragraph per
+// block, leaving out scripts, styles and other content that isn't shown,
+// and boilerplate if strip is set. A page whose text would be empty
+// without its boilerplate keeps it.
+func htmlText(root *html.Node, strip bool) string {
+	if strip {
+		w := htmlWriter{strip: true, stats: make(map[*html.Node]textStats)}
+		w.measure(root)
+		w.walk(contentRoot(root))
+		if text := strings.TrimSpace(w.text.String()); text != "" {
+			return text + "\n"
+		}
+	}
+	w := htmlWriter{}
+	w.walk(root)
+	if text := strings.TrimSpace(w.text.String()); text != "" {
+		return text + "\n"
+	}
+	return ""
+}
+
+// contentRoot returns the element holding the content of a page: its main
+// element, or its only article, or else the whole document
+func contentRoot(root *html.Node) *html.Node {
+	var main, article *html.Node
+	articles := 0
+	for n := range root.Descendants() {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		if main == nil && (n.DataAtom == atom.Main || attr(n, "role") == "main") {
+			main = n
+		}
+		if n.DataAtom == atom.Article {
+			article = n
+			articles++
+		}
+	}
+	switch {
+	case main != nil:
+		return main
+	case articles == 1:
+		return article
+	}
+	return root
+}
+
+// Elements whose content is never text of the page
+var hiddenElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Svg: true, atom.Math: true, atom.Iframe: true,
+	atom.Object: true, atom.Embed: true, atom.Canvas: true, atom.Select: true,
+	atom.Button: true,
+}
+
+// Elements that are boilerplate wherever they are
+var boilerplateElements = map[atom.Atom]bool{
+	atom.Nav: true, atom.Aside: true, atom.Form: true, atom.Dialog: true,
+}
+
+// Landmark roles that are boilerplate
+var boilerplateRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "complementary": true,
+	"search": true, "dialog": true, "alertdialog": true, "menu": true, "menubar": true,
+}
+
+// Class names and IDs of boilerplate, and of content, which wins when an
+// element has both
+var (
+	boilerplateNames = regexp.MustCompile(`(?i)\b(nav|navbar|navigation|menu|breadcrumbs?|sidebar|side-bar|footer|header|masthead|banner|cookies?|consent|gdpr|share|sharing|social|comments?|related|recommended|promo|ads?|advert|advertisement|sponsored|newsletter|subscribe|signup|popup|modal|skip-link|pagination)\b`)
+	contentNames     = regexp.MustCompile(`(?i)\b(article|content|main|post|entry|story|body|text)\b`)
+)
+
+// Block elements, rendered on lines of their own; those in paragraphs are
+// also set apart by a blank line
+var (
+	blockElements = map[atom.Atom]bool{
+		atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true, atom.Header: true,
+		atom.Footer: true, atom.Nav: true, atom.Aside: true, atom.Li: true, atom.Tr: true,
+		atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Figcaption: true, atom.Address: true,
+		atom.Caption: true, atom.Details: true, atom.Summary: true, atom.Body: true,
+	}
+	paragraphElements = map[atom.Atom]bool{
+		atom.P: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true,
+		atom.H6: true, atom.Blockquote: true, atom.Pre: true, atom.Table: true, atom.Ul: true,
+		atom.Ol: true, atom.Hr: true, atom.Figure: true,
+	}
+)
+
+// textStats counts the characters of text in an element, and those of it
+// in links
+type textStats struct {
+	text, links int
+}
+
+// htmlWriter renders the nodes of a page as text, collapsing whitespace
+// outside of pre elements
+type htmlWriter struct {
+	text     strings.Builder
+	newlines int  // Line breaks owed before the next text
+	space    bool // Whether a space is owed before the next text
+	pre      int  // Depth of pre elements
+	strip    bool
+	stats    map[*html.Node]textStats
+}
+
+// measure counts the text of n and every element below it, for the link
+// density of boilerplate removal
+func (w *htmlWriter) measure(n *html.Node) textStats {
+	var stats textStats
+	if n.Type == html.ElementNode && hiddenElements[n.DataAtom] {
+		return stats
+	}
+	if n.Type == html.TextNode {
+		stats.text = utf8.RuneCountInString(strings.Join(strings.Fields(n.Data), " "))
+		return stats
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		childStats := w.measure(child)
+		stats.text += childStats.text
+		stats.links += childStats.links
+	}
+	if n.Type == html.ElementNode && n.DataAtom == atom.A {
+		stats.links = stats.text
+	}
+	w.stats[n] = stats
+	return stats
+}
+
+// boilerplate reports whether an element is navigation, a sidebar, a
+// footer or the like rather than content
+func (w *htmlWriter) boilerplate(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Html, atom.Body, atom.Main, atom.Article:
+		return false
+	case atom.Header, atom.Footer:
+		// Those of an article hold its headline, byline and notes
+		return !within(n, atom.Article, atom.Main)
+	}
+	if boilerplateElements[n.DataAtom] || boilerplateRoles[attr(n, "role")] {
+		return true
+	}
+	names := attr(n, "class") + " " + attr(n, "id")
+	if boilerplateNames.MatchString(names) && !contentNames.MatchString(names) {
+		return true
+	}
+	// Blocks of mostly links are menus, tag clouds and lists of other pages
+	switch n.DataAtom {
+	case atom.Div, atom.Section, atom.Ul, atom.Ol, atom.Table, atom.Td:
+		stats := w.stats[n]
+		return stats.text > 0 && stats.links*2 > stats.text && countLinks(n) >= 2
+	}
+	return false
+}
+
+// walk renders n and the nodes below it
+func (w *htmlWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.writeText(n.Data)
+		return
+	case html.DocumentNode:
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			w.walk(child)
+		}
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	if hiddenElements[n.DataAtom] || hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" {
+		return
+	}
+	if w.strip && w.boilerplate(n) {
+		return
+	}
+
+	switch {
+	case n.DataAtom == atom.Br:
+		w.breakLine(1)
+		return
+	case paragraphElements[n.DataAtom]:
+		w.breakLine(2)
+	case blockElements[n.DataAtom]:
+		w.breakLine(1)
+	case n.DataAtom == atom.Td || n.DataAtom == atom.Th:
+		if previousCell(n) {
+			w.flush()
+			w.text.WriteByte('\t')
+		}
+	}
+	if n.DataAtom == atom.Li {
+		w.flush()
+		w.text.WriteString("- ")
+	}
+	if n.DataAtom == atom.Pre {
+		w.pre++
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		w.walk(child)
+	}
+
+	if n.DataAtom == atom.Pre {
+		w.pre--
+	}
+	switch {
+	case paragraphElements[n.DataAtom]:
+		w.breakLine(2)
+	case blockElements[n.DataAtom]:
+		w.breakLine(1)
+	}
+}
+
+// writeText writes the text of a text node
+func (w *htmlWriter) writeText(s string) {
+	if w.pre > 0 {
+		w.flush()
+		w.text.WriteString(s)
+		return
+	}
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if s != "" {
+			w.space = true
+		}
+		return
+	}
+	first, _ := utf8.DecodeRuneInString(s)
+	last, _ := utf8.DecodeLastRuneInString(s)
+	if unicode.IsSpace(first) {
+		w.space = true
+	}
+	w.flush()
+	w.text.WriteString(strings.Join(words, " "))
+	w.space = unicode.IsSpace(last)
+}
+
+// breakLine ends the current line, leaving n-1 blank lines before the next
+// text
+func (w *htmlWriter) breakLine(n int) {
+	if w.text.Len() > 0 {
+		w.newlines = max(w.newlines, n)
+	}
+	w.space = false
+}
+
+// flush writes the line breaks or space owed before the next text
+func (w *htmlWriter) flush() {
+	if w.newlines > 0 {
+		w.text.WriteString(strings.Repeat("\n", w.newlines))
+	} else if w.space && w.text.Len() > 0 {
+		w.text.WriteByte(' ')
+	}
+	w.newlines, w.space = 0, false
+}
+
+// previousCell reports whether a table cell follows another in its row
+func previousCell(n *html.Node) bool {
+	for sibling := n.PrevSibling; sibling != nil; sibling = sibling.PrevSibling {
+		if sibling.DataAtom == atom.Td || sibling.DataAtom == atom.Th {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether n is inside an element of one of the kinds
+func within(n *html.Node, kinds ...atom.Atom) bool {
+	for parent := n.Parent; parent != nil; parent = parent.Parent {
+		for _, kind := range kinds {
+			if parent.DataAtom == kind {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// countLinks counts the links in n
+func countLinks(n *html.Node) int {
+	count := 0
+	for d := range n.Descendants() {
+		if d.Type == html.ElementNode && d.DataAtom == atom.A {
+			count++
+		}
+	}
+	return count
+}
+
+// nodeText returns the text below n as it is in the page
+func nodeText(n *html.Node) string {
+	var text strings.Builder
+	for d := range n.Descendants() {
+		if d.Type == html.TextNode {
+			text.WriteString(d.Data)
+		}
+	}
+	return text.String()
+}
+
+// hasAttr reports whether n has an attribute, whatever its value
+func hasAttr(n *html.Node, name string) bool {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// attr returns the value of an attribute of n, or "" if it has none
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
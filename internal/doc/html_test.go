@@ -0,0 +1,64 @@
+package doc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Moving   house</title>
+<meta name="description" content="Notes on the move">
+<meta property="og:title" content="Ignored">
+<style>body { color: red }</style>
+<script>var tracking = "junk";</script>
+</head>
+<body>
+<div class="site-header"><a href="/">Home</a> <a href="/blog">Blog</a></div>
+<nav><ul><li><a href="/a">Archive</a></li><li><a href="/b">About</a></li></ul></nav>
+<div id="content">
+  <h1>Moving house</h1>
+  <p>We packed   the <b>kitchen</b> first.<br>Then the books.</p>
+  <ul><li>Boxes</li><li>Tape</li></ul>
+  <table><tr><th>Room</th><th>Boxes</th></tr><tr><td>Kitchen</td><td>12</td></tr></table>
+  <div class="related"><a href="/x">Other post</a> <a href="/y">Another post</a></div>
+  <p hidden>Draft</p>
+</div>
+<footer>Copyright 2009</footer>
+<div class="cookie-banner">We use cookies</div>
+</body>
+</html>`
+
+func TestExtractHTML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "moving.html")
+	if err := os.WriteFile(path, []byte(testPage), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ExtractText(context.Background(), path)
+	if err != nil || result.Error != nil {
+		t.Fatalf("ExtractText: %v, %v", err, result.Error)
+	}
+	want := "Moving house\n\nWe packed the kitchen first.\nThen the books.\n\n- Boxes\n- Tape\n\nRoom\tBoxes\nKitchen\t12\n"
+	if result.Text != want || result.Extractor != "native" {
+		t.Errorf("extracted %q with %s, want %q", result.Text, result.Extractor, want)
+	}
+	if result.Title != "Moving house" || result.Metadata["description"] != "Notes on the move" ||
+		result.Metadata["language"] != "en" || result.Metadata["encoding"] != "utf-8" {
+		t.Errorf("title %q, metadata %v", result.Title, result.Metadata)
+	}
+
+	// The whole page, without what is never shown
+	SetStripBoilerplate(false)
+	defer SetStripBoilerplate(true)
+	result, _ = ExtractText(context.Background(), path)
+	want = "Home Blog\n\n- Archive\n- About\n\nMoving house\n\nWe packed the kitchen first.\nThen the books.\n\n- Boxes\n- Tape\n\n" +
+		"Room\tBoxes\nKitchen\t12\n\nOther post Another post\nCopyright 2009\nWe use cookies\n"
+	if result.Text != want {
+		t.Errorf("extracted %q, want %q", result.Text, want)
+	}
+}
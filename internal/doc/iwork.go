@@ -0,0 +1,328 @@
+package doc
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxIWorkPart caps how much of one part of an iWork package is read
+const maxIWorkPart = 256 << 20
+
+// Object types holding text in iWork '13 and later archives
+const (
+	iworkStorage      = 2001 // TSWP.StorageArchive, the text of a body, text box, note or cell
+	iworkStorageOther = 2005 // TSWP.StorageArchive again, under the other type it is registered as
+	iworkStringList   = 6005 // TST.TableDataList, the strings of a Numbers table
+)
+
+// extractIWork extracts the text of a Pages, Numbers or Keynote file saved
+// as a single file: a ZIP package holding either the XML index of iWork
+// '09 and earlier, or the Snappy-compressed protobuf archives (.iwa) of
+// iWork '13 and later
+func extractIWork(filePath string) (string, map[string]string, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open iWork package: %w", err)
+	}
+	defer archive.Close()
+
+	parts := make(map[string]*zip.File)
+	for _, part := range archive.File {
+		parts[part.Name] = part
+	}
+	for _, name := range []string{"index.xml", "index.xml.gz", "index.apxl", "index.apxl.gz"} {
+		if part := parts[name]; part != nil {
+			text, metadata, err := extractIWorkXML(part)
+			if err != nil {
+				return "", nil, err
+			}
+			metadata["format"] = "iwork-09"
+			return text, metadata, nil
+		}
+	}
+
+	// Early iWork '13 packages keep their archives in a nested Index.zip
+	files := archive.File
+	if part := parts["Index.zip"]; part != nil {
+		data, err := readPart(part)
+		if err != nil {
+			return "", nil, err
+		}
+		nested, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid Index.zip: %w", err)
+		}
+		files = nested.File
+	}
+	var archives []*zip.File
+	for _, part := range files {
+		if path.Ext(part.Name) == ".iwa" {
+			archives = append(archives, part)
+		}
+	}
+	if len(archives) == 0 {
+		return "", nil, errors.New("not an iWork package: no index.xml or .iwa archives")
+	}
+	// The document comes first, then the rest in name order
+	sort.SliceStable(archives, func(i, j int) bool {
+		iDocument := path.Base(archives[i].Name) == "Document.iwa"
+		jDocument := path.Base(archives[j].Name) == "Document.iwa"
+		if iDocument != jDocument {
+			return iDocument
+		}
+		return archives[i].Name < archives[j].Name
+	})
+
+	var text strings.Builder
+	for _, part := range archives {
+		data, err := readPart(part)
+		if err != nil {
+			return "", nil, err
+		}
+		stream, err := decompressIWA(data)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", part.Name, err)
+		}
+		if err := iworkText(&text, stream); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", part.Name, err)
+		}
+	}
+	return text.String(), map[string]string{"format": "iwork-13"}, nil
+}
+
+// readPart reads a part of a ZIP package, up to maxIWorkPart bytes
+func readPart(part *zip.File) ([]byte, error) {
+	reader, err := part.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", part.Name, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, maxIWorkPart))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", part.Name, err)
+	}
+	return data, nil
+}
+
+// decompressIWA joins the chunks of an .iwa archive, each a zero byte and
+// a 24-bit little-endian length followed by a Snappy block
+func decompressIWA(data []byte) ([]byte, error) {
+	var stream []byte
+	for len(data) > 0 {
+		if len(data) < 4 || data[0] != 0 {
+			return nil, errors.New("invalid IWA chunk header")
+		}
+		length := int(data[1]) | int(data[2])<<8 | int(data[3])<<16
+		if len(data) < 4+length {
+			return nil, errors.New("truncated IWA chunk")
+		}
+		block, err := snappy.Decode(nil, data[4:4+length])
+		if err != nil {
+			return nil, fmt.Errorf("invalid IWA chunk: %w", err)
+		}
+		stream = append(stream, block...)
+		data = data[4+length:]
+	}
+	return stream, nil
+}
+
+// iworkText writes the text of the objects of a decompressed archive. Each
+// object is an ArchiveInfo message prefixed by its length, describing the
+// type and length of the messages that follow it.
+func iworkText(text *strings.Builder, stream []byte) error {
+	for len(stream) > 0 {
+		length, n := protowire.ConsumeVarint(stream)
+		if n < 0 || uint64(len(stream)-n) < length {
+			return errors.New("invalid IWA object")
+		}
+		info := stream[n : n+int(length)]
+		stream = stream[n+int(length):]
+
+		for _, message := range protoFields(info, 2) {
+			typ := protoVarint(message, 1)
+			size := protoVarint(message, 3)
+			if uint64(len(stream)) < size {
+				return errors.New("truncated IWA object")
+			}
+			payload := stream[:size]
+			stream = stream[size:]
+
+			switch typ {
+			case iworkStorage, iworkStorageOther:
+				for _, s := range protoFields(payload, 3) {
+					writeIWorkString(text, string(s))
+				}
+			case iworkStringList:
+				for _, entry := range protoFields(payload, 3) {
+					for _, s := range protoFields(entry, 3) {
+						writeIWorkString(text, string(s))
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeIWorkString writes a string of iWork text as lines, turning the
+// paragraph, line and page break characters iWork uses into newlines and
+// dropping the object replacement characters marking attachments
+func writeIWorkString(text *strings.Builder, s string) {
+	s = strings.NewReplacer("\u2029", "\n", "\u2028", "\n", "\r", "\n", "\f", "\n", "\ufffc", "").Replace(s)
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return
+	}
+	text.WriteString(s)
+	text.WriteString("\n\n")
+}
+
+// protoFields returns the length-delimited values of a field of a protobuf
+// message, ignoring fields of other types
+func protoFields(message []byte, field protowire.Number) [][]byte {
+	var values [][]byte
+	for len(message) > 0 {
+		number, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return values
+		}
+		message = message[n:]
+		if number == field && typ == protowire.BytesType {
+			value, n := protowire.ConsumeBytes(message)
+			if n < 0 {
+				return values
+			}
+			values = append(values, value)
+			message = message[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(number, typ, message)
+		if n < 0 {
+			return values
+		}
+		message = message[n:]
+	}
+	return values
+}
+
+// protoVarint returns the first value of a varint field of a protobuf
+// message, or 0 if it has none
+func protoVarint(message []byte, field protowire.Number) uint64 {
+	for len(message) > 0 {
+		number, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return 0
+		}
+		message = message[n:]
+		if number == field && typ == protowire.VarintType {
+			value, _ := protowire.ConsumeVarint(message)
+			return value
+		}
+		n = protowire.ConsumeFieldValue(number, typ, message)
+		if n < 0 {
+			return 0
+		}
+		message = message[n:]
+	}
+	return 0
+}
+
+// extractIWorkXML extracts the paragraphs, table cells and document
+// properties of the XML index of an iWork '09 package
+func extractIWorkXML(part *zip.File) (string, map[string]string, error) {
+	data, err := readPart(part)
+	if err != nil {
+		return "", nil, err
+	}
+	if strings.HasSuffix(part.Name, ".gz") {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read %s: %w", part.Name, err)
+		}
+		if data, err = io.ReadAll(io.LimitReader(reader, maxIWorkPart)); err != nil {
+			return "", nil, fmt.Errorf("failed to read %s: %w", part.Name, err)
+		}
+	}
+
+	var text strings.Builder
+	metadata := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	paragraphs := 0 // Depth of paragraphs
+	property := ""  // Document property being read, within sf:metadata
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid %s: %w", part.Name, err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch name := token.Name.Local; name {
+			case "p":
+				paragraphs++
+			case "br", "lnbr", "pgbr", "sectbr", "crbr":
+				text.WriteByte('\n')
+			case "tab":
+				text.WriteByte('\t')
+			case "ct":
+				// Numbers keeps the text of a cell in an attribute
+				if s := xmlAttr(token, "s"); s != "" {
+					text.WriteString(s)
+					text.WriteByte('\n')
+				}
+			case "title", "authors", "keywords", "comment":
+				property = name
+			case "string":
+				if property != "" && metadata[iworkProperty(property)] == "" {
+					metadata[iworkProperty(property)] = xmlAttr(token, "string")
+				}
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "p":
+				paragraphs--
+				text.WriteByte('\n')
+			case "title", "authors", "keywords", "comment":
+				property = ""
+			}
+		case xml.CharData:
+			if paragraphs > 0 {
+				text.Write(token)
+			}
+		}
+	}
+	return text.String(), metadata, nil
+}
+
+// iworkProperty returns the metadata key of an iWork '09 document property
+func iworkProperty(name string) string {
+	if name == "authors" {
+		return "author"
+	}
+	return name
+}
+
+// xmlAttr returns the value of an attribute of an element by its local
+// name, or "" if it has none
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
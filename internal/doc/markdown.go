@@ -0,0 +1,166 @@
+package doc
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// extractMarkdown extracts the text of a Markdown file without its syntax,
+// taking its title from its front matter or first heading
+func extractMarkdown(path string) (string, map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read Markdown file: %w", err)
+	}
+	content, encoding := decodeText(data, "")
+	text, title := stripMarkdown(content)
+	metadata := map[string]string{"encoding": encoding}
+	if title != "" {
+		metadata["title"] = title
+	}
+	return text, metadata, nil
+}
+
+// Markdown syntax, matched line by line outside of code blocks
+var (
+	markdownHeading    = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)(\s+#+)?\s*$`)
+	markdownUnderline  = regexp.MustCompile(`^\s{0,3}(=+|-+)\s*$`)
+	markdownRule       = regexp.MustCompile(`^\s{0,3}([-*_]\s*){3,}$`)
+	markdownReference  = regexp.MustCompile(`^\s{0,3}\[[^\]]+\]:\s*\S+`)
+	markdownQuote      = regexp.MustCompile(`^\s{0,3}(>\s?)+`)
+	markdownBullet     = regexp.MustCompile(`^(\s*)[*+-]\s+`)
+	markdownTableRule  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	markdownFence      = regexp.MustCompile("^\\s{0,3}(```|~~~)")
+	markdownFrontTitle = regexp.MustCompile(`(?m)^title:\s*["']?(.*?)["']?\s*$`)
+	markdownCodeSpan   = regexp.MustCompile("(`+)([^`]+?)(`+)")
+)
+
+// Inline Markdown syntax and the part of it that is text, in the order
+// they are replaced
+var markdownInline = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`), "$1"},
+	{regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`), "$1"},
+	{regexp.MustCompile(`\[([^\]]+)\]\[[^\]]*\]`), "$1"},
+	{regexp.MustCompile(`<((https?|mailto):[^>\s]+)>`), "$1"},
+	{regexp.MustCompile(`</?[a-zA-Z][^>]*>`), ""},
+	{regexp.MustCompile(`\*\*(.+?)\*\*`), "$1"},
+	{regexp.MustCompile(`__(.+?)__`), "$1"},
+	{regexp.MustCompile(`~~(.+?)~~`), "$1"},
+	{regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`), "$1"},
+	// Underscores inside words are those of identifiers, not emphasis
+	{regexp.MustCompile(`(^|[^\w])_([^_\s](?:[^_]*[^_\s])?)_([^\w]|$)`), "$1$2$3"},
+}
+
+// stripMarkdown returns the text of a Markdown document without its
+// syntax, keeping the contents of code blocks as they are, list items
+// under dashes and table rows as tab-separated cells, and the title from
+// its front matter or its first heading
+func stripMarkdown(content string) (string, string) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	var title string
+	if rest, ok := strings.CutPrefix(content, "---\n"); ok {
+		if front, body, ok := strings.Cut(rest, "\n---\n"); ok {
+			if match := markdownFrontTitle.FindStringSubmatch(front); match != nil {
+				title = match[1]
+			}
+			content = body
+		}
+	}
+
+	var lines []string
+	var fence string
+	previous := ""
+	for _, line := range strings.Split(content, "\n") {
+		if match := markdownFence.FindStringSubmatch(line); match != nil {
+			switch {
+			case fence == "":
+				fence = match[1]
+				continue
+			case fence == match[1]:
+				fence = ""
+				continue
+			}
+		}
+		if fence != "" {
+			lines = append(lines, line)
+			continue
+		}
+
+		switch {
+		case markdownUnderline.MatchString(line) && strings.TrimSpace(previous) != "":
+			// The line above was a heading
+			if title == "" && strings.Contains(line, "=") {
+				title = strings.TrimSpace(previous)
+			}
+			continue
+		case markdownRule.MatchString(line), markdownReference.MatchString(line), markdownTableRule.MatchString(line) && strings.Contains(line, "|"):
+			continue
+		}
+		previous = line
+
+		if match := markdownHeading.FindStringSubmatch(line); match != nil {
+			line = match[2]
+			if title == "" && match[1] == "#" {
+				title = stripInline(line)
+			}
+		}
+		line = markdownQuote.ReplaceAllString(line, "")
+		line = markdownBullet.ReplaceAllString(line, "$1- ")
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "|") {
+			cells := strings.Split(strings.Trim(trimmed, "|"), "|")
+			for i, cell := range cells {
+				cells[i] = strings.TrimSpace(cell)
+			}
+			line = strings.Join(cells, "\t")
+		}
+		lines = append(lines, strings.TrimRight(stripInline(line), " \t"))
+	}
+
+	// Runs of blank lines are left as one
+	var text strings.Builder
+	blank := true
+	for _, line := range lines {
+		if line == "" {
+			if !blank {
+				text.WriteByte('\n')
+			}
+			blank = true
+			continue
+		}
+		text.WriteString(line)
+		text.WriteByte('\n')
+		blank = false
+	}
+	if text.Len() == 0 {
+		return "", title
+	}
+	return strings.TrimRight(text.String(), "\n") + "\n", title
+}
+
+// stripInline removes the inline syntax of a line of Markdown, leaving
+// code spans as they are but for their backticks
+func stripInline(line string) string {
+	var text strings.Builder
+	start := 0
+	for _, span := range markdownCodeSpan.FindAllStringSubmatchIndex(line, -1) {
+		text.WriteString(stripSyntax(line[start:span[0]]))
+		text.WriteString(line[span[4]:span[5]])
+		start = span[1]
+	}
+	text.WriteString(stripSyntax(line[start:]))
+	return text.String()
+}
+
+// stripSyntax removes the inline syntax of Markdown text outside of code
+// spans
+func stripSyntax(text string) string {
+	for _, inline := range markdownInline {
+		text = inline.pattern.ReplaceAllString(text, inline.replacement)
+	}
+	return text
+}
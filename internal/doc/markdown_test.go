@@ -0,0 +1,35 @@
+package doc
+
+import "testing"
+
+func TestStripMarkdown(t *testing.T) {
+	content := "---\ntitle: \"Field notes\"\ndate: 2014-06-01\n---\n" +
+		"# Trip to the *coast*\n\n" +
+		"Took the **early** train, see [the map](https://example.com/map \"Map\") and ![a gull](gull.jpg).\n" +
+		"Call `parse_args()` before snake_case_names; ~~never~~ __always__ _check_.\n\n\n" +
+		"> Quoted <em>words</em>\n\n" +
+		"* one\n+ two\n  - nested\n\n" +
+		"| Day | Miles |\n|-----|------:|\n| Mon | 12 |\n\n" +
+		"```go\nfunc main() {\n\n\tfmt.Println(\"**not bold**\")\n}\n```\n\n" +
+		"Setext heading\n--------------\n\n***\n\n[map]: https://example.com/map\n"
+
+	text, title := stripMarkdown(content)
+	want := "Trip to the coast\n\n" +
+		"Took the early train, see the map and a gull.\n" +
+		"Call parse_args() before snake_case_names; never always check.\n\n" +
+		"Quoted words\n\n" +
+		"- one\n- two\n  - nested\n\n" +
+		"Day\tMiles\nMon\t12\n\n" +
+		"func main() {\n\n\tfmt.Println(\"**not bold**\")\n}\n\n" +
+		"Setext heading\n"
+	if text != want {
+		t.Errorf("stripped %q, want %q", text, want)
+	}
+	if title != "Field notes" {
+		t.Errorf("title = %q, want the front matter title", title)
+	}
+
+	if _, title := stripMarkdown("Read me\n=======\n\nText\n"); title != "Read me" {
+		t.Errorf("title = %q, want the setext heading", title)
+	}
+}
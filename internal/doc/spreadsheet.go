@@ -0,0 +1,399 @@
+package doc
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jth/archiver/internal/tools"
+)
+
+// maxSheetCells caps how many cells of a workbook are extracted, so that a
+// generated sheet of millions of rows doesn't swamp the index
+const maxSheetCells = 1_000_000
+
+// extractSpreadsheet extracts text from spreadsheet files: CSV and XLSX are
+// read natively, one row per line with tab-separated cells and each sheet
+// under its name; the older binary XLS format needs Apache Tika
+func extractSpreadsheet(ctx context.Context, path string) (string, map[string]string, string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		text, metadata, err := extractCSV(path)
+		return text, metadata, "native", err
+	case ".xlsx":
+		text, metadata, err := extractXLSX(path)
+		return text, metadata, "native", err
+	}
+
+	if tikaAvailable(ctx) {
+		return extractWithTika(ctx, path)
+	}
+	return "", nil, "", fmt.Errorf("no XLS extraction tools available: %w", tools.ErrNotInstalled)
+}
+
+// extractCSV reads a CSV file in whatever encoding and with whichever
+// delimiter it was written
+func extractCSV(path string) (string, map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read CSV file: %w", err)
+	}
+	content, encoding := decodeText(data, "")
+	delimiter := sniffDelimiter(content)
+
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	var text strings.Builder
+	rows := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to parse CSV file: %w", err)
+		}
+		writeRow(&text, record)
+		rows++
+	}
+
+	metadata := map[string]string{
+		"encoding":  encoding,
+		"delimiter": delimiterName(delimiter),
+		"rows":      strconv.Itoa(rows),
+	}
+	return text.String(), metadata, nil
+}
+
+// sniffDelimiter picks the delimiter of CSV content: the candidate found
+// the same, nonzero number of times on the most of its first lines
+func sniffDelimiter(content string) rune {
+	lines := strings.SplitN(content, "\n", 21)
+	if len(lines) > 20 {
+		lines = lines[:20]
+	}
+
+	best, bestScore := ',', 0
+	for _, candidate := range []rune{',', ';', '\t', '|'} {
+		counts := make(map[int]int)
+		for _, line := range lines {
+			if n := countOutsideQuotes(line, candidate); n > 0 {
+				counts[n]++
+			}
+		}
+		score := 0
+		for _, lines := range counts {
+			score = max(score, lines)
+		}
+		if score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
+
+// countOutsideQuotes counts the occurrences of r in line that aren't inside
+// a quoted field
+func countOutsideQuotes(line string, r rune) int {
+	n, quoted := 0, false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == r && !quoted:
+			n++
+		}
+	}
+	return n
+}
+
+// delimiterName names a delimiter for the metadata
+func delimiterName(delimiter rune) string {
+	if delimiter == '\t' {
+		return "tab"
+	}
+	return string(delimiter)
+}
+
+// writeRow writes the cells of a row as a tab-separated line, leaving out
+// empty cells at its end and rows with no values at all
+func writeRow(text *strings.Builder, cells []string) {
+	last := len(cells) - 1
+	for last >= 0 && strings.TrimSpace(cells[last]) == "" {
+		last--
+	}
+	if last < 0 {
+		return
+	}
+	for i, cell := range cells[:last+1] {
+		if i > 0 {
+			text.WriteByte('\t')
+		}
+		// Line breaks inside a cell would split the row
+		text.WriteString(strings.Join(strings.Fields(cell), " "))
+	}
+	text.WriteByte('\n')
+}
+
+// xlsxSheet is a sheet listed in the workbook part of an XLSX file
+type xlsxSheet struct {
+	Name string `xml:"name,attr"`
+	ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+}
+
+// extractXLSX reads the cell values of every sheet of an XLSX workbook, in
+// workbook order, each under a "Sheet: name" line
+func extractXLSX(filePath string) (string, map[string]string, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open XLSX file: %w", err)
+	}
+	defer reader.Close()
+	parts := make(map[string]*zip.File)
+	for _, file := range reader.File {
+		parts[file.Name] = file
+	}
+
+	var workbook struct {
+		Sheets []xlsxSheet `xml:"sheets>sheet"`
+	}
+	if err := decodePart(parts, "xl/workbook.xml", &workbook); err != nil {
+		return "", nil, err
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodePart(parts, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", nil, err
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join("xl", rel.Target)
+		}
+	}
+	shared, err := sharedStrings(parts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var text strings.Builder
+	var names []string
+	cells := 0
+	for _, sheet := range workbook.Sheets {
+		part, ok := parts[targets[sheet.ID]]
+		if !ok {
+			continue
+		}
+		names = append(names, sheet.Name)
+		fmt.Fprintf(&text, "Sheet: %s\n", sheet.Name)
+		n, err := writeSheet(&text, part, shared, maxSheetCells-cells)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read sheet %s: %w", sheet.Name, err)
+		}
+		cells += n
+		text.WriteByte('\n')
+	}
+
+	metadata := map[string]string{"sheets": strings.Join(names, ", ")}
+	var core struct {
+		Title   string `xml:"http://purl.org/dc/elements/1.1/ title"`
+		Creator string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	}
+	if decodePart(parts, "docProps/core.xml", &core) == nil {
+		if core.Title != "" {
+			metadata["title"] = core.Title
+		}
+		if core.Creator != "" {
+			metadata["author"] = core.Creator
+		}
+	}
+	return text.String(), metadata, nil
+}
+
+// decodePart decodes an XML part of an Office file
+func decodePart(parts map[string]*zip.File, name string, v any) error {
+	part, ok := parts[name]
+	if !ok {
+		return fmt.Errorf("not an XLSX workbook: %s is missing", name)
+	}
+	r, err := part.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := xml.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// sharedStrings reads the table of strings that text cells refer to by
+// index. Rich text strings are split in runs, which are joined.
+func sharedStrings(parts map[string]*zip.File) ([]string, error) {
+	part, ok := parts["xl/sharedStrings.xml"]
+	if !ok {
+		return nil, nil // Workbooks of numbers only have none
+	}
+	r, err := part.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var shared []string
+	var current strings.Builder
+	inText := false
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return shared, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse shared strings: %w", err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "si":
+				current.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				// Phonetic readings repeat the text
+				decoder.Skip()
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "si":
+				shared = append(shared, current.String())
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				current.Write(token)
+			}
+		}
+	}
+}
+
+// writeSheet writes the rows of a worksheet part, with each cell in its
+// column, and returns how many cells it wrote, at most limit
+func writeSheet(text *strings.Builder, part *zip.File, shared []string, limit int) (int, error) {
+	r, err := part.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	var row []string
+	var cellType, ref string
+	var value strings.Builder
+	inValue, cells := false, 0
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return cells, nil
+		}
+		if err != nil {
+			return cells, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "row":
+				row = row[:0]
+			case "c":
+				cellType, ref = "", ""
+				for _, attr := range token.Attr {
+					switch attr.Name.Local {
+					case "t":
+						cellType = attr.Value
+					case "r":
+						ref = attr.Value
+					}
+				}
+				value.Reset()
+			case "v", "t":
+				inValue = true
+			case "f", "rPh":
+				// Formulas and phonetic readings aren't values
+				decoder.Skip()
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				column := len(row)
+				if col, ok := columnIndex(ref); ok && col >= column {
+					column = col
+				}
+				for len(row) < column {
+					row = append(row, "")
+				}
+				row = append(row, cellValue(cellType, value.String(), shared))
+			case "row":
+				if cells+len(row) > limit {
+					return cells, nil
+				}
+				cells += len(row)
+				writeRow(text, row)
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(token)
+			}
+		}
+	}
+}
+
+// cellValue returns the text of a cell from its type and raw value
+func cellValue(cellType, value string, shared []string) string {
+	switch cellType {
+	case "s":
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 0 || i >= len(shared) {
+			return ""
+		}
+		return shared[i]
+	case "b":
+		if value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return value
+}
+
+// columnIndex returns the zero-based column of a cell reference such as
+// "C7"
+func columnIndex(ref string) (int, bool) {
+	column := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		column = column*26 + int(ref[i]-'A'+1)
+	}
+	if i == 0 {
+		return 0, false
+	}
+	return column - 1, true
+}
@@ -0,0 +1,78 @@
+package doc
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractCSV(t *testing.T) {
+	// Windows-1252, semicolon-separated, with a quoted semicolon
+	path := filepath.Join(t.TempDir(), "ventes.csv")
+	data := []byte("Produit;Prix;Note\nCaf\xe9;3,50;\"bon; pas cher\"\nTh\xe9;2,80;\n")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ExtractText(context.Background(), path)
+	if err != nil || result.Error != nil {
+		t.Fatalf("ExtractText: %v, %v", err, result.Error)
+	}
+	want := "Produit\tPrix\tNote\nCafé\t3,50\tbon; pas cher\nThé\t2,80\n"
+	if result.Text != want || result.Extractor != "native" {
+		t.Errorf("extracted %q with %s, want %q", result.Text, result.Extractor, want)
+	}
+	if result.Metadata["encoding"] != "windows-1252" || result.Metadata["delimiter"] != ";" || result.Metadata["rows"] != "3" {
+		t.Errorf("metadata = %v", result.Metadata)
+	}
+}
+
+func TestExtractXLSX(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budget.xlsx")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := zip.NewWriter(file)
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+			xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+			<sheets><sheet name="2024" sheetId="1" r:id="rId1"/><sheet name="Notes" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId1" Target="worksheets/sheet1.xml"/>
+			<Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>Rent</t></si><si><r><t>Gro</t></r><r><t>ceries</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>
+			<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1"><v>1200</v></c></row>
+			<row r="2"><c r="A2" t="s"><v>1</v></c><c r="B2" t="b"><v>1</v></c><c r="C2"><f>SUM(C1)</f><v>310.5</v></c></row>
+			</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData>
+			<row r="1"><c r="A1" t="inlineStr"><is><t>Paid in cash</t></is></c></row>
+			</sheetData></worksheet>`,
+		"docProps/core.xml": `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties"
+			xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Household budget</dc:title></cp:coreProperties>`,
+	}
+	for name, content := range parts {
+		part, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(content))
+	}
+	writer.Close()
+	file.Close()
+
+	result, err := ExtractText(context.Background(), path)
+	if err != nil || result.Error != nil {
+		t.Fatalf("ExtractText: %v, %v", err, result.Error)
+	}
+	want := "Sheet: 2024\nRent\t\t1200\nGroceries\tTRUE\t310.5\n\nSheet: Notes\nPaid in cash\n\n"
+	if result.Text != want {
+		t.Errorf("extracted %q, want %q", result.Text, want)
+	}
+	if result.Title != "Household budget" || result.Metadata["sheets"] != "2024, Notes" {
+		t.Errorf("title %q, metadata %v", result.Title, result.Metadata)
+	}
+}
@@ -0,0 +1,352 @@
+package doc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jth/archiver/internal/tools"
+)
+
+// DefaultTikaURL is where Tika Server listens unless told otherwise
+const DefaultTikaURL = "http://localhost:9998"
+
+// errTikaDown is wrapped by the errors of extractions that failed because
+// the Tika server couldn't be reached, rather than because of the document
+var errTikaDown = errors.New("tika server unavailable")
+
+const (
+	// tikaCheckInterval is how long the outcome of a health check is trusted
+	tikaCheckInterval = 30 * time.Second
+	// tikaStartTimeout is how long a started server has to answer
+	tikaStartTimeout = 90 * time.Second
+)
+
+// TikaServer extracts text and metadata with an Apache Tika server, which
+// keeps one JVM running for every document instead of starting the tika
+// command, and a JVM, per file
+type TikaServer struct {
+	url      string
+	client   *http.Client
+	launcher []string // Command starting a server when none answers; nil to only use a running one
+
+	mu      sync.Mutex
+	process *exec.Cmd
+	exited  chan struct{} // Closed when process exits
+	checked time.Time     // When the server was last checked, or zero to check again
+	err     error         // Outcome of the last check
+}
+
+// NewTikaServer returns a client of the Tika server at serverURL, or
+// DefaultTikaURL if it is "". If nothing answers there and launcher is
+// set, it is started when a document is first extracted with the port of
+// the URL appended, as in "tika-rest-server --port 9998", and stopped by
+// Close.
+func NewTikaServer(serverURL string, launcher ...string) *TikaServer {
+	if serverURL == "" {
+		serverURL = DefaultTikaURL
+	}
+	return &TikaServer{
+		url: strings.TrimSuffix(serverURL, "/"),
+		client: &http.Client{Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConns:        32,
+			MaxIdleConnsPerHost: 32,
+			IdleConnTimeout:     90 * time.Second,
+		}},
+		launcher: launcher,
+	}
+}
+
+// TikaLauncher returns the command starting a local Tika server: the
+// tika-rest-server or tika-server script if one is installed, or java with
+// jar, the tika-server-standard JAR, if it is set. It returns nil if there
+// is no way to start one.
+func TikaLauncher(jar string) []string {
+	if jar != "" && tools.Available("java") {
+		return []string{"java", "-jar", jar}
+	}
+	if script := tools.First("tika-rest-server", "tika-server"); script != "" {
+		return []string{script}
+	}
+	return nil
+}
+
+// Usable reports whether the server answers or could be started, without
+// starting it
+func (t *TikaServer) Usable(ctx context.Context) bool {
+	if len(t.launcher) > 0 && t.isLocal() {
+		return true
+	}
+	return t.ensure(ctx, false) == nil
+}
+
+// Check asks the server whether it is up
+func (t *TikaServer) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url+"/tika", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("tika server not reachable at %s: %w", t.url, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("tika server at %s: %s", t.url, resp.Status)
+	}
+	return nil
+}
+
+// ensure checks that the server is up, at most once per tikaCheckInterval,
+// and starts it if it isn't and start is set
+func (t *TikaServer) ensure(ctx context.Context, start bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.checked.IsZero() && time.Since(t.checked) < tikaCheckInterval {
+		return t.err
+	}
+
+	t.err = t.Check(ctx)
+	if t.err != nil && start && len(t.launcher) > 0 && t.isLocal() && ctx.Err() == nil {
+		t.err = t.start(ctx)
+	}
+	t.checked = time.Now()
+	return t.err
+}
+
+// recheck makes the next extraction check the server first, after a
+// request to it failed
+func (t *TikaServer) recheck() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.checked = time.Time{}
+}
+
+// isLocal reports whether the server URL is on this machine, where a
+// server can be started
+func (t *TikaServer) isLocal() bool {
+	parsed, err := url.Parse(t.url)
+	if err != nil {
+		return false
+	}
+	host := parsed.Hostname()
+	ip := net.ParseIP(host)
+	return host == "localhost" || (ip != nil && ip.IsLoopback())
+}
+
+// start launches the server and waits for it to answer. t.mu is held.
+func (t *TikaServer) start(ctx context.Context) error {
+	if t.process != nil {
+		select {
+		case <-t.exited:
+			t.process = nil
+		default:
+			// Still starting, or wedged: wait for it again below
+		}
+	}
+	if t.process == nil {
+		parsed, err := url.Parse(t.url)
+		if err != nil {
+			return err
+		}
+		port := parsed.Port()
+		if port == "" {
+			port = "80"
+		}
+		args := append(append([]string{}, t.launcher[1:]...), "--port", port)
+		// The server outlives the context of the document that started it
+		cmd := exec.Command(tools.Path(t.launcher[0]), args...)
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("failed to start tika server: %w", err)
+		}
+		exited := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(exited)
+		}()
+		t.process, t.exited = cmd, exited
+	}
+
+	deadline := time.NewTimer(tikaStartTimeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(500 * time.Millisecond)
+	defer poll.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-t.exited:
+			t.process = nil
+			return errors.New("tika server exited while starting")
+		case <-deadline.C:
+			return fmt.Errorf("tika server did not answer within %s of starting", tikaStartTimeout)
+		case <-poll.C:
+			if err := t.Check(ctx); err == nil {
+				return nil
+			}
+		}
+	}
+}
+
+// Close stops the server if it was started by this client
+func (t *TikaServer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.process == nil {
+		return nil
+	}
+	err := t.process.Process.Kill()
+	<-t.exited
+	t.process = nil
+	t.checked = time.Time{}
+	return err
+}
+
+// Extract sends a document to the server and returns its text, including
+// that of embedded documents such as attachments, and its metadata with
+// lowercased keys
+func (t *TikaServer) Extract(ctx context.Context, path string) (string, map[string]string, error) {
+	if err := t.ensure(ctx, true); err != nil {
+		return "", nil, fmt.Errorf("%w: %w", errTikaDown, err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.url+"/rmeta/text", file)
+	if err != nil {
+		return "", nil, err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Accept", "application/json")
+	// The name helps Tika tell formats sharing a container apart
+	req.Header.Set("Content-Disposition",
+		mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(path)}))
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		t.recheck()
+		return "", nil, fmt.Errorf("%w: %w", errTikaDown, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", nil, fmt.Errorf("tika server failed: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	var documents []map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&documents); err != nil {
+		return "", nil, fmt.Errorf("tika server returned invalid JSON: %w", err)
+	}
+	var text strings.Builder
+	metadata := make(map[string]string)
+	for i, document := range documents {
+		if content, ok := document["X-TIKA:content"].(string); ok {
+			text.WriteString(content)
+		}
+		if i > 0 {
+			continue
+		}
+		for key, value := range document {
+			if strings.HasPrefix(key, "X-TIKA:") {
+				continue
+			}
+			metadata[strings.ToLower(key)] = metadataValue(value)
+		}
+	}
+	if title := metadata["dc:title"]; title != "" && metadata["title"] == "" {
+		metadata["title"] = title
+	}
+	return text.String(), metadata, nil
+}
+
+// metadataValue joins the values of a metadata key Tika returns as a list
+func metadataValue(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			values = append(values, fmt.Sprint(v))
+		}
+		return strings.Join(values, ", ")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// tikaServer is the server documents are extracted with, if any
+var tikaServer atomic.Pointer[TikaServer]
+
+// SetTikaServer makes extraction use server in place of the tika command,
+// which remains the fallback when the server can't be reached; nil goes
+// back to the command
+func SetTikaServer(server *TikaServer) {
+	tikaServer.Store(server)
+}
+
+// TikaServerUsable reports whether a Tika server is set and answers or can
+// be started
+func TikaServerUsable(ctx context.Context) bool {
+	server := tikaServer.Load()
+	return server != nil && server.Usable(ctx)
+}
+
+// StartTikaServer makes sure the Tika server set is up, starting it if it
+// can be, so that the first documents extracted with it don't wait for it
+// within their extraction timeouts. It does nothing if no server is set.
+func StartTikaServer(ctx context.Context) error {
+	server := tikaServer.Load()
+	if server == nil {
+		return nil
+	}
+	return server.ensure(ctx, true)
+}
+
+// tikaAvailable reports whether documents can be extracted with Tika,
+// through the server or the command
+func tikaAvailable(ctx context.Context) bool {
+	return TikaServerUsable(ctx) || tools.Available("tika")
+}
+
+// extractWithTika extracts the text and metadata of a document with the
+// Tika server, or the tika command if there is no server or it is down
+func extractWithTika(ctx context.Context, path string) (string, map[string]string, string, error) {
+	if server := tikaServer.Load(); server != nil {
+		text, metadata, err := server.Extract(ctx, path)
+		if !errors.Is(err, errTikaDown) || !tools.Available("tika") || ctx.Err() != nil {
+			return text, metadata, "tika", err
+		}
+	}
+
+	cmd := tools.Command(ctx, "tika", "--text", "--encoding=UTF-8", path)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", nil, "", fmt.Errorf("tika failed: %w", err)
+	}
+	metadata, _ := extractTikaMetadata(ctx, path)
+	return string(out), metadata, "tika", nil
+}
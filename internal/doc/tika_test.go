@@ -0,0 +1,70 @@
+package doc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTikaServer(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/tika":
+			w.Write([]byte("This is Tika Server. Please PUT\n"))
+		case r.Method == http.MethodPut && r.URL.Path == "/rmeta/text":
+			requests++
+			body, _ := io.ReadAll(r.Body)
+			if !strings.Contains(r.Header.Get("Content-Disposition"), "report.docx") {
+				http.Error(w, "no file name", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[{"dc:title":"Quarterly report","dc:creator":["Ann","Bob"],"X-TIKA:content":"` +
+				string(body) + `\n"},{"X-TIKA:content":"attached notes\n","dc:title":"notes"}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "report.docx")
+	if err := os.WriteFile(path, []byte("Revenue grew"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", t.TempDir()) // No tika command to fall back to
+
+	SetTikaServer(NewTikaServer(server.URL + "/"))
+	defer SetTikaServer(nil)
+	for i := 0; i < 2; i++ {
+		result, err := ExtractText(context.Background(), path)
+		if err != nil || result.Error != nil {
+			t.Fatalf("ExtractText: %v, %v", err, result.Error)
+		}
+		if result.Extractor != "tika" || result.Text != "Revenue grew\nattached notes\n" || result.Title != "Quarterly report" {
+			t.Errorf("extracted %+v", result)
+		}
+		if result.Metadata["dc:creator"] != "Ann, Bob" {
+			t.Errorf("metadata = %v", result.Metadata)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("server got %d documents, want 2", requests)
+	}
+
+	// A server that isn't running and can't be started fails the document
+	// as unavailable rather than unreadable
+	down := NewTikaServer("http://127.0.0.1:1")
+	if down.Usable(context.Background()) {
+		t.Error("a server that isn't running is usable")
+	}
+	if _, _, err := down.Extract(context.Background(), path); !errors.Is(err, errTikaDown) {
+		t.Errorf("expected the server to be down, got %v", err)
+	}
+}
@@ -133,6 +133,36 @@ func getDriveInfoOSX(mountPoint string) (Drive, error) {
 	return drive, nil
 }
 
+// NameFromPath returns the name of the drive a path lives on, based on the
+// usual mount locations (/Volumes/NAME, /media/USER/NAME, /run/media/USER/NAME,
+// /mnt/NAME) or the drive letter on Windows. It returns "" when the path is
+// not on a recognised mount.
+func NameFromPath(path string) string {
+	if volume := filepath.VolumeName(path); volume != "" {
+		return strings.ToUpper(volume)
+	}
+
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	if len(segments) < 3 || segments[0] != "" {
+		return ""
+	}
+
+	switch segments[1] {
+	case "Volumes", "mnt":
+		return segments[2]
+	case "media":
+		if len(segments) > 3 {
+			return segments[3]
+		}
+	case "run":
+		if len(segments) > 4 && segments[2] == "media" {
+			return segments[4]
+		}
+	}
+
+	return ""
+}
+
 // Helper functions to determine the operating system
 func isOSX() bool {
 	return os.Getenv("TERM_PROGRAM") == "Apple_Terminal" ||
@@ -0,0 +1,190 @@
+package drives
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/tools"
+)
+
+// SMART attributes that count sectors going bad
+const (
+	attrReallocated   = 5   // Reallocated_Sector_Ct
+	attrPending       = 197 // Current_Pending_Sector
+	attrUncorrectable = 198 // Offline_Uncorrectable
+)
+
+// Health is the SMART status of the disk holding a drive, as smartctl
+// reports it
+type Health struct {
+	Device        string
+	Model         string
+	Serial        string
+	Passed        bool  // The disk's overall self-assessment
+	Reallocated   int64 // Sectors remapped to spares after failing
+	Pending       int64 // Unreadable sectors waiting to be remapped
+	Uncorrectable int64 // Sectors that failed offline tests, or NVMe media errors
+	PowerOnHours  int64
+	Temperature   int64 // Degrees Celsius
+	CheckedAt     time.Time
+}
+
+// Problems describes what is wrong with the disk, empty if nothing is
+func (h *Health) Problems() []string {
+	var problems []string
+	if !h.Passed {
+		problems = append(problems, "SMART self-assessment failed")
+	}
+	if h.Reallocated > 0 {
+		problems = append(problems, fmt.Sprintf("%d reallocated sector(s)", h.Reallocated))
+	}
+	if h.Pending > 0 {
+		problems = append(problems, fmt.Sprintf("%d pending sector(s)", h.Pending))
+	}
+	if h.Uncorrectable > 0 {
+		problems = append(problems, fmt.Sprintf("%d uncorrectable sector(s)", h.Uncorrectable))
+	}
+	return problems
+}
+
+// CheckHealth reads the SMART status of the disk holding path with
+// smartctl. Disks behind USB bridges that don't pass SMART through can't
+// be checked.
+func CheckHealth(ctx context.Context, path string) (*Health, error) {
+	if !tools.Available("smartctl") {
+		return nil, fmt.Errorf("smartctl not found in PATH, cannot check drive health: %w", tools.ErrNotInstalled)
+	}
+	device, err := DeviceFor(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// smartctl's exit status is a bit mask that is also set for failing
+	// disks, so its output is read whatever the status
+	output, err := exec.CommandContext(ctx, "smartctl", "--json", "-H", "-A", "-i", device).Output()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("failed to run smartctl: %w", err)
+	}
+	health, parseErr := parseSmartctl(output)
+	if parseErr != nil {
+		return nil, fmt.Errorf("cannot read SMART status of %s: %w", device, parseErr)
+	}
+	health.Device = device
+	health.CheckedAt = time.Now()
+	return health, nil
+}
+
+// DeviceFor returns the whole-disk device holding path, e.g. /dev/disk4
+// for a volume mounted from /dev/disk4s2
+func DeviceFor(ctx context.Context, path string) (string, error) {
+	output, err := exec.CommandContext(ctx, "df", "-P", path).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the device of %s: %w", path, err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) < 2 {
+		return "", fmt.Errorf("unexpected df output format")
+	}
+	device := strings.Fields(lines[len(lines)-1])[0]
+	if !strings.HasPrefix(device, "/dev/") {
+		return "", fmt.Errorf("%s is not on a local disk (%s)", path, device)
+	}
+	return wholeDisk(device), nil
+}
+
+// partition matches the partition suffix of a device name: s2 of disk4s2
+// (s1s1 of an APFS snapshot disk3s1s1), p1 of nvme0n1p1 and mmcblk0p1, 1 of
+// sdb1 and xvda1
+var partition = regexp.MustCompile(`^(disk\d+)(?:s\d+)+$|^(nvme\d+n\d+|mmcblk\d+|loop\d+)p\d+$|^((?:[hsv]|xv)d[a-z]+)\d+$`)
+
+// wholeDisk strips the partition from a device path
+func wholeDisk(device string) string {
+	match := partition.FindStringSubmatch(filepath.Base(device))
+	if match == nil {
+		return device
+	}
+	for _, disk := range match[1:] {
+		if disk != "" {
+			return filepath.Join(filepath.Dir(device), disk)
+		}
+	}
+	return device
+}
+
+// smartctlOutput is the part of smartctl's JSON output that is used
+type smartctlOutput struct {
+	Smartctl struct {
+		Messages []struct {
+			String   string `json:"string"`
+			Severity string `json:"severity"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	ATAAttributes struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value int64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeLog *struct {
+		MediaErrors int64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+	PowerOnTime struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	Temperature struct {
+		Current int64 `json:"current"`
+	} `json:"temperature"`
+}
+
+// parseSmartctl reads the output of smartctl --json -H -A -i
+func parseSmartctl(data []byte) (*Health, error) {
+	var output smartctlOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("unexpected smartctl output: %w", err)
+	}
+	if output.SmartStatus == nil {
+		for _, message := range output.Smartctl.Messages {
+			if message.Severity == "error" {
+				return nil, errors.New(message.String)
+			}
+		}
+		return nil, errors.New("SMART status not available")
+	}
+
+	health := &Health{
+		Model:        output.ModelName,
+		Serial:       output.SerialNumber,
+		Passed:       output.SmartStatus.Passed,
+		PowerOnHours: output.PowerOnTime.Hours,
+		Temperature:  output.Temperature.Current,
+	}
+	for _, attr := range output.ATAAttributes.Table {
+		switch attr.ID {
+		case attrReallocated:
+			health.Reallocated = attr.Raw.Value
+		case attrPending:
+			health.Pending = attr.Raw.Value
+		case attrUncorrectable:
+			health.Uncorrectable = attr.Raw.Value
+		}
+	}
+	if output.NVMeLog != nil {
+		health.Uncorrectable = output.NVMeLog.MediaErrors
+	}
+	return health, nil
+}
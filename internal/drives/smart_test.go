@@ -0,0 +1,58 @@
+package drives
+
+import "testing"
+
+func TestParseSmartctl(t *testing.T) {
+	health, err := parseSmartctl([]byte(`{
+		"model_name": "WDC WD10EZEX",
+		"serial_number": "WD-123",
+		"smart_status": {"passed": true},
+		"ata_smart_attributes": {"table": [
+			{"id": 5, "name": "Reallocated_Sector_Ct", "raw": {"value": 8}},
+			{"id": 197, "name": "Current_Pending_Sector", "raw": {"value": 2}},
+			{"id": 198, "name": "Offline_Uncorrectable", "raw": {"value": 0}}
+		]},
+		"power_on_time": {"hours": 41234},
+		"temperature": {"current": 38}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !health.Passed || health.Reallocated != 8 || health.Pending != 2 || health.PowerOnHours != 41234 {
+		t.Errorf("parsed %+v", health)
+	}
+	if problems := health.Problems(); len(problems) != 2 {
+		t.Errorf("Problems() = %q, want reallocated and pending sectors", problems)
+	}
+
+	_, err = parseSmartctl([]byte(`{"smartctl": {"messages": [
+		{"string": "/dev/disk4: Unknown USB bridge", "severity": "error"}
+	]}}`))
+	if err == nil || err.Error() != "/dev/disk4: Unknown USB bridge" {
+		t.Errorf("unsupported disk: err = %v", err)
+	}
+}
+
+func TestWholeDisk(t *testing.T) {
+	for device, want := range map[string]string{
+		"/dev/disk4s2":      "/dev/disk4",
+		"/dev/disk3s1s1":    "/dev/disk3",
+		"/dev/disk4":        "/dev/disk4",
+		"/dev/sdb1":         "/dev/sdb",
+		"/dev/sdaa12":       "/dev/sdaa",
+		"/dev/xvda1":        "/dev/xvda",
+		"/dev/nvme0n1p3":    "/dev/nvme0n1",
+		"/dev/nvme1n2p12":   "/dev/nvme1n2",
+		"/dev/nvme0n1":      "/dev/nvme0n1",
+		"/dev/mmcblk0p1":    "/dev/mmcblk0",
+		"/dev/mmcblk1p10":   "/dev/mmcblk1",
+		"/dev/mmcblk0":      "/dev/mmcblk0",
+		"/dev/loop0p1":      "/dev/loop0",
+		"/dev/sdc":          "/dev/sdc",
+		"/dev/mapper/crypt": "/dev/mapper/crypt",
+	} {
+		if got := wholeDisk(device); got != want {
+			t.Errorf("wholeDisk(%q) = %q, want %q", device, got, want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package dupes
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/image"
+)
+
+// Photo is a catalog photo with its perceptual fingerprint
+type Photo struct {
+	File  *db.FileStatus
+	Print *db.ImageHash
+}
+
+// pixels is the resolution of a photo
+func (p *Photo) pixels() int {
+	return p.Print.Width * p.Print.Height
+}
+
+// Burst is a set of near-identical photos, such as the shots of a burst or
+// edited copies of a photo
+type Burst struct {
+	Photos []*Photo // Best first
+}
+
+// Best is the photo worth keeping: the largest, then the sharpest
+func (b *Burst) Best() *Photo {
+	return b.Photos[0]
+}
+
+// Wasted is the space taken by the photos other than the best
+func (b *Burst) Wasted() int64 {
+	var wasted int64
+	for _, photo := range b.Photos[1:] {
+		wasted += photo.File.Size
+	}
+	return wasted
+}
+
+// BurstOptions configures GroupBursts
+type BurstOptions struct {
+	// MaxDistance is the most bits the perceptual hashes of two photos of a
+	// burst may differ by
+	MaxDistance int
+	// Window is how far apart in modification time photos are compared; 0
+	// compares every pair, which is slow on large libraries
+	Window time.Duration
+}
+
+// DefaultBurstOptions returns default burst grouping options
+func DefaultBurstOptions() BurstOptions {
+	return BurstOptions{
+		MaxDistance: 10,
+		Window:      time.Minute,
+	}
+}
+
+// GroupBursts groups photos whose perceptual hashes are within MaxDistance
+// of each other, directly or through other photos of the group, ordered by
+// wasted bytes, largest first
+func GroupBursts(photos []*Photo, opts BurstOptions) []*Burst {
+	sorted := append([]*Photo(nil), photos...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].File.ModTime.Before(sorted[j].File.ModTime)
+	})
+
+	parent := make([]int, len(sorted))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i, a := range sorted {
+		for j := i + 1; j < len(sorted); j++ {
+			b := sorted[j]
+			if opts.Window > 0 && b.File.ModTime.Sub(a.File.ModTime) > opts.Window {
+				break
+			}
+			if image.Distance(a.Print.Hash, b.Print.Hash) <= opts.MaxDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make(map[int]*Burst)
+	var bursts []*Burst
+	for i, photo := range sorted {
+		root := find(i)
+		burst, ok := groups[root]
+		if !ok {
+			burst = &Burst{}
+			groups[root] = burst
+			bursts = append(bursts, burst)
+		}
+		burst.Photos = append(burst.Photos, photo)
+	}
+
+	kept := bursts[:0]
+	for _, burst := range bursts {
+		if len(burst.Photos) < 2 {
+			continue
+		}
+		sort.SliceStable(burst.Photos, func(i, j int) bool {
+			return betterPhoto(burst.Photos[i], burst.Photos[j])
+		})
+		kept = append(kept, burst)
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Wasted() > kept[j].Wasted()
+	})
+	return kept
+}
+
+// betterPhoto reports whether a is a better photo to keep than b: larger,
+// then sharper, then a bigger file, then the one uploaded
+func betterPhoto(a, b *Photo) bool {
+	if pa, pb := a.pixels(), b.pixels(); pa != pb {
+		return pa > pb
+	}
+	if a.Print.Sharpness != b.Print.Sharpness {
+		return a.Print.Sharpness > b.Print.Sharpness
+	}
+	if a.File.Size != b.File.Size {
+		return a.File.Size > b.File.Size
+	}
+	return a.File.UploadedURL != "" && b.File.UploadedURL == ""
+}
+
+// BestOf maps each photo of the bursts to the file ID of its burst's best
+// photo, as recorded by db.SetBursts
+func BestOf(bursts []*Burst) map[int64]int64 {
+	best := make(map[int64]int64)
+	for _, burst := range bursts {
+		for _, photo := range burst.Photos {
+			best[photo.File.ID] = burst.Best().File.ID
+		}
+	}
+	return best
+}
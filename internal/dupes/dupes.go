@@ -0,0 +1,193 @@
+package dupes
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+// Cluster is a set of catalog files with the same content
+type Cluster struct {
+	SHA256 string
+	Size   int64
+	Files  []*db.FileStatus
+	Keep   *db.FileStatus // The copy to keep; nil when no copy is on disk
+}
+
+// Wasted is the space taken by all copies but one
+func (c *Cluster) Wasted() int64 {
+	return c.Size * int64(len(c.Files)-1)
+}
+
+// Extra returns the local copies other than the one kept
+func (c *Cluster) Extra() []*db.FileStatus {
+	var extra []*db.FileStatus
+	for _, file := range c.Files {
+		if file != c.Keep && Local(file) {
+			extra = append(extra, file)
+		}
+	}
+	return extra
+}
+
+// Local reports whether a catalog entry is a file on disk, rather than an
+// object adopted from a bucket
+func Local(file *db.FileStatus) bool {
+	return filepath.IsAbs(file.Path)
+}
+
+// Group clusters files by SHA-256, ordered by wasted bytes, largest first.
+// Files are expected ordered by hash, as returned by db.FindDuplicates. In
+// each cluster the copy to keep is the first local one under a prefer
+// prefix, then one that has been uploaded, then the oldest.
+func Group(files []*db.FileStatus, prefer []string) []*Cluster {
+	var clusters []*Cluster
+	var current *Cluster
+	for _, file := range files {
+		if current == nil || file.SHA256 != current.SHA256 {
+			current = &Cluster{SHA256: file.SHA256, Size: file.Size}
+			clusters = append(clusters, current)
+		}
+		current.Files = append(current.Files, file)
+	}
+
+	kept := clusters[:0]
+	for _, cluster := range clusters {
+		if len(cluster.Files) < 2 {
+			continue
+		}
+		cluster.Keep = choose(cluster.Files, prefer)
+		kept = append(kept, cluster)
+	}
+
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Wasted() > kept[j].Wasted()
+	})
+	return kept
+}
+
+// choose picks the copy to keep among files with the same content
+func choose(files []*db.FileStatus, prefer []string) *db.FileStatus {
+	rank := func(file *db.FileStatus) int {
+		for i, prefix := range prefer {
+			if strings.HasPrefix(file.Path, prefix) {
+				return i
+			}
+		}
+		return len(prefer)
+	}
+
+	var best *db.FileStatus
+	for _, file := range files {
+		if !Local(file) {
+			continue
+		}
+		if best == nil || better(file, best, rank) {
+			best = file
+		}
+	}
+	return best
+}
+
+// better reports whether a is a better copy to keep than b
+func better(a, b *db.FileStatus, rank func(*db.FileStatus) int) bool {
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra < rb
+	}
+	if ua, ub := a.UploadedURL != "", b.UploadedURL != ""; ua != ub {
+		return ua
+	}
+	if !a.ModTime.Equal(b.ModTime) {
+		return a.ModTime.Before(b.ModTime)
+	}
+	return len(a.Path) < len(b.Path)
+}
+
+// Action is what a script does with the extra copies
+type Action string
+
+// Script actions
+const (
+	ActionDelete Action = "delete"
+	ActionStub   Action = "stub"
+)
+
+// ScriptOptions configures WriteScript
+type ScriptOptions struct {
+	Action   Action
+	StubMode db.StubMode // For ActionStub
+
+	// Catalog and search index the removed copies are deleted from
+	DBPath   string
+	IndexDir string
+}
+
+// WriteScript writes a shell script that keeps one copy of each cluster and
+// deletes the others or replaces them with stubs pointing to the copy kept:
+// its upload if there is one, or the file itself. Removed copies are then
+// marked deleted in the catalog. Nothing is run; the script is for review.
+func WriteScript(w io.Writer, clusters []*Cluster, opts ScriptOptions) error {
+	fmt.Fprintln(w, "#!/bin/sh")
+	fmt.Fprintf(w, "# Generated by archiver dupes: %s duplicate copies\n", opts.Action)
+	fmt.Fprintln(w, "set -e")
+
+	for _, cluster := range clusters {
+		extra := cluster.Extra()
+		if cluster.Keep == nil || len(extra) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n# %d copies of %s (sha256 %s), keeping %s\n",
+			len(cluster.Files), formatSize(cluster.Size), cluster.SHA256, cluster.Keep.Path)
+		target := cluster.Keep.UploadedURL
+		if target == "" {
+			target = "file://" + filepath.ToSlash(cluster.Keep.Path)
+		}
+
+		for _, file := range extra {
+			switch opts.Action {
+			case ActionDelete:
+				fmt.Fprintf(w, "rm -- %s\n", quote(file.Path))
+			case ActionStub:
+				content, err := db.StubContent(target, opts.StubMode)
+				if err != nil {
+					return err
+				}
+				ext := ".webloc"
+				if opts.StubMode == db.StubModeShortcut {
+					ext = ".url"
+				}
+				fmt.Fprintf(w, "printf '%%s' %s > %s\n", quote(string(content)), quote(file.Path+ext))
+				fmt.Fprintf(w, "rm -- %s\n", quote(file.Path))
+			default:
+				return fmt.Errorf("unknown action %q (expected delete or stub)", opts.Action)
+			}
+			fmt.Fprintf(w, "archiver delete --db %s --index-dir %s --reason %s -- %s\n",
+				quote(opts.DBPath), quote(opts.IndexDir), quote("duplicate of "+cluster.Keep.Path), quote(file.Path))
+		}
+	}
+	return nil
+}
+
+// quote quotes a string for the shell
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// formatSize formats a byte count in binary units
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,118 @@
+package dupes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+func TestGroup(t *testing.T) {
+	old := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := old.AddDate(5, 0, 0)
+	files := []*db.FileStatus{
+		{Path: "/Volumes/A/big.mov", SHA256: "aaa", Size: 1000, ModTime: recent},
+		{Path: "/Volumes/B/big.mov", SHA256: "aaa", Size: 1000, ModTime: old},
+		{Path: "/Volumes/A/small.jpg", SHA256: "bbb", Size: 10, ModTime: recent},
+		{Path: "/Volumes/B/small.jpg", SHA256: "bbb", Size: 10, ModTime: old},
+		{Path: "/Volumes/C/small.jpg", SHA256: "bbb", Size: 10, ModTime: recent, UploadedURL: "https://f000.example/file/b/small.jpg"},
+		{Path: "b2://archive/small.jpg", SHA256: "bbb", Size: 10, ModTime: old},
+		{Path: "/Volumes/A/single.txt", SHA256: "ccc", Size: 5},
+	}
+
+	clusters := Group(files, nil)
+	if len(clusters) != 2 {
+		t.Fatalf("got %d clusters, want 2", len(clusters))
+	}
+	if clusters[0].SHA256 != "aaa" || clusters[0].Wasted() != 1000 {
+		t.Errorf("first cluster should waste the most, got %s wasting %d", clusters[0].SHA256, clusters[0].Wasted())
+	}
+	if got := clusters[0].Keep.Path; got != "/Volumes/B/big.mov" {
+		t.Errorf("should keep the oldest copy, kept %s", got)
+	}
+	if got := clusters[1].Keep.Path; got != "/Volumes/C/small.jpg" {
+		t.Errorf("should keep the uploaded copy, kept %s", got)
+	}
+	if n := len(clusters[1].Extra()); n != 2 {
+		t.Errorf("adopted remote entries are never extra copies, got %d extra", n)
+	}
+
+	clusters = Group(files, []string{"/Volumes/A/"})
+	for _, cluster := range clusters {
+		if !strings.HasPrefix(cluster.Keep.Path, "/Volumes/A/") {
+			t.Errorf("should prefer /Volumes/A/, kept %s", cluster.Keep.Path)
+		}
+	}
+}
+
+func TestWriteScript(t *testing.T) {
+	clusters := Group([]*db.FileStatus{
+		{Path: "/a/it's.pdf", SHA256: "aaa", Size: 10, UploadedURL: "https://f000.example/file/b/its.pdf"},
+		{Path: "/b/it's.pdf", SHA256: "aaa", Size: 10},
+	}, nil)
+
+	var script strings.Builder
+	err := WriteScript(&script, clusters, ScriptOptions{Action: ActionDelete, DBPath: "/data/archive.db", IndexDir: "/data/index"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`rm -- '/b/it'\''s.pdf'`,
+		`archiver delete --db '/data/archive.db' --index-dir '/data/index' --reason 'duplicate of /a/it'\''s.pdf' -- '/b/it'\''s.pdf'`,
+	} {
+		if !strings.Contains(script.String(), want) {
+			t.Errorf("script missing %q:\n%s", want, script.String())
+		}
+	}
+	if strings.Contains(script.String(), "rm -- '/a/") {
+		t.Error("the kept copy must not be removed")
+	}
+
+	script.Reset()
+	err = WriteScript(&script, clusters, ScriptOptions{Action: ActionStub, StubMode: db.StubModeShortcut})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script.String(), "URL=https://f000.example/file/b/its.pdf") ||
+		!strings.Contains(script.String(), `> '/b/it'\''s.pdf.url'`) {
+		t.Errorf("stub script should write a stub pointing to the upload:\n%s", script.String())
+	}
+}
+
+func TestGroupBursts(t *testing.T) {
+	start := time.Date(2019, 8, 3, 18, 30, 0, 0, time.UTC)
+	photo := func(id int64, seconds int, hash uint64, sharpness float64) *Photo {
+		return &Photo{
+			File:  &db.FileStatus{ID: id, Path: "/photos/" + string(rune('a'+id)) + ".jpg", Size: 1000, ModTime: start.Add(time.Duration(seconds) * time.Second)},
+			Print: &db.ImageHash{FileID: id, Hash: hash, Width: 4032, Height: 3024, Sharpness: sharpness},
+		}
+	}
+	photos := []*Photo{
+		photo(1, 0, 0xF0F0F0F0F0F0F0F0, 80),
+		photo(2, 1, 0xF0F0F0F0F0F0F0F1, 120), // Sharpest shot of the burst
+		photo(3, 2, 0xF0F0F0F0F0F0F0F3, 95),
+		photo(4, 3, 0x0F0F0F0F0F0F0F0F, 100),  // Another subject
+		photo(5, 600, 0xF0F0F0F0F0F0F0F0, 90), // Same scene, outside the window
+	}
+
+	bursts := GroupBursts(photos, DefaultBurstOptions())
+	if len(bursts) != 1 {
+		t.Fatalf("got %d bursts, want 1", len(bursts))
+	}
+	if n := len(bursts[0].Photos); n != 3 {
+		t.Errorf("burst has %d photos, want 3", n)
+	}
+	if got := bursts[0].Best().File.ID; got != 2 {
+		t.Errorf("best photo is %d, want the sharpest, 2", got)
+	}
+	if best := BestOf(bursts); best[1] != 2 || best[2] != 2 || best[3] != 2 || len(best) != 3 {
+		t.Errorf("BestOf = %v", best)
+	}
+
+	options := DefaultBurstOptions()
+	options.Window = 0
+	if bursts := GroupBursts(photos, options); len(bursts) != 1 || len(bursts[0].Photos) != 4 {
+		t.Errorf("without a window the later copy should join the burst")
+	}
+}
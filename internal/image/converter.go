@@ -7,6 +7,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/jth/archiver/internal/scratch"
+	"github.com/jth/archiver/internal/tools"
 )
 
 // ConvertOptions contains options for image conversion
@@ -21,6 +24,7 @@ type ConvertOptions struct {
 type ConvertResult struct {
 	InputPath  string
 	OutputPath string
+	Tool       string
 	SizeBytes  int64
 	Error      error
 }
@@ -44,13 +48,22 @@ func Convert(ctx context.Context, options ConvertOptions) (*ConvertResult, error
 		return nil, fmt.Errorf("source file does not exist: %s", options.SourcePath)
 	}
 
-	// Generate output path if not provided
-	if options.OutputPath == "" {
-		dir := filepath.Dir(options.SourcePath)
+	// Write to the scratch folder if no output path is provided. A JPEG
+	// can take twice the space of the HEIC it was converted from.
+	inScratch := options.OutputPath == ""
+	if inScratch {
+		info, err := os.Stat(options.SourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat source file: %w", err)
+		}
 		filename := filepath.Base(options.SourcePath)
-		ext := filepath.Ext(filename)
-		basename := strings.TrimSuffix(filename, ext)
-		options.OutputPath = filepath.Join(dir, basename+"."+options.OutputFormat)
+		basename := strings.TrimSuffix(filename, filepath.Ext(filename))
+		output, err := scratch.Create(basename+"-*."+options.OutputFormat, 2*info.Size())
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %s: %w", options.SourcePath, err)
+		}
+		output.Close()
+		options.OutputPath = output.Name()
 	}
 
 	// Create output directory if it doesn't exist
@@ -61,12 +74,14 @@ func Convert(ctx context.Context, options ConvertOptions) (*ConvertResult, error
 
 	// Determine conversion tool and arguments based on input format
 	var cmd *exec.Cmd
+	var tool string
 
 	ext := strings.ToLower(filepath.Ext(options.SourcePath))
 	if ext == ".heic" || ext == ".heif" {
 		// Use sips for HEIC conversion on macOS
-		if _, err := exec.LookPath("sips"); err == nil {
-			cmd = exec.CommandContext(ctx, "sips",
+		if _, err := tools.LookPath("sips"); err == nil {
+			tool = "sips"
+			cmd = tools.Command(ctx, tool,
 				"-s", "format", options.OutputFormat,
 				"-s", "formatOptions", fmt.Sprintf("normal %d", options.Quality),
 				options.SourcePath,
@@ -74,30 +89,33 @@ func Convert(ctx context.Context, options ConvertOptions) (*ConvertResult, error
 			)
 		} else {
 			// Fallback to ImageMagick if available
-			if _, err := exec.LookPath("convert"); err == nil {
-				cmd = exec.CommandContext(ctx, "convert",
+			if _, err := tools.LookPath("convert"); err == nil {
+				tool = "convert"
+				cmd = tools.Command(ctx, tool,
 					options.SourcePath,
 					"-quality", fmt.Sprintf("%d", options.Quality),
 					options.OutputPath,
 				)
 			} else {
-				return nil, fmt.Errorf("no suitable conversion tool found for HEIC format")
+				return nil, fmt.Errorf("no suitable conversion tool found for HEIC format: %w", tools.ErrNotInstalled)
 			}
 		}
 	} else if ext == ".avif" {
 		// Check for ImageMagick
-		if _, err := exec.LookPath("convert"); err == nil {
-			cmd = exec.CommandContext(ctx, "convert",
+		if _, err := tools.LookPath("convert"); err == nil {
+			tool = "convert"
+			cmd = tools.Command(ctx, tool,
 				options.SourcePath,
 				"-quality", fmt.Sprintf("%d", options.Quality),
 				options.OutputPath,
 			)
 		} else {
-			return nil, fmt.Errorf("no suitable conversion tool found for AVIF format")
+			return nil, fmt.Errorf("no suitable conversion tool found for AVIF format: %w", tools.ErrNotInstalled)
 		}
 	} else {
 		// Use ffmpeg for all other formats as it's more widely available
-		cmd = exec.CommandContext(ctx, "ffmpeg",
+		tool = "ffmpeg"
+		cmd = tools.Command(ctx, tool,
 			"-y",
 			"-i", options.SourcePath,
 			"-q:v", fmt.Sprintf("%d", 100-options.Quality), // ffmpeg quality is inverse (1-31)
@@ -108,6 +126,9 @@ func Convert(ctx context.Context, options ConvertOptions) (*ConvertResult, error
 	// Run the conversion command
 	output, err := cmd.CombinedOutput()
 	if err != nil {
+		if inScratch {
+			scratch.Remove(options.OutputPath)
+		}
 		return &ConvertResult{
 			InputPath:  options.SourcePath,
 			OutputPath: options.OutputPath,
@@ -128,6 +149,7 @@ func Convert(ctx context.Context, options ConvertOptions) (*ConvertResult, error
 	return &ConvertResult{
 		InputPath:  options.SourcePath,
 		OutputPath: options.OutputPath,
+		Tool:       tool,
 		SizeBytes:  fileInfo.Size(),
 	}, nil
 }
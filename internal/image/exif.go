@@ -0,0 +1,357 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/tools"
+)
+
+// ErrNoDate is returned by DateTaken for photos without a recorded date
+var ErrNoDate = errors.New("no EXIF DateTimeOriginal")
+
+// exifLayout is the format of EXIF dates
+const exifLayout = "2006:01:02 15:04:05"
+
+// DateTaken returns the EXIF DateTimeOriginal of a photo, the camera's
+// local time when it was taken, as a time in UTC with the same clock
+// reading. JPEG and TIFF-based raw files (DNG, CR2, NEF, ARW...) are read
+// directly; other formats such as HEIC need exiftool.
+func DateTaken(ctx context.Context, path string) (time.Time, error) {
+	exif, err := ReadEXIF(path)
+	if errors.Is(err, errUnsupported) {
+		return exiftoolDate(ctx, path)
+	}
+	if errors.Is(err, ErrNoEXIF) {
+		return time.Time{}, ErrNoDate
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if exif.Taken.IsZero() {
+		return time.Time{}, ErrNoDate
+	}
+	return exif.Taken, nil
+}
+
+// ErrNoEXIF is returned by ReadEXIF for files without EXIF data, or in a
+// format it can't read
+var ErrNoEXIF = errors.New("no EXIF data")
+
+// errUnsupported is wrapped in ErrNoEXIF for formats ReadEXIF can't read
+var errUnsupported = fmt.Errorf("%w in a format that can be read directly", ErrNoEXIF)
+
+// EXIF is the camera metadata of a photo. Fields not recorded are left
+// zero.
+type EXIF struct {
+	Make         string
+	Model        string
+	Lens         string
+	Taken        time.Time // As DateTaken returns it
+	Orientation  int
+	ISO          int
+	ExposureTime string  // e.g. "1/250" or "2"
+	FNumber      float64 // e.g. 2.8
+	FocalLength  float64 // In millimetres
+	Width        int
+	Height       int
+}
+
+// Camera returns the make and model, without the make repeated when the
+// model already starts with it
+func (e *EXIF) Camera() string {
+	if e.Make == "" || strings.HasPrefix(strings.ToLower(e.Model), strings.ToLower(strings.Fields(e.Make)[0])) {
+		return e.Model
+	}
+	return strings.TrimSpace(e.Make + " " + e.Model)
+}
+
+// EXIF tags read by ReadEXIF
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagExifIFD          = 0x8769
+	tagExposureTime     = 0x829A
+	tagFNumber          = 0x829D
+	tagISO              = 0x8827
+	tagDateTimeOriginal = 0x9003
+	tagFocalLength      = 0x920A
+	tagPixelXDimension  = 0xA002
+	tagPixelYDimension  = 0xA003
+	tagLensModel        = 0xA434
+)
+
+// ReadEXIF reads the EXIF metadata of a JPEG, of a TIFF-based raw file
+// (DNG, CR2, NEF, ARW, ORF, RW2...) or of the preview embedded in a Fuji
+// RAF file
+func ReadEXIF(path string) (*EXIF, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var magic [8]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return nil, ErrNoEXIF
+	}
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		return jpegEXIF(f)
+	case string(magic[:2]) == "II" || string(magic[:2]) == "MM":
+		return tiffEXIF(io.NewSectionReader(f, 0, info.Size()))
+	case string(magic[:]) == "FUJIFILM":
+		preview, err := rafPreview(f)
+		if err != nil {
+			return nil, ErrNoEXIF
+		}
+		return jpegEXIF(bytes.NewReader(preview))
+	}
+	return nil, errUnsupported
+}
+
+// jpegEXIF reads the EXIF segment of a JPEG
+func jpegEXIF(r io.ReadSeeker) (*EXIF, error) {
+	if _, err := r.Seek(2, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var header [4]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, ErrNoEXIF
+		}
+		if header[0] != 0xFF {
+			return nil, ErrNoEXIF
+		}
+		marker := header[1]
+		length := int64(binary.BigEndian.Uint16(header[2:])) - 2
+		// Start of scan: the metadata segments are all before it
+		if marker == 0xDA || length < 0 {
+			return nil, ErrNoEXIF
+		}
+		if marker != 0xE1 {
+			if _, err := r.Seek(length, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, ErrNoEXIF
+		}
+		if tiff, ok := bytes.CutPrefix(segment, []byte("Exif\x00\x00")); ok {
+			return tiffEXIF(bytes.NewReader(tiff))
+		}
+	}
+}
+
+// tiffEXIF reads the EXIF metadata of a TIFF structure: the camera and
+// orientation from its first IFD and the rest from the EXIF IFD
+func tiffEXIF(r io.ReaderAt) (*EXIF, error) {
+	t, first, err := newTIFF(r)
+	if err != nil {
+		return nil, ErrNoEXIF
+	}
+	ifd0, _, err := t.ifd(first)
+	if err != nil {
+		return nil, ErrNoEXIF
+	}
+
+	exif := &EXIF{
+		Make:        t.text(ifd0[tagMake]),
+		Model:       t.text(ifd0[tagModel]),
+		Orientation: int(t.number(ifd0[tagOrientation])),
+	}
+	entry, ok := ifd0[tagExifIFD]
+	if !ok {
+		return exif, nil
+	}
+	sub, _, err := t.ifd(int64(t.number(entry)))
+	if err != nil {
+		return exif, nil
+	}
+
+	exif.Lens = t.text(sub[tagLensModel])
+	exif.ISO = int(t.number(sub[tagISO]))
+	exif.Width = int(t.number(sub[tagPixelXDimension]))
+	exif.Height = int(t.number(sub[tagPixelYDimension]))
+	if num, den := t.rational(sub[tagExposureTime]); den != 0 {
+		if num >= den {
+			exif.ExposureTime = strconv.FormatFloat(float64(num)/float64(den), 'f', -1, 64)
+		} else {
+			exif.ExposureTime = fmt.Sprintf("1/%d", (den+num/2)/num)
+		}
+	}
+	if num, den := t.rational(sub[tagFNumber]); den != 0 {
+		exif.FNumber = float64(num) / float64(den)
+	}
+	if num, den := t.rational(sub[tagFocalLength]); den != 0 {
+		exif.FocalLength = float64(num) / float64(den)
+	}
+	if taken, err := parseExifDate(t.text(sub[tagDateTimeOriginal])); err == nil {
+		exif.Taken = taken
+	}
+	return exif, nil
+}
+
+// tiffReader reads the IFDs of a TIFF structure
+type tiffReader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+}
+
+// ifdEntry is a 12-byte IFD entry: tag, type, count and the value or its
+// offset
+type ifdEntry []byte
+
+// typeSizes are the sizes of the TIFF field types by type number
+var typeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 13: 4}
+
+// newTIFF reads the header of a TIFF structure and returns the offset of
+// its first IFD. Raw formats with their own magic number, such as ORF and
+// RW2, have the same layout.
+func newTIFF(r io.ReaderAt) (*tiffReader, int64, error) {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, 0, err
+	}
+	t := &tiffReader{r: r}
+	switch string(header[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, 0, errors.New("not a TIFF structure")
+	}
+	return t, int64(t.order.Uint32(header[4:])), nil
+}
+
+// ifd returns the entries of the IFD at offset by tag, and the offset of
+// the next IFD, 0 if it is the last
+func (t *tiffReader) ifd(offset int64) (map[uint16]ifdEntry, int64, error) {
+	var count [2]byte
+	if _, err := t.r.ReadAt(count[:], offset); err != nil {
+		return nil, 0, err
+	}
+	n := int64(t.order.Uint16(count[:]))
+	data := make([]byte, 12*n+4)
+	if _, err := t.r.ReadAt(data, offset+2); err != nil {
+		return nil, 0, err
+	}
+
+	entries := make(map[uint16]ifdEntry, n)
+	for i := int64(0); i < n; i++ {
+		entry := ifdEntry(data[12*i : 12*i+12])
+		entries[t.order.Uint16(entry)] = entry
+	}
+	return entries, int64(t.order.Uint32(data[12*n:])), nil
+}
+
+// value returns the bytes of an entry's value, stored in the entry when
+// they fit in 4 bytes and at an offset otherwise
+func (t *tiffReader) value(entry ifdEntry) []byte {
+	if entry == nil {
+		return nil
+	}
+	size := typeSizes[t.order.Uint16(entry[2:])] * t.order.Uint32(entry[4:])
+	if size <= 4 {
+		return entry[8 : 8+size]
+	}
+	if size > 1<<20 {
+		return nil
+	}
+	value := make([]byte, size)
+	if _, err := t.r.ReadAt(value, int64(t.order.Uint32(entry[8:]))); err != nil {
+		return nil
+	}
+	return value
+}
+
+// numbers returns the values of a BYTE, SHORT, LONG or IFD entry
+func (t *tiffReader) numbers(entry ifdEntry) []uint32 {
+	value := t.value(entry)
+	if value == nil {
+		return nil
+	}
+	var numbers []uint32
+	switch t.order.Uint16(entry[2:]) {
+	case 1:
+		for _, b := range value {
+			numbers = append(numbers, uint32(b))
+		}
+	case 3:
+		for i := 0; i+2 <= len(value); i += 2 {
+			numbers = append(numbers, uint32(t.order.Uint16(value[i:])))
+		}
+	case 4, 13:
+		for i := 0; i+4 <= len(value); i += 4 {
+			numbers = append(numbers, t.order.Uint32(value[i:]))
+		}
+	}
+	return numbers
+}
+
+// number returns the first value of an entry, or 0
+func (t *tiffReader) number(entry ifdEntry) uint32 {
+	if numbers := t.numbers(entry); len(numbers) > 0 {
+		return numbers[0]
+	}
+	return 0
+}
+
+// text returns the value of an ASCII entry
+func (t *tiffReader) text(entry ifdEntry) string {
+	return strings.TrimSpace(strings.TrimRight(string(t.value(entry)), "\x00"))
+}
+
+// rational returns the numerator and denominator of a RATIONAL entry
+func (t *tiffReader) rational(entry ifdEntry) (uint32, uint32) {
+	value := t.value(entry)
+	if len(value) < 8 {
+		return 0, 0
+	}
+	return t.order.Uint32(value), t.order.Uint32(value[4:])
+}
+
+// exiftoolDate reads the date with exiftool, for formats read through it
+func exiftoolDate(ctx context.Context, path string) (time.Time, error) {
+	exiftool, err := tools.LookPath("exiftool")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reading the date of %s needs exiftool: %w", filepath.Ext(path), tools.ErrNotInstalled)
+	}
+	out, err := exec.CommandContext(ctx, exiftool, "-s3", "-DateTimeOriginal", path).Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("exiftool failed: %w", err)
+	}
+	return parseExifDate(string(out))
+}
+
+// parseExifDate parses an EXIF date, treating blank dates as missing
+func parseExifDate(value string) (time.Time, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "\x00")
+	if len(value) < len(exifLayout) || strings.HasPrefix(value, "0000") || strings.TrimSpace(value) == "" {
+		return time.Time{}, ErrNoDate
+	}
+	taken, err := time.Parse(exifLayout, value[:len(exifLayout)])
+	if err != nil {
+		return time.Time{}, ErrNoDate
+	}
+	return taken, nil
+}
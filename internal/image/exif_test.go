@@ -0,0 +1,65 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// exifTIFF builds a little-endian TIFF structure with an EXIF IFD holding
+// DateTimeOriginal
+func exifTIFF(date string) []byte {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	b.WriteString("II*\x00")
+	binary.Write(&b, le, uint32(8))
+	// IFD0 at 8: one entry pointing to the EXIF IFD at 26
+	binary.Write(&b, le, uint16(1))
+	binary.Write(&b, le, []uint16{tagExifIFD, 4})
+	binary.Write(&b, le, []uint32{1, 26})
+	binary.Write(&b, le, uint32(0))
+	// EXIF IFD at 26: DateTimeOriginal stored at 44
+	binary.Write(&b, le, uint16(1))
+	binary.Write(&b, le, []uint16{tagDateTimeOriginal, 2})
+	binary.Write(&b, le, []uint32{20, 44})
+	binary.Write(&b, le, uint32(0))
+	b.WriteString(date + "\x00")
+	return b.Bytes()
+}
+
+func TestDateTaken(t *testing.T) {
+	dir := t.TempDir()
+	want := time.Date(2016, 7, 4, 12, 34, 56, 0, time.UTC)
+
+	tiff := exifTIFF("2016:07:04 12:34:56")
+	var jpeg bytes.Buffer
+	jpeg.Write([]byte{0xFF, 0xD8})
+	jpeg.Write([]byte{0xFF, 0xE0, 0x00, 0x04, 'J', 'F'}) // APP0 to skip
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	jpeg.Write([]byte{0xFF, 0xE1})
+	binary.Write(&jpeg, binary.BigEndian, uint16(len(app1)+2))
+	jpeg.Write(app1)
+	jpeg.Write([]byte{0xFF, 0xDA, 0x00, 0x02})
+
+	for name, content := range map[string][]byte{"photo.jpg": jpeg.Bytes(), "photo.dng": tiff} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := DateTaken(context.Background(), path)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("%s: got %v (%v), want %v", name, got, err, want)
+		}
+	}
+
+	blank := filepath.Join(dir, "blank.dng")
+	os.WriteFile(blank, exifTIFF("0000:00:00 00:00:00"), 0644)
+	if _, err := DateTaken(context.Background(), blank); !errors.Is(err, ErrNoDate) {
+		t.Errorf("a blank date should be ErrNoDate, got %v", err)
+	}
+}
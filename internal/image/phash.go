@@ -0,0 +1,163 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	goimage "image"
+	_ "image/jpeg" // Decoders for image.Decode
+	_ "image/png"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Fingerprint is a perceptual hash of a photo, which near-identical photos
+// such as the shots of a burst share, and what its quality is judged by
+type Fingerprint struct {
+	Hash      uint64 // dHash of the brightness gradients
+	Width     int
+	Height    int
+	Sharpness float64 // Variance of the Laplacian of a scaled-down copy
+}
+
+// sharpnessSize is the longest side of the copy sharpness is measured on,
+// so that it compares across resolutions
+const sharpnessSize = 512
+
+// previewFormatSize is the longest side of the previews made of formats Go
+// can't decode, such as HEIC and raw files
+const previewFormatSize = 1024
+
+// PerceptualHash fingerprints a photo. JPEG and PNG files and the previews
+// embedded in raw files are decoded directly; other formats are scaled down
+// by Preview first, so their size is that of the preview.
+func PerceptualHash(ctx context.Context, path string) (*Fingerprint, error) {
+	if IsRaw(path) {
+		if embedded, err := RawPreview(path); err == nil {
+			img, _, err := goimage.Decode(bytes.NewReader(embedded))
+			if err == nil {
+				return fingerprint(img), nil
+			}
+		}
+	}
+
+	var img goimage.Image
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if img, _, err = goimage.Decode(f); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+	default:
+		preview, err := Preview(ctx, path, previewFormatSize)
+		if err != nil {
+			return nil, err
+		}
+		if img, _, err = goimage.Decode(bytes.NewReader(preview)); err != nil {
+			return nil, fmt.Errorf("failed to decode the preview of %s: %w", path, err)
+		}
+	}
+	return fingerprint(img), nil
+}
+
+// fingerprint hashes and measures a decoded image
+func fingerprint(img goimage.Image) *Fingerprint {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	sw, sh := w, h
+	if longest := max(w, h); longest > sharpnessSize {
+		sw, sh = max(1, w*sharpnessSize/longest), max(1, h*sharpnessSize/longest)
+	}
+	return &Fingerprint{
+		Hash:      dHash(grayscale(img, 9, 8)),
+		Width:     w,
+		Height:    h,
+		Sharpness: sharpness(grayscale(img, sw, sh)),
+	}
+}
+
+// Distance is the number of bits two perceptual hashes differ by, from 0
+// for the same picture to 64
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// grayscale scales an image to width×height brightness levels from 0 to
+// 255, averaging the pixels that fall in each cell
+func grayscale(img goimage.Image, width, height int) [][]float64 {
+	bounds := img.Bounds()
+	sums := make([][]float64, height)
+	counts := make([][]int, height)
+	for i := range sums {
+		sums[i] = make([]float64, width)
+		counts[i] = make([]int, width)
+	}
+
+	ycbcr, _ := img.(*goimage.YCbCr)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := (y - bounds.Min.Y) * height / bounds.Dy()
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			col := (x - bounds.Min.X) * width / bounds.Dx()
+			var level float64
+			if ycbcr != nil {
+				// JPEGs carry the brightness as is
+				level = float64(ycbcr.Y[ycbcr.YOffset(x, y)])
+			} else {
+				r, g, b, _ := img.At(x, y).RGBA()
+				level = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+			}
+			sums[row][col] += level
+			counts[row][col]++
+		}
+	}
+
+	for i := range sums {
+		for j := range sums[i] {
+			if counts[i][j] > 0 {
+				sums[i][j] /= float64(counts[i][j])
+			}
+		}
+	}
+	return sums
+}
+
+// dHash sets a bit for each cell of a 9×8 grid brighter than the cell to
+// its right
+func dHash(gray [][]float64) uint64 {
+	var hash uint64
+	for _, row := range gray {
+		for x := 0; x+1 < len(row); x++ {
+			hash <<= 1
+			if row[x] > row[x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// sharpness is the variance of the Laplacian of the brightness: blurred
+// photos have weak edges and score low
+func sharpness(gray [][]float64) float64 {
+	var sum, sumSquares float64
+	var n int
+	for y := 1; y+1 < len(gray); y++ {
+		for x := 1; x+1 < len(gray[y]); x++ {
+			laplacian := gray[y-1][x] + gray[y+1][x] + gray[y][x-1] + gray[y][x+1] - 4*gray[y][x]
+			sum += laplacian
+			sumSquares += laplacian * laplacian
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	mean := sum / float64(n)
+	return sumSquares/float64(n) - mean*mean
+}
@@ -0,0 +1,50 @@
+package image
+
+import (
+	goimage "image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// gradient draws a picture whose brightness waves across it, shifted by
+// offset levels
+func gradient(width, height, offset int, flip bool) *goimage.Gray {
+	img := goimage.NewGray(goimage.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx, fy := float64(x)/float64(width), float64(y)/float64(height)
+			if flip {
+				fx = 1 - fx
+			}
+			level := 100 + 60*math.Sin(9*fx*fx+4*fy)
+			img.SetGray(x, y, color.Gray{Y: uint8(level) + uint8(offset)})
+		}
+	}
+	return img
+}
+
+func TestFingerprint(t *testing.T) {
+	original := fingerprint(gradient(320, 240, 0, false))
+	brighter := fingerprint(gradient(320, 240, 20, false))
+	smaller := fingerprint(gradient(160, 120, 0, false))
+	flipped := fingerprint(gradient(320, 240, 0, true))
+
+	if d := Distance(original.Hash, brighter.Hash); d > 4 {
+		t.Errorf("a brighter copy is %d bits away, want at most 4", d)
+	}
+	if d := Distance(original.Hash, smaller.Hash); d > 8 {
+		t.Errorf("a smaller copy is %d bits away, want at most 8", d)
+	}
+	if d := Distance(original.Hash, flipped.Hash); d < 16 {
+		t.Errorf("a different picture is only %d bits away", d)
+	}
+	if original.Width != 320 || original.Height != 240 {
+		t.Errorf("size = %dx%d, want 320x240", original.Width, original.Height)
+	}
+
+	flat := fingerprint(goimage.NewGray(goimage.Rect(0, 0, 100, 100)))
+	if flat.Sharpness != 0 || original.Sharpness <= 0 {
+		t.Errorf("sharpness of a flat picture = %f and of a detailed one = %f", flat.Sharpness, original.Sharpness)
+	}
+}
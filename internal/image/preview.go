@@ -0,0 +1,86 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jth/archiver/internal/scratch"
+	"github.com/jth/archiver/internal/tools"
+)
+
+// photoFormats are the image formats treated as photos, e.g. for
+// captioning, besides camera raw formats
+var photoFormats = []string{
+	".jpg", ".jpeg", ".png", ".heic", ".heif", ".avif",
+	".webp", ".tiff", ".tif",
+}
+
+// IsPhoto checks if a file is a photo
+func IsPhoto(path string) bool {
+	return slices.Contains(photoFormats, strings.ToLower(filepath.Ext(path))) || IsRaw(path)
+}
+
+// Preview returns a JPEG of the image scaled down to fit in size pixels,
+// made with sips, ImageMagick or ffmpeg, whichever is installed first. Raw
+// files are scaled from their embedded preview, which is returned as it is
+// when no tool is installed.
+func Preview(ctx context.Context, sourcePath string, size int) ([]byte, error) {
+	tool := tools.First("sips", "convert", "ffmpeg")
+	if IsRaw(sourcePath) {
+		embedded, err := RawPreview(sourcePath)
+		if err == nil {
+			if tool == "" {
+				return embedded, nil
+			}
+			source, err := scratch.Create("raw-*.jpg", int64(len(embedded)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to create preview file: %w", err)
+			}
+			defer scratch.Remove(source.Name())
+			_, err = source.Write(embedded)
+			if closeErr := source.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to write preview file: %w", err)
+			}
+			sourcePath = source.Name()
+		}
+	}
+	if tool == "" {
+		return nil, fmt.Errorf("no tool to scale images found: %w", tools.ErrNotInstalled)
+	}
+
+	output, err := scratch.Create("preview-*.jpg", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create preview file: %w", err)
+	}
+	output.Close()
+	defer scratch.Remove(output.Name())
+
+	var cmd *exec.Cmd
+	switch tool {
+	case "sips":
+		cmd = exec.CommandContext(ctx, "sips", "-Z", strconv.Itoa(size), "-s", "format", "jpeg",
+			sourcePath, "--out", output.Name())
+	case "convert":
+		// [0] takes the first frame or page
+		cmd = exec.CommandContext(ctx, "convert", sourcePath+"[0]", "-auto-orient",
+			"-resize", fmt.Sprintf("%dx%d>", size, size), "-quality", "80", output.Name())
+	default:
+		cmd = exec.CommandContext(ctx, tools.Path("ffmpeg"), "-y", "-i", sourcePath, "-frames:v", "1",
+			"-vf", fmt.Sprintf("scale='min(iw,%d)':'min(ih,%d)':force_original_aspect_ratio=decrease", size, size),
+			output.Name())
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed to scale %s: %w\nOutput: %s", tool, sourcePath, err, string(out))
+	}
+
+	return os.ReadFile(output.Name())
+}
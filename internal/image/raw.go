@@ -0,0 +1,155 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrNoPreview is returned by RawPreview for raw files without an embedded
+// JPEG that can be decoded
+var ErrNoPreview = errors.New("no embedded JPEG preview")
+
+// rawFormats are the camera raw formats
+var rawFormats = []string{
+	".cr2", ".nef", ".nrw", ".arw", ".srf", ".sr2", ".dng",
+	".orf", ".rw2", ".pef", ".raf",
+}
+
+// IsRaw checks if a file is a camera raw file
+func IsRaw(path string) bool {
+	return slices.Contains(rawFormats, strings.ToLower(filepath.Ext(path)))
+}
+
+// TIFF tags locating embedded JPEGs
+const (
+	tagCompression     = 0x0103
+	tagStripOffsets    = 0x0111
+	tagStripByteCounts = 0x0117
+	tagSubIFDs         = 0x014A
+	tagJPEGOffset      = 0x0201
+	tagJPEGLength      = 0x0202
+
+	compressionOldJPEG = 6
+	compressionJPEG    = 7
+)
+
+// Bounds on what is read from a damaged or unusual file
+const (
+	maxPreviewIFDs = 32
+	maxPreviewSize = 64 << 20
+)
+
+// rafPreviewHeaderPos is where a RAF header records its JPEG's offset and
+// length
+const rafPreviewHeaderPos = 84
+
+// RawPreview returns the largest JPEG preview embedded in a camera raw
+// file, which cameras write for their own screens: full size in CR2 and
+// most NEF and ARW files, smaller in others. TIFF-based formats and Fuji
+// RAF are read; previews that are lossless JPEG raw data are skipped.
+func RawPreview(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var magic [8]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return nil, ErrNoPreview
+	}
+	if string(magic[:]) == "FUJIFILM" {
+		return rafPreview(f)
+	}
+
+	t, first, err := newTIFF(io.NewSectionReader(f, 0, info.Size()))
+	if err != nil {
+		return nil, ErrNoPreview
+	}
+	var best []byte
+	for _, candidate := range t.previews(first) {
+		offset, length := candidate[0], candidate[1]
+		if length <= int64(len(best)) || length > maxPreviewSize || offset+length > info.Size() {
+			continue
+		}
+		if _, err := jpeg.DecodeConfig(io.NewSectionReader(f, offset, length)); err != nil {
+			continue
+		}
+		data := make([]byte, length)
+		if _, err := f.ReadAt(data, offset); err != nil {
+			continue
+		}
+		best = data
+	}
+	if best == nil {
+		return nil, ErrNoPreview
+	}
+	return best, nil
+}
+
+// previews returns the offset and length of the JPEGs referenced by the
+// IFDs chained from first and their sub-IFDs
+func (t *tiffReader) previews(first int64) [][2]int64 {
+	var candidates [][2]int64
+	queue := []int64{first}
+	visited := make(map[int64]bool)
+	for len(queue) > 0 && len(visited) < maxPreviewIFDs {
+		offset := queue[0]
+		queue = queue[1:]
+		if offset == 0 || visited[offset] {
+			continue
+		}
+		visited[offset] = true
+
+		entries, next, err := t.ifd(offset)
+		if err != nil {
+			continue
+		}
+		queue = append(queue, next)
+		for _, sub := range t.numbers(entries[tagSubIFDs]) {
+			queue = append(queue, int64(sub))
+		}
+
+		if start, length := t.number(entries[tagJPEGOffset]), t.number(entries[tagJPEGLength]); start > 0 && length > 0 {
+			candidates = append(candidates, [2]int64{int64(start), int64(length)})
+		}
+		compression := t.number(entries[tagCompression])
+		strips, counts := t.numbers(entries[tagStripOffsets]), t.numbers(entries[tagStripByteCounts])
+		if (compression == compressionOldJPEG || compression == compressionJPEG) && len(strips) == 1 && len(counts) == 1 {
+			candidates = append(candidates, [2]int64{int64(strips[0]), int64(counts[0])})
+		}
+	}
+	return candidates
+}
+
+// rafPreview reads the JPEG whose offset and length the header of a Fuji
+// RAF file records
+func rafPreview(r io.ReaderAt) ([]byte, error) {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], rafPreviewHeaderPos); err != nil {
+		return nil, ErrNoPreview
+	}
+	offset, length := binary.BigEndian.Uint32(header[:4]), binary.BigEndian.Uint32(header[4:])
+	if length == 0 || length > maxPreviewSize {
+		return nil, ErrNoPreview
+	}
+	data := make([]byte, length)
+	if _, err := r.ReadAt(data, int64(offset)); err != nil {
+		return nil, ErrNoPreview
+	}
+	if _, err := jpeg.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return nil, ErrNoPreview
+	}
+	return data, nil
+}
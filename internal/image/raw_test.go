@@ -0,0 +1,121 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	goimage "image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ifdField is an entry of a TIFF IFD built by rawTIFF
+type ifdField struct {
+	tag, typ uint16
+	count    uint32
+	value    uint32
+}
+
+// rawTIFF builds a little-endian TIFF-based raw file: IFD0 names the camera
+// and points to a small thumbnail and to the EXIF IFD, and a sub-IFD holds
+// a larger preview
+func rawTIFF(t *testing.T, small, large []byte) []byte {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	writeIFD := func(fields []ifdField, next uint32) {
+		binary.Write(&b, le, uint16(len(fields)))
+		for _, f := range fields {
+			binary.Write(&b, le, []uint16{f.tag, f.typ})
+			binary.Write(&b, le, []uint32{f.count, f.value})
+		}
+		binary.Write(&b, le, next)
+	}
+
+	// Layout: header, IFD0 at 8 (7 entries), EXIF IFD, sub-IFD, then data
+	const ifd0, exifIFD, subIFD = 8, 8 + 2 + 7*12 + 4, 8 + 2 + 7*12 + 4 + 2 + 4*12 + 4
+	data := uint32(subIFD + 2 + 3*12 + 4)
+	makeAt, modelAt := data, data+6
+	dateAt := modelAt + 14
+	exposureAt := dateAt + 20
+	smallAt := exposureAt + 8
+	largeAt := smallAt + uint32(len(small))
+
+	b.WriteString("II*\x00")
+	binary.Write(&b, le, uint32(ifd0))
+	writeIFD([]ifdField{
+		{tagMake, 2, 6, makeAt},
+		{tagModel, 2, 14, modelAt},
+		{tagOrientation, 3, 1, 6},
+		{tagSubIFDs, 4, 1, subIFD},
+		{tagJPEGOffset, 4, 1, smallAt},
+		{tagJPEGLength, 4, 1, uint32(len(small))},
+		{tagExifIFD, 4, 1, exifIFD},
+	}, 0)
+	writeIFD([]ifdField{
+		{tagExposureTime, 5, 1, exposureAt},
+		{tagISO, 3, 1, 400},
+		{tagDateTimeOriginal, 2, 20, dateAt},
+		{tagPixelXDimension, 4, 1, 6000},
+	}, 0)
+	writeIFD([]ifdField{
+		{tagCompression, 3, 1, compressionOldJPEG},
+		{tagStripOffsets, 4, 1, largeAt},
+		{tagStripByteCounts, 4, 1, uint32(len(large))},
+	}, 0)
+	if b.Len() != int(data) {
+		t.Fatalf("layout is off: data at %d, want %d", b.Len(), data)
+	}
+	b.WriteString("Nikon\x00")
+	b.WriteString("NIKON D7500\x00\x00\x00")
+	b.WriteString("2019:08:03 18:30:12\x00")
+	binary.Write(&b, le, []uint32{1, 250})
+	b.Write(small)
+	b.Write(large)
+	return b.Bytes()
+}
+
+func encodeJPEG(t *testing.T, width, height int) []byte {
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, goimage.NewGray(goimage.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestRawPreviewAndEXIF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "DSC_0001.NEF")
+	large := encodeJPEG(t, 64, 48)
+	if err := os.WriteFile(path, rawTIFF(t, encodeJPEG(t, 16, 12), large), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := RawPreview(path)
+	if err != nil {
+		t.Fatalf("RawPreview: %v", err)
+	}
+	if !bytes.Equal(preview, large) {
+		t.Errorf("RawPreview returned %d bytes, want the larger preview of %d", len(preview), len(large))
+	}
+
+	exif, err := ReadEXIF(path)
+	if err != nil {
+		t.Fatalf("ReadEXIF: %v", err)
+	}
+	want := EXIF{
+		Make:         "Nikon",
+		Model:        "NIKON D7500",
+		Orientation:  6,
+		ISO:          400,
+		ExposureTime: "1/250",
+		Width:        6000,
+		Taken:        time.Date(2019, 8, 3, 18, 30, 12, 0, time.UTC),
+	}
+	if *exif != want {
+		t.Errorf("ReadEXIF = %+v, want %+v", *exif, want)
+	}
+	if got := exif.Camera(); got != "NIKON D7500" {
+		t.Errorf("Camera() = %q, want the model alone", got)
+	}
+}
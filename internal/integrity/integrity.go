@@ -0,0 +1,97 @@
+// Package integrity re-hashes the files of a scanned drive and compares them
+// with the catalog, to find files damaged by bit-rot while the drive can
+// still be copied
+package integrity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+// Status is the outcome of checking a file
+type Status string
+
+// File statuses
+const (
+	StatusOK         Status = "ok"         // Content as scanned
+	StatusCorrupted  Status = "corrupted"  // Content changed without its size or modification time changing
+	StatusModified   Status = "modified"   // Edited since the scan: its size or modification time changed
+	StatusMissing    Status = "missing"    // No longer on the drive
+	StatusUnreadable Status = "unreadable" // Read errors, often a sign of a failing drive
+	StatusUnhashed   Status = "unhashed"   // No hash in the catalog to compare with
+)
+
+// Result is a file checked against the catalog
+type Result struct {
+	File   *db.FileStatus
+	Status Status
+	SHA256 string // Hash of the content on the drive, when it was read
+	Err    error  // Why a file is unreadable
+}
+
+// Damaged reports whether the file's content can no longer be trusted
+func (r Result) Damaged() bool {
+	return r.Status == StatusCorrupted || r.Status == StatusUnreadable
+}
+
+// Check re-hashes a catalog file and compares it with the hash recorded
+// when it was scanned. A different hash counts as corruption only while the
+// size and modification time are those scanned, since an edited file gets
+// a new modification time.
+func Check(file *db.FileStatus) Result {
+	result := Result{File: file}
+	info, err := os.Stat(file.Path)
+	switch {
+	case os.IsNotExist(err):
+		result.Status = StatusMissing
+		return result
+	case err != nil:
+		result.Status, result.Err = StatusUnreadable, err
+		return result
+	case file.SHA256 == "":
+		result.Status = StatusUnhashed
+		return result
+	case info.Size() != file.Size:
+		result.Status = StatusModified
+		return result
+	}
+
+	result.SHA256, err = hashFile(file.Path)
+	switch {
+	case err != nil:
+		result.Status, result.Err = StatusUnreadable, err
+	case result.SHA256 == file.SHA256:
+		result.Status = StatusOK
+	case !sameTime(info.ModTime(), file.ModTime):
+		result.Status = StatusModified
+	default:
+		result.Status = StatusCorrupted
+	}
+	return result
+}
+
+// sameTime compares modification times to the second, as some file
+// systems and the catalog keep them
+func sameTime(a, b time.Time) bool {
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+// hashFile calculates the SHA-256 of a file
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
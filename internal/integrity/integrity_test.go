@@ -0,0 +1,49 @@
+package integrity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	scanned := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	sum := sha256.Sum256([]byte("hello"))
+	hash := hex.EncodeToString(sum[:])
+
+	write := func(name, content string, modTime time.Time) *db.FileStatus {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		return &db.FileStatus{Path: path, Size: 5, ModTime: scanned, SHA256: hash}
+	}
+
+	unhashed := write("unhashed.txt", "hello", scanned)
+	unhashed.SHA256 = ""
+	tests := []struct {
+		file *db.FileStatus
+		want Status
+	}{
+		{write("ok.txt", "hello", scanned), StatusOK},
+		{write("rotted.txt", "hellp", scanned), StatusCorrupted},
+		{write("edited.txt", "jello", scanned.Add(time.Hour)), StatusModified},
+		{write("grown.txt", "hello, world", scanned), StatusModified},
+		{&db.FileStatus{Path: filepath.Join(dir, "gone.txt"), SHA256: hash}, StatusMissing},
+		{unhashed, StatusUnhashed},
+	}
+	for _, test := range tests {
+		if got := Check(test.file); got.Status != test.want {
+			t.Errorf("Check(%s) = %s, want %s", filepath.Base(test.file.Path), got.Status, test.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/qr"
+)
+
+// Label page size in points: 4 x 2 inches, the common shipping label size
+const (
+	PageWidth  = 288
+	PageHeight = 144
+)
+
+// Label is the information printed on the label of one drive
+type Label struct {
+	Drive      string
+	ArchivedAt time.Time
+	Bucket     string
+	Prefix     string
+	Files      int64
+	Bytes      int64
+	Link       string // Encoded in the QR code
+}
+
+// WritePDF writes a PDF with one label per page
+func WritePDF(w io.Writer, labels []Label) error {
+	doc := newPDF()
+	for _, label := range labels {
+		content, err := labelContent(label)
+		if err != nil {
+			return fmt.Errorf("label for %s: %w", label.Drive, err)
+		}
+		doc.addPage(content)
+	}
+	_, err := w.Write(doc.bytes())
+	return err
+}
+
+// labelContent draws a label: the QR code on the left, the details on the
+// right
+func labelContent(label Label) ([]byte, error) {
+	code, err := qr.Encode(label.Link)
+	if err != nil {
+		return nil, err
+	}
+
+	var content bytes.Buffer
+
+	// QR code with a four module quiet zone, 128pt square
+	const margin, side = 8.0, 128.0
+	module := side / float64(code.Size+8)
+	content.WriteString("0 g\n")
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; {
+			if !code.Dark(x, y) {
+				x++
+				continue
+			}
+			start := x
+			for x < code.Size && code.Dark(x, y) {
+				x++
+			}
+			fmt.Fprintf(&content, "%.3f %.3f %.3f %.3f re\n",
+				margin+float64(start+4)*module, PageHeight-margin-float64(y+5)*module,
+				float64(x-start)*module, module)
+		}
+	}
+	content.WriteString("f\n")
+
+	// Details, each line cut to fit beside the code
+	const left = margin + side + 6
+	lines := []struct {
+		font  string
+		size  float64
+		chars int
+		text  string
+	}{
+		{"F2", 14, 17, label.Drive},
+		{"F1", 9, 28, archived(label.ArchivedAt)},
+		{"F1", 9, 28, "Bucket: " + label.Bucket},
+		{"F1", 9, 28, "Prefix: " + orNone(label.Prefix)},
+		{"F1", 9, 28, fmt.Sprintf("%d files, %s", label.Files, formatSize(label.Bytes))},
+		{"F1", 7, 36, "Scan for the catalog entry"},
+	}
+	y := PageHeight - margin - 16
+	for _, line := range lines {
+		fmt.Fprintf(&content, "BT /%s %.0f Tf %.1f %.1f Td (%s) Tj ET\n",
+			line.font, line.size, left, y, pdfString(truncate(line.text, line.chars)))
+		y -= line.size + 8
+	}
+
+	return content.Bytes(), nil
+}
+
+// truncate shortens s to at most n characters, marking the cut
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+// archived describes when a drive was archived
+func archived(t time.Time) string {
+	if t.IsZero() {
+		return "Not archived yet"
+	}
+	return "Archived " + t.Format("2006-01-02")
+}
+
+// orNone returns s, or a placeholder when it is empty
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// formatSize formats a byte count in binary units
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// pdfString escapes s for a PDF string literal in WinAnsiEncoding.
+// Characters the encoding lacks are replaced with '?'.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r < 32 || (r >= 127 && r < 160) || r > 255:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,32 @@
+package labels
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePDF(t *testing.T) {
+	var buf bytes.Buffer
+	err := WritePDF(&buf, []Label{
+		{Drive: "Photos (2019)", ArchivedAt: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), Bucket: "archive", Files: 12, Bytes: 4096, Link: "https://example.com/?drive=Photos"},
+		{Drive: "Backup", Link: "Archiver drive Backup"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pdf := buf.String()
+	for _, want := range []string{"%PDF-1.4", "/Count 2", `(Photos \(2019\))`, "(Archived 2026-10-01)", "(12 files, 4.0 KB)", "%%EOF"} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("PDF is missing %q", want)
+		}
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	if got := pdfString(`a\b(c)é€`); got != `a\\b\(c\)`+"\xe9?" {
+		t.Errorf("pdfString = %q", got)
+	}
+}
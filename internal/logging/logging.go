@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Options configures the logger
+type Options struct {
+	Level  string // debug, info, warn or error
+	File   string // Log file, appended to; empty logs to stderr
+	Format string // text or json
+}
+
+// New creates a logger from the options. The returned closer closes the log
+// file, if one was opened.
+func New(opts Options) (*slog.Logger, io.Closer, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var w io.Writer = os.Stderr
+	var closer io.Closer = nopCloser{}
+	if opts.File != "" {
+		file, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		w, closer = file, file
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		closer.Close()
+		return nil, nil, fmt.Errorf("unknown log format %q (expected text or json)", opts.Format)
+	}
+
+	return slog.New(handler), closer, nil
+}
+
+// ParseLevel parses a level name such as "debug" or "warn"
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", name)
+	}
+	return level, nil
+}
+
+// OrDefault returns logger, or the default logger if it is nil
+func OrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+// nopCloser is the closer returned when logging to stderr
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,172 @@
+package manifest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+// Format represents the output format of a manifest
+type Format string
+
+const (
+	// FormatJSONL writes one JSON object per line
+	FormatJSONL Format = "jsonl"
+	// FormatCSV writes a header row followed by one row per file
+	FormatCSV Format = "csv"
+)
+
+// Schema identifies archiver manifests in their header
+const Schema = "archiver-manifest"
+
+// Version is the manifest version written by this release. Version 1
+// manifests, written before headers were added, have no header and no tags.
+const Version = 2
+
+// Header describes a manifest so later releases and other tools can tell how
+// to read it. Namespace is the bucket the entries were uploaded to.
+type Header struct {
+	Schema    string    `json:"schema"`
+	Version   int       `json:"version"`
+	Namespace string    `json:"namespace,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewHeader creates a header for a manifest of the current version
+func NewHeader(namespace string) Header {
+	return Header{
+		Schema:    Schema,
+		Version:   Version,
+		Namespace: namespace,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// headerLine wraps the header on the first line of a JSONL manifest, so it
+// can't be mistaken for an entry
+type headerLine struct {
+	Manifest *Header `json:"_manifest"`
+}
+
+// Entry represents a single archived file in a manifest
+type Entry struct {
+	Path         string     `json:"path"`
+	RelativePath string     `json:"relative_path"`
+	Size         int64      `json:"size"`
+	ModTime      time.Time  `json:"mod_time"`
+	ContentType  string     `json:"content_type,omitempty"`
+	SHA256       string     `json:"sha256,omitempty"`
+	UploadedURL  string     `json:"uploaded_url,omitempty"`
+	UploadTime   *time.Time `json:"upload_time,omitempty"`
+	Summary      string     `json:"summary,omitempty"`
+	Tags         []string   `json:"tags,omitempty"` // Since version 2
+}
+
+// csvHeader lists the CSV columns in the order written by Writer
+var csvHeader = []string{
+	"path", "relative_path", "size", "mod_time", "content_type",
+	"sha256", "uploaded_url", "upload_time", "summary", "tags",
+}
+
+// EntryFromFile converts a catalog record into a manifest entry
+func EntryFromFile(file *db.FileStatus) Entry {
+	entry := Entry{
+		Path:         file.Path,
+		RelativePath: file.RelativePath,
+		Size:         file.Size,
+		ModTime:      file.ModTime,
+		ContentType:  file.ContentType,
+		SHA256:       file.SHA256,
+		UploadedURL:  file.UploadedURL,
+		Summary:      file.Summary,
+	}
+	if file.UploadTime.Valid {
+		uploadTime := file.UploadTime.Time
+		entry.UploadTime = &uploadTime
+	}
+	return entry
+}
+
+// Writer writes manifest entries in a given format
+type Writer struct {
+	format Format
+	json   *json.Encoder
+	csv    *csv.Writer
+}
+
+// NewWriter creates a manifest writer for the given format and writes the
+// header. JSONL manifests start with a {"_manifest": ...} line; CSV
+// manifests with a # comment line ahead of the column names.
+func NewWriter(w io.Writer, format Format, header Header) (*Writer, error) {
+	writer := &Writer{format: format}
+
+	switch format {
+	case FormatJSONL:
+		writer.json = json.NewEncoder(w)
+		if err := writer.json.Encode(headerLine{Manifest: &header}); err != nil {
+			return nil, err
+		}
+	case FormatCSV:
+		_, err := fmt.Fprintf(w, "# schema=%s version=%d namespace=%s created_at=%s\n",
+			header.Schema, header.Version, header.Namespace, formatTime(header.CreatedAt))
+		if err != nil {
+			return nil, err
+		}
+		writer.csv = csv.NewWriter(w)
+		if err := writer.csv.Write(csvHeader); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported manifest format: %s", format)
+	}
+
+	return writer, nil
+}
+
+// Write writes a single entry
+func (w *Writer) Write(entry Entry) error {
+	if w.format == FormatJSONL {
+		return w.json.Encode(entry)
+	}
+
+	var uploadTime string
+	if entry.UploadTime != nil {
+		uploadTime = formatTime(*entry.UploadTime)
+	}
+
+	return w.csv.Write([]string{
+		entry.Path,
+		entry.RelativePath,
+		strconv.FormatInt(entry.Size, 10),
+		formatTime(entry.ModTime),
+		entry.ContentType,
+		entry.SHA256,
+		entry.UploadedURL,
+		uploadTime,
+		entry.Summary,
+		strings.Join(entry.Tags, ";"),
+	})
+}
+
+// Flush flushes any buffered output
+func (w *Writer) Flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
+
+// formatTime formats a timestamp as RFC 3339, leaving zero times empty
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,231 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reader reads manifests written by any release. Manifests without a header
+// are read as version 1; columns and fields a version doesn't have are left
+// empty, and unknown ones from newer versions are ignored.
+type Reader struct {
+	header  Header
+	format  Format
+	lines   *bufio.Scanner
+	pending []byte // First JSONL entry of a version 1 manifest
+	csv     *csv.Reader
+	columns map[string]int
+}
+
+// NewReader detects the format and version of a manifest and reads its
+// header
+func NewReader(r io.Reader) (*Reader, error) {
+	buffered := bufio.NewReader(r)
+	first, err := peekNonSpace(buffered)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &Reader{header: Header{Schema: Schema, Version: 1}}
+	if first == '{' {
+		reader.format = FormatJSONL
+		err = reader.readJSONLHeader(buffered)
+	} else {
+		reader.format = FormatCSV
+		err = reader.readCSVHeader(buffered)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if reader.header.Schema != Schema {
+		return nil, fmt.Errorf("not an archiver manifest (schema %q)", reader.header.Schema)
+	}
+	return reader, nil
+}
+
+// Header returns the manifest header. Version 1 manifests get a header with
+// only the schema and version set.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Format returns the format of the manifest
+func (r *Reader) Format() Format {
+	return r.format
+}
+
+// Read reads the next entry, returning io.EOF after the last one
+func (r *Reader) Read() (Entry, error) {
+	if r.format == FormatJSONL {
+		return r.readJSONL()
+	}
+	return r.readCSV()
+}
+
+// peekNonSpace skips leading whitespace and returns the next byte without
+// consuming it
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return 0, fmt.Errorf("empty manifest")
+			}
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			r.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
+
+// readJSONLHeader reads the header line, or keeps the first line as an
+// entry when the manifest has no header
+func (r *Reader) readJSONLHeader(buffered *bufio.Reader) error {
+	r.lines = bufio.NewScanner(buffered)
+	r.lines.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	if !r.lines.Scan() {
+		return r.lines.Err()
+	}
+
+	line := r.lines.Bytes()
+	var wrapped headerLine
+	if err := json.Unmarshal(line, &wrapped); err != nil {
+		return fmt.Errorf("invalid manifest line: %w", err)
+	}
+	if wrapped.Manifest == nil {
+		r.pending = append([]byte(nil), line...)
+		return nil
+	}
+	r.header = *wrapped.Manifest
+	return nil
+}
+
+// readJSONL reads the next non-empty JSONL line as an entry
+func (r *Reader) readJSONL() (Entry, error) {
+	var entry Entry
+	line := r.pending
+	r.pending = nil
+	for len(line) == 0 {
+		if !r.lines.Scan() {
+			if err := r.lines.Err(); err != nil {
+				return entry, err
+			}
+			return entry, io.EOF
+		}
+		line = bytes.TrimSpace(r.lines.Bytes())
+	}
+
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return entry, fmt.Errorf("invalid manifest entry: %w", err)
+	}
+	return entry, nil
+}
+
+// readCSVHeader reads the optional # header comment and the column names
+func (r *Reader) readCSVHeader(buffered *bufio.Reader) error {
+	if b, err := buffered.Peek(1); err == nil && b[0] == '#' {
+		comment, err := buffered.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err := r.parseCSVComment(comment); err != nil {
+			return err
+		}
+	}
+
+	r.csv = csv.NewReader(buffered)
+	r.csv.FieldsPerRecord = -1
+	columns, err := r.csv.Read()
+	if err != nil {
+		return fmt.Errorf("invalid manifest columns: %w", err)
+	}
+
+	r.columns = make(map[string]int, len(columns))
+	for i, column := range columns {
+		r.columns[strings.TrimSpace(column)] = i
+	}
+	if _, ok := r.columns["path"]; !ok {
+		return fmt.Errorf("manifest has no path column")
+	}
+	return nil
+}
+
+// parseCSVComment parses the key=value pairs of the header comment
+func (r *Reader) parseCSVComment(comment string) error {
+	fields := strings.Fields(strings.TrimPrefix(comment, "#"))
+	for _, field := range fields {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "schema":
+			r.header.Schema = value
+		case "version":
+			version, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid manifest version %q", value)
+			}
+			r.header.Version = version
+		case "namespace":
+			r.header.Namespace = value
+		case "created_at":
+			r.header.CreatedAt, _ = time.Parse(time.RFC3339, value)
+		}
+	}
+	return nil
+}
+
+// readCSV reads the next CSV row as an entry
+func (r *Reader) readCSV() (Entry, error) {
+	var entry Entry
+	record, err := r.csv.Read()
+	if err != nil {
+		return entry, err
+	}
+
+	field := func(name string) string {
+		if i, ok := r.columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	entry.Path = field("path")
+	entry.RelativePath = field("relative_path")
+	entry.ContentType = field("content_type")
+	entry.SHA256 = field("sha256")
+	entry.UploadedURL = field("uploaded_url")
+	entry.Summary = field("summary")
+	if size := field("size"); size != "" {
+		if entry.Size, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return entry, fmt.Errorf("invalid size %q for %s", size, entry.Path)
+		}
+	}
+	if modTime := field("mod_time"); modTime != "" {
+		if entry.ModTime, err = time.Parse(time.RFC3339, modTime); err != nil {
+			return entry, fmt.Errorf("invalid mod_time %q for %s", modTime, entry.Path)
+		}
+	}
+	if uploadTime := field("upload_time"); uploadTime != "" {
+		parsed, err := time.Parse(time.RFC3339, uploadTime)
+		if err != nil {
+			return entry, fmt.Errorf("invalid upload_time %q for %s", uploadTime, entry.Path)
+		}
+		entry.UploadTime = &parsed
+	}
+	if tags := field("tags"); tags != "" {
+		entry.Tags = strings.Split(tags, ";")
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,66 @@
+package manifest
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReaderRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatJSONL, FormatCSV} {
+		var buf bytes.Buffer
+		writer, err := NewWriter(&buf, format, NewHeader("my-bucket"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Write(Entry{Path: "/a/b.txt", Size: 42, Tags: []string{"x", "y"}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := NewReader(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		header := reader.Header()
+		if header.Version != Version || header.Namespace != "my-bucket" || reader.Format() != format {
+			t.Errorf("%s: unexpected header %+v", format, header)
+		}
+		entry, err := reader.Read()
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if entry.Path != "/a/b.txt" || entry.Size != 42 || strings.Join(entry.Tags, ",") != "x,y" {
+			t.Errorf("%s: unexpected entry %+v", format, entry)
+		}
+		if _, err := reader.Read(); err != io.EOF {
+			t.Errorf("%s: expected io.EOF, got %v", format, err)
+		}
+	}
+}
+
+func TestReaderVersion1(t *testing.T) {
+	manifests := map[string]string{
+		"jsonl": `{"path":"/a/b.txt","size":42}` + "\n",
+		"csv":   "path,relative_path,size,mod_time,content_type,sha256,uploaded_url,upload_time,summary\n/a/b.txt,,42,,,,,,\n",
+	}
+	for name, manifest := range manifests {
+		reader, err := NewReader(strings.NewReader(manifest))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if reader.Header().Version != 1 {
+			t.Errorf("%s: expected version 1, got %d", name, reader.Header().Version)
+		}
+		entry, err := reader.Read()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if entry.Path != "/a/b.txt" || entry.Size != 42 || entry.Tags != nil {
+			t.Errorf("%s: unexpected entry %+v", name, entry)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/logging"
+)
+
+// Webhook types
+const (
+	WebhookGeneric = "generic"
+	WebhookSlack   = "slack"
+	WebhookDiscord = "discord"
+)
+
+// Summary describes a finished run. Generic webhooks receive it as JSON.
+type Summary struct {
+	RunID           int64     `json:"run_id"`
+	Command         string    `json:"command"`
+	Source          string    `json:"source"`
+	Status          string    `json:"status"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	FilesTotal      int64     `json:"files_total"`
+	FilesProcessed  int64     `json:"files_processed"`
+	FilesSkipped    int64     `json:"files_skipped"`
+	FilesFailed     int64     `json:"files_failed"`
+	BytesProcessed  int64     `json:"bytes_processed"`
+	BytesUploaded   int64     `json:"bytes_uploaded"`
+	Cost            float64   `json:"cost"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// Title is a one-line description of how the run ended
+func (s Summary) Title() string {
+	return fmt.Sprintf("Archiver %s run %d %s", s.Command, s.RunID, s.Status)
+}
+
+// Message describes the totals of the run, and its error if it failed
+func (s Summary) Message() string {
+	duration := s.FinishedAt.Sub(s.StartedAt).Round(time.Second)
+	message := fmt.Sprintf("%d processed, %d skipped, %d failed, %s uploaded in %s ($%.4f)",
+		s.FilesProcessed, s.FilesSkipped, s.FilesFailed, formatBytes(s.BytesUploaded), duration, s.Cost)
+	if s.Error != "" {
+		message += "\n" + s.Error
+	}
+	return message
+}
+
+// Webhook is a URL posted to when a run ends. Type is slack, discord or
+// generic; when empty it is guessed from the URL.
+type Webhook struct {
+	URL  string
+	Type string
+}
+
+// Notifier sends desktop notifications and webhooks when runs end
+type Notifier struct {
+	desktop  bool
+	webhooks []Webhook
+	client   *http.Client
+	log      *slog.Logger
+}
+
+// New creates a notifier. desktop enables notifications through
+// terminal-notifier or osascript on macOS and notify-send on Linux.
+func New(desktop bool, webhooks []Webhook, logger *slog.Logger) (*Notifier, error) {
+	webhooks = append([]Webhook(nil), webhooks...)
+	for i, webhook := range webhooks {
+		if webhook.URL == "" {
+			return nil, fmt.Errorf("webhook %d has no URL", i+1)
+		}
+		if webhook.Type == "" {
+			webhooks[i].Type = detectType(webhook.URL)
+			continue
+		}
+		switch webhook.Type {
+		case WebhookGeneric, WebhookSlack, WebhookDiscord:
+		default:
+			return nil, fmt.Errorf("unknown webhook type %q (expected slack, discord or generic)", webhook.Type)
+		}
+	}
+
+	return &Notifier{
+		desktop:  desktop,
+		webhooks: webhooks,
+		client:   &http.Client{Timeout: 15 * time.Second},
+		log:      logging.OrDefault(logger),
+	}, nil
+}
+
+// Enabled reports whether the notifier sends anything
+func (n *Notifier) Enabled() bool {
+	return n.desktop || len(n.webhooks) > 0
+}
+
+// Notify sends the summary to every configured destination. Failures are
+// logged and returned together; one failing destination doesn't stop the
+// others.
+func (n *Notifier) Notify(ctx context.Context, summary Summary) error {
+	var errs []error
+	if n.desktop {
+		if err := notifyDesktop(ctx, summary.Title(), summary.Message()); err != nil {
+			n.log.Warn("desktop notification failed", "error", err)
+			errs = append(errs, fmt.Errorf("desktop notification: %w", err))
+		}
+	}
+
+	for _, webhook := range n.webhooks {
+		if err := n.post(ctx, webhook, summary); err != nil {
+			n.log.Warn("webhook failed", "type", webhook.Type, "error", err)
+			errs = append(errs, fmt.Errorf("%s webhook: %w", webhook.Type, err))
+		} else {
+			n.log.Debug("webhook sent", "type", webhook.Type, "run", summary.RunID)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// post sends the summary to a webhook in the payload its type expects
+func (n *Notifier) post(ctx context.Context, webhook Webhook, summary Summary) error {
+	var payload interface{}
+	switch webhook.Type {
+	case WebhookSlack:
+		payload = map[string]string{"text": "*" + summary.Title() + "*\n" + summary.Message()}
+	case WebhookDiscord:
+		payload = map[string]string{"content": "**" + summary.Title() + "**\n" + summary.Message()}
+	default:
+		payload = summary
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// detectType guesses the webhook type from its URL
+func detectType(url string) string {
+	switch {
+	case strings.Contains(url, "hooks.slack.com"):
+		return WebhookSlack
+	case strings.Contains(url, "discord.com/api/webhooks"), strings.Contains(url, "discordapp.com/api/webhooks"):
+		return WebhookDiscord
+	}
+	return WebhookGeneric
+}
+
+// notifyDesktop shows a desktop notification with the platform's tools.
+// On platforms without one it does nothing.
+func notifyDesktop(ctx context.Context, title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("terminal-notifier"); err == nil {
+			cmd = exec.CommandContext(ctx, "terminal-notifier", "-title", "Archiver", "-subtitle", title, "-message", message)
+		} else {
+			script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+			cmd = exec.CommandContext(ctx, "osascript", "-e", script)
+		}
+	case "linux":
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name=Archiver", title, message)
+	default:
+		return nil
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// appleScriptString quotes s as an AppleScript string literal
+func appleScriptString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// formatBytes formats a byte count in binary units
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotifyWebhooks(t *testing.T) {
+	var payloads []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	notifier, err := New(false, []Webhook{
+		{URL: server.URL},
+		{URL: server.URL, Type: WebhookSlack},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := Summary{RunID: 7, Command: "ingest", Status: "completed", FilesProcessed: 3}
+	if err := notifier.Notify(context.Background(), summary); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(payloads) != 2 {
+		t.Fatalf("expected 2 webhook calls, got %d", len(payloads))
+	}
+	if payloads[0]["run_id"] != float64(7) || payloads[0]["status"] != "completed" {
+		t.Errorf("unexpected generic payload %v", payloads[0])
+	}
+	if text, _ := payloads[1]["text"].(string); text == "" {
+		t.Errorf("unexpected slack payload %v", payloads[1])
+	}
+}
+
+func TestNotifyWebhookFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	notifier, err := New(false, []Webhook{{URL: server.URL}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Notify(context.Background(), Summary{}); err == nil {
+		t.Error("expected an error for a failing webhook")
+	}
+}
+
+func TestDetectType(t *testing.T) {
+	tests := map[string]string{
+		"https://hooks.slack.com/services/T0/B0/x":    WebhookSlack,
+		"https://discord.com/api/webhooks/1/abc":      WebhookDiscord,
+		"https://example.com/archiver/runs/completed": WebhookGeneric,
+	}
+	for url, want := range tests {
+		if got := detectType(url); got != want {
+			t.Errorf("detectType(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package pathnorm makes file names from other systems safe to use as
+// catalog keys and remote names: it normalizes Unicode to NFC, as macOS
+// writes decomposed (NFD) names that look identical to the composed names
+// other systems write, shortens names too long for common file systems, and
+// handles Windows long-path prefixes.
+package pathnorm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NFC returns s in Unicode Normalization Form C. Strings that aren't valid
+// UTF-8, such as names written in a legacy code page, are returned as they
+// are, as they can't be normalized without guessing their encoding.
+func NFC(s string) string {
+	if !utf8.ValidString(s) {
+		return s
+	}
+	return norm.NFC.String(s)
+}
+
+// IsNFC reports whether s is already in Normalization Form C
+func IsNFC(s string) bool {
+	return !utf8.ValidString(s) || norm.NFC.IsNormalString(s)
+}
+
+// FoldCase returns s in NFC and lower case, so that names a
+// case-insensitive file system takes for the same file fold to the same
+// string
+func FoldCase(s string) string {
+	return strings.ToLower(NFC(s))
+}
+
+// MaxNameBytes is the longest file name most file systems accept
+const MaxNameBytes = 255
+
+// FitName shortens a file name longer than max bytes, cutting the end of
+// its stem at a character boundary and adding a short hash of the full name
+// so that names sharing their start stay distinct. The extension is kept.
+func FitName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := "~" + hex.EncodeToString(sum[:4])
+	ext := path.Ext(name)
+	if len(ext)+len(suffix) >= max/2 {
+		ext = ""
+	}
+	stem := name[:max-len(ext)-len(suffix)]
+	for len(stem) > 0 && !utf8.ValidString(stem) {
+		stem = stem[:len(stem)-1]
+	}
+	return stem + suffix + ext
+}
+
+// FitPath applies FitName to each element of a slash-separated path
+func FitPath(p string) string {
+	elements := strings.Split(p, "/")
+	for i, element := range elements {
+		elements[i] = FitName(element, MaxNameBytes)
+	}
+	return strings.Join(elements, "/")
+}
+
+// RemotePath returns the name a relative path is stored under remotely:
+// slash-separated, in NFC and with over-long names shortened
+func RemotePath(relPath string) string {
+	return FitPath(NFC(filepath.ToSlash(relPath)))
+}
+
+// Windows long-path prefixes, which lift the 260 character limit on paths
+const (
+	longPrefix    = `\\?\`
+	longUNCPrefix = `\\?\UNC\`
+)
+
+// windowsMaxPath is the longest path Windows accepts without a long-path
+// prefix, less the terminating NUL
+const windowsMaxPath = 259
+
+// StripLongPrefix removes a Windows long-path prefix, so that paths given
+// with and without one name the same file in the catalog
+func StripLongPrefix(p string) string {
+	p = strings.Replace(p, `//?/`, longPrefix, 1)
+	switch {
+	case strings.HasPrefix(p, longUNCPrefix):
+		return `\\` + p[len(longUNCPrefix):]
+	case strings.HasPrefix(p, longPrefix):
+		return p[len(longPrefix):]
+	}
+	return p
+}
+
+// Long returns an absolute path that Windows can open whatever its length,
+// adding a long-path prefix to those over the limit. Elsewhere, and for
+// shorter paths, it returns p as it is.
+func Long(p string) string {
+	if runtime.GOOS != "windows" {
+		return p
+	}
+	return longPath(p)
+}
+
+// longPath adds a long-path prefix to an absolute Windows path over the limit
+func longPath(p string) string {
+	if len(p) <= windowsMaxPath || strings.HasPrefix(p, longPrefix) {
+		return p
+	}
+	p = strings.ReplaceAll(p, "/", `\`)
+	if strings.HasPrefix(p, `\\`) {
+		return longUNCPrefix + p[2:]
+	}
+	if len(p) >= 3 && p[1] == ':' && p[2] == '\\' {
+		return longPrefix + p
+	}
+	return p
+}
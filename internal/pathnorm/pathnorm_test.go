@@ -0,0 +1,86 @@
+package pathnorm
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNFC(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Report.pdf", "Report.pdf"},
+		{"Cafe\u0301.txt", "Café.txt"},    // macOS writes é as e and a combining acute
+		{"Café.txt", "Café.txt"},          // Already composed
+		{"A\u0308\u0304", "\u01DE"},       // Ǟ composes in two steps
+		{"a\u0323\u0302", "\u1EAD"},       // Marks out of order: ậ
+		{"a\u0302\u0323", "\u1EAD"},       // Marks in canonical order
+		{"\u1100\u1161\u11A8", "\uAC01"},  // Hangul jamo to a syllable
+		{"\u212B", "\u00C5"},              // Ångström sign is a singleton
+		{"e\u0301\u0301", "\u00E9\u0301"}, // Only one acute composes
+		{"\u0915\u093C", "\u0915\u093C"},  // Composition exclusion stays decomposed
+		{"Fotos 2009/Kr\u00e4ppel.jpg", "Fotos 2009/Kräppel.jpg"},
+		{"caf\xe9.txt", "caf\xe9.txt"}, // Latin-1, not UTF-8: left alone
+	}
+	for _, tt := range tests {
+		if got := NFC(tt.in); got != tt.want {
+			t.Errorf("NFC(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if IsNFC("Cafe\u0301") || !IsNFC("Café") {
+		t.Error("IsNFC doesn't tell composed from decomposed names")
+	}
+}
+
+func TestFitName(t *testing.T) {
+	if got := FitName("Report.pdf", MaxNameBytes); got != "Report.pdf" {
+		t.Errorf("short name changed to %q", got)
+	}
+
+	long := strings.Repeat("é", 200) + ".pdf" // 404 bytes
+	fitted := FitName(long, MaxNameBytes)
+	if len(fitted) > MaxNameBytes || !utf8.ValidString(fitted) || !strings.HasSuffix(fitted, ".pdf") {
+		t.Errorf("FitName = %q (%d bytes)", fitted, len(fitted))
+	}
+	other := FitName(strings.Repeat("é", 201)+".pdf", MaxNameBytes)
+	if other == fitted {
+		t.Error("long names sharing their start were shortened to the same name")
+	}
+	if FitName(long, MaxNameBytes) != fitted {
+		t.Error("FitName is not deterministic")
+	}
+
+	p := RemotePath("Docs/" + "Cafe\u0301/" + long)
+	if !strings.HasPrefix(p, "Docs/Café/") || len(p) != len("Docs/Café/")+len(fitted) {
+		t.Errorf("RemotePath = %q", p)
+	}
+}
+
+func TestLongPrefix(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`\\?\C:\Users\jo\file.txt`, `C:\Users\jo\file.txt`},
+		{`\\?\UNC\server\share\file.txt`, `\\server\share\file.txt`},
+		{`//?/C:/Users/jo`, `C:/Users/jo`},
+		{`/Volumes/OldDrive`, `/Volumes/OldDrive`},
+	}
+	for _, tt := range tests {
+		if got := StripLongPrefix(tt.in); got != tt.want {
+			t.Errorf("StripLongPrefix(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	deep := `C:\` + strings.Repeat(`folder\`, 40) + "file.txt"
+	if got := longPath(deep); got != `\\?\`+deep {
+		t.Errorf("longPath(%q) = %q", deep, got)
+	}
+	unc := `\\server\share\` + strings.Repeat(`folder\`, 40)
+	if got := longPath(unc); got != `\\?\UNC\server\share\`+strings.Repeat(`folder\`, 40) {
+		t.Errorf("longPath(%q) = %q", unc, got)
+	}
+	if got := longPath(`C:\short.txt`); got != `C:\short.txt` {
+		t.Errorf("short path changed to %q", got)
+	}
+}
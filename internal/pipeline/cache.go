@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"encoding/json"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/summariser"
+)
+
+// summaryCache keeps summaries in the database. With refresh set it misses
+// every lookup, so that documents are summarized again and the cached
+// summaries replaced.
+type summaryCache struct {
+	db      *db.DB
+	refresh bool
+}
+
+// CachedSummary implements summariser.Cache
+func (c summaryCache) CachedSummary(hash string, level summariser.SummaryLevel, family string) (*summariser.Summary, error) {
+	if c.refresh {
+		return nil, nil
+	}
+	cached, err := c.db.GetCachedSummary(hash, string(level), family)
+	if err != nil || cached == nil {
+		return nil, err
+	}
+	var entities *summariser.Entities
+	if cached.Entities != "" {
+		entities = &summariser.Entities{}
+		if err := json.Unmarshal([]byte(cached.Entities), entities); err != nil {
+			return nil, err
+		}
+	}
+	return &summariser.Summary{
+		Entities:      entities,
+		Summary:       cached.Summary,
+		Model:         cached.Model,
+		Provider:      cached.Provider,
+		Level:         summariser.SummaryLevel(cached.Level),
+		PromptVersion: cached.PromptVersion,
+		CreatedAt:     cached.CreatedAt,
+	}, nil
+}
+
+// CacheSummary implements summariser.Cache
+func (c summaryCache) CacheSummary(hash, family string, summary *summariser.Summary) error {
+	var entities []byte
+	if summary.Entities != nil {
+		var err error
+		if entities, err = json.Marshal(summary.Entities); err != nil {
+			return err
+		}
+	}
+	return c.db.CacheSummary(&db.CachedSummary{
+		SHA256:        hash,
+		Level:         string(summary.Level),
+		ModelFamily:   family,
+		Summary:       summary.Summary,
+		Model:         summary.Model,
+		Provider:      summary.Provider,
+		PromptVersion: summary.PromptVersion,
+		Entities:      string(entities),
+	})
+}
+
+// entitiesByKind lists the entities of a summary by their kind in the
+// database
+func entitiesByKind(entities *summariser.Entities) map[string][]string {
+	byKind := map[string][]string{
+		db.EntityPerson:       entities.People,
+		db.EntityOrganization: entities.Organizations,
+		db.EntityDate:         entities.Dates,
+		db.EntityPlace:        entities.Places,
+		db.EntityKeyword:      entities.Keywords,
+	}
+	if entities.DocumentType != "" {
+		byKind[db.EntityDocumentType] = []string{entities.DocumentType}
+	}
+	return byKind
+}
@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+// extractionBatchSize is the most extracted documents the extraction stage
+// stores in each write to the database
+const extractionBatchSize = 50
+
+// extractedDocument is a document whose text was extracted, on its way to
+// the database and then to be summarized
+type extractedDocument struct {
+	result     *Result
+	title      string
+	extraction db.Extraction
+}
+
+// writeExtractions stores the documents the extraction workers send on in,
+// writing whatever has arrived since the last write, up to
+// extractionBatchSize, in a single transaction, and passes the documents
+// stored on to out. Documents whose batch can't be written fail and are
+// handed to done. It closes out once in is closed.
+func (p *Pipeline) writeExtractions(in <-chan *extractedDocument, out chan<- *extractedDocument, done func(*Result)) {
+	defer close(out)
+	for document := range in {
+		batch := []*extractedDocument{document}
+	collect:
+		for len(batch) < extractionBatchSize {
+			select {
+			case document, ok := <-in:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, document)
+			default:
+				break collect
+			}
+		}
+
+		extractions := make([]db.Extraction, len(batch))
+		for i, document := range batch {
+			extractions[i] = document.extraction
+		}
+		if err := p.db.SaveExtractions(extractions); err != nil {
+			for _, document := range batch {
+				document.result.Error = fmt.Errorf("failed to store extracted text: %w", err)
+				done(document.result)
+			}
+			continue
+		}
+		for _, document := range batch {
+			out <- document
+		}
+	}
+}
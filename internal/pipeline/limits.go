@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// lowMemory is the amount of RAM below which fewer tools run at once
+const lowMemory = 8 << 30
+
+// Limits caps how many tasks of each kind run at once: external tool
+// processes, files hashed by the scanner and LLM requests. Zero fields use
+// the machine defaults.
+type Limits struct {
+	Transcodes  int // ffmpeg processes
+	Extractions int // pdftotext, Tika, pandoc and other text extractors
+	Conversions int // image converters
+	// Whisper processes, which use several cores and a lot of memory each
+	Transcriptions int
+	Hashes         int // Files hashed at once while scanning
+	Summaries      int // Summary and caption requests, which providers rate-limit
+}
+
+// DefaultLimits sizes the limits for this machine: one transcode and one
+// transcription at a time,
+// extractions and conversions scaled to the CPU count, halved when the
+// machine has little memory. Files are hashed one at a time, which is
+// fastest on the external hard drives being archived.
+func DefaultLimits() Limits {
+	cpus := runtime.NumCPU()
+	limits := Limits{
+		Transcodes:     1,
+		Extractions:    clamp(cpus/2, 1, 4),
+		Conversions:    clamp(cpus/4, 1, 2),
+		Transcriptions: 1,
+		Hashes:         1,
+		Summaries:      4,
+	}
+
+	if memory := totalMemory(); memory > 0 && memory < lowMemory {
+		limits.Extractions = clamp(limits.Extractions/2, 1, 4)
+		limits.Conversions = 1
+	}
+
+	return limits
+}
+
+// withDefaults fills unset limits from DefaultLimits
+func (l Limits) withDefaults() Limits {
+	defaults := DefaultLimits()
+	if l.Transcodes <= 0 {
+		l.Transcodes = defaults.Transcodes
+	}
+	if l.Extractions <= 0 {
+		l.Extractions = defaults.Extractions
+	}
+	if l.Conversions <= 0 {
+		l.Conversions = defaults.Conversions
+	}
+	if l.Transcriptions <= 0 {
+		l.Transcriptions = defaults.Transcriptions
+	}
+	if l.Hashes <= 0 {
+		l.Hashes = defaults.Hashes
+	}
+	if l.Summaries <= 0 {
+		l.Summaries = defaults.Summaries
+	}
+	return l
+}
+
+// slots is a counting semaphore bounding concurrent tool processes
+type slots chan struct{}
+
+// acquire waits for a free slot or for ctx to be done
+func (s slots) acquire(ctx context.Context) error {
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken by acquire
+func (s slots) release() {
+	<-s
+}
+
+// clamp limits n to the range [low, high]
+func clamp(n, low, high int) int {
+	if n < low {
+		return low
+	}
+	if n > high {
+		return high
+	}
+	return n
+}
+
+// totalMemory returns the installed RAM in bytes, or 0 if it can't be read
+func totalMemory() int64 {
+	switch runtime.GOOS {
+	case "darwin":
+		output, err := exec.Command("sysctl", "-n", "hw.memsize").Output()
+		if err != nil {
+			return 0
+		}
+		memory, _ := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+		return memory
+	case "linux":
+		file, err := os.Open("/proc/meminfo")
+		if err != nil {
+			return 0
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "MemTotal:" {
+				kb, _ := strconv.ParseInt(fields[1], 10, 64)
+				return kb * 1024
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"sync"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+// markBatchSize is how many files a stage marks processed in each write to
+// the database
+const markBatchSize = 100
+
+// statusBatch collects the files the workers of a stage mark processed and
+// writes them in batches, rather than updating the database once per file.
+// Outside a stage files are marked processed at once.
+type statusBatch struct {
+	mu       sync.Mutex
+	db       *db.DB
+	batching bool
+	pending  []db.StatusUpdate
+}
+
+// start collects the files marked processed until finish is called
+func (b *statusBatch) start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batching = true
+}
+
+// markProcessed records that a file is processed, writing the pending
+// files once there is a batch of them
+func (b *statusBatch) markProcessed(id int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.batching {
+		return b.db.MarkProcessed(id)
+	}
+	b.pending = append(b.pending, db.StatusUpdate{ID: id, Processed: true})
+	if len(b.pending) < markBatchSize {
+		return nil
+	}
+	return b.flush()
+}
+
+// checkpoint writes the pending files
+func (b *statusBatch) checkpoint() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flush()
+}
+
+// finish writes the pending files and marks files processed at once again
+func (b *statusBatch) finish() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batching = false
+	return b.flush()
+}
+
+// flush writes the pending files. b.mu is held. A batch that can't be
+// written is dropped, as its files are processed again by the next run.
+func (b *statusBatch) flush() error {
+	pending := b.pending
+	b.pending = nil
+	return b.db.UpdateFileStatusBatch(pending)
+}
@@ -0,0 +1,1078 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jth/archiver/internal/audio"
+	"github.com/jth/archiver/internal/capabilities"
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/doc"
+	"github.com/jth/archiver/internal/drives"
+	"github.com/jth/archiver/internal/image"
+	"github.com/jth/archiver/internal/logging"
+	"github.com/jth/archiver/internal/power"
+	"github.com/jth/archiver/internal/progress"
+	"github.com/jth/archiver/internal/scan"
+	"github.com/jth/archiver/internal/scratch"
+	"github.com/jth/archiver/internal/summariser"
+	"github.com/jth/archiver/internal/tagging"
+	"github.com/jth/archiver/internal/tools"
+	"github.com/jth/archiver/internal/upload"
+	"github.com/jth/archiver/internal/video"
+)
+
+// Config represents the pipeline configuration
+type Config struct {
+	SummaryLevel summariser.SummaryLevel
+	CostCap      float64
+	// LifetimeBudget caps the LLM spend recorded across all runs; 0 for no
+	// limit
+	LifetimeBudget float64
+	// DocumentCap caps the cost of summarizing one document and
+	// ProviderCaps the monthly spend by provider; documents over them are
+	// summarized by a cheaper model or more briefly
+	DocumentCap  float64
+	ProviderCaps map[string]float64
+	// RefreshCache summarizes documents again instead of reusing the
+	// cached summaries of identical content, and replaces them
+	RefreshCache bool
+	// ExtractEntities stores the people, organizations, dates, places,
+	// document type and keywords of each summarized document
+	ExtractEntities bool
+	// Classifier, if set, tags documents with the categories their text or
+	// extracted document type puts them in
+	Classifier *tagging.Classifier
+	// WhisperModel transcribes audio files; defaults to base
+	WhisperModel string
+	// Transcriber transcribes audio files; defaults to Whisper
+	Transcriber audio.Transcriber
+	// CaptionPhotos describes each photo in one line with a vision model,
+	// for text search, within the cost caps
+	CaptionPhotos bool
+	Limits        Limits
+	Timeouts      Timeouts
+	Logger        *slog.Logger // Defaults to slog.Default()
+}
+
+// Result represents the outcome of processing a single file
+type Result struct {
+	File      *db.FileStatus
+	Extractor string
+	Quality   float64
+	Model     string
+	Cost      float64
+	Skipped   bool
+	Error     error
+}
+
+// Pipeline runs files through extraction and summarization
+type Pipeline struct {
+	config         Config
+	db             *db.DB
+	summariser     *summariser.Summariser
+	transcodes     slots
+	extractions    slots
+	conversions    slots
+	transcriptions slots
+	summaries      slots
+	marks          *statusBatch // Files marked processed during a stage
+	power          *power.Monitor
+	media          upload.Destination // Where transcodes and conversions are uploaded
+	caps           capabilities.Matrix
+	processors     Registry
+	runID          int64
+	source         string // Folder the documents and photos processed are limited to
+	remaining      int64  // Documents or photos left unprocessed by an interrupted run
+	stage          string // Stage the run reached
+	log            *slog.Logger
+}
+
+// New creates a new pipeline backed by the given database
+func New(config Config, database *db.DB) *Pipeline {
+	summariserConfig := summariser.DefaultConfig()
+	if config.SummaryLevel != "" {
+		summariserConfig.Level = config.SummaryLevel
+	}
+	if config.CostCap > 0 {
+		summariserConfig.CostCap = config.CostCap
+	}
+
+	config.Limits = config.Limits.withDefaults()
+	if config.Transcriber == nil {
+		config.Transcriber = audio.Whisper{}
+	}
+	logger := logging.OrDefault(config.Logger)
+	summariserConfig.Logger = logger
+
+	if config.LifetimeBudget > 0 {
+		spent, err := database.TotalCost(db.CostLLM)
+		if err != nil {
+			logger.Warn("could not read the lifetime LLM spend", "error", err)
+		}
+		summariserConfig.LifetimeBudget = config.LifetimeBudget
+		summariserConfig.LifetimeSpent = spent
+	}
+	summariserConfig.DocumentCap = config.DocumentCap
+	summariserConfig.Cache = summaryCache{database, config.RefreshCache}
+	summariserConfig.ExtractEntities = config.ExtractEntities
+	if len(config.ProviderCaps) > 0 {
+		summariserConfig.ProviderCaps = config.ProviderCaps
+		summariserConfig.ProviderSpent = monthlySpend(database, logger)
+	}
+
+	p := &Pipeline{
+		config:         config,
+		db:             database,
+		summariser:     summariser.NewSummariser(summariserConfig),
+		transcodes:     make(slots, config.Limits.Transcodes),
+		extractions:    make(slots, config.Limits.Extractions),
+		conversions:    make(slots, config.Limits.Conversions),
+		transcriptions: make(slots, config.Limits.Transcriptions),
+		summaries:      make(slots, config.Limits.Summaries),
+		marks:          &statusBatch{db: database},
+		caps:           capabilities.Detect(),
+		log:            logger,
+	}
+	for _, processor := range builtinProcessors(p) {
+		p.processors.Register(processor)
+	}
+	return p
+}
+
+// Register adds a processor for the files it handles, taking precedence
+// over the built-in ones
+func (p *Pipeline) Register(processor Processor) {
+	p.processors.Register(processor)
+}
+
+// SetRun records the files that fail from now on against a run in the
+// run history
+func (p *Pipeline) SetRun(runID int64) {
+	p.runID = runID
+}
+
+// SetSource limits the documents and photos processed to those below root,
+// such as the source of a run being resumed. By default every unprocessed
+// file in the catalog is processed.
+func (p *Pipeline) SetSource(root string) {
+	p.source = root
+}
+
+// SetMediaDestination makes runs transcode videos and convert HEIC and AVIF
+// photos, uploading the results to dest. Without a destination they are
+// left alone.
+func (p *Pipeline) SetMediaDestination(dest upload.Destination) {
+	p.media = dest
+}
+
+// SetPowerMonitor makes transcoding and hashing pause while the monitor
+// reports the machine on battery or thermally throttled
+func (p *Pipeline) SetPowerMonitor(monitor *power.Monitor) {
+	p.power = monitor
+}
+
+// waitForPower blocks while heavy work is paused by the power monitor
+func (p *Pipeline) waitForPower(ctx context.Context) error {
+	if p.power == nil {
+		return nil
+	}
+	return p.power.Wait(ctx)
+}
+
+// ProcessDocument extracts the text of a document, or transcribes an audio
+// file, summarizes it and records the outcome in the database. Files that
+// are neither, or that no installed tool can handle, are skipped. Once its
+// text is stored and summarized, or stored when no model can summarize, a
+// file is marked processed and later runs skip it until its content changes.
+func (p *Pipeline) ProcessDocument(ctx context.Context, file *db.FileStatus) *Result {
+	document, result := p.extract(ctx, file)
+	if document == nil {
+		return result
+	}
+	if err := p.db.SaveExtractions([]db.Extraction{document.extraction}); err != nil {
+		result.Error = fmt.Errorf("failed to store extracted text: %w", err)
+		return result
+	}
+	return p.summarizeDocument(ctx, document)
+}
+
+// Resummarize summarizes a document again from the text stored when it was
+// extracted or transcribed, without reading the file, so that the drive it
+// is on needn't be connected. Its summary, entities and provenance are
+// replaced as by ProcessDocument. Files with no stored text are skipped.
+func (p *Pipeline) Resummarize(ctx context.Context, file *db.FileStatus) *Result {
+	result := &Result{File: file, Extractor: file.Extractor, Quality: file.ExtractQuality}
+	text, err := p.db.GetText(file.ID)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to read stored text: %w", err)
+		return result
+	}
+	if strings.TrimSpace(text) == "" {
+		result.Skipped = true
+		return result
+	}
+	metadata, err := p.db.GetMetadata(file.ID)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to read stored metadata: %w", err)
+		return result
+	}
+	title := metadata["title"]
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(file.Path), filepath.Ext(file.Path))
+	}
+
+	return p.summarizeDocument(ctx, &extractedDocument{
+		result:     result,
+		title:      title,
+		extraction: db.Extraction{FileID: file.ID, Text: text},
+	})
+}
+
+// extract extracts the text of a document, or transcribes an audio file,
+// for it to be stored. It returns no document when there is nothing to
+// store: the result then says whether the file was skipped or failed.
+func (p *Pipeline) extract(ctx context.Context, file *db.FileStatus) (*extractedDocument, *Result) {
+	result := &Result{File: file}
+
+	processor, ok := p.textProcessor(file)
+	if !ok || !processor.Available(file) {
+		result.Skipped = true
+		return nil, result
+	}
+
+	start := time.Now()
+	artifact, extracted, err := processor.Extract(ctx, file)
+	if err != nil {
+		result.Error = err
+		return nil, result
+	}
+	result.Extractor = extracted.Extractor
+	if errors.Is(extracted.Error, tools.ErrNotInstalled) {
+		// Reported once up front by tools.PrintHints rather than per file
+		result.Skipped = true
+		return nil, result
+	}
+	if extracted.Error != nil {
+		result.Error = fmt.Errorf("extraction failed: %w", extracted.Error)
+		return nil, result
+	}
+	result.Quality = extracted.Quality
+
+	provenance := &db.Provenance{
+		FileID:      file.ID,
+		Artifact:    artifact,
+		Tool:        extracted.Extractor,
+		ToolVersion: toolVersion(extracted.Extractor),
+		Duration:    time.Since(start),
+		Details:     fmt.Sprintf("quality=%.3f", extracted.Quality),
+	}
+	if artifact == db.ArtifactTranscript {
+		provenance.Model = extracted.Metadata["model"]
+		provenance.Details = ""
+	} else if len(extracted.Metadata) > 0 {
+		provenance.Details += " " + metadataDetails(extracted.Metadata)
+	}
+
+	return &extractedDocument{
+		result: result,
+		title:  extracted.Title,
+		extraction: db.Extraction{
+			FileID:    file.ID,
+			Extractor: extracted.Extractor,
+			Quality:   extracted.Quality,
+			Text:      extracted.Text,
+			Metadata:  extracted.Metadata,
+			// Without a usable model every summary would fail; the text is
+			// all that is kept
+			Processed:  !p.caps.Summarization.Available(),
+			Provenance: provenance,
+		},
+	}, result
+}
+
+// summarizeDocument classifies a document whose text is stored and
+// summarizes it, marking it processed once its summary is recorded
+func (p *Pipeline) summarizeDocument(ctx context.Context, document *extractedDocument) *Result {
+	result := document.result
+	file := result.File
+	text := document.extraction.Text
+	p.classify(file, text, "")
+
+	if document.extraction.Processed {
+		return result
+	}
+
+	start := time.Now()
+	if err := p.summaries.acquire(ctx); err != nil {
+		result.Error = err
+		return result
+	}
+	summarizing, cancel := deadline(ctx, "summary", p.config.Timeouts.Summarize)
+	summary, err := p.summariser.SummariseContent(summarizing, file.SHA256, document.title, text)
+	err = timedOut(summarizing, err)
+	cancel()
+	p.summaries.release()
+	if err != nil {
+		result.Error = fmt.Errorf("summarization failed: %w", err)
+		return result
+	}
+	result.Model = summary.Model
+	result.Cost = summary.Cost
+	if !summary.Cached {
+		p.recordCost(&db.Cost{
+			RunID:    p.runID,
+			FileID:   file.ID,
+			Kind:     db.CostLLM,
+			Provider: summary.Provider,
+			Model:    summary.Model,
+			Amount:   summary.Cost,
+		})
+	}
+
+	if err := p.db.UpdateSummary(file.ID, summary.Summary, summary.Model); err != nil {
+		result.Error = fmt.Errorf("failed to record summary: %w", err)
+		return result
+	}
+	if summary.Entities != nil {
+		if err := p.db.SetEntities(file.ID, entitiesByKind(summary.Entities)); err != nil {
+			result.Error = fmt.Errorf("failed to record entities: %w", err)
+			return result
+		}
+		p.classify(file, "", summary.Entities.DocumentType)
+	}
+	p.recordProvenance(&db.Provenance{
+		FileID:        file.ID,
+		Artifact:      db.ArtifactSummary,
+		Tool:          summary.Provider,
+		Model:         summary.Model,
+		PromptVersion: summary.PromptVersion,
+		Duration:      time.Since(start),
+		Cost:          summary.Cost,
+		Details:       summaryDetails(summary),
+	})
+	if err := p.marks.markProcessed(file.ID); err != nil {
+		result.Error = fmt.Errorf("failed to record processing: %w", err)
+	}
+
+	return result
+}
+
+// textProcessor returns the processor of a file if it derives text from it
+func (p *Pipeline) textProcessor(file *db.FileStatus) (TextProcessor, bool) {
+	processor, ok := p.processors.For(file).(TextProcessor)
+	return processor, ok
+}
+
+// mediaProcessor returns the processor of a file if it converts it
+func (p *Pipeline) mediaProcessor(file *db.FileStatus) (MediaProcessor, bool) {
+	processor, ok := p.processors.For(file).(MediaProcessor)
+	return processor, ok
+}
+
+// ProcessVideo transcodes a video into the scratch folder and records how
+// the transcode was produced. The caller removes the transcode with
+// scratch.Remove once it is uploaded, as ProcessMedia does.
+func (p *Pipeline) ProcessVideo(ctx context.Context, file *db.FileStatus) (*video.TranscodeResult, error) {
+	options := video.DefaultOptions()
+	options.SourcePath = file.Path
+
+	if !p.caps.Transcoding.Available {
+		return nil, fmt.Errorf("cannot transcode %s: %w", file.Path, tools.ErrNotInstalled)
+	}
+	if err := p.waitForPower(ctx); err != nil {
+		return nil, err
+	}
+	if err := p.transcodes.acquire(ctx); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	transcoding, cancel := deadline(ctx, "transcode", p.config.Timeouts.Transcode)
+	transcoded, err := video.Transcode(transcoding, options)
+	cancel()
+	p.transcodes.release()
+	if err != nil {
+		return nil, timedOut(transcoding, err)
+	}
+	if transcoded.Error != nil {
+		return transcoded, timedOut(transcoding, transcoded.Error)
+	}
+
+	p.recordProvenance(&db.Provenance{
+		FileID:      file.ID,
+		Artifact:    db.ArtifactTranscode,
+		Tool:        "ffmpeg",
+		ToolVersion: tools.Version("ffmpeg"),
+		Duration:    time.Since(start),
+		Details:     fmt.Sprintf("encoder=%s quality=%s", transcoded.Encoder, options.Quality),
+	})
+
+	return transcoded, nil
+}
+
+// ProcessImage converts an image (e.g. HEIC or AVIF) into the scratch
+// folder and records how the conversion was produced. The caller removes the
+// conversion with scratch.Remove once it is uploaded.
+func (p *Pipeline) ProcessImage(ctx context.Context, file *db.FileStatus) (*image.ConvertResult, error) {
+	options := image.DefaultOptions()
+	options.SourcePath = file.Path
+
+	if !p.caps.CanConvert(file.Path) {
+		return nil, fmt.Errorf("cannot convert %s: %w", file.Path, tools.ErrNotInstalled)
+	}
+	if err := p.conversions.acquire(ctx); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	converting, cancel := deadline(ctx, "conversion", p.config.Timeouts.Transcode)
+	converted, err := image.Convert(converting, options)
+	cancel()
+	p.conversions.release()
+	if err != nil {
+		return nil, timedOut(converting, err)
+	}
+	if converted.Error != nil {
+		return converted, timedOut(converting, converted.Error)
+	}
+
+	p.recordProvenance(&db.Provenance{
+		FileID:      file.ID,
+		Artifact:    db.ArtifactConversion,
+		Tool:        converted.Tool,
+		ToolVersion: tools.Version(converted.Tool),
+		Duration:    time.Since(start),
+		Details:     fmt.Sprintf("format=%s quality=%d", options.OutputFormat, options.Quality),
+	})
+
+	return converted, nil
+}
+
+// recordProvenance stores a provenance record. Failing to record provenance
+// doesn't fail the file, so errors are only reported.
+func (p *Pipeline) recordProvenance(record *db.Provenance) {
+	if err := p.db.RecordProvenance(record); err != nil {
+		p.log.Warn("could not record provenance",
+			"artifact", record.Artifact, "file_id", record.FileID, "error", err)
+	}
+}
+
+// classify tags a document with the categories its text or document type
+// puts it in. Failing to tag it doesn't fail the file, so errors are only
+// reported.
+func (p *Pipeline) classify(file *db.FileStatus, text, documentType string) {
+	tags := p.config.Classifier.ClassifyText(text, documentType)
+	if len(tags) == 0 {
+		return
+	}
+	if err := p.db.AddTags(file.ID, tags...); err != nil {
+		p.log.Warn("could not tag document", "path", file.Path, "tags", tags, "error", err)
+		return
+	}
+	p.log.Debug("classified document", "path", file.Path, "tags", tags)
+}
+
+// summaryDetails describes how a summary was made, for its provenance
+func summaryDetails(summary *summariser.Summary) string {
+	if summary.Cached {
+		return fmt.Sprintf("level=%s cached", summary.Level)
+	}
+	return fmt.Sprintf("level=%s", summary.Level)
+}
+
+// monthlySpend returns the LLM spend by provider since the start of the
+// month
+func monthlySpend(database *db.DB, logger *slog.Logger) map[string]float64 {
+	now := time.Now()
+	groups, err := database.CostsBy("provider", time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()))
+	if err != nil {
+		logger.Warn("could not read this month's LLM spend", "error", err)
+	}
+	spent := make(map[string]float64)
+	for _, group := range groups {
+		spent[group.Key] = group.Amount
+	}
+	return spent
+}
+
+// recordCost stores the cost of a request. Failing to record it doesn't fail
+// the file, so errors are only reported.
+func (p *Pipeline) recordCost(cost *db.Cost) {
+	if err := p.db.RecordCost(cost); err != nil {
+		p.log.Warn("could not record cost", "kind", cost.Kind, "file_id", cost.FileID, "error", err)
+	}
+}
+
+// toolVersion returns the version of an extractor, skipping the built-in
+// ones and plugins
+func toolVersion(extractor string) string {
+	if strings.HasPrefix(extractor, "plugin:") {
+		return ""
+	}
+	switch extractor {
+	case "", "native", "fallback", "archive":
+		return ""
+	}
+	return tools.Version(extractor)
+}
+
+// Stage names registered with the progress tracker
+const (
+	StageScan      = "scan"
+	StageDocuments = "documents"
+	StageMedia     = "media"
+	StageCaptions  = "captions"
+	// StageExtraction counts the documents of StageDocuments whose text has
+	// been extracted, ahead of their summaries
+	StageExtraction = "extraction"
+)
+
+// Run scans a source directory, processes the documents found in it,
+// transcodes its videos and photos and captions the photos if configured,
+// reporting progress on tracker. Stage totals come from the scan itself, so
+// percentages and ETAs reflect the actual work.
+//
+// Cancelling ctx interrupts the run: the scan stops, even in the middle of
+// hashing a file, and files already being processed are finished. Those are marked
+// processed, so a later run picks up the rest.
+func (p *Pipeline) Run(ctx context.Context, scanner *scan.Scanner, tracker *progress.Tracker) error {
+	scanner.SetHashWorkers(p.config.Limits.Hashes)
+	scanner.SetHashGate(func() error {
+		if err := tracker.Wait(ctx); err != nil {
+			return err
+		}
+		return p.waitForPower(ctx)
+	})
+	p.stage = StageScan
+	if err := scanStage(ctx, scanner, tracker); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("interrupted during %s: %w", StageScan, ctx.Err())
+		}
+		return err
+	}
+	if err := p.ProcessDocuments(ctx, tracker); err != nil {
+		return err
+	}
+	if err := p.ProcessMedia(ctx, tracker); err != nil {
+		return err
+	}
+	return p.CaptionPhotos(ctx, tracker)
+}
+
+// Scan runs the scan stage on its own. Pausing the tracker pauses hashing,
+// and cancelling ctx stops the scan.
+func Scan(ctx context.Context, scanner *scan.Scanner, tracker *progress.Tracker) error {
+	scanner.SetHashGate(func() error {
+		return tracker.Wait(ctx)
+	})
+	return scanStage(ctx, scanner, tracker)
+}
+
+// scanStage runs the scan stage. A size-only pass sizes the stage in bytes
+// before hashing starts; the totals are corrected with what was actually
+// scanned.
+func scanStage(ctx context.Context, scanner *scan.Scanner, tracker *progress.Tracker) error {
+	estimate, err := scanner.Estimate()
+	if err != nil {
+		return fmt.Errorf("failed to estimate source size: %w", err)
+	}
+	tracker.UpdateTotals(estimate.Files, estimate.Bytes)
+	tracker.AddByteStage(StageScan, "Scanning files", estimate.Bytes)
+
+	scanner.SetProgress(func(file scan.FileInfo) {
+		if !file.IsDir {
+			tracker.IncrementStage(StageScan, file.Size)
+			tracker.UpdateFileStats(1, 0, 0, file.Size)
+		}
+	})
+	defer scanner.SetProgress(nil)
+
+	if err := scanner.Scan(ctx); err != nil {
+		return fmt.Errorf("scan failed: %w", err)
+	}
+	tracker.CompleteStage(StageScan)
+
+	scanned := scanner.Scanned()
+	tracker.UpdateTotals(scanned.Files, scanned.Bytes)
+	return nil
+}
+
+// ProcessDocuments extracts and summarizes every unprocessed document, with
+// the stage sized by the number of documents found. Documents that no
+// installed tool can extract are counted as skipped without being queued.
+// When ctx is cancelled no more documents are started, but those in progress
+// are finished.
+//
+// Extraction runs as a stage of its own: a pool of workers extracts the
+// documents, sharing the Tika server and its connections, a writer stores
+// their text in batches and the summary workers take the documents stored.
+func (p *Pipeline) ProcessDocuments(ctx context.Context, tracker *progress.Tracker) error {
+	p.stage = StageDocuments
+	var documents, size, unextractable int64
+	tika := false
+	err := p.db.ForEachUnprocessedPage(p.source, pageSize, func(files []*db.FileStatus) error {
+		for _, file := range files {
+			processor, ok := p.textProcessor(file)
+			switch {
+			case !ok:
+			case !processor.Available(file):
+				p.log.Debug("no extractor installed", "path", file.Path, "processor", processor.Name())
+				unextractable++
+			default:
+				documents++
+				size += file.Size
+				tika = tika || p.caps.ExtractionTool(file.Path) == "tika-server"
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list unprocessed files: %w", err)
+	}
+	tracker.UpdateFileStats(0, unextractable, 0, 0)
+	if documents == 0 {
+		return nil
+	}
+
+	// The first documents would otherwise wait for the server to start
+	// within their extraction timeouts
+	if tika {
+		if err := doc.StartTikaServer(ctx); err != nil {
+			p.log.Warn("tika server unavailable", "error", err)
+		}
+	}
+
+	p.log.Info("processing documents", "documents", documents, "unextractable", unextractable)
+	tracker.AddStage(StageExtraction, "Extracting text", documents)
+	tracker.SetStageBytes(StageExtraction, size)
+	tracker.AddStage(StageDocuments, "Processing documents", documents)
+	tracker.SetStageBytes(StageDocuments, size)
+
+	p.marks.start()
+
+	done := func(result *Result) {
+		file := result.File
+		switch {
+		case result.Error != nil:
+			p.log.Warn("document failed", "path", file.Path, "error", result.Error)
+			tracker.UpdateFileStats(0, 0, 1, 0)
+			p.recordFailure(file, result.Error)
+			// Reading a file that timed out could take as long
+			// again; the next run retries it
+			if !errors.Is(result.Error, ErrTimedOut) {
+				p.quarantineIfUnreadable(file)
+			}
+		case result.Skipped:
+			p.log.Debug("document skipped", "path", file.Path)
+			tracker.UpdateFileStats(0, 1, 0, 0)
+		default:
+			p.log.Debug("document processed", "path", file.Path, "extractor", result.Extractor,
+				"quality", result.Quality, "model", result.Model, "cost", result.Cost)
+		}
+		tracker.IncrementStage(StageDocuments, 1)
+		tracker.IncrementStageBytes(StageDocuments, file.Size)
+	}
+
+	// Extraction and transcription slots bound the tools, with a worker
+	// for each so that long transcriptions don't hold up the documents
+	queue := make(chan *db.FileStatus)
+	extracted := make(chan *extractedDocument, extractionBatchSize)
+	stored := make(chan *extractedDocument)
+	work := context.WithoutCancel(ctx)
+	var extractors, summarizers sync.WaitGroup
+	for i := 0; i < p.config.Limits.Extractions+p.config.Limits.Transcriptions; i++ {
+		extractors.Add(1)
+		go func() {
+			defer extractors.Done()
+			for file := range queue {
+				document, result := p.extract(work, file)
+				tracker.IncrementStage(StageExtraction, 1)
+				tracker.IncrementStageBytes(StageExtraction, file.Size)
+				if document == nil {
+					done(result)
+					continue
+				}
+				extracted <- document
+			}
+		}()
+	}
+	go p.writeExtractions(extracted, stored, done)
+	// Summary slots bound the LLM requests
+	for i := 0; i < p.config.Limits.Summaries; i++ {
+		summarizers.Add(1)
+		go func() {
+			defer summarizers.Done()
+			for document := range stored {
+				done(p.summarizeDocument(work, document))
+			}
+		}()
+	}
+
+	started, err := p.dispatch(ctx, tracker, queue, func(file *db.FileStatus) bool {
+		processor, ok := p.textProcessor(file)
+		return ok && processor.Available(file)
+	})
+	close(queue)
+	extractors.Wait()
+	close(extracted)
+	summarizers.Wait()
+	if err := p.marks.finish(); err != nil {
+		return fmt.Errorf("failed to record processing: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list unprocessed files: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		p.remaining = max(documents-started, 0)
+		return fmt.Errorf("interrupted during %s: %w", StageDocuments, err)
+	}
+	tracker.CompleteStage(StageExtraction)
+	tracker.CompleteStage(StageDocuments)
+
+	return nil
+}
+
+// pageSize is how many unprocessed files the stages read from the database
+// at a time
+const pageSize = 500
+
+// dispatch queues the unprocessed files include selects, reading them from
+// the database a page at a time, and writes the files marked processed so
+// far after each page, so that a run that is killed loses little work. It
+// returns how many files were queued, stopping early when ctx is done.
+func (p *Pipeline) dispatch(ctx context.Context, tracker *progress.Tracker, queue chan<- *db.FileStatus, include func(*db.FileStatus) bool) (int64, error) {
+	var started int64
+	err := p.db.WithContext(ctx).ForEachUnprocessedPage(p.source, pageSize, func(files []*db.FileStatus) error {
+		for _, file := range files {
+			if !include(file) {
+				continue
+			}
+			if err := tracker.Wait(ctx); err != nil {
+				return err
+			}
+			select {
+			case queue <- file:
+				started++
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return p.marks.checkpoint()
+	})
+	if ctx.Err() != nil {
+		err = nil
+	}
+	return started, err
+}
+
+// isBelow reports whether path is below root, or root is empty
+func isBelow(path, root string) bool {
+	return root == "" || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/")
+}
+
+// ProcessMedia transcodes the unprocessed videos and converts the HEIC and
+// AVIF photos, uploading each result to the media destination, if one is
+// set. Files that no installed tool can handle are counted as skipped. When
+// ctx is cancelled no more files are started, but those in progress are
+// finished.
+func (p *Pipeline) ProcessMedia(ctx context.Context, tracker *progress.Tracker) error {
+	if p.media == nil {
+		return nil
+	}
+	p.stage = StageMedia
+	var media, size, unconvertible int64
+	err := p.db.ForEachUnprocessedPage(p.source, pageSize, func(files []*db.FileStatus) error {
+		for _, file := range files {
+			processor, ok := p.mediaProcessor(file)
+			switch {
+			case !ok:
+			case !processor.Available(file):
+				p.log.Debug("no transcoder or converter installed", "path", file.Path, "processor", processor.Name())
+				unconvertible++
+			default:
+				media++
+				size += file.Size
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list unprocessed files: %w", err)
+	}
+	tracker.UpdateFileStats(0, unconvertible, 0, 0)
+	if media == 0 {
+		return nil
+	}
+
+	p.log.Info("transcoding and converting media", "files", media, "unconvertible", unconvertible)
+	tracker.AddStage(StageMedia, "Transcoding videos and converting photos", media)
+	tracker.SetStageBytes(StageMedia, size)
+
+	p.marks.start()
+
+	// Transcode and conversion slots bound the tools; a worker for each
+	// lets conversions go on during a long transcode
+	queue := make(chan *db.FileStatus)
+	work := context.WithoutCancel(ctx)
+	var wg sync.WaitGroup
+	for i := 0; i < p.config.Limits.Transcodes+p.config.Limits.Conversions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range queue {
+				if remote, err := p.processMedia(work, file); err != nil {
+					p.log.Warn("media file failed", "path", file.Path, "error", err)
+					tracker.UpdateFileStats(0, 0, 1, 0)
+					p.recordFailure(file, err)
+				} else {
+					p.log.Debug("media file uploaded", "path", file.Path, "name", remote)
+				}
+				tracker.IncrementStage(StageMedia, 1)
+				tracker.IncrementStageBytes(StageMedia, file.Size)
+			}
+		}()
+	}
+
+	started, err := p.dispatch(ctx, tracker, queue, func(file *db.FileStatus) bool {
+		processor, ok := p.mediaProcessor(file)
+		return ok && processor.Available(file)
+	})
+	close(queue)
+	wg.Wait()
+	if err := p.marks.finish(); err != nil {
+		return fmt.Errorf("failed to record processing: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list unprocessed files: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		p.remaining = max(media-started, 0)
+		return fmt.Errorf("interrupted during %s: %w", StageMedia, err)
+	}
+	tracker.CompleteStage(StageMedia)
+
+	return nil
+}
+
+// processMedia transcodes or converts a media file, uploads the result to
+// the media destination and marks the file processed. The result is removed
+// from the scratch folder once uploaded, or once the upload failed since a
+// later run makes it again. It returns the name it was uploaded under.
+func (p *Pipeline) processMedia(ctx context.Context, file *db.FileStatus) (string, error) {
+	processor, ok := p.mediaProcessor(file)
+	if !ok {
+		return "", fmt.Errorf("no processor converts %s", file.Path)
+	}
+	output, format, err := processor.Convert(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := scratch.Remove(output); err != nil {
+			p.log.Warn("could not remove intermediate file", "path", output, "error", err)
+		}
+	}()
+
+	remote := mediaName(file, format)
+	uploaded, err := p.media.Put(ctx, output, remote, map[string]string{"source-sha256": file.SHA256})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload %s: %w", remote, err)
+	}
+	p.recordProvenance(&db.Provenance{
+		FileID:   file.ID,
+		Artifact: db.ArtifactUpload,
+		Tool:     "media",
+		Duration: uploaded.ElapsedTime,
+		Details:  "name=" + uploaded.RemotePath,
+	})
+	if err := p.marks.markProcessed(file.ID); err != nil {
+		return "", fmt.Errorf("failed to record processing: %w", err)
+	}
+	return uploaded.RemotePath, nil
+}
+
+// mediaName is the name a transcode or conversion is uploaded under: the
+// path of the original below media/ and its drive, with the extension of
+// the new format
+func mediaName(file *db.FileStatus, format string) string {
+	relative := filepath.ToSlash(file.RelativePath)
+	relative = strings.TrimSuffix(relative, path.Ext(relative)) + "." + format
+	return path.Join("media", drives.NameFromPath(file.Path), relative)
+}
+
+// totalSize returns the size of files in bytes
+func totalSize(files []*db.FileStatus) int64 {
+	var size int64
+	for _, file := range files {
+		size += file.Size
+	}
+	return size
+}
+
+// previewSize is the longest side of the photos sent to vision models, in
+// pixels; larger ones cost more without better captions
+const previewSize = 768
+
+// CaptionPhotos captions the photos that have none yet, if captioning is
+// configured and a vision model is available. Captioning stops once the
+// vision models are over the cost caps; the rest are captioned by a later
+// run.
+func (p *Pipeline) CaptionPhotos(ctx context.Context, tracker *progress.Tracker) error {
+	if !p.config.CaptionPhotos {
+		return nil
+	}
+	if !p.summariser.CanCaption() {
+		p.log.Warn("no vision model available, photos are not captioned")
+		return nil
+	}
+	p.stage = StageCaptions
+	files, err := p.db.GetUncaptionedFiles()
+	if err != nil {
+		return fmt.Errorf("failed to list uncaptioned files: %w", err)
+	}
+	var photos []*db.FileStatus
+	for _, file := range files {
+		if image.IsPhoto(file.Path) && isBelow(file.Path, p.source) {
+			photos = append(photos, file)
+		}
+	}
+	if len(photos) == 0 {
+		return nil
+	}
+
+	p.log.Info("captioning photos", "photos", len(photos))
+	tracker.AddStage(StageCaptions, "Captioning photos", int64(len(photos)))
+	tracker.SetStageBytes(StageCaptions, totalSize(photos))
+	work := context.WithoutCancel(ctx)
+	for i, file := range photos {
+		if err := tracker.Wait(ctx); err != nil {
+			p.remaining = int64(len(photos) - i)
+			return fmt.Errorf("interrupted during %s: %w", StageCaptions, err)
+		}
+		caption, err := p.CaptionPhoto(work, file)
+		switch {
+		case errors.Is(err, summariser.ErrOverCap):
+			p.log.Warn("captioning stopped", "reason", err, "uncaptioned", len(photos)-i)
+			return nil
+		case err != nil:
+			p.log.Warn("captioning failed", "path", file.Path, "error", err)
+			tracker.UpdateFileStats(0, 0, 1, 0)
+			p.recordFailure(file, err)
+		default:
+			p.log.Debug("photo captioned", "path", file.Path, "caption", caption.Text,
+				"model", caption.Model, "cost", caption.Cost)
+		}
+		tracker.IncrementStage(StageCaptions, 1)
+		tracker.IncrementStageBytes(StageCaptions, file.Size)
+	}
+	tracker.CompleteStage(StageCaptions)
+
+	return nil
+}
+
+// CaptionPhoto describes a photo in one line with the cheapest vision model
+// within the cost caps, and stores the caption
+func (p *Pipeline) CaptionPhoto(ctx context.Context, file *db.FileStatus) (*summariser.Caption, error) {
+	if err := p.conversions.acquire(ctx); err != nil {
+		return nil, err
+	}
+	preview, err := image.Preview(ctx, file.Path, previewSize)
+	p.conversions.release()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if err := p.summaries.acquire(ctx); err != nil {
+		return nil, err
+	}
+	captioning, cancel := deadline(ctx, "caption", p.config.Timeouts.Summarize)
+	caption, err := p.summariser.Caption(captioning, preview, "image/jpeg")
+	err = timedOut(captioning, err)
+	cancel()
+	p.summaries.release()
+	if err != nil {
+		return nil, err
+	}
+	p.recordCost(&db.Cost{
+		RunID:    p.runID,
+		FileID:   file.ID,
+		Kind:     db.CostLLM,
+		Provider: caption.Provider,
+		Model:    caption.Model,
+		Amount:   caption.Cost,
+	})
+	if err := p.db.SetCaption(file.ID, caption.Text, caption.Model); err != nil {
+		return nil, fmt.Errorf("failed to record caption: %w", err)
+	}
+	p.recordProvenance(&db.Provenance{
+		FileID:   file.ID,
+		Artifact: db.ArtifactCaption,
+		Tool:     caption.Provider,
+		Model:    caption.Model,
+		Duration: time.Since(start),
+		Cost:     caption.Cost,
+	})
+
+	return caption, nil
+}
+
+// recordFailure records a failed file against the current run, if any
+func (p *Pipeline) recordFailure(file *db.FileStatus, err error) {
+	if p.runID == 0 {
+		return
+	}
+	if dbErr := p.db.AddRunError(p.runID, file.Path, err); dbErr != nil {
+		p.log.Warn("could not record error in the run history", "path", file.Path, "error", dbErr)
+	}
+}
+
+// quarantineIfUnreadable sets aside a document whose extraction failed if
+// reading it fails too, as on a failing drive, so later runs skip it until
+// a scan with --retry-quarantined reads it
+func (p *Pipeline) quarantineIfUnreadable(file *db.FileStatus) {
+	f, err := os.Open(file.Path)
+	if err == nil {
+		_, err = io.Copy(io.Discard, f)
+		f.Close()
+	}
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	p.log.Warn("quarantined unreadable file", "path", file.Path, "error", err)
+	if err := p.db.Quarantine(file.Path, db.QuarantineExtraction, err); err != nil {
+		p.log.Warn("could not record quarantined file", "path", file.Path, "error", err)
+	}
+}
+
+// Remaining returns the number of documents or photos an interrupted run
+// left unprocessed
+func (p *Pipeline) Remaining() int64 {
+	return p.remaining
+}
+
+// Stage returns the stage the run reached, which is where an interrupted
+// run stopped
+func (p *Pipeline) Stage() string {
+	return p.stage
+}
+
+// CanSummarize reports whether any model can summarize documents
+func (p *Pipeline) CanSummarize() bool {
+	return p.caps.Summarization.Available()
+}
+
+// TotalCost returns the LLM spend incurred by this pipeline so far
+func (p *Pipeline) TotalCost() float64 {
+	return p.summariser.GetTotalCost()
+}
@@ -0,0 +1,320 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/audio"
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/progress"
+	"github.com/jth/archiver/internal/scan"
+	"github.com/jth/archiver/internal/summariser"
+)
+
+// scanInto catalogs dir into a new database and opens it
+func scanInto(t *testing.T, dir string) *db.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "archive.db")
+	scanner, err := scan.NewScanner(dir, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	scanner.Close()
+
+	database, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func TestProcessDocumentsSkipsProcessedFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("Minutes of the annual meeting"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	database := scanInto(t, dir)
+	p := New(Config{}, database)
+	// Keep the text only, whatever models this machine has
+	p.caps.Summarization.Local, p.caps.Summarization.Cloud = nil, nil
+
+	first := progress.NewTracker()
+	first.SetQuiet(true)
+	if err := p.ProcessDocuments(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	if stage := first.GetStage(StageDocuments); stage == nil || stage.Current != 1 {
+		t.Fatalf("first run processed %+v, want the one document", stage)
+	}
+	file, err := database.GetFileByPath(filepath.Join(dir, "notes.txt"))
+	if err != nil || file == nil || !file.Processed {
+		t.Fatalf("document not marked processed: %+v, %v", file, err)
+	}
+
+	second := progress.NewTracker()
+	second.SetQuiet(true)
+	if err := p.ProcessDocuments(context.Background(), second); err != nil {
+		t.Fatal(err)
+	}
+	if stage := second.GetStage(StageDocuments); stage != nil {
+		t.Errorf("second run processed %d documents again", stage.Current)
+	}
+}
+
+func TestProcessDocumentsBelowSource(t *testing.T) {
+	dir := t.TempDir()
+	for _, folder := range []string{"resumed", "other"} {
+		if err := os.Mkdir(filepath.Join(dir, folder), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, folder, "notes.txt"), []byte("Quarterly report"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	database := scanInto(t, dir)
+	p := New(Config{}, database)
+	p.caps.Summarization.Local, p.caps.Summarization.Cloud = nil, nil
+	p.SetSource(filepath.Join(dir, "resumed"))
+
+	tracker := progress.NewTracker()
+	tracker.SetQuiet(true)
+	if err := p.ProcessDocuments(context.Background(), tracker); err != nil {
+		t.Fatal(err)
+	}
+	files, err := database.GetUnprocessedFiles("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != filepath.Join(dir, "other", "notes.txt") {
+		t.Errorf("unprocessed after processing one folder: %v", files)
+	}
+}
+
+func TestMediaName(t *testing.T) {
+	file := &db.FileStatus{Path: "/Volumes/OldDrive/Trips/beach.MOV", RelativePath: "Trips/beach.MOV"}
+	if got := mediaName(file, "mp4"); got != "media/OldDrive/Trips/beach.mp4" {
+		t.Errorf("mediaName = %q", got)
+	}
+}
+
+func TestPausingBlocksScan(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "photo.jpg"), []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scanner, err := scan.NewScanner(dir, filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scanner.Close()
+
+	tracker := progress.NewTracker()
+	tracker.SetQuiet(true)
+	tracker.Pause()
+	done := make(chan error, 1)
+	go func() {
+		done <- Scan(context.Background(), scanner, tracker)
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("scan finished while paused: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	tracker.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("scan didn't resume")
+	}
+	if scanned := scanner.Scanned(); scanned.Files != 1 {
+		t.Errorf("scanned %d files, want 1", scanned.Files)
+	}
+}
+
+func TestProcessDocumentsExtractionStage(t *testing.T) {
+	dir := t.TempDir()
+	// More than one batch of documents
+	const documents = extractionBatchSize*2 + 7
+	for i := 0; i < documents; i++ {
+		content := []byte(fmt.Sprintf("Minutes of meeting %d", i))
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("minutes%03d.txt", i)), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	database := scanInto(t, dir)
+	p := New(Config{Limits: Limits{Extractions: 3}}, database)
+	p.caps.Summarization.Local, p.caps.Summarization.Cloud = nil, nil
+
+	tracker := progress.NewTracker()
+	tracker.SetQuiet(true)
+	if err := p.ProcessDocuments(context.Background(), tracker); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{StageExtraction, StageDocuments} {
+		if stage := tracker.GetStage(name); stage == nil || stage.Current != documents {
+			t.Errorf("%s stage = %+v, want %d documents", name, stage, documents)
+		}
+	}
+
+	file, err := database.GetFileByPath(filepath.Join(dir, "minutes042.txt"))
+	if err != nil || file == nil || !file.Processed || file.Extractor != "native" {
+		t.Fatalf("document not stored: %+v, %v", file, err)
+	}
+	if text, err := database.GetText(file.ID); err != nil || text != "Minutes of meeting 42" {
+		t.Errorf("text = %q, %v", text, err)
+	}
+	if metadata, err := database.GetMetadata(file.ID); err != nil || metadata["encoding"] != "utf-8" {
+		t.Errorf("metadata = %v, %v; want the encoding", metadata, err)
+	}
+	records, err := database.GetProvenance(file.ID)
+	if err != nil || len(records) != 1 || records[0].Artifact != db.ArtifactExtraction {
+		t.Errorf("provenance = %+v, %v; want the extraction", records, err)
+	}
+	if remaining, _ := database.GetUnprocessedFiles(""); len(remaining) != 0 {
+		t.Errorf("%d documents left unprocessed", len(remaining))
+	}
+}
+
+func TestResummarize(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"minutes.txt", "agenda.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("Minutes of the annual meeting"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	database := scanInto(t, dir)
+	minutes, _ := database.GetFileByPath(filepath.Join(dir, "minutes.txt"))
+	agenda, _ := database.GetFileByPath(filepath.Join(dir, "agenda.txt"))
+	err := database.SaveExtractions([]db.Extraction{{FileID: minutes.ID, Extractor: "native", Quality: 1,
+		Text: "Minutes of the annual meeting", Metadata: map[string]string{"title": "Annual meeting"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The drive is gone: only the stored text is summarized
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// A model with an API key, and a cap too small for any request to it
+	t.Setenv("OPENAI_API_KEY", "test")
+	p := New(Config{CostCap: 0.001}, database)
+
+	if result := p.Resummarize(context.Background(), agenda); !result.Skipped {
+		t.Errorf("file without stored text: %+v, want it skipped", result)
+	}
+	result := p.Resummarize(context.Background(), minutes)
+	if !errors.Is(result.Error, summariser.ErrBudgetReached) {
+		t.Errorf("Resummarize over the cost cap = %+v, want ErrBudgetReached", result)
+	}
+	if p.TotalCost() != 0 {
+		t.Errorf("spent $%v over the cost cap", p.TotalCost())
+	}
+}
+
+// fakeTranscriber transcribes every file to text, failing those in failures
+type fakeTranscriber struct {
+	text     string
+	failures map[string]error
+	models   []string
+}
+
+func (f *fakeTranscriber) Transcribe(ctx context.Context, path string, options audio.Options) (*audio.Transcript, error) {
+	if err := f.failures[filepath.Base(path)]; err != nil {
+		return nil, err
+	}
+	f.models = append(f.models, options.Model)
+	return &audio.Transcript{Text: f.text, Model: options.Model}, nil
+}
+
+func TestProcessDocumentsTranscribesAudio(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"interview.mp3", "voicemail.m4a"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("audio of "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	database := scanInto(t, dir)
+	interview, _ := database.GetFileByPath(filepath.Join(dir, "interview.mp3"))
+	voicemail, _ := database.GetFileByPath(filepath.Join(dir, "voicemail.m4a"))
+	// A cached summary by whichever model is tried first, so that no
+	// request is made
+	for _, model := range summariser.DefaultConfig().Models {
+		err := database.CacheSummary(&db.CachedSummary{SHA256: interview.SHA256, Level: string(summariser.SummaryDefault),
+			ModelFamily: summariser.Family(model), Summary: "An interview about the harbour", Model: model.Name, Provider: model.Provider})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	run, err := database.StartRun("process", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("OPENAI_API_KEY", "test")
+	transcriber := &fakeTranscriber{
+		text:     "We talked about the harbour",
+		failures: map[string]error{"voicemail.m4a": errors.New("whisper exited with status 1")},
+	}
+	p := New(Config{Transcriber: transcriber, WhisperModel: "small"}, database)
+	p.caps.Transcription.Available = true
+	p.SetRun(run.ID)
+
+	tracker := progress.NewTracker()
+	tracker.SetQuiet(true)
+	if err := p.ProcessDocuments(context.Background(), tracker); err != nil {
+		t.Fatal(err)
+	}
+	if stage := tracker.GetStage(StageDocuments); stage == nil || stage.Current != 2 {
+		t.Errorf("documents stage = %+v, want both files", stage)
+	}
+	if len(transcriber.models) != 1 || transcriber.models[0] != "small" {
+		t.Errorf("transcribed with models %v, want the configured one", transcriber.models)
+	}
+
+	file, err := database.GetFileByPath(interview.Path)
+	if err != nil || file == nil || !file.Processed || file.Summary != "An interview about the harbour" {
+		t.Fatalf("transcribed file = %+v, %v; want it summarized", file, err)
+	}
+	if text, err := database.GetText(file.ID); err != nil || text != "We talked about the harbour" {
+		t.Errorf("text = %q, %v; want the transcript", text, err)
+	}
+	records, err := database.GetProvenance(file.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts := map[string]string{}
+	for _, record := range records {
+		artifacts[record.Artifact] = record.Model
+	}
+	if model, ok := artifacts[db.ArtifactTranscript]; !ok || model != "small" {
+		t.Errorf("provenance = %v, want the transcript by the small model", artifacts)
+	}
+
+	// A failed transcription leaves the file for the next run
+	file, err = database.GetFileByPath(voicemail.Path)
+	if err != nil || file == nil || file.Processed {
+		t.Fatalf("failed file = %+v, %v; want it unprocessed", file, err)
+	}
+	if text, _ := database.GetText(file.ID); text != "" {
+		t.Errorf("failed file has text %q", text)
+	}
+	errs, err := database.GetRunErrors(run.ID)
+	if err != nil || len(errs) != 1 || errs[0].Path != voicemail.Path || !strings.Contains(errs[0].Error, "whisper exited") {
+		t.Errorf("run errors = %+v, %v; want the failed transcription", errs, err)
+	}
+}
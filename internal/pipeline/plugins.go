@@ -0,0 +1,194 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/doc"
+	"github.com/jth/archiver/internal/tools"
+)
+
+// Plugin is an external program deriving text from the files it handles,
+// for formats the archiver can't read itself. It is started once per file
+// with a PluginInput as JSON on stdin and prints a PluginOutput as JSON on
+// stdout; exiting with a non-zero status fails the file.
+type Plugin struct {
+	Name         string
+	Command      []string      // Program and its arguments
+	Extensions   []string      // Extensions handled, with the leading dot
+	ContentTypes []string      // Content type prefixes handled, e.g. "application/acad"
+	Timeout      time.Duration // Defaults to DefaultPluginTimeout
+}
+
+// DefaultPluginTimeout is how long a plugin may take on one file when its
+// configuration doesn't say
+const DefaultPluginTimeout = 5 * time.Minute
+
+// PluginInput describes the file a plugin is run on
+type PluginInput struct {
+	Path         string    `json:"path"`
+	RelativePath string    `json:"relative_path"`
+	Size         int64     `json:"size"`
+	ModTime      time.Time `json:"modified"`
+	ContentType  string    `json:"content_type"`
+	SHA256       string    `json:"sha256"`
+}
+
+// PluginOutput is what a plugin derived from a file. Text is summarized and
+// indexed like the text of a document; Metadata is recorded with the
+// extraction and Tags are added to the file.
+type PluginOutput struct {
+	Text     string            `json:"text"`
+	Title    string            `json:"title,omitempty"`
+	Quality  *float64          `json:"quality,omitempty"` // From 0 to 1; 1 when left out
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+}
+
+// Validate checks that the plugin can be registered
+func (plugin Plugin) Validate() error {
+	switch {
+	case plugin.Name == "":
+		return errors.New("plugin has no name")
+	case len(plugin.Command) == 0:
+		return fmt.Errorf("plugin %s has no command", plugin.Name)
+	case len(plugin.Extensions) == 0 && len(plugin.ContentTypes) == 0:
+		return fmt.Errorf("plugin %s handles no extensions or content types", plugin.Name)
+	}
+	return nil
+}
+
+// pluginProcessor runs a plugin as a TextProcessor
+type pluginProcessor struct {
+	p      *Pipeline
+	plugin Plugin
+}
+
+// RegisterPlugin adds a plugin as the processor of the files it handles,
+// taking precedence over the built-in processors and plugins registered
+// before it
+func (p *Pipeline) RegisterPlugin(plugin Plugin) error {
+	if err := plugin.Validate(); err != nil {
+		return err
+	}
+	if plugin.Timeout <= 0 {
+		plugin.Timeout = DefaultPluginTimeout
+	}
+	p.Register(pluginProcessor{p, plugin})
+	return nil
+}
+
+// Name implements Processor
+func (pp pluginProcessor) Name() string { return "plugin:" + pp.plugin.Name }
+
+// Handles implements Processor
+func (pp pluginProcessor) Handles(file *db.FileStatus) bool {
+	ext := strings.ToLower(filepath.Ext(file.Path))
+	if slices.ContainsFunc(pp.plugin.Extensions, func(handled string) bool { return strings.EqualFold(handled, ext) }) {
+		return true
+	}
+	return file.ContentType != "" && slices.ContainsFunc(pp.plugin.ContentTypes, func(prefix string) bool {
+		return strings.HasPrefix(file.ContentType, prefix)
+	})
+}
+
+// Available implements Processor
+func (pp pluginProcessor) Available(*db.FileStatus) bool {
+	return tools.Available(pp.plugin.Command[0])
+}
+
+// Extract implements TextProcessor
+func (pp pluginProcessor) Extract(ctx context.Context, file *db.FileStatus) (string, *doc.ExtractResult, error) {
+	if err := pp.p.extractions.acquire(ctx); err != nil {
+		return "", nil, err
+	}
+	defer pp.p.extractions.release()
+
+	extracted := &doc.ExtractResult{Path: file.Path, Extractor: pp.Name()}
+	ctx, cancel := deadline(ctx, "extraction", pp.p.config.Timeouts.Extract)
+	defer cancel()
+	output, err := pp.run(ctx, file)
+	if err != nil {
+		extracted.Error = timedOut(ctx, err)
+		return db.ArtifactExtraction, extracted, nil
+	}
+
+	extracted.Text = output.Text
+	extracted.Title = output.Title
+	extracted.Metadata = output.Metadata
+	extracted.Quality = 1
+	if output.Quality != nil {
+		extracted.Quality = *output.Quality
+	}
+	if len(output.Tags) > 0 {
+		if err := pp.p.db.AddTags(file.ID, output.Tags...); err != nil {
+			pp.p.log.Warn("could not tag file", "path", file.Path, "plugin", pp.plugin.Name, "error", err)
+		}
+	}
+	return db.ArtifactExtraction, extracted, nil
+}
+
+// run starts the plugin on file and decodes what it prints
+func (pp pluginProcessor) run(ctx context.Context, file *db.FileStatus) (*PluginOutput, error) {
+	input, err := json.Marshal(PluginInput{
+		Path:         file.Path,
+		RelativePath: file.RelativePath,
+		Size:         file.Size,
+		ModTime:      file.ModTime,
+		ContentType:  file.ContentType,
+		SHA256:       file.SHA256,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pp.plugin.Timeout)
+	defer cancel()
+	cmd := tools.Command(ctx, pp.plugin.Command[0], pp.plugin.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("plugin %s timed out after %s", pp.plugin.Name, pp.plugin.Timeout)
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("plugin %s failed: %w: %s", pp.plugin.Name, err, lastLine(message))
+		}
+		return nil, fmt.Errorf("plugin %s failed: %w", pp.plugin.Name, err)
+	}
+
+	var output PluginOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("plugin %s printed invalid JSON: %w", pp.plugin.Name, err)
+	}
+	return &output, nil
+}
+
+// lastLine returns the last line of a tool's error output, which usually
+// says what went wrong
+func lastLine(output string) string {
+	return output[strings.LastIndex(output, "\n")+1:]
+}
+
+// metadataDetails formats metadata for a provenance record, sorted by key
+func metadataDetails(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + metadata[key]
+	}
+	return strings.Join(pairs, " ")
+}
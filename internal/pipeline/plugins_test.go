@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlugin(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "house.dwg"), []byte("AC1027 drawing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	database := scanInto(t, dir)
+	file, err := database.GetFileByPath(filepath.Join(dir, "house.dwg"))
+	if err != nil || file == nil {
+		t.Fatalf("file not cataloged: %v", err)
+	}
+
+	p := New(Config{}, database)
+	if err := p.RegisterPlugin(Plugin{Name: "cad", Command: []string{"sh"}}); err == nil {
+		t.Error("expected an error for a plugin handling nothing")
+	}
+
+	// The plugin echoes the path it was given, to check the input
+	script := `path=$(sed 's/.*"path":"\([^"]*\)".*/\1/'); ` +
+		`printf '{"text":"Floor plan %s","metadata":{"layers":"12"},"tags":["cad"]}' "$path"`
+	if err := p.RegisterPlugin(Plugin{Name: "cad", Command: []string{"sh", "-c", script}, Extensions: []string{".DWG"}}); err != nil {
+		t.Fatal(err)
+	}
+	processor, ok := p.textProcessor(file)
+	if !ok || processor.Name() != "plugin:cad" {
+		t.Fatalf("processor for %s = %v", file.Path, p.processors.For(file).Name())
+	}
+	_, extracted, err := processor.Extract(context.Background(), file)
+	if err != nil || extracted.Error != nil {
+		t.Fatalf("Extract: %v, %v", err, extracted.Error)
+	}
+	if extracted.Text != "Floor plan "+file.Path || extracted.Quality != 1 || extracted.Metadata["layers"] != "12" {
+		t.Errorf("extracted %+v", extracted)
+	}
+	if tags, err := database.GetTags(file.ID); err != nil || !slices.Contains(tags, "cad") {
+		t.Errorf("tags = %v, %v", tags, err)
+	}
+
+	// A plugin registered later takes over, and its failures fail the file
+	if err := p.RegisterPlugin(Plugin{Name: "broken", Command: []string{"sh", "-c", "echo 'no license' >&2; exit 3"}, Extensions: []string{".dwg"}}); err != nil {
+		t.Fatal(err)
+	}
+	processor, _ = p.textProcessor(file)
+	_, extracted, err = processor.Extract(context.Background(), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extracted.Error == nil || !strings.Contains(extracted.Error.Error(), "no license") {
+		t.Errorf("expected the plugin's error output in the error, got %v", extracted.Error)
+	}
+}
+
+func TestExtractTimeout(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "house.dwg"), []byte("AC1027 drawing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	database := scanInto(t, dir)
+	file, err := database.GetFileByPath(filepath.Join(dir, "house.dwg"))
+	if err != nil || file == nil {
+		t.Fatalf("file not cataloged: %v", err)
+	}
+
+	p := New(Config{Timeouts: Timeouts{Extract: 200 * time.Millisecond}}, database)
+	if err := p.RegisterPlugin(Plugin{Name: "slow", Command: []string{"sh", "-c", "exec sleep 10"}, Extensions: []string{".dwg"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	result := p.ProcessDocument(context.Background(), file)
+	if !errors.Is(result.Error, ErrTimedOut) {
+		t.Fatalf("expected the extraction to time out, got %v", result.Error)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the file took %s to fail", elapsed)
+	}
+	if processed, _ := database.GetFileByID(file.ID); processed.Processed {
+		t.Error("a file that timed out was marked processed")
+	}
+}
@@ -0,0 +1,350 @@
+package pipeline
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jth/archiver/internal/audio"
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/doc"
+	"github.com/jth/archiver/internal/image"
+	"github.com/jth/archiver/internal/video"
+)
+
+// Processor handles the files of some types, picked by extension or
+// content type. What it does with them depends on the other interfaces it
+// implements: a TextProcessor derives text to summarize and index during
+// the documents stage, and a MediaProcessor makes a copy to upload during
+// the media stage. Files no other processor handles go to DefaultProcessor,
+// which leaves them as scanned.
+type Processor interface {
+	// Name identifies the processor in logs
+	Name() string
+	// Handles reports whether the processor is the one for file
+	Handles(file *db.FileStatus) bool
+	// Available reports whether the tools the processor needs for file
+	// are installed
+	Available(file *db.FileStatus) bool
+}
+
+// TextProcessor is a Processor that derives text from files
+type TextProcessor interface {
+	Processor
+	// Extract returns the text of file along with the provenance artifact
+	// it is recorded as. Failures of the tool are reported in the result's
+	// Error, other failures as the error.
+	Extract(ctx context.Context, file *db.FileStatus) (string, *doc.ExtractResult, error)
+}
+
+// MediaProcessor is a Processor that converts files into another format
+type MediaProcessor interface {
+	Processor
+	// Convert writes a copy of file to the scratch folder and returns its
+	// path and format, the extension it is uploaded with
+	Convert(ctx context.Context, file *db.FileStatus) (string, string, error)
+}
+
+// Registry picks the processor for each file. Processors registered later
+// take precedence, so a new type can be added, or a built-in one taken
+// over, without changing the stages.
+type Registry struct {
+	processors []Processor
+}
+
+// Register adds a processor, ahead of those already registered
+func (r *Registry) Register(processor Processor) {
+	r.processors = append([]Processor{processor}, r.processors...)
+}
+
+// For returns the processor for file: the most recently registered one
+// that handles it, or DefaultProcessor
+func (r *Registry) For(file *db.FileStatus) Processor {
+	for _, processor := range r.processors {
+		if processor.Handles(file) {
+			return processor
+		}
+	}
+	return DefaultProcessor{}
+}
+
+// Names returns the names of the registered processors, highest precedence
+// first
+func (r *Registry) Names() []string {
+	names := make([]string, len(r.processors))
+	for i, processor := range r.processors {
+		names[i] = processor.Name()
+	}
+	return names
+}
+
+// builtinProcessors returns the processors of a pipeline, in the order
+// they are registered
+func builtinProcessors(p *Pipeline) []Processor {
+	return []Processor{
+		ArchiveProcessor{p},
+		DocumentProcessor{p},
+		ImageProcessor{p},
+		VideoProcessor{p},
+		AudioProcessor{p},
+	}
+}
+
+// DefaultProcessor is the processor of the files no other one handles.
+// They are cataloged and uploaded as they are.
+type DefaultProcessor struct{}
+
+// Name implements Processor
+func (DefaultProcessor) Name() string { return "default" }
+
+// Handles implements Processor
+func (DefaultProcessor) Handles(*db.FileStatus) bool { return true }
+
+// Available implements Processor
+func (DefaultProcessor) Available(*db.FileStatus) bool { return true }
+
+// DocumentProcessor extracts the text of documents with the best installed
+// tool
+type DocumentProcessor struct {
+	p *Pipeline
+}
+
+// Name implements Processor
+func (DocumentProcessor) Name() string { return "document" }
+
+// Handles implements Processor
+func (DocumentProcessor) Handles(file *db.FileStatus) bool { return doc.IsSupported(file.Path) }
+
+// Available implements Processor
+func (d DocumentProcessor) Available(file *db.FileStatus) bool {
+	return d.p.caps.CanExtract(file.Path)
+}
+
+// Extract implements TextProcessor
+func (d DocumentProcessor) Extract(ctx context.Context, file *db.FileStatus) (string, *doc.ExtractResult, error) {
+	if err := d.p.extractions.acquire(ctx); err != nil {
+		return "", nil, err
+	}
+	defer d.p.extractions.release()
+	ctx, cancel := deadline(ctx, "extraction", d.p.config.Timeouts.Extract)
+	defer cancel()
+	extracted, err := doc.ExtractText(ctx, file.Path)
+	if extracted != nil {
+		extracted.Error = timedOut(ctx, extracted.Error)
+	}
+	return db.ArtifactExtraction, extracted, timedOut(ctx, err)
+}
+
+// AudioProcessor transcribes audio files, with Whisper unless the
+// configuration says otherwise
+type AudioProcessor struct {
+	p *Pipeline
+}
+
+// Name implements Processor
+func (AudioProcessor) Name() string { return "audio" }
+
+// Handles implements Processor
+func (AudioProcessor) Handles(file *db.FileStatus) bool { return audio.IsSupported(file.Path) }
+
+// Available implements Processor
+func (a AudioProcessor) Available(file *db.FileStatus) bool {
+	return a.p.caps.CanTranscribe(file.Path)
+}
+
+// Extract implements TextProcessor. A failed transcription is reported
+// like a failed extraction.
+func (a AudioProcessor) Extract(ctx context.Context, file *db.FileStatus) (string, *doc.ExtractResult, error) {
+	p := a.p
+	if err := p.transcriptions.acquire(ctx); err != nil {
+		return "", nil, err
+	}
+	defer p.transcriptions.release()
+	if err := p.waitForPower(ctx); err != nil {
+		return "", nil, err
+	}
+	options := audio.DefaultOptions()
+	if p.config.WhisperModel != "" {
+		options.Model = p.config.WhisperModel
+	}
+	extracted := &doc.ExtractResult{Path: file.Path, Extractor: "whisper"}
+	ctx, cancel := deadline(ctx, "transcription", p.config.Timeouts.Extract)
+	defer cancel()
+	transcript, err := p.config.Transcriber.Transcribe(ctx, file.Path, options)
+	if err != nil {
+		extracted.Error = timedOut(ctx, err)
+		return db.ArtifactTranscript, extracted, nil
+	}
+	extracted.Text = transcript.Text
+	extracted.Title = strings.TrimSuffix(filepath.Base(file.Path), filepath.Ext(file.Path))
+	extracted.Metadata = map[string]string{"model": transcript.Model}
+	extracted.Quality = 1
+	return db.ArtifactTranscript, extracted, nil
+}
+
+// VideoProcessor transcodes videos with ffmpeg
+type VideoProcessor struct {
+	p *Pipeline
+}
+
+// Name implements Processor
+func (VideoProcessor) Name() string { return "video" }
+
+// Handles implements Processor
+func (VideoProcessor) Handles(file *db.FileStatus) bool { return video.IsVideo(file.Path) }
+
+// Available implements Processor
+func (v VideoProcessor) Available(*db.FileStatus) bool { return v.p.caps.Transcoding.Available }
+
+// Convert implements MediaProcessor
+func (v VideoProcessor) Convert(ctx context.Context, file *db.FileStatus) (string, string, error) {
+	transcoded, err := v.p.ProcessVideo(ctx, file)
+	if err != nil {
+		return "", "", err
+	}
+	return transcoded.OutputPath, transcoded.OutputFormat, nil
+}
+
+// ImageProcessor converts HEIC and AVIF photos to a widely supported format
+type ImageProcessor struct {
+	p *Pipeline
+}
+
+// Name implements Processor
+func (ImageProcessor) Name() string { return "image" }
+
+// Handles implements Processor
+func (ImageProcessor) Handles(file *db.FileStatus) bool {
+	return image.IsHEIC(file.Path) || image.IsAVIF(file.Path)
+}
+
+// Available implements Processor
+func (i ImageProcessor) Available(file *db.FileStatus) bool { return i.p.caps.CanConvert(file.Path) }
+
+// Convert implements MediaProcessor
+func (i ImageProcessor) Convert(ctx context.Context, file *db.FileStatus) (string, string, error) {
+	converted, err := i.p.ProcessImage(ctx, file)
+	if err != nil {
+		return "", "", err
+	}
+	return converted.OutputPath, strings.TrimPrefix(filepath.Ext(converted.OutputPath), "."), nil
+}
+
+// archiveExtensions are the archives ArchiveProcessor can list
+var archiveExtensions = []string{".zip", ".tar", ".tgz", ".gz"}
+
+// maxArchiveEntries caps how many entries of an archive are listed
+const maxArchiveEntries = 10000
+
+// ArchiveProcessor lists the files inside ZIP and tar archives, so they
+// can be found by the names of what they contain
+type ArchiveProcessor struct {
+	p *Pipeline
+}
+
+// Name implements Processor
+func (ArchiveProcessor) Name() string { return "archive" }
+
+// Handles implements Processor
+func (ArchiveProcessor) Handles(file *db.FileStatus) bool {
+	ext := strings.ToLower(filepath.Ext(file.Path))
+	if ext == ".gz" {
+		return strings.HasSuffix(strings.ToLower(file.Path), ".tar.gz")
+	}
+	return slices.Contains(archiveExtensions, ext) ||
+		file.ContentType == "application/zip" || file.ContentType == "application/x-tar"
+}
+
+// Available implements Processor
+func (ArchiveProcessor) Available(*db.FileStatus) bool { return true }
+
+// Extract implements TextProcessor
+func (a ArchiveProcessor) Extract(ctx context.Context, file *db.FileStatus) (string, *doc.ExtractResult, error) {
+	if err := a.p.extractions.acquire(ctx); err != nil {
+		return "", nil, err
+	}
+	defer a.p.extractions.release()
+
+	extracted := &doc.ExtractResult{
+		Path:      file.Path,
+		Extractor: "archive",
+		Title:     filepath.Base(file.Path),
+	}
+	var entries []string
+	var err error
+	if file.ContentType == "application/zip" || strings.ToLower(filepath.Ext(file.Path)) == ".zip" {
+		entries, err = zipEntries(file.Path)
+	} else {
+		entries, err = tarEntries(file.Path)
+	}
+	if err != nil {
+		extracted.Error = err
+		return db.ArtifactExtraction, extracted, nil
+	}
+	extracted.Text = strings.Join(entries, "\n")
+	extracted.Quality = 1
+	return db.ArtifactExtraction, extracted, nil
+}
+
+// zipEntries lists the files in a ZIP archive with their sizes
+func zipEntries(path string) ([]string, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var entries []string
+	for _, entry := range reader.File {
+		if len(entries) == maxArchiveEntries {
+			break
+		}
+		if !entry.FileInfo().IsDir() {
+			entries = append(entries, fmt.Sprintf("%s (%d bytes)", entry.Name, entry.UncompressedSize64))
+		}
+	}
+	return entries, nil
+}
+
+// tarEntries lists the files in a tar archive, compressed with gzip or not,
+// with their sizes
+func tarEntries(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".tgz" || ext == ".gz" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	var entries []string
+	archive := tar.NewReader(reader)
+	for len(entries) < maxArchiveEntries {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg {
+			entries = append(entries, fmt.Sprintf("%s (%d bytes)", header.Name, header.Size))
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+// gpxProcessor stands in for a processor added for a new file type
+type gpxProcessor struct{}
+
+func (gpxProcessor) Name() string                       { return "gpx" }
+func (gpxProcessor) Handles(file *db.FileStatus) bool   { return filepath.Ext(file.Path) == ".gpx" }
+func (gpxProcessor) Available(file *db.FileStatus) bool { return true }
+
+func TestRegistry(t *testing.T) {
+	p := New(Config{}, nil)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/a/report.pdf", "document"},
+		{"/a/interview.mp3", "audio"},
+		{"/a/clip.mov", "video"},
+		{"/a/IMG_0001.HEIC", "image"},
+		{"/a/backup.tar.gz", "archive"},
+		{"/a/track.gpx", "default"},
+	}
+	for _, tt := range tests {
+		if got := p.processors.For(&db.FileStatus{Path: tt.path}).Name(); got != tt.want {
+			t.Errorf("processor for %s = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+
+	p.Register(gpxProcessor{})
+	if got := p.processors.For(&db.FileStatus{Path: "/a/track.gpx"}).Name(); got != "gpx" {
+		t.Errorf("processor for a registered type = %s, want gpx", got)
+	}
+	if _, ok := p.textProcessor(&db.FileStatus{Path: "/a/track.gpx"}); ok {
+		t.Error("a processor without Extract was taken for a text processor")
+	}
+}
+
+func TestArchiveProcessor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photos.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(out)
+	for _, name := range []string{"2009/beach.jpg", "2009/notes.txt"} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("contents"))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	p := New(Config{}, nil)
+	processor, ok := p.textProcessor(&db.FileStatus{Path: path})
+	if !ok {
+		t.Fatal("no text processor for a ZIP archive")
+	}
+	artifact, extracted, err := processor.Extract(context.Background(), &db.FileStatus{Path: path})
+	if err != nil || extracted.Error != nil {
+		t.Fatalf("Extract: %v, %v", err, extracted.Error)
+	}
+	if artifact != db.ArtifactExtraction {
+		t.Errorf("artifact = %s, want %s", artifact, db.ArtifactExtraction)
+	}
+	if !strings.Contains(extracted.Text, "2009/beach.jpg (8 bytes)") || !strings.Contains(extracted.Text, "2009/notes.txt") {
+		t.Errorf("listing = %q", extracted.Text)
+	}
+}
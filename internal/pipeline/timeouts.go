@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimedOut is the cause of the failure of a file whose extraction,
+// transcode or summary ran past its timeout
+var ErrTimedOut = errors.New("timed out")
+
+// Timeouts caps how long one file may spend in each step, so that a file
+// that wedges a tool fails and the stage moves on. Zero fields don't limit
+// the step.
+type Timeouts struct {
+	Extract   time.Duration // Text extraction and transcription
+	Transcode time.Duration // Video transcodes and image conversions
+	Summarize time.Duration // Summary requests, including retries
+}
+
+// deadline returns a context that is cancelled once timeout has passed,
+// with a cause naming the step
+func deadline(ctx context.Context, step string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%s %w after %s", step, ErrTimedOut, timeout))
+}
+
+// timedOut returns the cause of ctx in place of err if ctx ran out of time,
+// since tools killed at the deadline report less useful errors
+func timedOut(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if cause := context.Cause(ctx); errors.Is(cause, ErrTimedOut) {
+		return cause
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+package policy
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// exclusionLists holds the curated default exclusions, one file per OS plus
+// a common list
+//
+//go:embed exclusions/*.txt
+var exclusionLists embed.FS
+
+// listOrder is the order in which the default lists are evaluated. Drives
+// move between machines, so every OS list applies regardless of the host.
+// The common list comes last because it ends with the catch-all hidden rule.
+var listOrder = []string{"darwin", "windows", "linux", "common"}
+
+// Rule is a single exclusion pattern
+type Rule struct {
+	List     string // Name of the list the rule came from, e.g. "darwin"
+	Pattern  string // Pattern as written in the list
+	dirOnly  bool
+	anchored bool
+	segments int
+	glob     string
+}
+
+// String returns the rule as "list:pattern"
+func (r *Rule) String() string {
+	return r.List + ":" + r.Pattern
+}
+
+// Policy decides which paths are left out of a scan
+type Policy struct {
+	rules []*Rule
+}
+
+// Default returns the policy built from the embedded exclusion lists
+func Default() (*Policy, error) {
+	p := &Policy{}
+	for _, name := range listOrder {
+		data, err := exclusionLists.ReadFile("exclusions/" + name + ".txt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read exclusion list %s: %w", name, err)
+		}
+		if err := p.AddList(name, string(data)); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// AddList parses an exclusion list and appends its rules to the policy
+func (p *Policy) AddList(name, data string) error {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		rule, err := parseRule(name, pattern)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		p.rules = append(p.rules, rule)
+	}
+	return scanner.Err()
+}
+
+// Rules returns the rules of the policy in evaluation order
+func (p *Policy) Rules() []*Rule {
+	return p.rules
+}
+
+// Match returns the first rule excluding relPath, or nil if the path is kept.
+// relPath is relative to the root of the scanned source.
+func (p *Policy) Match(relPath string, isDir bool) *Rule {
+	if p == nil {
+		return nil
+	}
+
+	relPath = strings.ToLower(filepath.ToSlash(relPath))
+	if relPath == "." || relPath == "" {
+		return nil
+	}
+	segments := strings.Split(relPath, "/")
+
+	for _, rule := range p.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.matches(segments) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// matches reports whether the trailing segments of a path match the rule
+func (r *Rule) matches(segments []string) bool {
+	if len(segments) < r.segments {
+		return false
+	}
+	if r.anchored && len(segments) != r.segments {
+		return false
+	}
+
+	tail := strings.Join(segments[len(segments)-r.segments:], "/")
+	matched, _ := path.Match(r.glob, tail)
+	return matched
+}
+
+// parseRule parses one line of an exclusion list
+func parseRule(list, pattern string) (*Rule, error) {
+	rule := &Rule{List: list, Pattern: pattern}
+
+	glob := strings.ToLower(pattern)
+	if strings.HasSuffix(glob, "/") {
+		rule.dirOnly = true
+		glob = strings.TrimSuffix(glob, "/")
+	}
+	if strings.HasPrefix(glob, "/") {
+		rule.anchored = true
+		glob = strings.TrimPrefix(glob, "/")
+	}
+	if glob == "" {
+		return nil, fmt.Errorf("empty pattern %q", pattern)
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	rule.glob = glob
+	rule.segments = strings.Count(glob, "/") + 1
+	return rule, nil
+}
+
+// Exclusion records a path left out of a scan
+type Exclusion struct {
+	Path  string
+	IsDir bool
+	Rule  *Rule
+}
+
+// Report collects the exclusions of a scan
+type Report struct {
+	Exclusions []Exclusion
+}
+
+// Add records an excluded path
+func (r *Report) Add(filePath string, isDir bool, rule *Rule) {
+	r.Exclusions = append(r.Exclusions, Exclusion{Path: filePath, IsDir: isDir, Rule: rule})
+}
+
+// RuleCount is the number of paths excluded by a rule
+type RuleCount struct {
+	Rule  *Rule
+	Count int
+}
+
+// ByRule returns how many paths each rule excluded, most frequent first
+func (r *Report) ByRule() []RuleCount {
+	counts := make(map[*Rule]int)
+	for _, exclusion := range r.Exclusions {
+		counts[exclusion.Rule]++
+	}
+
+	result := make([]RuleCount, 0, len(counts))
+	for rule, count := range counts {
+		result = append(result, RuleCount{Rule: rule, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Rule.String() < result[j].Rule.String()
+	})
+	return result
+}
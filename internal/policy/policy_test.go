@@ -0,0 +1,42 @@
+package policy
+
+import "testing"
+
+func TestDefaultPolicy(t *testing.T) {
+	p, err := Default()
+	if err != nil {
+		t.Fatalf("Default() failed: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		{"projects/site/node_modules", true, true},
+		{"projects/site/node_modules", false, false},
+		{"$RECYCLE.BIN", true, true},
+		{"Users/jo/Library/Caches", true, true},
+		{"Windows", true, true},
+		{"Documents/Windows", true, false},
+		{"Photos/.DS_Store", false, true},
+		{"Photos/IMG_0001.HEIC", false, false},
+		{"code/app/.venv", true, true},
+		{"Documents/report.pdf", false, false},
+		{".", true, false},
+	}
+
+	for _, tt := range tests {
+		rule := p.Match(tt.path, tt.isDir)
+		if (rule != nil) != tt.excluded {
+			t.Errorf("Match(%q, %v) = %v, want excluded=%v", tt.path, tt.isDir, rule, tt.excluded)
+		}
+	}
+}
+
+func TestNilPolicyIncludesEverything(t *testing.T) {
+	var p *Policy
+	if rule := p.Match(".git", true); rule != nil {
+		t.Errorf("nil policy excluded .git by %s", rule)
+	}
+}
@@ -0,0 +1,230 @@
+package power
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is how often the power state is polled
+const DefaultInterval = 30 * time.Second
+
+// State is a snapshot of the machine's power and thermal condition
+type State struct {
+	OnBattery      bool
+	BatteryPercent int // -1 when unknown
+	Throttled      bool
+	SpeedLimit     int // CPU speed limit in percent, 100 when not throttled
+}
+
+// ShouldPause reports whether heavy work should wait in this state
+func (s State) ShouldPause() bool {
+	return s.OnBattery || s.Throttled
+}
+
+// Reason describes why heavy work is paused
+func (s State) Reason() string {
+	switch {
+	case s.OnBattery && s.BatteryPercent >= 0:
+		return "running on battery (" + strconv.Itoa(s.BatteryPercent) + "%)"
+	case s.OnBattery:
+		return "running on battery"
+	case s.Throttled:
+		return "CPU thermally throttled to " + strconv.Itoa(s.SpeedLimit) + "%"
+	}
+	return ""
+}
+
+// ReadState reads the current power state. On platforms without support it
+// returns a state that never pauses.
+func ReadState() (State, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return readDarwin()
+	case "linux":
+		return readLinux(), nil
+	}
+	return State{BatteryPercent: -1, SpeedLimit: 100}, nil
+}
+
+// Monitor polls the power state and lets heavy work wait while the machine
+// is on battery or throttled
+type Monitor struct {
+	interval time.Duration
+	onChange func(State)
+
+	mu     sync.Mutex
+	state  State
+	resume chan struct{} // closed when work may continue
+}
+
+// NewMonitor creates a monitor polling at the given interval. onChange, if
+// set, is called whenever work is paused or resumed.
+func NewMonitor(interval time.Duration, onChange func(State)) *Monitor {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	resume := make(chan struct{})
+	close(resume)
+
+	return &Monitor{
+		interval: interval,
+		onChange: onChange,
+		state:    State{BatteryPercent: -1, SpeedLimit: 100},
+		resume:   resume,
+	}
+}
+
+// Start polls the power state until ctx is done
+func (m *Monitor) Start(ctx context.Context) {
+	m.poll()
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.poll()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// State returns the last polled state
+func (m *Monitor) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Wait blocks while heavy work is paused, returning early if ctx is done
+func (m *Monitor) Wait(ctx context.Context) error {
+	m.mu.Lock()
+	resume := m.resume
+	m.mu.Unlock()
+
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// poll reads the power state and pauses or resumes waiting work
+func (m *Monitor) poll() {
+	state, err := ReadState()
+	if err != nil {
+		// Keep the previous state rather than guessing
+		return
+	}
+
+	m.mu.Lock()
+	wasPaused := m.state.ShouldPause()
+	m.state = state
+	paused := state.ShouldPause()
+	switch {
+	case paused && !wasPaused:
+		m.resume = make(chan struct{})
+	case !paused && wasPaused:
+		close(m.resume)
+	}
+	m.mu.Unlock()
+
+	if paused != wasPaused && m.onChange != nil {
+		m.onChange(state)
+	}
+}
+
+// readDarwin reads the power source and thermal state with pmset, which
+// unlike powermetrics doesn't need root
+func readDarwin() (State, error) {
+	batt, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return State{}, err
+	}
+	state := parsePmsetBatt(string(batt))
+
+	// Thermal state is optional; older systems don't report it
+	if therm, err := exec.Command("pmset", "-g", "therm").Output(); err == nil {
+		state.SpeedLimit = parsePmsetTherm(string(therm))
+	}
+	state.Throttled = state.SpeedLimit < 100
+
+	return state, nil
+}
+
+var batteryPercentPattern = regexp.MustCompile(`(\d+)%`)
+
+// parsePmsetBatt parses the output of `pmset -g batt`
+func parsePmsetBatt(output string) State {
+	state := State{
+		OnBattery:      strings.Contains(output, "'Battery Power'"),
+		BatteryPercent: -1,
+		SpeedLimit:     100,
+	}
+	if match := batteryPercentPattern.FindStringSubmatch(output); match != nil {
+		state.BatteryPercent, _ = strconv.Atoi(match[1])
+	}
+	return state
+}
+
+// parsePmsetTherm returns the CPU speed limit reported by `pmset -g therm`
+func parsePmsetTherm(output string) int {
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(line, "=")
+		if !found || strings.TrimSpace(key) != "CPU_Speed_Limit" {
+			continue
+		}
+		if limit, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return limit
+		}
+	}
+	return 100
+}
+
+// readLinux reads the power source from sysfs. Thermal throttling isn't
+// reported consistently across drivers, so it is not detected.
+func readLinux() State {
+	state := State{BatteryPercent: -1, SpeedLimit: 100}
+
+	supplies, _ := filepath.Glob("/sys/class/power_supply/*")
+	onlineAC, hasAC, hasBattery := false, false, false
+	for _, supply := range supplies {
+		kind := readSysfs(filepath.Join(supply, "type"))
+		switch kind {
+		case "Mains":
+			hasAC = true
+			if readSysfs(filepath.Join(supply, "online")) == "1" {
+				onlineAC = true
+			}
+		case "Battery":
+			hasBattery = true
+			if capacity, err := strconv.Atoi(readSysfs(filepath.Join(supply, "capacity"))); err == nil {
+				state.BatteryPercent = capacity
+			}
+		}
+	}
+
+	state.OnBattery = hasBattery && hasAC && !onlineAC
+	return state
+}
+
+// readSysfs reads a single-value sysfs file
+func readSysfs(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,29 @@
+package power
+
+import "testing"
+
+func TestParsePmset(t *testing.T) {
+	onBattery := parsePmsetBatt("Now drawing from 'Battery Power'\n" +
+		" -InternalBattery-0 (id=4653155)\t72%; discharging; 5:12 remaining present: true\n")
+	if !onBattery.OnBattery || onBattery.BatteryPercent != 72 {
+		t.Errorf("parsePmsetBatt(battery) = %+v", onBattery)
+	}
+
+	onAC := parsePmsetBatt("Now drawing from 'AC Power'\n" +
+		" -InternalBattery-0 (id=4653155)\t100%; charged; 0:00 remaining present: true\n")
+	if onAC.OnBattery || onAC.ShouldPause() {
+		t.Errorf("parsePmsetBatt(AC) = %+v", onAC)
+	}
+
+	therm := "Note: No thermal warning level has been recorded\n" +
+		"2024-05-01 10:00:00 CPU Power notify\n" +
+		"\tCPU_Scheduler_Limit \t= 100\n" +
+		"\tCPU_Available_CPUs \t= 10\n" +
+		"\tCPU_Speed_Limit \t= 62\n"
+	if limit := parsePmsetTherm(therm); limit != 62 {
+		t.Errorf("parsePmsetTherm() = %d, want 62", limit)
+	}
+	if limit := parsePmsetTherm("Note: No thermal warning level has been recorded\n"); limit != 100 {
+		t.Errorf("parsePmsetTherm(no data) = %d, want 100", limit)
+	}
+}
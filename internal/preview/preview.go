@@ -0,0 +1,104 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jth/archiver/internal/tools"
+)
+
+// Kind is the kind of preview a file gets
+type Kind string
+
+// Preview kinds
+const (
+	KindVideo Kind = "video"
+	KindPDF   Kind = "pdf"
+	KindOther Kind = "other"
+)
+
+// KindOf returns the kind of preview of a file from its content type, or its
+// extension when the content type is not specific
+func KindOf(path, contentType string) Kind {
+	switch {
+	case strings.HasPrefix(contentType, "video/"):
+		return KindVideo
+	case contentType == "application/pdf":
+		return KindPDF
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".m4v", ".mov", ".mkv", ".webm", ".avi", ".mts", ".m2ts", ".ts", ".mpg", ".mpeg":
+		return KindVideo
+	case ".pdf":
+		return KindPDF
+	}
+	return KindOther
+}
+
+// DefaultBytes returns how much of a file of a kind is fetched by default:
+// enough for about the first 30 seconds of a typical camera video or the
+// first pages of a scanned document
+func DefaultBytes(kind Kind) int64 {
+	switch kind {
+	case KindVideo:
+		return 32 << 20
+	case KindPDF:
+		return 4 << 20
+	}
+	return 1 << 20
+}
+
+// Video cuts the first seconds of a partial video into a playable file
+// without re-encoding. It fails for containers that keep their index at the
+// end of the file, such as MP4 files not written for streaming.
+func Video(ctx context.Context, partial, output string, seconds int) error {
+	if !tools.Available("ffmpeg") {
+		return fmt.Errorf("ffmpeg not found in PATH: %w", tools.ErrNotInstalled)
+	}
+
+	cmd := exec.CommandContext(ctx, tools.Path("ffmpeg"), "-y", "-v", "error", "-i", partial,
+		"-t", fmt.Sprint(seconds), "-c", "copy", output)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// PDFPages renders the first pages of a partial PDF to PNG images next to
+// prefix and returns their paths. pdftoppm rebuilds the cross-reference
+// table that a partial file is missing, so pages whose objects were fetched
+// render.
+func PDFPages(ctx context.Context, partial, prefix string, pages int) ([]string, error) {
+	if !tools.Available("pdftoppm") {
+		return nil, fmt.Errorf("pdftoppm not found in PATH: %w", tools.ErrNotInstalled)
+	}
+
+	cmd := exec.CommandContext(ctx, "pdftoppm", "-png", "-r", "100", "-f", "1", "-l", fmt.Sprint(pages), partial, prefix)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	// Pages rendered before an error are still useful
+	images, err := filepath.Glob(prefix + "-*.png")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(images)
+	if len(images) == 0 {
+		if runErr == nil {
+			runErr = fmt.Errorf("no pages rendered")
+		}
+		return nil, fmt.Errorf("pdftoppm failed: %w: %s", runErr, strings.TrimSpace(stderr.String()))
+	}
+	return images, nil
+}
@@ -0,0 +1,181 @@
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event types emitted on the event stream
+const (
+	EventStageStart    = "stage_start"
+	EventProgress      = "progress"
+	EventStageComplete = "stage_complete"
+	EventSummary       = "summary"
+	EventPaused        = "paused"
+	EventResumed       = "resumed"
+)
+
+// eventInterval limits how often progress events are emitted
+const eventInterval = 250 * time.Millisecond
+
+// Event is a machine-readable progress update, written as one JSON object
+// per line
+type Event struct {
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time"`
+	Stage       string    `json:"stage,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Current     int64     `json:"current"`
+	Total       int64     `json:"total"`
+	// Size of the stage in bytes, and its estimate from the bytes done
+	StageBytesDone  int64   `json:"stage_bytes_done,omitempty"`
+	StageBytesTotal int64   `json:"stage_bytes_total,omitempty"`
+	StageETASeconds float64 `json:"stage_eta_seconds,omitempty"`
+
+	FilesTotal     int64   `json:"files_total"`
+	FilesProcessed int64   `json:"files_processed"`
+	FilesSkipped   int64   `json:"files_skipped"`
+	FilesFailed    int64   `json:"files_failed"`
+	BytesTotal     int64   `json:"bytes_total"`
+	BytesProcessed int64   `json:"bytes_processed"`
+	BytesUploaded  int64   `json:"bytes_uploaded"`
+	Rate           float64 `json:"rate"`         // Stage units per second
+	UploadSpeed    float64 `json:"upload_speed"` // Bytes per second
+	ETASeconds     float64 `json:"eta_seconds"`  // All stages started so far
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// eventStream writes events to a writer
+type eventStream struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// SetEventWriter switches the tracker from progress bars to newline-delimited
+// JSON events written to w. Stage starts and completions and the summary are
+// always written; progress events at most every 250ms.
+func (t *Tracker) SetEventWriter(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = &eventStream{encoder: json.NewEncoder(w)}
+}
+
+// Subscribe calls fn with each event, as written by SetEventWriter, without
+// switching off the progress bars. fn must not block. Call the returned
+// function to stop.
+func (t *Tracker) Subscribe(fn func(Event)) (unsubscribe func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.listeners == nil {
+		t.listeners = make(map[int]func(Event))
+	}
+	id := t.nextListener
+	t.nextListener++
+	t.listeners[id] = fn
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.listeners, id)
+	}
+}
+
+// Snapshot returns a progress event for each stage, in the order they were
+// added, or a single event for the run when there are none yet
+func (t *Tracker) Snapshot() []Event {
+	now := time.Now()
+	t.mu.Lock()
+	stages := make([]*Stage, 0, len(t.order))
+	for _, name := range t.order {
+		stages = append(stages, t.Stages[name])
+	}
+	t.mu.Unlock()
+
+	if len(stages) == 0 {
+		return []Event{t.event(EventProgress, nil, now)}
+	}
+	events := make([]Event, len(stages))
+	for i, stage := range stages {
+		events[i] = t.event(EventProgress, stage, now)
+	}
+	return events
+}
+
+// emit writes an event for a stage, or for the whole run if stage is nil,
+// and passes it to the subscribers. Write errors are ignored so a closed
+// reader doesn't stop the run.
+func (t *Tracker) emit(eventType string, stage *Stage) {
+	t.mu.Lock()
+	events := t.events
+	listeners := make([]func(Event), 0, len(t.listeners))
+	for _, fn := range t.listeners {
+		listeners = append(listeners, fn)
+	}
+	t.mu.Unlock()
+	if events == nil && len(listeners) == 0 {
+		return
+	}
+
+	now := t.now()
+	if eventType == EventProgress {
+		t.throttle.Lock()
+		throttled := now.Sub(t.lastProgress) < eventInterval
+		if !throttled {
+			t.lastProgress = now
+		}
+		t.throttle.Unlock()
+		if throttled {
+			return
+		}
+	}
+
+	event := t.event(eventType, stage, now)
+	if events != nil {
+		events.mu.Lock()
+		events.encoder.Encode(event)
+		events.mu.Unlock()
+	}
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
+
+// event describes a stage, or the whole run if stage is nil, at now
+func (t *Tracker) event(eventType string, stage *Stage, now time.Time) Event {
+	event := Event{Type: eventType, Time: now}
+	if stage != nil {
+		stage.mu.Lock()
+		event.Stage = stage.Name
+		event.Description = stage.Description
+		event.Current = stage.Current
+		event.Total = stage.Total
+		event.StageBytesDone = stage.BytesDone
+		event.StageBytesTotal = stage.BytesTotal
+		event.StageETASeconds = stage.estimate(now).Seconds()
+		stage.mu.Unlock()
+	}
+	event.ETASeconds = t.EstimatedTimeLeft().Seconds()
+
+	stats := t.Statistics
+	stats.mu.Lock()
+	event.FilesTotal = stats.TotalFiles
+	event.FilesProcessed = stats.ProcessedFiles
+	event.FilesSkipped = stats.SkippedFiles
+	event.FilesFailed = stats.FailedFiles
+	event.BytesTotal = stats.BytesTotal
+	event.BytesProcessed = stats.BytesProcessed
+	event.BytesUploaded = stats.BytesUploaded
+	event.Rate = stats.ProcessingRate
+	event.UploadSpeed = stats.UploadSpeed
+	event.ElapsedSeconds = now.Sub(stats.StartTime).Seconds()
+	stats.mu.Unlock()
+	return event
+}
+
+// eventsEnabled reports whether the tracker writes events instead of bars
+func (t *Tracker) eventsEnabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.events != nil
+}
@@ -0,0 +1,126 @@
+package progress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEventStream(t *testing.T) {
+	var buf bytes.Buffer
+	tracker := NewTracker()
+	tracker.SetEventWriter(&buf)
+	// A clock that moves only when told, so the throttle doesn't depend on
+	// how fast the test runs
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+
+	tracker.UpdateTotals(3, 300)
+	tracker.AddStage("scan", "Scanning files", 300)
+	for i := 0; i < 2; i++ {
+		tracker.IncrementStage("scan", 100)
+		tracker.UpdateFileStats(1, 0, 0, 100)
+	}
+	now = now.Add(eventInterval)
+	tracker.IncrementStage("scan", 100)
+	tracker.UpdateFileStats(1, 0, 0, 100)
+	tracker.CompleteStage("scan")
+	tracker.PrintSummary()
+
+	var events []Event
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Invalid event %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+
+	// Progress events within 250ms of each other are dropped
+	want := []string{EventStageStart, EventProgress, EventProgress, EventStageComplete, EventSummary}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %d: %+v", len(want), len(events), events)
+	}
+	for i, event := range events {
+		if event.Type != want[i] {
+			t.Errorf("Event %d: expected type %s, got %s", i, want[i], event.Type)
+		}
+	}
+
+	if progress := events[2]; progress.Current != 300 {
+		t.Errorf("Unexpected progress event after the interval: %+v", progress)
+	}
+	complete := events[3]
+	if complete.Stage != "scan" || complete.Current != 300 || complete.Total != 300 {
+		t.Errorf("Unexpected stage_complete event: %+v", complete)
+	}
+	if summary := events[4]; summary.FilesProcessed != 3 || summary.BytesTotal != 300 {
+		t.Errorf("Unexpected summary event: %+v", summary)
+	}
+}
+
+func TestSocketWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "progress.sock")
+	// A socket left by a killed run is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	w, err := ListenSocket(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListenSocket(path); err == nil {
+		t.Error("listened on a socket in use")
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tracker := NewTracker()
+	tracker.SetEventWriter(w)
+	// Events written before the client is accepted are not sent to it, so
+	// write until one arrives
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	var line string
+	for line == "" {
+		tracker.AddStage("scan", "Scanning files", 10)
+		select {
+		case line = <-lines:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	var event Event
+	if err := json.Unmarshal([]byte(line), &event); err != nil || event.Type != EventStageStart {
+		t.Errorf("event = %q, %v; want stage_start", line, err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("socket file after Close: %v", err)
+	}
+	// The client is disconnected
+	for range lines {
+	}
+}
@@ -21,11 +21,15 @@ const (
 
 // StageInfo represents information about a stage that can be formatted
 type StageInfo struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Current     int64   `json:"current"`
-	Total       int64   `json:"total"`
-	Percentage  float64 `json:"percentage"`
+	Name              string        `json:"name"`
+	Description       string        `json:"description"`
+	Current           int64         `json:"current"`
+	Total             int64         `json:"total"`
+	Percentage        float64       `json:"percentage"`
+	BytesDone         int64         `json:"bytes_done"`
+	BytesTotal        int64         `json:"bytes_total"`
+	Rate              float64       `json:"rate"` // Bytes per second when BytesTotal is known
+	EstimatedTimeLeft time.Duration `json:"estimated_time_left"`
 }
 
 // StatsInfo represents statistics that can be formatted
@@ -107,6 +111,7 @@ func (f *Formatter) FormatStage(tracker *Tracker, stageName string) string {
 
 // getStatsInfo extracts stats info from the tracker
 func (f *Formatter) getStatsInfo(tracker *Tracker) StatsInfo {
+	left := tracker.EstimatedTimeLeft()
 	tracker.Statistics.mu.Lock()
 	defer tracker.Statistics.mu.Unlock()
 
@@ -131,20 +136,20 @@ func (f *Formatter) getStatsInfo(tracker *Tracker) StatsInfo {
 		CurrentPhase:      stats.CurrentPhase,
 		ProcessingRate:    stats.ProcessingRate,
 		UploadSpeed:       stats.UploadSpeed,
-		EstimatedTimeLeft: stats.EstimatedTimeLeft,
+		EstimatedTimeLeft: left,
 		CompletionPercent: completionPercent,
 	}
 }
 
 // getStageInfos extracts info for all stages
 func (f *Formatter) getStageInfos(tracker *Tracker) []StageInfo {
-	tracker.mu.Lock()
-	defer tracker.mu.Unlock()
+	names := tracker.StageNames()
+	stageInfos := make([]StageInfo, 0, len(names))
 
-	stageInfos := make([]StageInfo, 0, len(tracker.Stages))
-
-	for _, stage := range tracker.Stages {
-		stageInfos = append(stageInfos, f.getStageInfo(stage))
+	for _, name := range names {
+		if stage := tracker.GetStage(name); stage != nil {
+			stageInfos = append(stageInfos, f.getStageInfo(stage))
+		}
 	}
 
 	return stageInfos
@@ -160,12 +165,17 @@ func (f *Formatter) getStageInfo(stage *Stage) StageInfo {
 		percentage = float64(stage.Current) / float64(stage.Total) * 100
 	}
 
+	now := time.Now()
 	return StageInfo{
-		Name:        stage.Name,
-		Description: stage.Description,
-		Current:     stage.Current,
-		Total:       stage.Total,
-		Percentage:  percentage,
+		Name:              stage.Name,
+		Description:       stage.Description,
+		Current:           stage.Current,
+		Total:             stage.Total,
+		Percentage:        percentage,
+		BytesDone:         stage.BytesDone,
+		BytesTotal:        stage.BytesTotal,
+		Rate:              stage.window.rate(now),
+		EstimatedTimeLeft: stage.estimate(now),
 	}
 }
 
@@ -213,11 +223,21 @@ func (f *Formatter) formatStagesText(stages []StageInfo) string {
 }
 
 func (f *Formatter) formatStageText(stage StageInfo) string {
-	return fmt.Sprintf("%s: %d/%d (%.1f%%)",
+	text := fmt.Sprintf("%s: %d/%d (%.1f%%)",
 		stage.Description,
 		stage.Current,
 		stage.Total,
 		stage.Percentage)
+	if stage.BytesTotal > 0 && stage.BytesTotal != stage.Total {
+		text += fmt.Sprintf(", %s of %s", formatBytes(stage.BytesDone), formatBytes(stage.BytesTotal))
+	}
+	if stage.BytesTotal > 0 && stage.Rate > 0 {
+		text += fmt.Sprintf(", %s/s", formatBytes(int64(stage.Rate)))
+	}
+	if stage.EstimatedTimeLeft > 0 {
+		text += ", " + formatDuration(stage.EstimatedTimeLeft) + " left"
+	}
+	return text
 }
 
 // JSON formatters
@@ -250,10 +270,10 @@ func (f *Formatter) formatStatsCSV(stats StatsInfo) string {
 	var sb strings.Builder
 
 	// Header
-	sb.WriteString("total_files,processed_files,skipped_files,failed_files,bytes_processed,bytes_total,bytes_uploaded,elapsed_seconds,processing_rate,upload_speed,completion_percent\n")
+	sb.WriteString("total_files,processed_files,skipped_files,failed_files,bytes_processed,bytes_total,bytes_uploaded,elapsed_seconds,processing_rate,upload_speed,completion_percent,eta_seconds\n")
 
 	// Data
-	sb.WriteString(fmt.Sprintf("%d,%d,%d,%d,%d,%d,%d,%.1f,%.1f,%.1f,%.1f\n",
+	sb.WriteString(fmt.Sprintf("%d,%d,%d,%d,%d,%d,%d,%.1f,%.1f,%.1f,%.1f,%.0f\n",
 		stats.TotalFiles,
 		stats.ProcessedFiles,
 		stats.SkippedFiles,
@@ -264,7 +284,8 @@ func (f *Formatter) formatStatsCSV(stats StatsInfo) string {
 		stats.ElapsedTime.Seconds(),
 		stats.ProcessingRate,
 		stats.UploadSpeed,
-		stats.CompletionPercent))
+		stats.CompletionPercent,
+		stats.EstimatedTimeLeft.Seconds()))
 
 	return sb.String()
 }
@@ -273,7 +294,7 @@ func (f *Formatter) formatStagesCSV(stages []StageInfo) string {
 	var sb strings.Builder
 
 	// Header
-	sb.WriteString("name,description,current,total,percentage\n")
+	sb.WriteString("name,description,current,total,percentage,bytes_done,bytes_total,eta_seconds\n")
 
 	// Data
 	for _, stage := range stages {
@@ -284,12 +305,15 @@ func (f *Formatter) formatStagesCSV(stages []StageInfo) string {
 }
 
 func (f *Formatter) formatStageCSV(stage StageInfo) string {
-	return fmt.Sprintf("%s,%s,%d,%d,%.1f\n",
+	return fmt.Sprintf("%s,%s,%d,%d,%.1f,%d,%d,%.0f\n",
 		escapeCSV(stage.Name),
 		escapeCSV(stage.Description),
 		stage.Current,
 		stage.Total,
-		stage.Percentage)
+		stage.Percentage,
+		stage.BytesDone,
+		stage.BytesTotal,
+		stage.EstimatedTimeLeft.Seconds())
 }
 
 // escapeCSV escapes a string for CSV output
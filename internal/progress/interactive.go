@@ -1,13 +1,13 @@
 package progress
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"os/signal"
+	"log/slog"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/fatih/color"
 	"github.com/gizak/termui/v3"
 	"github.com/gizak/termui/v3/widgets"
 )
@@ -16,8 +16,12 @@ import (
 type InteractiveModeConfig struct {
 	RefreshInterval  time.Duration
 	ShowDetailedView bool
-	TerminalWidth    int
-	TerminalHeight   int
+	// Lowest level of the log records shown in the activity log; v cycles
+	// through warn, info and debug
+	Verbosity slog.Level
+	// OnQuit is called when q or Ctrl+C is pressed. The terminal is in raw
+	// mode, so Ctrl+C doesn't interrupt the process by itself.
+	OnQuit func()
 }
 
 // DefaultInteractiveModeConfig returns a default configuration for interactive mode
@@ -25,288 +29,284 @@ func DefaultInteractiveModeConfig() InteractiveModeConfig {
 	return InteractiveModeConfig{
 		RefreshInterval:  250 * time.Millisecond,
 		ShowDetailedView: true,
-		TerminalWidth:    80,
-		TerminalHeight:   25,
+		Verbosity:        slog.LevelWarn,
 	}
 }
 
-// InteractiveMode handles interactive display of backup progress
+// maxLogs is how many lines the activity log keeps
+const maxLogs = 100
+
+// InteractiveMode is a terminal dashboard of a tracker's progress: the
+// current phase, a gauge per stage with its estimate, statistics and an
+// activity log. It redraws on a timer and when the terminal is resized, and
+// takes keys to pause and resume the work (p), change the log verbosity (v),
+// toggle the stage gauges (r) and quit (q).
 type InteractiveMode struct {
-	mu          sync.Mutex
-	tracker     *Tracker
-	config      InteractiveModeConfig
-	stopChan    chan struct{}
-	stoppedChan chan struct{}
-	running     bool
-
-	// UI components
-	gauges         map[string]*widgets.Gauge
-	statsTable     *widgets.Table
-	infoBox        *widgets.Paragraph
-	logBox         *widgets.List
-	logs           []string
-	lastUpdateTime time.Time
+	tracker *Tracker
+	config  InteractiveModeConfig
+
+	mu        sync.Mutex
+	running   bool
+	stop      chan struct{}
+	done      chan struct{}
+	logs      []string
+	verbosity slog.Level
+	quits     int
+
+	// Widgets, only used by the update loop once started
+	grid       *termui.Grid
+	infoBox    *widgets.Paragraph
+	statsTable *widgets.Table
+	logBox     *widgets.List
+	gauges     map[string]*widgets.Gauge
+	stages     []string // Stages with a gauge, in the order they were added
+	width      int
+	height     int
 }
 
 // NewInteractiveMode creates a new interactive mode display
 func NewInteractiveMode(tracker *Tracker, config InteractiveModeConfig) *InteractiveMode {
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = DefaultInteractiveModeConfig().RefreshInterval
+	}
 	return &InteractiveMode{
-		tracker:     tracker,
-		config:      config,
-		stopChan:    make(chan struct{}),
-		stoppedChan: make(chan struct{}),
-		gauges:      make(map[string]*widgets.Gauge),
-		logs:        make([]string, 0, 100),
+		tracker:   tracker,
+		config:    config,
+		verbosity: config.Verbosity,
+		logs:      make([]string, 0, maxLogs),
+		gauges:    make(map[string]*widgets.Gauge),
 	}
 }
 
-// Start starts the interactive display
+// Start takes over the terminal and keeps the dashboard updated until Stop.
+// The tracker draws no progress bars meanwhile.
 func (im *InteractiveMode) Start() error {
 	im.mu.Lock()
+	defer im.mu.Unlock()
 	if im.running {
-		im.mu.Unlock()
 		return fmt.Errorf("interactive mode is already running")
 	}
-	im.running = true
-	im.mu.Unlock()
 
 	if err := termui.Init(); err != nil {
 		return fmt.Errorf("failed to initialize terminal UI: %w", err)
 	}
+	im.running = true
+	im.stop = make(chan struct{})
+	im.done = make(chan struct{})
+	im.tracker.SetQuiet(true)
 
-	// Initialize components
+	im.width, im.height = termui.TerminalDimensions()
 	im.initializeComponents()
-
-	// Start UI update goroutine
 	go im.updateLoop()
-
-	// Handle Ctrl+C to exit gracefully
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
-	go func() {
-		<-sigChan
-		im.Stop()
-	}()
-
-	// Handle terminal UI events
-	termui.Render(termui.Body)
-	uiEvents := termui.PollEvents()
-	for {
-		select {
-		case e := <-uiEvents:
-			switch e.ID {
-			case "q", "<C-c>":
-				im.Stop()
-				return nil
-			case "r":
-				// Toggle detailed view
-				im.config.ShowDetailedView = !im.config.ShowDetailedView
-				im.initializeComponents()
-				termui.Render(termui.Body)
-			}
-		case <-im.stopChan:
-			termui.Close()
-			close(im.stoppedChan)
-			return nil
-		}
-	}
+	return nil
 }
 
-// Stop stops the interactive display
+// Stop closes the dashboard and gives the terminal back. It may be called
+// more than once.
 func (im *InteractiveMode) Stop() {
 	im.mu.Lock()
-	defer im.mu.Unlock()
-
 	if !im.running {
+		im.mu.Unlock()
 		return
 	}
-
-	close(im.stopChan)
-	<-im.stoppedChan
 	im.running = false
+	close(im.stop)
+	done := im.done
+	im.mu.Unlock()
+
+	<-done
 }
 
-// AddLog adds a log message to the interactive display
+// AddLog adds a message to the activity log
 func (im *InteractiveMode) AddLog(message string) {
 	im.mu.Lock()
 	defer im.mu.Unlock()
 
-	// Add timestamp
-	timestamp := time.Now().Format("15:04:05")
-	logLine := fmt.Sprintf("[%s] %s", timestamp, message)
-
-	// Add to logs with a maximum capacity
-	if len(im.logs) >= 100 {
+	line := fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), message)
+	if len(im.logs) >= maxLogs {
 		im.logs = im.logs[1:]
 	}
-	im.logs = append(im.logs, logLine)
+	im.logs = append(im.logs, line)
+}
 
-	// Update log box if running
-	if im.running && im.logBox != nil {
-		im.logBox.Rows = im.logs
-	}
+// Verbosity returns the lowest level of the log records shown
+func (im *InteractiveMode) Verbosity() slog.Level {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return im.verbosity
 }
 
-// initializeComponents initializes the UI components
+// initializeComponents creates the widgets that don't depend on the stages
 func (im *InteractiveMode) initializeComponents() {
-	// Get terminal size
-	termWidth, termHeight := termui.TerminalDimensions()
-
-	// Create a grid
-	grid := termui.NewGrid()
-	grid.SetRect(0, 0, termWidth, termHeight)
-
-	// Create info box for overall progress
 	im.infoBox = widgets.NewParagraph()
 	im.infoBox.Title = "Backup Status"
 	im.infoBox.BorderStyle.Fg = termui.ColorCyan
 
-	// Create stats table
 	im.statsTable = widgets.NewTable()
 	im.statsTable.Title = "Statistics"
 	im.statsTable.BorderStyle.Fg = termui.ColorGreen
-	im.statsTable.RowSeparator = true
-	im.statsTable.FillRow = true
-	im.statsTable.Rows = [][]string{
-		{"Metric", "Value"},
-		{"Files Processed", "0"},
-		{"Files Skipped", "0"},
-		{"Files Failed", "0"},
-		{"Data Processed", "0 B"},
-		{"Upload Speed", "0 B/s"},
-		{"Elapsed Time", "0s"},
-		{"Est. Time Left", "N/A"},
-	}
-	im.statsTable.ColumnWidths = []int{20, 15}
+	im.statsTable.RowSeparator = false
+	im.statsTable.ColumnWidths = []int{20, 20}
 
-	// Create log box
 	im.logBox = widgets.NewList()
 	im.logBox.Title = "Activity Log"
 	im.logBox.BorderStyle.Fg = termui.ColorYellow
-	im.logBox.Rows = im.logs
 
-	// Initialize gauges for each stage
-	im.gauges = make(map[string]*widgets.Gauge)
-	for name, stage := range im.tracker.Stages {
+	im.layout()
+}
+
+// updateLoop redraws the dashboard on a timer and handles keys and resizes
+// until Stop, or until quit is pressed twice
+func (im *InteractiveMode) updateLoop() {
+	quit := false
+	defer func() {
+		termui.Close()
+		im.tracker.SetQuiet(false)
+		close(im.done)
+		if quit && im.config.OnQuit != nil {
+			im.config.OnQuit()
+		}
+	}()
+
+	ticker := time.NewTicker(im.config.RefreshInterval)
+	defer ticker.Stop()
+	events := termui.PollEvents()
+
+	im.render()
+	for {
+		select {
+		case <-im.stop:
+			return
+		case <-ticker.C:
+		case e := <-events:
+			if !im.handleEvent(e) {
+				quit = true
+				return
+			}
+		}
+		im.render()
+	}
+}
+
+// handleEvent acts on a key or resize. It returns false when quit is pressed
+// a second time: the dashboard closes to give the terminal back before
+// OnQuit is called again.
+func (im *InteractiveMode) handleEvent(e termui.Event) bool {
+	switch e.ID {
+	case "q", "<C-c>":
+		im.mu.Lock()
+		im.quits++
+		if im.quits > 1 {
+			im.running = false
+			im.mu.Unlock()
+			return false
+		}
+		im.mu.Unlock()
+
+		im.AddLog("Stopping: finishing the files in progress (press q again to quit now)")
+		if im.config.OnQuit != nil {
+			im.config.OnQuit()
+		}
+	case "p":
+		if im.tracker.Paused() {
+			im.tracker.Resume()
+			im.AddLog("Resumed")
+		} else {
+			im.tracker.Pause()
+			im.AddLog("Paused: files in progress are finished, no more are started")
+		}
+	case "v":
+		im.mu.Lock()
+		switch {
+		case im.verbosity <= slog.LevelDebug:
+			im.verbosity = slog.LevelWarn
+		case im.verbosity <= slog.LevelInfo:
+			im.verbosity = slog.LevelDebug
+		default:
+			im.verbosity = slog.LevelInfo
+		}
+		level := im.verbosity
+		im.mu.Unlock()
+		im.AddLog("Showing " + strings.ToLower(level.String()) + " messages and above")
+	case "r":
+		im.config.ShowDetailedView = !im.config.ShowDetailedView
+		im.layout()
+	case "<Resize>":
+		if size, ok := e.Payload.(termui.Resize); ok {
+			im.width, im.height = size.Width, size.Height
+			termui.Clear()
+			im.layout()
+		}
+	}
+	return true
+}
+
+// layout arranges the widgets on the grid, with a gauge per stage in the
+// detailed view. It runs when stages are added, the view is toggled or the
+// terminal is resized, not on every redraw.
+func (im *InteractiveMode) layout() {
+	im.stages = im.tracker.StageNames()
+	for _, name := range im.stages {
+		if _, ok := im.gauges[name]; ok {
+			continue
+		}
 		gauge := widgets.NewGauge()
-		gauge.Title = stage.Description
-		gauge.Percent = 0
+		if stage := im.tracker.GetStage(name); stage != nil {
+			gauge.Title = stage.Description
+		}
 		gauge.BarColor = termui.ColorBlue
 		gauge.BorderStyle.Fg = termui.ColorWhite
 		gauge.TitleStyle.Fg = termui.ColorCyan
 		im.gauges[name] = gauge
 	}
 
-	// Set up the layout based on whether detailed view is enabled
+	// Fixed heights in lines; the log gets the rest
+	const infoHeight, gaugeHeight, statsHeight, minLogHeight = 7, 3, 11, 5
+	fixed := infoHeight + statsHeight
 	if im.config.ShowDetailedView {
-		// Calculate heights based on number of stages and available space
-		stageHeight := 3
-		totalStagesHeight := len(im.gauges) * stageHeight
-		infoHeight := 5
-		statsHeight := 10
-		logHeight := termHeight - totalStagesHeight - infoHeight - statsHeight
-
-		// Ensure minimum log height
-		if logHeight < 5 {
-			logHeight = 5
-			// Adjust other components if needed
-			if totalStagesHeight > (termHeight - logHeight - infoHeight - 5) {
-				statsHeight = 5
-			}
-		}
+		fixed += gaugeHeight * len(im.stages)
+	}
+	total := max(im.height, fixed+minLogHeight)
+	row := func(lines int, widget interface{}) termui.GridItem {
+		return termui.NewRow(float64(lines)/float64(total), termui.NewCol(1.0, widget))
+	}
 
-		// Set up grid layout
-		grid.Set(
-			termui.NewRow(infoHeight/termHeight,
-				termui.NewCol(1.0, im.infoBox),
-			),
-		)
-
-		// Add a row for each stage gauge
-		for _, gauge := range im.gauges {
-			grid.Items = append(grid.Items,
-				termui.NewRow(float64(stageHeight)/float64(termHeight),
-					termui.NewCol(1.0, gauge),
-				),
-			)
+	rows := []interface{}{row(infoHeight, im.infoBox)}
+	if im.config.ShowDetailedView {
+		for _, name := range im.stages {
+			rows = append(rows, row(gaugeHeight, im.gauges[name]))
 		}
-
-		// Add stats and log sections
-		grid.Items = append(grid.Items,
-			termui.NewRow(float64(statsHeight)/float64(termHeight),
-				termui.NewCol(1.0, im.statsTable),
-			),
-			termui.NewRow(float64(logHeight)/float64(termHeight),
-				termui.NewCol(1.0, im.logBox),
-			),
-		)
-	} else {
-		// Simple layout with just overall progress and logs
-		grid.Set(
-			termui.NewRow(0.2,
-				termui.NewCol(1.0, im.infoBox),
-			),
-			termui.NewRow(0.3,
-				termui.NewCol(1.0, im.statsTable),
-			),
-			termui.NewRow(0.5,
-				termui.NewCol(1.0, im.logBox),
-			),
-		)
 	}
+	rows = append(rows,
+		row(statsHeight, im.statsTable),
+		row(total-fixed, im.logBox),
+	)
 
-	termui.Body = grid
-	termui.Render(termui.Body)
+	im.grid = termui.NewGrid()
+	im.grid.SetRect(0, 0, im.width, im.height)
+	im.grid.Set(rows...)
 }
 
-// updateLoop periodically updates the UI components
-func (im *InteractiveMode) updateLoop() {
-	ticker := time.NewTicker(im.config.RefreshInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			im.updateComponents()
-			termui.Render(termui.Body)
-		case <-im.stopChan:
-			return
-		}
+// render updates the widgets from the tracker and draws them
+func (im *InteractiveMode) render() {
+	if names := im.tracker.StageNames(); len(names) != len(im.stages) {
+		im.layout()
 	}
+	im.updateComponents()
+	termui.Render(im.grid)
 }
 
-// updateComponents updates all UI components with current data
+// updateComponents updates all widgets with current data
 func (im *InteractiveMode) updateComponents() {
-	im.mu.Lock()
-	defer im.mu.Unlock()
-
-	// Skip if not running
-	if !im.running {
-		return
-	}
-
-	// Get current statistics
+	left := im.tracker.EstimatedTimeLeft()
 	stats := im.tracker.Statistics
 	stats.mu.Lock()
-	defer stats.mu.Unlock()
-
-	// Update info box with overall status
 	var completionPercent float64
 	if stats.TotalFiles > 0 {
 		completionPercent = float64(stats.ProcessedFiles) / float64(stats.TotalFiles) * 100
 	}
-
-	im.infoBox.Text = fmt.Sprintf(
-		"Phase: %s\nFiles: %d/%d\nOverall Progress: %.1f%%\nCurrent Speed: %s/s",
-		color.CyanString(stats.CurrentPhase),
-		stats.ProcessedFiles,
-		stats.TotalFiles,
-		completionPercent,
-		formatBytes(int64(stats.UploadSpeed)),
-	)
-
-	// Update stats table
-	elapsedTime := time.Since(stats.StartTime)
+	phase := stats.CurrentPhase
+	filesLine := fmt.Sprintf("Files: %d/%d (%.1f%%)", stats.ProcessedFiles, stats.TotalFiles, completionPercent)
 	im.statsTable.Rows = [][]string{
 		{"Metric", "Value"},
 		{"Files Processed", fmt.Sprintf("%d", stats.ProcessedFiles)},
@@ -315,32 +315,124 @@ func (im *InteractiveMode) updateComponents() {
 		{"Data Processed", formatBytes(stats.BytesProcessed)},
 		{"Data Uploaded", formatBytes(stats.BytesUploaded)},
 		{"Upload Speed", fmt.Sprintf("%s/s", formatBytes(int64(stats.UploadSpeed)))},
-		{"Elapsed Time", formatDuration(elapsedTime)},
-		{"Est. Time Left", formatDuration(stats.EstimatedTimeLeft)},
+		{"Elapsed Time", formatDuration(time.Since(stats.StartTime))},
+		{"Est. Time Left", formatEstimate(left)},
+	}
+	stats.mu.Unlock()
+
+	state := "[running](fg:green)"
+	if im.tracker.Paused() {
+		state = "[paused](fg:yellow)"
 	}
+	im.mu.Lock()
+	verbosity := strings.ToLower(im.verbosity.String())
+	logs := append([]string(nil), im.logs...)
+	im.mu.Unlock()
+
+	im.infoBox.Text = fmt.Sprintf(
+		"Phase: [%s](fg:cyan), %s\n%s\nTime left: %s\nLog: %s and above\n[p] pause/resume  [v] verbosity  [r] stages  [q] quit",
+		phase, state, filesLine, formatEstimate(left), verbosity)
 
-	// Update gauges for all stages
-	for name, stage := range im.tracker.Stages {
-		gauge, ok := im.gauges[name]
-		if !ok {
+	for _, name := range im.stages {
+		stage := im.tracker.GetStage(name)
+		if stage == nil {
 			continue
 		}
+		percent, label := stageGauge(stage)
+		im.gauges[name].Percent = percent
+		im.gauges[name].Label = label
+	}
 
-		stage.mu.Lock()
-		var percent int
-		if stage.Total > 0 {
-			percent = int(float64(stage.Current) / float64(stage.Total) * 100)
-		}
-		label := fmt.Sprintf("%d/%d", stage.Current, stage.Total)
-		stage.mu.Unlock()
+	im.logBox.Rows = logs
+	im.logBox.ScrollBottom()
+}
+
+// stageGauge returns the percentage and label of a stage's gauge
+func stageGauge(stage *Stage) (int, string) {
+	stage.mu.Lock()
+	defer stage.mu.Unlock()
+
+	var percent int
+	if stage.Total > 0 {
+		percent = int(float64(stage.Current) / float64(stage.Total) * 100)
+	}
+	label := fmt.Sprintf("%d/%d", stage.Current, stage.Total)
+	if stage.byteUnits {
+		label = fmt.Sprintf("%s/%s", formatBytes(stage.Current), formatBytes(stage.Total))
+	}
+	if stage.complete {
+		return percent, label + ", done"
+	}
+	return percent, label + ", " + formatEstimate(stage.estimate(time.Now())) + " left"
+}
 
-		gauge.Percent = percent
-		gauge.Label = label
+// formatEstimate formats an estimate, which is 0 until there is a rate
+func formatEstimate(d time.Duration) string {
+	if d <= 0 {
+		return "N/A"
 	}
+	return formatDuration(d)
+}
 
-	// Update log list
-	im.logBox.Rows = im.logs
-	im.logBox.ScrollBottom()
+// LogHandler returns a log handler that shows records in the activity log
+// from the chosen verbosity up, and passes them on to next if it is not nil
+func (im *InteractiveMode) LogHandler(next slog.Handler) slog.Handler {
+	return &logHandler{sink: im, next: next}
+}
+
+// logSink is a view showing log records, such as the dashboard's activity
+// log
+type logSink interface {
+	AddLog(message string)
+	Verbosity() slog.Level
+}
+
+// logHandler writes log records to the activity log of a view
+type logHandler struct {
+	sink   logSink
+	next   slog.Handler
+	prefix string // Group names of the attributes, joined with dots
+	attrs  []string
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.sink.Verbosity() || (h.next != nil && h.next.Enabled(ctx, level))
+}
+
+func (h *logHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= h.sink.Verbosity() {
+		parts := append([]string{record.Level.String(), record.Message}, h.attrs...)
+		record.Attrs(func(attr slog.Attr) bool {
+			parts = append(parts, h.prefix+attr.Key+"="+attr.Value.String())
+			return true
+		})
+		h.sink.AddLog(strings.Join(parts, " "))
+	}
+	if h.next != nil && h.next.Enabled(ctx, record.Level) {
+		return h.next.Handle(ctx, record)
+	}
+	return nil
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handler := *h
+	handler.attrs = append([]string(nil), h.attrs...)
+	for _, attr := range attrs {
+		handler.attrs = append(handler.attrs, h.prefix+attr.Key+"="+attr.Value.String())
+	}
+	if h.next != nil {
+		handler.next = h.next.WithAttrs(attrs)
+	}
+	return &handler
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	handler := *h
+	handler.prefix = h.prefix + name + "."
+	if h.next != nil {
+		handler.next = h.next.WithGroup(name)
+	}
+	return &handler
 }
 
 // PrintToConsole prints the current progress to the console
@@ -349,10 +441,3 @@ func (im *InteractiveMode) PrintToConsole() {
 	fmt.Println(formatter.FormatStats(im.tracker))
 	fmt.Println(formatter.FormatStages(im.tracker))
 }
-
-// RunInteractiveMode starts an interactive display for the given tracker
-func RunInteractiveMode(tracker *Tracker) error {
-	interactive := NewInteractiveMode(tracker, DefaultInteractiveModeConfig())
-	interactive.AddLog("Starting interactive mode")
-	return interactive.Start()
-}
@@ -0,0 +1,99 @@
+package progress
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// socketWriteTimeout is how long a client of the socket has to read an
+// event before it is disconnected, so that a stalled reader doesn't hold up
+// the run
+const socketWriteTimeout = time.Second
+
+// SocketWriter writes the event stream to the clients connected to a Unix
+// socket, such as a GUI following the run. Clients get the events written
+// after they connect.
+type SocketWriter struct {
+	path     string
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+// ListenSocket creates the Unix socket at path and accepts clients on it
+// until Close. A socket left at path by a run that was killed is replaced;
+// one another run is listening on, or a file that isn't a socket, is an
+// error.
+func ListenSocket(path string) (*SocketWriter, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another run", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	w := &SocketWriter{path: path, listener: listener, conns: make(map[net.Conn]bool)}
+	go w.accept()
+	return w, nil
+}
+
+// accept adds clients until the listener is closed
+func (w *SocketWriter) accept() {
+	for {
+		conn, err := w.listener.Accept()
+		if err != nil {
+			return
+		}
+		w.mu.Lock()
+		w.conns[conn] = true
+		w.mu.Unlock()
+	}
+}
+
+// Write writes p to every connected client, disconnecting those that fail
+// to read it in time. It never fails, as the run goes on without clients.
+func (w *SocketWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for conn := range w.conns {
+		conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+		if _, err := conn.Write(p); err != nil {
+			conn.Close()
+			delete(w.conns, conn)
+		}
+	}
+	return len(p), nil
+}
+
+// Close stops accepting clients, disconnects those connected and removes
+// the socket file
+func (w *SocketWriter) Close() error {
+	err := w.listener.Close()
+	w.mu.Lock()
+	for conn := range w.conns {
+		conn.Close()
+		delete(w.conns, conn)
+	}
+	w.mu.Unlock()
+	// The listener usually removes the file as it closes
+	if rmErr := os.Remove(w.path); rmErr != nil && !errors.Is(rmErr, fs.ErrNotExist) && err == nil {
+		err = rmErr
+	}
+	return err
+}
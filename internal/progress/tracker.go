@@ -1,7 +1,10 @@
 package progress
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"sync"
 	"time"
 
@@ -20,9 +23,10 @@ type Stats struct {
 	StartTime         time.Time
 	LastUpdateTime    time.Time
 	CurrentPhase      string
-	ProcessingRate    float64 // files per second
-	UploadSpeed       float64 // bytes per second
-	EstimatedTimeLeft time.Duration
+	ProcessingRate    float64       // units of the current stage per second
+	UploadSpeed       float64       // bytes per second over the last rateWindowSize
+	EstimatedTimeLeft time.Duration // as of LastUpdateTime; see Tracker.EstimatedTimeLeft
+	uploads           rateWindow
 	mu                sync.Mutex
 }
 
@@ -33,7 +37,108 @@ type Stage struct {
 	Bar         *progressbar.ProgressBar
 	Total       int64
 	Current     int64
-	mu          sync.Mutex
+	// Size of the stage's items in bytes and how much of it is done; for
+	// stages counted in bytes these are Total and Current
+	BytesTotal int64
+	BytesDone  int64
+	byteUnits  bool
+	complete   bool
+	window     rateWindow
+	mu         sync.Mutex
+}
+
+// rateWindowSize is how far back rates are measured, so that estimates
+// follow the current throughput rather than the average since the start
+const rateWindowSize = 30 * time.Second
+
+// rateResolution is the shortest time between the samples of a rate window;
+// closer samples replace each other to keep the window small
+const rateResolution = time.Second
+
+// rateSample is a running total at a point in time
+type rateSample struct {
+	at    time.Time
+	total int64
+}
+
+// rateWindow measures the rate of a running total over the last
+// rateWindowSize
+type rateWindow struct {
+	samples []rateSample
+}
+
+// add records the running total at a point in time
+func (w *rateWindow) add(at time.Time, total int64) {
+	if n := len(w.samples); n >= 2 && at.Sub(w.samples[n-2].at) < rateResolution {
+		w.samples[n-1] = rateSample{at: at, total: total}
+		return
+	}
+	w.samples = append(w.samples, rateSample{at: at, total: total})
+	// Keep the last sample before the window as its baseline
+	cut := 0
+	for cut+1 < len(w.samples) && at.Sub(w.samples[cut+1].at) >= rateWindowSize {
+		cut++
+	}
+	w.samples = w.samples[cut:]
+}
+
+// rate returns the growth of the total per second up to now. It drops while
+// nothing is added, so a stall shows in the estimates.
+func (w *rateWindow) rate(now time.Time) float64 {
+	if len(w.samples) < 2 {
+		return 0
+	}
+	first, last := w.samples[0], w.samples[len(w.samples)-1]
+	elapsed := now.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(last.total-first.total) / elapsed
+}
+
+// estimate returns the time left to get from done to total at the current
+// rate, or 0 when there is no rate yet
+func (w *rateWindow) estimate(now time.Time, done, total int64) time.Duration {
+	rate := w.rate(now)
+	if rate <= 0 || done >= total {
+		return 0
+	}
+	return time.Duration(float64(total-done) / rate * float64(time.Second))
+}
+
+// progress returns how far the stage is and its size, in bytes when they
+// are known and otherwise in its own units. Callers hold the stage lock.
+func (s *Stage) progress() (done, total int64) {
+	if s.BytesTotal > 0 {
+		return s.BytesDone, s.BytesTotal
+	}
+	return s.Current, s.Total
+}
+
+// EstimatedTimeLeft returns the time the stage needs to complete at its
+// rate over the last rateWindowSize, or 0 when it is complete or has no
+// rate yet
+func (s *Stage) EstimatedTimeLeft() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.estimate(time.Now())
+}
+
+// estimate returns the time left at now. Callers hold the stage lock.
+func (s *Stage) estimate(now time.Time) time.Duration {
+	if s.complete {
+		return 0
+	}
+	done, total := s.progress()
+	return s.window.estimate(now, done, total)
+}
+
+// Rate returns the stage's throughput over the last rateWindowSize, in
+// bytes per second when its size in bytes is known
+func (s *Stage) Rate() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.window.rate(time.Now())
 }
 
 // Tracker manages multiple progress bars and statistics
@@ -41,29 +146,139 @@ type Tracker struct {
 	Stages     map[string]*Stage
 	Statistics *Stats
 	mu         sync.Mutex
+	order      []string // Stage names in the order they were added
+	events     *eventStream
+	listeners  map[int]func(Event) // Subscribers to the events
+	quiet      bool                // Another view, such as the dashboard, shows progress
+	resume     chan struct{}       // Closed unless paused
+
+	nextListener int
+	throttle     sync.Mutex       // Guards lastProgress
+	lastProgress time.Time        // When the last progress event was emitted
+	now          func() time.Time // Clock of the event throttle
 }
 
 // NewTracker creates a new progress tracker
 func NewTracker() *Tracker {
+	resume := make(chan struct{})
+	close(resume)
+
 	return &Tracker{
 		Stages: make(map[string]*Stage),
 		Statistics: &Stats{
 			StartTime:      time.Now(),
 			LastUpdateTime: time.Now(),
 		},
+		resume: resume,
+		now:    time.Now,
 	}
 }
 
-// AddStage adds a new stage to the tracker
-func (t *Tracker) AddStage(name, description string, total int64) *Stage {
+// SetQuiet stops drawing progress bars and stage messages for stages added
+// from now on, while another view shows the progress
+func (t *Tracker) SetQuiet(quiet bool) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	t.quiet = quiet
+}
+
+// Pause makes Wait block until Resume: work in progress is finished but no
+// more is started
+func (t *Tracker) Pause() {
+	t.mu.Lock()
+	paused := false
+	select {
+	case <-t.resume:
+		t.resume = make(chan struct{})
+		paused = true
+	default:
+	}
+	t.mu.Unlock()
+
+	if paused {
+		t.emit(EventPaused, nil)
+	}
+}
+
+// Resume lets work paused with Pause continue
+func (t *Tracker) Resume() {
+	t.mu.Lock()
+	resumed := false
+	select {
+	case <-t.resume:
+	default:
+		close(t.resume)
+		resumed = true
+	}
+	t.mu.Unlock()
+
+	if resumed {
+		t.emit(EventResumed, nil)
+	}
+}
+
+// Paused reports whether the tracker is paused
+func (t *Tracker) Paused() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.resume:
+		return false
+	default:
+		return true
+	}
+}
+
+// Wait blocks while the tracker is paused, returning early if ctx is done
+func (t *Tracker) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	resume := t.resume
+	t.mu.Unlock()
+
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StageNames returns the names of the stages in the order they were added
+func (t *Tracker) StageNames() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.order...)
+}
+
+// AddStage adds a new stage to the tracker, counted in items such as files
+func (t *Tracker) AddStage(name, description string, total int64) *Stage {
+	return t.addStage(name, description, total, false)
+}
+
+// AddByteStage adds a new stage to the tracker counted in bytes, whose
+// estimates follow the bytes done
+func (t *Tracker) AddByteStage(name, description string, totalBytes int64) *Stage {
+	return t.addStage(name, description, totalBytes, true)
+}
+
+func (t *Tracker) addStage(name, description string, total int64, byteUnits bool) *Stage {
+	t.mu.Lock()
+
+	// Bars are drawn only when no event stream or other view replaces them
+	writer := io.Writer(os.Stdout)
+	if t.events != nil || t.quiet {
+		writer = io.Discard
+	}
 
 	bar := progressbar.NewOptions64(
 		total,
+		progressbar.OptionSetWriter(writer),
 		progressbar.OptionSetDescription(description),
 		progressbar.OptionSetWidth(50),
-		progressbar.OptionShowBytes(true),
+		progressbar.OptionShowBytes(byteUnits),
 		progressbar.OptionShowCount(),
 		progressbar.OptionSetTheme(progressbar.Theme{
 			Saucer:        "=",
@@ -79,9 +294,20 @@ func (t *Tracker) AddStage(name, description string, total int64) *Stage {
 		Description: description,
 		Bar:         bar,
 		Total:       total,
+		byteUnits:   byteUnits,
 	}
+	if byteUnits {
+		stage.BytesTotal = total
+	}
+	stage.window.add(time.Now(), 0)
 
+	if _, ok := t.Stages[name]; !ok {
+		t.order = append(t.order, name)
+	}
 	t.Stages[name] = stage
+	t.mu.Unlock()
+
+	t.emit(EventStageStart, stage)
 	return stage
 }
 
@@ -99,41 +325,110 @@ func (t *Tracker) UpdateStage(name string, current int64) {
 		return
 	}
 
+	if t.advanceStage(stage, current) {
+		t.emit(EventProgress, stage)
+	}
+}
+
+// advanceStage moves a stage forward to current and updates the rate and
+// estimate. It reports whether the stage moved.
+func (t *Tracker) advanceStage(stage *Stage, current int64) bool {
 	stage.mu.Lock()
-	defer stage.mu.Unlock()
+	moved := stage.advance(current - stage.Current)
+	stage.mu.Unlock()
+
+	if moved {
+		t.updateEstimates(stage, time.Now())
+	}
+	return moved
+}
 
-	// Calculate increment needed
-	increment := current - stage.Current
+// advance moves a stage forward by increment, ignoring increments that
+// aren't positive, and reports whether it moved. stage.mu is held, so that
+// concurrent increments all count.
+func (stage *Stage) advance(increment int64) bool {
 	if increment <= 0 {
-		return
+		return false
 	}
 
-	stage.Current = current
+	stage.Current += increment
 	stage.Bar.Add64(increment)
+	if stage.byteUnits {
+		stage.BytesDone = stage.Current
+	}
+	if stage.byteUnits || stage.BytesTotal == 0 {
+		stage.window.add(time.Now(), stage.Current)
+	}
+	return true
+}
 
-	// Update statistics
-	t.Statistics.mu.Lock()
-	defer t.Statistics.mu.Unlock()
+// SetStageBytes sets the size in bytes of the items of a stage counted in
+// items, so that its estimates follow the bytes done with
+// IncrementStageBytes rather than the number of items: one large file takes
+// longer than many small ones.
+func (t *Tracker) SetStageBytes(name string, totalBytes int64) {
+	stage := t.GetStage(name)
+	if stage == nil || stage.byteUnits {
+		return
+	}
+
+	stage.mu.Lock()
+	defer stage.mu.Unlock()
+	stage.BytesTotal = totalBytes
+	stage.window = rateWindow{}
+	stage.window.add(time.Now(), stage.BytesDone)
+}
+
+// IncrementStageBytes adds to the bytes done in a stage sized with
+// SetStageBytes
+func (t *Tracker) IncrementStageBytes(name string, bytes int64) {
+	stage := t.GetStage(name)
+	if stage == nil || stage.byteUnits || bytes <= 0 {
+		return
+	}
 
-	t.Statistics.CurrentPhase = name
+	stage.mu.Lock()
+	stage.BytesDone += bytes
 	now := time.Now()
+	stage.window.add(now, stage.BytesDone)
+	stage.mu.Unlock()
 
-	// Calculate processing rate
-	elapsed := now.Sub(t.Statistics.LastUpdateTime).Seconds()
-	if elapsed > 0 {
-		t.Statistics.ProcessingRate = float64(increment) / elapsed
+	t.updateEstimates(stage, now)
+}
 
-		// Calculate estimated time left for this stage
-		remainingItems := stage.Total - stage.Current
-		if t.Statistics.ProcessingRate > 0 {
-			remainingSeconds := float64(remainingItems) / t.Statistics.ProcessingRate
-			t.Statistics.EstimatedTimeLeft = time.Duration(remainingSeconds) * time.Second
-		}
-	}
+// updateEstimates updates the rate and overall estimate after a stage moved
+func (t *Tracker) updateEstimates(stage *Stage, now time.Time) {
+	stage.mu.Lock()
+	rate := stage.window.rate(now)
+	stage.mu.Unlock()
+	left := t.EstimatedTimeLeft()
 
+	t.Statistics.mu.Lock()
+	defer t.Statistics.mu.Unlock()
+	t.Statistics.CurrentPhase = stage.Name
+	t.Statistics.ProcessingRate = rate
+	t.Statistics.EstimatedTimeLeft = left
 	t.Statistics.LastUpdateTime = now
 }
 
+// EstimatedTimeLeft returns the time the stages started so far need to
+// complete, each at its rate over the last rateWindowSize. Stages run one
+// after another, so their estimates add up.
+func (t *Tracker) EstimatedTimeLeft() time.Duration {
+	t.mu.Lock()
+	stages := make([]*Stage, 0, len(t.Stages))
+	for _, name := range t.order {
+		stages = append(stages, t.Stages[name])
+	}
+	t.mu.Unlock()
+
+	var left time.Duration
+	for _, stage := range stages {
+		left += stage.EstimatedTimeLeft()
+	}
+	return left
+}
+
 // IncrementStage increments a stage's progress by a given amount
 func (t *Tracker) IncrementStage(name string, increment int64) {
 	stage := t.GetStage(name)
@@ -142,11 +437,13 @@ func (t *Tracker) IncrementStage(name string, increment int64) {
 	}
 
 	stage.mu.Lock()
-	stage.Current += increment
-	currentValue := stage.Current
+	moved := stage.advance(increment)
 	stage.mu.Unlock()
 
-	t.UpdateStage(name, currentValue)
+	if moved {
+		t.updateEstimates(stage, time.Now())
+		t.emit(EventProgress, stage)
+	}
 }
 
 // CompleteStage marks a stage as complete
@@ -157,12 +454,24 @@ func (t *Tracker) CompleteStage(name string) {
 	}
 
 	stage.mu.Lock()
-	defer stage.mu.Unlock()
-
 	stage.Bar.Finish()
+	stage.complete = true
+	stage.mu.Unlock()
+
+	t.emit(EventStageComplete, stage)
+	if t.eventsEnabled() || t.isQuiet() {
+		return
+	}
 	fmt.Printf("\nCompleted stage: %s\n", stage.Description)
 }
 
+// isQuiet reports whether another view shows the progress
+func (t *Tracker) isQuiet() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.quiet
+}
+
 // UpdateFileStats updates file processing statistics
 func (t *Tracker) UpdateFileStats(processed, skipped, failed int64, bytesProcessed int64) {
 	t.Statistics.mu.Lock()
@@ -172,12 +481,6 @@ func (t *Tracker) UpdateFileStats(processed, skipped, failed int64, bytesProcess
 	t.Statistics.SkippedFiles += skipped
 	t.Statistics.FailedFiles += failed
 	t.Statistics.BytesProcessed += bytesProcessed
-
-	// Update upload speed
-	elapsed := time.Since(t.Statistics.StartTime).Seconds()
-	if elapsed > 0 {
-		t.Statistics.UploadSpeed = float64(t.Statistics.BytesUploaded) / elapsed
-	}
 }
 
 // UpdateTotals updates the total counts
@@ -194,17 +497,23 @@ func (t *Tracker) UpdateUploadStats(bytesUploaded int64) {
 	t.Statistics.mu.Lock()
 	defer t.Statistics.mu.Unlock()
 
-	t.Statistics.BytesUploaded += bytesUploaded
-
-	// Update upload speed
-	elapsed := time.Since(t.Statistics.StartTime).Seconds()
-	if elapsed > 0 {
-		t.Statistics.UploadSpeed = float64(t.Statistics.BytesUploaded) / elapsed
+	stats := t.Statistics
+	if len(stats.uploads.samples) == 0 {
+		stats.uploads.add(stats.StartTime, 0)
 	}
+	stats.BytesUploaded += bytesUploaded
+	now := time.Now()
+	stats.uploads.add(now, stats.BytesUploaded)
+	stats.UploadSpeed = stats.uploads.rate(now)
 }
 
 // PrintSummary prints a summary of the backup process
 func (t *Tracker) PrintSummary() {
+	t.emit(EventSummary, nil)
+	if t.eventsEnabled() {
+		return
+	}
+
 	t.Statistics.mu.Lock()
 	defer t.Statistics.mu.Unlock()
 
@@ -221,8 +530,8 @@ func (t *Tracker) PrintSummary() {
 	fmt.Printf("Data uploaded: %s\n", formatBytes(t.Statistics.BytesUploaded))
 	fmt.Printf("Total time: %s\n", formatDuration(elapsed))
 
-	if t.Statistics.UploadSpeed > 0 {
-		fmt.Printf("Average upload speed: %s/s\n", formatBytes(int64(t.Statistics.UploadSpeed)))
+	if seconds := elapsed.Seconds(); t.Statistics.BytesUploaded > 0 && seconds > 0 {
+		fmt.Printf("Average upload speed: %s/s\n", formatBytes(int64(float64(t.Statistics.BytesUploaded)/seconds)))
 	}
 
 	// Calculate completion percentage
@@ -0,0 +1,128 @@
+package progress
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateWindow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var w rateWindow
+	w.add(start, 0)
+
+	// 1 MB/s for a minute, then 10 MB/s: the rate follows the last 30s
+	var total int64
+	for i := 1; i <= 60; i++ {
+		total += 1 << 20
+		w.add(start.Add(time.Duration(i)*time.Second), total)
+	}
+	for i := 61; i <= 100; i++ {
+		total += 10 << 20
+		w.add(start.Add(time.Duration(i)*time.Second), total)
+	}
+	now := start.Add(100 * time.Second)
+	if rate := w.rate(now); rate < 9.5*(1<<20) || rate > 10.5*(1<<20) {
+		t.Errorf("Expected about 10 MB/s, got %.0f B/s", rate)
+	}
+	if len(w.samples) > 32 {
+		t.Errorf("Expected the window to drop old samples, has %d", len(w.samples))
+	}
+
+	left := w.estimate(now, total, total+600<<20)
+	if left < 55*time.Second || left > 65*time.Second {
+		t.Errorf("Expected about 60s left, got %s", left)
+	}
+
+	// Nothing done for a while: the rate drops
+	if stalled := w.rate(now.Add(time.Minute)); stalled >= w.rate(now)/2 {
+		t.Errorf("Expected a stall to lower the rate, got %.0f B/s", stalled)
+	}
+}
+
+func TestStageBytes(t *testing.T) {
+	tracker := NewTracker()
+	tracker.SetEventWriter(io.Discard)
+	tracker.AddStage("documents", "Processing documents", 2)
+	tracker.SetStageBytes("documents", 100<<20)
+
+	// One small document done of a small and a large one: most bytes remain
+	stage := tracker.GetStage("documents")
+	stage.mu.Lock()
+	stage.window = rateWindow{}
+	base := time.Now().Add(-10 * time.Second)
+	stage.window.add(base, 0)
+	stage.mu.Unlock()
+	tracker.IncrementStage("documents", 1)
+	tracker.IncrementStageBytes("documents", 1<<20)
+
+	if left := stage.EstimatedTimeLeft(); left < 15*time.Minute {
+		t.Errorf("Expected the estimate to follow the bytes left, got %s", left)
+	}
+	if left := tracker.EstimatedTimeLeft(); left < 15*time.Minute {
+		t.Errorf("Expected the overall estimate to include the stage, got %s", left)
+	}
+
+	tracker.CompleteStage("documents")
+	if left := tracker.EstimatedTimeLeft(); left != 0 {
+		t.Errorf("Expected no time left after completion, got %s", left)
+	}
+}
+
+func TestConcurrentIncrements(t *testing.T) {
+	tracker := NewTracker()
+	tracker.SetQuiet(true)
+	const workers, increments = 8, 2000
+	tracker.AddStage("documents", "Processing documents", workers*increments)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				tracker.IncrementStage("documents", 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stage := tracker.GetStage("documents"); stage.Current != workers*increments {
+		t.Errorf("Expected %d items done, got %d", workers*increments, stage.Current)
+	}
+}
+
+func TestPause(t *testing.T) {
+	tracker := NewTracker()
+	ctx := context.Background()
+	if err := tracker.Wait(ctx); err != nil {
+		t.Fatalf("Expected no wait while running, got %v", err)
+	}
+
+	tracker.Pause()
+	tracker.Pause()
+	if !tracker.Paused() {
+		t.Fatal("Expected the tracker to be paused")
+	}
+	waited := make(chan error)
+	go func() { waited <- tracker.Wait(ctx) }()
+	select {
+	case <-waited:
+		t.Fatal("Expected Wait to block while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	tracker.Resume()
+	tracker.Resume()
+	if err := <-waited; err != nil {
+		t.Errorf("Expected Wait to return on resume, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := tracker.Wait(cancelled); err == nil {
+		t.Error("Expected Wait to return the context's error")
+	}
+}
@@ -0,0 +1,326 @@
+package progress
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxWebLogs is how many recent log lines the web page shows
+const maxWebLogs = 200
+
+// WebServer serves a live view of a tracker over HTTP, for runs watched from
+// another machine: /progress is a page with the progress bars, throughput
+// charts, recent log lines and spend, updated from /progress/events, a
+// stream of server-sent events
+type WebServer struct {
+	tracker     *Tracker
+	server      *http.Server
+	listener    net.Listener
+	unsubscribe func()
+
+	mu      sync.Mutex
+	spend   func() float64
+	logs    []string
+	clients map[chan webMessage]bool
+}
+
+// webMessage is a server-sent event
+type webMessage struct {
+	name string // progress or log
+	data []byte // JSON
+}
+
+// webProgress is a progress event with the spend so far
+type webProgress struct {
+	Event
+	Spend float64 `json:"spend"`
+}
+
+// NewWebServer creates a web view of tracker
+func NewWebServer(tracker *Tracker) *WebServer {
+	return &WebServer{tracker: tracker, clients: make(map[chan webMessage]bool)}
+}
+
+// SetSpend sets the function returning the LLM spend of the run in USD
+func (w *WebServer) SetSpend(spend func() float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.spend = spend
+}
+
+// Start listens on addr, such as "localhost:8080", and serves until Stop
+func (w *WebServer) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	w.listener = listener
+	w.server = &http.Server{Handler: w.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	w.unsubscribe = w.tracker.Subscribe(w.publish)
+	go func() {
+		if err := w.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("progress page stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// URL returns the address of the progress page
+func (w *WebServer) URL() string {
+	return "http://" + w.listener.Addr().String() + "/progress"
+}
+
+// Stop closes the connections and stops serving
+func (w *WebServer) Stop() {
+	if w.unsubscribe != nil {
+		w.unsubscribe()
+	}
+	if w.server != nil {
+		w.server.Close()
+	}
+}
+
+// Handler returns the handler serving the page and its events
+func (w *WebServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /progress", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(rw, progressPage)
+	})
+	mux.HandleFunc("GET /progress/events", w.serveEvents)
+	return mux
+}
+
+// serveEvents streams events to a client, starting with the state of every
+// stage and the recent log lines
+func (w *WebServer) serveEvents(rw http.ResponseWriter, r *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+
+	messages := make(chan webMessage, 256)
+	w.mu.Lock()
+	logs := append([]string(nil), w.logs...)
+	w.clients[messages] = true
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.clients, messages)
+		w.mu.Unlock()
+	}()
+
+	for _, event := range w.tracker.Snapshot() {
+		writeMessage(rw, w.progressMessage(event))
+	}
+	for _, line := range logs {
+		writeMessage(rw, logMessage(line))
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case message := <-messages:
+			writeMessage(rw, message)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeMessage writes a server-sent event
+func writeMessage(rw http.ResponseWriter, message webMessage) {
+	fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", message.name, message.data)
+}
+
+// publish sends a tracker event to the clients
+func (w *WebServer) publish(event Event) {
+	w.broadcast(w.progressMessage(event))
+}
+
+// broadcast sends a message to every client, dropping it for clients too
+// slow to take it so the run never waits for a browser
+func (w *WebServer) broadcast(message webMessage) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for client := range w.clients {
+		select {
+		case client <- message:
+		default:
+		}
+	}
+}
+
+// progressMessage encodes a progress event with the spend so far
+func (w *WebServer) progressMessage(event Event) webMessage {
+	w.mu.Lock()
+	spend := w.spend
+	w.mu.Unlock()
+	update := webProgress{Event: event}
+	if spend != nil {
+		update.Spend = spend()
+	}
+	data, _ := json.Marshal(update)
+	return webMessage{name: "progress", data: data}
+}
+
+// logMessage encodes a log line
+func logMessage(line string) webMessage {
+	data, _ := json.Marshal(line)
+	return webMessage{name: "log", data: data}
+}
+
+// AddLog adds a line to the log shown on the page
+func (w *WebServer) AddLog(message string) {
+	line := fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), message)
+	w.mu.Lock()
+	if len(w.logs) >= maxWebLogs {
+		w.logs = w.logs[1:]
+	}
+	w.logs = append(w.logs, line)
+	w.mu.Unlock()
+	w.broadcast(logMessage(line))
+}
+
+// Verbosity returns the lowest level of the log records shown
+func (w *WebServer) Verbosity() slog.Level {
+	return slog.LevelInfo
+}
+
+// LogHandler returns a log handler that shows records from info up on the
+// page, and passes them on to next if it is not nil
+func (w *WebServer) LogHandler(next slog.Handler) slog.Handler {
+	return &logHandler{sink: w, next: next}
+}
+
+// progressPage shows the events of /progress/events
+const progressPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Archiver progress</title>
+<style>
+body { font: 14px system-ui, sans-serif; margin: 2em auto; max-width: 60em; padding: 0 1em; color: #222; }
+h1 { font-size: 1.4em; }
+.totals { display: flex; flex-wrap: wrap; gap: 1.5em; margin-bottom: 1.5em; }
+.totals div { min-width: 8em; }
+.totals b { display: block; font-size: 1.4em; }
+.stage { margin: .8em 0; }
+.stage .label { display: flex; justify-content: space-between; }
+.bar { background: #eee; border-radius: 4px; height: 14px; overflow: hidden; }
+.bar div { background: #3a7bd5; height: 100%; width: 0; transition: width .3s; }
+.stage.done .bar div { background: #4caf50; }
+canvas { width: 100%; height: 160px; border: 1px solid #ddd; border-radius: 4px; }
+#logs { background: #111; color: #ddd; font: 12px monospace; height: 20em; overflow-y: auto; padding: .5em; border-radius: 4px; white-space: pre-wrap; }
+#status { color: #888; }
+</style>
+</head>
+<body>
+<h1>Archiver progress <span id="status">connecting…</span></h1>
+<div class="totals">
+  <div>Files<b id="files">–</b></div>
+  <div>Failed<b id="failed">–</b></div>
+  <div>Processed<b id="bytes">–</b></div>
+  <div>Uploaded<b id="uploaded">–</b></div>
+  <div>Upload speed<b id="speed">–</b></div>
+  <div>Time left<b id="eta">–</b></div>
+  <div>Elapsed<b id="elapsed">–</b></div>
+  <div>Spend<b id="spend">–</b></div>
+</div>
+<div id="stages"></div>
+<h2>Throughput</h2>
+<canvas id="chart" width="960" height="160"></canvas>
+<h2>Log</h2>
+<div id="logs"></div>
+<script>
+const stages = {}, samples = [];
+function size(n) {
+  const units = ["B", "KB", "MB", "GB", "TB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) { n /= 1024; i++; }
+  return n.toFixed(i ? 1 : 0) + " " + units[i];
+}
+function duration(s) {
+  if (!s) return "–";
+  s = Math.round(s);
+  const h = Math.floor(s / 3600), m = Math.floor(s % 3600 / 60);
+  return h ? h + "h " + m + "m" : m ? m + "m " + s % 60 + "s" : s + "s";
+}
+function stage(e) {
+  let el = stages[e.stage];
+  if (!el) {
+    el = document.createElement("div");
+    el.className = "stage";
+    el.innerHTML = '<div class="label"><span></span><span></span></div><div class="bar"><div></div></div>';
+    document.getElementById("stages").appendChild(el);
+    stages[e.stage] = el;
+  }
+  const bytes = e.stage_bytes_total > 0;
+  const done = bytes ? e.stage_bytes_done : e.current, total = bytes ? e.stage_bytes_total : e.total;
+  const labels = el.querySelectorAll(".label span");
+  labels[0].textContent = e.description || e.stage;
+  labels[1].textContent = (bytes ? size(done) + " / " + size(total) : done + " / " + total) +
+    (e.stage_eta_seconds ? " – " + duration(e.stage_eta_seconds) + " left" : "");
+  el.querySelector(".bar div").style.width = (total ? Math.min(100, 100 * done / total) : 0) + "%";
+  if (e.type === "stage_complete") el.classList.add("done");
+}
+function chart() {
+  const canvas = document.getElementById("chart"), ctx = canvas.getContext("2d");
+  ctx.clearRect(0, 0, canvas.width, canvas.height);
+  if (samples.length < 2) return;
+  const max = Math.max(1, ...samples.map(s => s.speed));
+  ctx.strokeStyle = "#3a7bd5";
+  ctx.lineWidth = 2;
+  ctx.beginPath();
+  samples.forEach((s, i) => {
+    const x = i / (samples.length - 1) * canvas.width, y = canvas.height - 10 - s.speed / max * (canvas.height - 30);
+    i ? ctx.lineTo(x, y) : ctx.moveTo(x, y);
+  });
+  ctx.stroke();
+  ctx.fillStyle = "#555";
+  ctx.fillText("upload " + size(max) + "/s peak", 8, 14);
+}
+const source = new EventSource("/progress/events");
+source.onopen = () => document.getElementById("status").textContent = "";
+source.onerror = () => document.getElementById("status").textContent = "disconnected, retrying…";
+source.addEventListener("progress", m => {
+  const e = JSON.parse(m.data);
+  if (e.stage) stage(e);
+  document.getElementById("files").textContent = e.files_processed + " / " + e.files_total;
+  document.getElementById("failed").textContent = e.files_failed;
+  document.getElementById("bytes").textContent = size(e.bytes_processed);
+  document.getElementById("uploaded").textContent = size(e.bytes_uploaded);
+  document.getElementById("speed").textContent = size(e.upload_speed) + "/s";
+  document.getElementById("eta").textContent = duration(e.eta_seconds);
+  document.getElementById("elapsed").textContent = duration(e.elapsed_seconds);
+  document.getElementById("spend").textContent = "$" + e.spend.toFixed(4);
+  if (e.type === "paused") document.getElementById("status").textContent = "paused";
+  if (e.type === "resumed") document.getElementById("status").textContent = "";
+  if (e.type === "summary") document.getElementById("status").textContent = "finished";
+  samples.push({speed: e.upload_speed});
+  if (samples.length > 600) samples.shift();
+  chart();
+});
+source.addEventListener("log", m => {
+  const logs = document.getElementById("logs"), atEnd = logs.scrollTop + logs.clientHeight >= logs.scrollHeight - 5;
+  const line = document.createElement("div");
+  line.textContent = JSON.parse(m.data);
+  logs.appendChild(line);
+  while (logs.children.length > 500) logs.firstChild.remove();
+  if (atEnd) logs.scrollTop = logs.scrollHeight;
+});
+</script>
+</body>
+</html>
+`
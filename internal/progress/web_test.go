@@ -0,0 +1,72 @@
+package progress
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebServer(t *testing.T) {
+	tracker := NewTracker()
+	tracker.SetQuiet(true)
+	tracker.AddStage("scan", "Scanning files", 10)
+	tracker.IncrementStage("scan", 4)
+
+	web := NewWebServer(tracker)
+	web.SetSpend(func() float64 { return 0.25 })
+	web.AddLog("scan started")
+	if err := web.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer web.Stop()
+
+	resp, err := http.Get(web.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), `new EventSource("/progress/events")`) {
+		t.Fatalf("Unexpected page: %d %s", resp.StatusCode, page)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, web.URL()+"/events", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	// A new client gets the state of each stage and the recent log lines,
+	// then the events as they happen
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		for lines.Scan() {
+			if data, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+				return data
+			}
+		}
+		t.Fatal("Event stream ended")
+		return ""
+	}
+	if data := next(); !strings.Contains(data, `"stage":"scan"`) || !strings.Contains(data, `"current":4`) || !strings.Contains(data, `"spend":0.25`) {
+		t.Errorf("Unexpected snapshot: %s", data)
+	}
+	if data := next(); !strings.Contains(data, "scan started") {
+		t.Errorf("Unexpected log line: %s", data)
+	}
+
+	tracker.CompleteStage("scan")
+	if data := next(); !strings.Contains(data, `"type":"stage_complete"`) {
+		t.Errorf("Unexpected event: %s", data)
+	}
+}
@@ -0,0 +1,408 @@
+package qr
+
+import "fmt"
+
+// Code is an encoded QR code. Modules are indexed [y][x]; true is dark.
+type Code struct {
+	Version  int
+	Size     int
+	modules  [][]bool
+	function [][]bool // Finder, timing, alignment and format modules
+}
+
+// Dark reports whether the module at x, y is dark
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// blockLayout is the error correction layout of one version at level M
+type blockLayout struct {
+	ecPerBlock int
+	groups     [][2]int // Number of blocks and data codewords per block
+	alignment  []int    // Alignment pattern centre coordinates
+}
+
+// layouts lists versions 1-10 at error correction level M, which holds up
+// to 213 bytes: plenty for a URL
+var layouts = []blockLayout{
+	1:  {10, [][2]int{{1, 16}}, nil},
+	2:  {16, [][2]int{{1, 28}}, []int{6, 18}},
+	3:  {26, [][2]int{{1, 44}}, []int{6, 22}},
+	4:  {18, [][2]int{{2, 32}}, []int{6, 26}},
+	5:  {24, [][2]int{{2, 43}}, []int{6, 30}},
+	6:  {16, [][2]int{{4, 27}}, []int{6, 34}},
+	7:  {18, [][2]int{{4, 31}}, []int{6, 22, 38}},
+	8:  {22, [][2]int{{2, 38}, {2, 39}}, []int{6, 24, 42}},
+	9:  {22, [][2]int{{3, 36}, {2, 37}}, []int{6, 26, 46}},
+	10: {26, [][2]int{{4, 43}, {1, 44}}, []int{6, 28, 50}},
+}
+
+// dataCodewords returns the number of data codewords of the layout
+func (l blockLayout) dataCodewords() int {
+	total := 0
+	for _, group := range l.groups {
+		total += group[0] * group[1]
+	}
+	return total
+}
+
+// Encode encodes data in byte mode at error correction level M, using the
+// smallest version that fits
+func Encode(data string) (*Code, error) {
+	for version := 1; version < len(layouts); version++ {
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= 8*layouts[version].dataCodewords() {
+			return encode([]byte(data), version, countBits), nil
+		}
+	}
+	return nil, fmt.Errorf("data too long for a QR code (%d bytes, at most 213)", len(data))
+}
+
+// encode builds the symbol for data at the given version
+func encode(data []byte, version, countBits int) *Code {
+	layout := layouts[version]
+	capacity := 8 * layout.dataCodewords()
+
+	// Mode indicator, character count, data, terminator and padding
+	var bits bitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), countBits)
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := interleave(bits.bytes(), layout)
+
+	code := newCode(version)
+	code.drawFunctionPatterns(layout)
+	code.drawCodewords(codewords)
+	code.applyBestMask()
+	return code
+}
+
+// interleave splits the data into blocks, adds their error correction
+// codewords and interleaves the result
+func interleave(data []byte, layout blockLayout) []byte {
+	var blocks, ecBlocks [][]byte
+	offset := 0
+	for _, group := range layout.groups {
+		for i := 0; i < group[0]; i++ {
+			block := data[offset : offset+group[1]]
+			offset += group[1]
+			blocks = append(blocks, block)
+			ecBlocks = append(ecBlocks, reedSolomon(block, layout.ecPerBlock))
+		}
+	}
+
+	var result []byte
+	longest := layout.groups[len(layout.groups)-1][1]
+	for i := 0; i < longest; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// newCode creates an empty symbol for a version
+func newCode(version int) *Code {
+	size := 17 + 4*version
+	code := &Code{Version: version, Size: size}
+	code.modules = make([][]bool, size)
+	for y := range code.modules {
+		code.modules[y] = make([]bool, size)
+	}
+	return code
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns and
+// reserves the format and version areas
+func (c *Code) drawFunctionPatterns(layout blockLayout) {
+	c.function = make([][]bool, c.Size)
+	for y := range c.function {
+		c.function[y] = make([]bool, c.Size)
+	}
+	set := func(x, y int, dark bool) {
+		c.modules[y][x] = dark
+		c.function[y][x] = true
+	}
+
+	// Timing patterns
+	for i := 0; i < c.Size; i++ {
+		set(6, i, i%2 == 0)
+		set(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their separators
+	for _, corner := range [][2]int{{3, 3}, {c.Size - 4, 3}, {3, c.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := corner[0]+dx, corner[1]+dy
+				if x < 0 || x >= c.Size || y < 0 || y >= c.Size {
+					continue
+				}
+				distance := max(abs(dx), abs(dy))
+				set(x, y, distance != 2 && distance != 4)
+			}
+		}
+	}
+
+	// Alignment patterns, except where they would overlap the finders
+	positions := layout.alignment
+	for i, cy := range positions {
+		for j, cx := range positions {
+			last := len(positions) - 1
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas (drawn with the mask) and draw the version
+	c.drawFormat(0, set)
+	if c.Version >= 7 {
+		bits := versionBits(c.Version)
+		for i := 0; i < 18; i++ {
+			dark := bits>>i&1 != 0
+			a, b := c.Size-11+i%3, i/3
+			set(a, b, dark)
+			set(b, a, dark)
+		}
+	}
+}
+
+// drawFormat draws both copies of the format information for a mask
+func (c *Code) drawFormat(mask int, set func(x, y int, dark bool)) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		set(8, i, bit(i))
+	}
+	set(8, 7, bit(6))
+	set(8, 8, bit(7))
+	set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		set(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		set(8, c.Size-15+i, bit(i))
+	}
+	set(8, c.Size-8, true) // Dark module
+}
+
+// drawCodewords places the codewords in the zigzag order, skipping function
+// modules. Modules left over are remainder bits and stay light.
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = c.Size - 1 - vert
+				}
+				if c.function[y][x] || i >= 8*len(codewords) {
+					continue
+				}
+				c.modules[y][x] = codewords[i/8]>>(7-i%8)&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask with the lowest penalty and draws its
+// format information
+func (c *Code) applyBestMask() {
+	set := func(x, y int, dark bool) { c.modules[y][x] = dark }
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.toggleMask(mask)
+		c.drawFormat(mask, set)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		c.toggleMask(mask)
+	}
+
+	c.toggleMask(best)
+	c.drawFormat(best, set)
+	c.function = nil
+}
+
+// toggleMask inverts the data modules selected by a mask pattern
+func (c *Code) toggleMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.function[y][x] && maskBit(mask, x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// maskBit reports whether a mask pattern inverts the module at x, y
+func maskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// penalty scores a masked symbol by the four rules of the specification:
+// long runs, 2x2 blocks, finder-like patterns and dark/light imbalance
+func (c *Code) penalty() int {
+	penalty := 0
+	dark := 0
+	for a := 0; a < c.Size; a++ {
+		var row, column []bool
+		for b := 0; b < c.Size; b++ {
+			row = append(row, c.modules[a][b])
+			column = append(column, c.modules[b][a])
+		}
+		penalty += linePenalty(row) + linePenalty(column)
+
+		for b := 0; b < c.Size; b++ {
+			if c.modules[a][b] {
+				dark++
+			}
+			if a+1 < c.Size && b+1 < c.Size {
+				v := c.modules[a][b]
+				if v == c.modules[a][b+1] && v == c.modules[a+1][b] && v == c.modules[a+1][b+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	total := c.Size * c.Size
+	deviation := abs(dark*20-total*10) / total
+	return penalty + 10*deviation
+}
+
+// finderLike is the 1:1:3:1:1 pattern with four light modules on one side
+var finderLike = [][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// linePenalty scores the runs and finder-like patterns of one row or column
+func linePenalty(line []bool) int {
+	penalty := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			penalty += run - 2
+		}
+		run = 1
+	}
+
+	for i := 0; i+len(finderLike[0]) <= len(line); i++ {
+		for _, pattern := range finderLike {
+			match := true
+			for j, dark := range pattern {
+				if line[i+j] != dark {
+					match = false
+					break
+				}
+			}
+			if match {
+				penalty += 40
+			}
+		}
+	}
+	return penalty
+}
+
+// formatBits returns the 15 format bits for level M and a mask
+func formatBits(mask int) int {
+	data := 0<<3 | mask // Level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// versionBits returns the 18 version bits of versions 7 and up
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+// bitBuffer collects bits most significant first
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, count int) {
+	for i := count - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 != 0)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	result := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			result[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return result
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
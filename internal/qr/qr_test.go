@@ -0,0 +1,51 @@
+package qr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" at version 1-M, from the worked example in ISO/IEC 18004
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := reedSolomon(data, 10); !bytes.Equal(got, want) {
+		t.Errorf("reedSolomon = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	if got := formatBits(0); got != 0b101010000010010 {
+		t.Errorf("formatBits(0) = %015b", got)
+	}
+	if got := formatBits(5); got != 0b100000011001110 {
+		t.Errorf("formatBits(5) = %015b", got)
+	}
+	if got := versionBits(7); got != 0b000111110010010100 {
+		t.Errorf("versionBits(7) = %018b", got)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	code, err := Encode("https://archive.example.com/drives/Photos%202019")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.Version != 4 || code.Size != 33 {
+		t.Errorf("expected version 4 (33 modules), got %d (%d)", code.Version, code.Size)
+	}
+	// Finder pattern corners and the dark module
+	for _, xy := range [][2]int{{0, 0}, {code.Size - 1, 0}, {0, code.Size - 1}, {8, code.Size - 8}} {
+		if !code.Dark(xy[0], xy[1]) {
+			t.Errorf("module %v should be dark", xy)
+		}
+	}
+
+	if _, err := Encode(strings.Repeat("x", 214)); err == nil {
+		t.Error("expected an error for data over capacity")
+	}
+	if code, err := Encode(strings.Repeat("x", 213)); err != nil || code.Version != 10 {
+		t.Errorf("expected 213 bytes to fit version 10, got %v", err)
+	}
+}
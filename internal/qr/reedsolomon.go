@@ -0,0 +1,58 @@
+package qr
+
+// gfExp and gfLog are the exponent and logarithm tables of GF(256) with the
+// QR code polynomial x^8 + x^4 + x^3 + x^2 + 1
+var gfExp, gfLog = func() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+// gfMul multiplies two elements of GF(256)
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// reedSolomon returns the error correction codewords of a block
+func reedSolomon(data []byte, count int) []byte {
+	// Generator polynomial (x - a^0)(x - a^1)...(x - a^(count-1)), with
+	// the leading coefficient left out
+	generator := make([]byte, count)
+	generator[count-1] = 1
+	root := byte(1)
+	for i := 0; i < count; i++ {
+		for j := 0; j < count; j++ {
+			generator[j] = gfMul(generator[j], root)
+			if j+1 < count {
+				generator[j] ^= generator[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+
+	remainder := make([]byte, count)
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[count-1] = 0
+		for i := range remainder {
+			remainder[i] ^= gfMul(generator[i], factor)
+		}
+	}
+	return remainder
+}
@@ -0,0 +1,232 @@
+package reconcile
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/upload"
+)
+
+// Options controls how remote objects are matched to catalog records
+type Options struct {
+	// Prefix restricts the listing and is stripped from object names before matching
+	Prefix string
+	// VerifyHash compares the local SHA-1 with the object's SHA-1 before
+	// accepting a match, even when only one candidate exists
+	VerifyHash bool
+	// DryRun reports matches without writing them to the database
+	DryRun bool
+	// Adopt adds catalog entries for objects with no local match, so
+	// uploads made outside the archiver can be searched
+	Adopt bool
+}
+
+// Match pairs a remote object with the catalog record it was matched to
+type Match struct {
+	Remote upload.RemoteFile
+	File   *db.FileStatus
+}
+
+// Report summarises an import run
+type Report struct {
+	RemoteFiles     int
+	Matched         []Match
+	AlreadyArchived int
+	Unmatched       []upload.RemoteFile
+	Adopted         []*db.FileStatus
+	Ambiguous       []upload.RemoteFile
+	Errors          []error
+}
+
+// Importer matches objects already in a bucket to files in the catalog so
+// they are not uploaded again
+type Importer struct {
+	db       *db.DB
+	uploader *upload.B2Uploader
+}
+
+// NewImporter creates a new importer
+func NewImporter(database *db.DB, uploader *upload.B2Uploader) *Importer {
+	return &Importer{
+		db:       database,
+		uploader: uploader,
+	}
+}
+
+// writeBatchSize is how many matches and adopted entries Import writes to
+// the catalog at a time
+const writeBatchSize = 1000
+
+// Import lists the bucket and records every object that matches a local file
+// by name, size and (when needed) SHA-1 as already uploaded
+func (im *Importer) Import(ctx context.Context, options Options) (*Report, error) {
+	report := &Report{}
+	pending := &pendingWrites{matched: make(map[int64]bool)}
+
+	err := im.uploader.ListFiles(ctx, options.Prefix, func(remote upload.RemoteFile) error {
+		report.RemoteFiles++
+
+		relPath := strings.TrimPrefix(strings.TrimPrefix(remote.Name, options.Prefix), "/")
+		candidates, err := im.db.FindUploadCandidates(relPath, remote.Size)
+		if err != nil {
+			return err
+		}
+
+		candidates = withoutOtherRemotes(candidates, remote)
+
+		file, ambiguous := pickCandidate(candidates, remote, options.VerifyHash)
+		switch {
+		case file == nil && ambiguous:
+			report.Ambiguous = append(report.Ambiguous, remote)
+			return nil
+		case file == nil && options.Adopt:
+			if adopted := im.adopt(remote, relPath, report); adopted != nil && !options.DryRun {
+				pending.adopted = append(pending.adopted, adopted)
+			}
+		case file == nil:
+			report.Unmatched = append(report.Unmatched, remote)
+			return nil
+		case file.UploadedURL != "" || pending.matched[file.ID]:
+			report.AlreadyArchived++
+			return nil
+		default:
+			if !options.DryRun {
+				pending.matched[file.ID] = true
+				pending.updates = append(pending.updates, db.StatusUpdate{
+					ID:          file.ID,
+					UploadedURL: remote.URL,
+					UploadTime:  remote.UploadedAt,
+				})
+			}
+			report.Matched = append(report.Matched, Match{Remote: remote, File: file})
+		}
+
+		if len(pending.updates)+len(pending.adopted) >= writeBatchSize {
+			im.write(pending, report)
+		}
+		return nil
+	})
+	im.write(pending, report)
+
+	return report, err
+}
+
+// pendingWrites are the matches and adopted entries Import has yet to write
+type pendingWrites struct {
+	updates []db.StatusUpdate
+	adopted []*db.FileStatus
+	matched map[int64]bool // Files matched during this import
+}
+
+// write records the pending matches and adopted entries in the catalog
+func (im *Importer) write(pending *pendingWrites, report *Report) {
+	if err := im.db.UpdateFileStatusBatch(pending.updates); err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("recording %d matches: %w", len(pending.updates), err))
+	}
+	if _, err := im.db.InsertFilesBatch(pending.adopted); err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("adopting %d objects: %w", len(pending.adopted), err))
+	}
+	pending.updates = pending.updates[:0]
+	pending.adopted = pending.adopted[:0]
+}
+
+// adopt returns a catalog entry for a remote object with no local copy,
+// adding it to the report. The entry's path names the object in its bucket;
+// its hash is the SHA-1 the server reports, as there is no content to
+// compute a SHA-256 from.
+func (im *Importer) adopt(remote upload.RemoteFile, relPath string, report *Report) *db.FileStatus {
+	bucket, name, err := upload.SplitFileURL(remote.URL)
+	if err != nil {
+		report.Errors = append(report.Errors, err)
+		return nil
+	}
+
+	modTime := remote.ModTime
+	if modTime.IsZero() {
+		modTime = remote.UploadedAt
+	}
+	file := &db.FileStatus{
+		Path:         RemotePath(bucket, name),
+		RelativePath: relPath,
+		Size:         remote.Size,
+		ModTime:      modTime,
+		ContentType:  remote.ContentType,
+		SHA1:         strings.ToLower(remote.SHA1),
+		Processed:    true,
+		UploadedURL:  remote.URL,
+		UploadTime:   sql.NullTime{Time: remote.UploadedAt, Valid: true},
+	}
+	report.Adopted = append(report.Adopted, file)
+	return file
+}
+
+// RemotePath returns the catalog path of an object adopted from a bucket
+func RemotePath(bucket, name string) string {
+	return "b2://" + bucket + "/" + name
+}
+
+// withoutOtherRemotes drops adopted entries standing for other objects, which
+// share the object's name and size but have no local content to compare
+func withoutOtherRemotes(candidates []*db.FileStatus, remote upload.RemoteFile) []*db.FileStatus {
+	kept := candidates[:0]
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate.Path, "b2://") && candidate.UploadedURL != remote.URL {
+			continue
+		}
+		kept = append(kept, candidate)
+	}
+	return kept
+}
+
+// pickCandidate chooses the catalog record matching a remote object. A single
+// candidate is accepted as-is unless verification is requested; otherwise the
+// candidate whose content hashes to the object's SHA-1 wins. ambiguous is set
+// when several candidates remain and none could be confirmed by hash.
+func pickCandidate(candidates []*db.FileStatus, remote upload.RemoteFile, verify bool) (file *db.FileStatus, ambiguous bool) {
+	if len(candidates) == 0 {
+		return nil, false
+	}
+	if len(candidates) == 1 && !verify {
+		return candidates[0], false
+	}
+
+	if remote.SHA1 != "" {
+		for _, candidate := range candidates {
+			sum := candidate.SHA1
+			if sum == "" {
+				var err error
+				if sum, err = fileSHA1(candidate.Path); err != nil {
+					continue
+				}
+			}
+			if strings.EqualFold(sum, remote.SHA1) {
+				return candidate, false
+			}
+		}
+	}
+
+	return nil, len(candidates) > 1
+}
+
+// fileSHA1 calculates the SHA-1 hash of a local file, as used by B2
+func fileSHA1(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,145 @@
+// Package recovery repairs what a run leaves behind when the machine crashes
+// or loses power in the middle of it
+package recovery
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+// Fix is one repair made in a source
+type Fix struct {
+	Path   string
+	Action string // "removed", "rewrote" or "kept"
+	Detail string
+}
+
+// tempFile matches the temporary files of restores and stubs being written
+var tempFile = regexp.MustCompile(`^\..+\.\d+\.part$|\.(webloc|url)\.tmp$`)
+
+// Sweep walks root for leftovers of a crashed run and repairs them.
+// Temporary files of restores and stubs being written are removed. An
+// incomplete stub is removed if its original file is still there, since the
+// original was only to be removed once the stub was written; otherwise it
+// is rewritten to point to the upload uploadURL returns for the original.
+// Incomplete stubs that can't be rewritten are kept and reported.
+func Sweep(root string, uploadURL func(original string) string) ([]Fix, error) {
+	var fixes []Fix
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// Unreadable directories can't hold anything we wrote
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		name := d.Name()
+		if tempFile.MatchString(name) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			fixes = append(fixes, Fix{Path: path, Action: "removed", Detail: "temporary file of an unfinished write"})
+			return nil
+		}
+
+		mode := stubMode(name)
+		if mode == "" {
+			return nil
+		}
+		if _, err := db.ReadStub(path); err == nil {
+			return nil
+		}
+
+		original := strings.TrimSuffix(path, filepath.Ext(path))
+		if _, err := os.Lstat(original); err == nil {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			fixes = append(fixes, Fix{Path: path, Action: "removed", Detail: "incomplete stub; the original is still there"})
+			return nil
+		}
+		if url := uploadURL(original); url != "" {
+			if _, err := db.CreateStub(original, url, mode); err != nil {
+				return err
+			}
+			fixes = append(fixes, Fix{Path: path, Action: "rewrote", Detail: "incomplete stub, pointing to " + url})
+			return nil
+		}
+		fixes = append(fixes, Fix{Path: path, Action: "kept", Detail: "incomplete stub; the original is gone and no upload is recorded"})
+		return nil
+	})
+	return fixes, err
+}
+
+// stubMode returns the stub mode of a file name, or "" if it isn't a stub
+func stubMode(name string) db.StubMode {
+	switch filepath.Ext(name) {
+	case ".webloc":
+		return db.StubModeWebloc
+	case ".url":
+		return db.StubModeShortcut
+	}
+	return ""
+}
+
+// BootTime returns when the machine last booted. Runs still recorded as
+// running that started before it can't still be running.
+func BootTime() (time.Time, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		out, err := exec.Command("sysctl", "-n", "kern.boottime").Output()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to read the boot time: %w", err)
+		}
+		return parseSysctlBoottime(string(out))
+	case "linux":
+		data, err := os.ReadFile("/proc/stat")
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to read the boot time: %w", err)
+		}
+		return parseProcStat(string(data))
+	}
+	return time.Time{}, fmt.Errorf("the boot time can't be read on %s", runtime.GOOS)
+}
+
+// parseSysctlBoottime parses `sysctl -n kern.boottime` output, like
+// "{ sec = 1700000000, usec = 123456 } Tue Nov 14 22:13:20 2023"
+func parseSysctlBoottime(output string) (time.Time, error) {
+	m := regexp.MustCompile(`sec = (\d+)`).FindStringSubmatch(output)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("unexpected kern.boottime %q", strings.TrimSpace(output))
+	}
+	sec, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// parseProcStat parses the btime line of /proc/stat
+func parseProcStat(data string) (time.Time, error) {
+	for _, line := range strings.Split(data, "\n") {
+		if value, ok := strings.CutPrefix(line, "btime "); ok {
+			sec, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("no btime in /proc/stat")
+}
@@ -0,0 +1,80 @@
+package recovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+func TestSweep(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	write("kept.pdf", "original")
+	halfStub := write("kept.pdf.webloc", `<?xml version="1.0" encoding="UTF-8"?><plist`)
+	lostStub := write("uploaded.mov.url", "[InternetShortcut]\n")
+	orphanStub := write("gone.doc.url", "")
+	goodStub := filepath.Join(dir, "fine.jpg.webloc")
+	if _, err := db.CreateStub(filepath.Join(dir, "fine.jpg"), "https://f000.example/file/b/fine.jpg", db.StubModeWebloc); err != nil {
+		t.Fatal(err)
+	}
+	restoreTemp := write(".photo.jpg.123456.part", "partial")
+	stubTemp := write("other.pdf.webloc.tmp", "")
+	write("notes.part", "a user's file")
+
+	fixes, err := Sweep(dir, func(original string) string {
+		if filepath.Base(original) == "uploaded.mov" {
+			return "https://f000.example/file/b/uploaded.mov"
+		}
+		return ""
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions := map[string]string{}
+	for _, fix := range fixes {
+		actions[fix.Path] = fix.Action
+	}
+	for path, want := range map[string]string{
+		halfStub:    "removed",
+		lostStub:    "rewrote",
+		orphanStub:  "kept",
+		restoreTemp: "removed",
+		stubTemp:    "removed",
+	} {
+		if actions[path] != want {
+			t.Errorf("%s: got %q, want %q", filepath.Base(path), actions[path], want)
+		}
+	}
+	if len(fixes) != 5 {
+		t.Errorf("got %d fixes, want 5: %+v", len(fixes), fixes)
+	}
+	if _, err := os.Stat(goodStub); err != nil {
+		t.Error("a complete stub must be left alone")
+	}
+	if url, err := db.ReadStub(lostStub); err != nil || url != "https://f000.example/file/b/uploaded.mov" {
+		t.Errorf("rewritten stub points to %q (%v)", url, err)
+	}
+}
+
+func TestParseBootTime(t *testing.T) {
+	want := time.Unix(1700000000, 0)
+	got, err := parseSysctlBoottime("{ sec = 1700000000, usec = 123456 } Tue Nov 14 22:13:20 2023\n")
+	if err != nil || !got.Equal(want) {
+		t.Errorf("sysctl: got %v (%v), want %v", got, err, want)
+	}
+	got, err = parseProcStat("cpu  1 2 3\nintr 4\nbtime 1700000000\nprocesses 5\n")
+	if err != nil || !got.Equal(want) {
+		t.Errorf("/proc/stat: got %v (%v), want %v", got, err, want)
+	}
+}
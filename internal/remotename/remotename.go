@@ -0,0 +1,214 @@
+// Package remotename evaluates the templates that name uploaded files in the
+// bucket, like "{drive}/{relpath}" or "{year}/{month}/{hash[:2]}/{name}"
+package remotename
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/pathnorm"
+)
+
+// Placeholders lists the names a template can use, with what they expand to
+var Placeholders = map[string]string{
+	"prefix":  "the upload prefix",
+	"drive":   "the drive the file is on, or \"unknown\"",
+	"path":    "the full local path, without the leading slash",
+	"relpath": "the path relative to the source folder",
+	"dir":     "the directory of relpath",
+	"name":    "the file name",
+	"stem":    "the file name without its extension",
+	"ext":     "the extension, without the dot",
+	"year":    "the year the photo was taken, or else modified",
+	"month":   "the month, 01 to 12",
+	"day":     "the day of the month, 01 to 31",
+	"hash":    "the SHA-256 of the content",
+}
+
+// Vars are the values of a file's placeholders
+type Vars struct {
+	Prefix  string
+	Path    string // Local path
+	RelPath string // Path relative to the source folder
+	Drive   string
+	Date    time.Time // When a photo was taken, or the file was modified
+	SHA256  string
+}
+
+// Template is a parsed remote name template
+type Template struct {
+	text  string
+	parts []part
+}
+
+// part is literal text or a placeholder, optionally cut to its first n
+// characters as in {hash[:2]}
+type part struct {
+	literal string
+	name    string
+	n       int
+}
+
+// Parse parses a template
+func Parse(text string) (*Template, error) {
+	t := &Template{text: text}
+	rest := text
+	for rest != "" {
+		start := strings.IndexAny(rest, "{}")
+		if start < 0 {
+			t.parts = append(t.parts, part{literal: rest})
+			break
+		}
+		if rest[start] == '}' {
+			return nil, fmt.Errorf("template %q: unmatched }", text)
+		}
+		if start > 0 {
+			t.parts = append(t.parts, part{literal: rest[:start]})
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("template %q: unclosed {", text)
+		}
+
+		p, err := parsePlaceholder(rest[start+1 : start+end])
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %w", text, err)
+		}
+		t.parts = append(t.parts, p)
+		rest = rest[start+end+1:]
+	}
+	return t, nil
+}
+
+// parsePlaceholder parses the inside of {...}
+func parsePlaceholder(s string) (part, error) {
+	name, slice, cut := strings.Cut(s, "[")
+	if _, ok := Placeholders[name]; !ok {
+		return part{}, fmt.Errorf("unknown placeholder {%s}", name)
+	}
+	p := part{name: name}
+	if !cut {
+		return p, nil
+	}
+
+	digits, ok := strings.CutPrefix(strings.TrimSuffix(slice, "]"), ":")
+	n, err := strconv.Atoi(digits)
+	if !ok || !strings.HasSuffix(slice, "]") || err != nil || n < 1 {
+		return part{}, fmt.Errorf("invalid slice in {%s}: expected e.g. {%s[:2]}", s, name)
+	}
+	p.n = n
+	return p, nil
+}
+
+// String returns the template text
+func (t *Template) String() string {
+	return t.text
+}
+
+// Uses reports whether the template uses a placeholder
+func (t *Template) Uses(name string) bool {
+	for _, p := range t.parts {
+		if p.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute returns the remote name of a file. Empty and "." segments are
+// dropped; a name with ".." segments or no segments at all is an error. The
+// name is normalized to NFC and over-long segments are shortened.
+func (t *Template) Execute(v Vars) (string, error) {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.name == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+		value, err := v.value(p.name)
+		if err != nil {
+			return "", err
+		}
+		if p.n > 0 {
+			// Composed first, so that an accent stays with its letter
+			value = firstRunes(pathnorm.NFC(value), p.n)
+		}
+		b.WriteString(value)
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(b.String(), "/") {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("remote name %q for %s climbs out of the bucket", b.String(), v.Path)
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		return "", fmt.Errorf("template %q gives %s an empty name", t.text, v.Path)
+	}
+	return pathnorm.FitPath(pathnorm.NFC(strings.Join(segments, "/"))), nil
+}
+
+// firstRunes returns the first n characters of s
+func firstRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// errNoHash is returned for {hash} of a file that wasn't hashed
+var errNoHash = errors.New("no SHA-256 recorded")
+
+// value returns the value of one placeholder
+func (v Vars) value(name string) (string, error) {
+	relPath := filepath.ToSlash(v.RelPath)
+	if relPath == "" {
+		relPath = filepath.Base(v.Path)
+	}
+	base := path.Base(relPath)
+
+	switch name {
+	case "prefix":
+		return v.Prefix, nil
+	case "drive":
+		if v.Drive == "" {
+			return "unknown", nil
+		}
+		return v.Drive, nil
+	case "path":
+		return strings.TrimPrefix(filepath.ToSlash(v.Path), "/"), nil
+	case "relpath":
+		return relPath, nil
+	case "dir":
+		return path.Dir(relPath), nil
+	case "name":
+		return base, nil
+	case "stem":
+		return strings.TrimSuffix(base, path.Ext(base)), nil
+	case "ext":
+		return strings.TrimPrefix(path.Ext(base), "."), nil
+	case "year", "month", "day":
+		if v.Date.IsZero() {
+			return "unknown", nil
+		}
+		return v.Date.Format(map[string]string{"year": "2006", "month": "01", "day": "02"}[name]), nil
+	case "hash":
+		if v.SHA256 == "" {
+			return "", fmt.Errorf("{hash} for %s: %w", v.Path, errNoHash)
+		}
+		return v.SHA256, nil
+	}
+	return "", fmt.Errorf("unknown placeholder {%s}", name)
+}
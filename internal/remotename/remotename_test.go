@@ -0,0 +1,63 @@
+package remotename
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestTemplate(t *testing.T) {
+	vars := Vars{
+		Prefix:  "laptop",
+		Path:    "/Volumes/Photos/2016/Trip/IMG_1234.JPG",
+		RelPath: "2016/Trip/IMG_1234.JPG",
+		Drive:   "Photos",
+		Date:    time.Date(2016, 7, 4, 12, 0, 0, 0, time.UTC),
+		SHA256:  "1a2b3c",
+	}
+	for template, want := range map[string]string{
+		"{drive}/{relpath}":                 "Photos/2016/Trip/IMG_1234.JPG",
+		"{year}/{month}/{hash[:2]}/{name}":  "2016/07/1a/IMG_1234.JPG",
+		"{prefix}/{dir}/{stem}-{day}.{ext}": "laptop/2016/Trip/IMG_1234-04.JPG",
+		"/{prefix}//{path}":                 "laptop/Volumes/Photos/2016/Trip/IMG_1234.JPG",
+		"archive/{hash[:100]}":              "archive/1a2b3c",
+	} {
+		tmpl, err := Parse(template)
+		if err != nil {
+			t.Errorf("%s: %v", template, err)
+			continue
+		}
+		if got, err := tmpl.Execute(vars); err != nil || got != want {
+			t.Errorf("%s: got %q (%v), want %q", template, got, err, want)
+		}
+	}
+
+	// Names are cut to characters, not bytes, composed or not
+	for _, name := range []string{"/Photos/Édouard.jpg", "/Photos/E\u0301douard.jpg", "/Photos/日本の旅.jpg"} {
+		tmpl, _ := Parse("{name[:2]}/{name}")
+		got, err := tmpl.Execute(Vars{Path: name})
+		if err != nil || !utf8.ValidString(got) {
+			t.Errorf("%s: got %q (%v), want valid UTF-8", name, got, err)
+			continue
+		}
+		if first, _, _ := strings.Cut(got, "/"); utf8.RuneCountInString(first) != 2 {
+			t.Errorf("%s: got %q, want the first 2 characters of the name", name, got)
+		}
+	}
+
+	for _, bad := range []string{"{nope}", "{name", "name}", "{hash[2]}", "{hash[:0]}"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("%s should not parse", bad)
+		}
+	}
+
+	tmpl, _ := Parse("{prefix}/{hash}")
+	if _, err := tmpl.Execute(Vars{Path: "/big.mov"}); err == nil {
+		t.Error("{hash} of a file without a hash should fail")
+	}
+	tmpl, _ = Parse("{dir}/../{name}")
+	if _, err := tmpl.Execute(vars); err == nil {
+		t.Error("names climbing out of the bucket should fail")
+	}
+}
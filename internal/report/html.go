@@ -0,0 +1,148 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/jth/archiver/internal/stats"
+)
+
+// Write renders the report as a single HTML page with no scripts or
+// external files, so it can be attached to an email or opened from disk
+func Write(w io.Writer, report *Report) error {
+	return reportTemplate.Execute(w, report)
+}
+
+var funcs = template.FuncMap{
+	"size":  formatSize,
+	"money": func(amount float64) string { return fmt.Sprintf("$%.2f", amount) },
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02 15:04")
+	},
+	// percent is part's share of whole, for the bars of the charts
+	"percent": func(part, whole int64) string {
+		if whole <= 0 {
+			return "0"
+		}
+		return fmt.Sprintf("%.1f", float64(part)*100/float64(whole))
+	},
+	"largest": func(groups []stats.Group) int64 {
+		var largest int64
+		for _, group := range groups {
+			largest = max(largest, group.Bytes)
+		}
+		return largest
+	},
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, system-ui, sans-serif; margin: 2em auto; max-width: 60em; padding: 0 1em; color: #222; }
+h2 { margin-top: 2em; border-bottom: 1px solid #ddd; padding-bottom: .2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; vertical-align: top; padding: .3em .6em; border-bottom: 1px solid #eee; }
+td.num { white-space: nowrap; text-align: right; }
+.totals { display: flex; flex-wrap: wrap; gap: 2em; }
+.totals b { display: block; font-size: 1.5em; }
+.bar { background: #3a7bd5; height: 1em; min-width: 1px; }
+.years { display: flex; align-items: flex-end; gap: 2px; height: 12em; border-bottom: 1px solid #999; }
+.years div { flex: 1; background: #3a7bd5; min-height: 1px; }
+.labels { display: flex; gap: 2px; font-size: .75em; color: #555; }
+.labels span { flex: 1; text-align: center; overflow: hidden; }
+.summary { color: #444; }
+.muted { color: #777; font-size: .9em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="muted">{{with .Run}}Run {{.ID}} ({{.Command}}{{if .Source}} of {{.Source}}{{end}}), started {{date .StartedAt}}, {{.Status}}.{{else}}The whole archive.{{end}}
+Generated {{date .GeneratedAt}}.</p>
+
+<div class="totals">
+  <div>Files<b>{{.Files}}</b></div>
+  <div>Size<b>{{size .Bytes}}</b></div>
+  <div>Saved by deduplication<b>{{size .DuplicateBytes}}</b></div>
+  {{if .StoredBytes}}<div>Stored in the cloud<b>{{size .StoredBytes}}</b></div>{{end}}
+  <div>AI spend<b>{{money .Cost}}</b></div>
+  <div>Failed files<b>{{.FailedFiles}}</b></div>
+</div>
+
+<h2>What is in it</h2>
+<table>
+<tr><th>Kind</th><th>Files</th><th>Size</th><th style="width:40%"></th></tr>
+{{range .ByType}}<tr><td>{{.Key}}</td><td class="num">{{.Files}}</td><td class="num">{{size .Bytes}}</td>
+<td><div class="bar" style="width:{{percent .Bytes $.Bytes}}%"></div></td></tr>
+{{else}}<tr><td colspan="4">No files.</td></tr>{{end}}
+</table>
+
+{{if .ByYear}}<h2>By year</h2>
+<p class="muted">Size of the files by the year photos were taken or files last changed.</p>
+{{$largest := largest .ByYear}}
+<div class="years">{{range .ByYear}}<div style="height:{{percent .Bytes $largest}}%" title="{{.Key}}: {{.Files}} files, {{size .Bytes}}"></div>{{end}}</div>
+<div class="labels">{{range .ByYear}}<span>{{.Key}}</span>{{end}}</div>
+<table>
+<tr><th>Year</th><th>Files</th><th>Size</th></tr>
+{{range .ByYear}}<tr><td>{{.Key}}</td><td class="num">{{.Files}}</td><td class="num">{{size .Bytes}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>Deduplication</h2>
+{{if .Duplicates}}<p>{{.Duplicates}} files are copies of others, {{size .DuplicateBytes}} that is only stored once
+({{percent .DuplicateBytes .Bytes}}% of the total).</p>{{else}}<p>No file is a copy of another.</p>{{end}}
+
+<h2>Costs</h2>
+{{if .CostsByKind}}<table>
+<tr><th>Spent on</th><th>Requests</th><th>Amount</th></tr>
+{{range .CostsByKind}}<tr><td>{{.Key}}</td><td class="num">{{.Requests}}</td><td class="num">{{money .Amount}}</td></tr>
+{{end}}<tr><th>Total</th><th></th><th class="num">{{money .Cost}}</th></tr>
+</table>
+{{if .CostsByModel}}<table>
+<tr><th>Model</th><th>Requests</th><th>Amount</th></tr>
+{{range .CostsByModel}}<tr><td>{{.Key}}</td><td class="num">{{.Requests}}</td><td class="num">{{money .Amount}}</td></tr>
+{{end}}</table>{{end}}{{else}}<p>Nothing was spent.</p>{{end}}
+
+{{if .Runs}}<h2>Recent runs</h2>
+<table>
+<tr><th>Run</th><th>Started</th><th>Status</th><th>Files</th><th>Failed</th><th>Uploaded</th><th>Spend</th></tr>
+{{range .Runs}}<tr><td>{{.ID}} {{.Command}}</td><td>{{date .StartedAt}}</td><td>{{.Status}}</td>
+<td class="num">{{.FilesProcessed}}</td><td class="num">{{.FilesFailed}}</td><td class="num">{{size .BytesUploaded}}</td><td class="num">{{money .Cost}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>Errors</h2>
+{{if .Errors}}<table>
+<tr><th>Error</th><th>Files</th><th>For example</th></tr>
+{{range .Errors}}<tr><td>{{.Message}}</td><td class="num">{{.Count}}</td><td>{{.Example}}</td></tr>
+{{end}}</table>{{else}}<p>No file failed.</p>{{end}}
+
+{{if .Notable}}<h2>Notable files</h2>
+<p class="muted">A sample of the summaries, the most detailed in each folder.</p>
+{{range .Notable}}<h3>{{.Path}}</h3>
+<p class="muted">{{.Year}}, {{size .Size}}</p>
+<p class="summary">{{.Summary}}</p>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+// formatSize formats a byte count in binary units
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,248 @@
+// Package report builds a standalone HTML report of a run or of the whole
+// catalog, to share with people who don't run the archiver: what is in the
+// archive by type and year, what deduplication saved, what it cost, what
+// failed, and a sample of the summaries
+package report
+
+import (
+	"mime"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/stats"
+)
+
+// DefaultNotable is the number of summaries sampled
+const DefaultNotable = 12
+
+// maxErrorGroups is the number of kinds of errors listed
+const maxErrorGroups = 20
+
+// Options configures a Collector
+type Options struct {
+	Title   string
+	Run     *db.Run // Run reported on, or nil for the whole catalog
+	Notable int     // Summaries to sample
+}
+
+// Report is what the HTML report shows. The collector fills in the files
+// and errors; costs and runs come from the catalog.
+type Report struct {
+	Title       string
+	GeneratedAt time.Time
+	Run         *db.Run   // nil for the whole catalog
+	Runs        []*db.Run // Recent runs, for the whole catalog
+
+	Files  int64
+	Bytes  int64
+	ByType []stats.Group // Broad kinds of files, largest first
+	ByYear []stats.Group // Year taken or modified, oldest first
+
+	// Copies of files found elsewhere in the report, which are stored once
+	Duplicates     int64
+	DuplicateBytes int64
+
+	StoredBytes int64 // Bytes stored in the bucket, for the whole catalog
+
+	Cost         float64
+	CostsByKind  []db.CostGroup
+	CostsByModel []db.CostGroup
+
+	FailedFiles int
+	Errors      []ErrorGroup // Most frequent first
+	Notable     []Notable
+}
+
+// ErrorGroup is the failures with the same error once the path of the file
+// is taken out of it
+type ErrorGroup struct {
+	Message string
+	Count   int
+	Example string // Path of one of the files
+}
+
+// Notable is a file with its summary
+type Notable struct {
+	Path    string
+	Size    int64
+	Year    string
+	Summary string
+}
+
+// Collector totals files and errors as they are added
+type Collector struct {
+	opts    Options
+	report  Report
+	types   map[string]*stats.Group
+	years   map[string]*stats.Group
+	hashes  map[string]bool
+	notable map[string]Notable // Longest summary in each directory
+	errors  map[string]*ErrorGroup
+}
+
+// NewCollector creates a collector
+func NewCollector(opts Options) *Collector {
+	if opts.Notable <= 0 {
+		opts.Notable = DefaultNotable
+	}
+	if opts.Title == "" {
+		opts.Title = "Archive report"
+	}
+	return &Collector{
+		opts:    opts,
+		report:  Report{Title: opts.Title, Run: opts.Run},
+		types:   make(map[string]*stats.Group),
+		years:   make(map[string]*stats.Group),
+		hashes:  make(map[string]bool),
+		notable: make(map[string]Notable),
+		errors:  make(map[string]*ErrorGroup),
+	}
+}
+
+// Add counts a file
+func (c *Collector) Add(file *db.FileStatus) {
+	c.report.Files++
+	c.report.Bytes += file.Size
+	year := fileYear(file)
+	add(c.types, Kind(file.ContentType), file.Size)
+	add(c.years, year, file.Size)
+
+	if file.SHA256 != "" {
+		if c.hashes[file.SHA256] {
+			c.report.Duplicates++
+			c.report.DuplicateBytes += file.Size
+		} else {
+			c.hashes[file.SHA256] = true
+		}
+	}
+
+	if summary := strings.TrimSpace(file.Summary); summary != "" {
+		dir := path.Dir(file.Path)
+		if best, ok := c.notable[dir]; !ok || len(summary) > len(best.Summary) {
+			c.notable[dir] = Notable{Path: file.Path, Size: file.Size, Year: year, Summary: summary}
+		}
+	}
+}
+
+// AddError counts a file that failed
+func (c *Collector) AddError(runError db.RunError) {
+	c.report.FailedFiles++
+	message := runError.Error
+	if runError.Path != "" {
+		message = strings.ReplaceAll(message, runError.Path, "…")
+	}
+	group := c.errors[message]
+	if group == nil {
+		group = &ErrorGroup{Message: message, Example: runError.Path}
+		c.errors[message] = group
+	}
+	group.Count++
+}
+
+func add(groups map[string]*stats.Group, key string, size int64) {
+	group := groups[key]
+	if group == nil {
+		group = &stats.Group{Key: key}
+		groups[key] = group
+	}
+	group.Files++
+	group.Bytes += size
+}
+
+// Report returns what was collected so far. The summaries sampled are the
+// longest of each directory, longest first, so the sample spreads across
+// the archive and favours the documents with the most to say.
+func (c *Collector) Report() *Report {
+	report := c.report
+	report.GeneratedAt = time.Now()
+
+	report.ByType = sortedGroups(c.types)
+	sort.Slice(report.ByType, func(i, j int) bool {
+		if report.ByType[i].Bytes != report.ByType[j].Bytes {
+			return report.ByType[i].Bytes > report.ByType[j].Bytes
+		}
+		return report.ByType[i].Key < report.ByType[j].Key
+	})
+	report.ByYear = sortedGroups(c.years)
+
+	report.Errors = make([]ErrorGroup, 0, len(c.errors))
+	for _, group := range c.errors {
+		report.Errors = append(report.Errors, *group)
+	}
+	sort.Slice(report.Errors, func(i, j int) bool {
+		if report.Errors[i].Count != report.Errors[j].Count {
+			return report.Errors[i].Count > report.Errors[j].Count
+		}
+		return report.Errors[i].Message < report.Errors[j].Message
+	})
+	if len(report.Errors) > maxErrorGroups {
+		report.Errors = report.Errors[:maxErrorGroups]
+	}
+
+	report.Notable = make([]Notable, 0, len(c.notable))
+	for _, notable := range c.notable {
+		report.Notable = append(report.Notable, notable)
+	}
+	sort.Slice(report.Notable, func(i, j int) bool {
+		if len(report.Notable[i].Summary) != len(report.Notable[j].Summary) {
+			return len(report.Notable[i].Summary) > len(report.Notable[j].Summary)
+		}
+		return report.Notable[i].Path < report.Notable[j].Path
+	})
+	if len(report.Notable) > c.opts.Notable {
+		report.Notable = report.Notable[:c.opts.Notable]
+	}
+	return &report
+}
+
+// sortedGroups returns the groups ordered by key
+func sortedGroups(groups map[string]*stats.Group) []stats.Group {
+	list := make([]stats.Group, 0, len(groups))
+	for _, group := range groups {
+		list = append(list, *group)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// Kind returns the broad kind of a content type, as shown in the report
+func Kind(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	major, minor, _ := strings.Cut(mediaType, "/")
+	switch {
+	case major == "image":
+		return "Photos and images"
+	case major == "video":
+		return "Videos"
+	case major == "audio":
+		return "Audio"
+	case major == "text", minor == "pdf", minor == "rtf", minor == "msword",
+		strings.Contains(minor, "officedocument"), strings.Contains(minor, "opendocument"),
+		strings.Contains(minor, "ms-excel"), strings.Contains(minor, "ms-powerpoint"):
+		return "Documents"
+	case strings.Contains(minor, "zip"), strings.Contains(minor, "tar"),
+		strings.Contains(minor, "compressed"), strings.Contains(minor, "x-7z"):
+		return "Archives"
+	default:
+		return "Other"
+	}
+}
+
+// fileYear returns the year a photo was taken or a file last modified
+func fileYear(file *db.FileStatus) string {
+	switch {
+	case file.TakenAt.Valid:
+		return strconv.Itoa(file.TakenAt.Time.Year())
+	case !file.ModTime.IsZero():
+		return strconv.Itoa(file.ModTime.Year())
+	default:
+		return "(unknown)"
+	}
+}
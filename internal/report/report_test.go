@@ -0,0 +1,74 @@
+package report
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+func TestCollector(t *testing.T) {
+	files := []*db.FileStatus{
+		{Path: "/A/Photos/beach.jpg", Size: 300, ContentType: "image/jpeg", SHA256: "a",
+			TakenAt: sql.NullTime{Time: time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+			ModTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Path: "/B/Photos/beach copy.jpg", Size: 300, ContentType: "image/jpeg", SHA256: "a",
+			ModTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Path: "/A/Docs/will.pdf", Size: 50, ContentType: "application/pdf", SHA256: "b",
+			ModTime: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), Summary: "Grandma's will, leaving the house to the grandchildren."},
+		{Path: "/A/Docs/note.txt", Size: 10, ContentType: "text/plain; charset=utf-8", SHA256: "c",
+			ModTime: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), Summary: "A short note."},
+		{Path: "/A/Other/tape.mov", Size: 1000, ContentType: "video/quicktime", Summary: "A birthday party."},
+	}
+
+	c := NewCollector(Options{Notable: 5})
+	for _, file := range files {
+		c.Add(file)
+	}
+	c.AddError(db.RunError{Path: "/A/broken.pdf", Error: "failed to extract /A/broken.pdf: encrypted"})
+	c.AddError(db.RunError{Path: "/A/locked.pdf", Error: "failed to extract /A/locked.pdf: encrypted"})
+	c.AddError(db.RunError{Path: "/A/gone.doc", Error: "open /A/gone.doc: no such file or directory"})
+	report := c.Report()
+
+	if report.Files != 5 || report.Bytes != 1660 {
+		t.Errorf("got %d files, %d bytes", report.Files, report.Bytes)
+	}
+	if report.ByType[0].Key != "Videos" || len(report.ByType) != 3 {
+		t.Errorf("unexpected kinds %+v", report.ByType)
+	}
+	// Photos count in the year they were taken
+	if years := report.ByYear; len(years) != 4 || years[0].Key != "(unknown)" || years[1].Key != "2019" {
+		t.Errorf("unexpected years %+v", years)
+	}
+	if report.Duplicates != 1 || report.DuplicateBytes != 300 {
+		t.Errorf("got %d duplicates of %d bytes, want 1 of 300", report.Duplicates, report.DuplicateBytes)
+	}
+
+	if report.FailedFiles != 3 || len(report.Errors) != 2 {
+		t.Fatalf("unexpected errors %+v", report.Errors)
+	}
+	if got := report.Errors[0]; got.Message != "failed to extract …: encrypted" || got.Count != 2 || got.Example != "/A/broken.pdf" {
+		t.Errorf("unexpected error group %+v", got)
+	}
+
+	// One summary per directory, the longest
+	if len(report.Notable) != 2 || report.Notable[0].Path != "/A/Docs/will.pdf" || report.Notable[1].Path != "/A/Other/tape.mov" {
+		t.Errorf("unexpected notable files %+v", report.Notable)
+	}
+
+	var out strings.Builder
+	if err := Write(&out, report); err != nil {
+		t.Fatal(err)
+	}
+	html := out.String()
+	for _, want := range []string{"The whole archive.", "Grandma&#39;s will", "width:60.2%", "failed to extract …: encrypted", "300 B"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("report is missing %q", want)
+		}
+	}
+	if strings.Contains(html, "ZgotmplZ") || strings.Contains(html, "<script") {
+		t.Error("report has unsafe values or scripts")
+	}
+}
@@ -0,0 +1,164 @@
+package restore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/pathnorm"
+	"github.com/jth/archiver/internal/scratch"
+)
+
+// Policy decides what happens when a restored file would replace a
+// different local file
+type Policy string
+
+// Conflict policies
+const (
+	PolicyPrompt    Policy = "prompt"
+	PolicySkip      Policy = "skip"
+	PolicyOverwrite Policy = "overwrite"
+	PolicyKeepBoth  Policy = "keep-both"
+)
+
+// ParsePolicy parses a policy name
+func ParsePolicy(name string) (Policy, error) {
+	switch policy := Policy(name); policy {
+	case PolicyPrompt, PolicySkip, PolicyOverwrite, PolicyKeepBoth:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q (expected prompt, skip, overwrite or keep-both)", name)
+}
+
+// Target is where a catalog file is restored to and what is there now
+type Target struct {
+	File       *db.FileStatus
+	Path       string
+	Exists     bool
+	Identical  bool // The local file has the archived content
+	LocalNewer bool // The local file was modified after the archived version
+}
+
+// Conflict reports whether restoring would replace a different local file
+func (t *Target) Conflict() bool {
+	return t.Exists && !t.Identical
+}
+
+// Inspect finds the destination of a file restored into dir, at its
+// relative path as scanned, byte for byte, and compares what is there with the catalog entry. Files
+// are compared by SHA-256 when the catalog has one, otherwise by size and
+// modification time.
+func Inspect(file *db.FileStatus, dir string) (*Target, error) {
+	relPath := filepath.FromSlash(file.RelativePath)
+	if !filepath.IsLocal(relPath) {
+		return nil, fmt.Errorf("%s: relative path %q leaves the restore directory", file.Path, file.RelativePath)
+	}
+	target := &Target{File: file, Path: pathnorm.Long(filepath.Join(dir, relPath))}
+
+	info, err := os.Stat(target.Path)
+	if os.IsNotExist(err) {
+		return target, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", target.Path)
+	}
+
+	target.Exists = true
+	target.LocalNewer = info.ModTime().After(file.ModTime)
+	if info.Size() != file.Size {
+		return target, nil
+	}
+	if file.SHA256 == "" {
+		target.Identical = info.ModTime().Equal(file.ModTime)
+		return target, nil
+	}
+
+	sum, err := fileSHA256(target.Path)
+	if err != nil {
+		return nil, err
+	}
+	target.Identical = sum == file.SHA256
+	return target, nil
+}
+
+// KeepBothPath returns a free path next to path for keeping both versions:
+// "report (restored).pdf", then "report (restored 2).pdf" and so on
+func KeepBothPath(path string) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 1; ; n++ {
+		suffix := " (restored)"
+		if n > 1 {
+			suffix = fmt.Sprintf(" (restored %d)", n)
+		}
+		candidate := base + suffix + ext
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// WriteFile writes a restored file to path with the content fetch writes,
+// going through a temporary file so an interrupted download never leaves a
+// partial file in place. The content is checked against the catalog's
+// SHA-256 when there is one, and the file gets its archived modification
+// time. Files that would leave the disk nearly full aren't written.
+func WriteFile(path string, file *db.FileStatus, fetch func(io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := scratch.Ensure(filepath.Dir(path), file.Size); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	err = fetch(io.MultiWriter(tmp, hash))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); file.SHA256 != "" && sum != file.SHA256 {
+		return fmt.Errorf("%s: downloaded content has SHA-256 %s, expected %s", file.Path, sum, file.SHA256)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), file.ModTime, file.ModTime); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fileSHA256 calculates the SHA-256 hash of a local file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,100 @@
+package restore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+func sha(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	archived := time.Date(2023, 3, 1, 9, 0, 0, 0, time.UTC)
+	file := &db.FileStatus{Path: "/Volumes/Old/docs/a.txt", RelativePath: "docs/a.txt",
+		Size: 5, ModTime: archived, SHA256: sha("hello")}
+
+	target, err := Inspect(file, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Exists || target.Conflict() || target.Path != filepath.Join(dir, "docs", "a.txt") {
+		t.Fatalf("expected a free target in the docs folder, got %+v", target)
+	}
+
+	os.MkdirAll(filepath.Join(dir, "docs"), 0755)
+	os.WriteFile(target.Path, []byte("hello"), 0644)
+	if target, err = Inspect(file, dir); err != nil || !target.Identical || target.Conflict() {
+		t.Fatalf("expected an identical file, got %+v (%v)", target, err)
+	}
+
+	os.WriteFile(target.Path, []byte("HELLO"), 0644)
+	if target, err = Inspect(file, dir); err != nil || !target.Conflict() || !target.LocalNewer {
+		t.Fatalf("expected a conflict with a newer local file, got %+v (%v)", target, err)
+	}
+
+	escaping := &db.FileStatus{Path: "b2://archive/../x", RelativePath: "../x"}
+	if _, err := Inspect(escaping, dir); err == nil {
+		t.Error("expected an error for a path leaving the restore directory")
+	}
+}
+
+func TestKeepBothPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.pdf")
+
+	got, err := KeepBothPath(path)
+	if err != nil || got != filepath.Join(dir, "report (restored).pdf") {
+		t.Fatalf("got %q (%v)", got, err)
+	}
+	os.WriteFile(got, nil, 0644)
+	if got, _ = KeepBothPath(path); got != filepath.Join(dir, "report (restored 2).pdf") {
+		t.Errorf("got %q once the first suffix is taken", got)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "a.txt")
+	archived := time.Date(2023, 3, 1, 9, 0, 0, 0, time.UTC)
+	file := &db.FileStatus{Path: "/a.txt", ModTime: archived, SHA256: sha("hello")}
+
+	err := WriteFile(path, file, func(w io.Writer) error {
+		_, err := io.WriteString(w, "hello")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.ModTime().Equal(archived) {
+		t.Fatalf("expected the archived modification time, got %v (%v)", info, err)
+	}
+
+	// Corrupt and failed downloads leave the existing file alone
+	if err := WriteFile(path, file, func(w io.Writer) error {
+		_, err := io.WriteString(w, "HELLO")
+		return err
+	}); err == nil {
+		t.Error("expected a hash mismatch")
+	}
+	if err := WriteFile(path, file, func(io.Writer) error { return errors.New("network down") }); err == nil {
+		t.Error("expected the fetch error")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "hello" {
+		t.Errorf("existing file changed to %q", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("expected temporary files to be removed, found %d entries", len(entries))
+	}
+}
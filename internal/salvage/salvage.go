@@ -0,0 +1,233 @@
+// Package salvage reads what can still be read of files on failing drives:
+// in small chunks, each retried and given up on after a timeout, narrowing
+// failed chunks down to the sectors that can't be read, which are mapped as
+// bad ranges and replaced with zeros.
+package salvage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Range is a run of bytes of a file
+type Range struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// End returns the offset just past the range
+func (r Range) End() int64 { return r.Offset + r.Length }
+
+// Options tune how hard unreadable chunks are retried. Zero fields take the
+// defaults.
+type Options struct {
+	ChunkSize  int           // Bytes read at once; 64KB by default
+	SectorSize int           // Bytes a failed chunk is retried in; 4KB by default
+	Retries    int           // Attempts per chunk and per sector; 3 by default
+	Timeout    time.Duration // Before a read is given up on; 10s by default
+	Pause      time.Duration // After a failed read, growing with each attempt; 500ms by default
+}
+
+// Defaults for the fields of Options
+const (
+	DefaultChunkSize  = 64 * 1024
+	DefaultSectorSize = 4096
+	DefaultRetries    = 3
+	DefaultTimeout    = 10 * time.Second
+	DefaultPause      = 500 * time.Millisecond
+)
+
+// withDefaults fills in the fields left zero
+func (o Options) withDefaults() Options {
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = DefaultChunkSize
+	}
+	if o.SectorSize <= 0 || o.SectorSize > o.ChunkSize {
+		o.SectorSize = min(DefaultSectorSize, o.ChunkSize)
+	}
+	if o.Retries <= 0 {
+		o.Retries = DefaultRetries
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.Pause <= 0 {
+		o.Pause = DefaultPause
+	}
+	return o
+}
+
+// errTimeout is the error of a read that didn't return in time
+var errTimeout = errors.New("read timed out")
+
+// Read reads the first limit bytes of a file in order, passing them to fn in
+// chunks. A chunk that fails every attempt is read again sector by sector;
+// the sectors that still fail are passed to fn as zeros and returned as bad
+// ranges. Reading stops early at the end of a file shorter than limit.
+func Read(ctx context.Context, path string, limit int64, options Options, fn func([]byte)) ([]Range, error) {
+	options = options.withDefaults()
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// Reads that timed out may still be blocked on the file
+	defer func() { go file.Close() }()
+	return read(ctx, &reader{file: file, options: options}, limit, fn)
+}
+
+// read reads the first limit bytes with r, as Read does
+func read(ctx context.Context, r *reader, limit int64, fn func([]byte)) ([]Range, error) {
+	options := r.options
+	buffer := make([]byte, options.ChunkSize)
+	var bad []Range
+	for offset := int64(0); offset < limit; {
+		if err := ctx.Err(); err != nil {
+			return bad, err
+		}
+		chunk := buffer[:min(int64(len(buffer)), limit-offset)]
+		n, err := r.readAt(ctx, chunk, offset)
+		if err == nil || err == io.EOF {
+			fn(chunk[:n])
+			if err == io.EOF || n == 0 {
+				return bad, nil
+			}
+			offset += int64(n)
+			continue
+		}
+
+		// Narrow the failure down to its sectors
+		for start := 0; start < len(chunk); start += options.SectorSize {
+			sector := chunk[start:min(start+options.SectorSize, len(chunk))]
+			n, err := r.readAt(ctx, sector, offset+int64(start))
+			if err == io.EOF {
+				fn(sector[:n])
+				return bad, nil
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return bad, ctx.Err()
+				}
+				clear(sector)
+				bad = addRange(bad, Range{Offset: offset + int64(start), Length: int64(len(sector))})
+			}
+			fn(sector)
+		}
+		offset += int64(len(chunk))
+	}
+	return bad, nil
+}
+
+// addRange appends r to the ranges, merging it with the last one when they
+// touch
+func addRange(ranges []Range, r Range) []Range {
+	if last := len(ranges) - 1; last >= 0 && ranges[last].End() == r.Offset {
+		ranges[last].Length += r.Length
+		return ranges
+	}
+	return append(ranges, r)
+}
+
+// reader reads a file with retries and timeouts
+type reader struct {
+	file    io.ReaderAt
+	options Options
+}
+
+// readAt reads len(p) bytes at offset, making up to Retries attempts. Like
+// ReadAt it returns io.EOF with the bytes read at the end of the file.
+func (r *reader) readAt(ctx context.Context, p []byte, offset int64) (int, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		var n int
+		n, err = r.readOnce(p, offset)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if attempt == r.options.Retries {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(time.Duration(attempt) * r.options.Pause):
+		}
+	}
+	return 0, fmt.Errorf("unreadable at byte %d after %d attempts: %w", offset, r.options.Retries, err)
+}
+
+// readOnce makes one attempt at reading p, giving up after the timeout. A
+// read that times out is left to finish into a buffer of its own, so it
+// can't write into p later.
+func (r *reader) readOnce(p []byte, offset int64) (int, error) {
+	type result struct {
+		n   int
+		err error
+	}
+	buffer := make([]byte, len(p))
+	done := make(chan result, 1)
+	go func() {
+		n, err := r.file.ReadAt(buffer, offset)
+		done <- result{n, err}
+	}()
+
+	timer := time.NewTimer(r.options.Timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		copy(p, buffer[:res.n])
+		return res.n, res.err
+	case <-timer.C:
+		return 0, errTimeout
+	}
+}
+
+// Result is what a salvage recovered of a file
+type Result struct {
+	Size      int64   // Bytes written, the size of the file unless it shrank
+	Recovered int64   // Bytes read, the others are zeros
+	BadRanges []Range // Ranges that could not be read
+	SHA256    string  // Hash of what was written
+}
+
+// Partial reports whether some of the file could not be read
+func (r *Result) Partial() bool { return len(r.BadRanges) > 0 }
+
+// Copy writes what can be read of the file at path to w, with zeros in
+// place of the bad ranges
+func Copy(ctx context.Context, path string, w io.Writer, options Options) (*Result, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	out := io.MultiWriter(w, hash)
+	result := &Result{}
+	var writeErr error
+	bad, err := Read(ctx, path, info.Size(), options, func(chunk []byte) {
+		if writeErr == nil {
+			_, writeErr = out.Write(chunk)
+			result.Size += int64(len(chunk))
+		}
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.BadRanges = bad
+	result.Recovered = result.Size
+	for _, r := range bad {
+		result.Recovered -= r.Length
+	}
+	result.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return result, nil
+}
@@ -0,0 +1,100 @@
+package salvage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// failingDisk stands in for a file on a failing drive: reads touching a bad
+// range fail, and reads touching a slow range hang
+type failingDisk struct {
+	data []byte
+	bad  []Range
+	slow []Range
+}
+
+func (d *failingDisk) ReadAt(p []byte, offset int64) (int, error) {
+	read := Range{Offset: offset, Length: int64(len(p))}
+	for _, r := range d.slow {
+		if overlaps(read, r) {
+			time.Sleep(time.Second)
+		}
+	}
+	for _, r := range d.bad {
+		if overlaps(read, r) {
+			return 0, errors.New("input/output error")
+		}
+	}
+	return bytes.NewReader(d.data).ReadAt(p, offset)
+}
+
+func overlaps(a, b Range) bool { return a.Offset < b.End() && b.Offset < a.End() }
+
+func TestRead(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1024) // 16KB
+	disk := &failingDisk{
+		data: data,
+		bad:  []Range{{Offset: 4096, Length: 10}, {Offset: 5000, Length: 1}},
+		slow: []Range{{Offset: 12288, Length: 1}},
+	}
+	r := &reader{file: disk, options: Options{ChunkSize: 8192, SectorSize: 512, Retries: 2, Timeout: 50 * time.Millisecond, Pause: time.Millisecond}.withDefaults()}
+
+	var got []byte
+	bad, err := read(context.Background(), r, int64(len(data)), func(chunk []byte) { got = append(got, chunk...) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The failed sectors of the first chunk are merged
+	want := []Range{{Offset: 4096, Length: 1024}, {Offset: 12288, Length: 512}}
+	if !slices.Equal(bad, want) {
+		t.Errorf("bad ranges = %v, want %v", bad, want)
+	}
+	if len(got) != len(data) {
+		t.Fatalf("read %d bytes, want %d", len(got), len(data))
+	}
+	for _, r := range want {
+		if !bytes.Equal(got[r.Offset:r.End()], make([]byte, r.Length)) {
+			t.Errorf("bad range %v not zeroed", r)
+		}
+		copy(got[r.Offset:r.End()], data[r.Offset:r.End()])
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("readable bytes were not passed on as read")
+	}
+}
+
+func TestCopy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "letter.doc")
+	data := bytes.Repeat([]byte("x"), 100000)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	result, err := Copy(context.Background(), path, &out, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Partial() || result.Size != int64(len(data)) || result.Recovered != result.Size {
+		t.Errorf("copy of a readable file = %+v", result)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("copy differs from the file")
+	}
+
+	// Limits past the end stop at it
+	var n int
+	if _, err := Read(context.Background(), path, 1<<30, Options{}, func(chunk []byte) { n += len(chunk) }); err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	if n != len(data) {
+		t.Errorf("read %d bytes past the end, want %d", n, len(data))
+	}
+}
@@ -0,0 +1,170 @@
+package scan
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// DefaultBatchSize is how many files a scan saves to the catalog in each
+// transaction
+const DefaultBatchSize = 1000
+
+// maxBatchAge is how long a transaction of a scan stays open before it is
+// committed, however few files it holds, as it keeps other writers to the
+// catalog waiting
+const maxBatchAge = time.Second
+
+// batch runs the catalog writes of a scanner, grouping those of a scan into
+// transactions of a number of saved files, as committing every file on its
+// own makes scanning a drive of millions of files slow. Statements are
+// prepared once and reused. A transaction is begun for each file saved and
+// committed once it holds a batch of files, is maxBatchAge old or the
+// saving waits on hashing, so that it isn't held open while files are read.
+// Writes made from the hash workers, such as quarantining a file, go into
+// the open transaction if there is one, so they don't wait on the lock it
+// holds.
+type batch struct {
+	mu    sync.Mutex
+	db    *sql.DB
+	stmts map[string]*sql.Stmt
+	tx    *sql.Tx
+	began time.Time // When tx began
+	size  int       // Files per transaction; 0 outside a scan
+	files int       // Saved in the open transaction
+}
+
+// newBatch returns a batch writing to db, each statement on its own until
+// start is called
+func newBatch(db *sql.DB) *batch {
+	return &batch{db: db, stmts: make(map[string]*sql.Stmt)}
+}
+
+// start groups the writes of the files saved after it into transactions of
+// size files
+func (b *batch) start(size int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.size = max(size, 1)
+}
+
+// begin begins a transaction for the writes saving a file, unless one is
+// open or no scan is in progress
+func (b *batch) begin() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.size == 0 || b.tx != nil {
+		return nil
+	}
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	b.tx = tx
+	b.began = time.Now()
+	return nil
+}
+
+// exec runs a statement, in the open transaction during a scan
+func (b *batch) exec(query string, args ...any) (sql.Result, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stmt, err := b.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args...)
+}
+
+// queryRow runs a query returning a single row and scans it into dest,
+// seeing the writes of the open transaction
+func (b *batch) queryRow(query string, args []any, dest ...any) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stmt, err := b.stmt(query)
+	if err != nil {
+		return err
+	}
+	return stmt.QueryRow(args...).Scan(dest...)
+}
+
+// stmt returns the prepared statement for a query, bound to the open
+// transaction if there is one. b.mu is held.
+func (b *batch) stmt(query string) (*sql.Stmt, error) {
+	stmt, ok := b.stmts[query]
+	if !ok {
+		var err error
+		if stmt, err = b.db.Prepare(query); err != nil {
+			return nil, err
+		}
+		b.stmts[query] = stmt
+	}
+	if b.tx == nil {
+		return stmt, nil
+	}
+	return b.tx.Stmt(stmt), nil
+}
+
+// saved counts a file saved in the open transaction, committing it once it
+// holds a batch of files or has been open for maxBatchAge
+func (b *batch) saved() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.files++
+	if b.files < b.size && time.Since(b.began) < maxBatchAge {
+		return nil
+	}
+	return b.commit()
+}
+
+// flush commits the open transaction, if any, before waiting on the next
+// file to be hashed
+func (b *batch) flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.commit()
+}
+
+// rollback rolls back the open transaction, if any, so that a file that
+// failed to save isn't left half written along with the rest of its batch
+func (b *batch) rollback() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.files = 0
+	if b.tx == nil {
+		return nil
+	}
+	err := b.tx.Rollback()
+	b.tx = nil
+	return err
+}
+
+// finish commits the open transaction and writes each statement on its own
+// again
+func (b *batch) finish() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.size = 0
+	return b.commit()
+}
+
+// commit commits the open transaction, if any. b.mu is held.
+func (b *batch) commit() error {
+	b.files = 0
+	if b.tx == nil {
+		return nil
+	}
+	err := b.tx.Commit()
+	b.tx = nil
+	return err
+}
+
+// close releases the prepared statements
+func (b *batch) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, stmt := range b.stmts {
+		stmt.Close()
+	}
+	clear(b.stmts)
+}
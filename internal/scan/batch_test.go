@@ -0,0 +1,132 @@
+package scan
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+func TestBatchedScan(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 7; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d.txt", i)), []byte(fmt.Sprint(i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dbPath := filepath.Join(t.TempDir(), "archive.db")
+	scanner, err := NewScanner(dir, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scanner.Close()
+	scanner.SetBatchSize(3)
+
+	var seen int
+	scanner.SetProgress(func(FileInfo) { seen++ })
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var mode string
+	if err := scanner.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal mode = %q, want wal", mode)
+	}
+
+	// The last, partial batch is committed too, and visible to other
+	// connections
+	reader, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	files, err := reader.FindFiles("is_dir = FALSE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 7 || seen != 8 {
+		t.Errorf("cataloged %d files, saw %d entries; want 7 files and the folder", len(files), seen)
+	}
+
+	// Writes after the scan aren't held in a transaction
+	if _, err := scanner.store.exec("UPDATE files SET processed = TRUE"); err != nil {
+		t.Fatal(err)
+	}
+	if scanner.store.tx != nil {
+		t.Error("a transaction is still open after the scan")
+	}
+}
+
+func TestBatchCommits(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "archive.db")
+	conn, err := sql.Open("sqlite3", db.DSN(dbPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Exec("CREATE TABLE saved (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := sql.Open("sqlite3", db.DSN(dbPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	count := func() int {
+		var n int
+		if err := reader.QueryRow("SELECT COUNT(*) FROM saved").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	store := newBatch(conn)
+	defer store.close()
+	store.start(100)
+	save := func(name string) {
+		t.Helper()
+		if err := store.begin(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.exec("INSERT INTO saved (name) VALUES (?)", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A batch short of its size stays open until flushed
+	save("a")
+	if err := store.saved(); err != nil || store.tx == nil || count() != 0 {
+		t.Fatalf("after one file: err %v, open %v, %d committed; want an open transaction", err, store.tx != nil, count())
+	}
+	if err := store.flush(); err != nil || store.tx != nil || count() != 1 {
+		t.Fatalf("after flush: err %v, open %v, %d committed; want the file committed", err, store.tx != nil, count())
+	}
+
+	// An old batch is committed however few files it holds
+	save("b")
+	store.began = time.Now().Add(-maxBatchAge)
+	if err := store.saved(); err != nil || store.tx != nil || count() != 2 {
+		t.Fatalf("after %s: err %v, open %v, %d committed; want the batch committed", maxBatchAge, err, store.tx != nil, count())
+	}
+
+	// A batch a file failed to save in is rolled back, not committed
+	save("c")
+	if err := store.saved(); err != nil {
+		t.Fatal(err)
+	}
+	save("d")
+	if err := store.rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.finish(); err != nil || count() != 2 {
+		t.Errorf("after rollback and finish: err %v, %d committed; want 2", err, count())
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !darwin && !linux
+
+package scan
+
+import "io/fs"
+
+// linkKey identifies a file however many hard links it has
+type linkKey struct{}
+
+// fileLink can't tell hard links apart on this platform
+func fileLink(info fs.FileInfo) (linkKey, bool) {
+	return linkKey{}, false
+}
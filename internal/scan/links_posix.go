@@ -0,0 +1,32 @@
+//go:build darwin || linux
+
+package scan
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// linkKey identifies a file across the snapshots of a backup
+type linkKey struct {
+	dev     uint64
+	ino     uint64
+	size    int64
+	modTime int64
+}
+
+// fileLink returns the key of a file or folder. Folders are the same when
+// hard-linked, on the same device. Files are the same across snapshots
+// when they keep their inode, size and modification time: Time Machine
+// hard-links unchanged files on HFS+ disks, and APFS snapshots, mounted as
+// separate devices, keep the inodes of unchanged files.
+func fileLink(info fs.FileInfo) (linkKey, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return linkKey{}, false
+	}
+	if info.IsDir() {
+		return linkKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+	}
+	return linkKey{ino: uint64(stat.Ino), size: info.Size(), modTime: info.ModTime().UnixNano()}, true
+}
@@ -0,0 +1,320 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// sniffLen is how much of the start of a file is read to detect its type:
+// enough to reach the volume descriptor of an ISO 9660 image
+const sniffLen = 0x8006
+
+// signature is a magic number at a fixed offset
+type signature struct {
+	offset   int
+	magic    string
+	mimeType string
+}
+
+// signatures are the magic numbers of the formats http.DetectContentType
+// does not know, or knows only generically. More specific signatures come
+// before the ones they share a prefix with.
+var signatures = []signature{
+	// Camera raw files
+	{0, "FUJIFILMCCD-RAW", "image/x-fuji-raf"},
+	{0, "IIRO\x08\x00", "image/x-olympus-orf"},
+	{0, "IIRS\x08\x00", "image/x-olympus-orf"},
+	{0, "IIU\x00", "image/x-panasonic-rw2"},
+	{8, "CR\x02", "image/x-canon-cr2"},
+
+	// Other images and design files
+	{0, "8BPS", "image/vnd.adobe.photoshop"},
+	{0, "gimp xcf", "image/x-xcf"},
+	{0, "AT&TFORM", "image/vnd.djvu"},
+	{0, "\x00\x00\x00\x0cjP  \r\n\x87\n", "image/jp2"},
+	{0, "BLENDER", "application/x-blender"},
+	{0, "SIMPLE  =", "image/fits"},
+
+	// Video containers
+	{0, "FLV\x01", "video/x-flv"},
+	{0, "0&\xb2u\x8ef\xcf\x11\xa6\xd9\x00\xaa\x00b\xce\x6c", "video/x-ms-asf"},
+	{0, "\x00\x00\x01\xba", "video/mpeg"},
+	{0, "\x00\x00\x01\xb3", "video/mpeg"},
+	{4, "moov", "video/quicktime"},
+	{4, "mdat", "video/quicktime"},
+	{4, "wide", "video/quicktime"},
+
+	// Audio
+	{0, "fLaC", "audio/flac"},
+	{0, "MAC ", "audio/x-ape"},
+	{0, "wvpk", "audio/x-wavpack"},
+	{0, "#!AMR", "audio/amr"},
+	{0, "MThd", "audio/midi"},
+
+	// Archives and compressed files
+	{0, "7z\xbc\xaf\x27\x1c", "application/x-7z-compressed"},
+	{0, "Rar!\x1a\x07", "application/vnd.rar"},
+	{0, "\xfd7zXZ\x00", "application/x-xz"},
+	{0, "BZh", "application/x-bzip2"},
+	{0, "\x28\xb5\x2f\xfd", "application/zstd"},
+	{0, "\x04\x22\x4d\x18", "application/x-lz4"},
+	{0, "MSCF\x00\x00\x00\x00", "application/vnd.ms-cab-compressed"},
+	{0, "xar!", "application/x-xar"},
+	{0, "StuffIt (c)1997", "application/x-stuffit"},
+	{0, "SIT!\x00", "application/x-stuffit"},
+	{0, "StuffIt!", "application/x-stuffitx"},
+	{0, "!<arch>\ndebian", "application/vnd.debian.binary-package"},
+	{0, "\xed\xab\xee\xdb", "application/x-rpm"},
+	{257, "ustar", "application/x-tar"},
+
+	// Disk images
+	{0x8001, "CD001", "application/x-iso9660-image"},
+	{0, "conectix", "application/x-vhd"},
+	{0, "vhdxfile", "application/x-vhdx"},
+	{0, "KDMV", "application/x-vmdk"},
+	{0, "# Disk DescriptorFile", "application/x-vmdk"},
+	{0, "QFI\xfb", "application/x-qemu-disk"},
+	{0x40, "\x7f\x10\xda\xbe", "application/x-virtualbox-vdi"},
+	{0, "ADSEGMENTEDFILE", "application/x-aff"},
+	{0, "EVF\x09\x0d\x0a\xff\x00", "application/x-ewf"},
+
+	// Documents, databases and mail
+	{0, "SQLite format 3\x00", "application/vnd.sqlite3"},
+	{0, "\x00\x01\x00\x00Standard Jet DB", "application/x-msaccess"},
+	{0, "\x00\x01\x00\x00Standard ACE DB", "application/x-msaccess"},
+	{0, "!BDN", "application/vnd.ms-outlook-pst"},
+	{0, "{\\rtf", "application/rtf"},
+	{0, "%!PS-Adobe-", "application/postscript"},
+	{0, "\xc5\xd0\xd3\xc6", "application/postscript"},
+	{0, "BEGIN:VCARD", "text/vcard"},
+	{0, "BEGIN:VCALENDAR", "text/calendar"},
+	{0, "bplist00", "application/x-bplist"},
+	{0, "\x7fELF", "application/x-elf"},
+	{0, "\xca\xfe\xba\xbe", "application/x-mach-binary"},
+	{0, "\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+	{0, "\xce\xfa\xed\xfe", "application/x-mach-binary"},
+}
+
+// ftypBrands are the MIME types of ISO base media files by major brand
+var ftypBrands = map[string]string{
+	"qt  ": "video/quicktime",
+	"crx ": "image/x-canon-cr3",
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"hevc": "image/heic-sequence",
+	"mif1": "image/heif",
+	"msf1": "image/heif-sequence",
+	"avif": "image/avif",
+	"avis": "image/avif",
+	"M4A ": "audio/mp4",
+	"M4B ": "audio/mp4",
+	"M4P ": "audio/mp4",
+	"M4V ": "video/x-m4v",
+	"M4VH": "video/x-m4v",
+	"M4VP": "video/x-m4v",
+	"3gp4": "video/3gpp",
+	"3gp5": "video/3gpp",
+	"3gp6": "video/3gpp",
+	"3g2a": "video/3gpp2",
+	"f4v ": "video/x-f4v",
+	"jp2 ": "image/jp2",
+}
+
+// riffTypes are the MIME types of RIFF files by form type
+var riffTypes = map[string]string{
+	"AVI ": "video/x-msvideo",
+	"WAVE": "audio/wav",
+	"WEBP": "image/webp",
+	"CDXA": "video/mpeg",
+	"ACON": "application/x-navi-animation",
+}
+
+// zipTypes are the MIME types of ZIP-based formats by the name of a file
+// they start with
+var zipTypes = []struct{ entry, mimeType string }{
+	{"word/", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	{"xl/", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	{"ppt/", "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+	{"META-INF/mozilla.rsa", "application/x-xpinstall"},
+	{"AndroidManifest.xml", "application/vnd.android.package-archive"},
+	{"Index/Document.iwa", "application/vnd.apple.iwork"},
+	{"index.xml", "application/vnd.apple.iwork"},
+	{"doc.kml", "application/vnd.google-earth.kmz"},
+	{"3D/3dmodel.model", "application/vnd.ms-package.3dmanufacturing-3dmodel+xml"},
+}
+
+// ooxmlExtensions are the Office Open XML types by extension, for packages
+// whose first entry is [Content_Types].xml rather than the document itself
+var ooxmlExtensions = map[string]string{
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".docm": "application/vnd.ms-word.document.macroenabled.12",
+	".dotx": "application/vnd.openxmlformats-officedocument.wordprocessingml.template",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".xlsm": "application/vnd.ms-excel.sheet.macroenabled.12",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".pptm": "application/vnd.ms-powerpoint.presentation.macroenabled.12",
+	".vsdx": "application/vnd.ms-visio.drawing",
+}
+
+// oleExtensions are the types of OLE2 compound files by extension, which
+// all share the same header
+var oleExtensions = map[string]string{
+	".doc": "application/msword",
+	".dot": "application/msword",
+	".xls": "application/vnd.ms-excel",
+	".xlt": "application/vnd.ms-excel",
+	".ppt": "application/vnd.ms-powerpoint",
+	".pps": "application/vnd.ms-powerpoint",
+	".msg": "application/vnd.ms-outlook",
+	".vsd": "application/vnd.visio",
+	".pub": "application/vnd.ms-publisher",
+	".msi": "application/x-msi",
+}
+
+// sniff detects the type of a file from its first bytes by magic number,
+// returning "" for formats it does not know
+func sniff(buffer []byte, extension string) string {
+	switch {
+	case len(buffer) >= 12 && string(buffer[4:8]) == "ftyp":
+		return sniffFtyp(buffer)
+	case len(buffer) >= 12 && string(buffer[:4]) == "RIFF":
+		if mimeType, ok := riffTypes[string(buffer[8:12])]; ok {
+			return mimeType
+		}
+		return "application/x-riff"
+	case len(buffer) >= 12 && string(buffer[:4]) == "FORM":
+		switch string(buffer[8:12]) {
+		case "AIFF":
+			return "audio/aiff"
+		case "AIFC":
+			return "audio/x-aifc"
+		}
+	case bytes.HasPrefix(buffer, []byte("\x1a\x45\xdf\xa3")):
+		if bytes.Contains(buffer[:min(len(buffer), 64)], []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	case bytes.HasPrefix(buffer, []byte("OggS")):
+		return sniffOgg(buffer)
+	case bytes.HasPrefix(buffer, []byte("PK\x03\x04")):
+		return sniffZip(buffer, extension)
+	case bytes.HasPrefix(buffer, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")):
+		if mimeType, ok := oleExtensions[strings.ToLower(extension)]; ok {
+			return mimeType
+		}
+		return "application/x-ole-storage"
+	case isMPEGTS(buffer):
+		return "video/mp2t"
+	}
+
+	for _, sig := range signatures {
+		end := sig.offset + len(sig.magic)
+		if len(buffer) >= end && string(buffer[sig.offset:end]) == sig.magic {
+			return sig.mimeType
+		}
+	}
+	return ""
+}
+
+// sniffFtyp detects the type of an ISO base media file (MP4, QuickTime,
+// HEIF and relatives) from its major brand
+func sniffFtyp(buffer []byte) string {
+	brand := string(buffer[8:12])
+	if mimeType, ok := ftypBrands[brand]; ok {
+		return mimeType
+	}
+	if strings.HasPrefix(brand, "3g2") {
+		return "video/3gpp2"
+	}
+	if strings.HasPrefix(brand, "3g") {
+		return "video/3gpp"
+	}
+	return "video/mp4"
+}
+
+// sniffOgg detects the codec of an Ogg file from its first packet
+func sniffOgg(buffer []byte) string {
+	packet := buffer[min(len(buffer), 28):]
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		return "audio/ogg"
+	case bytes.HasPrefix(packet, []byte("OpusHead")):
+		return "audio/opus"
+	case bytes.HasPrefix(packet, []byte("\x7fFLAC")):
+		return "audio/ogg"
+	case bytes.HasPrefix(packet, []byte("\x80theora")):
+		return "video/ogg"
+	}
+	return "application/ogg"
+}
+
+// sniffZip detects ZIP-based formats from the name, and for OpenDocument
+// and EPUB the contents, of the first entry of the archive
+func sniffZip(buffer []byte, extension string) string {
+	if len(buffer) < 30 {
+		return "application/zip"
+	}
+	nameLen := int(binary.LittleEndian.Uint16(buffer[26:28]))
+	extraLen := int(binary.LittleEndian.Uint16(buffer[28:30]))
+	if len(buffer) < 30+nameLen {
+		return "application/zip"
+	}
+	name := string(buffer[30 : 30+nameLen])
+
+	// OpenDocument and EPUB store their type uncompressed as the first entry
+	if name == "mimetype" {
+		start := 30 + nameLen + extraLen
+		size := int(binary.LittleEndian.Uint32(buffer[18:22]))
+		if start+size <= len(buffer) && size > 0 && size < 128 {
+			return string(buffer[start : start+size])
+		}
+	}
+	if name == "[Content_Types].xml" || name == "_rels/.rels" {
+		if mimeType, ok := ooxmlExtensions[strings.ToLower(extension)]; ok {
+			return mimeType
+		}
+	}
+	for _, zipType := range zipTypes {
+		if strings.HasPrefix(name, zipType.entry) {
+			return zipType.mimeType
+		}
+	}
+	if strings.ToLower(extension) == ".jar" || name == "META-INF/MANIFEST.MF" || name == "META-INF/" {
+		return "application/java-archive"
+	}
+	return "application/zip"
+}
+
+// isMPEGTS reports whether buffer starts with MPEG transport stream packets,
+// which begin with a sync byte every 188 bytes
+func isMPEGTS(buffer []byte) bool {
+	if len(buffer) < 3*188 {
+		return false
+	}
+	for i := 0; i < 3; i++ {
+		if buffer[i*188] != 0x47 {
+			return false
+		}
+	}
+	return true
+}
+
+// sniffTrailer detects the formats identified by their last bytes rather
+// than their first: Apple disk images end with a "koly" block
+func sniffTrailer(file io.ReaderAt, size int64) string {
+	if size < 512 {
+		return ""
+	}
+	trailer := make([]byte, 4)
+	if _, err := file.ReadAt(trailer, size-512); err != nil {
+		return ""
+	}
+	if string(trailer) == "koly" {
+		return "application/x-apple-diskimage"
+	}
+	return ""
+}
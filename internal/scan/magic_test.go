@@ -0,0 +1,81 @@
+package scan
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectMIMEType(t *testing.T) {
+	iso := make([]byte, sniffLen)
+	copy(iso[0x8001:], "CD001")
+	ts := make([]byte, 3*188)
+	for i := 0; i < 3; i++ {
+		ts[i*188] = 0x47
+	}
+	odt := append([]byte("PK\x03\x04\x14\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x27\x00\x00\x00\x27\x00\x00\x00\x08\x00\x00\x00mimetype"),
+		"application/vnd.oasis.opendocument.text"...)
+
+	tests := []struct {
+		name      string
+		buffer    []byte
+		extension string
+		want      string
+	}{
+		{"QuickTime", []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"), ".mov", "video/quicktime"},
+		{"MP4", []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00"), ".mp4", "video/mp4"},
+		{"CR3", []byte("\x00\x00\x00\x18ftypcrx \x00\x00\x00\x01"), ".cr3", "image/x-canon-cr3"},
+		{"HEIC", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "", "image/heic"},
+		{"AVI", []byte("RIFF\x00\x00\x00\x00AVI LIST"), ".avi", "video/x-msvideo"},
+		{"Matroska", []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x88matroska"), ".mkv", "video/x-matroska"},
+		{"MPEG-TS", ts, ".mts", "video/mp2t"},
+		{"CR2", []byte("II*\x00\x10\x00\x00\x00CR\x02\x00"), ".cr2", "image/x-canon-cr2"},
+		{"NEF by extension", []byte("MM\x00*\x00\x00\x00\x08"), ".nef", "image/x-nikon-nef"},
+		{"RAF", []byte("FUJIFILMCCD-RAW 0201"), ".raf", "image/x-fuji-raf"},
+		{"ISO", iso, ".iso", "application/x-iso9660-image"},
+		{"VMDK", []byte("KDMV\x01\x00\x00\x00"), ".vmdk", "application/x-vmdk"},
+		{"Photoshop", []byte("8BPS\x00\x01"), ".psd", "image/vnd.adobe.photoshop"},
+		{"OpenDocument", odt, ".odt", "application/vnd.oasis.opendocument.text"},
+		{"DOCX", []byte("PK\x03\x04\x14\x00\x06\x00\x08\x00\x00\x00\x21\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x13\x00\x00\x00[Content_Types].xml"), ".docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"ZIP", []byte("PK\x03\x04\x14\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x05\x00\x00\x00a.txt"), ".zip", "application/zip"},
+		{"DOC", []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1\x00\x00"), ".DOC", "application/msword"},
+		{"SQLite", []byte("SQLite format 3\x00\x10\x00"), ".db", "application/vnd.sqlite3"},
+		{"7-Zip", []byte("7z\xbc\xaf\x27\x1c\x00\x04"), ".7z", "application/x-7z-compressed"},
+		{"PNG", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), ".png", "image/png"},
+		{"Text", []byte("hello world\n"), ".txt", "text/plain; charset=utf-8"},
+		{"Unknown by extension", []byte("\x00\x01\x02\x03"), ".pptx", "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+	}
+
+	for _, tt := range tests {
+		if got := detectMIMEType(tt.buffer, tt.extension); got != tt.want {
+			t.Errorf("%s: detectMIMEType = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectContentTypeTrailer(t *testing.T) {
+	image := make([]byte, 4096)
+	copy(image[len(image)-512:], "koly")
+	path := filepath.Join(t.TempDir(), "Installer.dmg")
+	if err := os.WriteFile(path, image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	contentType, err := detectContentType(path)
+	if err != nil {
+		t.Fatalf("detectContentType: %v", err)
+	}
+	if contentType != "application/x-apple-diskimage" {
+		t.Errorf("detectContentType = %q, want application/x-apple-diskimage", contentType)
+	}
+
+	// Short files are sniffed from what there is, not zero padding
+	path = filepath.Join(t.TempDir(), "short")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("a"), 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if contentType, _ := detectContentType(path); contentType != "text/plain; charset=utf-8" {
+		t.Errorf("detectContentType of a short text file = %q", contentType)
+	}
+}
@@ -0,0 +1,49 @@
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizationVariant(t *testing.T) {
+	dir := t.TempDir()
+	decomposed := filepath.Join(dir, "Café.txt") // As a Mac writes it
+	composed := filepath.Join(dir, "Caf\u00e9.txt")
+	if err := os.WriteFile(decomposed, []byte("menu"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(t.TempDir(), "archive.db")
+	scanner, err := NewScanner(dir, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scanner.Close()
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	if err := scanner.db.QueryRow("SELECT id FROM files WHERE path_key = ?", composed).Scan(&id); err != nil {
+		t.Fatalf("file not keyed by its NFC path: %v", err)
+	}
+
+	// Copied by a system that writes composed names
+	if err := os.Rename(decomposed, composed); err != nil {
+		t.Fatal(err)
+	}
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var rows int
+	var path string
+	scanner.db.QueryRow("SELECT COUNT(*), MAX(path) FROM files WHERE id = ? AND is_dir = FALSE", id).Scan(&rows, &path)
+	if rows != 1 || path != composed {
+		t.Errorf("row %d has path %q, want %q", id, path, composed)
+	}
+	var files int
+	scanner.db.QueryRow("SELECT COUNT(*) FROM files WHERE is_dir = FALSE").Scan(&files)
+	if files != 1 {
+		t.Errorf("%d files cataloged, want the renamed file once", files)
+	}
+}
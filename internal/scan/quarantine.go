@@ -0,0 +1,202 @@
+package scan
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/salvage"
+)
+
+// errQuarantined is returned by hashFile for files set aside as unreadable
+var errQuarantined = errors.New("file quarantined")
+
+// Chunked reads of quarantined files: small chunks, each retried with a
+// growing pause, so a sector that reads on the second try doesn't fail the
+// file
+const (
+	retryChunkSize = 64 * 1024
+	retryAttempts  = 5
+	retryPause     = 500 * time.Millisecond
+)
+
+// isRoot reports whether path is one of the roots being scanned
+func (s *Scanner) isRoot(path string) bool {
+	return slices.Contains(s.roots, path)
+}
+
+// quarantine sets aside a file or directory that could not be read, so the
+// scan goes on without it. Failing to record it only stops the scan if the
+// catalog itself can't be written, which the next save reports.
+func (s *Scanner) quarantine(path string, cause error) {
+	s.quarantined.Add(1)
+	s.log.Warn("quarantined unreadable file", "path", path, "error", cause)
+	now := time.Now()
+	_, err := s.store.exec(`
+	INSERT INTO quarantine (path, stage, error, attempts, first_seen, last_seen)
+	VALUES (?, ?, ?, 1, ?, ?)
+	ON CONFLICT (path) DO UPDATE
+	SET stage = excluded.stage, error = excluded.error, attempts = quarantine.attempts + 1,
+	    last_seen = excluded.last_seen
+	`, path, db.QuarantineScan, cause.Error(), now, now)
+	if err != nil {
+		s.log.Error("could not record quarantined file", "path", path, "error", err)
+	}
+}
+
+// loadQuarantined returns the quarantined paths below the roots, which a
+// successful scan takes out of quarantine
+func (s *Scanner) loadQuarantined() map[string]bool {
+	held := make(map[string]bool)
+	rows, err := s.db.Query("SELECT path FROM quarantine")
+	if err != nil {
+		s.log.Warn("could not list quarantined files", "error", err)
+		return held
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var path string
+		if rows.Scan(&path) == nil && s.isBelowRoots(path) {
+			held[path] = true
+		}
+	}
+	return held
+}
+
+// release takes a file that was read after all out of quarantine
+func (s *Scanner) release(path string) error {
+	if _, err := s.store.exec("DELETE FROM quarantine WHERE path = ?", path); err != nil {
+		return fmt.Errorf("failed to release %s from quarantine: %w", path, err)
+	}
+	delete(s.held, path)
+	return nil
+}
+
+// isBelowRoots reports whether path is one of the roots or below one
+func (s *Scanner) isBelowRoots(path string) bool {
+	for _, root := range s.roots {
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryResult is the outcome of retrying the quarantined files
+type RetryResult struct {
+	Recovered int // Read in full and cataloged
+	Failed    int // Still unreadable
+	Missing   int // No longer on the drive, left in quarantine
+}
+
+// RetryQuarantined reads the quarantined files below the roots again, in
+// small chunks with each chunk retried, and catalogs those that read in
+// full. Files that still fail stay quarantined with another attempt
+// counted. It stops between files when ctx is done.
+func (s *Scanner) RetryQuarantined(ctx context.Context) (*RetryResult, error) {
+	s.held = s.loadQuarantined()
+	paths := make([]string, 0, len(s.held))
+	for path := range s.held {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	result := &RetryResult{}
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			result.Missing++
+			continue
+		}
+		if err == nil && info.IsDir() {
+			// Folders are scanned again by the next scan of the drive
+			if _, err := os.ReadDir(path); err == nil {
+				if err := s.release(path); err != nil {
+					return result, err
+				}
+				result.Recovered++
+				continue
+			}
+		}
+		var file scannedFile
+		if err == nil && !info.IsDir() {
+			file, err = s.rereadFile(path, info)
+		}
+		if err != nil {
+			s.quarantine(path, err)
+			result.Failed++
+			continue
+		}
+		if err := s.saveFile(file); err != nil {
+			return result, err
+		}
+		s.log.Info("recovered quarantined file", "path", path)
+		result.Recovered++
+	}
+	return result, nil
+}
+
+// rereadFile detects the content type of a quarantined file and hashes it,
+// reading it in small retried chunks. As in a scan, files of 1GB or more
+// are not hashed and only their start is read.
+func (s *Scanner) rereadFile(path string, info os.FileInfo) (scannedFile, error) {
+	relPath, err := filepath.Rel(s.sourcePath, path)
+	if err != nil {
+		return scannedFile{}, err
+	}
+	file := scannedFile{info: FileInfo{
+		Path:         path,
+		RelativePath: relPath,
+		Size:         info.Size(),
+		ModTime:      info.ModTime(),
+	}}
+
+	limit := info.Size()
+	if limit >= 1073741824 {
+		limit = sniffLen
+	}
+	hash := sha256.New()
+	head := make([]byte, 0, sniffLen)
+	err = readChunked(path, limit, func(chunk []byte) {
+		hash.Write(chunk)
+		if room := sniffLen - len(head); room > 0 {
+			head = append(head, chunk[:min(room, len(chunk))]...)
+		}
+	})
+	if err != nil {
+		return file, err
+	}
+
+	file.info.ContentType = detectMIMEType(head, filepath.Ext(path))
+	if limit == info.Size() {
+		file.info.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	}
+	return file, nil
+}
+
+// readChunked reads the first limit bytes of a file in retryChunkSize
+// chunks, passing each to fn. A chunk that fails to read is retried up to
+// retryAttempts times, pausing longer after each failure, and fails the file
+// if it never reads; archiver salvage copies what can be read of such files.
+func readChunked(path string, limit int64, fn func([]byte)) error {
+	bad, err := salvage.Read(context.Background(), path, limit, salvage.Options{
+		ChunkSize: retryChunkSize,
+		Retries:   retryAttempts,
+		Pause:     retryPause,
+	}, fn)
+	if err == nil && len(bad) > 0 {
+		err = fmt.Errorf("%d bytes unreadable from byte %d", bad[0].Length, bad[0].Offset)
+	}
+	return err
+}
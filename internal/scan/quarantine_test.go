@@ -0,0 +1,77 @@
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "good.txt"), []byte("readable"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Opening a link to itself fails like a file on bad sectors would
+	bad := filepath.Join(dir, "bad.mov")
+	if err := os.Symlink(bad, bad); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner, err := NewScanner(dir, filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scanner.Close()
+
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatalf("an unreadable file stopped the scan: %v", err)
+	}
+	if got := scanner.Quarantined(); got != 1 {
+		t.Errorf("Quarantined() = %d, want 1", got)
+	}
+	if got := scanner.Scanned().Files; got != 1 {
+		t.Errorf("scanned %d files, want the readable one", got)
+	}
+	var attempts int
+	if err := scanner.db.QueryRow("SELECT attempts FROM quarantine WHERE path = ?", bad).Scan(&attempts); err != nil {
+		t.Fatalf("unreadable file not quarantined: %v", err)
+	}
+
+	// Still unreadable: another attempt is counted
+	result, err := scanner.RetryQuarantined(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failed != 1 || result.Recovered != 0 {
+		t.Errorf("retry of an unreadable file = %+v", result)
+	}
+	scanner.db.QueryRow("SELECT attempts FROM quarantine WHERE path = ?", bad).Scan(&attempts)
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+
+	// Readable again: cataloged and released
+	os.Remove(bad)
+	if err := os.WriteFile(bad, []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = scanner.RetryQuarantined(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if result.Recovered != 1 || result.Failed != 0 {
+		t.Errorf("retry of a readable file = %+v", result)
+	}
+	var contentType, hash string
+	if err := scanner.db.QueryRow("SELECT content_type, sha256 FROM files WHERE path = ?", bad).Scan(&contentType, &hash); err != nil {
+		t.Fatalf("recovered file not cataloged: %v", err)
+	}
+	if contentType != "video/quicktime" || hash == "" {
+		t.Errorf("recovered file cataloged as %q with hash %q", contentType, hash)
+	}
+	var left int
+	scanner.db.QueryRow("SELECT COUNT(*) FROM quarantine").Scan(&left)
+	if left != 0 {
+		t.Errorf("%d files left in quarantine", left)
+	}
+}
@@ -0,0 +1,117 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jth/archiver/internal/salvage"
+	"github.com/jth/archiver/internal/scratch"
+)
+
+// Salvaged is a quarantined file copied with what could be read of it
+type Salvaged struct {
+	Path   string
+	Copy   string // Copy in the scratch folder, which the caller removes
+	Result *salvage.Result
+}
+
+// Salvage copies what can be read of a quarantined file to the scratch
+// folder, with zeros in place of the ranges that could not be read. The file
+// is cataloged with the hash of the copy and taken out of quarantine, and
+// its bad ranges are recorded. Partial files are marked processed, as
+// extracting them would read the failing drive again.
+func (s *Scanner) Salvage(ctx context.Context, path string, options salvage.Options) (*Salvaged, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a folder, scan it again instead", path)
+	}
+	relPath, err := filepath.Rel(s.sourcePath, path)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := scratch.Create("salvage-*"+filepath.Ext(path), info.Size())
+	if err != nil {
+		return nil, err
+	}
+	salvaged := &Salvaged{Path: path, Copy: out.Name()}
+	head := &headWriter{limit: sniffLen}
+	salvaged.Result, err = salvage.Copy(ctx, path, io.MultiWriter(out, head), options)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		scratch.Remove(salvaged.Copy)
+		return nil, err
+	}
+
+	file := scannedFile{info: FileInfo{
+		Path:         path,
+		RelativePath: relPath,
+		Size:         salvaged.Result.Size,
+		ModTime:      info.ModTime(),
+		ContentType:  detectMIMEType(head.data, filepath.Ext(path)),
+		SHA256:       salvaged.Result.SHA256,
+	}}
+	if err := s.saveSalvaged(file, salvaged.Result); err != nil {
+		scratch.Remove(salvaged.Copy)
+		return nil, err
+	}
+	return salvaged, nil
+}
+
+// saveSalvaged catalogs a salvaged file and records what was read of it
+func (s *Scanner) saveSalvaged(file scannedFile, result *salvage.Result) error {
+	ranges := result.BadRanges
+	if ranges == nil {
+		ranges = []salvage.Range{}
+	}
+	badRanges, err := json.Marshal(ranges)
+	if err != nil {
+		return err
+	}
+	if err := s.saveFile(file); err != nil {
+		return err
+	}
+	if err := s.release(file.info.Path); err != nil {
+		return err
+	}
+
+	_, err = s.store.exec(`
+	INSERT INTO salvaged (file_id, partial, recovered, bad_ranges, salvaged_at)
+	SELECT id, ?, ?, ?, ? FROM files WHERE path = ?
+	ON CONFLICT (file_id) DO UPDATE
+	SET partial = excluded.partial, recovered = excluded.recovered,
+	    bad_ranges = excluded.bad_ranges, salvaged_at = excluded.salvaged_at
+	`, result.Partial(), result.Recovered, string(badRanges), time.Now(), file.info.Path)
+	if err == nil && result.Partial() {
+		_, err = s.store.exec("UPDATE files SET processed = TRUE WHERE path = ?", file.info.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record the salvage of %s: %w", file.info.Path, err)
+	}
+	return nil
+}
+
+// headWriter keeps the first bytes written to it, to detect the content
+// type from
+type headWriter struct {
+	limit int
+	data  []byte
+}
+
+// Write implements io.Writer
+func (w *headWriter) Write(p []byte) (int, error) {
+	if room := w.limit - len(w.data); room > 0 {
+		w.data = append(w.data, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
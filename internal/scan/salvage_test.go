@@ -0,0 +1,61 @@
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jth/archiver/internal/salvage"
+	"github.com/jth/archiver/internal/scratch"
+)
+
+func TestSalvage(t *testing.T) {
+	dir := t.TempDir()
+	if err := scratch.Configure(t.TempDir(), 0); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "clip.mov")
+	if err := os.Symlink(path, path); err != nil {
+		t.Fatal(err)
+	}
+	scanner, err := NewScanner(dir, filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scanner.Close()
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The drive lets the file be read before it is salvaged
+	os.Remove(path)
+	if err := os.WriteFile(path, []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	salvaged, err := scanner.Salvage(context.Background(), path, salvage.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scratch.Remove(salvaged.Copy)
+	if salvaged.Result.Partial() || salvaged.Result.Size != 16 {
+		t.Errorf("salvage = %+v", salvaged.Result)
+	}
+
+	var contentType, hash string
+	if err := scanner.db.QueryRow("SELECT content_type, sha256 FROM files WHERE path = ?", path).Scan(&contentType, &hash); err != nil {
+		t.Fatalf("salvaged file not cataloged: %v", err)
+	}
+	if contentType != "video/quicktime" || hash != salvaged.Result.SHA256 {
+		t.Errorf("salvaged file cataloged as %q with hash %q", contentType, hash)
+	}
+	var badRanges string
+	if err := scanner.db.QueryRow("SELECT bad_ranges FROM salvaged").Scan(&badRanges); err != nil || badRanges != "[]" {
+		t.Errorf("bad ranges recorded as %q: %v", badRanges, err)
+	}
+	var left int
+	scanner.db.QueryRow("SELECT COUNT(*) FROM quarantine").Scan(&left)
+	if left != 0 {
+		t.Errorf("%d files left in quarantine", left)
+	}
+}
@@ -1,17 +1,30 @@
 package scan
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/image"
+	"github.com/jth/archiver/internal/logging"
+	"github.com/jth/archiver/internal/pathnorm"
+	"github.com/jth/archiver/internal/policy"
+	"github.com/jth/archiver/internal/tagging"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -28,26 +41,69 @@ type FileInfo struct {
 
 // Scanner scans a directory and builds a manifest
 type Scanner struct {
-	db         *sql.DB
-	sourcePath string
-	dbPath     string
+	db          *sql.DB
+	store       *batch // Writes to db
+	batchSize   int
+	sourcePath  string   // Base that relative paths are recorded against
+	roots       []string // Files and directories to walk
+	dbPath      string
+	policy      *policy.Policy
+	tagger      *tagging.Tagger
+	log         *slog.Logger
+	excluded    policy.Report
+	scanned     Estimate
+	onFile      func(FileInfo)
+	beforeHash  func() error
+	reuseHash   bool
+	hashWorkers int
+	hashTimeout time.Duration
+	snapshots   SnapshotMode
+	filter      *snapshotFilter // Of the scan in progress
+	copies      Estimate        // Files left out as unchanged copies in snapshots
+	quarantined atomic.Int64    // Files and directories set aside as unreadable
+	held        map[string]bool // Paths quarantined before the scan in progress
+}
+
+// scannedFile is a file on its way from the walk to the catalog
+type scannedFile struct {
+	info      FileInfo
+	unchanged bool // The recorded hash was kept
+}
+
+// Estimate holds the totals of a size-only pass over a source directory
+type Estimate struct {
+	Files int64
+	Dirs  int64
+	Bytes int64
 }
 
 // NewScanner creates a new scanner
 func NewScanner(sourcePath, dbPath string) (*Scanner, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	conn, err := sql.Open("sqlite3", db.DSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	defaultPolicy, err := policy.Default()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
 	scanner := &Scanner{
-		db:         db,
+		db:         conn,
+		store:      newBatch(conn),
+		batchSize:  DefaultBatchSize,
 		sourcePath: sourcePath,
+		roots:      []string{sourcePath},
 		dbPath:     dbPath,
+		policy:     defaultPolicy,
+		log:        slog.Default(),
+		snapshots:  SnapshotsDedupe,
 	}
 
 	if err := scanner.initDB(); err != nil {
-		db.Close()
+		conn.Close()
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
@@ -56,60 +112,325 @@ func NewScanner(sourcePath, dbPath string) (*Scanner, error) {
 
 // Close closes the database connection
 func (s *Scanner) Close() error {
+	s.store.close()
 	return s.db.Close()
 }
 
 // initDB initializes the database schema
 func (s *Scanner) initDB() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS files (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		path TEXT NOT NULL,
-		relative_path TEXT NOT NULL,
-		size INTEGER NOT NULL,
-		mod_time DATETIME NOT NULL,
-		is_dir BOOLEAN NOT NULL,
-		content_type TEXT,
-		sha256 TEXT,
-		processed BOOLEAN DEFAULT FALSE,
-		uploaded_url TEXT,
-		upload_time DATETIME,
-		summary TEXT,
-		UNIQUE(path)
-	);
-	CREATE INDEX IF NOT EXISTS idx_files_path ON files(path);
-	CREATE INDEX IF NOT EXISTS idx_files_relative_path ON files(relative_path);
-	CREATE INDEX IF NOT EXISTS idx_files_processed ON files(processed);
-	`
+	return db.Migrate(s.db)
+}
 
-	_, err := s.db.Exec(schema)
-	return err
+// SetPolicy replaces the exclusion policy. A nil policy includes everything.
+func (s *Scanner) SetPolicy(p *policy.Policy) {
+	s.policy = p
 }
 
-// Scan scans the source directory and builds a manifest
-func (s *Scanner) Scan() error {
-	return filepath.Walk(s.sourcePath, s.processFile)
+// SetLogger sets the logger scan details are written to
+func (s *Scanner) SetLogger(logger *slog.Logger) {
+	s.log = logging.OrDefault(logger)
 }
 
-// processFile processes a single file or directory
-func (s *Scanner) processFile(path string, info os.FileInfo, err error) error {
-	if err != nil {
+// SetTagger sets the rules used to tag scanned files. A nil tagger tags
+// nothing.
+func (s *Scanner) SetTagger(t *tagging.Tagger) {
+	s.tagger = t
+}
+
+// SetProgress sets a function called after each file or directory is saved
+func (s *Scanner) SetProgress(fn func(FileInfo)) {
+	s.onFile = fn
+}
+
+// SetHashGate sets a function called before each file is hashed. Hashing
+// waits until it returns, and the scan stops if it returns an error.
+func (s *Scanner) SetHashGate(fn func() error) {
+	s.beforeHash = fn
+}
+
+// SetHashWorkers sets how many files are hashed at once. Files are saved
+// in the order they are hashed, which is the walk order with one worker,
+// the default.
+func (s *Scanner) SetHashWorkers(n int) {
+	s.hashWorkers = n
+}
+
+// SetHashTimeout sets how long hashing one file may take before the file
+// is quarantined and the scan moves on; 0, the default, doesn't limit it
+func (s *Scanner) SetHashTimeout(timeout time.Duration) {
+	s.hashTimeout = timeout
+}
+
+// SetReuseHashes makes the scan keep the recorded hash of files already in
+// the catalog with the same size and modification time instead of hashing
+// them again, so a resumed scan quickly passes what was scanned before
+func (s *Scanner) SetReuseHashes(reuse bool) {
+	s.reuseHash = reuse
+}
+
+// SetBatchSize sets how many files a scan saves to the catalog in each
+// transaction. Larger batches scan faster; a crash loses the files of the
+// open batch, which the next scan saves again.
+func (s *Scanner) SetBatchSize(n int) {
+	s.batchSize = n
+}
+
+// Excluded returns the paths left out by the policy during the last scan
+func (s *Scanner) Excluded() *policy.Report {
+	return &s.excluded
+}
+
+// SetSnapshotMode sets how Time Machine backups and folders of APFS
+// snapshots are scanned; the default scans every snapshot, leaving out files
+// unchanged since an earlier one
+func (s *Scanner) SetSnapshotMode(mode SnapshotMode) {
+	s.snapshots = mode
+}
+
+// SnapshotCopies returns the totals of the files the last scan left out as
+// unchanged since an earlier snapshot
+func (s *Scanner) SnapshotCopies() Estimate {
+	return s.copies
+}
+
+// Quarantined returns how many files and directories the last scan set
+// aside because they could not be read
+func (s *Scanner) Quarantined() int64 {
+	return s.quarantined.Load()
+}
+
+// Scanned returns the totals of the files and directories saved by the last scan
+func (s *Scanner) Scanned() Estimate {
+	return s.scanned
+}
+
+// Scan scans the source directory and builds a manifest. The walk, the
+// hash workers and the saving to the catalog run concurrently; the first
+// error, or ctx being done, stops all of them. Files saved until then stay
+// in the catalog, except those of a batch a file failed to save in.
+func (s *Scanner) Scan(ctx context.Context) error {
+	s.excluded = policy.Report{}
+	s.scanned = Estimate{}
+	s.copies = Estimate{}
+	s.quarantined.Store(0)
+	s.held = s.loadQuarantined()
+	s.filter = newSnapshotFilter(s.snapshots)
+	s.store.start(s.batchSize)
+	workers := max(s.hashWorkers, 1)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	walked := make(chan FileInfo, workers)
+	hashed := make(chan scannedFile, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for info := range walked {
+				file, err := s.hashFile(ctx, info)
+				if errors.Is(err, errQuarantined) {
+					continue
+				}
+				if err != nil {
+					cancel(err)
+					continue
+				}
+				select {
+				case hashed <- file:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(hashed)
+	}()
+
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		for {
+			var file scannedFile
+			var ok bool
+			select {
+			case file, ok = <-hashed:
+			default:
+				// Commit the files saved so far rather than hold the
+				// transaction open while the next file is read
+				if err := s.store.flush(); err != nil {
+					cancel(fmt.Errorf("failed to commit to the catalog: %w", err))
+				}
+				file, ok = <-hashed
+			}
+			if !ok {
+				return
+			}
+			if ctx.Err() != nil {
+				continue
+			}
+			if err := s.store.begin(); err != nil {
+				cancel(fmt.Errorf("failed to begin writing to the catalog: %w", err))
+			} else if err := s.saveFile(file); err != nil {
+				if rollbackErr := s.store.rollback(); rollbackErr != nil {
+					s.log.Warn("could not roll back the catalog writes", "error", rollbackErr)
+				}
+				cancel(err)
+			} else if err := s.store.saved(); err != nil {
+				cancel(fmt.Errorf("failed to commit to the catalog: %w", err))
+			}
+		}
+	}()
+
+	for _, root := range s.roots {
+		s.log.Info("scanning", "root", root)
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			return s.walkFile(ctx, walked, path, info, err)
+		})
+		if err != nil {
+			cancel(err)
+			break
+		}
+	}
+	close(walked)
+	<-saved
+	if err := s.store.finish(); err != nil {
+		cancel(fmt.Errorf("failed to commit to the catalog: %w", err))
+	}
+	if s.filter.found() {
+		s.log.Info("scanned Time Machine snapshots", "mode", s.snapshots,
+			"unchanged_files_left_out", s.copies.Files)
+	}
+
+	if err := context.Cause(ctx); err != nil {
+		s.log.Error("scan failed", "error", err)
 		return err
 	}
+	return nil
+}
 
-	// Skip hidden files and directories
-	if strings.HasPrefix(filepath.Base(path), ".") {
-		if info.IsDir() {
+// Estimate counts the files and bytes Scan will process without reading any
+// file contents
+func (s *Scanner) Estimate() (*Estimate, error) {
+	estimate := &Estimate{}
+	filter := newSnapshotFilter(s.snapshots)
+	for _, root := range s.roots {
+		if err := estimateInto(estimate, s.sourcePath, root, s.policy, filter); err != nil {
+			return nil, err
+		}
+	}
+	return estimate, nil
+}
+
+// EstimateSize walks a directory without hashing, applying the same
+// exclusions as a scan with the given policy and the default snapshot mode.
+// Entries that cannot be read are skipped; the real scan reports them.
+func EstimateSize(sourcePath string, p *policy.Policy) (*Estimate, error) {
+	estimate := &Estimate{}
+	if err := estimateInto(estimate, sourcePath, sourcePath, p, newSnapshotFilter(SnapshotsDedupe)); err != nil {
+		return nil, err
+	}
+	return estimate, nil
+}
+
+// estimateInto adds the totals of root, with paths relative to sourcePath,
+// to estimate
+func estimateInto(estimate *Estimate, sourcePath, root string, p *policy.Policy, filter *snapshotFilter) error {
+	if _, err := os.Stat(root); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if entry != nil && entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(sourcePath, path)
+		if err != nil {
+			return err
+		}
+		if p.Match(relPath, entry.IsDir()) != nil {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if filter.skip(path, info) != nil {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			estimate.Dirs++
+			return nil
+		}
+		estimate.Files++
+		estimate.Bytes += info.Size()
+		return nil
+	})
+}
+
+// walkFile applies the policy to a file or directory of the walk and passes
+// it on to be hashed
+func (s *Scanner) walkFile(ctx context.Context, walked chan<- FileInfo, path string, info os.FileInfo, err error) error {
+	if err != nil && s.isRoot(path) {
+		return err
+	}
+	if err != nil {
+		// An unreadable folder or file doesn't stop the walk
+		s.quarantine(path, err)
+		if info != nil && info.IsDir() {
 			return filepath.SkipDir
 		}
 		return nil
 	}
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
 
 	relPath, err := filepath.Rel(s.sourcePath, path)
 	if err != nil {
 		return err
 	}
 
+	// Leave out the history of Time Machine backups
+	if rule := s.filter.skip(path, info); rule == unchangedCopy {
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		s.copies.Files++
+		s.copies.Bytes += info.Size()
+		return nil
+	} else if rule != nil {
+		s.excluded.Add(relPath, info.IsDir(), rule)
+		s.log.Debug("excluded", "path", path, "list", rule.List, "rule", rule.Pattern)
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+
+	// Skip system folders, caches and other noise
+	if rule := s.policy.Match(relPath, info.IsDir()); rule != nil {
+		s.excluded.Add(relPath, info.IsDir(), rule)
+		s.log.Debug("excluded", "path", path, "list", rule.List, "rule", rule.Pattern)
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+
 	fileInfo := FileInfo{
 		Path:         path,
 		RelativePath: relPath,
@@ -117,36 +438,131 @@ func (s *Scanner) processFile(path string, info os.FileInfo, err error) error {
 		ModTime:      info.ModTime(),
 		IsDir:        info.IsDir(),
 	}
+	select {
+	case walked <- fileInfo:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// hashFile detects the content type of a file and hashes it
+func (s *Scanner) hashFile(ctx context.Context, fileInfo FileInfo) (scannedFile, error) {
+	file := scannedFile{info: fileInfo}
+	if fileInfo.IsDir {
+		return file, nil
+	}
+
+	contentType, err := detectContentType(fileInfo.Path)
+	if err != nil {
+		s.quarantine(fileInfo.Path, err)
+		return file, errQuarantined
+	}
+	file.info.ContentType = contentType
 
-	if !info.IsDir() {
-		contentType, err := detectContentType(path)
+	// Calculate hash for files smaller than 1GB, unless already recorded
+	if hash, ok := s.recordedHash(fileInfo); ok {
+		file.info.SHA256 = hash
+		file.unchanged = true
+	} else if fileInfo.Size < 1073741824 {
+		if s.beforeHash != nil {
+			if err := s.beforeHash(); err != nil {
+				return file, err
+			}
+		}
+		hash, err := s.hashWithTimeout(ctx, fileInfo.Path)
+		if err != nil && ctx.Err() != nil {
+			return file, context.Cause(ctx)
+		}
 		if err != nil {
-			return err
+			s.quarantine(fileInfo.Path, err)
+			return file, errQuarantined
 		}
-		fileInfo.ContentType = contentType
+		file.info.SHA256 = hash
+	}
+	return file, nil
+}
 
-		// Calculate hash for files smaller than 1GB
-		if info.Size() < 1073741824 {
-			hash, err := calculateSHA256(path)
-			if err != nil {
-				return err
-			}
-			fileInfo.SHA256 = hash
+// saveFile records a hashed file or directory in the catalog
+func (s *Scanner) saveFile(file scannedFile) error {
+	fileInfo := file.info
+	if err := s.saveFileInfo(fileInfo); err != nil {
+		return err
+	}
+	if err := s.saveTags(fileInfo); err != nil {
+		return err
+	}
+	if s.held[fileInfo.Path] {
+		if err := s.release(fileInfo.Path); err != nil {
+			return err
+		}
+	}
+	if !fileInfo.IsDir && !file.unchanged && image.IsPhoto(fileInfo.Path) {
+		if err := s.savePhotoInfo(fileInfo); err != nil {
+			return err
 		}
 	}
+	s.log.Debug("scanned", "path", fileInfo.Path, "size", fileInfo.Size, "content_type", fileInfo.ContentType)
+	if fileInfo.IsDir {
+		s.scanned.Dirs++
+	} else {
+		s.scanned.Files++
+		s.scanned.Bytes += fileInfo.Size
+	}
+	if s.onFile != nil {
+		s.onFile(fileInfo)
+	}
+	return nil
+}
+
+// recordedHash returns the hash recorded for an unchanged file when hashes
+// are reused
+func (s *Scanner) recordedHash(info FileInfo) (string, bool) {
+	if !s.reuseHash {
+		return "", false
+	}
 
-	return s.saveFileInfo(fileInfo)
+	var hash sql.NullString
+	err := s.db.QueryRow("SELECT sha256 FROM files WHERE path = ? AND size = ? AND mod_time = ?",
+		info.Path, info.Size, info.ModTime).Scan(&hash)
+	if err != nil || hash.String == "" {
+		return "", false
+	}
+	return hash.String, true
 }
 
-// saveFileInfo saves file information to the database
+// saveFileInfo saves file information to the database. Rescanning a file
+// keeps its row ID, so tags and provenance stay attached, and keeps it
+// processed unless its content changed. Rows are keyed by the path in NFC
+// as well, so a file whose name was written in another Unicode
+// normalization, as when a drive moved between a Mac and another system,
+// keeps its row too.
 func (s *Scanner) saveFileInfo(info FileInfo) error {
+	key := pathnorm.NFC(info.Path)
+	if err := s.renameVariant(info.Path, key); err != nil {
+		return err
+	}
+	if err := s.keepVersion(info); err != nil {
+		return err
+	}
+
 	query := `
-	INSERT OR REPLACE INTO files 
-	(path, relative_path, size, mod_time, is_dir, content_type, sha256)
-	VALUES (?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO files 
+	(path, relative_path, size, mod_time, is_dir, content_type, sha256, scanned_at, path_key)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(path) DO UPDATE SET
+		relative_path = excluded.relative_path,
+		scanned_at = excluded.scanned_at,
+		size = excluded.size,
+		mod_time = excluded.mod_time,
+		is_dir = excluded.is_dir,
+		content_type = excluded.content_type,
+		processed = CASE WHEN files.sha256 IS excluded.sha256 THEN files.processed ELSE FALSE END,
+		sha256 = excluded.sha256,
+		path_key = excluded.path_key
 	`
 
-	_, err := s.db.Exec(
+	_, err := s.store.exec(
 		query,
 		info.Path,
 		info.RelativePath,
@@ -155,11 +571,113 @@ func (s *Scanner) saveFileInfo(info FileInfo) error {
 		info.IsDir,
 		info.ContentType,
 		info.SHA256,
+		time.Now(),
+		key,
 	)
 
 	return err
 }
 
+// keepVersion records the cataloged content of a file as a previous
+// version when the file's content changed, along with its upload if that
+// content was uploaded, so the upload can still be restored once a newer
+// one replaces it
+func (s *Scanner) keepVersion(info FileInfo) error {
+	if info.IsDir || info.SHA256 == "" {
+		return nil
+	}
+	_, err := s.store.exec(`
+	INSERT INTO file_versions (file_id, sha256, size, mod_time, summary, uploaded_url, remote_name, upload_time, replaced_at)
+	SELECT id, sha256, size, mod_time, summary,
+	       CASE uploaded WHEN 1 THEN uploaded_url END,
+	       CASE uploaded WHEN 1 THEN remote_name END,
+	       CASE uploaded WHEN 1 THEN upload_time END, ?
+	FROM (
+		SELECT *, COALESCE(upload_sha256, '') IN ('', sha256) AND COALESCE(uploaded_url, '') != '' AS uploaded
+		FROM files
+		WHERE path = ? AND is_dir = FALSE AND COALESCE(sha256, '') NOT IN ('', ?)
+	)
+	`, time.Now(), info.Path, info.SHA256)
+	return err
+}
+
+// renameVariant moves the row of a file cataloged under another
+// normalization of its name to the name it has now, keeping the byte-exact
+// name on disk for restores. Variants still on disk are other files, as
+// file systems that don't normalize names can hold both.
+func (s *Scanner) renameVariant(path, key string) error {
+	if !strings.ContainsFunc(path, func(r rune) bool { return r >= utf8.RuneSelf }) {
+		return nil
+	}
+	var variant string
+	err := s.store.queryRow(`
+	SELECT path FROM files
+	WHERE path_key = ? AND path != ? AND NOT EXISTS (SELECT 1 FROM files WHERE path = ?)
+	LIMIT 1
+	`, []any{key, path, path}, &variant)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(variant); !errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if _, err := s.store.exec("UPDATE files SET path = ? WHERE path = ?", path, variant); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", variant, path, err)
+	}
+	s.log.Debug("file name changed normalization", "from", variant, "to", path)
+	return nil
+}
+
+// saveTags records the tags the tag rules give a saved file
+func (s *Scanner) saveTags(info FileInfo) error {
+	tags := s.tagger.Tags(info.Path)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, tag := range tags {
+		_, err := s.store.exec(
+			"INSERT OR IGNORE INTO file_tags (file_id, tag, created_at) SELECT id, ?, ? FROM files WHERE path = ?",
+			tag, now, info.Path,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to tag %s: %w", info.Path, err)
+		}
+	}
+	return nil
+}
+
+// savePhotoInfo records the camera metadata and the date taken of a saved
+// photo, if its EXIF data can be read
+func (s *Scanner) savePhotoInfo(info FileInfo) error {
+	exif, err := image.ReadEXIF(info.Path)
+	if err != nil {
+		s.log.Debug("no EXIF data", "path", info.Path, "error", err)
+		return nil
+	}
+
+	_, err = s.store.exec(`
+	INSERT INTO photo_exif (file_id, camera, lens, iso, exposure_time, f_number, focal_length, width, height, orientation)
+	SELECT id, ?, ?, ?, ?, ?, ?, ?, ?, ? FROM files WHERE path = ?
+	ON CONFLICT(file_id) DO UPDATE SET
+		camera = excluded.camera, lens = excluded.lens, iso = excluded.iso, exposure_time = excluded.exposure_time,
+		f_number = excluded.f_number, focal_length = excluded.focal_length, width = excluded.width,
+		height = excluded.height, orientation = excluded.orientation
+	`, exif.Camera(), exif.Lens, exif.ISO, exif.ExposureTime, exif.FNumber, exif.FocalLength,
+		exif.Width, exif.Height, exif.Orientation, info.Path)
+	if err == nil && !exif.Taken.IsZero() {
+		_, err = s.store.exec("UPDATE files SET taken_at = ? WHERE path = ?", exif.Taken, info.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record the EXIF data of %s: %w", info.Path, err)
+	}
+	return nil
+}
+
 // detectContentType attempts to determine the MIME type of a file
 func detectContentType(path string) (string, error) {
 	file, err := os.Open(path)
@@ -168,19 +686,48 @@ func detectContentType(path string) (string, error) {
 	}
 	defer file.Close()
 
-	// Read the first 512 bytes to detect content type
-	buffer := make([]byte, 512)
-	_, err = file.Read(buffer)
-	if err != nil && err != io.EOF {
+	// Read the start of the file to detect content type
+	buffer := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		return "", err
 	}
 
-	return detectMIMEType(buffer, filepath.Ext(path)), nil
+	contentType := detectMIMEType(buffer[:n], filepath.Ext(path))
+	if contentType == "application/octet-stream" {
+		if info, err := file.Stat(); err == nil {
+			if mimeType := sniffTrailer(file, info.Size()); mimeType != "" {
+				return mimeType, nil
+			}
+		}
+	}
+	return contentType, nil
+}
+
+// rawMIMETypes are the MIME types of camera raw formats
+var rawMIMETypes = map[string]string{
+	".cr2": "image/x-canon-cr2",
+	".cr3": "image/x-canon-cr3",
+	".nef": "image/x-nikon-nef",
+	".nrw": "image/x-nikon-nrw",
+	".arw": "image/x-sony-arw",
+	".srf": "image/x-sony-srf",
+	".sr2": "image/x-sony-sr2",
+	".dng": "image/x-adobe-dng",
+	".orf": "image/x-olympus-orf",
+	".rw2": "image/x-panasonic-rw2",
+	".pef": "image/x-pentax-pef",
+	".raf": "image/x-fuji-raf",
 }
 
-// detectMIMEType detects MIME type based on file contents and extension
+// detectMIMEType detects MIME type based on file contents and extension:
+// by magic number first, then as the standard library would, and by
+// extension as a last resort
 func detectMIMEType(buffer []byte, extension string) string {
-	contentType := http.DetectContentType(buffer)
+	contentType := sniff(buffer, extension)
+	if contentType == "" {
+		contentType = http.DetectContentType(buffer)
+	}
 
 	// Map common extensions to MIME types if detection is generic
 	if contentType == "application/octet-stream" {
@@ -206,11 +753,18 @@ func detectMIMEType(buffer []byte, extension string) string {
 		}
 	}
 
+	// Most raw files are plain TIFF structures; name them by camera
+	if mimeType, ok := rawMIMETypes[strings.ToLower(extension)]; ok &&
+		(contentType == "image/tiff" || contentType == "application/octet-stream") {
+		return mimeType
+	}
+
 	return contentType
 }
 
-// calculateSHA256 calculates the SHA-256 hash of a file
-func calculateSHA256(path string) (string, error) {
+// calculateSHA256 calculates the SHA-256 hash of a file, stopping when ctx
+// is done
+func calculateSHA256(ctx context.Context, path string) (string, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return "", err
@@ -218,9 +772,50 @@ func calculateSHA256(path string) (string, error) {
 	defer file.Close()
 
 	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	if _, err := io.Copy(hash, readerWithContext{ctx, file}); err != nil {
 		return "", err
 	}
 
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
+
+// hashWithTimeout calculates the SHA-256 hash of a file within the hash
+// timeout. A read that hangs, as on a failing drive, is left behind rather
+// than waited for.
+func (s *Scanner) hashWithTimeout(ctx context.Context, path string) (string, error) {
+	if s.hashTimeout <= 0 {
+		return calculateSHA256(ctx, path)
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, s.hashTimeout,
+		fmt.Errorf("hashing timed out after %s", s.hashTimeout))
+	defer cancel()
+
+	type hashed struct {
+		hash string
+		err  error
+	}
+	done := make(chan hashed, 1)
+	go func() {
+		hash, err := calculateSHA256(ctx, path)
+		done <- hashed{hash, err}
+	}()
+	select {
+	case result := <-done:
+		return result.hash, result.err
+	case <-ctx.Done():
+		return "", context.Cause(ctx)
+	}
+}
+
+// readerWithContext stops a copy when its context is done
+type readerWithContext struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r readerWithContext) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,134 @@
+package scan
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jth/archiver/internal/policy"
+)
+
+// SnapshotMode is how Time Machine backups and folders of APFS snapshots
+// are scanned. Every snapshot is a full copy of the backed-up disk, with
+// files unchanged since the previous snapshot hard-linked to it.
+type SnapshotMode string
+
+// Snapshot modes
+const (
+	SnapshotsLatest SnapshotMode = "latest" // Only the latest snapshot of each backup
+	SnapshotsDedupe SnapshotMode = "dedupe" // Every snapshot, with each hard-linked file once
+	SnapshotsAll    SnapshotMode = "all"    // Every snapshot, as ordinary folders
+)
+
+// snapshotName matches the folders snapshots are kept in: dated folders in
+// Backups.backupdb and on APFS backup disks (2024-03-01-101500.backup), and
+// mounted local snapshots (com.apple.TimeMachine.2024-03-01-101500.local)
+var snapshotName = regexp.MustCompile(`^(com\.apple\.TimeMachine\.)?\d{4}-\d{2}-\d{2}-\d{6}(\.backup|\.previous|\.local|\.inProgress|\.interrupted)?$`)
+
+// Rules the exclusions of snapshot folders and files are reported under
+var (
+	olderSnapshot    = &policy.Rule{List: "snapshots", Pattern: "older snapshots"}
+	unfinishedBackup = &policy.Rule{List: "snapshots", Pattern: "unfinished backups"}
+	unchangedCopy    = &policy.Rule{List: "snapshots", Pattern: "unchanged since an earlier snapshot"}
+)
+
+// snapshotFilter leaves the history of Time Machine backups out of a walk
+type snapshotFilter struct {
+	mode      SnapshotMode
+	latest    map[string]string // Latest snapshot in each folder of snapshots
+	snapshots []string          // Snapshot folders walked
+	seen      map[linkKey]bool  // Files and folders walked in a snapshot
+}
+
+// newSnapshotFilter creates a filter for one walk
+func newSnapshotFilter(mode SnapshotMode) *snapshotFilter {
+	return &snapshotFilter{
+		mode:   mode,
+		latest: make(map[string]string),
+		seen:   make(map[linkKey]bool),
+	}
+}
+
+// skip returns the rule leaving a file or folder out of the walk, or nil.
+// Unfinished backups are left out, and older snapshots when only the latest
+// is scanned. When deduplicating, a file or folder already walked in an
+// earlier snapshot is left out.
+func (f *snapshotFilter) skip(path string, info fs.FileInfo) *policy.Rule {
+	if f == nil || f.mode == SnapshotsAll {
+		return nil
+	}
+
+	if info.IsDir() && snapshotName.MatchString(info.Name()) {
+		name := info.Name()
+		if strings.HasSuffix(name, ".inProgress") || strings.HasSuffix(name, ".interrupted") {
+			return unfinishedBackup
+		}
+		parent := filepath.Dir(path)
+		latest, ok := f.latest[parent]
+		if !ok {
+			latest = latestSnapshot(parent)
+			f.latest[parent] = latest
+		}
+		if f.mode == SnapshotsLatest && name != latest {
+			return olderSnapshot
+		}
+		f.snapshots = append(f.snapshots, path)
+		return nil
+	}
+
+	if f.mode != SnapshotsDedupe || !f.inSnapshot(path) {
+		return nil
+	}
+	key, ok := fileLink(info)
+	if !ok {
+		return nil
+	}
+	if f.seen[key] {
+		return unchangedCopy
+	}
+	f.seen[key] = true
+	return nil
+}
+
+// found reports whether the walk came across any snapshots
+func (f *snapshotFilter) found() bool {
+	return f != nil && len(f.latest) > 0
+}
+
+// inSnapshot reports whether path is below a snapshot folder being walked
+func (f *snapshotFilter) inSnapshot(path string) bool {
+	for i := len(f.snapshots) - 1; i >= 0; i-- {
+		if strings.HasPrefix(path, f.snapshots[i]+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// latestSnapshot returns the name of the latest finished snapshot in a
+// folder. Snapshot names start with their date, so the latest sorts last.
+func latestSnapshot(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	latest := ""
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || !snapshotName.MatchString(name) ||
+			strings.HasSuffix(name, ".inProgress") || strings.HasSuffix(name, ".interrupted") {
+			continue
+		}
+		if snapshotDate(name) > snapshotDate(latest) {
+			latest = name
+		}
+	}
+	return latest
+}
+
+// snapshotDate returns the sortable date part of a snapshot name
+func snapshotDate(name string) string {
+	return strings.TrimPrefix(name, "com.apple.TimeMachine.")
+}
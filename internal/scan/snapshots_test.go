@@ -0,0 +1,76 @@
+//go:build darwin || linux
+
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jth/archiver/internal/policy"
+)
+
+func TestSnapshotModes(t *testing.T) {
+	dir := t.TempDir()
+	machine := filepath.Join(dir, "Backups.backupdb", "mac")
+	older := filepath.Join(machine, "2024-01-01-100000")
+	latest := filepath.Join(machine, "2024-02-01-100000")
+	unfinished := filepath.Join(machine, "2024-03-01-100000.inProgress")
+	for _, snapshot := range []string{older, latest, unfinished} {
+		if err := os.MkdirAll(snapshot, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(older, "kept.txt"), "same")
+	write(filepath.Join(older, "changed.txt"), "old")
+	write(filepath.Join(latest, "changed.txt"), "new!")
+	write(filepath.Join(unfinished, "partial.txt"), "x")
+	// Time Machine hard-links files unchanged since the previous snapshot
+	if err := os.Link(filepath.Join(older, "kept.txt"), filepath.Join(latest, "kept.txt")); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+
+	// The default exclusions mustn't hide the backup from the snapshot modes
+	defaults, err := policy.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		mode  SnapshotMode
+		files int64
+	}{
+		{SnapshotsAll, 5},
+		{SnapshotsDedupe, 3},
+		{SnapshotsLatest, 2},
+	} {
+		estimate := &Estimate{}
+		if err := estimateInto(estimate, dir, dir, defaults, newSnapshotFilter(test.mode)); err != nil {
+			t.Fatal(err)
+		}
+		if estimate.Files != test.files {
+			t.Errorf("%s: %d files, want %d", test.mode, estimate.Files, test.files)
+		}
+	}
+}
+
+func TestLatestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"2023-12-31-235959.backup",
+		"com.apple.TimeMachine.2024-01-02-080000.local",
+		"2024-05-01-000000.inProgress",
+		"Latest",
+	} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := latestSnapshot(dir); got != "com.apple.TimeMachine.2024-01-02-080000.local" {
+		t.Errorf("latestSnapshot = %q", got)
+	}
+}
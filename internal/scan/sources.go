@@ -0,0 +1,174 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jth/archiver/internal/pathnorm"
+)
+
+// ResolveSource expands a source argument into the paths to scan. The source
+// may be a directory, a single file, or a glob pattern such as
+// "/Volumes/Drive/Projects/*.pdf". Windows long-path prefixes are dropped,
+// so the catalog names files the same whichever way they were given.
+func ResolveSource(source string) ([]string, error) {
+	source = pathnorm.StripLongPrefix(source)
+	if _, err := os.Stat(source); err == nil {
+		return []string{source}, nil
+	} else if !strings.ContainsAny(source, "*?[") {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source pattern %q: %w", source, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %s", source)
+	}
+	return matches, nil
+}
+
+// ReadFileList reads a list of paths, one per line. Blank lines and lines
+// starting with # are ignored, so lists produced by find, fd or Spotlight
+// can be used as they are.
+func ReadFileList(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, pathnorm.StripLongPrefix(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list: %w", err)
+	}
+	return paths, nil
+}
+
+// ReadNULList reads a list of NUL-terminated paths, as written by
+// `find -print0`. Unlike newline-separated lists it can carry any file name.
+func ReadNULList(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	scanner.Split(splitNUL)
+	for scanner.Scan() {
+		if path := scanner.Text(); path != "" {
+			paths = append(paths, pathnorm.StripLongPrefix(path))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read path list: %w", err)
+	}
+	return paths, nil
+}
+
+// splitNUL is a bufio.SplitFunc splitting on NUL bytes
+func splitNUL(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// SetPaths makes the scanner walk the given files and directories instead of
+// its source directory. Relative paths are recorded against the deepest
+// directory containing all of them, and paths inside another listed
+// directory are only scanned once.
+func (s *Scanner) SetPaths(paths []string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no paths to scan")
+	}
+
+	roots := make([]string, 0, len(paths))
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return err
+		}
+		roots = append(roots, abs)
+	}
+
+	s.roots = dedupeRoots(roots)
+	s.sourcePath = commonDir(s.roots)
+	return nil
+}
+
+// dedupeRoots sorts roots and drops duplicates and any root inside another
+func dedupeRoots(roots []string) []string {
+	listed := make(map[string]bool, len(roots))
+	for _, root := range roots {
+		listed[root] = true
+	}
+
+	var kept []string
+	for root := range listed {
+		if !hasListedAncestor(root, listed) {
+			kept = append(kept, root)
+		}
+	}
+	sort.Strings(kept)
+	return kept
+}
+
+// hasListedAncestor reports whether any parent directory of path is listed
+func hasListedAncestor(path string, listed map[string]bool) bool {
+	for dir := filepath.Dir(path); dir != path; path, dir = dir, filepath.Dir(dir) {
+		if listed[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// commonDir returns the deepest directory containing every root. A lone
+// directory root is its own base, so scanning one directory records the same
+// relative paths as before.
+func commonDir(roots []string) string {
+	dirs := make([]string, len(roots))
+	for i, root := range roots {
+		if info, err := os.Stat(root); err == nil && info.IsDir() {
+			dirs[i] = root
+		} else {
+			dirs[i] = filepath.Dir(root)
+		}
+	}
+
+	common := dirs[0]
+	for _, dir := range dirs[1:] {
+		for !isWithin(dir, common) {
+			parent := filepath.Dir(common)
+			if parent == common {
+				break
+			}
+			common = parent
+		}
+	}
+	return common
+}
+
+// isWithin reports whether path is dir or inside it
+func isWithin(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
+}
@@ -0,0 +1,99 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveSource(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.pdf", "b.pdf", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := ResolveSource(filepath.Join(dir, "*.pdf"))
+	if err != nil {
+		t.Fatalf("ResolveSource glob: %v", err)
+	}
+	want := []string{filepath.Join(dir, "a.pdf"), filepath.Join(dir, "b.pdf")}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("glob matched %v, want %v", paths, want)
+	}
+
+	if paths, err := ResolveSource(dir); err != nil || len(paths) != 1 || paths[0] != dir {
+		t.Errorf("ResolveSource(dir) = %v, %v", paths, err)
+	}
+	if _, err := ResolveSource(filepath.Join(dir, "*.doc")); err == nil {
+		t.Error("expected an error for a glob without matches")
+	}
+	if _, err := ResolveSource(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing path")
+	}
+}
+
+func TestReadFileList(t *testing.T) {
+	list := "# exported from Finder\n/a/one.pdf\n\n  /a/two.pdf  \n"
+	paths, err := ReadFileList(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/a/one.pdf", "/a/two.pdf"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("ReadFileList = %v, want %v", paths, want)
+	}
+}
+
+func TestReadNULList(t *testing.T) {
+	list := "/a/with\nnewline.txt\x00/a/two.pdf\x00\x00/a/last"
+	paths, err := ReadNULList(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/a/with\nnewline.txt", "/a/two.pdf", "/a/last"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("ReadNULList = %q, want %q", paths, want)
+	}
+}
+
+func TestSetPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"docs/report.pdf", "docs/old/memo.txt", "photos/img.jpg"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Scanner{}
+	err := s.SetPaths([]string{
+		filepath.Join(dir, "photos/img.jpg"),
+		filepath.Join(dir, "docs"),
+		filepath.Join(dir, "docs/old/memo.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantRoots := []string{filepath.Join(dir, "docs"), filepath.Join(dir, "photos/img.jpg")}
+	if !reflect.DeepEqual(s.roots, wantRoots) {
+		t.Errorf("roots = %v, want %v", s.roots, wantRoots)
+	}
+	if s.sourcePath != dir {
+		t.Errorf("base = %s, want %s", s.sourcePath, dir)
+	}
+
+	if err := s.SetPaths([]string{filepath.Join(dir, "docs/report.pdf")}); err != nil {
+		t.Fatal(err)
+	}
+	if s.sourcePath != filepath.Join(dir, "docs") {
+		t.Errorf("base of a single file = %s, want its directory", s.sourcePath)
+	}
+}
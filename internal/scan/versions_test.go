@@ -0,0 +1,82 @@
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeepVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "thesis.txt")
+	if err := os.WriteFile(path, []byte("draft"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scanner, err := NewScanner(dir, filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scanner.Close()
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var id int64
+	var draft string
+	if err := scanner.db.QueryRow("SELECT id, sha256 FROM files WHERE path = ?", path).Scan(&id, &draft); err != nil {
+		t.Fatal(err)
+	}
+	uploaded := time.UnixMilli(1700000000000)
+	if _, err := scanner.db.Exec(`UPDATE files SET uploaded_url = 'https://f000.backblazeb2.com/file/archive/thesis.txt',
+		remote_name = 'thesis.txt', upload_time = ?, upload_sha256 = sha256 WHERE id = ?`, uploaded, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rescanning unchanged content keeps no version
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("final version"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("final version, fixed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := scanner.db.Query("SELECT sha256, size, COALESCE(uploaded_url, ''), upload_time FROM file_versions WHERE file_id = ? ORDER BY id", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type version struct {
+		sha256, url string
+		size        int64
+		uploadTime  *time.Time
+	}
+	var versions []version
+	for rows.Next() {
+		var v version
+		if err := rows.Scan(&v.sha256, &v.size, &v.url, &v.uploadTime); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, v)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("got %d versions, want 2", len(versions))
+	}
+	if versions[0].sha256 != draft || versions[0].size != 5 || versions[0].url == "" ||
+		versions[0].uploadTime == nil || !versions[0].uploadTime.Equal(uploaded) {
+		t.Errorf("first version should be the uploaded draft: %+v", versions[0])
+	}
+	if versions[1].size != int64(len("final version")) || versions[1].url != "" {
+		t.Errorf("second version was never uploaded: %+v", versions[1])
+	}
+}
@@ -0,0 +1,174 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec is a parsed five-field cron expression: minute, hour, day of month,
+// month and day of week
+type Spec struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDom bool
+	anyDow bool
+}
+
+// field describes the valid range of one cron field
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+// shortcuts are the named schedules accepted in place of five fields
+var shortcuts = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+}
+
+// Parse parses a cron expression such as "0 2 * * *" or "*/15 9-17 * * 1-5".
+// Each field accepts *, numbers, ranges, lists and steps; @daily and the
+// other common shortcuts are also accepted.
+func Parse(expr string) (*Spec, error) {
+	expr = strings.TrimSpace(expr)
+	normalized := expr
+	if shortcut, ok := shortcuts[expr]; ok {
+		normalized = shortcut
+	}
+
+	parts := strings.Fields(normalized)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields (minute hour day month weekday)", expr)
+	}
+
+	sets := make([]uint64, len(fields))
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+		}
+		sets[i] = set
+	}
+
+	// Sunday may be written as 0 or 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &Spec{
+		expr:   expr,
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		anyDom: parts[2] == "*",
+		anyDow: parts[4] == "*",
+	}, nil
+}
+
+// parseField parses one comma-separated cron field into a bit set
+func parseField(part string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(part, ",") {
+		rangePart, step := item, 1
+		if before, after, found := strings.Cut(item, "/"); found {
+			n, err := strconv.Atoi(after)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q in %s", after, f.name)
+			}
+			rangePart, step = before, n
+		}
+
+		low, high := f.min, f.max
+		if rangePart != "*" {
+			lowStr, highStr, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(lowStr); err != nil {
+				return 0, fmt.Errorf("bad value %q in %s", lowStr, f.name)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highStr); err != nil {
+					return 0, fmt.Errorf("bad value %q in %s", highStr, f.name)
+				}
+			} else if step > 1 {
+				// "5/15" means every 15 starting at 5
+				high = f.max
+			}
+		}
+
+		if low < f.min || high > f.max || low > high {
+			return 0, fmt.Errorf("%s must be between %d and %d", f.name, f.min, f.max)
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// String returns the expression the spec was parsed from
+func (s *Spec) String() string {
+	return s.expr
+}
+
+// Matches reports whether the spec fires in the minute containing t. As in
+// cron, when both day of month and day of week are restricted either may
+// match.
+func (s *Spec) Matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 ||
+		s.hour&(1<<uint(t.Hour())) == 0 ||
+		s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDom && s.anyDow:
+		return true
+	case s.anyDom:
+		return dowMatch
+	case s.anyDow:
+		return domMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first minute after t at which the spec fires, or the zero
+// time if it never fires within five years (e.g. "0 0 31 2 *")
+func (s *Spec) Next(t time.Time) time.Time {
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	limit := next.AddDate(5, 0, 0)
+	for next.Before(limit) {
+		if s.month&(1<<uint(next.Month())) == 0 {
+			// Skip to the start of the next month
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+			continue
+		}
+		if s.Matches(next) {
+			return next
+		}
+		next = next.Add(time.Minute)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,169 @@
+// Package scratch manages the folder that temporary and intermediate files,
+// such as transcodes and previews, are written to, so that nothing is
+// written next to the files being archived, and checks that the disks
+// written to keep some space free.
+package scratch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDiskFull is wrapped by errors for writes that would leave a disk with
+// less than the minimum free space
+var ErrDiskFull = errors.New("not enough free disk space")
+
+// DefaultMinFree is the space left free on the disks written to unless
+// configured
+const DefaultMinFree = 1 << 30
+
+// prefix names everything created in the scratch folder, so that leftovers
+// of an interrupted run can be found
+const prefix = "archiver-"
+
+var (
+	mu      sync.Mutex
+	dir     string
+	minFree int64 = DefaultMinFree
+	created       = map[string]bool{} // Paths to remove on Cleanup
+)
+
+// Configure sets the scratch folder, the system temporary folder when
+// empty, and the space to leave free on the disks written to, the default
+// when not positive
+func Configure(folder string, keepFree int64) error {
+	if folder != "" {
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			return fmt.Errorf("failed to create scratch folder: %w", err)
+		}
+	}
+	if keepFree <= 0 {
+		keepFree = DefaultMinFree
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	dir = folder
+	minFree = keepFree
+	return nil
+}
+
+// Dir returns the scratch folder
+func Dir() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if dir == "" {
+		return os.TempDir()
+	}
+	return dir
+}
+
+// MinFree returns the space left free on the disks written to
+func MinFree() int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return minFree
+}
+
+// Ensure checks that size bytes can be written below path while leaving
+// MinFree bytes free. Disks whose free space can't be read pass.
+func Ensure(path string, size int64) error {
+	free, err := FreeSpace(path)
+	if err != nil {
+		return nil
+	}
+	if keep := MinFree(); free-size < keep {
+		return fmt.Errorf("%s has %d MB free, %d MB needed leaving %d MB: %w",
+			path, free>>20, size>>20, keep>>20, ErrDiskFull)
+	}
+	return nil
+}
+
+// Create creates a temporary file in the scratch folder, as os.CreateTemp
+// does, after checking that size bytes will fit in it
+func Create(pattern string, size int64) (*os.File, error) {
+	folder := Dir()
+	if err := Ensure(folder, size); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(folder, prefix+pattern)
+	if err != nil {
+		return nil, err
+	}
+	track(file.Name())
+	return file, nil
+}
+
+// Mkdir creates a temporary folder in the scratch folder, as os.MkdirTemp
+// does, after checking that size bytes will fit in it
+func Mkdir(pattern string, size int64) (string, error) {
+	folder := Dir()
+	if err := Ensure(folder, size); err != nil {
+		return "", err
+	}
+	path, err := os.MkdirTemp(folder, prefix+pattern)
+	if err != nil {
+		return "", err
+	}
+	track(path)
+	return path, nil
+}
+
+// Remove removes a file or folder made by Create or Mkdir once it is no
+// longer needed, e.g. after it has been uploaded
+func Remove(path string) error {
+	mu.Lock()
+	delete(created, path)
+	mu.Unlock()
+	return os.RemoveAll(path)
+}
+
+// Cleanup removes everything made by Create or Mkdir that is still there
+func Cleanup() {
+	mu.Lock()
+	paths := created
+	created = map[string]bool{}
+	mu.Unlock()
+
+	for path := range paths {
+		os.RemoveAll(path)
+	}
+}
+
+// RemoveStale removes what runs left in the scratch folder more than age
+// ago, e.g. when they were killed, and returns how many entries it removed
+func RemoveStale(age time.Duration) (int, error) {
+	folder := Dir()
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read scratch folder: %w", err)
+	}
+
+	removed := 0
+	cutoff := time.Now().Add(-age)
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(folder, entry.Name())); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// track records a path to remove on Cleanup
+func track(path string) {
+	mu.Lock()
+	defer mu.Unlock()
+	created[path] = true
+}
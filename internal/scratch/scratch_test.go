@@ -0,0 +1,72 @@
+package scratch
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCreateAndCleanup(t *testing.T) {
+	if err := Configure(t.TempDir(), 0); err != nil {
+		t.Fatal(err)
+	}
+	defer Configure("", 0)
+
+	kept, err := Create("kept-*.mp4", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept.Close()
+	folder, err := Mkdir("whisper-*", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Remove(kept.Name()); err != nil {
+		t.Fatal(err)
+	}
+	Cleanup()
+	for _, path := range []string{kept.Name(), folder} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed: %v", path, err)
+		}
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	if _, err := FreeSpace(os.TempDir()); err != nil {
+		t.Skip("free space not available:", err)
+	}
+	if err := Ensure(os.TempDir(), 1<<62); !errors.Is(err, ErrDiskFull) {
+		t.Errorf("Ensure of 4 EB = %v, want ErrDiskFull", err)
+	}
+}
+
+func TestRemoveStale(t *testing.T) {
+	folder := t.TempDir()
+	if err := Configure(folder, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer Configure("", 0)
+
+	old, _ := Create("old-*", 0)
+	old.Close()
+	recent, _ := Create("recent-*", 0)
+	recent.Close()
+	other, _ := os.CreateTemp(folder, "other-*")
+	other.Close()
+	past := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(old.Name(), past, past)
+	os.Chtimes(other.Name(), past, past)
+
+	removed, err := RemoveStale(24 * time.Hour)
+	if err != nil || removed != 1 {
+		t.Fatalf("RemoveStale = %d, %v; want 1", removed, err)
+	}
+	if _, err := os.Stat(recent.Name()); err != nil {
+		t.Error("recent file was removed")
+	}
+	if _, err := os.Stat(other.Name()); err != nil {
+		t.Error("file not made by a run was removed")
+	}
+}
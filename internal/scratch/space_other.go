@@ -0,0 +1,10 @@
+//go:build !darwin && !linux
+
+package scratch
+
+import "errors"
+
+// FreeSpace can't read free space on this platform
+func FreeSpace(path string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
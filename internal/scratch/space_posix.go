@@ -0,0 +1,15 @@
+//go:build darwin || linux
+
+package scratch
+
+import "syscall"
+
+// FreeSpace returns the bytes available to this user on the disk holding
+// path
+func FreeSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
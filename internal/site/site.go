@@ -0,0 +1,222 @@
+package site
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/manifest"
+)
+
+// DefaultPageSize is the number of entries per page
+const DefaultPageSize = 100
+
+// Options configures a site export
+type Options struct {
+	Title    string
+	PageSize int
+	Header   manifest.Header
+
+	// StreamURL, if set, returns a URL for playing a video entry in the
+	// page, such as a time-limited download URL. Videos get no player when
+	// it returns an empty URL.
+	StreamURL func(entry manifest.Entry) (string, error)
+
+	// Private keeps the full paths and the summaries of the entries. Without
+	// it, as for a site others can see, the paths are made relative to their
+	// source and the summaries left out.
+	Private bool
+}
+
+// Catalog is written to catalog.json and describes the whole export
+type Catalog struct {
+	Manifest    manifest.Header `json:"_manifest"`
+	Title       string          `json:"title"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Total       int             `json:"total"`
+	PageSize    int             `json:"page_size"`
+	Pages       int             `json:"pages"`
+	Tags        map[string]int  `json:"tags,omitempty"` // Number of entries per tag
+}
+
+// Page is written to pages/<n>.json
+type Page struct {
+	Page    int               `json:"page"`
+	Entries []manifest.Entry  `json:"entries"`
+	Streams map[string]string `json:"streams,omitempty"` // Stream URL by entry path
+}
+
+// Writer writes a static catalog browser into a directory: catalog.json and
+// index.html, plus pages/<n>.json and pages/<n>.html for each page of
+// entries. The HTML needs no JavaScript or server, so the directory can be
+// hosted anywhere or opened from disk.
+type Writer struct {
+	dir     string
+	opts    Options
+	catalog Catalog
+	pending []manifest.Entry
+	streams map[string]string
+}
+
+// NewWriter creates a site writer, creating dir if needed
+func NewWriter(dir string, opts Options) (*Writer, error) {
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultPageSize
+	}
+	if opts.Title == "" {
+		opts.Title = "Archive"
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "pages"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create site directory: %w", err)
+	}
+
+	return &Writer{
+		dir:  dir,
+		opts: opts,
+		catalog: Catalog{
+			Manifest:    opts.Header,
+			Title:       opts.Title,
+			GeneratedAt: time.Now().UTC(),
+			PageSize:    opts.PageSize,
+			Tags:        make(map[string]int),
+		},
+	}, nil
+}
+
+// Write adds an entry. A page is written once the entry after it arrives,
+// so each page knows whether another follows.
+func (w *Writer) Write(entry manifest.Entry) error {
+	if !w.opts.Private {
+		entry = public(entry)
+	}
+	if len(w.pending) == w.opts.PageSize {
+		if err := w.flushPage(true); err != nil {
+			return err
+		}
+	}
+
+	if w.opts.StreamURL != nil && strings.HasPrefix(entry.ContentType, "video/") && entry.UploadedURL != "" {
+		streamURL, err := w.opts.StreamURL(entry)
+		if err != nil {
+			return fmt.Errorf("stream URL for %s: %w", entry.Path, err)
+		}
+		if streamURL != "" {
+			if w.streams == nil {
+				w.streams = make(map[string]string)
+			}
+			w.streams[entry.Path] = streamURL
+		}
+	}
+
+	w.pending = append(w.pending, entry)
+	w.catalog.Total++
+	for _, tag := range entry.Tags {
+		w.catalog.Tags[tag]++
+	}
+	return nil
+}
+
+// public returns entry without what a visitor of the site shouldn't see:
+// the folders above its source, and its summary
+func public(entry manifest.Entry) manifest.Entry {
+	if entry.RelativePath == "" || filepath.IsAbs(entry.RelativePath) {
+		entry.RelativePath = filepath.Base(entry.Path)
+	}
+	entry.Path = entry.RelativePath
+	entry.Summary = ""
+	return entry
+}
+
+// Close writes the last page, catalog.json and index.html
+func (w *Writer) Close() error {
+	if len(w.pending) > 0 {
+		if err := w.flushPage(false); err != nil {
+			return err
+		}
+	}
+
+	if err := writeJSON(filepath.Join(w.dir, "catalog.json"), w.catalog); err != nil {
+		return err
+	}
+	return w.writeHTML("index.html", indexTemplate, indexData{
+		Catalog: w.catalog,
+		Pages:   pageNumbers(w.catalog.Pages),
+		Tags:    sortedTags(w.catalog.Tags),
+	})
+}
+
+// flushPage writes the pending entries as the next page
+func (w *Writer) flushPage(hasNext bool) error {
+	w.catalog.Pages++
+	page := Page{Page: w.catalog.Pages, Entries: w.pending, Streams: w.streams}
+	w.pending = nil
+	w.streams = nil
+
+	name := strconv.Itoa(page.Page)
+	if err := writeJSON(filepath.Join(w.dir, "pages", name+".json"), page); err != nil {
+		return err
+	}
+	return w.writeHTML(filepath.Join("pages", name+".html"), pageTemplate, pageData{
+		Title:   w.opts.Title,
+		Page:    page,
+		HasNext: hasNext,
+	})
+}
+
+// writeHTML renders a template into a file under the site directory
+func (w *Writer) writeHTML(name string, tmpl *template.Template, data interface{}) error {
+	file, err := os.Create(filepath.Join(w.dir, name))
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(file, data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return file.Close()
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// tagCount is a tag and the number of entries carrying it
+type tagCount struct {
+	Tag   string
+	Count int
+}
+
+// sortedTags orders tags by count, then name
+func sortedTags(tags map[string]int) []tagCount {
+	counts := make([]tagCount, 0, len(tags))
+	for tag, count := range tags {
+		counts = append(counts, tagCount{tag, count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Tag < counts[j].Tag
+	})
+	return counts
+}
+
+// pageNumbers returns 1..n
+func pageNumbers(n int) []int {
+	pages := make([]int, n)
+	for i := range pages {
+		pages[i] = i + 1
+	}
+	return pages
+}
@@ -0,0 +1,132 @@
+package site
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jth/archiver/internal/manifest"
+)
+
+func TestWriterPages(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewWriter(dir, Options{Title: "Family", PageSize: 2, Header: manifest.NewHeader("bucket")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/a/1.jpg", "/a/2.jpg", "/a/<3>.jpg"} {
+		if err := writer.Write(manifest.Entry{Path: path, Tags: []string{"family"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var catalog Catalog
+	data, err := os.ReadFile(filepath.Join(dir, "catalog.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		t.Fatal(err)
+	}
+	if catalog.Total != 3 || catalog.Pages != 2 || catalog.Tags["family"] != 3 || catalog.Manifest.Namespace != "bucket" {
+		t.Errorf("unexpected catalog %+v", catalog)
+	}
+
+	first, err := os.ReadFile(filepath.Join(dir, "pages", "1.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(first), `href="2.html"`) {
+		t.Error("page 1 should link to page 2")
+	}
+
+	last, err := os.ReadFile(filepath.Join(dir, "pages", "2.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(last), `href="3.html"`) {
+		t.Error("last page should not link to a next page")
+	}
+	if !strings.Contains(string(last), "&lt;3&gt;.jpg") {
+		t.Error("file names should be escaped")
+	}
+}
+
+func TestWriterStreams(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewWriter(dir, Options{
+		StreamURL: func(entry manifest.Entry) (string, error) {
+			return entry.UploadedURL + "?Authorization=token", nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []manifest.Entry{
+		{Path: "/v/clip.mp4", ContentType: "video/mp4", UploadedURL: "https://f000.example/file/b/clip.mp4"},
+		{Path: "/v/photo.jpg", ContentType: "image/jpeg", UploadedURL: "https://f000.example/file/b/photo.jpg"},
+	}
+	for _, entry := range entries {
+		if err := writer.Write(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	html, err := os.ReadFile(filepath.Join(dir, "pages", "1.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), `<video controls preload="none" src="https://f000.example/file/b/clip.mp4?Authorization=token">`) {
+		t.Error("the video should get a player with its stream URL")
+	}
+	if strings.Count(string(html), "<video") != 1 {
+		t.Error("only videos should get a player")
+	}
+}
+
+func TestWriterPublic(t *testing.T) {
+	entry := manifest.Entry{Path: "/Users/ann/Drive/Taxes/2019.pdf", RelativePath: "Taxes/2019.pdf", Summary: "Ann's 2019 return"}
+	for _, private := range []bool{false, true} {
+		dir := t.TempDir()
+		writer, err := NewWriter(dir, Options{Private: private})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Write(entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var page Page
+		data, err := os.ReadFile(filepath.Join(dir, "pages", "1.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &page); err != nil {
+			t.Fatal(err)
+		}
+		html, err := os.ReadFile(filepath.Join(dir, "pages", "1.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := page.Entries[0]
+		switch {
+		case private && (got.Path != entry.Path || got.Summary != entry.Summary):
+			t.Errorf("private entry = %+v, want it whole", got)
+		case !private && (got.Path != "Taxes/2019.pdf" || got.Summary != ""):
+			t.Errorf("public entry = %+v, want the relative path and no summary", got)
+		case !private && (strings.Contains(string(html), "/Users/ann") || strings.Contains(string(html), "2019 return")):
+			t.Errorf("public page shows the path or summary:\n%s", html)
+		}
+	}
+}
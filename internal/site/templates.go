@@ -0,0 +1,116 @@
+package site
+
+import (
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/jth/archiver/internal/manifest"
+)
+
+// indexData is rendered by indexTemplate
+type indexData struct {
+	Catalog Catalog
+	Pages   []int
+	Tags    []tagCount
+}
+
+// pageData is rendered by pageTemplate
+type pageData struct {
+	Title   string
+	Page    Page
+	HasNext bool
+}
+
+var funcs = template.FuncMap{
+	"size": formatSize,
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	},
+	"name": func(entry manifest.Entry) string {
+		if entry.RelativePath != "" {
+			return entry.RelativePath
+		}
+		return entry.Path
+	},
+	"inc": func(n int) int { return n + 1 },
+	"dec": func(n int) int { return n - 1 },
+}
+
+const style = `<style>
+body { font-family: -apple-system, system-ui, sans-serif; margin: 2em auto; max-width: 72em; padding: 0 1em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; vertical-align: top; padding: .4em .6em; border-bottom: 1px solid #ddd; }
+td.size { white-space: nowrap; text-align: right; }
+.summary { color: #555; font-size: .9em; }
+.tag { display: inline-block; background: #eef; border-radius: 3px; padding: 0 .4em; margin: 0 .2em .2em 0; font-size: .85em; }
+video { max-width: 32em; width: 100%; margin-top: .3em; }
+nav { margin: 1em 0; }
+nav a { margin-right: .6em; }
+</style>`
+
+var indexTemplate = template.Must(template.New("index").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Catalog.Title}}</title>
+` + style + `
+</head>
+<body>
+<h1>{{.Catalog.Title}}</h1>
+<p>{{.Catalog.Total}} files, generated {{date .Catalog.GeneratedAt}}.
+Machine-readable: <a href="catalog.json">catalog.json</a> and <code>pages/&lt;n&gt;.json</code>.</p>
+{{if .Tags}}<h2>Tags</h2>
+<p>{{range .Tags}}<span class="tag">{{.Tag}} ({{.Count}})</span>{{end}}</p>{{end}}
+<h2>Pages</h2>
+<nav>{{range .Pages}}<a href="pages/{{.}}.html">{{.}}</a>{{else}}No files.{{end}}</nav>
+</body>
+</html>
+`))
+
+var pageTemplate = template.Must(template.New("page").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}: page {{.Page.Page}}</title>
+` + style + `
+</head>
+<body>
+<h1><a href="../index.html">{{.Title}}</a>: page {{.Page.Page}}</h1>
+{{define "nav"}}<nav>{{if gt .Page.Page 1}}<a href="{{dec .Page.Page}}.html">&larr; Previous</a>{{end}}{{if .HasNext}}<a href="{{inc .Page.Page}}.html">Next &rarr;</a>{{end}}</nav>{{end}}
+{{template "nav" .}}
+<table>
+<tr><th>File</th><th>Size</th><th>Modified</th><th>Type</th></tr>
+{{range .Page.Entries}}<tr>
+<td>{{if .UploadedURL}}<a href="{{.UploadedURL}}">{{name .}}</a>{{else}}{{name .}}{{end}}
+{{if .Tags}}<br>{{range .Tags}}<span class="tag">{{.}}</span>{{end}}{{end}}
+{{with index $.Page.Streams .Path}}<br><video controls preload="none" src="{{.}}"></video>{{end}}
+{{if .Summary}}<div class="summary">{{.Summary}}</div>{{end}}</td>
+<td class="size">{{size .Size}}</td>
+<td>{{date .ModTime}}</td>
+<td>{{.ContentType}}</td>
+</tr>
+{{end}}</table>
+{{template "nav" .}}
+</body>
+</html>
+`))
+
+// formatSize formats a byte count in binary units
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,240 @@
+// Package stats totals the files in the catalog by extension, content type,
+// directory, modification year and drive
+package stats
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jth/archiver/internal/db"
+	"github.com/jth/archiver/internal/drives"
+)
+
+// Dimensions files are grouped by
+const (
+	ByExtension = "extension"
+	ByType      = "type"
+	ByDirectory = "directory"
+	ByYear      = "year"
+	ByDrive     = "drive"
+)
+
+// Dimensions lists every dimension in report order
+var Dimensions = []string{ByExtension, ByType, ByDirectory, ByYear, ByDrive}
+
+// none is the key of files a dimension doesn't apply to
+const none = "(none)"
+
+// Group totals the files sharing one key of a dimension
+type Group struct {
+	Key   string `json:"key"`
+	Files int64  `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Report is the totals of the files collected, with the groups of each
+// dimension ordered by size, largest first
+type Report struct {
+	Files  int64              `json:"files"`
+	Bytes  int64              `json:"bytes"`
+	Groups map[string][]Group `json:"groups"`
+}
+
+// Options configures a Collector
+type Options struct {
+	// Under limits the report to files under this directory. Directory
+	// groups are relative to it.
+	Under string
+	// Depth is how many levels below Under (or the root) directories are
+	// totalled at; files deeper count toward their ancestor at that depth
+	Depth int
+}
+
+// Collector totals files as they are added
+type Collector struct {
+	opts   Options
+	report Report
+	groups map[string]map[string]*Group
+}
+
+// NewCollector creates a collector
+func NewCollector(opts Options) *Collector {
+	if opts.Depth < 1 {
+		opts.Depth = 1
+	}
+	if opts.Under != "" {
+		opts.Under = strings.TrimSuffix(opts.Under, "/") + "/"
+	}
+	c := &Collector{opts: opts, groups: make(map[string]map[string]*Group)}
+	for _, dim := range Dimensions {
+		c.groups[dim] = make(map[string]*Group)
+	}
+	return c
+}
+
+// Add counts a file, unless it is outside Options.Under
+func (c *Collector) Add(file *db.FileStatus) {
+	if c.opts.Under != "" && !strings.HasPrefix(file.Path, c.opts.Under) {
+		return
+	}
+
+	c.report.Files++
+	c.report.Bytes += file.Size
+	c.add(ByExtension, extension(file.Path), file.Size)
+	c.add(ByType, contentType(file.ContentType), file.Size)
+	c.add(ByDirectory, c.directory(file.Path), file.Size)
+	c.add(ByYear, year(file), file.Size)
+	c.add(ByDrive, orNone(drives.NameFromPath(file.Path)), file.Size)
+}
+
+func (c *Collector) add(dim, key string, size int64) {
+	group := c.groups[dim][key]
+	if group == nil {
+		group = &Group{Key: key}
+		c.groups[dim][key] = group
+	}
+	group.Files++
+	group.Bytes += size
+}
+
+// Report returns the totals of the files added so far
+func (c *Collector) Report() *Report {
+	report := c.report
+	report.Groups = make(map[string][]Group, len(c.groups))
+	for dim, groups := range c.groups {
+		list := make([]Group, 0, len(groups))
+		for _, group := range groups {
+			list = append(list, *group)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Bytes != list[j].Bytes {
+				return list[i].Bytes > list[j].Bytes
+			}
+			return list[i].Key < list[j].Key
+		})
+		report.Groups[dim] = list
+	}
+	return &report
+}
+
+// directory returns the ancestor of path at the configured depth, or its
+// own directory if that is shallower. Files adopted from a bucket are
+// grouped by bucket.
+func (c *Collector) directory(path string) string {
+	if scheme, rest, ok := strings.Cut(path, "://"); ok {
+		bucket, _, _ := strings.Cut(rest, "/")
+		return scheme + "://" + bucket
+	}
+
+	root := c.opts.Under
+	if root == "" {
+		root = "/"
+	}
+	rel := strings.TrimPrefix(path, root)
+	parts := strings.Split(rel, "/")
+	parts = parts[:len(parts)-1] // The file name
+	if len(parts) > c.opts.Depth {
+		parts = parts[:c.opts.Depth]
+	}
+	if len(parts) == 0 {
+		return strings.TrimSuffix(root, "/") + "/"
+	}
+	return root + strings.Join(parts, "/")
+}
+
+// extension returns the lower-case extension of path
+func extension(path string) string {
+	return orNone(strings.ToLower(filepath.Ext(path)))
+}
+
+// contentType returns a content type without its parameters
+func contentType(value string) string {
+	if mediaType, _, err := mime.ParseMediaType(value); err == nil {
+		return mediaType
+	}
+	return orNone(value)
+}
+
+// year returns the modification year of a file
+func year(file *db.FileStatus) string {
+	if file.ModTime.IsZero() {
+		return none
+	}
+	return strconv.Itoa(file.ModTime.Year())
+}
+
+func orNone(key string) string {
+	if key == "" {
+		return none
+	}
+	return key
+}
+
+// WriteText writes the report as tables, one per dimension, listing at
+// most limit groups each (0 for all) with their share of the bytes
+func WriteText(w io.Writer, report *Report, dims []string, limit int) error {
+	fmt.Fprintf(w, "%d files, %s\n", report.Files, formatSize(report.Bytes))
+	for _, dim := range dims {
+		groups := report.Groups[dim]
+		fmt.Fprintf(w, "\nBy %s:\n", dim)
+		for i, group := range groups {
+			if limit > 0 && i == limit {
+				fmt.Fprintf(w, "  ... %d more\n", len(groups)-i)
+				break
+			}
+			share := 0.0
+			if report.Bytes > 0 {
+				share = float64(group.Bytes) / float64(report.Bytes)
+			}
+			fmt.Fprintf(w, "  %10s %5.1f%% [%-20s] %8d  %s\n", formatSize(group.Bytes), share*100,
+				strings.Repeat("#", int(share*20+0.5)), group.Files, group.Key)
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the report as JSON, with only the given dimensions
+func WriteJSON(w io.Writer, report *Report, dims []string) error {
+	out := *report
+	out.Groups = make(map[string][]Group, len(dims))
+	for _, dim := range dims {
+		out.Groups[dim] = report.Groups[dim]
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// WriteCSV writes the report as CSV rows of dimension, key, files and bytes
+func WriteCSV(w io.Writer, report *Report, dims []string) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"dimension", "key", "files", "bytes"})
+	for _, dim := range dims {
+		for _, group := range report.Groups[dim] {
+			writer.Write([]string{dim, group.Key, strconv.FormatInt(group.Files, 10), strconv.FormatInt(group.Bytes, 10)})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatSize formats a byte count in binary units
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,73 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+func TestCollector(t *testing.T) {
+	files := []*db.FileStatus{
+		{Path: "/Volumes/A/Photos/2019/beach.JPG", Size: 300, ContentType: "image/jpeg", ModTime: time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{Path: "/Volumes/A/Photos/2020/snow.jpg", Size: 200, ContentType: "image/jpeg", ModTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Path: "/Volumes/A/Docs/notes.txt", Size: 50, ContentType: "text/plain; charset=utf-8", ModTime: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{Path: "/Volumes/A/README", Size: 10},
+		{Path: "b2://archive/old/tape.mov", Size: 1000, ContentType: "video/quicktime"},
+	}
+
+	c := NewCollector(Options{Depth: 3})
+	for _, file := range files {
+		c.Add(file)
+	}
+	report := c.Report()
+	if report.Files != 5 || report.Bytes != 1560 {
+		t.Fatalf("got %d files, %d bytes", report.Files, report.Bytes)
+	}
+
+	want := map[string]Group{
+		ByExtension: {Key: ".jpg", Files: 2, Bytes: 500},
+		ByType:      {Key: "image/jpeg", Files: 2, Bytes: 500},
+		ByDirectory: {Key: "/Volumes/A/Photos", Files: 2, Bytes: 500},
+		ByYear:      {Key: "2019", Files: 1, Bytes: 300},
+		ByDrive:     {Key: "A", Files: 4, Bytes: 560},
+	}
+	for dim, group := range want {
+		if !containsGroup(report.Groups[dim], group) {
+			t.Errorf("%s: missing %+v in %+v", dim, group, report.Groups[dim])
+		}
+	}
+	if got := report.Groups[ByDirectory][0].Key; got != "b2://archive" {
+		t.Errorf("largest directory should be the bucket, got %s", got)
+	}
+	if !containsGroup(report.Groups[ByType], Group{Key: "text/plain", Files: 1, Bytes: 50}) {
+		t.Errorf("content type parameters should be dropped: %+v", report.Groups[ByType])
+	}
+
+	c = NewCollector(Options{Under: "/Volumes/A/Photos", Depth: 1})
+	for _, file := range files {
+		c.Add(file)
+	}
+	report = c.Report()
+	if report.Files != 2 || report.Groups[ByDirectory][0].Key != "/Volumes/A/Photos/2019" {
+		t.Errorf("--under should total the subtree's children, got %+v", report.Groups[ByDirectory])
+	}
+
+	var out strings.Builder
+	if err := WriteCSV(&out, report, []string{ByYear}); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "dimension,key,files,bytes\nyear,2019,1,300\nyear,2020,1,200\n" {
+		t.Errorf("unexpected CSV:\n%s", got)
+	}
+}
+
+func containsGroup(groups []Group, want Group) bool {
+	for _, group := range groups {
+		if group == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,252 @@
+package summariser
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrOverCap is returned by Caption when every vision model is over a cost
+// cap, so that callers can stop captioning rather than fail each photo
+var ErrOverCap = errors.New("over the cost caps")
+
+// Caption is a one-line description of a photo
+type Caption struct {
+	Text      string
+	Model     string
+	Provider  string
+	Cost      float64
+	CreatedAt time.Time
+}
+
+// captionPrompt asks for a caption short enough to read in search results
+const captionPrompt = `Describe this photo in one short line of plain text, such as "two kids on a beach at sunset". ` +
+	`Mention the people, animals, objects, place and activity you can see. Reply with the description only.`
+
+// A low-detail image is billed as a fixed number of input tokens, and a
+// caption is a few dozen tokens
+const (
+	captionImageTokens = 2833
+	captionTokens      = 40
+)
+
+// DefaultVisionModels returns the models that can caption photos: LLaVA run
+// locally by Ollama and OpenAI's smallest vision model
+func DefaultVisionModels() []Model {
+	return []Model{
+		{
+			Name:         "llava",
+			Provider:     "ollama",
+			CostPer1KIn:  0.0,
+			CostPer1KOut: 0.0,
+			MaxTokens:    4096,
+		},
+		{
+			Name:         "gpt-4o-mini",
+			Provider:     "openai",
+			CostPer1KIn:  0.00015,
+			CostPer1KOut: 0.0006,
+			MaxTokens:    128000,
+		},
+	}
+}
+
+// CanCaption reports whether any vision model is available
+func (s *Summariser) CanCaption() bool {
+	for _, model := range s.config.VisionModels {
+		if model.Available {
+			return true
+		}
+	}
+	return false
+}
+
+// Caption describes a JPEG or PNG image in one line, with the cheapest
+// available vision model that is within the cost caps. Captions count
+// against the same caps as summaries.
+func (s *Summariser) Caption(ctx context.Context, image []byte, mimeType string) (*Caption, error) {
+	var models []Model
+	for _, model := range s.config.VisionModels {
+		if model.Available {
+			models = append(models, model)
+		}
+	}
+	if len(models) == 0 {
+		return nil, errors.New("no vision models available for captioning")
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].CostPer1KOut < models[j].CostPer1KOut
+	})
+
+	var err error
+	var capped string
+	for _, model := range models {
+		expectedCost := captionCost(model, captionImageTokens+estimateTokenCount(captionPrompt), captionTokens)
+		if reason := s.overCap(expectedCost, model); reason != "" {
+			capped = reason
+			continue
+		}
+
+		var text string
+		var inputTokens, outputTokens int
+		switch model.Provider {
+		case "ollama":
+			text, err = captionWithOllama(ctx, model.Name, image)
+		case "openai":
+			text, inputTokens, outputTokens, err = captionWithOpenAI(ctx, model.Name, image, mimeType)
+		default:
+			err = fmt.Errorf("%s models can't caption images", model.Provider)
+		}
+		if err != nil {
+			s.log.Warn("captioning failed", "model", model.Name, "error", err)
+			continue
+		}
+		text = cleanCaption(text)
+		if text == "" {
+			err = fmt.Errorf("%s returned an empty caption", model.Name)
+			continue
+		}
+
+		if inputTokens == 0 {
+			inputTokens = captionImageTokens + estimateTokenCount(captionPrompt)
+			outputTokens = estimateTokenCount(text)
+		}
+		cost := captionCost(model, inputTokens, outputTokens)
+		s.costTracker.AddCost(cost, model)
+		return &Caption{
+			Text:      text,
+			Model:     model.Name,
+			Provider:  model.Provider,
+			Cost:      cost,
+			CreatedAt: time.Now(),
+		}, nil
+	}
+
+	if err == nil && capped != "" {
+		return nil, fmt.Errorf("every vision model is over the %s: %w", capped, ErrOverCap)
+	}
+	return nil, fmt.Errorf("failed to caption image with any available model: %w", err)
+}
+
+// captionCost returns the cost of a captioning request
+func captionCost(model Model, inputTokens, outputTokens int) float64 {
+	return float64(inputTokens)*model.CostPer1KIn/1000 + float64(outputTokens)*model.CostPer1KOut/1000
+}
+
+// cleanCaption keeps the first line of a model's reply, without quotes or
+// a trailing period
+func cleanCaption(text string) string {
+	text = strings.TrimSpace(text)
+	if line, _, found := strings.Cut(text, "\n"); found {
+		text = strings.TrimSpace(line)
+	}
+	text = strings.Trim(text, `"'`)
+	return strings.TrimSuffix(strings.TrimSpace(text), ".")
+}
+
+// visionClient is shared by the captioning requests; local models can take
+// a while on a large photo
+var visionClient = &http.Client{Timeout: 2 * time.Minute}
+
+// captionWithOllama captions an image with a model served by Ollama, at
+// OLLAMA_HOST or on localhost
+func captionWithOllama(ctx context.Context, model string, image []byte) (string, error) {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		host = "http://localhost:11434"
+	} else if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+
+	var response struct {
+		Response string `json:"response"`
+	}
+	err := postJSON(ctx, strings.TrimSuffix(host, "/")+"/api/generate", nil, map[string]any{
+		"model":  model,
+		"prompt": captionPrompt,
+		"images": []string{base64.StdEncoding.EncodeToString(image)},
+		"stream": false,
+	}, &response)
+	if err != nil {
+		return "", fmt.Errorf("ollama: %w", err)
+	}
+	return response.Response, nil
+}
+
+// captionWithOpenAI captions an image with an OpenAI vision model at low
+// detail, returning the tokens billed
+func captionWithOpenAI(ctx context.Context, model string, image []byte, mimeType string) (string, int, int, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return "", 0, 0, errors.New("OPENAI_API_KEY is not set")
+	}
+
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	dataURL := "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(image)
+	err := postJSON(ctx, "https://api.openai.com/v1/chat/completions", map[string]string{
+		"Authorization": "Bearer " + apiKey,
+	}, map[string]any{
+		"model":      model,
+		"max_tokens": 2 * captionTokens,
+		"messages": []map[string]any{{
+			"role": "user",
+			"content": []map[string]any{
+				{"type": "text", "text": captionPrompt},
+				{"type": "image_url", "image_url": map[string]string{"url": dataURL, "detail": "low"}},
+			},
+		}},
+	}, &response)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("openai: %w", err)
+	}
+	if len(response.Choices) == 0 {
+		return "", 0, 0, errors.New("openai: no caption returned")
+	}
+	return response.Choices[0].Message.Content, response.Usage.PromptTokens, response.Usage.CompletionTokens, nil
+}
+
+// postJSON posts a JSON request and decodes the JSON response into result
+func postJSON(ctx context.Context, url string, header map[string]string, request, result any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := visionClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
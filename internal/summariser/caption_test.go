@@ -0,0 +1,15 @@
+package summariser
+
+import "testing"
+
+func TestCleanCaption(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"Two kids on a beach at sunset.", "Two kids on a beach at sunset"},
+		{"  \"A red car parked in the snow\"\n\nIt looks cold.", "A red car parked in the snow"},
+		{"", ""},
+	} {
+		if got := cleanCaption(tc.in); got != tc.want {
+			t.Errorf("cleanCaption(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package summariser
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Entities are the structured data extracted from a document
+type Entities struct {
+	People        []string `json:"people"`
+	Organizations []string `json:"organizations"`
+	Dates         []string `json:"dates"`
+	Places        []string `json:"places"`
+	DocumentType  string   `json:"document_type"`
+	Keywords      []string `json:"keywords"`
+}
+
+// entitiesMarker separates the summary from the entities in a response
+const entitiesMarker = "ENTITIES:"
+
+// entitiesInstructions asks for the entities after the summary
+const entitiesInstructions = `After the summary, write a line with ` + entitiesMarker + ` followed by a JSON
+object with the keys "people", "organizations", "dates" (YYYY-MM-DD where
+known), "places" and "keywords", each a list of strings, and "document_type",
+a short lowercase label such as "invoice", "letter" or "contract".`
+
+// parseEntities splits a response into the summary and the entities after
+// it. Entities that are missing or not valid JSON are returned as nil.
+func parseEntities(response string) (string, *Entities) {
+	summary, rest, found := strings.Cut(response, entitiesMarker)
+	if !found {
+		return response, nil
+	}
+	summary = strings.TrimSpace(summary)
+
+	// Models often wrap JSON in a code fence
+	rest = strings.TrimSpace(rest)
+	rest = strings.TrimPrefix(rest, "```json")
+	rest = strings.Trim(rest, "`\n ")
+
+	var entities Entities
+	if err := json.Unmarshal([]byte(rest), &entities); err != nil {
+		return summary, nil
+	}
+	entities.DocumentType = strings.ToLower(strings.TrimSpace(entities.DocumentType))
+	for _, list := range []*[]string{&entities.People, &entities.Organizations, &entities.Dates, &entities.Places, &entities.Keywords} {
+		*list = cleanValues(*list)
+	}
+	return summary, &entities
+}
+
+// cleanValues trims values and drops empty and repeated ones
+func cleanValues(values []string) []string {
+	seen := make(map[string]bool)
+	var cleaned []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[strings.ToLower(value)] {
+			continue
+		}
+		seen[strings.ToLower(value)] = true
+		cleaned = append(cleaned, value)
+	}
+	return cleaned
+}
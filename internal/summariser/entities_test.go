@@ -0,0 +1,33 @@
+package summariser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEntities(t *testing.T) {
+	response := "An invoice from Acme Corp for repairs.\n\nENTITIES: ```json\n" +
+		`{"people": ["Jane Doe", " jane doe ", ""], "organizations": ["Acme Corp"], "dates": ["2015-03-01"],` +
+		` "places": [], "document_type": " Invoice", "keywords": ["repairs", "roof"]}` + "\n```"
+
+	summary, entities := parseEntities(response)
+	if summary != "An invoice from Acme Corp for repairs." {
+		t.Errorf("summary = %q", summary)
+	}
+	want := &Entities{
+		People:        []string{"Jane Doe"},
+		Organizations: []string{"Acme Corp"},
+		Dates:         []string{"2015-03-01"},
+		DocumentType:  "invoice",
+		Keywords:      []string{"repairs", "roof"},
+	}
+	if !reflect.DeepEqual(entities, want) {
+		t.Errorf("entities = %+v, want %+v", entities, want)
+	}
+
+	for _, response := range []string{"Just a summary.", "A summary.\nENTITIES: not json"} {
+		if _, entities := parseEntities(response); entities != nil {
+			t.Errorf("parseEntities(%q) = %+v, want nil", response, entities)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package summariser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pingURLs are the endpoints listing a provider's models, which need a valid
+// key but cost nothing
+var pingURLs = map[string]string{
+	"anthropic": "https://api.anthropic.com/v1/models",
+	"openai":    "https://api.openai.com/v1/models",
+	"groq":      "https://api.groq.com/openai/v1/models",
+}
+
+// Ping checks an API key of a provider (anthropic, openai or groq) by listing
+// its models
+func Ping(ctx context.Context, provider, apiKey string) error {
+	endpoint, ok := pingURLs[provider]
+	if !ok {
+		return fmt.Errorf("unknown provider %q", provider)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if provider == "anthropic" {
+		req.Header.Set("x-api-key", apiKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+	} else {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s: %s", provider, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
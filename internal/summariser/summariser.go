@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/jth/archiver/internal/logging"
 )
 
 // Model represents an LLM model
@@ -35,20 +39,49 @@ const (
 	SummaryFull SummaryLevel = "full"
 )
 
+// PromptVersion identifies the prompt templates built by buildPrompt. Bump it
+// whenever the prompts change so summaries can be traced back to them.
+const PromptVersion = "2"
+
 // CostTracker tracks LLM usage costs
 type CostTracker struct {
 	mu       sync.Mutex
 	total    float64
 	costCap  float64
 	perModel map[string]float64
+
+	lifetimeBudget float64 // 0 for no lifetime limit
+	lifetimeSpent  float64 // Spent before this tracker was created
+
+	perProvider   map[string]float64
+	providerCaps  map[string]float64 // Monthly, by provider
+	providerSpent map[string]float64 // Spent this month before this tracker was created
 }
 
 // Config represents the summariser configuration
 type Config struct {
-	Level       SummaryLevel
-	CostCap     float64
-	Concurrency int
-	Models      []Model
+	Level   SummaryLevel
+	CostCap float64
+	// LifetimeBudget caps the spend across all runs, LifetimeSpent of which
+	// earlier runs have used; 0 for no limit
+	LifetimeBudget float64
+	LifetimeSpent  float64
+	// DocumentCap is the most one document may cost; 0 for no limit
+	DocumentCap float64
+	// ProviderCaps caps the monthly spend by provider, ProviderSpent of
+	// which has been used this month
+	ProviderCaps  map[string]float64
+	ProviderSpent map[string]float64
+	// Cache, if set, holds earlier summaries to reuse for identical content
+	Cache Cache
+	// ExtractEntities asks for the people, organizations, dates, places,
+	// document type and keywords of each document along with its summary
+	ExtractEntities bool
+	Concurrency     int
+	Models          []Model
+	// VisionModels caption photos
+	VisionModels []Model
+	Logger       *slog.Logger // Defaults to slog.Default()
 }
 
 // Summary represents a document summary
@@ -60,13 +93,28 @@ type Summary struct {
 	SummaryTokens int
 	Cost          float64
 	Model         string
+	Provider      string
+	Level         SummaryLevel // Below the configured level if it was over a cap
+	PromptVersion string
+	Cached        bool      // Reused from the cache, at no cost
+	Entities      *Entities // Nil unless requested and returned by the model
 	CreatedAt     time.Time
 }
 
+// Cache stores summaries by the SHA-256 of the content summarized, the
+// level and the model family, so that identical content is only paid for
+// once
+type Cache interface {
+	// CachedSummary returns the cached summary, or nil if there is none
+	CachedSummary(hash string, level SummaryLevel, family string) (*Summary, error)
+	CacheSummary(hash, family string, summary *Summary) error
+}
+
 // Summariser handles text summarization
 type Summariser struct {
 	config      Config
 	costTracker *CostTracker
+	log         *slog.Logger
 }
 
 // NewSummariser creates a new summariser
@@ -78,30 +126,42 @@ func NewSummariser(config Config) *Summariser {
 
 	// Initialize cost tracker
 	costTracker := &CostTracker{
-		costCap:  config.CostCap,
-		perModel: make(map[string]float64),
+		costCap:        config.CostCap,
+		perModel:       make(map[string]float64),
+		lifetimeBudget: config.LifetimeBudget,
+		lifetimeSpent:  config.LifetimeSpent,
+		perProvider:    make(map[string]float64),
+		providerCaps:   config.ProviderCaps,
+		providerSpent:  config.ProviderSpent,
+	}
+
+	markAvailable(config.Models)
+	markAvailable(config.VisionModels)
+
+	return &Summariser{
+		config:      config,
+		costTracker: costTracker,
+		log:         logging.OrDefault(config.Logger),
 	}
+}
 
-	// Check environment variables for API keys and mark models as available
-	for i, model := range config.Models {
+// markAvailable checks environment variables for API keys and marks the
+// models they make available
+func markAvailable(models []Model) {
+	for i, model := range models {
 		switch model.Provider {
 		case "openai":
-			config.Models[i].Available = os.Getenv("OPENAI_API_KEY") != ""
+			models[i].Available = os.Getenv("OPENAI_API_KEY") != ""
 		case "anthropic":
-			config.Models[i].Available = os.Getenv("ANTHROPIC_KEY") != ""
+			models[i].Available = os.Getenv("ANTHROPIC_KEY") != ""
 		case "groq":
-			config.Models[i].Available = os.Getenv("GROQ_API_KEY") != ""
+			models[i].Available = os.Getenv("GROQ_API_KEY") != ""
 		case "ollama":
 			// Check if ollama is installed
 			_, err := os.Stat("/usr/local/bin/ollama")
-			config.Models[i].Available = err == nil
+			models[i].Available = err == nil
 		}
 	}
-
-	return &Summariser{
-		config:      config,
-		costTracker: costTracker,
-	}
 }
 
 // DefaultConfig returns the default configuration
@@ -140,11 +200,23 @@ func DefaultConfig() Config {
 				MaxTokens:    16384,
 			},
 		},
+		VisionModels: DefaultVisionModels(),
 	}
 }
 
 // Summarise summarizes text
 func (s *Summariser) Summarise(ctx context.Context, title, text string) (*Summary, error) {
+	return s.SummariseContent(ctx, "", title, text)
+}
+
+// ErrBudgetReached is returned by SummariseContent once the cost cap or the
+// lifetime budget is spent, so that callers can stop summarizing rather
+// than fail each document
+var ErrBudgetReached = errors.New("spending limit reached")
+
+// SummariseContent summarizes the text of content with the given SHA-256,
+// reusing a cached summary of the same content if there is one
+func (s *Summariser) SummariseContent(ctx context.Context, hash, title, text string) (*Summary, error) {
 	if s.config.Level == SummaryNone {
 		return &Summary{
 			Title:         title,
@@ -154,6 +226,7 @@ func (s *Summariser) Summarise(ctx context.Context, title, text string) (*Summar
 			SummaryTokens: 0,
 			Cost:          0,
 			Model:         "none",
+			Level:         SummaryNone,
 			CreatedAt:     time.Now(),
 		}, nil
 	}
@@ -170,9 +243,23 @@ func (s *Summariser) Summarise(ctx context.Context, title, text string) (*Summar
 		return nil, errors.New("no LLM models available for summarization")
 	}
 
+	// Use the waterfall approach to find the right model
+	// Start with the cheapest model
+	sort.Slice(availableModels, func(i, j int) bool {
+		return availableModels[i].CostPer1KOut < availableModels[j].CostPer1KOut
+	})
+
+	// Cached summaries cost nothing, so they are used even over budget
+	if summary := s.cached(hash, availableModels); summary != nil {
+		return summary, nil
+	}
+
 	// Check if we're under the cost cap
 	if !s.costTracker.CheckBudget(0.01) { // Check with minimum budget
-		return nil, fmt.Errorf("cost cap of $%.2f has been reached", s.config.CostCap)
+		if s.costTracker.lifetimeExceeded(0.01) {
+			return nil, fmt.Errorf("%w: lifetime budget of $%.2f", ErrBudgetReached, s.config.LifetimeBudget)
+		}
+		return nil, fmt.Errorf("%w: cost cap of $%.2f", ErrBudgetReached, s.config.CostCap)
 	}
 
 	// Truncate text if it's too long for any model
@@ -189,41 +276,149 @@ func (s *Summariser) Summarise(ctx context.Context, title, text string) (*Summar
 		sourceTokens = estimateTokenCount(text)
 	}
 
-	// Use the waterfall approach to find the right model
-	// Start with the cheapest model
-	sort.Slice(availableModels, func(i, j int) bool {
-		return availableModels[i].CostPer1KOut < availableModels[j].CostPer1KOut
-	})
-
+	// A document over a cap at the configured level is summarized more
+	// briefly rather than not at all
 	var summary *Summary
 	var err error
+	var capped string
+	for _, level := range fallbackLevels(s.config.Level) {
+		prompt := buildPrompt(title, text, level, s.config.ExtractEntities)
+		for _, model := range availableModels {
+			// Check if we can afford this model
+			expectedCost := estimateCost(prompt, level, model)
+			if reason := s.overCap(expectedCost, model); reason != "" {
+				capped = reason
+				s.log.Debug("model over "+reason, "title", title, "model", model.Name, "level", level, "expected_cost", expectedCost)
+				continue
+			}
+
+			// Try to summarize with this model
+			summary, err = s.summarizeWithModel(ctx, title, text, sourceTokens, model, level)
+			if err == nil {
+				if level != s.config.Level {
+					s.log.Info("summarized at a lower level to stay under the cost caps", "title", title,
+						"model", model.Name, "level", level, "configured_level", s.config.Level)
+				}
+				s.log.Debug("summarized", "title", title, "model", model.Name,
+					"source_tokens", sourceTokens, "cost", summary.Cost)
+				s.cache(hash, model, summary)
+				return summary, nil
+			}
+			s.log.Warn("summarization failed", "title", title, "model", model.Name, "error", err)
+		}
+	}
 
-	for _, model := range availableModels {
-		// Calculate expected cost
-		expectedCost := calculateCost(text, "", model)
+	if summary != nil {
+		return summary, nil
+	}
+	if err == nil && capped != "" {
+		return nil, fmt.Errorf("every model is over the %s, even at the %s level", capped, SummaryBasic)
+	}
+
+	return nil, errors.New("failed to summarize text with any available model")
+}
 
-		// Check if we can afford this model
-		if !s.costTracker.CheckBudget(expectedCost) {
-			continue
+// cached returns the cached summary of content at the configured level by
+// the first of the models' families that has one, or nil
+func (s *Summariser) cached(hash string, models []Model) *Summary {
+	if s.config.Cache == nil || hash == "" {
+		return nil
+	}
+	for _, model := range models {
+		summary, err := s.config.Cache.CachedSummary(hash, s.config.Level, Family(model))
+		if err != nil {
+			s.log.Warn("could not read the summary cache", "sha256", hash, "error", err)
+			return nil
+		}
+		// A summary cached without entities is made again to get them
+		if summary != nil && (summary.Entities != nil || !s.config.ExtractEntities) {
+			summary.Cost = 0
+			summary.Cached = true
+			s.log.Debug("reused cached summary", "sha256", hash, "model", summary.Model)
+			return summary
 		}
+	}
+	return nil
+}
+
+// cache stores a summary of content in the cache, if there is one
+func (s *Summariser) cache(hash string, model Model, summary *Summary) {
+	if s.config.Cache == nil || hash == "" {
+		return
+	}
+	if err := s.config.Cache.CacheSummary(hash, Family(model), summary); err != nil {
+		s.log.Warn("could not cache summary", "sha256", hash, "error", err)
+	}
+}
+
+// datedSuffix matches a trailing date written with dashes, as in
+// gpt-4o-2024-08-06, which is one version rather than three segments
+var datedSuffix = regexp.MustCompile(`.-\d{4}-\d{2}-\d{2}$`)
+
+// Family returns the family of a model, which its summaries are cached
+// under: the provider and the model name without a trailing date or
+// version, so that e.g. claude-3-haiku-20240307 and claude-3-haiku-20240620
+// share summaries
+func Family(model Model) string {
+	name := model.Name
+	if loc := datedSuffix.FindStringIndex(name); loc != nil {
+		name = name[:loc[0]+1]
+	}
+	parts := strings.Split(name, "-")
+	for len(parts) > 1 && isVersion(parts[len(parts)-1]) {
+		parts = parts[:len(parts)-1]
+	}
+	return model.Provider + "/" + strings.Join(parts, "-")
+}
 
-		// Try to summarize with this model
-		summary, err = s.summarizeWithModel(ctx, title, text, sourceTokens, model)
-		if err == nil {
-			return summary, nil
+// isVersion reports whether a model name segment is a date or version such
+// as 20240307, 0613, v2 or latest
+func isVersion(segment string) bool {
+	if segment == "latest" {
+		return true
+	}
+	digits := strings.TrimPrefix(segment, "v")
+	if len(digits) < 4 && digits == segment {
+		return false // Short numbers such as the 4 of gpt-4 name the model
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return false
 		}
 	}
+	return digits != ""
+}
 
-	if summary != nil {
-		return summary, nil
+// overCap returns which cap a request of a model would exceed, or "" if it
+// is within all of them
+func (s *Summariser) overCap(cost float64, model Model) string {
+	switch {
+	case s.config.DocumentCap > 0 && cost > s.config.DocumentCap:
+		return "document cap"
+	case !s.costTracker.CheckProvider(cost, model.Provider):
+		return "monthly cap of " + model.Provider
+	case !s.costTracker.CheckBudget(cost):
+		return "budget"
 	}
+	return ""
+}
 
-	return nil, errors.New("failed to summarize text with any available model")
+// fallbackLevels returns the level and the briefer levels below it, to try
+// in turn
+func fallbackLevels(level SummaryLevel) []SummaryLevel {
+	switch level {
+	case SummaryFull:
+		return []SummaryLevel{SummaryFull, SummaryDefault, SummaryBasic}
+	case SummaryDefault:
+		return []SummaryLevel{SummaryDefault, SummaryBasic}
+	}
+	return []SummaryLevel{level}
 }
 
 // summarizeWithModel summarizes text using a specific model
-func (s *Summariser) summarizeWithModel(ctx context.Context, title, text string, sourceTokens int, model Model) (*Summary, error) {
-	prompt := buildPrompt(title, text, s.config.Level)
+func (s *Summariser) summarizeWithModel(ctx context.Context, title, text string, sourceTokens int, model Model,
+	level SummaryLevel) (*Summary, error) {
+	prompt := buildPrompt(title, text, level, s.config.ExtractEntities)
 
 	var summaryText string
 	var err error
@@ -246,11 +441,15 @@ func (s *Summariser) summarizeWithModel(ctx context.Context, title, text string,
 	}
 
 	// Calculate actual cost
-	summaryTokens := estimateTokenCount(summaryText)
 	cost := calculateCost(prompt, summaryText, model)
+	var entities *Entities
+	if s.config.ExtractEntities {
+		summaryText, entities = parseEntities(summaryText)
+	}
+	summaryTokens := estimateTokenCount(summaryText)
 
 	// Track cost
-	s.costTracker.AddCost(cost, model.Name)
+	s.costTracker.AddCost(cost, model)
 
 	return &Summary{
 		Title:         title,
@@ -260,10 +459,25 @@ func (s *Summariser) summarizeWithModel(ctx context.Context, title, text string,
 		SummaryTokens: summaryTokens,
 		Cost:          cost,
 		Model:         model.Name,
+		Provider:      model.Provider,
+		Level:         level,
+		PromptVersion: PromptVersion,
+		Entities:      entities,
 		CreatedAt:     time.Now(),
 	}, nil
 }
 
+// Models returns the configured models, with Available set for those whose
+// provider is usable on this machine
+func (s *Summariser) Models() []Model {
+	return append([]Model(nil), s.config.Models...)
+}
+
+// Level returns the configured summary level
+func (s *Summariser) Level() SummaryLevel {
+	return s.config.Level
+}
+
 // GetTotalCost returns the total cost incurred
 func (s *Summariser) GetTotalCost() float64 {
 	return s.costTracker.GetTotal()
@@ -275,20 +489,44 @@ func (s *Summariser) GetRemainingBudget() float64 {
 }
 
 // AddCost adds cost to the tracker
-func (c *CostTracker) AddCost(cost float64, model string) {
+func (c *CostTracker) AddCost(cost float64, model Model) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	c.total += cost
-	c.perModel[model] += cost
+	c.perModel[model.Name] += cost
+	c.perProvider[model.Provider] += cost
 }
 
-// CheckBudget checks if a cost can be accommodated within the budget
+// CheckProvider checks if a cost can be accommodated within the monthly cap
+// of a provider, if it has one
+func (c *CostTracker) CheckProvider(cost float64, provider string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	limit, ok := c.providerCaps[provider]
+	return !ok || c.providerSpent[provider]+c.perProvider[provider]+cost <= limit
+}
+
+// CheckBudget checks if a cost can be accommodated within the budget and
+// the lifetime budget
 func (c *CostTracker) CheckBudget(cost float64) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	return c.total+cost <= c.costCap
+	return c.total+cost <= c.costCap && !c.overLifetime(cost)
+}
+
+// lifetimeExceeded reports whether a cost would exceed the lifetime budget
+func (c *CostTracker) lifetimeExceeded(cost float64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.overLifetime(cost)
+}
+
+func (c *CostTracker) overLifetime(cost float64) bool {
+	return c.lifetimeBudget > 0 && c.lifetimeSpent+c.total+cost > c.lifetimeBudget
 }
 
 // GetTotal returns the total cost
@@ -320,6 +558,19 @@ func calculateCost(input, output string, model Model) float64 {
 	return inputCost + outputCost
 }
 
+// summaryTokens is roughly how long a summary at each level is, to estimate
+// the cost of a request before making it
+var summaryTokens = map[SummaryLevel]int{
+	SummaryBasic:   100,
+	SummaryDefault: 300,
+	SummaryFull:    800,
+}
+
+// estimateCost estimates the cost of summarizing with a prompt at a level
+func estimateCost(prompt string, level SummaryLevel, model Model) float64 {
+	return calculateCost(prompt, "", model) + float64(summaryTokens[level])*model.CostPer1KOut/1000
+}
+
 // estimateTokenCount estimates the number of tokens in a text
 // This is a very rough estimate; in production, you'd use a proper tokenizer
 func estimateTokenCount(text string) int {
@@ -342,8 +593,9 @@ func truncateText(text string, maxTokens int) string {
 	return strings.Join(words[:estimatedWordCount], " ") + "..."
 }
 
-// buildPrompt builds a prompt for the summarization task
-func buildPrompt(title, text string, level SummaryLevel) string {
+// buildPrompt builds a prompt for the summarization task, asking for the
+// entities of the document after the summary if withEntities is set
+func buildPrompt(title, text string, level SummaryLevel, withEntities bool) string {
 	var instructions string
 
 	switch level {
@@ -356,6 +608,9 @@ func buildPrompt(title, text string, level SummaryLevel) string {
 	default:
 		instructions = "Provide a concise summary that captures the key points and main ideas."
 	}
+	if withEntities {
+		instructions += " " + entitiesInstructions
+	}
 
 	return fmt.Sprintf(`Document Title: %s
 
@@ -0,0 +1,83 @@
+package summariser
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestFamily(t *testing.T) {
+	for _, tc := range []struct{ provider, name, want string }{
+		{"anthropic", "claude-3-haiku-20240307", "anthropic/claude-3-haiku"},
+		{"anthropic", "claude-3-5-sonnet-20241022", "anthropic/claude-3-5-sonnet"},
+		{"anthropic", "claude-3-5-sonnet-latest", "anthropic/claude-3-5-sonnet"},
+		{"anthropic", "claude-sonnet-4-20250514", "anthropic/claude-sonnet-4"},
+		{"anthropic", "claude-haiku", "anthropic/claude-haiku"},
+		{"openai", "gpt-4o-2024-08-06", "openai/gpt-4o"},
+		{"openai", "gpt-4o-mini-2024-07-18", "openai/gpt-4o-mini"},
+		{"openai", "gpt-4-turbo-2024-04-09", "openai/gpt-4-turbo"},
+		{"openai", "gpt-4-0613", "openai/gpt-4"},
+		{"openai", "gpt-3.5-turbo-0125", "openai/gpt-3.5-turbo"},
+		{"openai", "o1-2024-12-17", "openai/o1"},
+		{"openai", "gpt-4", "openai/gpt-4"},
+		{"ollama", "llama3-8b-instruct", "ollama/llama3-8b-instruct"},
+		{"ollama", "mistral-v2", "ollama/mistral"},
+	} {
+		if got := Family(Model{Name: tc.name, Provider: tc.provider}); got != tc.want {
+			t.Errorf("Family(%s/%s) = %q, want %q", tc.provider, tc.name, got, tc.want)
+		}
+	}
+}
+
+// mapCache is a Cache kept in memory
+type mapCache map[string]*Summary
+
+func (c mapCache) CachedSummary(hash string, level SummaryLevel, family string) (*Summary, error) {
+	summary := c[hash+" "+string(level)+" "+family]
+	if summary == nil {
+		return nil, nil
+	}
+	copied := *summary
+	return &copied, nil
+}
+
+func (c mapCache) CacheSummary(hash, family string, summary *Summary) error {
+	c[hash+" "+string(summary.Level)+" "+family] = summary
+	return nil
+}
+
+func TestSummaryCache(t *testing.T) {
+	cache := mapCache{}
+	s := &Summariser{
+		config: Config{Level: SummaryDefault, Cache: cache},
+		log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	dated := Model{Name: "gpt-4o-2024-05-13", Provider: "openai"}
+	s.cache("abc", dated, &Summary{Summary: "A lease", Model: dated.Name, Level: SummaryDefault, Cost: 0.02})
+
+	newer := Model{Name: "gpt-4o-2024-08-06", Provider: "openai"}
+	summary := s.cached("abc", []Model{newer})
+	if summary == nil || summary.Summary != "A lease" {
+		t.Fatalf("cached by a newer model of the family = %+v, want the lease summary", summary)
+	}
+	if !summary.Cached || summary.Cost != 0 {
+		t.Errorf("cached summary = cached %v, cost %v; want cached at no cost", summary.Cached, summary.Cost)
+	}
+
+	for name, miss := range map[string]func() *Summary{
+		"other hash":   func() *Summary { return s.cached("def", []Model{newer}) },
+		"no hash":      func() *Summary { return s.cached("", []Model{newer}) },
+		"other family": func() *Summary { return s.cached("abc", []Model{{Name: "gpt-4o-mini", Provider: "openai"}}) },
+		"other provider": func() *Summary {
+			return s.cached("abc", []Model{{Name: "gpt-4o", Provider: "groq"}})
+		},
+		"other level": func() *Summary {
+			full := &Summariser{config: Config{Level: SummaryFull, Cache: cache}, log: s.log}
+			return full.cached("abc", []Model{newer})
+		},
+	} {
+		if summary := miss(); summary != nil {
+			t.Errorf("%s: cached = %+v, want a miss", name, summary)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package tagging
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// defaultMinMatches is how many distinct keywords a text must contain to be
+// put in a category
+const defaultMinMatches = 2
+
+// Category tags files that look like they belong to it
+type Category struct {
+	Tag          string
+	Extensions   []string // File extensions, e.g. ".heic"
+	PathKeywords []string // Words any of which in the path is enough, e.g. "taxes"
+	Keywords     []string // Words and phrases looked for in the text
+	MinMatches   int      // Distinct Keywords the text must contain; 0 for the default of 2
+}
+
+// DefaultCategories returns the built-in taxonomy
+func DefaultCategories() []Category {
+	return []Category{
+		{
+			Tag:          "tax",
+			PathKeywords: []string{"tax", "taxes", "irs", "w2", "1099"},
+			Keywords: []string{"tax return", "irs", "form 1040", "w-2", "1099", "taxable income", "withholding",
+				"adjusted gross income", "deduction", "hmrc", "self assessment"},
+		},
+		{
+			Tag:          "medical",
+			PathKeywords: []string{"medical", "health", "doctor", "hospital"},
+			Keywords: []string{"patient", "diagnosis", "prescription", "physician", "hospital", "clinic",
+				"medical record", "lab results", "dosage", "symptoms", "treatment"},
+		},
+		{
+			Tag: "photos",
+			Extensions: []string{".jpg", ".jpeg", ".png", ".heic", ".heif", ".gif", ".tif", ".tiff", ".webp",
+				".dng", ".cr2", ".cr3", ".nef", ".arw", ".orf", ".rw2", ".raf"},
+			PathKeywords: []string{"photos", "pictures", "dcim"},
+		},
+		{
+			Tag: "code",
+			Extensions: []string{".go", ".py", ".js", ".ts", ".java", ".c", ".h", ".cpp", ".hpp", ".cs", ".rs",
+				".rb", ".php", ".swift", ".kt", ".scala", ".sh", ".pl", ".sql", ".m", ".vb", ".bas", ".pas"},
+		},
+		{
+			Tag:          "receipts",
+			PathKeywords: []string{"receipt", "receipts", "invoices"},
+			Keywords: []string{"receipt", "invoice", "subtotal", "amount paid", "order number", "total due",
+				"payment received", "thank you for your purchase", "vat"},
+		},
+		{
+			Tag:          "legal",
+			PathKeywords: []string{"legal", "contracts"},
+			Keywords: []string{"agreement", "contract", "hereby", "whereas", "plaintiff", "defendant",
+				"power of attorney", "last will", "testament", "deed", "notary", "lease", "party of the first part"},
+		},
+		{
+			Tag:          "school",
+			PathKeywords: []string{"school", "homework", "university", "college"},
+			Keywords: []string{"student", "homework", "semester", "transcript", "report card", "teacher",
+				"syllabus", "assignment", "grade", "exam", "coursework"},
+		},
+	}
+}
+
+// Classifier puts files into categories from their name, text and the
+// document type reported by a model
+type Classifier struct {
+	categories []*Category
+}
+
+// NewClassifier creates a classifier for the given categories. Categories
+// sharing a tag are merged.
+func NewClassifier(categories []Category) *Classifier {
+	c := &Classifier{}
+	for _, category := range categories {
+		c.Add(category)
+	}
+	return c
+}
+
+// Add adds a category, or extends the one with the same tag with its
+// extensions and keywords
+func (c *Classifier) Add(category Category) {
+	category.Tag = strings.TrimSpace(category.Tag)
+	if category.Tag == "" {
+		return
+	}
+	extensions := make([]string, len(category.Extensions))
+	for i, ext := range category.Extensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions[i] = ext
+	}
+	category.Extensions = extensions
+	category.PathKeywords = normalizeAll(category.PathKeywords)
+	category.Keywords = normalizeAll(category.Keywords)
+
+	for _, existing := range c.categories {
+		if existing.Tag == category.Tag {
+			existing.Extensions = append(existing.Extensions, category.Extensions...)
+			existing.PathKeywords = append(existing.PathKeywords, category.PathKeywords...)
+			existing.Keywords = append(existing.Keywords, category.Keywords...)
+			if category.MinMatches > 0 {
+				existing.MinMatches = category.MinMatches
+			}
+			return
+		}
+	}
+	c.categories = append(c.categories, &category)
+}
+
+// ClassifyPath returns the tags of the categories a file's extension or path
+// puts it in. A nil classifier returns no tags.
+func (c *Classifier) ClassifyPath(filePath string) []string {
+	if c == nil {
+		return nil
+	}
+	ext := strings.ToLower(filepath.Ext(filePath))
+	words := normalize(filePath)
+
+	var tags []string
+	for _, category := range c.categories {
+		if slices.Contains(category.Extensions, ext) || containsAny(words, category.PathKeywords) {
+			tags = append(tags, category.Tag)
+		}
+	}
+	return tags
+}
+
+// ClassifyText returns the tags of the categories a document's text or its
+// type, as reported by a model, puts it in. A nil classifier returns no
+// tags.
+func (c *Classifier) ClassifyText(text, documentType string) []string {
+	if c == nil {
+		return nil
+	}
+	words := normalize(text)
+	docType := normalize(documentType)
+
+	var tags []string
+	for _, category := range c.categories {
+		minMatches := category.MinMatches
+		if minMatches <= 0 {
+			minMatches = defaultMinMatches
+		}
+
+		matched := docType != " " && (docType == normalize(category.Tag) || slices.Contains(category.Keywords, docType))
+		for i, count := 0, 0; !matched && i < len(category.Keywords); i++ {
+			if strings.Contains(words, category.Keywords[i]) {
+				count++
+				matched = count >= minMatches
+			}
+		}
+		if matched {
+			tags = append(tags, category.Tag)
+		}
+	}
+	return tags
+}
+
+// normalize lowercases s and replaces every run of characters other than
+// letters and digits with a space, padding the result with spaces, so that
+// whole words and phrases can be found with strings.Contains
+func normalize(s string) string {
+	var b strings.Builder
+	b.WriteByte(' ')
+	space := true
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+		} else if !space {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	if !space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// normalizeAll normalizes keywords, dropping empty ones
+func normalizeAll(keywords []string) []string {
+	var normalized []string
+	for _, keyword := range keywords {
+		if keyword = normalize(keyword); keyword != " " {
+			normalized = append(normalized, keyword)
+		}
+	}
+	return normalized
+}
+
+// containsAny reports whether normalized text contains any of the keywords
+func containsAny(text string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package tagging
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Rule tags paths matching a pattern
+type Rule struct {
+	Pattern  string
+	Tag      string
+	anchored bool
+	segments []string
+}
+
+// Tagger applies path-pattern tag rules to scanned files
+type Tagger struct {
+	rules      []*Rule
+	classifier *Classifier
+}
+
+// NewTagger creates a tagger without rules
+func NewTagger() *Tagger {
+	return &Tagger{}
+}
+
+// Add adds a rule tagging paths that match pattern. In patterns * matches
+// within a path segment and ** matches any number of segments. A pattern
+// starting with / must match from the root of the path; other patterns may
+// match at any depth. Matching is case-insensitive.
+func (t *Tagger) Add(pattern, tag string) error {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return fmt.Errorf("tag rule %q has no tag", pattern)
+	}
+
+	trimmed := strings.Trim(pattern, "/")
+	if trimmed == "" {
+		return fmt.Errorf("empty tag pattern for tag %q", tag)
+	}
+
+	segments := strings.Split(strings.ToLower(trimmed), "/")
+	for _, segment := range segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid tag pattern %q: %w", pattern, err)
+		}
+	}
+
+	t.rules = append(t.rules, &Rule{
+		Pattern:  pattern,
+		Tag:      tag,
+		anchored: strings.HasPrefix(pattern, "/"),
+		segments: segments,
+	})
+	return nil
+}
+
+// SetClassifier also tags files with the categories their extension or path
+// puts them in
+func (t *Tagger) SetClassifier(c *Classifier) {
+	t.classifier = c
+}
+
+// Tags returns the tags of every rule matching filePath, in rule order, and
+// then those of the classifier's categories, without duplicates. A nil
+// tagger returns no tags.
+func (t *Tagger) Tags(filePath string) []string {
+	if t == nil || len(t.rules) == 0 && t.classifier == nil {
+		return nil
+	}
+
+	segments := strings.Split(strings.Trim(strings.ToLower(filepath.ToSlash(filePath)), "/"), "/")
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, rule := range t.rules {
+		if seen[rule.Tag] || !rule.matches(segments) {
+			continue
+		}
+		seen[rule.Tag] = true
+		tags = append(tags, rule.Tag)
+	}
+	for _, tag := range t.classifier.ClassifyPath(filePath) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// matches reports whether the rule matches the path segments
+func (r *Rule) matches(segments []string) bool {
+	if r.anchored {
+		return matchSegments(r.segments, segments)
+	}
+	for start := range segments {
+		if matchSegments(r.segments, segments[start:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches pattern segments against all of the path segments
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for skip := 0; skip <= len(segments); skip++ {
+			if matchSegments(pattern[1:], segments[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
@@ -0,0 +1,93 @@
+package tagging
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	tagger := NewTagger()
+	rules := []struct{ pattern, tag string }{
+		{"*/Tax*/**", "tax"},
+		{"*/Camera Uploads/**", "photos"},
+		{"**/*.heic", "photos"},
+		{"/Volumes/Work/**", "work"},
+	}
+	for _, rule := range rules {
+		if err := tagger.Add(rule.pattern, rule.tag); err != nil {
+			t.Fatalf("Add(%q): %v", rule.pattern, err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/Volumes/Old/Finance/Taxes 2019/w2.pdf", []string{"tax"}},
+		{"/Volumes/Old/tax/return.pdf", []string{"tax"}},
+		{"/Users/me/Dropbox/Camera Uploads/2019/IMG_1.HEIC", []string{"photos"}},
+		{"/Volumes/Work/Tax/notes.txt", []string{"tax", "work"}},
+		{"/Volumes/Old/Syntax/readme.md", nil},
+		{"/Volumes/Old/Work/file.txt", nil},
+	}
+
+	for _, tt := range tests {
+		if got := tagger.Tags(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tags(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAddErrors(t *testing.T) {
+	tagger := NewTagger()
+	if err := tagger.Add("*/Tax*/**", ""); err == nil {
+		t.Error("expected an error for a rule without a tag")
+	}
+	if err := tagger.Add("*/[Tax/**", "tax"); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	classifier := NewClassifier(DefaultCategories())
+	classifier.Add(Category{Tag: "recipes", Keywords: []string{"preheat", "tablespoon"}})
+	classifier.Add(Category{Tag: "photos", Extensions: []string{"PSD"}})
+
+	paths := []struct {
+		path string
+		want []string
+	}{
+		{"/Volumes/Old/DCIM/IMG_0001.HEIC", []string{"photos"}},
+		{"/Volumes/Old/art/cover.psd", []string{"photos"}},
+		{"/Volumes/Old/Taxes 2019/return.pdf", []string{"tax"}},
+		{"/Volumes/Old/src/main.go", []string{"code"}},
+		{"/Volumes/Old/Syntax/readme.md", nil},
+	}
+	for _, tt := range paths {
+		if got := classifier.ClassifyPath(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ClassifyPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	texts := []struct {
+		text, docType string
+		want          []string
+	}{
+		{"Patient: J. Doe. Diagnosis: sprain. Prescription: rest.", "", []string{"medical"}},
+		{"Preheat the oven. Add a tablespoon of sugar.", "", []string{"recipes"}},
+		{"The patient was happy.", "", nil},
+		{"", "Invoice", []string{"receipts"}},
+		{"", "tax return", []string{"tax"}},
+	}
+	for _, tt := range texts {
+		if got := classifier.ClassifyText(tt.text, tt.docType); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ClassifyText(%q, %q) = %v, want %v", tt.text, tt.docType, got, tt.want)
+		}
+	}
+
+	tagger := NewTagger()
+	tagger.SetClassifier(classifier)
+	if got := tagger.Tags("/Users/me/Pictures/beach.jpg"); !reflect.DeepEqual(got, []string{"photos"}) {
+		t.Errorf("Tags = %v, want [photos]", got)
+	}
+}
@@ -0,0 +1,74 @@
+package tools
+
+// Tool is the state of one optional external tool
+type Tool struct {
+	Name    string `json:"name"`
+	Path    string `json:"path,omitempty"` // "" when not installed
+	Version string `json:"version,omitempty"`
+	Package string `json:"package,omitempty"` // Package that installs it
+	Install string `json:"install,omitempty"` // Install command for this platform, if known
+}
+
+// Installed reports whether the tool was found
+func (t Tool) Installed() bool {
+	return t.Path != ""
+}
+
+// Need is the state of a piece of optional functionality: provided by the
+// preferred tool, degraded to a fallback, or unavailable
+type Need struct {
+	Purpose   string   `json:"purpose"`
+	Tool      string   `json:"tool,omitempty"` // Installed tool providing it, "" if none
+	Preferred string   `json:"preferred"`
+	Tools     []string `json:"tools"` // Tools that provide it, in order of preference
+}
+
+// Available reports whether any tool provides the functionality
+func (n Need) Available() bool {
+	return n.Tool != ""
+}
+
+// Degraded reports whether the functionality is provided by a fallback
+// rather than the preferred tool
+func (n Need) Degraded() bool {
+	return n.Tool != "" && n.Tool != n.Preferred
+}
+
+// Tools probes every optional tool, with its version when it is installed.
+// Tools that come with another OS and aren't installed are left out.
+func Tools() []Tool {
+	var found []Tool
+	seen := make(map[string]bool)
+	for _, n := range needs {
+		for _, name := range n.tools {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			tool := Tool{Name: name}
+			tool.Path, _ = LookPath(name)
+			if tool.Installed() {
+				tool.Version = Version(name)
+			}
+			if install, ok := installs[name]; ok {
+				tool.Package = install.pkg
+				tool.Install = install.command()
+			} else if !tool.Installed() {
+				continue
+			}
+			found = append(found, tool)
+		}
+	}
+	return found
+}
+
+// Needs reports which tool, if any, provides each piece of optional
+// functionality
+func Needs() []Need {
+	var states []Need
+	for _, n := range needs {
+		states = append(states, Need{Purpose: n.purpose, Tool: First(n.tools...), Preferred: n.tools[0], Tools: n.tools})
+	}
+	return states
+}
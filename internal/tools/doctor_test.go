@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestNeeds(t *testing.T) {
+	// Only a fake pandoc is on the PATH
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pandoc"), []byte("#!/bin/sh\necho 'pandoc 3.1.9'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	t.Setenv("HOME", t.TempDir())
+	reset := func(cache *sync.Map) {
+		cache.Range(func(key, _ any) bool {
+			cache.Delete(key)
+			return true
+		})
+	}
+	reset(&lookupCache)
+	reset(&versionCache)
+	defer reset(&lookupCache)
+	defer reset(&versionCache)
+
+	states := make(map[string]Need)
+	for _, need := range Needs() {
+		states[need.Purpose] = need
+	}
+	if office := states["Office document extraction"]; !office.Degraded() || office.Tool != "pandoc" || office.Preferred != "tika" {
+		t.Errorf("office extraction = %+v, want degraded to pandoc", office)
+	}
+	if epub := states["EPUB extraction"]; !epub.Available() || epub.Degraded() {
+		t.Errorf("EPUB extraction = %+v, want pandoc", epub)
+	}
+	if pdf := states["PDF extraction"]; pdf.Available() {
+		t.Errorf("PDF extraction = %+v, want unavailable", pdf)
+	}
+
+	found := make(map[string]Tool)
+	for _, tool := range Tools() {
+		found[tool.Name] = tool
+	}
+	if pandoc := found["pandoc"]; pandoc.Version != "pandoc 3.1.9" || pandoc.Path != filepath.Join(dir, "pandoc") {
+		t.Errorf("pandoc = %+v", pandoc)
+	}
+	if ffmpeg := found["ffmpeg"]; ffmpeg.Installed() || ffmpeg.Package != "ffmpeg" {
+		t.Errorf("ffmpeg = %+v, want missing with a package to install", ffmpeg)
+	}
+	if _, ok := found["textutil"]; ok {
+		t.Error("textutil, which comes with macOS, is listed as missing")
+	}
+}
@@ -0,0 +1,219 @@
+package tools
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// DefaultFFmpegURL is where InstallFFmpeg downloads static builds of ffmpeg
+// and ffprobe from. {os}, {arch} and {tool} are replaced, e.g. with macos,
+// arm64 and ffprobe; the SHA-256 of each archive is read from the same URL
+// with .sha256 appended.
+const DefaultFFmpegURL = "https://ffmpeg.martin-riedl.de/redirect/latest/{os}/{arch}/release/{tool}.zip"
+
+// ffmpegPlatforms names the platforms that static builds are published for
+var ffmpegPlatforms = map[string]string{
+	"darwin/amd64": "macos/amd64",
+	"darwin/arm64": "macos/arm64",
+	"linux/amd64":  "linux/amd64",
+	"linux/arm64":  "linux/arm64",
+}
+
+// BinDir returns the folder tools installed by the archiver are kept in,
+// ~/.archiver/bin. Tools are looked for there when they aren't on the PATH,
+// so static builds can also be copied there by hand.
+func BinDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".archiver", "bin"), nil
+}
+
+// bundled returns the path of a tool in BinDir, if it is there
+func bundled(name string) (string, bool) {
+	dir, err := BinDir()
+	if err != nil {
+		return "", false
+	}
+	path := filepath.Join(dir, name)
+	if runtime.GOOS == "windows" {
+		path += ".exe"
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || (runtime.GOOS != "windows" && info.Mode()&0111 == 0) {
+		return "", false
+	}
+	return path, true
+}
+
+// InstallFFmpeg downloads static builds of ffmpeg and ffprobe for this
+// platform into BinDir, from urlTemplate or DefaultFFmpegURL if it is "".
+// Each archive is checked against its published SHA-256 before anything is
+// installed. It returns the paths of the installed tools.
+func InstallFFmpeg(ctx context.Context, urlTemplate string) ([]string, error) {
+	if urlTemplate == "" {
+		urlTemplate = DefaultFFmpegURL
+	}
+	platform, ok := ffmpegPlatforms[runtime.GOOS+"/"+runtime.GOARCH]
+	if !ok && urlTemplate == DefaultFFmpegURL {
+		return nil, fmt.Errorf("no static ffmpeg build is published for %s/%s; install ffmpeg with the package manager",
+			runtime.GOOS, runtime.GOARCH)
+	}
+	if !ok {
+		platform = runtime.GOOS + "/" + runtime.GOARCH
+	}
+	osName, arch, _ := strings.Cut(platform, "/")
+
+	dir, err := BinDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var installed []string
+	for _, tool := range []string{"ffmpeg", "ffprobe"} {
+		url := strings.NewReplacer("{os}", osName, "{arch}", arch, "{tool}", tool).Replace(urlTemplate)
+		path, err := installTool(ctx, url, tool, dir)
+		if err != nil {
+			return installed, fmt.Errorf("failed to install %s: %w", tool, err)
+		}
+		installed = append(installed, path)
+	}
+
+	// Tools looked for before the install were cached as missing
+	lookupCache.Delete("ffmpeg")
+	lookupCache.Delete("ffprobe")
+	versionCache.Delete("ffmpeg")
+	versionCache.Delete("ffprobe")
+	return installed, nil
+}
+
+// installTool downloads the ZIP archive at url, checks it against the
+// SHA-256 at url.sha256 and extracts the tool in it into dir
+func installTool(ctx context.Context, url, tool, dir string) (string, error) {
+	want, err := fetchChecksum(ctx, url+".sha256")
+	if err != nil {
+		return "", err
+	}
+
+	archive, err := os.CreateTemp(dir, tool+"-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	body, err := get(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(archive, hash), body)
+	if err != nil {
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return "", fmt.Errorf("checksum mismatch for %s: got %s, want %s", url, got, want)
+	}
+
+	reader, err := zip.NewReader(archive, size)
+	if err != nil {
+		return "", err
+	}
+	name := tool
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	for _, entry := range reader.File {
+		if entry.FileInfo().IsDir() || filepath.Base(entry.Name) != name {
+			continue
+		}
+		return extractTool(entry, filepath.Join(dir, name))
+	}
+	return "", fmt.Errorf("%s has no %s in it", url, name)
+}
+
+// extractTool writes a file of an archive to path as an executable,
+// replacing any earlier version only once it is complete
+func extractTool(entry *zip.File, path string) (string, error) {
+	src, err := entry.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	partial := path + ".partial"
+	dst, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(partial)
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	return path, nil
+}
+
+// fetchChecksum reads a SHA-256 published as a checksum file, either the
+// bare digest or sha256sum output
+func fetchChecksum(ctx context.Context, url string) (string, error) {
+	body, err := get(ctx, url)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the checksum: %w", err)
+	}
+	defer body.Close()
+
+	line, err := bufio.NewReader(io.LimitReader(body, 4096)).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to get the checksum: %w", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%s is empty", url)
+	}
+	digest := strings.ToLower(fields[0])
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != sha256.Size*2 {
+		return "", fmt.Errorf("%s holds no SHA-256", url)
+	}
+	return digest, nil
+}
+
+// get starts downloading url, failing for responses other than 200 OK
+func get(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
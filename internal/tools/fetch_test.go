@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestInstallFFmpeg(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake tools are shell scripts")
+	}
+	archives := make(map[string][]byte)
+	for _, tool := range []string{"ffmpeg", "ffprobe"} {
+		var buf bytes.Buffer
+		writer := zip.NewWriter(&buf)
+		entry, err := writer.Create(tool + "-7.1/bin/" + tool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write([]byte("#!/bin/sh\necho '" + tool + " version 7.1'\n"))
+		writer.Close()
+		archives[tool] = buf.Bytes()
+	}
+	corrupt := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tool := strings.TrimSuffix(filepath.Base(strings.TrimSuffix(r.URL.Path, ".sha256")), ".zip")
+		archive, ok := archives[tool]
+		switch {
+		case !ok:
+			http.NotFound(w, r)
+		case strings.HasSuffix(r.URL.Path, ".sha256"):
+			sum := sha256.Sum256(archive)
+			w.Write([]byte(hex.EncodeToString(sum[:]) + "  " + tool + ".zip\n"))
+		case corrupt:
+			w.Write(archive[1:])
+		default:
+			w.Write(archive)
+		}
+	}))
+	defer server.Close()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PATH", t.TempDir())
+	defer lookupCache.Delete("ffmpeg")
+	defer versionCache.Delete("ffmpeg")
+	defer lookupCache.Delete("ffprobe")
+
+	// A download that doesn't match its checksum installs nothing
+	corrupt = true
+	if _, err := InstallFFmpeg(context.Background(), server.URL+"/{os}/{arch}/{tool}.zip"); err == nil ||
+		!strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".archiver", "bin", "ffmpeg")); err == nil {
+		t.Error("ffmpeg was installed from a corrupt download")
+	}
+
+	corrupt = false
+	installed, err := InstallFFmpeg(context.Background(), server.URL+"/{os}/{arch}/{tool}.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installed) != 2 || installed[0] != filepath.Join(home, ".archiver", "bin", "ffmpeg") {
+		t.Errorf("installed %v", installed)
+	}
+	if path, err := LookPath("ffmpeg"); err != nil || path != installed[0] {
+		t.Errorf("LookPath(ffmpeg) = %q, %v; want the installed build", path, err)
+	}
+	if version := Version("ffmpeg"); version != "ffmpeg version 7.1" {
+		t.Errorf("version = %q", version)
+	}
+}
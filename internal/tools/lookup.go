@@ -0,0 +1,204 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ErrNotInstalled is wrapped by errors for work that needs a tool that isn't
+// installed, so callers can skip such files instead of reporting each one
+var ErrNotInstalled = errors.New("required tool not installed")
+
+// lookup is a cached exec.LookPath result
+type lookup struct {
+	path string
+	err  error
+}
+
+var lookupCache sync.Map
+
+// LookPath is exec.LookPath with the result cached, so a missing tool is
+// searched for once per run rather than once per file. Tools not on the
+// PATH are looked for in BinDir.
+func LookPath(name string) (string, error) {
+	if cached, ok := lookupCache.Load(name); ok {
+		result := cached.(lookup)
+		return result.path, result.err
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		if installed, ok := bundled(name); ok {
+			path, err = installed, nil
+		}
+	}
+	lookupCache.Store(name, lookup{path: path, err: err})
+	return path, err
+}
+
+// Path returns where a tool is installed, or its name if it isn't found,
+// for starting it with exec.Command
+func Path(name string) string {
+	if path, err := LookPath(name); err == nil {
+		return path
+	}
+	return name
+}
+
+// Available reports whether a tool is installed
+func Available(name string) bool {
+	_, err := LookPath(name)
+	return err == nil
+}
+
+// need is a piece of functionality provided by any one of several tools
+type need struct {
+	purpose string
+	tools   []string // in order of preference
+	install install  // how to install the preferred tool
+}
+
+// install describes how to install a package on each platform
+type install struct {
+	pkg  string
+	brew string
+	apt  string
+}
+
+// needs lists the optional functionality backed by external tools
+var needs = []need{
+	{"PDF extraction", []string{"pdftotext", "pdf2text"}, poppler},
+	{"PDF metadata", []string{"pdfinfo"}, poppler},
+	{"PDF previews", []string{"pdftoppm"}, poppler},
+	{"Office document extraction", []string{"tika", "pandoc", "textutil"}, pandoc},
+	{"XLS spreadsheet extraction", []string{"tika"}, tika},
+	{"presentation extraction", []string{"tika", "pandoc"}, pandoc},
+	{"EPUB extraction", []string{"pandoc", "tika"}, pandoc},
+	{"video transcoding", []string{"ffmpeg"}, ffmpeg},
+	{"video metadata", []string{"ffprobe"}, ffmpeg},
+	{"transcripts", []string{"whisper"}, whisper},
+	{"HEIC conversion", []string{"sips", "convert"}, imagemagick},
+	{"AVIF conversion", []string{"convert"}, imagemagick},
+	{"HEIC photo dates", []string{"exiftool"}, exiftool},
+	{"OCR", []string{"tesseract"}, tesseract},
+	{"drive health checks", []string{"smartctl"}, smartmontools},
+}
+
+var (
+	poppler       = install{pkg: "poppler", brew: "brew install poppler", apt: "sudo apt install poppler-utils"}
+	pandoc        = install{pkg: "pandoc", brew: "brew install pandoc", apt: "sudo apt install pandoc"}
+	tika          = install{pkg: "tika", brew: "brew install tika"}
+	ffmpeg        = install{pkg: "ffmpeg", brew: "brew install ffmpeg", apt: "sudo apt install ffmpeg"}
+	whisper       = install{pkg: "whisper", brew: "pip install openai-whisper", apt: "pip install openai-whisper"}
+	imagemagick   = install{pkg: "imagemagick", brew: "brew install imagemagick", apt: "sudo apt install imagemagick"}
+	exiftool      = install{pkg: "exiftool", brew: "brew install exiftool", apt: "sudo apt install libimage-exiftool-perl"}
+	smartmontools = install{pkg: "smartmontools", brew: "brew install smartmontools", apt: "sudo apt install smartmontools"}
+	tesseract     = install{pkg: "tesseract", brew: "brew install tesseract", apt: "sudo apt install tesseract-ocr"}
+)
+
+// installs maps the tools that can be installed to their package; the rest
+// come with the OS
+var installs = map[string]install{
+	"pdftotext": poppler,
+	"pdfinfo":   poppler,
+	"pdftoppm":  poppler,
+	"tika":      tika,
+	"pandoc":    pandoc,
+	"ffmpeg":    ffmpeg,
+	"ffprobe":   ffmpeg,
+	"whisper":   whisper,
+	"convert":   imagemagick,
+	"exiftool":  exiftool,
+	"smartctl":  smartmontools,
+	"tesseract": tesseract,
+}
+
+// command returns the install command for this platform, or "" if unknown
+func (i install) command() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return i.brew
+	case "linux":
+		return i.apt
+	}
+	return ""
+}
+
+// Hint suggests a package to install for functionality that is unavailable
+type Hint struct {
+	Package  string
+	Command  string   // install command for this platform, if known
+	Purposes []string // what the package would enable
+}
+
+// String formats the hint as e.g.
+// "install poppler for PDF extraction (brew install poppler)"
+func (h Hint) String() string {
+	hint := fmt.Sprintf("install %s for %s", h.Package, joinPurposes(h.Purposes))
+	if h.Command != "" {
+		hint += " (" + h.Command + ")"
+	}
+	return hint
+}
+
+// Hints probes every optional tool once and returns install hints for the
+// functionality that no installed tool provides, one per package
+func Hints() []Hint {
+	var hints []Hint
+	index := make(map[string]int)
+
+	for _, n := range needs {
+		if First(n.tools...) != "" {
+			continue
+		}
+
+		i, ok := index[n.install.pkg]
+		if !ok {
+			i = len(hints)
+			index[n.install.pkg] = i
+			hints = append(hints, Hint{Package: n.install.pkg, Command: n.install.command()})
+		}
+		hints[i].Purposes = append(hints[i].Purposes, n.purpose)
+	}
+
+	return hints
+}
+
+// PrintHints writes a single section listing the packages to install for
+// unavailable functionality. Nothing is written when every need is met.
+func PrintHints(w io.Writer) {
+	hints := Hints()
+	if len(hints) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "Some optional tools are missing; matching files will be skipped:")
+	for _, hint := range hints {
+		fmt.Fprintf(w, "  %s\n", hint)
+	}
+	fmt.Fprintln(w)
+}
+
+// First returns the first of the named tools that is installed, or "" if
+// none is
+func First(names ...string) string {
+	for _, name := range names {
+		if Available(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// joinPurposes joins purposes as "a, b and c"
+func joinPurposes(purposes []string) string {
+	if len(purposes) <= 1 {
+		return strings.Join(purposes, "")
+	}
+	return strings.Join(purposes[:len(purposes)-1], ", ") + " and " + purposes[len(purposes)-1]
+}
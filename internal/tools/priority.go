@@ -0,0 +1,36 @@
+package tools
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+)
+
+// niceness is how much lower than the archiver's the CPU priority of the
+// tools started with Command is
+var niceness atomic.Int32
+
+// SetLowPriority makes the transcoders, converters, text extractors and
+// Whisper started with Command run at a lower CPU priority, so that work the
+// archiver does itself, such as uploading, isn't starved by them
+func SetLowPriority(low bool) {
+	if low {
+		niceness.Store(10)
+	} else {
+		niceness.Store(0)
+	}
+}
+
+// Command is exec.CommandContext for the tools doing the heavy work of a
+// run, found as LookPath finds them. After SetLowPriority they are started
+// through nice; where nice isn't installed they run at the usual priority.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	name = Path(name)
+	if n := niceness.Load(); n > 0 {
+		if nice, err := LookPath("nice"); err == nil {
+			return exec.CommandContext(ctx, nice, append([]string{"-n", strconv.Itoa(int(n)), name}, args...)...)
+		}
+	}
+	return exec.CommandContext(ctx, name, args...)
+}
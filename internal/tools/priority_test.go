@@ -0,0 +1,25 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommandLowPriority(t *testing.T) {
+	if !Available("nice") {
+		t.Skip("nice not installed")
+	}
+	defer SetLowPriority(false)
+
+	cmd := Command(context.Background(), "ffmpeg", "-version")
+	if filepath.Base(cmd.Args[0]) != "ffmpeg" {
+		t.Errorf("normal priority command = %v", cmd.Args)
+	}
+
+	SetLowPriority(true)
+	cmd = Command(context.Background(), "ffmpeg", "-version")
+	if filepath.Base(cmd.Path) != "nice" || cmd.Args[1] != "-n" || filepath.Base(cmd.Args[3]) != "ffmpeg" {
+		t.Errorf("low priority command = %v", cmd.Args)
+	}
+}
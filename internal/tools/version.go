@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// versionArgs lists tools that don't understand --version
+var versionArgs = map[string][]string{
+	"ffmpeg":    {"-version"},
+	"ffprobe":   {"-version"},
+	"pdftotext": {"-v"},
+	"pdfinfo":   {"-v"},
+	"pdftoppm":  {"-v"},
+	"exiftool":  {"-ver"},
+	"convert":   {"-version"},
+	"sips":      {"--help"},
+	"textutil":  {"-help"},
+}
+
+var versionCache sync.Map
+
+// Version returns the version line reported by an external tool, or
+// "unknown" if it can't be determined. Results are cached per tool.
+func Version(name string) string {
+	if v, ok := versionCache.Load(name); ok {
+		return v.(string)
+	}
+
+	version := probeVersion(name)
+	versionCache.Store(name, version)
+	return version
+}
+
+// probeVersion runs the tool's version flag and returns the first output line
+func probeVersion(name string) string {
+	path, err := LookPath(name)
+	if err != nil {
+		return "unknown"
+	}
+
+	args, ok := versionArgs[name]
+	if !ok {
+		args = []string{"--version"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Some tools print their version to stderr or exit non-zero, so keep
+	// whatever output they produced
+	output, _ := exec.CommandContext(ctx, path, args...).CombinedOutput()
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			return line
+		}
+	}
+
+	return "unknown"
+}
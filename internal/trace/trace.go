@@ -0,0 +1,279 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+// Event is one thing that happened to a file
+type Event struct {
+	Time   time.Time
+	Action string
+	Detail string
+}
+
+// Sources holds what the catalog recorded about a file
+type Sources struct {
+	File       *db.FileStatus
+	Provenance []*db.Provenance
+	Errors     []db.RunError
+	Tags       []db.FileTag
+	Notes      []*db.Note
+}
+
+// Timeline assembles the events recorded for a file, oldest first
+func Timeline(src Sources) []Event {
+	file := src.File
+	events := []Event{{Time: file.ModTime, Action: "modified", Detail: "last change on disk, " + formatBytes(file.Size)}}
+
+	if file.ScannedAt.Valid {
+		detail := "hashed"
+		if file.SHA256 == "" {
+			detail = "not hashed"
+		}
+		if file.ContentType != "" {
+			detail += ", " + file.ContentType
+		}
+		events = append(events, Event{Time: file.ScannedAt.Time, Action: "scanned", Detail: detail})
+	}
+
+	uploadRecorded := false
+	for _, p := range src.Provenance {
+		events = append(events, provenanceEvent(p))
+		uploadRecorded = uploadRecorded || p.Artifact == db.ArtifactUpload
+	}
+	// Uploads made before they were recorded in provenance, and adoptions
+	if file.UploadTime.Valid && !uploadRecorded {
+		events = append(events, Event{Time: file.UploadTime.Time, Action: "uploaded", Detail: "to " + file.UploadedURL})
+	}
+
+	for _, tag := range src.Tags {
+		events = append(events, Event{Time: tag.CreatedAt, Action: "tagged", Detail: tag.Tag})
+	}
+	for _, note := range src.Notes {
+		events = append(events, Event{Time: note.CreatedAt, Action: "noted", Detail: note.Text})
+	}
+	for _, runErr := range src.Errors {
+		events = append(events, Event{Time: runErr.CreatedAt, Action: "failed", Detail: fmt.Sprintf("in run %d: %s", runErr.RunID, runErr.Error)})
+	}
+	if file.DeletedAt.Valid {
+		detail := "from the catalog"
+		if file.DeleteReason != "" {
+			detail += ": " + file.DeleteReason
+		}
+		events = append(events, Event{Time: file.DeletedAt.Time, Action: "deleted", Detail: detail})
+	}
+
+	Sort(events)
+	return events
+}
+
+// Sort orders events by time, keeping the order of simultaneous ones
+func Sort(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+}
+
+// provenanceEvent describes how an artifact was produced
+func provenanceEvent(p *db.Provenance) Event {
+	actions := map[string]string{
+		db.ArtifactExtraction: "extracted",
+		db.ArtifactTranscript: "transcribed",
+		db.ArtifactSummary:    "summarized",
+		db.ArtifactTranscode:  "transcoded",
+		db.ArtifactConversion: "converted",
+		db.ArtifactCaption:    "captioned",
+		db.ArtifactThumbnail:  "thumbnailed",
+		db.ArtifactUpload:     "uploaded",
+	}
+	action, ok := actions[p.Artifact]
+	if !ok {
+		action = p.Artifact
+	}
+
+	var parts []string
+	if p.Duration > 0 {
+		parts = append(parts, "in "+formatDuration(p.Duration))
+	}
+	tool := strings.TrimSpace(p.Tool + " " + p.ToolVersion)
+	switch {
+	case p.Model != "" && tool != "":
+		parts = append(parts, fmt.Sprintf("by %s (%s)", p.Model, tool))
+	case p.Model != "":
+		parts = append(parts, "by "+p.Model)
+	case tool != "":
+		parts = append(parts, "with "+tool)
+	}
+	if p.Cost > 0 {
+		parts = append(parts, fmt.Sprintf("for $%.4f", p.Cost))
+	}
+	if p.PromptVersion != "" {
+		parts = append(parts, "prompt v"+p.PromptVersion)
+	}
+	if p.Details != "" {
+		parts = append(parts, p.Details)
+	}
+
+	return Event{Time: p.CreatedAt, Action: action, Detail: strings.Join(parts, ", ")}
+}
+
+// Stubs returns an event for each stub file next to a file, dated by when
+// the stub was written
+func Stubs(path string) []Event {
+	var events []Event
+	for _, ext := range []string{".webloc", ".url"} {
+		info, err := os.Stat(path + ext)
+		if err != nil {
+			continue
+		}
+		events = append(events, Event{Time: info.ModTime(), Action: "stub", Detail: "created " + path + ext})
+	}
+	return events
+}
+
+// FromLog returns the log records about a file from a log written with
+// --log-file, in either the text or the JSON format. Records are matched by
+// their path attribute.
+func FromLog(r io.Reader, path string) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var attrs []attr
+		if strings.HasPrefix(line, "{") {
+			attrs = parseJSONRecord(line)
+		} else {
+			attrs = parseTextRecord(line)
+		}
+		if event, ok := logEvent(attrs, path); ok {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// attr is a key and value of a log record
+type attr struct {
+	key, value string
+}
+
+// logEvent turns a log record about path into an event
+func logEvent(attrs []attr, path string) (Event, bool) {
+	var event Event
+	var level, msg string
+	var rest []string
+	matched := false
+	for _, a := range attrs {
+		switch a.key {
+		case "time":
+			event.Time, _ = time.Parse(time.RFC3339Nano, a.value)
+		case "level":
+			level = a.value
+		case "msg":
+			msg = a.value
+		case "path":
+			matched = a.value == path
+		default:
+			rest = append(rest, a.key+"="+a.value)
+		}
+	}
+	if !matched {
+		return Event{}, false
+	}
+
+	event.Action = "log " + strings.ToLower(level)
+	event.Detail = strings.TrimSpace(msg + " " + strings.Join(rest, " "))
+	return event, true
+}
+
+// parseJSONRecord reads the attributes of a JSON log line, sorted by key
+// after the standard ones
+func parseJSONRecord(line string) []attr {
+	var record map[string]interface{}
+	if json.Unmarshal([]byte(line), &record) != nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(record))
+	for key := range record {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]attr, 0, len(keys))
+	for _, key := range keys {
+		value, ok := record[key].(string)
+		if !ok {
+			value = fmt.Sprint(record[key])
+		}
+		attrs = append(attrs, attr{key, value})
+	}
+	return attrs
+}
+
+// parseTextRecord reads the key=value pairs of a text log line. Values with
+// spaces or quotes are Go-quoted by slog.
+func parseTextRecord(line string) []attr {
+	var attrs []attr
+	for line != "" {
+		key, rest, ok := strings.Cut(line, "=")
+		if !ok {
+			break
+		}
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				break
+			}
+			value, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted):]
+		} else {
+			value, rest, _ = strings.Cut(rest, " ")
+		}
+		attrs = append(attrs, attr{strings.TrimSpace(key), value})
+		line = strings.TrimLeft(rest, " ")
+	}
+	return attrs
+}
+
+// formatDuration rounds a duration for display
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
+
+// formatBytes formats a byte count in binary units
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jth/archiver/internal/db"
+)
+
+func TestTimeline(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	file := &db.FileStatus{
+		Path:        "/Volumes/Old/deed.pdf",
+		Size:        2048,
+		ModTime:     t0.Add(-24 * time.Hour),
+		ScannedAt:   sql.NullTime{Time: t0, Valid: true},
+		SHA256:      "abc",
+		ContentType: "application/pdf",
+		UploadTime:  sql.NullTime{Time: t0.Add(time.Hour), Valid: true},
+		UploadedURL: "https://f000.example/file/b/deed.pdf",
+	}
+	events := Timeline(Sources{
+		File: file,
+		Provenance: []*db.Provenance{
+			{Artifact: db.ArtifactSummary, Tool: "anthropic", Model: "claude-haiku", PromptVersion: "1",
+				Duration: 1500 * time.Millisecond, Cost: 0.0041, CreatedAt: t0.Add(2 * time.Minute)},
+			{Artifact: db.ArtifactExtraction, Tool: "pdftotext", ToolVersion: "24.02",
+				Duration: 3200 * time.Millisecond, CreatedAt: t0.Add(time.Minute)},
+		},
+		Errors: []db.RunError{{RunID: 7, Error: "timeout", CreatedAt: t0.Add(30 * time.Second)}},
+	})
+
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Action+": "+e.Detail)
+	}
+	want := []string{
+		"modified: last change on disk, 2.0 KB",
+		"scanned: hashed, application/pdf",
+		"failed: in run 7: timeout",
+		"extracted: in 3.2s, with pdftotext 24.02",
+		"summarized: in 1.5s, by claude-haiku (anthropic), for $0.0041, prompt v1",
+		"uploaded: to https://f000.example/file/b/deed.pdf",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("timeline:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFromLog(t *testing.T) {
+	log := `time=2024-05-01T10:00:00.000Z level=DEBUG msg=scanned path=/a/b.pdf size=10
+time=2024-05-01T10:00:01.000Z level=DEBUG msg=scanned path=/a/c.pdf size=20
+time=2024-05-01T10:00:02.000Z level=WARN msg="document failed" path="/a/b.pdf" error="exit status 1"
+{"time":"2024-05-01T10:00:03Z","level":"DEBUG","msg":"uploaded","path":"/a/b.pdf","url":"https://x/b.pdf"}
+not a log line
+`
+	events, err := FromLog(strings.NewReader(log), "/a/b.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"log debug: scanned size=10",
+		`log warn: document failed error=exit status 1`,
+		"log debug: uploaded url=https://x/b.pdf",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events %+v, want %d", len(events), events, len(want))
+	}
+	for i, e := range events {
+		if got := e.Action + ": " + e.Detail; got != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got, want[i])
+		}
+	}
+	if !events[1].Time.Equal(time.Date(2024, 5, 1, 10, 0, 2, 0, time.UTC)) {
+		t.Errorf("time = %v", events[1].Time)
+	}
+}
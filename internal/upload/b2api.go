@@ -0,0 +1,758 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RemoteFile represents a file stored in a B2 bucket
+type RemoteFile struct {
+	FileID      string
+	Name        string
+	Size        int64
+	ContentType string
+	SHA1        string
+	UploadedAt  time.Time
+	ModTime     time.Time // From src_last_modified_millis, when the uploader set it
+	Info        map[string]string
+	URL         string
+}
+
+// b2Error is an error response from the B2 API
+type b2Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *b2Error) Error() string {
+	return fmt.Sprintf("B2 API error %d (%s): %s", e.Status, e.Code, e.Message)
+}
+
+// b2FileInfo mirrors the file object returned by the B2 API
+type b2FileInfo struct {
+	FileID          string            `json:"fileId"`
+	FileName        string            `json:"fileName"`
+	ContentLength   int64             `json:"contentLength"`
+	ContentType     string            `json:"contentType"`
+	ContentSha1     string            `json:"contentSha1"`
+	FileInfo        map[string]string `json:"fileInfo"`
+	Action          string            `json:"action"`
+	UploadTimestamp int64             `json:"uploadTimestamp"`
+}
+
+// ListFiles lists all files in the bucket under prefix, calling fn for each.
+// Listing stops at the first error returned by fn.
+func (u *B2Uploader) ListFiles(ctx context.Context, prefix string, fn func(RemoteFile) error) error {
+	if u.config.Prefix != "" && prefix == "" {
+		prefix = u.config.Prefix
+	}
+
+	startFileName := ""
+	for {
+		files, next, err := u.client.listFileNames(ctx, prefix, startFileName, 1000)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if f.Action != "" && f.Action != "upload" {
+				continue
+			}
+			if err := fn(u.client.toRemoteFile(f)); err != nil {
+				return err
+			}
+		}
+
+		if next == "" {
+			return nil
+		}
+		startFileName = next
+	}
+}
+
+// CheckAccess authorizes with the configured key and looks up the bucket,
+// reporting bad credentials or a missing bucket without touching any file
+func (u *B2Uploader) CheckAccess(ctx context.Context) error {
+	_, err := u.client.ensureBucketID(ctx)
+	return err
+}
+
+// toRemoteFile converts an API file object into a RemoteFile
+func (c *b2Client) toRemoteFile(f b2FileInfo) RemoteFile {
+	remote := RemoteFile{
+		FileID:      f.FileID,
+		Name:        f.FileName,
+		Size:        f.ContentLength,
+		ContentType: f.ContentType,
+		SHA1:        f.ContentSha1,
+		UploadedAt:  time.UnixMilli(f.UploadTimestamp),
+		Info:        f.FileInfo,
+		URL:         c.fileURL(f.FileName),
+	}
+
+	// Large files carry their SHA-1 in file info instead
+	if remote.SHA1 == "" || remote.SHA1 == "none" {
+		remote.SHA1 = f.FileInfo["large_file_sha1"]
+	}
+	remote.SHA1 = strings.TrimPrefix(remote.SHA1, "unverified:")
+
+	if millis, err := strconv.ParseInt(f.FileInfo["src_last_modified_millis"], 10, 64); err == nil {
+		remote.ModTime = time.UnixMilli(millis)
+	}
+
+	return remote
+}
+
+// authorize calls b2_authorize_account and caches the account credentials
+func (c *b2Client) authorize(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.authorized {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.authURL, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.keyID, c.appKey)
+
+	var auth struct {
+		AccountID          string `json:"accountId"`
+		AuthorizationToken string `json:"authorizationToken"`
+		APIURL             string `json:"apiUrl"`
+		DownloadURL        string `json:"downloadUrl"`
+		Allowed            struct {
+			BucketID   string `json:"bucketId"`
+			BucketName string `json:"bucketName"`
+		} `json:"allowed"`
+	}
+	if err := c.do(req, &auth); err != nil {
+		return fmt.Errorf("B2 authorization failed: %w", err)
+	}
+
+	c.accountID = auth.AccountID
+	c.authToken = auth.AuthorizationToken
+	c.apiURL = auth.APIURL
+	c.downloadURL = auth.DownloadURL
+	if auth.Allowed.BucketName == c.bucketName {
+		c.bucketID = auth.Allowed.BucketID
+	}
+	c.authorized = true
+
+	return nil
+}
+
+// call invokes a B2 API operation, authorizing first and re-authorizing once
+// if the token has expired
+func (c *b2Client) call(ctx context.Context, operation string, request, response interface{}) error {
+	for attempt := 0; ; attempt++ {
+		if err := c.authorize(ctx); err != nil {
+			return err
+		}
+
+		body, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		endpoint := c.apiURL + "/b2api/v2/" + operation
+		token := c.authToken
+		c.mu.Unlock()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", token)
+		req.Header.Set("Content-Type", "application/json")
+
+		err = c.do(req, response)
+		if apiErr, ok := err.(*b2Error); ok && apiErr.Code == "expired_auth_token" && attempt == 0 {
+			c.mu.Lock()
+			c.authorized = false
+			c.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+		return nil
+	}
+}
+
+// do executes an HTTP request and decodes a JSON response or B2 error
+func (c *b2Client) do(req *http.Request, response interface{}) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return newB2Error(resp.StatusCode, data)
+	}
+
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal(data, response)
+}
+
+// newB2Error decodes the error response of a failed request
+func newB2Error(status int, data []byte) *b2Error {
+	apiErr := &b2Error{Status: status}
+	if json.Unmarshal(data, apiErr) != nil || apiErr.Code == "" {
+		apiErr.Code = "http_error"
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	return apiErr
+}
+
+// ensureBucketID resolves the ID of the configured bucket
+func (c *b2Client) ensureBucketID(ctx context.Context) (string, error) {
+	if err := c.authorize(ctx); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	bucketID, accountID := c.bucketID, c.accountID
+	c.mu.Unlock()
+	if bucketID != "" {
+		return bucketID, nil
+	}
+
+	buckets, err := c.listBuckets(ctx, accountID, c.bucketName)
+	if err != nil {
+		return "", err
+	}
+	if len(buckets) == 0 {
+		return "", fmt.Errorf("bucket not found: %s", c.bucketName)
+	}
+
+	c.mu.Lock()
+	c.bucketID = buckets[0].ID
+	c.mu.Unlock()
+
+	return buckets[0].ID, nil
+}
+
+// listBuckets calls b2_list_buckets for the account's buckets, or only the
+// one named name
+func (c *b2Client) listBuckets(ctx context.Context, accountID, name string) ([]Bucket, error) {
+	request := map[string]string{"accountId": accountID}
+	if name != "" {
+		request["bucketName"] = name
+	}
+	var resp struct {
+		Buckets []b2Bucket `json:"buckets"`
+	}
+	if err := c.call(ctx, "b2_list_buckets", request, &resp); err != nil {
+		return nil, err
+	}
+
+	buckets := make([]Bucket, len(resp.Buckets))
+	for i, b := range resp.Buckets {
+		buckets[i] = b.toBucket()
+	}
+	return buckets, nil
+}
+
+// listFileNames calls b2_list_file_names for one page of results
+func (c *b2Client) listFileNames(ctx context.Context, prefix, startFileName string, maxCount int) ([]b2FileInfo, string, error) {
+	bucketID, err := c.ensureBucketID(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	request := map[string]interface{}{
+		"bucketId":     bucketID,
+		"maxFileCount": maxCount,
+	}
+	if prefix != "" {
+		request["prefix"] = prefix
+	}
+	if startFileName != "" {
+		request["startFileName"] = startFileName
+	}
+
+	var resp struct {
+		Files        []b2FileInfo `json:"files"`
+		NextFileName *string      `json:"nextFileName"`
+	}
+	if err := c.call(ctx, "b2_list_file_names", request, &resp); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if resp.NextFileName != nil {
+		next = *resp.NextFileName
+	}
+	return resp.Files, next, nil
+}
+
+// fileURL returns the friendly download URL of a file in the bucket
+func (c *b2Client) fileURL(fileName string) string {
+	segments := strings.Split(fileName, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	c.mu.Lock()
+	downloadURL := c.downloadURL
+	c.mu.Unlock()
+
+	return fmt.Sprintf("%s/file/%s/%s", downloadURL, c.bucketName, strings.Join(segments, "/"))
+}
+
+// RemoteName returns the name in the bucket of a file uploaded to the given
+// URL, as produced by fileURL
+func (u *B2Uploader) RemoteName(fileURL string) (string, error) {
+	bucket, name, err := SplitFileURL(fileURL)
+	if err != nil {
+		return "", err
+	}
+	if bucket != u.client.bucketName || name == "" {
+		return "", fmt.Errorf("%s is not a file in bucket %s", fileURL, u.client.bucketName)
+	}
+	return name, nil
+}
+
+// SplitFileURL returns the bucket and file name of a download URL of the
+// form <download host>/file/<bucket>/<name>. The name is empty for a URL
+// ending at the bucket.
+func SplitFileURL(fileURL string) (bucket, name string, err error) {
+	parsed, err := url.Parse(fileURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, rest, found := strings.Cut(parsed.Path, "/file/")
+	if !found || rest == "" {
+		return "", "", fmt.Errorf("%s is not a B2 file URL", fileURL)
+	}
+	bucket, name, _ = strings.Cut(rest, "/")
+	return bucket, name, nil
+}
+
+// DeleteFile permanently deletes every version of a file in the bucket.
+// Deleting a file that doesn't exist is not an error.
+func (u *B2Uploader) DeleteFile(ctx context.Context, fileName string) error {
+	versions, err := u.client.listFileVersions(ctx, fileName)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		u.log.Debug("deleting file version", "name", version.FileName, "file_id", version.FileID)
+		err := u.client.call(ctx, "b2_delete_file_version", map[string]string{
+			"fileName": version.FileName,
+			"fileId":   version.FileID,
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %w", fileName, err)
+		}
+	}
+	return nil
+}
+
+// listFileVersions calls b2_list_file_versions for the versions of one file
+func (c *b2Client) listFileVersions(ctx context.Context, fileName string) ([]b2FileInfo, error) {
+	bucketID, err := c.ensureBucketID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []b2FileInfo
+	request := map[string]interface{}{
+		"bucketId":      bucketID,
+		"startFileName": fileName,
+		"prefix":        fileName,
+		"maxFileCount":  100,
+	}
+	for {
+		var resp struct {
+			Files        []b2FileInfo `json:"files"`
+			NextFileName *string      `json:"nextFileName"`
+			NextFileID   *string      `json:"nextFileId"`
+		}
+		if err := c.call(ctx, "b2_list_file_versions", request, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, f := range resp.Files {
+			// The prefix also matches longer names
+			if f.FileName == fileName {
+				versions = append(versions, f)
+			}
+		}
+
+		if resp.NextFileName == nil || *resp.NextFileName != fileName || resp.NextFileID == nil {
+			return versions, nil
+		}
+		request["startFileId"] = *resp.NextFileID
+	}
+}
+
+// CancelUnfinishedUploads cancels the large file uploads in the bucket that
+// were started but never finished, which B2 keeps (and bills for) until
+// they are cancelled. It returns the names of the files cancelled.
+func (u *B2Uploader) CancelUnfinishedUploads(ctx context.Context) ([]string, error) {
+	bucketID, err := u.client.ensureBucketID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var cancelled []string
+	request := map[string]interface{}{
+		"bucketId":     bucketID,
+		"maxFileCount": 100,
+	}
+	for {
+		var resp struct {
+			Files      []b2FileInfo `json:"files"`
+			NextFileID *string      `json:"nextFileId"`
+		}
+		if err := u.client.call(ctx, "b2_list_unfinished_large_files", request, &resp); err != nil {
+			return cancelled, err
+		}
+
+		for _, f := range resp.Files {
+			u.log.Debug("cancelling unfinished upload", "name", f.FileName, "file_id", f.FileID)
+			err := u.client.call(ctx, "b2_cancel_large_file", map[string]string{"fileId": f.FileID}, nil)
+			if err != nil {
+				return cancelled, fmt.Errorf("failed to cancel the upload of %s: %w", f.FileName, err)
+			}
+			cancelled = append(cancelled, f.FileName)
+		}
+
+		if resp.NextFileID == nil {
+			return cancelled, nil
+		}
+		request["startFileId"] = *resp.NextFileID
+	}
+}
+
+// uploadURL is a URL and token from b2_get_upload_url. Each can upload one
+// file at a time and is reused until it fails.
+type uploadURL struct {
+	url   string
+	token string
+}
+
+// b2Upload describes a file for b2_upload_file
+type b2Upload struct {
+	name        string
+	size        int64
+	contentType string
+	sha1        string
+	info        map[string]string
+	encryption  string
+	retention   *Retention
+}
+
+// uploadFile uploads content with b2_upload_file. An upload URL that fails
+// is dropped and the upload retried once with a new one, as B2 asks.
+func (c *b2Client) uploadFile(ctx context.Context, content io.ReadSeeker, upload b2Upload) (*b2FileInfo, error) {
+	for attempt := 0; ; attempt++ {
+		target, err := c.takeUploadURL(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.url, io.NopCloser(content))
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = upload.size
+		req.Header.Set("Authorization", target.token)
+		req.Header.Set("X-Bz-File-Name", b2Escape(upload.name))
+		req.Header.Set("Content-Type", upload.contentType)
+		req.Header.Set("X-Bz-Content-Sha1", upload.sha1)
+		for key, value := range upload.info {
+			req.Header.Set("X-Bz-Info-"+key, b2Escape(value))
+		}
+		if upload.encryption == EncryptionB2 {
+			req.Header.Set("X-Bz-Server-Side-Encryption", "AES256")
+		}
+		c.setCustomerKey(req.Header)
+		upload.retention.setHeaders(req.Header)
+
+		var uploaded b2FileInfo
+		err = c.do(req, &uploaded)
+		if err == nil {
+			c.mu.Lock()
+			c.uploadURLs = append(c.uploadURLs, target)
+			c.mu.Unlock()
+			return &uploaded, nil
+		}
+
+		apiErr, ok := err.(*b2Error)
+		retry := !ok || apiErr.Status == http.StatusUnauthorized || apiErr.Status == http.StatusRequestTimeout ||
+			apiErr.Status >= http.StatusInternalServerError
+		if !retry || attempt > 0 || ctx.Err() != nil {
+			return nil, err
+		}
+	}
+}
+
+// takeUploadURL returns a free upload URL, getting a new one if there is none
+func (c *b2Client) takeUploadURL(ctx context.Context) (uploadURL, error) {
+	c.mu.Lock()
+	if n := len(c.uploadURLs); n > 0 {
+		target := c.uploadURLs[n-1]
+		c.uploadURLs = c.uploadURLs[:n-1]
+		c.mu.Unlock()
+		return target, nil
+	}
+	c.mu.Unlock()
+
+	bucketID, err := c.ensureBucketID(ctx)
+	if err != nil {
+		return uploadURL{}, err
+	}
+	var resp struct {
+		UploadURL          string `json:"uploadUrl"`
+		AuthorizationToken string `json:"authorizationToken"`
+	}
+	if err := c.call(ctx, "b2_get_upload_url", map[string]string{"bucketId": bucketID}, &resp); err != nil {
+		return uploadURL{}, err
+	}
+	return uploadURL{url: resp.UploadURL, token: resp.AuthorizationToken}, nil
+}
+
+// setCustomerKey adds the SSE-C key headers, if a key is configured
+func (c *b2Client) setCustomerKey(header http.Header) {
+	if c.customerKey == nil {
+		return
+	}
+	sum := md5.Sum(c.customerKey)
+	header.Set("X-Bz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+	header.Set("X-Bz-Server-Side-Encryption-Customer-Key", base64.StdEncoding.EncodeToString(c.customerKey))
+	header.Set("X-Bz-Server-Side-Encryption-Customer-Key-Md5", base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// b2Escape percent-encodes a file name or file info value for a header,
+// keeping slashes
+func b2Escape(s string) string {
+	escaped := strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	return strings.ReplaceAll(escaped, "%2F", "/")
+}
+
+// LifecycleRule hides and deletes old file versions under a name prefix.
+// Nil durations leave that step out.
+type LifecycleRule struct {
+	FileNamePrefix            string `json:"fileNamePrefix"`
+	DaysFromUploadingToHiding *int   `json:"daysFromUploadingToHiding"`
+	DaysFromHidingToDeleting  *int   `json:"daysFromHidingToDeleting"`
+}
+
+// LifecycleRules returns the lifecycle rules of the bucket
+func (u *B2Uploader) LifecycleRules(ctx context.Context) ([]LifecycleRule, error) {
+	bucket, err := u.BucketInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bucket.LifecycleRules, nil
+}
+
+// SetLifecycleRules replaces the lifecycle rules of the bucket
+func (u *B2Uploader) SetLifecycleRules(ctx context.Context, rules []LifecycleRule) error {
+	bucketID, err := u.client.ensureBucketID(ctx)
+	if err != nil {
+		return err
+	}
+	u.client.mu.Lock()
+	accountID := u.client.accountID
+	u.client.mu.Unlock()
+
+	if rules == nil {
+		rules = []LifecycleRule{}
+	}
+	return u.client.call(ctx, "b2_update_bucket", map[string]interface{}{
+		"accountId":      accountID,
+		"bucketId":       bucketID,
+		"lifecycleRules": rules,
+	}, nil)
+}
+
+// KeepLastVersion returns the rule of B2's "keep only the last version"
+// setting: replaced or deleted versions are removed a day after they are
+// hidden
+func KeepLastVersion(prefix string) LifecycleRule {
+	days := 1
+	return LifecycleRule{FileNamePrefix: prefix, DaysFromHidingToDeleting: &days}
+}
+
+// Bucket describes a B2 bucket
+type Bucket struct {
+	ID             string
+	Name           string
+	Type           string // allPrivate or allPublic
+	LifecycleRules []LifecycleRule
+	Encryption     string // Default server-side encryption: EncryptionB2 or ""
+}
+
+// b2Bucket mirrors the bucket object returned by the B2 API
+type b2Bucket struct {
+	BucketID                    string          `json:"bucketId"`
+	BucketName                  string          `json:"bucketName"`
+	BucketType                  string          `json:"bucketType"`
+	LifecycleRules              []LifecycleRule `json:"lifecycleRules"`
+	DefaultServerSideEncryption struct {
+		Value *struct {
+			Mode string `json:"mode"`
+		} `json:"value"`
+	} `json:"defaultServerSideEncryption"`
+}
+
+func (b b2Bucket) toBucket() Bucket {
+	bucket := Bucket{ID: b.BucketID, Name: b.BucketName, Type: b.BucketType, LifecycleRules: b.LifecycleRules}
+	if v := b.DefaultServerSideEncryption.Value; v != nil && v.Mode != "none" {
+		bucket.Encryption = v.Mode
+	}
+	return bucket
+}
+
+// ListBuckets lists the buckets of the account
+func (u *B2Uploader) ListBuckets(ctx context.Context) ([]Bucket, error) {
+	accountID, err := u.client.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return u.client.listBuckets(ctx, accountID, "")
+}
+
+// BucketInfo describes the configured bucket
+func (u *B2Uploader) BucketInfo(ctx context.Context) (*Bucket, error) {
+	accountID, err := u.client.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := u.client.listBuckets(ctx, accountID, u.config.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("bucket not found: %s", u.config.BucketName)
+	}
+	return &buckets[0], nil
+}
+
+// CreateBucket creates the configured bucket, private, with the given
+// lifecycle rules and, if encryption is EncryptionB2, encrypted by default
+func (u *B2Uploader) CreateBucket(ctx context.Context, rules []LifecycleRule, encryption string) (*Bucket, error) {
+	accountID, err := u.client.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = []LifecycleRule{}
+	}
+	request := map[string]interface{}{
+		"accountId":      accountID,
+		"bucketName":     u.config.BucketName,
+		"bucketType":     "allPrivate",
+		"lifecycleRules": rules,
+	}
+	if encryption == EncryptionB2 {
+		request["defaultServerSideEncryption"] = map[string]string{"mode": EncryptionB2, "algorithm": "AES256"}
+	}
+
+	var created b2Bucket
+	if err := u.client.call(ctx, "b2_create_bucket", request, &created); err != nil {
+		return nil, err
+	}
+	bucket := created.toBucket()
+	return &bucket, nil
+}
+
+// Usage totals the files stored in a bucket
+type Usage struct {
+	Files        int64 // Current versions
+	Bytes        int64
+	OldVersions  int64 // Hidden and replaced versions, still billed
+	OldBytes     int64
+	LargeStarted int64 // Unfinished large file uploads
+}
+
+// Usage lists every file version in the bucket and totals them. B2 has no
+// usage call, so this takes a class C transaction per 1000 versions.
+func (u *B2Uploader) Usage(ctx context.Context) (*Usage, error) {
+	bucketID, err := u.client.ensureBucketID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &Usage{}
+	current := ""
+	request := map[string]interface{}{
+		"bucketId":     bucketID,
+		"maxFileCount": 1000,
+	}
+	for {
+		var resp struct {
+			Files        []b2FileInfo `json:"files"`
+			NextFileName *string      `json:"nextFileName"`
+			NextFileID   *string      `json:"nextFileId"`
+		}
+		if err := u.client.call(ctx, "b2_list_file_versions", request, &resp); err != nil {
+			return nil, err
+		}
+
+		// Versions of a file are listed newest first: the first one of each
+		// name is current unless it hides the file
+		for _, f := range resp.Files {
+			switch {
+			case f.Action == "start":
+				usage.LargeStarted++
+			case f.FileName != current && f.Action == "upload":
+				usage.Files++
+				usage.Bytes += f.ContentLength
+			default:
+				usage.OldVersions++
+				usage.OldBytes += f.ContentLength
+			}
+			current = f.FileName
+		}
+
+		if resp.NextFileName == nil {
+			return usage, nil
+		}
+		request["startFileName"] = *resp.NextFileName
+		if resp.NextFileID != nil {
+			request["startFileId"] = *resp.NextFileID
+		}
+	}
+}
+
+// account returns the account ID, authorizing first
+func (c *b2Client) account(ctx context.Context) (string, error) {
+	if err := c.authorize(ctx); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accountID, nil
+}
@@ -0,0 +1,446 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestB2Server returns a fake B2 API serving two pages of file names.
+// File versions deleted through it are appended to deleted.
+func newTestB2Server(t *testing.T, deleted ...*[]string) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/b2api/v2/b2_authorize_account", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "key-id" || pass != "app-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(b2Error{Status: 401, Code: "unauthorized", Message: "bad credentials"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"accountId":          "account",
+			"authorizationToken": "token",
+			"apiUrl":             server.URL,
+			"downloadUrl":        server.URL,
+			"allowed":            map[string]string{"bucketId": "bucket-id", "bucketName": "archive"},
+		})
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"buckets": []interface{}{}})
+	})
+	mux.HandleFunc("/b2api/v2/b2_get_download_authorization", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"authorizationToken": fmt.Sprintf("%s/%s/%v", req["bucketId"], req["fileNamePrefix"], req["validDurationInSeconds"]),
+		})
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if req["startFileName"] == nil {
+			next := "photos/b.jpg"
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"files": []b2FileInfo{
+					{FileName: "photos/a.jpg", ContentLength: 10, ContentSha1: "abc", Action: "upload"},
+					{FileName: "photos/old.jpg", ContentLength: 5, Action: "hide"},
+				},
+				"nextFileName": next,
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"files": []b2FileInfo{
+				{
+					FileName:      "photos/b.jpg",
+					ContentLength: 20,
+					ContentSha1:   "none",
+					FileInfo:      map[string]string{"large_file_sha1": "def", "src_last_modified_millis": "1000"},
+					Action:        "upload",
+				},
+			},
+		})
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_list_file_versions", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"files": []b2FileInfo{
+				{FileID: "v2", FileName: "photos/a.jpg", Action: "upload"},
+				{FileID: "v1", FileName: "photos/a.jpg", Action: "hide"},
+				{FileID: "v3", FileName: "photos/a.jpg.bak", Action: "upload"},
+			},
+		})
+	})
+	mux.HandleFunc("/b2api/v2/b2_delete_file_version", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, list := range deleted {
+			*list = append(*list, req["fileName"]+"@"+req["fileId"])
+		}
+		json.NewEncoder(w).Encode(req)
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"uploadUrl": server.URL + "/upload", "authorizationToken": "upload-token"})
+	})
+	// Uploads echo what they received as the file info, failing the first
+	// time with a busy server
+	busy := true
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		if busy {
+			busy = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(b2Error{Status: 503, Code: "service_unavailable", Message: "busy"})
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if sum := sha1.Sum(body); hex.EncodeToString(sum[:]) != r.Header.Get("X-Bz-Content-Sha1") || r.Header.Get("Authorization") != "upload-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(b2Error{Status: 400, Code: "bad_request", Message: "checksum mismatch"})
+			return
+		}
+		name, _ := url.QueryUnescape(r.Header.Get("X-Bz-File-Name"))
+		info := map[string]string{
+			"sse":     r.Header.Get("X-Bz-Server-Side-Encryption"),
+			"sse_c":   r.Header.Get("X-Bz-Server-Side-Encryption-Customer-Key-Md5"),
+			"content": string(body),
+		}
+		for key := range r.Header {
+			if strings.HasPrefix(key, "X-Bz-Info-") {
+				info[strings.ToLower(strings.TrimPrefix(key, "X-Bz-Info-"))], _ = url.QueryUnescape(r.Header.Get(key))
+			}
+		}
+		json.NewEncoder(w).Encode(b2FileInfo{FileID: "uploaded", FileName: name, FileInfo: info, UploadTimestamp: 1000})
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_download_file_by_id", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token" || r.URL.Query().Get("fileId") != "v2" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(b2Error{Status: 404, Code: "not_found", Message: "no such version"})
+			return
+		}
+		io.WriteString(w, "version two")
+	})
+
+	mux.HandleFunc("/file/archive/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(b2Error{Status: 401, Code: "unauthorized", Message: "no token"})
+			return
+		}
+		if r.URL.Path != "/file/archive/photos/a.jpg" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(b2Error{Status: 404, Code: "not_found", Message: "file not present"})
+			return
+		}
+		http.ServeContent(w, r, "a.jpg", time.Time{}, strings.NewReader("0123456789"))
+	})
+
+	server = httptest.NewServer(mux)
+	return server
+}
+
+func TestListFiles(t *testing.T) {
+	server := newTestB2Server(t)
+	defer server.Close()
+
+	uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "app-key", BucketName: "archive"})
+	if err != nil {
+		t.Fatalf("Failed to create uploader: %v", err)
+	}
+	defer uploader.Close()
+	uploader.client.authURL = server.URL + "/b2api/v2/b2_authorize_account"
+
+	var files []RemoteFile
+	err = uploader.ListFiles(context.Background(), "photos/", func(f RemoteFile) error {
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files (hidden versions skipped), got %d", len(files))
+	}
+	if files[0].SHA1 != "abc" {
+		t.Errorf("Expected SHA1 abc, got %s", files[0].SHA1)
+	}
+	if files[1].SHA1 != "def" {
+		t.Errorf("Expected large file SHA1 def, got %s", files[1].SHA1)
+	}
+	if files[1].ModTime.UnixMilli() != 1000 {
+		t.Errorf("Expected mod time from src_last_modified_millis, got %v", files[1].ModTime)
+	}
+	if want := server.URL + "/file/archive/photos/b.jpg"; files[1].URL != want {
+		t.Errorf("Expected URL %s, got %s", want, files[1].URL)
+	}
+}
+
+func TestListFilesBadCredentials(t *testing.T) {
+	server := newTestB2Server(t)
+	defer server.Close()
+
+	uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "wrong", BucketName: "archive"})
+	if err != nil {
+		t.Fatalf("Failed to create uploader: %v", err)
+	}
+	defer uploader.Close()
+	uploader.client.authURL = server.URL + "/b2api/v2/b2_authorize_account"
+
+	err = uploader.ListFiles(context.Background(), "", func(RemoteFile) error { return nil })
+	if err == nil {
+		t.Fatal("Expected an authorization error")
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	server := newTestB2Server(t)
+	defer server.Close()
+
+	for _, tt := range []struct {
+		appKey, bucket string
+		ok             bool
+	}{
+		{"app-key", "archive", true},
+		{"wrong", "archive", false},
+		{"app-key", "missing", false},
+	} {
+		uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: tt.appKey, BucketName: tt.bucket})
+		if err != nil {
+			t.Fatalf("Failed to create uploader: %v", err)
+		}
+		uploader.client.authURL = server.URL + "/b2api/v2/b2_authorize_account"
+
+		err = uploader.CheckAccess(context.Background())
+		if (err == nil) != tt.ok {
+			t.Errorf("CheckAccess(%s, %s) = %v, want ok %v", tt.appKey, tt.bucket, err, tt.ok)
+		}
+		uploader.Close()
+	}
+}
+
+func TestDeleteFile(t *testing.T) {
+	var deleted []string
+	server := newTestB2Server(t, &deleted)
+	defer server.Close()
+
+	uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "app-key", BucketName: "archive"})
+	if err != nil {
+		t.Fatalf("Failed to create uploader: %v", err)
+	}
+	defer uploader.Close()
+	uploader.client.authURL = server.URL + "/b2api/v2/b2_authorize_account"
+
+	name, err := uploader.RemoteName(server.URL + "/file/archive/photos/a.jpg")
+	if err != nil {
+		t.Fatalf("RemoteName failed: %v", err)
+	}
+	if err := uploader.DeleteFile(context.Background(), name); err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+
+	want := []string{"photos/a.jpg@v2", "photos/a.jpg@v1"}
+	if len(deleted) != len(want) || deleted[0] != want[0] || deleted[1] != want[1] {
+		t.Errorf("Expected deleted versions %v, got %v", want, deleted)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	server := newTestB2Server(t)
+	defer server.Close()
+
+	uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "app-key", BucketName: "archive"})
+	if err != nil {
+		t.Fatalf("Failed to create uploader: %v", err)
+	}
+	defer uploader.Close()
+	uploader.client.authURL = server.URL + "/b2api/v2/b2_authorize_account"
+
+	var buf bytes.Buffer
+	if err := uploader.Download(context.Background(), server.URL+"/file/archive/photos/a.jpg", &buf); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if buf.String() != "0123456789" {
+		t.Errorf("Expected the file content, got %q", buf.String())
+	}
+
+	err = uploader.Download(context.Background(), server.URL+"/file/archive/photos/missing.jpg", &buf)
+	if err == nil || !strings.Contains(err.Error(), "not_found") {
+		t.Errorf("Expected a not_found error, got %v", err)
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	server := newTestB2Server(t)
+	defer server.Close()
+
+	uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "app-key", BucketName: "archive"})
+	if err != nil {
+		t.Fatalf("Failed to create uploader: %v", err)
+	}
+	defer uploader.Close()
+	uploader.client.authURL = server.URL + "/b2api/v2/b2_authorize_account"
+
+	fileURL := server.URL + "/file/archive/photos/a.jpg"
+	for _, tc := range []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 4, "0123"},
+		{6, 10, "6789"},
+		{20, 5, ""},
+	} {
+		var buf bytes.Buffer
+		n, err := uploader.DownloadRange(context.Background(), fileURL, tc.offset, tc.length, &buf)
+		if err != nil {
+			t.Fatalf("DownloadRange(%d, %d) failed: %v", tc.offset, tc.length, err)
+		}
+		if buf.String() != tc.want || n != int64(len(tc.want)) {
+			t.Errorf("DownloadRange(%d, %d) = %q (%d bytes), want %q", tc.offset, tc.length, buf.String(), n, tc.want)
+		}
+	}
+}
+
+func TestStreamURL(t *testing.T) {
+	server := newTestB2Server(t)
+	defer server.Close()
+
+	uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "app-key", BucketName: "archive"})
+	if err != nil {
+		t.Fatalf("Failed to create uploader: %v", err)
+	}
+	defer uploader.Close()
+	uploader.client.authURL = server.URL + "/b2api/v2/b2_authorize_account"
+
+	fileURL := server.URL + "/file/archive/videos/clip%201.mp4"
+	got, err := uploader.StreamURL(context.Background(), fileURL, time.Hour)
+	if err != nil {
+		t.Fatalf("StreamURL failed: %v", err)
+	}
+	if want := fileURL + "?Authorization=bucket-id%2Fvideos%2Fclip+1.mp4%2F3600"; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	if _, err := uploader.StreamURL(context.Background(), fileURL, 8*24*time.Hour); err == nil {
+		t.Error("Expected an error for a duration over the B2 limit")
+	}
+	if _, err := uploader.StreamURL(context.Background(), server.URL+"/file/other/a.mp4", time.Hour); err == nil {
+		t.Error("Expected an error for a file in another bucket")
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	server := newTestB2Server(t)
+	defer server.Close()
+
+	key := bytes.Repeat([]byte{7}, 32)
+	uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "app-key", BucketName: "archive",
+		Encryption: EncryptionCustomer, CustomerKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uploader.Close()
+	uploader.client.authURL = server.URL + "/b2api/v2/b2_authorize_account"
+
+	content := "hello"
+	sum := sha1.Sum([]byte(content))
+	uploaded, err := uploader.client.uploadFile(context.Background(), strings.NewReader(content), b2Upload{
+		name:        "photos/2016/a b+c.jpg",
+		size:        int64(len(content)),
+		contentType: "image/jpeg",
+		sha1:        hex.EncodeToString(sum[:]),
+		info:        map[string]string{"drive": "Old Drive", "run_id": "12"},
+	})
+	if err != nil {
+		t.Fatalf("upload failed after a retry: %v", err)
+	}
+	if uploaded.FileName != "photos/2016/a b+c.jpg" {
+		t.Errorf("file name not encoded for B2: %q", uploaded.FileName)
+	}
+	for key, want := range map[string]string{"drive": "Old Drive", "run_id": "12", "content": content} {
+		if got := uploaded.FileInfo[key]; got != want {
+			t.Errorf("%s: got %q, want %q", key, got, want)
+		}
+	}
+	if uploaded.FileInfo["sse_c"] == "" || uploaded.FileInfo["sse"] != "" {
+		t.Errorf("SSE-C headers not sent: %v", uploaded.FileInfo)
+	}
+
+	if _, err := NewB2Uploader(B2Config{KeyID: "k", AppKey: "a", BucketName: "b", Encryption: EncryptionCustomer}); err == nil {
+		t.Error("SSE-C without a key should be rejected")
+	}
+}
+
+func TestUsage(t *testing.T) {
+	server := newTestB2Server(t)
+	defer server.Close()
+
+	uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "app-key", BucketName: "archive"})
+	if err != nil {
+		t.Fatalf("Failed to create uploader: %v", err)
+	}
+	defer uploader.Close()
+	uploader.client.authURL = server.URL + "/b2api/v2/b2_authorize_account"
+
+	usage, err := uploader.Usage(context.Background())
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if usage.Files != 2 || usage.OldVersions != 1 {
+		t.Errorf("Expected 2 files and 1 old version, got %+v", usage)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	server := newTestB2Server(t)
+	defer server.Close()
+
+	uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "app-key", BucketName: "archive"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uploader.Close()
+	uploader.client.authURL = server.URL + "/b2api/v2/b2_authorize_account"
+
+	ctx := context.Background()
+	fileURL := server.URL + "/file/archive/photos/a.jpg"
+	versions, err := uploader.Versions(ctx, fileURL)
+	if err != nil {
+		t.Fatalf("Versions failed: %v", err)
+	}
+	if len(versions) != 1 || versions[0].FileID != "v2" {
+		t.Fatalf("expected only the uploaded version of the file, got %+v", versions)
+	}
+	if _, err := uploader.VersionAt(ctx, fileURL, time.UnixMilli(5)); err == nil {
+		t.Error("expected no version uploaded at that time")
+	}
+
+	var buf bytes.Buffer
+	if err := uploader.DownloadVersion(ctx, "v2", &buf); err != nil {
+		t.Fatalf("DownloadVersion failed: %v", err)
+	}
+	if buf.String() != "version two" {
+		t.Errorf("downloaded %q", buf.String())
+	}
+	if err := uploader.DownloadVersion(ctx, "v1", &buf); err == nil {
+		t.Error("expected an error for a missing version")
+	}
+}
@@ -2,13 +2,25 @@ package upload
 
 import (
 	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/jth/archiver/internal/drives"
+	"github.com/jth/archiver/internal/logging"
+	"github.com/jth/archiver/internal/remotename"
 )
 
 // B2Config represents the configuration for Backblaze B2
@@ -17,9 +29,24 @@ type B2Config struct {
 	AppKey     string
 	BucketName string
 	Prefix     string
-	Concurrent int
+	// NameTemplate names the files given to Upload; by default they are
+	// named by their base name below Prefix
+	NameTemplate *remotename.Template
+	// Encryption is the server-side encryption of uploads: EncryptionB2,
+	// EncryptionCustomer with CustomerKey, or "" for the bucket default
+	Encryption  string
+	CustomerKey []byte // AES-256 key for EncryptionCustomer
+	Concurrent  int
+	Timeout     time.Duration // Per file; 0 for no limit
+	Logger      *slog.Logger  // Defaults to slog.Default()
 }
 
+// Server-side encryption modes
+const (
+	EncryptionB2       = "SSE-B2" // Keys managed by B2
+	EncryptionCustomer = "SSE-C"  // Key supplied with every upload and download
+)
+
 // UploadResult represents the result of an upload operation
 type UploadResult struct {
 	LocalPath   string
@@ -31,6 +58,7 @@ type UploadResult struct {
 	UploadedAt  time.Time
 	ElapsedTime time.Duration
 	Error       error
+	FileID      string
 }
 
 // B2Uploader handles file uploads to Backblaze B2
@@ -41,11 +69,18 @@ type B2Uploader struct {
 	mutex  sync.Mutex
 	queue  chan uploadTask
 	done   chan struct{}
+	log    *slog.Logger
+
+	namesMu sync.Mutex
+	names   map[string]string // Local path of each name generated
 }
 
 type uploadTask struct {
+	ctx        context.Context
 	localPath  string
 	remotePath string
+	info       map[string]string
+	retention  *Retention // Object Lock setting, or nil
 	resultChan chan *UploadResult
 }
 
@@ -62,6 +97,16 @@ func NewB2Uploader(config B2Config) (*B2Uploader, error) {
 		return nil, errors.New("B2 Bucket Name is required")
 	}
 
+	switch config.Encryption {
+	case "", EncryptionB2:
+	case EncryptionCustomer:
+		if len(config.CustomerKey) != 32 {
+			return nil, fmt.Errorf("%s needs a 256-bit key, got %d bytes", EncryptionCustomer, len(config.CustomerKey))
+		}
+	default:
+		return nil, fmt.Errorf("unknown encryption %q (expected %s or %s)", config.Encryption, EncryptionB2, EncryptionCustomer)
+	}
+
 	// Set default concurrency
 	if config.Concurrent <= 0 {
 		config.Concurrent = 4
@@ -72,12 +117,17 @@ func NewB2Uploader(config B2Config) (*B2Uploader, error) {
 	if err != nil {
 		return nil, err
 	}
+	if config.Encryption == EncryptionCustomer {
+		client.customerKey = config.CustomerKey
+	}
 
 	uploader := &B2Uploader{
 		config: config,
 		client: client,
 		queue:  make(chan uploadTask, 100),
 		done:   make(chan struct{}),
+		log:    logging.OrDefault(config.Logger),
+		names:  make(map[string]string),
 	}
 
 	// Start worker goroutines
@@ -88,8 +138,31 @@ func NewB2Uploader(config B2Config) (*B2Uploader, error) {
 	return uploader, nil
 }
 
-// Upload uploads a file to B2
+// Upload uploads a file to B2 under the name the template gives it, or its
+// base name below the configured prefix. Giving two files the same name is
+// an error.
 func (u *B2Uploader) Upload(ctx context.Context, localPath string) (*UploadResult, error) {
+	remotePath, err := u.generateRemotePath(localPath)
+	if err != nil {
+		return nil, err
+	}
+	return u.UploadAs(ctx, localPath, remotePath)
+}
+
+// UploadAs uploads a file to B2 under the given remote name
+func (u *B2Uploader) UploadAs(ctx context.Context, localPath, remotePath string) (*UploadResult, error) {
+	return u.UploadWithInfo(ctx, localPath, remotePath, nil)
+}
+
+// UploadWithInfo uploads a file to B2 under the given remote name with
+// custom file info, such as the drive it came from, which B2 stores with
+// the file and lists with it
+func (u *B2Uploader) UploadWithInfo(ctx context.Context, localPath, remotePath string, info map[string]string) (*UploadResult, error) {
+	return u.upload(ctx, localPath, remotePath, info, nil)
+}
+
+// upload queues a file for the workers and waits for its upload
+func (u *B2Uploader) upload(ctx context.Context, localPath, remotePath string, info map[string]string, retention *Retention) (*UploadResult, error) {
 	// Check if file exists
 	fileInfo, err := os.Stat(localPath)
 	if err != nil {
@@ -99,15 +172,12 @@ func (u *B2Uploader) Upload(ctx context.Context, localPath string) (*UploadResul
 		return nil, errors.New("directories cannot be uploaded directly")
 	}
 
-	// Generate remote path
-	remotePath := u.generateRemotePath(localPath)
-
 	// Create a channel for the result
 	resultChan := make(chan *UploadResult, 1)
 
 	// Add task to queue
 	select {
-	case u.queue <- uploadTask{localPath, remotePath, resultChan}:
+	case u.queue <- uploadTask{ctx, localPath, remotePath, info, retention, resultChan}:
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
@@ -159,7 +229,13 @@ func (u *B2Uploader) worker() {
 	for {
 		select {
 		case task := <-u.queue:
-			result := u.processUpload(task.localPath, task.remotePath)
+			result := u.processUpload(task)
+			if result.Error != nil {
+				u.log.Error("upload failed", "path", task.localPath, "error", result.Error)
+			} else {
+				u.log.Debug("uploaded", "path", task.localPath, "url", result.URL,
+					"size", result.Size, "elapsed", result.ElapsedTime)
+			}
 			task.resultChan <- result
 		case <-u.done:
 			return
@@ -167,58 +243,142 @@ func (u *B2Uploader) worker() {
 	}
 }
 
-// processUpload uploads a file to B2
-func (u *B2Uploader) processUpload(localPath, remotePath string) *UploadResult {
+// processUpload uploads a file to B2 with b2_upload_file
+func (u *B2Uploader) processUpload(task uploadTask) *UploadResult {
 	startTime := time.Now()
 
 	result := &UploadResult{
-		LocalPath:  localPath,
-		RemotePath: remotePath,
-		UploadedAt: startTime,
+		LocalPath:   task.localPath,
+		RemotePath:  task.remotePath,
+		ContentType: detectContentType(task.localPath),
+		UploadedAt:  startTime,
 	}
 
-	// Get file info
-	fileInfo, err := os.Stat(localPath)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to stat file: %w", err)
-		return result
+	// A file that takes too long fails, so that a stalled transfer doesn't
+	// hold up the queue
+	ctx := task.ctx
+	if u.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, u.config.Timeout,
+			fmt.Errorf("upload timed out after %s", u.config.Timeout))
+		defer cancel()
 	}
-	result.Size = fileInfo.Size()
 
 	// Open the file
-	file, err := os.Open(localPath)
+	file, err := os.Open(task.localPath)
 	if err != nil {
 		result.Error = fmt.Errorf("failed to open file: %w", err)
 		return result
 	}
 	defer file.Close()
 
-	// In a real implementation, this would call the B2 API
-	// This is a placeholder implementation
-	// Simulating a successful upload
-	time.Sleep(time.Duration(fileInfo.Size()/1000000) * time.Millisecond) // Simulate upload time based on file size
+	fileInfo, err := file.Stat()
+	if err != nil {
+		result.Error = fmt.Errorf("failed to stat file: %w", err)
+		return result
+	}
+	result.Size = fileInfo.Size()
+
+	// B2 checks the content against its SHA-1, sent ahead of it
+	hash := sha1.New()
+	if _, err := io.Copy(hash, readerWithContext{ctx, file}); err != nil {
+		result.Error = fmt.Errorf("failed to read file: %w", timedOut(ctx, task.ctx, err))
+		return result
+	}
+	result.SHA1 = hex.EncodeToString(hash.Sum(nil))
+
+	info := map[string]string{"src_last_modified_millis": strconv.FormatInt(fileInfo.ModTime().UnixMilli(), 10)}
+	for key, value := range task.info {
+		info[key] = value
+	}
 
-	url := fmt.Sprintf("https://f000.backblazeb2.com/file/%s/%s", u.config.BucketName, remotePath)
+	uploaded, err := u.client.uploadFile(ctx, file, b2Upload{
+		name:        task.remotePath,
+		size:        result.Size,
+		contentType: result.ContentType,
+		sha1:        result.SHA1,
+		info:        info,
+		encryption:  u.config.Encryption,
+		retention:   task.retention,
+	})
+	if err != nil {
+		result.Error = fmt.Errorf("failed to upload %s: %w", task.remotePath, timedOut(ctx, task.ctx, err))
+		return result
+	}
 
-	result.URL = url
-	result.ContentType = detectContentType(localPath)
-	result.SHA1 = "placeholder-sha1-hash"
+	result.FileID = uploaded.FileID
+	result.URL = u.client.fileURL(task.remotePath)
+	if uploaded.UploadTimestamp > 0 {
+		result.UploadedAt = time.UnixMilli(uploaded.UploadTimestamp)
+	}
 	result.ElapsedTime = time.Since(startTime)
 
 	return result
 }
 
-// generateRemotePath generates a remote path for the file
-func (u *B2Uploader) generateRemotePath(localPath string) string {
-	// Extract the base name
-	fileName := filepath.Base(localPath)
+// timedOut returns the cause of ctx in place of err if ctx ran out of time
+// while its parent, which the caller cancels, did not
+func timedOut(ctx, parent context.Context, err error) error {
+	if ctx.Err() != nil && parent.Err() == nil {
+		return context.Cause(ctx)
+	}
+	return err
+}
+
+// generateRemotePath generates a remote path for the file and checks that
+// no other file uploaded by this uploader was given the same one
+func (u *B2Uploader) generateRemotePath(localPath string) (string, error) {
+	remotePath, err := u.templatePath(localPath)
+	if err != nil {
+		return "", err
+	}
+
+	u.namesMu.Lock()
+	defer u.namesMu.Unlock()
+	if other, ok := u.names[remotePath]; ok && other != localPath {
+		return "", fmt.Errorf("remote name collision: %s and %s are both named %s", other, localPath, remotePath)
+	}
+	u.names[remotePath] = localPath
+	return remotePath, nil
+}
+
+// templatePath evaluates the name template for a file
+func (u *B2Uploader) templatePath(localPath string) (string, error) {
+	if u.config.NameTemplate == nil {
+		return path.Join(u.config.Prefix, filepath.Base(localPath)), nil
+	}
 
-	// Combine with prefix if provided
-	if u.config.Prefix != "" {
-		return filepath.Join(u.config.Prefix, fileName)
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+	vars := remotename.Vars{
+		Prefix: u.config.Prefix,
+		Path:   localPath,
+		Drive:  drives.NameFromPath(localPath),
+		Date:   info.ModTime(),
+	}
+	if u.config.NameTemplate.Uses("hash") {
+		if vars.SHA256, err = hashFile(localPath); err != nil {
+			return "", err
+		}
 	}
+	return u.config.NameTemplate.Execute(vars)
+}
+
+// hashFile returns the SHA-256 of a file in hex
+func hashFile(localPath string) (string, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
 
-	return fileName
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 // detectContentType detects the content type of a file
@@ -256,8 +416,8 @@ func detectContentType(path string) string {
 	}
 }
 
-// b2Client is a placeholder for a real B2 client
-// In a real implementation, this would use the B2 API
+// b2Client talks to the Backblaze B2 native API. It authorizes lazily on
+// the first call that needs the API.
 type b2Client struct {
 	keyID      string
 	appKey     string
@@ -265,26 +425,34 @@ type b2Client struct {
 	authToken  string
 	apiURL     string
 	bucketID   string
+
+	mu          sync.Mutex
+	authURL     string
+	accountID   string
+	downloadURL string
+	authorized  bool
+	httpClient  *http.Client
+	// Downloads can take much longer than API calls and are bounded by
+	// their context instead
+	downloadClient *http.Client
+
+	uploadURLs  []uploadURL // Upload URLs free for reuse
+	customerKey []byte      // SSE-C key sent with uploads and downloads
 }
 
 // newB2Client creates a new B2 client
 func newB2Client(keyID, appKey, bucketName string) (*b2Client, error) {
-	// In a real implementation, this would authenticate with B2
 	client := &b2Client{
-		keyID:      keyID,
-		appKey:     appKey,
-		bucketName: bucketName,
-		authToken:  "placeholder-auth-token",
-		apiURL:     "https://api.backblazeb2.com",
-		bucketID:   "placeholder-bucket-id",
+		keyID:       keyID,
+		appKey:      appKey,
+		bucketName:  bucketName,
+		authURL:     "https://api.backblazeb2.com/b2api/v2/b2_authorize_account",
+		apiURL:      "https://api.backblazeb2.com",
+		downloadURL: "https://f000.backblazeb2.com",
+		httpClient:  &http.Client{Timeout: 60 * time.Second},
+
+		downloadClient: &http.Client{},
 	}
 
 	return client, nil
 }
-
-// In a real implementation, this would have methods for interacting with the B2 API:
-// - authorizeAccount
-// - getBucket
-// - getUploadURL
-// - uploadFile
-// - etc.
@@ -0,0 +1,78 @@
+package upload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jth/archiver/internal/remotename"
+)
+
+func TestGenerateRemotePath(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/notes.txt", "b/notes.txt"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "app-key", BucketName: "archive", Prefix: "docs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uploader.Close()
+	if got, err := uploader.generateRemotePath(filepath.Join(dir, "a/notes.txt")); err != nil || got != "docs/notes.txt" {
+		t.Errorf("got %q (%v)", got, err)
+	}
+	if _, err := uploader.generateRemotePath(filepath.Join(dir, "b/notes.txt")); err == nil {
+		t.Error("two files named docs/notes.txt should collide")
+	}
+
+	template, err := remotename.Parse("{prefix}/{hash[:8]}/{name}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploader, err = NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "app-key", BucketName: "archive", Prefix: "docs", NameTemplate: template})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uploader.Close()
+	a, errA := uploader.generateRemotePath(filepath.Join(dir, "a/notes.txt"))
+	b, errB := uploader.generateRemotePath(filepath.Join(dir, "b/notes.txt"))
+	if errA != nil || errB != nil || a == b || filepath.Dir(a) == "docs" {
+		t.Errorf("hashed names should differ: %q (%v), %q (%v)", a, errA, b, errB)
+	}
+}
+
+func TestLocalDestination(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(src, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	dest, err := NewLocalDestination(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := dest.Put(context.Background(), src, "docs/2024/notes.txt", nil)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "docs", "2024", "notes.txt")); err != nil || string(data) != "hello" {
+		t.Errorf("copy = %q (%v)", data, err)
+	}
+	if result.Size != 5 || result.SHA1 != "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	if _, err := dest.Put(context.Background(), src, "../escape.txt", nil); err == nil {
+		t.Error("a name leaving the folder should fail")
+	}
+	if _, err := NewLocalDestination(filepath.Join(root, "unmounted")); err == nil {
+		t.Error("a missing folder should fail")
+	}
+}
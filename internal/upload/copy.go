@@ -0,0 +1,153 @@
+package upload
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// B2 copies files up to maxCopyFileSize in one call; larger files are
+// copied as a large file in parts of copyPartSize
+const (
+	maxCopyFileSize = 5 * 1000 * 1000 * 1000
+	copyPartSize    = 1 << 30
+)
+
+// CopyFrom copies a file from another bucket of the account under the same
+// name. The copy is made by B2 without downloading the file.
+func (u *B2Uploader) CopyFrom(ctx context.Context, src *B2Uploader, name string) (*UploadResult, error) {
+	start := time.Now()
+	source, err := src.client.findFile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	bucketID, err := u.client.ensureBucketID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	srcEncryption := encryptionSetting(src.config.Encryption, src.config.CustomerKey)
+	dstEncryption := encryptionSetting(u.config.Encryption, u.config.CustomerKey)
+	var copied *b2FileInfo
+	if source.ContentLength <= maxCopyFileSize {
+		request := map[string]interface{}{
+			"sourceFileId":        source.FileID,
+			"destinationBucketId": bucketID,
+			"fileName":            name,
+		}
+		if srcEncryption != nil {
+			request["sourceServerSideEncryption"] = srcEncryption
+		}
+		if dstEncryption != nil {
+			request["destinationServerSideEncryption"] = dstEncryption
+		}
+		copied = &b2FileInfo{}
+		err = u.client.call(ctx, "b2_copy_file", request, copied)
+	} else {
+		copied, err = u.client.copyLargeFile(ctx, bucketID, source, srcEncryption, dstEncryption)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy %s: %w", name, err)
+	}
+
+	result := &UploadResult{
+		RemotePath:  name,
+		URL:         u.client.fileURL(name),
+		Size:        source.ContentLength,
+		ContentType: source.ContentType,
+		SHA1:        source.ContentSha1,
+		FileID:      copied.FileID,
+		UploadedAt:  time.Now(),
+		ElapsedTime: time.Since(start),
+	}
+	if copied.UploadTimestamp > 0 {
+		result.UploadedAt = time.UnixMilli(copied.UploadTimestamp)
+	}
+	return result, nil
+}
+
+// copyLargeFile copies a file over maxCopyFileSize in parts with
+// b2_copy_part. An unfinished copy is cancelled.
+func (c *b2Client) copyLargeFile(ctx context.Context, bucketID string, source *b2FileInfo,
+	srcEncryption, dstEncryption map[string]string) (*b2FileInfo, error) {
+	start := map[string]interface{}{
+		"bucketId":    bucketID,
+		"fileName":    source.FileName,
+		"contentType": source.ContentType,
+		"fileInfo":    source.FileInfo,
+	}
+	if dstEncryption != nil {
+		start["serverSideEncryption"] = dstEncryption
+	}
+	var large b2FileInfo
+	if err := c.call(ctx, "b2_start_large_file", start, &large); err != nil {
+		return nil, err
+	}
+
+	var sha1s []string
+	for offset, part := int64(0), 1; offset < source.ContentLength; offset, part = offset+copyPartSize, part+1 {
+		end := min(offset+copyPartSize, source.ContentLength) - 1
+		request := map[string]interface{}{
+			"sourceFileId": source.FileID,
+			"largeFileId":  large.FileID,
+			"partNumber":   part,
+			"range":        fmt.Sprintf("bytes=%d-%d", offset, end),
+		}
+		if srcEncryption != nil {
+			request["sourceServerSideEncryption"] = srcEncryption
+		}
+		if dstEncryption != nil && dstEncryption["mode"] == EncryptionCustomer {
+			request["destinationServerSideEncryption"] = dstEncryption
+		}
+		var copied struct {
+			ContentSha1 string `json:"contentSha1"`
+		}
+		if err := c.call(ctx, "b2_copy_part", request, &copied); err != nil {
+			c.call(context.WithoutCancel(ctx), "b2_cancel_large_file", map[string]string{"fileId": large.FileID}, nil)
+			return nil, err
+		}
+		sha1s = append(sha1s, copied.ContentSha1)
+	}
+
+	var finished b2FileInfo
+	err := c.call(ctx, "b2_finish_large_file", map[string]interface{}{
+		"fileId":        large.FileID,
+		"partSha1Array": sha1s,
+	}, &finished)
+	if err != nil {
+		return nil, err
+	}
+	return &finished, nil
+}
+
+// findFile returns the current version of a file in the bucket
+func (c *b2Client) findFile(ctx context.Context, name string) (*b2FileInfo, error) {
+	files, _, err := c.listFileNames(ctx, name, name, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 || files[0].FileName != name {
+		return nil, fmt.Errorf("%s not found in bucket %s", name, c.bucketName)
+	}
+	return &files[0], nil
+}
+
+// encryptionSetting returns the B2 server-side encryption setting of an
+// encryption mode, or nil for the bucket default
+func encryptionSetting(mode string, customerKey []byte) map[string]string {
+	switch mode {
+	case EncryptionB2:
+		return map[string]string{"mode": EncryptionB2, "algorithm": "AES256"}
+	case EncryptionCustomer:
+		sum := md5.Sum(customerKey)
+		return map[string]string{
+			"mode":           EncryptionCustomer,
+			"algorithm":      "AES256",
+			"customerKey":    base64.StdEncoding.EncodeToString(customerKey),
+			"customerKeyMd5": base64.StdEncoding.EncodeToString(sum[:]),
+		}
+	}
+	return nil
+}
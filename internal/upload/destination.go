@@ -0,0 +1,158 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jth/archiver/internal/scratch"
+)
+
+// Destination is somewhere files are uploaded to under a remote name
+type Destination interface {
+	Put(ctx context.Context, localPath, remotePath string, info map[string]string) (*UploadResult, error)
+}
+
+// Put uploads a file under the given remote name, returning the upload's
+// error as an error
+func (u *B2Uploader) Put(ctx context.Context, localPath, remotePath string, info map[string]string) (*UploadResult, error) {
+	result, err := u.UploadWithInfo(ctx, localPath, remotePath, info)
+	if err != nil {
+		return nil, err
+	}
+	return result, result.Error
+}
+
+// LocalDestination copies files into a folder, such as a mounted NAS share,
+// laid out by their remote names
+type LocalDestination struct {
+	Root string
+}
+
+// NewLocalDestination creates a destination copying into root, which must
+// be an existing folder so that an unmounted share isn't filled in on the
+// local disk
+func NewLocalDestination(root string) (*LocalDestination, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("replica folder not available: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a folder", root)
+	}
+	return &LocalDestination{Root: root}, nil
+}
+
+// StreamDestination is somewhere content streamed from another provider
+// can be stored
+type StreamDestination interface {
+	PutStream(ctx context.Context, remotePath string, body io.Reader, size int64, contentType string) (*UploadResult, error)
+}
+
+// Put copies a file to the remote name below the folder, keeping its
+// modification time. info is not kept.
+func (d *LocalDestination) Put(ctx context.Context, localPath, remotePath string, info map[string]string) (*UploadResult, error) {
+	src, err := os.Open(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+	srcInfo, err := src.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	result, err := d.write(ctx, remotePath, src, srcInfo.Size(), srcInfo.ModTime())
+	if err != nil {
+		return nil, err
+	}
+	result.LocalPath = localPath
+	result.ContentType = detectContentType(localPath)
+	return result, nil
+}
+
+// PutStream writes content to the remote name below the folder
+func (d *LocalDestination) PutStream(ctx context.Context, remotePath string, body io.Reader, size int64, contentType string) (*UploadResult, error) {
+	result, err := d.write(ctx, remotePath, body, max(size, 0), time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 && result.Size != size {
+		return nil, fmt.Errorf("copied %d of %d bytes of %s", result.Size, size, remotePath)
+	}
+	result.ContentType = contentType
+	return result, nil
+}
+
+// write stores content under the remote name below the folder. The copy is
+// written next to its target and renamed into place, so an interrupted copy
+// never leaves a partial file under the final name. Copies that would
+// leave the disk with less than the minimum free space fail with
+// scratch.ErrDiskFull.
+func (d *LocalDestination) write(ctx context.Context, remotePath string, content io.Reader, expected int64, modTime time.Time) (*UploadResult, error) {
+	start := time.Now()
+	if remotePath == "" || strings.HasPrefix(remotePath, "/") || strings.Contains("/"+remotePath+"/", "/../") {
+		return nil, fmt.Errorf("invalid remote name %q", remotePath)
+	}
+	if err := scratch.Ensure(d.Root, expected); err != nil {
+		return nil, fmt.Errorf("cannot copy %s: %w", remotePath, err)
+	}
+	target := filepath.Join(d.Root, filepath.FromSlash(remotePath))
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create folder: %w", err)
+	}
+	tmp := target + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create copy: %w", err)
+	}
+
+	hash := sha1.New()
+	size, err := io.Copy(io.MultiWriter(dst, hash), readerWithContext{ctx, content})
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && !modTime.IsZero() {
+		err = os.Chtimes(tmp, modTime, modTime)
+	}
+	if err == nil {
+		err = os.Rename(tmp, target)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to copy %s: %w", remotePath, err)
+	}
+
+	return &UploadResult{
+		RemotePath:  remotePath,
+		URL:         (&url.URL{Scheme: "file", Path: filepath.ToSlash(target)}).String(),
+		Size:        size,
+		SHA1:        hex.EncodeToString(hash.Sum(nil)),
+		UploadedAt:  time.Now(),
+		ElapsedTime: time.Since(start),
+	}, nil
+}
+
+// readerWithContext stops a copy when its context is cancelled
+type readerWithContext struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r readerWithContext) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
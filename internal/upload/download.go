@@ -0,0 +1,152 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Download writes the content of the file at a download URL, as recorded in
+// the catalog, to w. The request is authorized with the account's token, so
+// files in private buckets can be read.
+func (u *B2Uploader) Download(ctx context.Context, fileURL string, w io.Writer) error {
+	resp, err := u.client.get(ctx, fileURL, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("download %s: %w", fileURL, err)
+	}
+	return nil
+}
+
+// Object is a remote file open for reading
+type Object struct {
+	io.ReadCloser
+	Size        int64
+	ContentType string
+}
+
+// Open opens the file at a download URL for reading, to stream it elsewhere.
+// The caller closes it.
+func (u *B2Uploader) Open(ctx context.Context, fileURL string) (*Object, error) {
+	resp, err := u.client.get(ctx, fileURL, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Object{ReadCloser: resp.Body, Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}, nil
+}
+
+// DownloadRange writes up to length bytes of the file at a download URL,
+// starting at offset, to w with a ranged request, and returns the number of
+// bytes written. Fewer bytes are written when the file ends first.
+func (u *B2Uploader) DownloadRange(ctx context.Context, fileURL string, offset, length int64, w io.Writer) (int64, error) {
+	resp, err := u.client.get(ctx, fileURL, fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	var apiErr *b2Error
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusRequestedRangeNotSatisfiable {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// A server ignoring the range sends the whole file
+	body := io.Reader(resp.Body)
+	if resp.StatusCode == http.StatusOK && offset > 0 {
+		if _, err := io.CopyN(io.Discard, body, offset); err == io.EOF {
+			return 0, nil
+		} else if err != nil {
+			return 0, fmt.Errorf("download %s: %w", fileURL, err)
+		}
+	}
+
+	n, err := io.Copy(w, io.LimitReader(body, length))
+	if err != nil {
+		return n, fmt.Errorf("download %s: %w", fileURL, err)
+	}
+	return n, nil
+}
+
+// get requests a file from the download URL, re-authorizing once if the
+// token has expired. byteRange, if set, is sent as the Range header. The
+// caller closes the response body.
+func (c *b2Client) get(ctx context.Context, fileURL, byteRange string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.authorize(ctx); err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		token := c.authToken
+		c.mu.Unlock()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", token)
+		if byteRange != "" {
+			req.Header.Set("Range", byteRange)
+		}
+		c.setCustomerKey(req.Header)
+
+		resp, err := c.downloadClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("download %s: %w", fileURL, err)
+		}
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+			return resp, nil
+		}
+
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		apiErr := newB2Error(resp.StatusCode, data)
+		if apiErr.Code == "expired_auth_token" && attempt == 0 {
+			c.mu.Lock()
+			c.authorized = false
+			c.mu.Unlock()
+			continue
+		}
+		return nil, fmt.Errorf("download %s: %w", fileURL, apiErr)
+	}
+}
+
+// MaxStreamDuration is the longest a streaming URL can stay valid
+const MaxStreamDuration = 7 * 24 * time.Hour
+
+// StreamURL returns a download URL of a file in the bucket that works
+// without credentials until validFor has passed, so a browser or media
+// player can stream it with range requests. Only that file is authorized.
+func (u *B2Uploader) StreamURL(ctx context.Context, fileURL string, validFor time.Duration) (string, error) {
+	if validFor < time.Second || validFor > MaxStreamDuration {
+		return "", fmt.Errorf("streaming URLs must be valid for between 1s and %s", MaxStreamDuration)
+	}
+	name, err := u.RemoteName(fileURL)
+	if err != nil {
+		return "", err
+	}
+	bucketID, err := u.client.ensureBucketID(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		AuthorizationToken string `json:"authorizationToken"`
+	}
+	err = u.client.call(ctx, "b2_get_download_authorization", map[string]interface{}{
+		"bucketId":               bucketID,
+		"fileNamePrefix":         name,
+		"validDurationInSeconds": int64(validFor / time.Second),
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	return fileURL + "?Authorization=" + url.QueryEscape(resp.AuthorizationToken), nil
+}
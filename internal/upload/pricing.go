@@ -0,0 +1,21 @@
+package upload
+
+// B2 list prices in USD, used to estimate what storing and downloading
+// files costs. The first 10 GB stored are free, as is egress up to three
+// times the stored amount, neither of which the estimates account for.
+const (
+	B2StoragePerGBMonth = 0.006
+	B2EgressPerGB       = 0.01
+)
+
+const bytesPerGB = 1e9
+
+// StorageCost estimates the monthly cost of storing bytes in B2
+func StorageCost(bytes int64) float64 {
+	return float64(bytes) / bytesPerGB * B2StoragePerGBMonth
+}
+
+// EgressCost estimates the cost of downloading bytes from B2
+func EgressCost(bytes int64) float64 {
+	return float64(bytes) / bytesPerGB * B2EgressPerGB
+}
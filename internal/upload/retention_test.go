@@ -0,0 +1,99 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetentionHeaders(t *testing.T) {
+	until := time.UnixMilli(1700000000000)
+	header := http.Header{}
+	(&Retention{Mode: RetentionCompliance, Until: until, LegalHold: true}).setHeaders(header)
+	if header.Get("X-Bz-File-Retention-Mode") != "compliance" || header.Get("X-Bz-File-Retain-Until-Timestamp") != "1700000000000" {
+		t.Errorf("unexpected retention headers %v", header)
+	}
+	if header.Get("X-Bz-File-Legal-Hold") != "on" {
+		t.Errorf("legal hold header not set: %v", header)
+	}
+
+	header = http.Header{}
+	(*Retention)(nil).setHeaders(header)
+	if len(header) != 0 {
+		t.Errorf("no retention should set no headers, got %v", header)
+	}
+
+	if CheckRetentionMode("governance") != nil || CheckRetentionMode("forever") == nil {
+		t.Error("CheckRetentionMode accepts the wrong modes")
+	}
+}
+
+func TestSetRetention(t *testing.T) {
+	calls := make(map[string]map[string]interface{})
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/b2api/v2/b2_authorize_account", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"accountId":          "account",
+			"authorizationToken": "token",
+			"apiUrl":             server.URL,
+			"downloadUrl":        server.URL,
+			"allowed":            map[string]string{"bucketId": "bucket-id", "bucketName": "archive"},
+		})
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"files": []b2FileInfo{{FileID: "v2", FileName: "photos/a.jpg", Action: "upload"}},
+		})
+	})
+	for _, operation := range []string{"b2_update_file_retention", "b2_update_file_legal_hold"} {
+		mux.HandleFunc("/b2api/v2/"+operation, func(w http.ResponseWriter, r *http.Request) {
+			var req map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&req)
+			calls[operation] = req
+			json.NewEncoder(w).Encode(req)
+		})
+	}
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "app-key", BucketName: "archive"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uploader.Close()
+	uploader.client.authURL = server.URL + "/b2api/v2/b2_authorize_account"
+
+	ctx := context.Background()
+	fileURL := server.URL + "/file/archive/photos/a.jpg"
+	until := time.UnixMilli(1700000000000)
+	if err := uploader.SetRetention(ctx, fileURL, Retention{Mode: RetentionGovernance, Until: until}); err != nil {
+		t.Fatalf("SetRetention failed: %v", err)
+	}
+	retention := calls["b2_update_file_retention"]
+	if retention["fileId"] != "v2" || retention["fileName"] != "photos/a.jpg" {
+		t.Errorf("retention set on the wrong file: %v", retention)
+	}
+	if setting, _ := retention["fileRetention"].(map[string]interface{}); setting["mode"] != "governance" || setting["retainUntilTimestamp"] != float64(1700000000000) {
+		t.Errorf("unexpected retention %v", retention["fileRetention"])
+	}
+	if _, ok := calls["b2_update_file_legal_hold"]; ok {
+		t.Error("legal hold should be left alone without one")
+	}
+
+	if err := uploader.SetRetention(ctx, fileURL, Retention{LegalHold: true}); err != nil {
+		t.Fatalf("SetRetention failed: %v", err)
+	}
+	if calls["b2_update_file_legal_hold"]["legalHold"] != "on" {
+		t.Errorf("legal hold not placed: %v", calls["b2_update_file_legal_hold"])
+	}
+	if err := uploader.ReleaseLegalHold(ctx, fileURL); err != nil {
+		t.Fatalf("ReleaseLegalHold failed: %v", err)
+	}
+	if calls["b2_update_file_legal_hold"]["legalHold"] != "off" {
+		t.Errorf("legal hold not released: %v", calls["b2_update_file_legal_hold"])
+	}
+}
@@ -0,0 +1,325 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config represents the configuration of an S3 or S3-compatible bucket
+type S3Config struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string // Defaults to us-east-1
+	Endpoint        string // Defaults to AWS; set for S3-compatible providers
+	Bucket          string
+}
+
+// Objects up to maxPutSize are uploaded with one PUT; larger ones in parts
+const (
+	maxPutSize     = 5 << 30
+	minS3PartSize  = 100 << 20
+	maxS3PartCount = 10000
+)
+
+// unsignedPayload is sent as the payload hash of streamed bodies, which
+// can't be hashed ahead of sending them
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Client uploads files to an S3 bucket, addressed path-style so that
+// S3-compatible providers work too
+type S3Client struct {
+	config     S3Config
+	endpoint   *url.URL
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewS3Client creates a client for the bucket
+func NewS3Client(config S3Config) (*S3Client, error) {
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("S3 access key ID and secret access key are required")
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("S3 bucket name is required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+
+	return &S3Client{
+		config:     config,
+		endpoint:   endpoint,
+		httpClient: &http.Client{},
+		now:        time.Now,
+	}, nil
+}
+
+// objectURL returns the URL of an object in the bucket
+func (c *S3Client) objectURL(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.TrimSuffix(c.endpoint.String(), "/") + "/" + s3Escape(c.config.Bucket) + "/" + strings.Join(segments, "/")
+}
+
+// Put uploads a file under the given name, with info stored as metadata
+func (c *S3Client) Put(ctx context.Context, localPath, remotePath string, info map[string]string) (*UploadResult, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	result, err := c.put(ctx, remotePath, f, stat.Size(), detectContentType(localPath), info)
+	if err != nil {
+		return nil, err
+	}
+	result.LocalPath = localPath
+	return result, nil
+}
+
+// PutStream uploads size bytes of body under the given name
+func (c *S3Client) PutStream(ctx context.Context, remotePath string, body io.Reader, size int64, contentType string) (*UploadResult, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("size of %s is unknown", remotePath)
+	}
+	return c.put(ctx, remotePath, body, size, contentType, nil)
+}
+
+// put uploads an object with one PUT, or in parts if it is too large
+func (c *S3Client) put(ctx context.Context, name string, body io.Reader, size int64, contentType string,
+	info map[string]string) (*UploadResult, error) {
+	start := time.Now()
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := http.Header{"Content-Type": {contentType}}
+	for key, value := range info {
+		header.Set("X-Amz-Meta-"+key, value)
+	}
+
+	var err error
+	if size <= maxPutSize {
+		_, err = c.do(ctx, http.MethodPut, name, nil, header, io.LimitReader(body, size), size)
+	} else {
+		err = c.putMultipart(ctx, name, body, size, header)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+
+	return &UploadResult{
+		RemotePath:  name,
+		URL:         c.objectURL(name),
+		Size:        size,
+		ContentType: contentType,
+		UploadedAt:  time.Now(),
+		ElapsedTime: time.Since(start),
+	}, nil
+}
+
+// putMultipart uploads an object in parts. An unfinished upload is aborted.
+func (c *S3Client) putMultipart(ctx context.Context, name string, body io.Reader, size int64, header http.Header) error {
+	partSize := max(int64(minS3PartSize), (size+maxS3PartCount-1)/maxS3PartCount)
+
+	resp, err := c.do(ctx, http.MethodPost, name, url.Values{"uploads": {""}}, header, nil, 0)
+	if err != nil {
+		return err
+	}
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(resp.body, &created); err != nil || created.UploadID == "" {
+		return fmt.Errorf("unexpected response to starting a multipart upload: %s", resp.body)
+	}
+
+	type part struct {
+		PartNumber int
+		ETag       string
+	}
+	var parts []part
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+partSize, number+1 {
+		n := min(partSize, size-offset)
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {created.UploadID}}
+		resp, err := c.do(ctx, http.MethodPut, name, query, nil, io.LimitReader(body, n), n)
+		if err != nil {
+			c.do(context.WithoutCancel(ctx), http.MethodDelete, name, url.Values{"uploadId": {created.UploadID}}, nil, nil, 0)
+			return err
+		}
+		parts = append(parts, part{number, resp.header.Get("ETag")})
+	}
+
+	complete, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{Parts: parts})
+	_, err = c.do(ctx, http.MethodPost, name, url.Values{"uploadId": {created.UploadID}}, nil, bytes.NewReader(complete), int64(len(complete)))
+	return err
+}
+
+// s3Response is the header and body of a successful response
+type s3Response struct {
+	header http.Header
+	body   []byte
+}
+
+// do sends a signed request for an object. The body, of size bytes, is
+// sent unhashed.
+func (c *S3Client) do(ctx context.Context, method, name string, query url.Values, header http.Header,
+	body io.Reader, size int64) (*s3Response, error) {
+	target, err := url.Parse(c.objectURL(name))
+	if err != nil {
+		return nil, err
+	}
+	target.RawQuery = s3Query(query)
+
+	// An empty body is sent as none, or it would be sent chunked
+	if size == 0 {
+		body = nil
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	c.sign(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if xml.Unmarshal(data, &apiErr) == nil && apiErr.Code != "" {
+			return nil, fmt.Errorf("S3 error (status %d): %s: %s", resp.StatusCode, apiErr.Code, apiErr.Message)
+		}
+		return nil, fmt.Errorf("S3 error (status %d)", resp.StatusCode)
+	}
+	return &s3Response{header: resp.Header, body: data}, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to a request,
+// signing the host, any Range and the X-Amz-* headers. The payload hash is
+// taken from X-Amz-Content-Sha256.
+func (c *S3Client) sign(req *http.Request) {
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		lower := strings.ToLower(key)
+		if lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := now.Format("20060102") + "/" + c.config.Region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.config.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, c.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but unreserved characters, as
+// signature version 4 requires
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if 'A' <= ch && ch <= 'Z' || 'a' <= ch && ch <= 'z' || '0' <= ch && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// s3Query encodes query parameters sorted by name, as signature version 4
+// requires
+func s3Query(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, s3Escape(name)+"="+s3Escape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,51 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ShareKey is an application key that can only read and share the files of
+// one bucket. Download authorizations derive from the key that signed them,
+// so deleting it revokes every link it signed before they expire.
+type ShareKey struct {
+	KeyID  string
+	AppKey string
+	Name   string
+}
+
+// CreateShareKey creates a key restricted to reading and sharing the files
+// of the bucket. The configured key needs the writeKeys capability.
+func (u *B2Uploader) CreateShareKey(ctx context.Context) (*ShareKey, error) {
+	bucketID, err := u.client.ensureBucketID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	accountID, err := u.client.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		ApplicationKeyID string `json:"applicationKeyId"`
+		ApplicationKey   string `json:"applicationKey"`
+		KeyName          string `json:"keyName"`
+	}
+	err = u.client.call(ctx, "b2_create_key", map[string]interface{}{
+		"accountId":    accountID,
+		"capabilities": []string{"readFiles", "shareFiles"},
+		"keyName":      fmt.Sprintf("archiver-share-%d", time.Now().Unix()),
+		"bucketId":     bucketID,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &ShareKey{KeyID: resp.ApplicationKeyID, AppKey: resp.ApplicationKey, Name: resp.KeyName}, nil
+}
+
+// DeleteKey deletes an application key of the account. The configured key
+// needs the deleteKeys capability.
+func (u *B2Uploader) DeleteKey(ctx context.Context, keyID string) error {
+	return u.client.call(ctx, "b2_delete_key", map[string]string{"applicationKeyId": keyID}, nil)
+}
@@ -0,0 +1,68 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestShareKeys(t *testing.T) {
+	var created map[string]interface{}
+	var deleted string
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/b2api/v2/b2_authorize_account", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"accountId":          "account",
+			"authorizationToken": "token",
+			"apiUrl":             server.URL,
+			"allowed":            map[string]string{"bucketId": "bucket-id", "bucketName": "archive"},
+		})
+	})
+	mux.HandleFunc("/b2api/v2/b2_create_key", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&created)
+		json.NewEncoder(w).Encode(map[string]string{
+			"applicationKeyId": "share-id",
+			"applicationKey":   "share-secret",
+			"keyName":          created["keyName"].(string),
+		})
+	})
+	mux.HandleFunc("/b2api/v2/b2_delete_key", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		deleted = req["applicationKeyId"]
+		json.NewEncoder(w).Encode(req)
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	uploader, err := NewB2Uploader(B2Config{KeyID: "key-id", AppKey: "app-key", BucketName: "archive"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uploader.Close()
+	uploader.client.authURL = server.URL + "/b2api/v2/b2_authorize_account"
+
+	key, err := uploader.CreateShareKey(context.Background())
+	if err != nil {
+		t.Fatalf("CreateShareKey failed: %v", err)
+	}
+	if key.KeyID != "share-id" || key.AppKey != "share-secret" {
+		t.Errorf("unexpected key %+v", key)
+	}
+	if created["bucketId"] != "bucket-id" || created["accountId"] != "account" {
+		t.Errorf("key should be restricted to the bucket: %v", created)
+	}
+	if caps, _ := created["capabilities"].([]interface{}); len(caps) != 2 || caps[0] != "readFiles" || caps[1] != "shareFiles" {
+		t.Errorf("unexpected capabilities %v", created["capabilities"])
+	}
+
+	if err := uploader.DeleteKey(context.Background(), key.KeyID); err != nil {
+		t.Fatalf("DeleteKey failed: %v", err)
+	}
+	if deleted != "share-id" {
+		t.Errorf("deleted %q, want share-id", deleted)
+	}
+}
@@ -0,0 +1,69 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Stat returns the bucket's record of the file at a download URL
+func (u *B2Uploader) Stat(ctx context.Context, fileURL string) (*RemoteFile, error) {
+	name, err := u.RemoteName(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	info, err := u.client.findFile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	remote := u.client.toRemoteFile(*info)
+	return &remote, nil
+}
+
+// Verify checks that the file at a download URL holds the content of a
+// local file: the sizes must match, and so must the SHA-1 B2 keeps when it
+// has one
+func (u *B2Uploader) Verify(ctx context.Context, fileURL, localPath string) error {
+	remote, err := u.Stat(ctx, fileURL)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	if remote.Size != info.Size() {
+		return fmt.Errorf("%s has %d bytes in the bucket, %d on disk", remote.Name, remote.Size, info.Size())
+	}
+	if remote.SHA1 == "" || remote.SHA1 == "none" {
+		return nil
+	}
+
+	sum, err := fileSHA1(localPath)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, remote.SHA1) {
+		return fmt.Errorf("%s has SHA-1 %s in the bucket, %s on disk", remote.Name, remote.SHA1, sum)
+	}
+	return nil
+}
+
+// fileSHA1 returns the SHA-1 of a file in hex, as B2 reports it
+func fileSHA1(localPath string) (string, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,69 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+// Versions returns the uploaded versions of the file at a download URL,
+// newest first. B2 keeps the versions a new upload under the same name
+// replaces until a lifecycle rule or a delete removes them.
+func (u *B2Uploader) Versions(ctx context.Context, fileURL string) ([]RemoteFile, error) {
+	name, err := u.RemoteName(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := u.client.listFileVersions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []RemoteFile
+	for _, info := range infos {
+		if info.Action == "upload" {
+			versions = append(versions, u.client.toRemoteFile(info))
+		}
+	}
+	return versions, nil
+}
+
+// VersionAt returns the version of the file at a download URL uploaded at
+// uploadedAt, as recorded when it was uploaded
+func (u *B2Uploader) VersionAt(ctx context.Context, fileURL string, uploadedAt time.Time) (*RemoteFile, error) {
+	versions, err := u.Versions(ctx, fileURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		if version.UploadedAt.UnixMilli() == uploadedAt.UnixMilli() {
+			return &version, nil
+		}
+	}
+	return nil, fmt.Errorf("the version of %s uploaded %s is no longer in the bucket", fileURL, uploadedAt.Format(time.RFC3339))
+}
+
+// DownloadVersion writes the content of a version of a file, identified by
+// its B2 file ID, to w
+func (u *B2Uploader) DownloadVersion(ctx context.Context, fileID string, w io.Writer) error {
+	if err := u.client.authorize(ctx); err != nil {
+		return err
+	}
+	u.client.mu.Lock()
+	downloadURL := u.client.downloadURL
+	u.client.mu.Unlock()
+
+	versionURL := downloadURL + "/b2api/v2/b2_download_file_by_id?fileId=" + url.QueryEscape(fileID)
+	resp, err := u.client.get(ctx, versionURL, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("download version %s: %w", fileID, err)
+	}
+	return nil
+}
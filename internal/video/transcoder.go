@@ -3,12 +3,18 @@ package video
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/jth/archiver/internal/audio"
+	"github.com/jth/archiver/internal/scratch"
+	"github.com/jth/archiver/internal/tools"
 )
 
 // TranscodeOptions contains options for video transcoding
@@ -25,6 +31,7 @@ type TranscodeResult struct {
 	InputPath       string
 	OutputPath      string
 	OutputFormat    string
+	Encoder         string
 	DurationSeconds float64
 	SizeBytes       int64
 	Error           error
@@ -50,13 +57,26 @@ func Transcode(ctx context.Context, options TranscodeOptions) (*TranscodeResult,
 		return nil, fmt.Errorf("source file does not exist: %s", options.SourcePath)
 	}
 
-	// Generate output path if not provided
-	if options.OutputPath == "" {
-		dir := filepath.Dir(options.SourcePath)
+	if !tools.Available("ffmpeg") {
+		return nil, fmt.Errorf("ffmpeg not found in PATH, cannot transcode: %w", tools.ErrNotInstalled)
+	}
+
+	// Write to the scratch folder if no output path is provided. A
+	// transcode is rarely larger than its source.
+	inScratch := options.OutputPath == ""
+	if inScratch {
+		info, err := os.Stat(options.SourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat source file: %w", err)
+		}
 		filename := filepath.Base(options.SourcePath)
-		ext := filepath.Ext(filename)
-		basename := strings.TrimSuffix(filename, ext)
-		options.OutputPath = filepath.Join(dir, basename+".transcoded."+options.OutputFormat)
+		basename := strings.TrimSuffix(filename, filepath.Ext(filename))
+		output, err := scratch.Create(basename+"-*.transcoded."+options.OutputFormat, info.Size())
+		if err != nil {
+			return nil, fmt.Errorf("cannot transcode %s: %w", options.SourcePath, err)
+		}
+		output.Close()
+		options.OutputPath = output.Name()
 	}
 
 	// Create output directory if it doesn't exist
@@ -67,11 +87,14 @@ func Transcode(ctx context.Context, options TranscodeOptions) (*TranscodeResult,
 
 	// Build ffmpeg command
 	args := buildFFmpegArgs(options)
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd := tools.Command(ctx, "ffmpeg", args...)
 
 	// Capture output for logging
 	output, err := cmd.CombinedOutput()
 	if err != nil {
+		if inScratch {
+			scratch.Remove(options.OutputPath)
+		}
 		return &TranscodeResult{
 			InputPath:  options.SourcePath,
 			OutputPath: options.OutputPath,
@@ -93,13 +116,14 @@ func Transcode(ctx context.Context, options TranscodeOptions) (*TranscodeResult,
 	duration, err := getVideoDuration(options.OutputPath)
 	if err != nil {
 		// Non-fatal error, just log it
-		fmt.Printf("Warning: could not get video duration: %v\n", err)
+		slog.Warn("could not get video duration", "path", options.OutputPath, "error", err)
 	}
 
 	return &TranscodeResult{
 		InputPath:       options.SourcePath,
 		OutputPath:      options.OutputPath,
 		OutputFormat:    options.OutputFormat,
+		Encoder:         videoEncoder(args),
 		DurationSeconds: duration,
 		SizeBytes:       fileInfo.Size(),
 	}, nil
@@ -145,9 +169,19 @@ func buildFFmpegArgs(options TranscodeOptions) []string {
 	return args
 }
 
+// videoEncoder returns the video codec selected in a set of ffmpeg arguments
+func videoEncoder(args []string) string {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "-c:v" {
+			return args[i+1]
+		}
+	}
+	return "default"
+}
+
 // getVideoDuration gets the duration of a video file in seconds
 func getVideoDuration(videoPath string) (float64, error) {
-	cmd := exec.Command("ffprobe",
+	cmd := exec.Command(tools.Path("ffprobe"),
 		"-v", "error",
 		"-show_entries", "format=duration",
 		"-of", "default=noprint_wrappers=1:nokey=1",
@@ -167,58 +201,47 @@ func getVideoDuration(videoPath string) (float64, error) {
 	return duration, nil
 }
 
-// ExtractAudio extracts audio from a video file
-func ExtractAudio(ctx context.Context, videoPath, outputPath string) error {
+// formats are the extensions of the video files Transcode is used on
+var formats = []string{".mp4", ".m4v", ".mov", ".mkv", ".webm", ".avi", ".mts", ".m2ts", ".mpg", ".mpeg", ".wmv", ".3gp"}
+
+// IsVideo reports whether the file at path is a video, by its extension
+func IsVideo(path string) bool {
+	return slices.Contains(formats, strings.ToLower(filepath.Ext(path)))
+}
+
+// ExtractAudio extracts audio from a video file, into the scratch folder if
+// outputPath is empty, and returns the path it was written to
+func ExtractAudio(ctx context.Context, videoPath, outputPath string) (string, error) {
 	if outputPath == "" {
-		dir := filepath.Dir(videoPath)
 		filename := filepath.Base(videoPath)
-		ext := filepath.Ext(filename)
-		basename := strings.TrimSuffix(filename, ext)
-		outputPath = filepath.Join(dir, basename+".mp3")
+		basename := strings.TrimSuffix(filename, filepath.Ext(filename))
+		output, err := scratch.Create(basename+"-*.mp3", 0)
+		if err != nil {
+			return "", fmt.Errorf("cannot extract audio from %s: %w", videoPath, err)
+		}
+		output.Close()
+		outputPath = output.Name()
 	}
 
-	cmd := exec.CommandContext(ctx, "ffmpeg",
+	cmd := tools.Command(ctx, "ffmpeg",
+		"-y",
 		"-i", videoPath,
 		"-q:a", "0",
 		"-map", "a",
 		outputPath,
 	)
 
-	return cmd.Run()
+	return outputPath, cmd.Run()
 }
 
 // GenerateWhisperTranscript generates a transcript using Whisper
 func GenerateWhisperTranscript(ctx context.Context, audioPath string) (string, error) {
-	// Check if whisper exists
-	_, err := exec.LookPath("whisper")
-	if err != nil {
-		return "", fmt.Errorf("whisper not found in PATH, cannot generate transcript")
-	}
-
-	outputDir := filepath.Dir(audioPath)
-	baseFileName := strings.TrimSuffix(filepath.Base(audioPath), filepath.Ext(audioPath))
-	outputTxtPath := filepath.Join(outputDir, baseFileName+".txt")
-
-	// Run whisper with a timeout
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "whisper",
-		"--model", "tiny", // Use tiny model for speed
-		"--output_format", "txt",
-		"--output_dir", outputDir,
-		audioPath,
-	)
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("whisper transcription failed: %w", err)
-	}
-
-	// Read the transcript
-	transcript, err := os.ReadFile(outputTxtPath)
+	transcript, err := audio.Whisper{}.Transcribe(ctx, audioPath, audio.Options{
+		Model:   "tiny", // Use tiny model for speed
+		Timeout: 30 * time.Minute,
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to read transcript file: %w", err)
+		return "", err
 	}
-
-	return string(transcript), nil
+	return transcript.Text, nil
 }